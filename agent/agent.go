@@ -0,0 +1,341 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/fetch"
+	"github.com/moffa90/go-cyacd/fwcache"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Default configuration values.
+const (
+	// DefaultTopicPrefix is the default prefix of the agent's topics
+	DefaultTopicPrefix = "cyacd"
+
+	// DefaultMaxImageSize is the default limit on the size of downloaded images
+	DefaultMaxImageSize = 16 << 20
+
+	// DefaultProgressInterval is the default minimum time between published
+	// progress reports
+	DefaultProgressInterval = time.Second
+
+	// queueSize is the number of commands that may wait while one runs
+	queueSize = 8
+)
+
+// Client is the part of an MQTT client the agent uses. Handlers may be called
+// from any goroutine.
+type Client interface {
+	// Subscribe registers handler for messages on topic.
+	Subscribe(topic string, handler func(topic string, payload []byte)) error
+
+	// Publish sends payload to topic.
+	Publish(topic string, payload []byte) error
+}
+
+// Opener opens the device behind a named transport, such as a serial port
+// path. A device that implements io.Closer is closed after programming.
+type Opener func(ctx context.Context, name string) (io.ReadWriter, error)
+
+// Command is a firmware-update command received on the update topic.
+type Command struct {
+	// ID identifies the command in progress reports and results
+	ID string `json:"id"`
+
+	// URL is the HTTP(S) location of the .cyacd or .cyacd2 image
+	URL string `json:"url"`
+
+	// SHA256 is the hex-encoded SHA-256 digest of the image
+	SHA256 string `json:"sha256"`
+
+	// Transport names the device to program, passed to the Opener
+	Transport string `json:"transport"`
+
+	// Key is the bootloader key as 12 hex digits, or "none" for a bootloader
+	// built without a key (.cyacd images only)
+	Key string `json:"key,omitempty"`
+}
+
+// Result is published on the result topic when a command ends.
+type Result struct {
+	ID         string          `json:"id"`
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+	Report     json.RawMessage `json:"report,omitempty"`
+}
+
+// progressMessage is published on the progress topic.
+type progressMessage struct {
+	ID         string           `json:"id"`
+	Phase      bootloader.Phase `json:"phase"`
+	Percentage float64          `json:"percentage"`
+	CurrentRow int              `json:"current_row"`
+	TotalRows  int              `json:"total_rows"`
+}
+
+// Option configures an Agent.
+type Option func(*Agent)
+
+// WithTopicPrefix sets the prefix of the update, progress, and result topics.
+// Default is DefaultTopicPrefix ("cyacd").
+//
+// Example:
+//
+//	a := agent.New(client, open, agent.WithTopicPrefix("site1/gw42/cyacd"))
+func WithTopicPrefix(prefix string) Option {
+	return func(a *Agent) {
+		a.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithHTTPClient sets the client used to download images.
+// Default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Agent) {
+		a.http = client
+	}
+}
+
+// WithMaxImageSize limits the size of downloaded images.
+// Default is DefaultMaxImageSize (16 MiB).
+func WithMaxImageSize(size int64) Option {
+	return func(a *Agent) {
+		if size > 0 {
+			a.maxImage = size
+		}
+	}
+}
+
+// WithProgrammerOptions sets options applied to the Programmer of every
+// command. Progress reports are published at most every
+// DefaultProgressInterval unless the options include
+// bootloader.WithProgressInterval.
+func WithProgrammerOptions(opts ...bootloader.Option) Option {
+	return func(a *Agent) {
+		a.progOpts = append(a.progOpts, opts...)
+	}
+}
+
+// WithCache keeps downloaded and parsed images in cache, so commands that
+// flash the same release to several devices download and parse it once.
+// Default is no cache: every command downloads its image.
+//
+// Example:
+//
+//	cache, err := fwcache.Open("/var/cache/cyacd")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	a := agent.New(client, open, agent.WithCache(cache))
+func WithCache(cache *fwcache.Cache) Option {
+	return func(a *Agent) {
+		a.cache = cache
+	}
+}
+
+// Agent runs firmware-update commands received over MQTT.
+type Agent struct {
+	client   Client
+	open     Opener
+	prefix   string
+	http     *http.Client
+	maxImage int64
+	progOpts []bootloader.Option
+	cache    *fwcache.Cache
+}
+
+// New returns an Agent that receives commands through client and opens
+// transports with open. It panics if client or open is nil.
+func New(client Client, open Opener, opts ...Option) *Agent {
+	if client == nil || open == nil {
+		panic("agent: nil Client or Opener")
+	}
+	a := &Agent{
+		client:   client,
+		open:     open,
+		prefix:   DefaultTopicPrefix,
+		http:     http.DefaultClient,
+		maxImage: DefaultMaxImageSize,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// topic returns the topic with the given suffix.
+func (a *Agent) topic(suffix string) string {
+	return a.prefix + "/" + suffix
+}
+
+// Run subscribes to the update topic and runs the commands received, one at
+// a time in arrival order, until ctx is done. Commands that arrive while
+// too many others are waiting are rejected with a result. Run returns the
+// subscription error or ctx.Err().
+func (a *Agent) Run(ctx context.Context) error {
+	queue := make(chan Command, queueSize)
+	err := a.client.Subscribe(a.topic("update"), func(_ string, payload []byte) {
+		var cmd Command
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			a.publish("result", Result{Error: fmt.Sprintf("invalid command: %v", err)})
+			return
+		}
+		select {
+		case queue <- cmd:
+		default:
+			a.publish("result", Result{ID: cmd.ID, Error: "agent busy: too many queued commands"})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case cmd := <-queue:
+			a.publish("result", a.Execute(ctx, cmd))
+		}
+	}
+}
+
+// Execute downloads, checks, and programs the image of cmd, publishing
+// progress while programming, and returns the result. Run calls it for every
+// command received; it can also be called directly, e.g. for commands that
+// arrive by another route.
+func (a *Agent) Execute(ctx context.Context, cmd Command) Result {
+	start := time.Now()
+	result := Result{ID: cmd.ID}
+	report, err := a.execute(ctx, cmd)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if report != nil {
+		var buf bytes.Buffer
+		if report.WriteJSON(&buf) == nil {
+			result.Report = json.RawMessage(bytes.TrimSpace(buf.Bytes()))
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func (a *Agent) execute(ctx context.Context, cmd Command) (*bootloader.ProgramReport, error) {
+	if cmd.Transport == "" {
+		return nil, errors.New("no transport given")
+	}
+	image, err := a.download(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		v1  *cyacd.Firmware
+		v2  *cyacd.Firmware2
+		key []byte
+	)
+	if cyacd.IsCyacd2(cmd.URL, image) {
+		v2, err = cyacd.ParseReader2(bytes.NewReader(image))
+	} else {
+		v1, err = a.parse(ctx, cmd, image)
+		if err == nil {
+			key, err = protocol.ParseKey(cmd.Key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key: %w", err)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse image: %w", err)
+	}
+
+	device, err := a.open(ctx, cmd.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("open transport: %w", err)
+	}
+	if c, ok := device.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	opts := append([]bootloader.Option{bootloader.WithProgressInterval(DefaultProgressInterval)}, a.progOpts...)
+	opts = append(opts, bootloader.WithProgressCallback(func(p bootloader.Progress) {
+		a.publish("progress", progressMessage{ID: cmd.ID, Phase: p.Phase, Percentage: p.Percentage,
+			CurrentRow: p.CurrentRow, TotalRows: p.TotalRows})
+	}))
+	prog, err := bootloader.NewProgrammer(device, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if v2 != nil {
+		return nil, prog.ProgramV2(ctx, v2)
+	}
+	return prog.ProgramWithReport(ctx, v1, key)
+}
+
+// download fetches the image of cmd and checks its digest.
+func (a *Agent) download(ctx context.Context, cmd Command) ([]byte, error) {
+	want, err := hex.DecodeString(cmd.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return nil, errors.New("command needs the SHA-256 digest of the image")
+	}
+
+	if a.cache != nil {
+		image, err := a.cache.Download(ctx, cmd.URL, cmd.SHA256, a.fetchOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("download: %w", err)
+		}
+		return image, nil
+	}
+	res, err := fetch.Fetch(ctx, cmd.URL, append(a.fetchOptions(), fetch.WithSHA256(cmd.SHA256))...)
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	return res.Data, nil
+}
+
+// parse parses a downloaded .cyacd image, reusing the parsed image kept in
+// the cache for the same digest.
+func (a *Agent) parse(ctx context.Context, cmd Command, image []byte) (*cyacd.Firmware, error) {
+	if a.cache != nil {
+		return a.cache.Firmware(ctx, cmd.URL, cmd.SHA256, a.fetchOptions()...)
+	}
+	return cyacd.ParseReader(bytes.NewReader(image))
+}
+
+// fetchOptions returns the options of image downloads. The digest of the
+// command pins the image, so plain HTTP servers are allowed.
+func (a *Agent) fetchOptions() []fetch.Option {
+	return []fetch.Option{
+		fetch.WithHTTPClient(a.http),
+		fetch.WithMaxSize(a.maxImage),
+		fetch.WithAllowHTTP(),
+	}
+}
+
+// publish sends v as JSON to the topic with the given suffix. Publish errors
+// are dropped: the broker connection is the client library's to recover.
+func (a *Agent) publish(suffix string, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_ = a.client.Publish(a.topic(suffix), payload)
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/fwcache"
+)
+
+// broker is an in-memory Client.
+type broker struct {
+	mu        sync.Mutex
+	handlers  map[string]func(string, []byte)
+	published map[string][][]byte
+	results   chan Result
+}
+
+func newBroker() *broker {
+	return &broker{
+		handlers:  make(map[string]func(string, []byte)),
+		published: make(map[string][][]byte),
+		results:   make(chan Result, 4),
+	}
+}
+
+func (b *broker) Subscribe(topic string, handler func(string, []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = handler
+	return nil
+}
+
+func (b *broker) Publish(topic string, payload []byte) error {
+	b.mu.Lock()
+	b.published[topic] = append(b.published[topic], payload)
+	b.mu.Unlock()
+
+	if topic == "gw/result" {
+		var r Result
+		json.Unmarshal(payload, &r)
+		b.results <- r
+	}
+	return nil
+}
+
+// send delivers a message once the topic has a subscriber.
+func (b *broker) send(t *testing.T, topic string, v interface{}) {
+	t.Helper()
+	payload, _ := json.Marshal(v)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		b.mu.Lock()
+		handler := b.handlers[topic]
+		b.mu.Unlock()
+		if handler != nil {
+			handler(topic, payload)
+			return
+		}
+	}
+	t.Fatalf("nobody subscribed to %s", topic)
+}
+
+func (b *broker) result(t *testing.T) Result {
+	t.Helper()
+	select {
+	case r := <-b.results:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result published")
+		return Result{}
+	}
+}
+
+func TestAgent(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 3; i++ {
+		fw.Rows = append(fw.Rows, cyacd.NewRow(0, uint16(0x10+i), bytes.Repeat([]byte{byte(i)}, 64)))
+	}
+	var image bytes.Buffer
+	fw.WriteTo(&image)
+	sum := sha256.Sum256(image.Bytes())
+
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(image.Bytes())
+	}))
+	defer files.Close()
+
+	device := bootloadertest.NewDevice()
+	b := newBroker()
+	a := New(b, func(ctx context.Context, name string) (io.ReadWriter, error) {
+		return device, nil
+	}, WithTopicPrefix("gw/"), WithProgrammerOptions(bootloader.WithVerifyAfterProgram(false), bootloader.WithProgressInterval(0)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	cmd := Command{ID: "c1", URL: files.URL + "/app.cyacd", SHA256: hex.EncodeToString(sum[:]),
+		Transport: "port0", Key: "0A1B2C3D4E5F"}
+	b.send(t, "gw/update", cmd)
+	if r := b.result(t); !r.Success || r.ID != "c1" || len(r.Report) == 0 {
+		t.Errorf("result = %+v", r)
+	}
+	if _, ok := device.Row(0, 0x12); !ok {
+		t.Error("row 0x12 not programmed")
+	}
+	b.mu.Lock()
+	progress := len(b.published["gw/progress"])
+	b.mu.Unlock()
+	if progress == 0 {
+		t.Error("no progress published")
+	}
+
+	// A corrupted download is not programmed
+	cmd.ID, cmd.SHA256 = "c2", hex.EncodeToString(make([]byte, sha256.Size))
+	b.send(t, "gw/update", cmd)
+	if r := b.result(t); r.Success || r.ID != "c2" {
+		t.Errorf("result with wrong digest = %+v", r)
+	}
+
+	// A bootloader without a key is flashed with "none", not with no key
+	cmd.ID, cmd.SHA256, cmd.Key = "c3", hex.EncodeToString(sum[:]), ""
+	b.send(t, "gw/update", cmd)
+	if r := b.result(t); r.Success || r.ID != "c3" {
+		t.Errorf("result without a key = %+v", r)
+	}
+	cmd.ID, cmd.Key = "c4", "none"
+	b.send(t, "gw/update", cmd)
+	if r := b.result(t); !r.Success || r.ID != "c4" {
+		t.Errorf("result with key none = %+v", r)
+	}
+
+	b.send(t, "gw/update", "not a command")
+	if r := b.result(t); r.Success || r.Error == "" {
+		t.Errorf("result of an invalid command = %+v", r)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v, want context.Canceled", err)
+	}
+}
+
+func TestAgentCache(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	fw.Rows = append(fw.Rows, cyacd.NewRow(0, 0x10, bytes.Repeat([]byte{0x5A}, 64)))
+	var image bytes.Buffer
+	fw.WriteTo(&image)
+	sum := sha256.Sum256(image.Bytes())
+
+	var requests int32
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(image.Bytes())
+	}))
+	defer files.Close()
+
+	cache, err := fwcache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := make(map[string]*bootloadertest.Device)
+	a := New(newBroker(), func(ctx context.Context, name string) (io.ReadWriter, error) {
+		devices[name] = bootloadertest.NewDevice()
+		return devices[name], nil
+	}, WithCache(cache), WithProgrammerOptions(bootloader.WithVerifyAfterProgram(false)))
+
+	for _, port := range []string{"port0", "port1", "port2"} {
+		cmd := Command{ID: port, URL: files.URL + "/app.cyacd", SHA256: hex.EncodeToString(sum[:]),
+			Transport: port, Key: "0A1B2C3D4E5F"}
+		if r := a.Execute(context.Background(), cmd); !r.Success {
+			t.Fatalf("Execute(%s) = %+v", port, r)
+		}
+		if _, ok := devices[port].Row(0, 0x10); !ok {
+			t.Errorf("%s: row 0x10 not programmed", port)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+}
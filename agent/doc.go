@@ -0,0 +1,57 @@
+// Package agent implements a remote flashing agent for gateways that receive
+// firmware-update commands over MQTT. The agent subscribes to a command
+// topic, downloads and checks the image named by each command, programs it
+// with the bootloader package, and publishes progress and the result.
+//
+// # Topics
+//
+// With the default prefix "cyacd", the agent uses:
+//
+//	cyacd/update    commands (subscribed)
+//	cyacd/progress  progress reports while programming (published)
+//	cyacd/result    the outcome of each command (published)
+//
+// Use WithTopicPrefix to give every gateway its own topics, e.g.
+// "site1/gw42/cyacd".
+//
+// A command is a JSON object:
+//
+//	{
+//	  "id": "rollout-17",
+//	  "url": "https://updates.example.com/app-1.4.cyacd",
+//	  "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+//	  "transport": "/dev/ttyACM0",
+//	  "key": "0A1B2C3D4E5F"
+//	}
+//
+// The SHA-256 digest is required; images that do not match it are not
+// programmed. The key is parsed with protocol.ParseKey, so it is "none" for a
+// bootloader built without a key, and is not needed for .cyacd2 images.
+//
+// # MQTT Client
+//
+// The module has no dependencies, so the agent talks to the broker through
+// the small Client interface. An adapter for a client library such as
+// Eclipse Paho takes a few lines:
+//
+//	type pahoClient struct{ c mqtt.Client }
+//
+//	func (p pahoClient) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+//	    t := p.c.Subscribe(topic, 1, func(_ mqtt.Client, m mqtt.Message) { handler(m.Topic(), m.Payload()) })
+//	    t.Wait()
+//	    return t.Error()
+//	}
+//
+//	func (p pahoClient) Publish(topic string, payload []byte) error {
+//	    t := p.c.Publish(topic, 1, false, payload)
+//	    t.Wait()
+//	    return t.Error()
+//	}
+//
+// # Usage
+//
+//	a := agent.New(pahoClient{c}, func(ctx context.Context, name string) (io.ReadWriter, error) {
+//	    return openSerialPort(name)
+//	}, agent.WithTopicPrefix("site1/gw42/cyacd"))
+//	log.Fatal(a.Run(ctx))
+package agent
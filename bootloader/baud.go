@@ -0,0 +1,89 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// DefaultBaudRates are the UART speeds tried by DetectBaudRate when no list is
+// given: the PSoC Creator default first, then common alternatives.
+var DefaultBaudRates = []int{115200, 57600, 38400, 19200, 9600, 230400, 460800, 921600}
+
+// BaudSetter changes the baud rate of the serial port behind the device, e.g.
+// by calling SetMode on a go.bug.st/serial port.
+type BaudSetter func(baud int) error
+
+// DetectBaudRate finds the UART speed the bootloader is configured for. For each
+// rate in rates (DefaultBaudRates if empty) it switches the port with setBaud,
+// resynchronizes the bootloader with Sync Bootloader, and sends Enter Bootloader
+// with key. It locks onto the first rate the bootloader answers at and returns
+// it together with the device identification; the device is left in bootloader
+// mode at that rate.
+//
+// A rate at which the bootloader answers with an error status (e.g. a wrong key)
+// is still the right rate: DetectBaudRate stops there and returns the rate with
+// the *protocol.ProtocolError. Probing is bounded by the read timeout, so set a
+// short one (e.g. WithReadTimeout(300*time.Millisecond)) when many rates are tried.
+//
+// Example:
+//
+//	baud, info, err := prog.DetectBaudRate(ctx, func(baud int) error {
+//	    return port.SetMode(&serial.Mode{BaudRate: baud})
+//	}, nil, key)
+func (p *Programmer) DetectBaudRate(ctx context.Context, setBaud BaudSetter, rates []int, key []byte) (int, *protocol.DeviceInfo, error) {
+	if setBaud == nil {
+		return 0, nil, fmt.Errorf("baud setter cannot be nil")
+	}
+	if err := protocol.ValidateKey(key); err != nil {
+		return 0, nil, err
+	}
+	if len(rates) == 0 {
+		rates = DefaultBaudRates
+	}
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer finish()
+
+	var lastErr error
+	for _, baud := range rates {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, fmt.Errorf("canceled: %w", err)
+		}
+
+		if err := setBaud(baud); err != nil {
+			return 0, nil, fmt.Errorf("set baud rate %d: %w", baud, err)
+		}
+
+		info, err := p.probeBaudRate(ctx, key)
+		if err == nil {
+			p.logInfo("bootloader found", "baud", baud)
+			p.setState(StateInBootloader)
+			return baud, info, nil
+		}
+
+		var protoErr *protocol.ProtocolError
+		if errors.As(err, &protoErr) {
+			return baud, nil, err
+		}
+
+		p.logDebug("no response at baud rate", "baud", baud, "error", err)
+		lastErr = err
+	}
+
+	return 0, nil, fmt.Errorf("bootloader did not respond at any of %d baud rates: %w", len(rates), lastErr)
+}
+
+// probeBaudRate tries to enter the bootloader at the current baud rate.
+func (p *Programmer) probeBaudRate(ctx context.Context, key []byte) (*protocol.DeviceInfo, error) {
+	// Garbage received at the previous rate may have left a partial frame behind
+	if err := p.resync(ctx); err != nil {
+		return nil, err
+	}
+	return p.enterBootloader(ctx, key)
+}
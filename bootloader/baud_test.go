@@ -0,0 +1,108 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// baudDevice only understands frames sent at the bootloader's baud rate
+type baudDevice struct {
+	device *bootloadertest.Device
+	baud   int
+	want   int
+}
+
+func (d *baudDevice) Read(p []byte) (int, error) {
+	if d.baud != d.want {
+		return 0, io.EOF
+	}
+	return d.device.Read(p)
+}
+
+func (d *baudDevice) Write(p []byte) (int, error) {
+	if d.baud != d.want {
+		return len(p), nil
+	}
+	return d.device.Write(p)
+}
+
+func (d *baudDevice) ResetInputBuffer() error {
+	return d.device.ResetInputBuffer()
+}
+
+func TestDetectBaudRate(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("locks onto responding rate", func(t *testing.T) {
+		device := &baudDevice{device: bootloadertest.NewDevice(), want: 38400}
+		var tried []int
+		setBaud := func(baud int) error {
+			tried = append(tried, baud)
+			device.baud = baud
+			return nil
+		}
+
+		prog := New(device)
+		baud, info, err := prog.DetectBaudRate(context.Background(), setBaud, nil, key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if baud != 38400 {
+			t.Errorf("baud = %d, want 38400", baud)
+		}
+		if info == nil || info.SiliconID != bootloadertest.DefaultSiliconID {
+			t.Errorf("info = %+v", info)
+		}
+		if want := []int{115200, 57600, 38400}; !reflect.DeepEqual(tried, want) {
+			t.Errorf("tried %v, want %v", tried, want)
+		}
+		if !device.device.InBootloader() {
+			t.Error("device not left in bootloader")
+		}
+	})
+
+	t.Run("wrong key still identifies rate", func(t *testing.T) {
+		device := &baudDevice{device: bootloadertest.NewDevice(bootloadertest.WithKey(key)), want: 9600}
+		setBaud := func(baud int) error {
+			device.baud = baud
+			return nil
+		}
+
+		baud, _, err := New(device).DetectBaudRate(context.Background(), setBaud, []int{19200, 9600},
+			[]byte{1, 2, 3, 4, 5, 6})
+		var protoErr *protocol.ProtocolError
+		if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrKey {
+			t.Fatalf("error = %v, want bad key status", err)
+		}
+		if baud != 9600 {
+			t.Errorf("baud = %d, want 9600", baud)
+		}
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		device := &baudDevice{device: bootloadertest.NewDevice(), want: 1200}
+		setBaud := func(baud int) error {
+			device.baud = baud
+			return nil
+		}
+
+		baud, _, err := New(device).DetectBaudRate(context.Background(), setBaud, []int{9600, 19200}, key)
+		if err == nil || baud != 0 {
+			t.Fatalf("baud = %d, error = %v, want failure", baud, err)
+		}
+	})
+
+	t.Run("setter failure", func(t *testing.T) {
+		setBaud := func(baud int) error { return errors.New("unsupported rate") }
+		_, _, err := New(NewMockDevice()).DetectBaudRate(context.Background(), setBaud, []int{9600}, key)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -1,6 +1,11 @@
 package bootloader
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Phase represents the current operation phase during firmware programming.
 // Use the exported Phase constants for type-safe comparisons.
@@ -28,16 +33,29 @@ const (
 	// PhaseProgramming indicates flash rows are being programmed
 	PhaseProgramming Phase = "programming"
 
+	// PhaseErasing indicates flash rows are being erased (see Plan.EraseRange)
+	PhaseErasing Phase = "erasing"
+
 	// PhaseVerifying indicates firmware is being verified
 	PhaseVerifying Phase = "verifying"
 
 	// PhaseExiting indicates the bootloader is being exited
 	PhaseExiting Phase = "exiting"
 
+	// PhaseWaiting indicates the programmer is waiting for the application to
+	// start after exiting the bootloader (see WithWaitForApplication)
+	PhaseWaiting Phase = "waiting"
+
 	// PhaseComplete indicates the operation completed successfully
 	PhaseComplete Phase = "complete"
 )
 
+// String returns the phase name, e.g. "programming". Phases marshal to JSON
+// as the same string.
+func (p Phase) String() string {
+	return string(p)
+}
+
 // Progress contains information about the programming progress.
 // Passed to ProgressCallback during programming operations.
 type Progress struct {
@@ -49,6 +67,7 @@ type Progress struct {
 	CurrentRow int
 
 	// TotalRows is the total number of rows to program
+	// (excluding rows skipped by the row filter)
 	TotalRows int
 
 	// Percentage is the completion percentage (0.0 to 100.0)
@@ -59,6 +78,127 @@ type Progress struct {
 
 	// ElapsedTime is the time elapsed since programming started
 	ElapsedTime time.Duration
+
+	// TotalBytes is the total number of row data bytes to program
+	TotalBytes int
+
+	// BytesPerSecond is the row data throughput measured since row programming started
+	// (0 until the first row has been programmed)
+	BytesPerSecond float64
+
+	// EstimatedRemaining is the estimated time until all rows are programmed,
+	// based on BytesPerSecond. Only set during PhaseProgramming; 0 when unknown.
+	EstimatedRemaining time.Duration
+
+	// ChunkIndex is the number of chunks of the current row sent so far.
+	// Rows larger than one packet are sent as several Send Data chunks
+	// followed by a final Program Row command.
+	ChunkIndex int
+
+	// ChunkCount is the total number of chunks for the current row
+	// (0 outside of row programming)
+	ChunkCount int
+
+	// PhaseStartedAt is the time the current phase started
+	PhaseStartedAt time.Time
+
+	// RowsSkipped is the number of firmware rows excluded by the row filter
+	// (see WithRowFilter) or dropped as bootloader rows (see WithSkipBootloaderRows)
+	RowsSkipped int
+
+	// Step is the index of the running step when executing a Plan (0-based)
+	Step int
+
+	// Steps is the number of steps of the running Plan (0 outside of RunPlan)
+	Steps int
+}
+
+// String returns a one-line summary of the report, e.g.
+//
+//	programming 42.0% (row 21/50, 2688/6400 bytes, 1344 B/s, 3s left)
+//
+// Only the fields known at the time of the report are included.
+func (p Progress) String() string {
+	var b strings.Builder
+	if p.Steps > 0 {
+		fmt.Fprintf(&b, "step %d/%d ", p.Step+1, p.Steps)
+	}
+	fmt.Fprintf(&b, "%s %.1f%%", p.Phase, p.Percentage)
+
+	var details []string
+	if p.TotalRows > 0 {
+		details = append(details, fmt.Sprintf("row %d/%d", p.CurrentRow, p.TotalRows))
+	}
+	if p.TotalBytes > 0 {
+		details = append(details, fmt.Sprintf("%d/%d bytes", p.BytesWritten, p.TotalBytes))
+	}
+	if p.BytesPerSecond > 0 {
+		details = append(details, fmt.Sprintf("%.0f B/s", p.BytesPerSecond))
+	}
+	if remaining := p.EstimatedRemaining.Round(time.Second); remaining > 0 {
+		details = append(details, remaining.String()+" left")
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(details, ", "))
+	}
+	return b.String()
+}
+
+// progressJSON is the stable JSON representation of a Progress. Fields are
+// only ever added.
+type progressJSON struct {
+	Phase          Phase      `json:"phase"`
+	Percentage     float64    `json:"percentage"`
+	CurrentRow     int        `json:"current_row"`
+	TotalRows      int        `json:"total_rows"`
+	RowsSkipped    int        `json:"rows_skipped"`
+	BytesWritten   int        `json:"bytes_written"`
+	TotalBytes     int        `json:"total_bytes"`
+	ElapsedMs      int64      `json:"elapsed_ms"`
+	BytesPerSecond float64    `json:"bytes_per_second"`
+	RemainingMs    int64      `json:"remaining_ms"`
+	ChunkIndex     int        `json:"chunk_index"`
+	ChunkCount     int        `json:"chunk_count"`
+	PhaseStartedAt *time.Time `json:"phase_started_at,omitempty"`
+	Step           int        `json:"step"`
+	Steps          int        `json:"steps"`
+}
+
+// MarshalJSON encodes the report with snake_case field names, durations in
+// whole milliseconds (elapsed_ms, remaining_ms), and phase_started_at in RFC
+// 3339 format (omitted when unset), so it can be forwarded to web clients
+// as is.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithProgressCallback(func(p bootloader.Progress) {
+//	        data, _ := json.Marshal(p)
+//	        ws.WriteMessage(websocket.TextMessage, data)
+//	    }),
+//	)
+func (p Progress) MarshalJSON() ([]byte, error) {
+	v := progressJSON{
+		Phase:          p.Phase,
+		Percentage:     p.Percentage,
+		CurrentRow:     p.CurrentRow,
+		TotalRows:      p.TotalRows,
+		RowsSkipped:    p.RowsSkipped,
+		BytesWritten:   p.BytesWritten,
+		TotalBytes:     p.TotalBytes,
+		ElapsedMs:      p.ElapsedTime.Milliseconds(),
+		BytesPerSecond: p.BytesPerSecond,
+		RemainingMs:    p.EstimatedRemaining.Milliseconds(),
+		ChunkIndex:     p.ChunkIndex,
+		ChunkCount:     p.ChunkCount,
+		Step:           p.Step,
+		Steps:          p.Steps,
+	}
+	if !p.PhaseStartedAt.IsZero() {
+		t := p.PhaseStartedAt.UTC()
+		v.PhaseStartedAt = &t
+	}
+	return json.Marshal(v)
 }
 
 // ProgressCallback is called periodically during programming to report progress.
@@ -74,6 +214,66 @@ type Progress struct {
 //	)
 type ProgressCallback func(Progress)
 
+// PhaseCallback is called once per phase transition with the previous and new
+// phase (old is empty for the first phase reported by a Programmer). It is
+// called before the ProgressCallback receives the first report of the new phase,
+// synchronously from the goroutine running the operation, and should return quickly.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithPhaseCallback(func(old, new bootloader.Phase) {
+//	        fmt.Printf("\n%s\n", strings.ToUpper(string(new)))
+//	    }),
+//	)
+type PhaseCallback func(old, new Phase)
+
+// RowResult describes the outcome of programming a single flash row.
+// Passed to RowCallback after each row, including rows that failed.
+type RowResult struct {
+	// Index is the position of the row in programming order (0-based)
+	Index int
+
+	// ArrayID is the flash array of the row
+	ArrayID byte
+
+	// RowNum is the flash row number
+	RowNum uint16
+
+	// Bytes is the number of row data bytes
+	Bytes int
+
+	// Duration is the time spent programming and verifying the row, including retries
+	Duration time.Duration
+
+	// Verified reports whether the row checksum was read back and matched
+	// (false when VerifyAfterProgram is disabled and for rows skipped by
+	// WithVerifyEvery, unless WithAdaptiveVerify verified a retried row)
+	Verified bool
+
+	// DeviceChecksum is the row checksum reported by the device during verification
+	DeviceChecksum byte
+
+	// Retries is the number of times the row was retried after a transient failure
+	Retries int
+
+	// Err is the error that caused the row to fail, or nil on success
+	Err error
+}
+
+// RowCallback is called after each row is programmed, with the row's outcome.
+// It is finer-grained than ProgressCallback and is suitable for per-row audit logs.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithRowCallback(func(r bootloader.RowResult) {
+//	        fmt.Fprintf(auditLog, "%d,%d,%d,%s,%t,%d\n",
+//	            r.ArrayID, r.RowNum, r.Bytes, r.Duration, r.Verified, r.Retries)
+//	    }),
+//	)
+type RowCallback func(RowResult)
+
 // Logger is an optional logging interface that can be provided to the programmer.
 // This allows integration with any logging framework.
 //
@@ -85,6 +285,11 @@ type ProgressCallback func(Progress)
 //	func (l *StdLogger) Error(msg string, kv ...interface{}) { log.Println(msg, kv) }
 //
 //	prog := bootloader.New(device, bootloader.WithLogger(&StdLogger{}))
+//
+// Messages use stable keys so that log pipelines can index them: "phase"
+// (a Phase), "array" and "row" (the flash row), "attempt" (1 for the first
+// try), "duration" (a time.Duration string) and "error". Messages below the
+// level set with WithLogLevel are not passed to the Logger.
 type Logger interface {
 	// Debug logs a debug message with optional key-value pairs
 	Debug(msg string, keysAndValues ...interface{})
@@ -95,3 +300,49 @@ type Logger interface {
 	// Error logs an error message with optional key-value pairs
 	Error(msg string, keysAndValues ...interface{})
 }
+
+// WarnLogger is implemented by loggers with a warning level. Warnings, such as
+// an overridden silicon ID check, are logged with Warn when the Logger
+// implements it and with Info otherwise.
+type WarnLogger interface {
+	Warn(msg string, keysAndValues ...interface{})
+}
+
+// LogLevel is the minimum severity of the messages passed to the Logger.
+type LogLevel int
+
+// Log levels, from the most to the least verbose.
+const (
+	// LogDebug passes all messages, including per-row and per-command detail
+	LogDebug LogLevel = iota
+
+	// LogInfo passes informational messages, warnings and errors
+	LogInfo
+
+	// LogWarn passes warnings and errors
+	LogWarn
+
+	// LogError passes errors only
+	LogError
+
+	// LogOff passes no messages
+	LogOff
+)
+
+// String returns the name of the level.
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	case LogOff:
+		return "off"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
@@ -0,0 +1,107 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// chunkSizeCandidates are the Send Data sizes tried by NegotiateChunkSize, largest first.
+var chunkSizeCandidates = []int{MaxChunkSize, 128, 64, DefaultChunkSize}
+
+// NegotiateChunkSize finds the largest Send Data chunk the bootloader accepts and
+// uses it for the rest of the Programmer's lifetime. The device must already be in
+// bootloader mode (see EnterBootloader and Connect).
+//
+// Bootloaders do not report their receive buffer size, so the size is found by
+// trial: a Send Data command of each candidate size (MaxChunkSize, 128, 64, and
+// DefaultChunkSize) is sent, largest first, and the buffered data is discarded
+// with Sync Bootloader after each attempt. Sizes that do not fit in the packet
+// size configured with WithWritePacketSize are skipped. If no candidate is
+// accepted, the configured chunk size is kept and an error is returned.
+//
+// Programs run with WithAutoChunkSize negotiate automatically after entering the
+// bootloader.
+//
+// Example:
+//
+//	size, err := prog.NegotiateChunkSize(ctx)
+//	if err == nil {
+//	    log.Printf("using %d-byte chunks", size)
+//	}
+func (p *Programmer) NegotiateChunkSize(ctx context.Context) (int, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer finish()
+
+	return p.negotiateChunkSize(ctx)
+}
+
+// negotiateChunkSize implements NegotiateChunkSize within an operation already in progress.
+func (p *Programmer) negotiateChunkSize(ctx context.Context) (int, error) {
+	limit := p.chunkSizeLimit()
+
+	var lastErr error
+	for _, size := range chunkSizeCandidates {
+		if size > limit {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return p.chunkSize, fmt.Errorf("canceled: %w", err)
+		}
+
+		err := p.sendData(ctx, make([]byte, size))
+
+		// Discard the trial data, and any partial response after a failure
+		if syncErr := p.resync(ctx); syncErr != nil && err == nil {
+			err = syncErr
+		}
+
+		if err == nil {
+			p.chunkSize = size
+			p.chunkNegotiated = true
+			p.logInfo("chunk size negotiated", "size", size)
+			return size, nil
+		}
+
+		p.logDebug("chunk size rejected", "size", size, "error", err)
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return p.chunkSize, fmt.Errorf("no chunk size candidate fits in %d-byte packets", p.config.WritePacketSize)
+	}
+	return p.chunkSize, fmt.Errorf("no chunk size accepted: %w", lastErr)
+}
+
+// chunkSizeLimit returns the largest chunk size that fits in the packets set
+// with WritePacketSize.
+func (p *Programmer) chunkSizeLimit() int {
+	if p.config.WritePacketSize <= 0 {
+		return MaxChunkSize
+	}
+	limit := p.config.WritePacketSize - protocol.SendDataOverhead
+	if p.config.UseReportID {
+		limit--
+	}
+	return limit
+}
+
+// autoChunkSize negotiates the chunk size before programming when AutoChunkSize
+// is set. Failure falls back to the configured size; only cancellation is an error.
+func (p *Programmer) autoChunkSize(ctx context.Context) error {
+	if !p.config.AutoChunkSize || p.chunkNegotiated {
+		return nil
+	}
+
+	if _, err := p.negotiateChunkSize(ctx); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		p.logInfo("chunk size negotiation failed, using configured size", "size", p.chunkSize, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestNegotiateChunkSize(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name    string
+		maxData int
+		opts    []Option
+		want    int
+	}{
+		{"unlimited buffer", 0, nil, MaxChunkSize},
+		{"128-byte buffer", 200, nil, 128},
+		{"64-byte buffer", 64, nil, 64},
+		{"small buffer", 60, nil, DefaultChunkSize},
+		{"HID packet limit", 0, []Option{WithHIDReportID(0), WithWritePacketSize(72)}, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := bootloadertest.NewDevice(bootloadertest.WithMaxSendData(tt.maxData))
+			prog := New(device, tt.opts...)
+
+			if _, err := prog.EnterBootloader(context.Background(), key); err != nil {
+				t.Fatalf("enter bootloader: %v", err)
+			}
+			size, err := prog.NegotiateChunkSize(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != tt.want {
+				t.Errorf("size = %d, want %d", size, tt.want)
+			}
+		})
+	}
+
+	t.Run("no size accepted keeps configured size", func(t *testing.T) {
+		device := bootloadertest.NewDevice(bootloadertest.WithMaxSendData(32))
+		prog := New(device, WithChunkSize(32))
+
+		if _, err := prog.EnterBootloader(context.Background(), key); err != nil {
+			t.Fatalf("enter bootloader: %v", err)
+		}
+		size, err := prog.NegotiateChunkSize(context.Background())
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if size != 32 {
+			t.Errorf("size = %d, want configured 32", size)
+		}
+	})
+}
+
+func TestProgramAutoChunkSize(t *testing.T) {
+	data := bytes.Repeat([]byte{0xA5}, 256)
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: uint16(len(data)), Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+			{ArrayID: 0, RowNum: 0x0011, Size: uint16(len(data)), Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	device := bootloadertest.NewDevice(bootloadertest.WithMaxSendData(128))
+	prog := New(device, WithAutoChunkSize())
+
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, row := range fw.Rows {
+		if got, ok := device.Row(row.ArrayID, row.RowNum); !ok || !bytes.Equal(got, row.Data) {
+			t.Errorf("row %d not programmed correctly", row.RowNum)
+		}
+	}
+
+	// Each 256-byte row needs two Send Data chunks (128 and 127 bytes) and a
+	// 1-byte Program Row, after the negotiation trials (256 rejected, 128 accepted)
+	sendData := bytes.Count(device.Commands(), []byte{protocol.CmdSendData})
+	if sendData != 2+2*2 {
+		t.Errorf("%d Send Data commands, want 6", sendData)
+	}
+}
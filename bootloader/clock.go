@@ -0,0 +1,53 @@
+package bootloader
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time used by a Programmer for elapsed times and
+// durations, command delays and rate limiting, polling, and the read timeout
+// of devices without ContextReader. WithClock replaces the system clock, e.g.
+// with bootloadertest.Clock so that tests can simulate slow devices and check
+// timing without real sleeps.
+//
+// Timeouts that interrupt a ContextReader or ContextWriter are enforced with
+// context deadlines and always follow the system clock.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+
+	// Sleep pauses for d or until ctx is done, whichever comes first,
+	// returning ctx.Err() in the latter case
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// clockKey is the context key of the Clock passed to a Resetter.
+type clockKey struct{}
+
+// withClock returns a copy of ctx carrying clock, for callbacks such as the
+// Resetter built by LineResetter that are created without the Programmer.
+func withClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// contextClock returns the Clock carried by ctx, or the system clock.
+func contextClock(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+	return systemClock{}
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                  { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	return sleepContext(ctx, d)
+}
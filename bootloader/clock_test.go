@@ -0,0 +1,108 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// slowReader never delivers a response; each read takes a simulated second.
+type slowReader struct {
+	clock *bootloadertest.Clock
+	reads int
+}
+
+func (r *slowReader) Write(p []byte) (int, error) { return len(p), nil }
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.clock.Advance(time.Second)
+	return 0, nil
+}
+
+func TestClockCommandDelay(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	clock := bootloadertest.NewClock(time.Unix(0, 0))
+	device := bootloadertest.NewDevice()
+	var last Progress
+	prog := New(device,
+		WithClock(clock),
+		WithCommandDelay(25*time.Millisecond),
+		WithProgressCallback(func(p Progress) { last = p }),
+	)
+
+	report, err := prog.ProgramWithReport(context.Background(), fw, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// One delay per command, and no other time passes
+	commands := len(device.Commands())
+	want := time.Duration(commands) * 25 * time.Millisecond
+	if got := clock.Sleeps(); len(got) != commands {
+		t.Errorf("%d sleeps for %d commands", len(got), commands)
+	}
+	if report.Duration != want {
+		t.Errorf("Duration = %s, want %s", report.Duration, want)
+	}
+	if last.ElapsedTime != want {
+		t.Errorf("ElapsedTime = %s, want %s", last.ElapsedTime, want)
+	}
+}
+
+func TestClockReadTimeout(t *testing.T) {
+	clock := bootloadertest.NewClock(time.Unix(0, 0))
+	device := &slowReader{clock: clock}
+	prog := New(device, WithClock(clock), WithReadTimeout(5*time.Second))
+
+	_, err := prog.GetMetadata(context.Background(), 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("error %v is not a *TimeoutError", err)
+	}
+	if device.reads != 6 {
+		t.Errorf("%d reads before the timeout, want 6", device.reads)
+	}
+}
+
+func TestClockWaitForApplication(t *testing.T) {
+	clock := bootloadertest.NewClock(time.Unix(0, 0))
+	prog := New(bootloadertest.NewDevice(), WithClock(clock))
+
+	probes := 0
+	err := prog.waitForApplication(context.Background(), func(context.Context) error {
+		probes++
+		return errors.New("no answer")
+	}, 2*time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// Probes run every DefaultAppPollInterval until the simulated timeout
+	if want := int(2 * time.Second / DefaultAppPollInterval); probes != want {
+		t.Errorf("%d probes, want %d", probes, want)
+	}
+	if got := clock.Since(time.Unix(0, 0)); got <= 2*time.Second || got > 2*time.Second+DefaultAppPollInterval {
+		t.Errorf("simulated wait of %s, want just over 2s", got)
+	}
+	if !strings.Contains(err.Error(), "no answer") {
+		t.Errorf("error %q does not include the last probe error", err)
+	}
+}
@@ -0,0 +1,149 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// coalesceMTU returns the number of frame bytes that may be coalesced into one
+// write, or 0 when writes are not coalesced (see WithCoalescedWrites).
+func (p *Programmer) coalesceMTU() int {
+	mtu := p.config.CoalesceMTU
+	if p.config.WritePacketSize > 0 {
+		mtu = min(mtu, p.config.WritePacketSize)
+	}
+	if p.config.UseReportID {
+		mtu--
+	}
+	if mtu < 2*protocol.MinFrameSize {
+		return 0
+	}
+	return mtu
+}
+
+// programRowCoalesced implements programRow with coalesced writes: the Send
+// Data frames and the final Program Row frame are gathered into writes of at
+// most mtu bytes, and the responses to each write are read before the next.
+func (p *Programmer) programRowCoalesced(ctx context.Context, row *cyacd.Row, mtu int, onChunk func(chunk, chunks int)) error {
+	data := row.Data
+	end := p.sendDataEnd(int(row.Size), len(data), protocol.SendDataOverhead)
+	chunks := p.chunkCount(row)
+
+	// ends holds the end offset of each frame in the batch
+	batch := p.batchBuf[:0]
+	ends := p.batchEnds[:0]
+	defer func() {
+		// Keep the grown buffers for the next row
+		p.batchBuf = batch[:0]
+		p.batchEnds = ends[:0]
+	}()
+
+	offset, acked := 0, 0
+	for built := 0; built < chunks; built++ {
+		var frame []byte
+		var err error
+		if built < chunks-1 {
+			n := min(p.chunkSize, end-offset)
+			frame, err = protocol.AppendSendDataCmd(p.txBuf[:0], data[offset:offset+n])
+			offset += n
+		} else {
+			frame, err = protocol.AppendProgramRowCmd(p.txBuf[:0], row.ArrayID, row.RowNum, data[end:])
+		}
+		if err != nil {
+			return err
+		}
+		p.txBuf = frame
+
+		if p.checksumType != protocol.ChecksumBasicSum {
+			if err := protocol.SetPacketChecksum(frame, p.checksumType); err != nil {
+				return err
+			}
+		}
+
+		// Send the batch first if the frame would overflow it
+		if len(ends) > 0 && len(batch)+len(frame) > mtu {
+			n, err := p.flushBatch(ctx, batch, ends, acked, chunks, onChunk)
+			acked += n
+			if err != nil {
+				return err
+			}
+			batch, ends = batch[:0], ends[:0]
+		}
+
+		p.logFrame("frame sent", frame)
+		p.captureFrame(pcapng.Outbound, frame)
+		batch = append(batch, frame...)
+		ends = append(ends, len(batch))
+	}
+
+	_, err := p.flushBatch(ctx, batch, ends, acked, chunks, onChunk)
+	return err
+}
+
+// flushBatch writes the coalesced frames in batch, whose ends are given by
+// ends, and reads and checks their responses in order. acked is the number of
+// the row's chunks acknowledged before the batch. It returns the number of
+// frames acknowledged. After a failure, the responses still expected are
+// drained so that they are not mistaken for responses to later commands.
+func (p *Programmer) flushBatch(ctx context.Context, batch []byte, ends []int, acked, chunks int, onChunk func(chunk, chunks int)) (int, error) {
+	// Stop between writes rather than after the whole row on slow links
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("canceled: %w", err)
+	}
+
+	start := p.clock.Now()
+	if _, err := p.writePacket(ctx, batch); err != nil {
+		p.stats.record(batch[1], len(batch), p.clock.Since(start), 0, err)
+		return 0, fmt.Errorf("write coalesced frames: %w", err)
+	}
+
+	if err := p.clock.Sleep(ctx, p.commandDelay); err != nil {
+		return 0, err
+	}
+
+	// Several responses may arrive in one read
+	p.pipelined = true
+	defer func() {
+		p.pipelined = false
+		p.rxPending = p.rxPending[:0]
+	}()
+
+	frameStart := 0
+	for i, frameEnd := range ends {
+		cmd := batch[frameStart+1]
+		response, err := p.readFrame(ctx)
+		p.stats.record(cmd, frameEnd-frameStart, p.clock.Since(start), len(response), err)
+		frameStart = frameEnd
+
+		if err == nil {
+			if cmd == protocol.CmdSendData {
+				err = p.checkSendDataResponse(response)
+			} else {
+				err = p.checkProgramRowResponse(response)
+			}
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				for range ends[i+1:] {
+					if _, err := p.readFrame(ctx); err != nil {
+						break
+					}
+				}
+			}
+			if cmd == protocol.CmdSendData {
+				err = fmt.Errorf("send data chunk: %w", err)
+			}
+			return i, err
+		}
+
+		if onChunk != nil {
+			onChunk(acked+i+1, chunks)
+		}
+	}
+
+	return len(ends), nil
+}
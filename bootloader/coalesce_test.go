@@ -0,0 +1,137 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// coalescingDevice splits coalesced writes into frames for the simulated
+// bootloader and records the size of each write. Reads return every queued
+// response at once.
+type coalescingDevice struct {
+	device *bootloadertest.Device
+	writes []int
+}
+
+func (d *coalescingDevice) Write(p []byte) (int, error) {
+	d.writes = append(d.writes, len(p))
+	for rest := p; len(rest) >= 4; {
+		size := protocol.MinFrameSize + int(binary.LittleEndian.Uint16(rest[2:4]))
+		if _, err := d.device.Write(rest[:size]); err != nil {
+			return 0, err
+		}
+		rest = rest[size:]
+	}
+	return len(p), nil
+}
+
+func (d *coalescingDevice) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		read, err := d.device.Read(p[n:])
+		n += read
+		if err != nil {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func TestProgramCoalescedWrites(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name string
+		mtu  int
+		// writes per 256-byte row: 4 Send Data frames of 64 bytes and a
+		// 38-byte Program Row frame
+		want int
+	}{
+		{"disabled", 0, 5},
+		{"too small to coalesce", 10, 5},
+		{"two frames per write", 128, 3},
+		{"whole row", 512, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := pipelineFirmware()
+			device := &coalescingDevice{device: bootloadertest.NewDevice()}
+
+			var chunks []int
+			prog := New(device,
+				WithCoalescedWrites(tt.mtu),
+				WithVerifyAfterProgram(false),
+				WithSkipAppVerify(),
+				WithSkipExit(),
+				WithProgressCallback(func(p Progress) {
+					if p.Phase == PhaseProgramming && p.CurrentRow == 0 && p.ChunkCount > 0 && p.ChunkIndex < p.ChunkCount {
+						chunks = append(chunks, p.ChunkIndex)
+					}
+				}),
+			)
+			if err := prog.Program(context.Background(), fw, key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The first write is Enter Bootloader
+			rowWrites := device.writes[1:]
+			if got := len(rowWrites) / len(fw.Rows); got != tt.want {
+				t.Errorf("%d writes per row (%v), want %d", got, rowWrites, tt.want)
+			}
+			for _, n := range rowWrites {
+				if tt.mtu >= 2*protocol.MinFrameSize && n > tt.mtu {
+					t.Errorf("write of %d bytes exceeds mtu %d", n, tt.mtu)
+				}
+			}
+			if want := "[1 2 3 4]"; fmt.Sprint(chunks) != want {
+				t.Errorf("chunks reported = %v, want %s", chunks, want)
+			}
+			for _, row := range fw.Rows {
+				if got, _ := device.device.Row(row.ArrayID, row.RowNum); !bytes.Equal(got, row.Data) {
+					t.Errorf("row 0x%04X = %x, want %x", row.RowNum, got, row.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestProgramCoalescedWritesRetry(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	fw := pipelineFirmware()
+
+	// The response to the second Send Data of the first row is corrupted
+	device := &coalescingDevice{device: bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultCorruptChecksum,
+		Command: protocol.CmdSendData,
+		Skip:    1,
+	}))}
+
+	var retries int
+	prog := New(device,
+		WithCoalescedWrites(512),
+		WithRowCallback(func(r RowResult) { retries += r.Retries }),
+	)
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if retries != 1 {
+		t.Errorf("%d retries, want 1", retries)
+	}
+	for _, row := range fw.Rows {
+		if got, _ := device.device.Row(row.ArrayID, row.RowNum); !bytes.Equal(got, row.Data) {
+			t.Errorf("row 0x%04X = %x, want %x", row.RowNum, got, row.Data)
+		}
+	}
+}
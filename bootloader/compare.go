@@ -0,0 +1,152 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// RowComparison is the outcome of comparing one firmware row with the flash
+// of the device (see Compare).
+type RowComparison struct {
+	// ArrayID and RowNum identify the row
+	ArrayID byte
+	RowNum  uint16
+
+	// Expected is the Verify Row checksum of the row in the firmware image
+	Expected byte
+
+	// Actual is the checksum reported by the device (0 if Err is set)
+	Actual byte
+
+	// Err is the error the bootloader returned instead of a checksum, e.g.
+	// for a row outside its flash range; nil if the checksum was read
+	Err error
+}
+
+// CompareResult lists the rows of a firmware image that match and that do
+// not match the flash of the device. Returned by Compare.
+type CompareResult struct {
+	// DeviceInfo is the identification returned by Enter Bootloader
+	DeviceInfo *protocol.DeviceInfo
+
+	// Matching holds the rows whose device checksum matches the image, in image order
+	Matching []RowComparison
+
+	// Mismatching holds the rows whose device checksum differs from the
+	// image or could not be read, in image order
+	Mismatching []RowComparison
+}
+
+// Match reports whether every row of the image matches the device.
+func (r *CompareResult) Match() bool {
+	return len(r.Mismatching) == 0
+}
+
+// Compare audits the flash of the device against fw without writing
+// anything, for incoming inspection and RMA triage. The bootloader is entered
+// with key, the checksum of every row of fw is read with Verify Row and
+// compared with the image, and the bootloader is exited again. If a session
+// was opened with Connect, it is reused and left open, and key is ignored.
+//
+// A device with a different silicon ID fails with a *DeviceMismatchError
+// (see WithAllowSiliconIDMismatch). Rows the bootloader refuses to checksum
+// are listed as mismatching with the error; a communication failure ends the
+// comparison with an error. Progress is reported in the PhaseVerifying phase.
+//
+// Example:
+//
+//	result, err := prog.Compare(ctx, fw, key)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, row := range result.Mismatching {
+//	    fmt.Printf("row %d (array %d) differs\n", row.RowNum, row.ArrayID)
+//	}
+func (p *Programmer) Compare(ctx context.Context, fw *cyacd.Firmware, key []byte) (*CompareResult, error) {
+	if fw == nil {
+		return nil, fmt.Errorf("firmware cannot be nil")
+	}
+	if p.sessionInfo() == nil {
+		if err := protocol.ValidateKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	result, err := p.compare(ctx, fw, key)
+	err = withCause(ctx, err)
+	if err != nil {
+		p.setState(StateFailed)
+	}
+	return result, err
+}
+
+// compare implements Compare within an operation already in progress.
+func (p *Programmer) compare(ctx context.Context, fw *cyacd.Firmware, key []byte) (*CompareResult, error) {
+	info := p.sessionInfo()
+	inSession := info != nil
+	if !inSession {
+		var err error
+		if info, err = p.enterBootloader(ctx, key); err != nil {
+			return nil, fmt.Errorf("enter bootloader: %w", err)
+		}
+	}
+	p.setState(StateInBootloader)
+
+	if err := p.checkSiliconID(info, fw.SiliconID); err != nil {
+		return nil, err
+	}
+
+	result := &CompareResult{DeviceInfo: info}
+	for i, row := range fw.Rows {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("canceled: %w", err)
+		}
+
+		cmp := RowComparison{
+			ArrayID:  row.ArrayID,
+			RowNum:   row.RowNum,
+			Expected: protocol.CalculateRowChecksumWithMetadata(row.Checksum, row.ArrayID, row.RowNum, uint16(len(row.Data))),
+		}
+		checksum, err := p.rowChecksum(ctx, row.ArrayID, row.RowNum)
+		var protoErr *protocol.ProtocolError
+		switch {
+		case errors.As(err, &protoErr):
+			cmp.Err = err
+			result.Mismatching = append(result.Mismatching, cmp)
+		case err != nil:
+			return nil, fmt.Errorf("row %d (array %d): %w", row.RowNum, row.ArrayID, err)
+		default:
+			cmp.Actual = checksum
+			if checksum == cmp.Expected {
+				result.Matching = append(result.Matching, cmp)
+			} else {
+				result.Mismatching = append(result.Mismatching, cmp)
+			}
+		}
+
+		p.reportProgress(Progress{
+			Phase:      PhaseVerifying,
+			CurrentRow: i + 1,
+			TotalRows:  len(fw.Rows),
+			Percentage: float64(i+1) / float64(len(fw.Rows)) * 100,
+		})
+	}
+
+	if !inSession {
+		if err := p.exitBootloader(ctx); err != nil {
+			return nil, fmt.Errorf("exit bootloader: %w", err)
+		}
+		p.setState(StateDone)
+	}
+	return result, nil
+}
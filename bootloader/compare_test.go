@@ -0,0 +1,56 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestCompare(t *testing.T) {
+	fw := journalFirmware() // rows 0x10-0x13
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	device := bootloadertest.NewDevice(bootloadertest.WithFlashRange(0x0000, 0x0012))
+
+	// Program the first two rows, then change one of them in the image
+	partial := &cyacd.Firmware{SiliconID: fw.SiliconID, Rows: fw.Rows[:2]}
+	if err := New(device).Program(context.Background(), partial, key); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	fw.Rows[1] = cyacd.NewRow(0, 0x11, []byte{0xFF, 0xFF, 0xFF, 0xFF})
+
+	writes := len(device.Commands())
+	result, err := New(device).Compare(context.Background(), fw, key)
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if result.Match() || len(result.Matching) != 1 || result.Matching[0].RowNum != 0x10 {
+		t.Errorf("Matching = %+v", result.Matching)
+	}
+
+	// Row 0x11 differs, 0x12 was never programmed, 0x13 is outside the flash
+	if len(result.Mismatching) != 3 {
+		t.Fatalf("Mismatching = %+v, want 3 rows", result.Mismatching)
+	}
+	if m := result.Mismatching[0]; m.RowNum != 0x11 || m.Err != nil || m.Actual == m.Expected {
+		t.Errorf("changed row = %+v", m)
+	}
+	if m := result.Mismatching[2]; m.RowNum != 0x13 || m.Err == nil {
+		t.Errorf("row outside the flash = %+v", m)
+	}
+	for _, cmd := range device.Commands()[writes:] {
+		if cmd == protocol.CmdProgramRow || cmd == protocol.CmdSendData || cmd == protocol.CmdEraseRow {
+			t.Errorf("Compare sent write command 0x%02X", cmd)
+		}
+	}
+
+	// A different device is reported, not compared
+	fw.SiliconID = 0x04C81193
+	var mismatchErr *DeviceMismatchError
+	if _, err := New(device).Compare(context.Background(), fw, key); !errors.As(err, &mismatchErr) {
+		t.Errorf("Compare with another silicon ID = %v, want *DeviceMismatchError", err)
+	}
+}
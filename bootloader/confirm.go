@@ -0,0 +1,62 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Description describes a programming operation that is about to write to
+// the device, passed to the ConfirmFunc set with WithConfirm.
+type Description struct {
+	// DeviceInfo is the identification returned by Enter Bootloader
+	DeviceInfo *protocol.DeviceInfo
+
+	// DeviceID is the label set with WithDeviceID
+	DeviceID string
+
+	// Rows and Bytes are the number of rows and data bytes to be written
+	Rows  int
+	Bytes int
+
+	// Metadata is the application metadata embedded in a .cyacd image (see
+	// UpdateIfNewer); nil for .cyacd2 images and images too short to hold it
+	Metadata *protocol.Metadata
+
+	// AppID is the application ID of a .cyacd2 image (0 for .cyacd images)
+	AppID byte
+
+	// FirmwareFingerprint identifies a .cyacd image (see cyacd.Firmware.Fingerprint);
+	// empty for .cyacd2 images
+	FirmwareFingerprint string
+}
+
+// ConfirmFunc is called before the first row is written, after the device
+// was identified and the image checked against it. Returning an error aborts
+// the operation without writing anything. See WithConfirm.
+type ConfirmFunc func(Description) error
+
+// confirm asks the ConfirmFunc, if any, whether to proceed. A refusal is
+// returned wrapped in ErrNotConfirmed.
+func (p *Programmer) confirm(desc Description) error {
+	if p.config.Confirm == nil {
+		return nil
+	}
+	if err := p.config.Confirm(desc); err != nil {
+		p.logInfo("operation not confirmed", "error", err)
+		return fmt.Errorf("%w: %w", ErrNotConfirmed, err)
+	}
+	return nil
+}
+
+// leaveUnconfirmed exits the bootloader after a refused operation, so that
+// the untouched application starts again. Reports whether the exit succeeded.
+func (p *Programmer) leaveUnconfirmed(ctx context.Context) bool {
+	if err := p.exitBootloader(ctx); err != nil {
+		p.logError("exit bootloader after refusal failed", "error", err)
+		return false
+	}
+	p.setState(StateDone)
+	return true
+}
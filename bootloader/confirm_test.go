@@ -0,0 +1,61 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestConfirm(t *testing.T) {
+	fw := journalFirmware() // rows 0x10-0x13 of 4 bytes
+	key := []byte(protocol.DefaultExampleKey)
+
+	var desc Description
+	device := bootloadertest.NewDevice()
+	prog := New(device, WithDeviceID("SN-1"), WithConfirm(func(d Description) error {
+		desc = d
+		return nil
+	}))
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	if desc.Rows != 4 || desc.Bytes != 16 || desc.DeviceID != "SN-1" ||
+		desc.DeviceInfo == nil || desc.DeviceInfo.SiliconID != bootloadertest.DefaultSiliconID ||
+		desc.FirmwareFingerprint != fw.Fingerprint() {
+		t.Errorf("Description = %+v", desc)
+	}
+
+	// A refusal writes nothing and leaves the bootloader
+	refused := errors.New("canceled by user")
+	device = bootloadertest.NewDevice()
+	prog = New(device, WithConfirm(func(Description) error { return refused }))
+	err := prog.Program(context.Background(), fw, key)
+	if !errors.Is(err, ErrNotConfirmed) || !errors.Is(err, refused) {
+		t.Fatalf("err = %v, want ErrNotConfirmed wrapping the refusal", err)
+	}
+	cmds := device.Commands()
+	for _, cmd := range cmds {
+		if cmd == protocol.CmdProgramRow || cmd == protocol.CmdSendData || cmd == protocol.CmdEraseRow {
+			t.Fatalf("command 0x%02X sent after refusal: % 02X", cmd, cmds)
+		}
+	}
+	if cmds[len(cmds)-1] != protocol.CmdExitBootloader {
+		t.Errorf("last command 0x%02X, want Exit Bootloader", cmds[len(cmds)-1])
+	}
+
+	// Within a session the bootloader is left running
+	device = bootloadertest.NewDevice()
+	prog = New(device, WithConfirm(func(Description) error { return refused }))
+	if _, err := prog.Connect(context.Background(), key); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := prog.Program(context.Background(), fw, nil); !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("err = %v, want ErrNotConfirmed", err)
+	}
+	if !device.InBootloader() {
+		t.Error("refusal within a session exited the bootloader")
+	}
+}
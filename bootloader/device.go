@@ -0,0 +1,223 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// InputFlusher is an optional interface for devices that can discard unread input.
+// Serial port libraries commonly provide this method.
+//
+// When the device implements InputFlusher, Abort uses it to drop stale response
+// bytes left over from an interrupted operation.
+type InputFlusher interface {
+	// ResetInputBuffer discards any data received but not yet read
+	ResetInputBuffer() error
+}
+
+// ContextReader is an optional interface for devices whose reads can be interrupted.
+//
+// A plain io.Reader blocks until the device answers, so canceling the context
+// only takes effect after the current read returns. When the device implements
+// ContextReader, the Programmer calls ReadContext instead of Read, with a context
+// that is canceled when the operation is canceled or the read timeout expires.
+type ContextReader interface {
+	// ReadContext reads like io.Reader.Read but returns early with ctx.Err()
+	// when ctx is done
+	ReadContext(ctx context.Context, p []byte) (int, error)
+}
+
+// ContextWriter is an optional interface for devices whose writes can be interrupted.
+// See ContextReader; the write timeout applies to WriteContext.
+type ContextWriter interface {
+	// WriteContext writes like io.Writer.Write but returns early with ctx.Err()
+	// when ctx is done
+	WriteContext(ctx context.Context, p []byte) (int, error)
+}
+
+// ModemControl is implemented by serial ports that can drive the DTR and RTS
+// modem control lines, such as go.bug.st/serial ports. See LineResetter.
+type ModemControl interface {
+	// SetDTR asserts (true) or deasserts (false) Data Terminal Ready
+	SetDTR(dtr bool) error
+
+	// SetRTS asserts (true) or deasserts (false) Request To Send
+	SetRTS(rts bool) error
+}
+
+// write sends b to the device, using WriteContext when the device supports it.
+// The frame is wrapped with the configured HID report ID and padding first.
+func (p *Programmer) write(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if p.checksumType != protocol.ChecksumBasicSum {
+		if err := protocol.SetPacketChecksum(b, p.checksumType); err != nil {
+			return 0, err
+		}
+	}
+	p.logFrame("frame sent", b)
+	p.captureFrame(pcapng.Outbound, b)
+
+	return p.writePacket(ctx, b)
+}
+
+// writePacket sends b, one or more complete frames, to the device in a single
+// write, wrapped with the configured HID report ID and padding.
+func (p *Programmer) writePacket(ctx context.Context, b []byte) (int, error) {
+	b, err := p.packetize(b)
+	if err != nil {
+		return 0, err
+	}
+	if p.config.UseReportID || p.config.WritePacketSize > 0 {
+		// The packet is a private copy that may hold key material
+		defer clear(b)
+	}
+
+	if err := p.throttle(ctx, len(b)); err != nil {
+		return 0, err
+	}
+
+	if size := p.config.WriteSegmentSize; size > 0 && len(b) > size {
+		return p.writeSegments(ctx, b, size)
+	}
+	return p.writeDevice(ctx, b)
+}
+
+// writeSegments writes b in segments of at most size bytes, pausing for the
+// configured segment delay between them (see WithWriteSegments).
+func (p *Programmer) writeSegments(ctx context.Context, b []byte, size int) (int, error) {
+	total := 0
+	for total < len(b) {
+		if total > 0 {
+			if err := p.clock.Sleep(ctx, p.config.WriteSegmentDelay); err != nil {
+				return total, err
+			}
+		}
+
+		n, err := p.writeDevice(ctx, b[total:min(total+size, len(b))])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// writeDevice performs a single write to the device, using WriteContext when
+// the device supports it. Errors of the device are returned as *IOError.
+func (p *Programmer) writeDevice(ctx context.Context, b []byte) (int, error) {
+	var n int
+	var err error
+	if w, ok := p.device.(ContextWriter); ok {
+		if p.config.WriteTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.config.WriteTimeout)
+			defer cancel()
+		}
+		n, err = w.WriteContext(ctx, b)
+	} else {
+		n, err = p.device.Write(b)
+	}
+	if err != nil {
+		return n, &IOError{Err: err}
+	}
+	return n, nil
+}
+
+// read receives into b from the device, using ReadContext when the device supports it.
+// The read timeout is applied by readFrame across all reads of a response.
+func (p *Programmer) read(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if r, ok := p.device.(ContextReader); ok {
+		return r.ReadContext(ctx, b)
+	}
+
+	return p.device.Read(b)
+}
+
+// packetize prepends the HID report ID and pads the frame to the write packet size,
+// as configured. The frame is returned unchanged when neither option is set.
+func (p *Programmer) packetize(frame []byte) ([]byte, error) {
+	if !p.config.UseReportID && p.config.WritePacketSize == 0 {
+		return frame, nil
+	}
+
+	size := len(frame)
+	if p.config.UseReportID {
+		size++
+	}
+
+	if p.config.WritePacketSize > 0 {
+		if size > p.config.WritePacketSize {
+			return nil, fmt.Errorf("frame of %d bytes exceeds write packet size %d", size, p.config.WritePacketSize)
+		}
+		size = p.config.WritePacketSize
+	}
+
+	if cap(p.pktBuf) < size {
+		p.pktBuf = make([]byte, 0, size)
+	}
+	packet := p.pktBuf[:0]
+	if p.config.UseReportID {
+		packet = append(packet, p.config.ReportID)
+	}
+	packet = append(packet, frame...)
+
+	// Zero padding up to the packet size
+	n := len(packet)
+	packet = packet[:size]
+	clear(packet[n:])
+	return packet, nil
+}
+
+// throttle waits until n more bytes may be written without exceeding
+// MaxBytesPerSecond, then reserves transmission time for them.
+func (p *Programmer) throttle(ctx context.Context, n int) error {
+	if p.config.MaxBytesPerSecond <= 0 {
+		return nil
+	}
+
+	now := p.clock.Now()
+	if p.nextWrite.Before(now) {
+		p.nextWrite = now
+	}
+
+	if err := p.clock.Sleep(ctx, p.nextWrite.Sub(now)); err != nil {
+		return err
+	}
+
+	p.nextWrite = p.nextWrite.Add(time.Duration(n) * time.Second / time.Duration(p.config.MaxBytesPerSecond))
+	return nil
+}
+
+// sleepContext pauses for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseResponse validates a response frame with the packet checksum type in use
+// and returns its status code and data.
+func (p *Programmer) parseResponse(frame []byte) (byte, []byte, error) {
+	return protocol.ParseResponseWithChecksum(frame, p.checksumType)
+}
@@ -0,0 +1,376 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// blockingContextDevice answers queued responses and then blocks in ReadContext
+// until the context is done, like a real device that never answers.
+type blockingContextDevice struct {
+	*MockDevice
+	readCalls int
+}
+
+func (d *blockingContextDevice) ReadContext(ctx context.Context, p []byte) (int, error) {
+	d.readCalls++
+	if d.respIdx < len(d.responses) {
+		return d.Read(p)
+	}
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (d *blockingContextDevice) WriteContext(ctx context.Context, p []byte) (int, error) {
+	return d.Write(p)
+}
+
+func TestContextReaderCancellation(t *testing.T) {
+	device := &blockingContextDevice{MockDevice: NewMockDevice()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	prog := New(device, WithReadTimeout(time.Minute))
+
+	start := time.Now()
+	_, err := prog.GetFlashSize(ctx, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("read was not interrupted: took %v", elapsed)
+	}
+	if device.readCalls != 1 {
+		t.Errorf("readCalls = %d, want 1", device.readCalls)
+	}
+}
+
+func TestContextReaderTimeout(t *testing.T) {
+	device := &blockingContextDevice{MockDevice: NewMockDevice()}
+
+	prog := New(device, WithReadTimeout(10*time.Millisecond))
+
+	_, err := prog.GetFlashSize(context.Background(), 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestContextReaderResponse(t *testing.T) {
+	device := &blockingContextDevice{MockDevice: NewMockDevice()}
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+
+	prog := New(device)
+
+	size, err := prog.GetFlashSize(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size.EndRow != 0x01FF {
+		t.Errorf("EndRow = 0x%04X, want 0x01FF", size.EndRow)
+	}
+}
+
+func TestWritePacketization(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		wantLen int
+		wantID  bool
+		wantErr bool
+	}{
+		{
+			name:    "raw frame",
+			options: nil,
+			wantLen: 8,
+		},
+		{
+			name:    "report ID",
+			options: []Option{WithHIDReportID(0x02)},
+			wantLen: 9,
+			wantID:  true,
+		},
+		{
+			name:    "report ID and padding",
+			options: []Option{WithHIDReportID(0x02), WithWritePacketSize(65)},
+			wantLen: 65,
+			wantID:  true,
+		},
+		{
+			name:    "padding only",
+			options: []Option{WithWritePacketSize(64)},
+			wantLen: 64,
+		},
+		{
+			name:    "frame exceeds packet size",
+			options: []Option{WithWritePacketSize(4)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := NewMockDevice()
+			device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+
+			prog := New(device, tt.options...)
+			_, err := prog.GetFlashSize(context.Background(), 0)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			written := device.writeBuf.Bytes()
+			if len(written) != tt.wantLen {
+				t.Fatalf("write length = %d, want %d", len(written), tt.wantLen)
+			}
+
+			frame := written
+			if tt.wantID {
+				if written[0] != 0x02 {
+					t.Errorf("report ID = 0x%02X, want 0x02", written[0])
+				}
+				frame = written[1:]
+			}
+			if frame[0] != protocol.StartOfPacket || frame[1] != protocol.CmdGetFlashSize {
+				t.Errorf("frame = % 02X, want Get Flash Size frame", frame)
+			}
+			for i, b := range frame[8:] {
+				if b != 0 {
+					t.Fatalf("padding byte %d = 0x%02X, want 0x00", i, b)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxBytesPerSecond(t *testing.T) {
+	device := NewMockDevice()
+	for i := 0; i < 3; i++ {
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	}
+
+	// Each Get Flash Size frame is 8 bytes: 20ms at 400 bytes/s
+	prog := New(device, WithMaxBytesPerSecond(400))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		// Distinct arrays, since flash sizes are cached per array
+		if _, err := prog.GetFlashSize(context.Background(), byte(i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("elapsed = %v, want >= 40ms", elapsed)
+	}
+}
+
+// retainingDevice keeps the buffers passed to Write, to check they are wiped.
+type retainingDevice struct {
+	*MockDevice
+	writes [][]byte
+}
+
+func (d *retainingDevice) Write(p []byte) (int, error) {
+	d.writes = append(d.writes, p)
+	return d.MockDevice.Write(p)
+}
+
+func TestEnterBootloaderWipesKey(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	for _, opts := range [][]Option{nil, {WithHIDReportID(0x00)}} {
+		device := &retainingDevice{MockDevice: NewMockDevice()}
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+
+		prog := New(device, opts...)
+		if _, err := prog.EnterBootloader(context.Background(), key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Contains(device.writeBuf.Bytes(), key) {
+			t.Fatal("key was not sent to the device")
+		}
+		for _, w := range device.writes {
+			if bytes.Contains(w, key) {
+				t.Errorf("write buffer still holds the key after EnterBootloader: % 02X", w)
+			}
+		}
+		if key[0] != 0x0A {
+			t.Error("caller's key was modified")
+		}
+	}
+}
+
+// frameLogger records the frames logged by WithFrameLogging.
+type frameLogger struct {
+	MockLogger
+	frames []string
+}
+
+func (l *frameLogger) Debug(msg string, kv ...interface{}) {
+	if len(kv) == 4 && kv[0] == "frame" {
+		l.frames = append(l.frames, fmt.Sprintf("%s: %s [%s]", msg, kv[1], kv[3]))
+	}
+}
+
+func TestFrameLogging(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("enabled", func(t *testing.T) {
+		logger := &frameLogger{}
+		prog := New(bootloadertest.NewDevice(), WithLogger(logger), WithFrameLogging())
+		if _, err := prog.EnterBootloader(context.Background(), key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(logger.frames) != 2 {
+			t.Fatalf("logged frames = %q, want request and response", logger.frames)
+		}
+		sent, received := logger.frames[0], logger.frames[1]
+		if !strings.HasPrefix(sent, "frame sent: Enter Bootloader (0x38) len=6 checksum=ok") {
+			t.Errorf("sent frame logged as %q", sent)
+		}
+		if !strings.Contains(sent, "FF FF FF FF FF FF") || strings.Contains(sent, "0A 1B 2C") {
+			t.Errorf("key not redacted in %q", sent)
+		}
+		if !strings.HasPrefix(received, "frame received: status success (0x00) len=8 checksum=ok") {
+			t.Errorf("received frame logged as %q", received)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		logger := &frameLogger{}
+		prog := New(bootloadertest.NewDevice(), WithLogger(logger))
+		if _, err := prog.EnterBootloader(context.Background(), key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(logger.frames) != 0 {
+			t.Errorf("logged frames = %q without WithFrameLogging", logger.frames)
+		}
+	})
+}
+
+func TestCapture(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	var buf bytes.Buffer
+	capture, err := pcapng.NewWriter(&buf, pcapng.LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := bootloadertest.NewClock(time.Unix(1700000000, 0))
+	prog := New(bootloadertest.NewDevice(), WithCapture(capture), WithClock(clock), WithDeviceID("SN-0042"))
+	if _, err := prog.EnterBootloader(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prog.GetFlashSize(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Walk the blocks: section header, interface, then one packet per frame
+	var packets [][]byte
+	for b := buf.Bytes(); len(b) >= 12; {
+		total := binary.LittleEndian.Uint32(b[4:])
+		if binary.LittleEndian.Uint32(b) == 6 {
+			packets = append(packets, b[8:total-4])
+		}
+		b = b[total:]
+	}
+	if len(packets) != 4 {
+		t.Fatalf("captured %d frames, want 4", len(packets))
+	}
+	for i, pkt := range packets {
+		n := binary.LittleEndian.Uint32(pkt[12:])
+		frame := pkt[20 : 20+n]
+		flags := binary.LittleEndian.Uint32(pkt[20+n+(4-n%4)%4+4:])
+		wantDir := pcapng.Outbound
+		if i%2 == 1 {
+			wantDir = pcapng.Inbound
+		}
+		if pcapng.Direction(flags) != wantDir {
+			t.Errorf("frame %d: direction %d, want %d", i, flags, wantDir)
+		}
+		if i == 0 && (frame[1] != protocol.CmdEnterBootloader || !bytes.Equal(frame[4:10], bytes.Repeat([]byte{0xFF}, 6))) {
+			t.Errorf("Enter Bootloader captured as % X, want the key redacted", frame)
+		}
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("SN-0042")) {
+		t.Error("capture interface is not named after the device ID")
+	}
+}
+
+// segmentedDevice reassembles frames written in segments for a simulated
+// bootloader and records the size of every write.
+type segmentedDevice struct {
+	*bootloadertest.Device
+	buf    []byte
+	writes []int
+}
+
+func (d *segmentedDevice) Write(p []byte) (int, error) {
+	d.writes = append(d.writes, len(p))
+	d.buf = append(d.buf, p...)
+	for len(d.buf) >= 4 {
+		size := protocol.MinFrameSize + int(binary.LittleEndian.Uint16(d.buf[2:4]))
+		if len(d.buf) < size {
+			break
+		}
+		if _, err := d.Device.Write(d.buf[:size]); err != nil {
+			return 0, err
+		}
+		d.buf = d.buf[size:]
+	}
+	return len(p), nil
+}
+
+func TestWriteSegments(t *testing.T) {
+	fw := journalFirmware()
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	clock := bootloadertest.NewClock(time.Unix(0, 0))
+	device := &segmentedDevice{Device: bootloadertest.NewDevice()}
+
+	prog := New(device, WithClock(clock), WithWriteSegments(8, 2*time.Millisecond))
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+
+	split := 0
+	for _, n := range device.writes {
+		if n > 8 {
+			t.Fatalf("write of %d bytes exceeds the segment size", n)
+		}
+		if n == 8 {
+			split++
+		}
+	}
+	if split == 0 {
+		t.Error("no frame was split")
+	}
+	sleeps := clock.Sleeps()
+	if len(sleeps) == 0 || sleeps[0] != 2*time.Millisecond {
+		t.Errorf("sleeps = %v, want segment delays of 2ms", sleeps)
+	}
+
+	_, err := NewProgrammer(device, WithWriteSegments(8, 0), WithWritePacketSize(64))
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("segments with packet size: err = %v, want ErrInvalidOption", err)
+	}
+}
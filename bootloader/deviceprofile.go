@@ -0,0 +1,137 @@
+package bootloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// DeviceProfile holds the flash geometry and known-good settings of a device,
+// identified by the silicon ID it reports on Enter Bootloader. Profiles are
+// registered with RegisterDeviceProfile and applied automatically after the
+// bootloader is entered (see WithDeviceProfiles).
+//
+// Profiles of the PSoC 4 and PSoC 5LP devices simulated by the bootloadertest
+// presets are built in. Their row size is only a hint: an image with other
+// rows is logged as a warning rather than rejected, because some images of a
+// family legitimately differ, such as the 288-byte rows of PSoC 5LP images
+// storing configuration data in ECC memory. A registered profile replaces the
+// built-in one and its row size is checked.
+type DeviceProfile struct {
+	// Name describes the device, e.g. "CY8C4245AXI-483"
+	Name string
+
+	// SiliconID is the silicon ID reported by the device
+	SiliconID uint32
+
+	// RowSize is the flash row size in bytes, checked as set with WithRowSize
+	// (0 leaves the row size unchecked)
+	RowSize int
+
+	// ChunkSize is the Send Data chunk size the bootloader accepts
+	// (0 keeps the configured size)
+	ChunkSize int
+
+	// CommandDelay is the delay the device needs between commands
+	// (0 keeps the configured delay)
+	CommandDelay time.Duration
+}
+
+// builtinDeviceProfiles are the profiles of the devices known to the library,
+// by silicon ID, matching the bootloadertest presets.
+var builtinDeviceProfiles = map[uint32]DeviceProfile{
+	0x04C81193: {Name: "PSoC 4 (CY8C4245AXI-483)", SiliconID: 0x04C81193, RowSize: 128},
+	0x1E9602AA: {Name: "PSoC 5LP", SiliconID: 0x1E9602AA, RowSize: 256},
+}
+
+var (
+	deviceProfilesMu sync.RWMutex
+	deviceProfiles   = make(map[uint32]DeviceProfile)
+)
+
+// RegisterDeviceProfile adds profile to the device database, replacing any
+// profile registered for the same silicon ID. It is typically called from an
+// init function of the application or of a package describing a product line.
+//
+// Example:
+//
+//	func init() {
+//	    bootloader.RegisterDeviceProfile(bootloader.DeviceProfile{
+//	        Name:      "CY8C4245AXI-483",
+//	        SiliconID: 0x04C81193,
+//	        RowSize:   128,
+//	        ChunkSize: 57,
+//	    })
+//	}
+func RegisterDeviceProfile(profile DeviceProfile) {
+	deviceProfilesMu.Lock()
+	defer deviceProfilesMu.Unlock()
+	deviceProfiles[profile.SiliconID] = profile
+}
+
+// LookupDeviceProfile returns the profile registered for siliconID, or the
+// built-in one if none is registered.
+func LookupDeviceProfile(siliconID uint32) (DeviceProfile, bool) {
+	profile, ok, _ := lookupDeviceProfile(siliconID)
+	return profile, ok
+}
+
+// lookupDeviceProfile is LookupDeviceProfile that also reports whether the
+// profile is built in.
+func lookupDeviceProfile(siliconID uint32) (profile DeviceProfile, ok, builtin bool) {
+	deviceProfilesMu.RLock()
+	defer deviceProfilesMu.RUnlock()
+	if profile, ok := deviceProfiles[siliconID]; ok {
+		return profile, true, false
+	}
+	profile, ok = builtinDeviceProfiles[siliconID]
+	return profile, ok, ok
+}
+
+// applyDeviceProfile applies the registered profile of the device that just
+// entered the bootloader, for the settings not set explicitly with options.
+// Settings of a previously entered device are reset first, so a Programmer
+// reused with another device does not keep them. A chunk size found by
+// NegotiateChunkSize is kept.
+func (p *Programmer) applyDeviceProfile(info *protocol.DeviceInfo) {
+	p.rowSize = p.config.RowSize
+	p.rowSizeHint = 0
+	p.commandDelay = p.config.CommandDelay
+	if !p.chunkNegotiated {
+		p.chunkSize = p.config.ChunkSize
+	}
+	if !p.config.DeviceProfiles || info == nil {
+		return
+	}
+	profile, ok, builtin := lookupDeviceProfile(info.SiliconID)
+	if !ok {
+		return
+	}
+
+	if profile.RowSize > 0 && p.config.RowSize == 0 {
+		if builtin {
+			p.rowSizeHint = profile.RowSize
+		} else {
+			p.rowSize = profile.RowSize
+		}
+	}
+	if profile.ChunkSize > 0 && !p.config.chunkSizeSet && !p.chunkNegotiated {
+		if profile.ChunkSize <= p.chunkSizeLimit() {
+			p.chunkSize = profile.ChunkSize
+		} else {
+			p.logInfo("device profile chunk size does not fit the write packet size, using configured size",
+				"profile", profile.Name, "size", profile.ChunkSize)
+		}
+	}
+	if profile.CommandDelay > 0 && !p.config.commandDelaySet {
+		p.commandDelay = profile.CommandDelay
+	}
+
+	p.logInfo("device profile applied",
+		"profile", profile.Name,
+		"row_size", max(p.rowSize, p.rowSizeHint),
+		"chunk_size", p.chunkSize,
+		"command_delay", p.commandDelay.String(),
+	)
+}
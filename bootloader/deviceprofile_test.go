@@ -0,0 +1,159 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestDeviceProfile(t *testing.T) {
+	const siliconID = 0x0BADCAFE
+	RegisterDeviceProfile(DeviceProfile{
+		Name:         "test device",
+		SiliconID:    siliconID,
+		RowSize:      128,
+		ChunkSize:    32,
+		CommandDelay: 5 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		deviceProfilesMu.Lock()
+		delete(deviceProfiles, siliconID)
+		deviceProfilesMu.Unlock()
+	})
+
+	if profile, ok := LookupDeviceProfile(siliconID); !ok || profile.Name != "test device" {
+		t.Fatalf("LookupDeviceProfile() = %+v, %t", profile, ok)
+	}
+	if _, ok := LookupDeviceProfile(0x0BADF00D); ok {
+		t.Fatal("profile found for an unregistered device")
+	}
+
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	data := bytes.Repeat([]byte{0x5A}, 128)
+	fw := &cyacd.Firmware{
+		SiliconID: siliconID,
+		Rows:      []*cyacd.Row{{ArrayID: 0, RowNum: 0x0010, Size: 128, Data: data, Checksum: protocol.CalculateRowChecksum(data)}},
+	}
+	newDevice := func() *bootloadertest.Device {
+		return bootloadertest.NewDevice(bootloadertest.WithSiliconID(siliconID))
+	}
+
+	t.Run("applied", func(t *testing.T) {
+		clock := bootloadertest.NewClock(time.Unix(0, 0))
+		device := newDevice()
+		prog := New(device, WithClock(clock))
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("Program() error = %v", err)
+		}
+		// 128 bytes in 32-byte chunks: three Send Data and a Program Row
+		sends := bytes.Count(device.Commands(), []byte{protocol.CmdSendData})
+		if sends != 3 {
+			t.Errorf("%d Send Data commands, want 3", sends)
+		}
+		if len(clock.Sleeps()) == 0 || clock.Sleeps()[0] != 5*time.Millisecond {
+			t.Errorf("command delays %v, want 5ms", clock.Sleeps())
+		}
+
+		// The profile's row size rejects a short row
+		short := &cyacd.Firmware{
+			SiliconID: siliconID,
+			Rows:      []*cyacd.Row{{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data[:4], Checksum: protocol.CalculateRowChecksum(data[:4])}},
+		}
+		if err := New(newDevice()).Program(context.Background(), short, key); !errors.Is(err, ErrGeometry) {
+			t.Errorf("expected ErrGeometry, got %v", err)
+		}
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		device := newDevice()
+		prog := New(device, WithChunkSize(100), WithCommandDelay(0))
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("Program() error = %v", err)
+		}
+		if sends := bytes.Count(device.Commands(), []byte{protocol.CmdSendData}); sends != 1 {
+			t.Errorf("%d Send Data commands, want 1", sends)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		device := newDevice()
+		prog := New(device, WithDeviceProfiles(false))
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("Program() error = %v", err)
+		}
+		// DefaultChunkSize (57) bytes per Send Data
+		if sends := bytes.Count(device.Commands(), []byte{protocol.CmdSendData}); sends != 2 {
+			t.Errorf("%d Send Data commands, want 2", sends)
+		}
+	})
+}
+
+func TestBuiltinDeviceProfiles(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	for _, name := range []string{"psoc4", "psoc5lp"} {
+		t.Run(name, func(t *testing.T) {
+			preset, _ := bootloadertest.LookupPreset(name)
+			profile, ok := LookupDeviceProfile(preset.SiliconID)
+			if !ok || profile.RowSize != preset.RowSize {
+				t.Fatalf("LookupDeviceProfile(0x%08X) = %+v, %t", preset.SiliconID, profile, ok)
+			}
+
+			image := func(size int) *cyacd.Firmware {
+				data := bytes.Repeat([]byte{0x5A}, size)
+				return &cyacd.Firmware{
+					SiliconID: preset.SiliconID,
+					Rows:      []*cyacd.Row{{ArrayID: 0, RowNum: preset.FlashStart, Size: uint16(size), Data: data, Checksum: protocol.CalculateRowChecksum(data)}},
+				}
+			}
+
+			// Applied without registration
+			logger := &MockLogger{}
+			device, _ := bootloadertest.NewPresetDevice(name)
+			if err := New(device, WithLogger(logger)).Program(context.Background(), image(preset.RowSize), key); err != nil {
+				t.Fatalf("%d-byte rows: %v", preset.RowSize, err)
+			}
+			if !slices.Contains(logger.infoMsgs, "device profile applied") {
+				t.Errorf("info messages = %q, want the profile applied", logger.infoMsgs)
+			}
+
+			// The built-in row size is a hint: other rows reach the device,
+			// which decides, and the difference is logged
+			logger = &MockLogger{}
+			err := New(device, WithLogger(logger)).Program(context.Background(), image(64), key)
+			var protoErr *protocol.ProtocolError
+			if errors.Is(err, ErrGeometry) || !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrLength {
+				t.Errorf("64-byte rows: error = %v, want the device's length error", err)
+			}
+			if !slices.Contains(logger.infoMsgs, "image rows differ from the usual row size of the device") {
+				t.Errorf("info messages = %q, want the row size difference", logger.infoMsgs)
+			}
+		})
+	}
+
+	t.Run("registered profile is checked", func(t *testing.T) {
+		preset, _ := bootloadertest.LookupPreset("psoc4")
+		RegisterDeviceProfile(DeviceProfile{Name: "product", SiliconID: preset.SiliconID, RowSize: preset.RowSize})
+		t.Cleanup(func() {
+			deviceProfilesMu.Lock()
+			delete(deviceProfiles, preset.SiliconID)
+			deviceProfilesMu.Unlock()
+		})
+
+		data := bytes.Repeat([]byte{0x5A}, 64)
+		fw := &cyacd.Firmware{
+			SiliconID: preset.SiliconID,
+			Rows:      []*cyacd.Row{{ArrayID: 0, RowNum: preset.FlashStart, Size: 64, Data: data, Checksum: protocol.CalculateRowChecksum(data)}},
+		}
+		device, _ := bootloadertest.NewPresetDevice("psoc4")
+		if err := New(device).Program(context.Background(), fw, key); !errors.Is(err, ErrGeometry) {
+			t.Errorf("expected ErrGeometry, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Candidate is a device that may host a bootloader, as reported by an Enumerator.
+// The library has no platform dependencies, so enumerating serial ports or HID
+// devices is left to the caller's USB or serial library.
+type Candidate struct {
+	// Name identifies the device, e.g. "/dev/ttyACM0", "COM3", or a HID path
+	Name string
+
+	// VendorID and ProductID are the USB identifiers (0 if unknown)
+	VendorID  uint16
+	ProductID uint16
+
+	// SerialNumber is the USB serial number (empty if unknown)
+	SerialNumber string
+
+	// Open opens the device for communication
+	Open func() (io.ReadWriter, error)
+}
+
+// Enumerator lists candidate devices.
+type Enumerator func(ctx context.Context) ([]Candidate, error)
+
+// Discovered is a candidate whose bootloader answered the probe.
+type Discovered struct {
+	Candidate
+
+	// Device is the open device, left in bootloader mode.
+	// The caller owns it and must close it when done.
+	Device io.ReadWriter
+
+	// Info is the identification returned by Enter Bootloader
+	Info *protocol.DeviceInfo
+
+	// Key is the bootloader key the device accepted
+	Key []byte
+}
+
+// DiscoverOption configures Discover.
+type DiscoverOption func(*discoverConfig)
+
+type discoverConfig struct {
+	match     func(Candidate) bool
+	keys      [][]byte
+	siliconID uint32
+	options   []Option
+}
+
+// MatchVIDPID probes only candidates with the given USB vendor and product ID.
+func MatchVIDPID(vendorID, productID uint16) DiscoverOption {
+	return func(c *discoverConfig) {
+		prev := c.match
+		c.match = func(cand Candidate) bool {
+			return prev(cand) && cand.VendorID == vendorID && cand.ProductID == productID
+		}
+	}
+}
+
+// MatchName probes only candidates whose name matches the shell pattern
+// (see path.Match), e.g. "/dev/ttyACM*".
+func MatchName(pattern string) DiscoverOption {
+	return func(c *discoverConfig) {
+		prev := c.match
+		c.match = func(cand Candidate) bool {
+			ok, err := path.Match(pattern, cand.Name)
+			return prev(cand) && err == nil && ok
+		}
+	}
+}
+
+// MatchSiliconID keeps only devices whose bootloader reports the given silicon ID.
+func MatchSiliconID(siliconID uint32) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.siliconID = siliconID
+	}
+}
+
+// WithProbeKeys sets the bootloader keys tried on each device, in order.
+// Each key must be protocol.BootloaderKeySize bytes, or protocol.NoKey.
+//
+// Example:
+//
+//	bootloader.WithProbeKeys([]byte(protocol.DefaultExampleKey), protocol.NoKey)
+func WithProbeKeys(keys ...[]byte) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.keys = append(c.keys, keys...)
+	}
+}
+
+// WithProbeOptions sets the Programmer options used while probing,
+// e.g. a short read timeout so unresponsive devices are skipped quickly.
+func WithProbeOptions(opts ...Option) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.options = append(c.options, opts...)
+	}
+}
+
+// Discover enumerates candidate devices and probes each one for a bootloader.
+//
+// Every candidate that passes the match filters is opened, resynchronized with
+// Sync Bootloader, and sent Enter Bootloader with each probe key until one is
+// accepted. Devices that answer are returned open and in bootloader mode;
+// devices that do not are closed (if they implement io.Closer). Probe failures
+// of individual devices are not errors: Discover only fails if enumeration fails.
+//
+// Example:
+//
+//	found, err := bootloader.Discover(ctx, listSerialPorts,
+//	    bootloader.MatchVIDPID(0x04B4, 0xB71D),
+//	    bootloader.WithProbeKeys(key),
+//	    bootloader.WithProbeOptions(bootloader.WithReadTimeout(500*time.Millisecond)),
+//	)
+//	for _, d := range found {
+//	    fmt.Printf("%s: silicon ID 0x%08X\n", d.Name, d.Info.SiliconID)
+//	}
+func Discover(ctx context.Context, enumerate Enumerator, opts ...DiscoverOption) ([]Discovered, error) {
+	cfg := discoverConfig{
+		match: func(Candidate) bool { return true },
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.keys) == 0 {
+		return nil, fmt.Errorf("no probe keys configured")
+	}
+
+	candidates, err := enumerate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("enumerate devices: %w", err)
+	}
+
+	var found []Discovered
+	for _, cand := range candidates {
+		if err := ctx.Err(); err != nil {
+			return found, fmt.Errorf("canceled: %w", err)
+		}
+		if !cfg.match(cand) || cand.Open == nil {
+			continue
+		}
+
+		if d, ok := probe(ctx, cand, &cfg); ok {
+			found = append(found, d)
+		}
+	}
+
+	return found, nil
+}
+
+// probe opens a candidate and tries each key. The device is closed unless it answers.
+func probe(ctx context.Context, cand Candidate, cfg *discoverConfig) (Discovered, bool) {
+	device, err := cand.Open()
+	if err != nil {
+		return Discovered{}, false
+	}
+
+	prog := New(device, cfg.options...)
+	for _, key := range cfg.keys {
+		// Discard any half-received command left by a previous host
+		_ = prog.Abort(ctx)
+
+		info, err := prog.EnterBootloader(ctx, key)
+		if err != nil {
+			continue
+		}
+		if cfg.siliconID != 0 && info.SiliconID != cfg.siliconID {
+			break
+		}
+
+		// A copy of protocol.NoKey would be an empty key, so it is kept as is
+		if !protocol.IsNoKey(key) {
+			key = append([]byte(nil), key...)
+		}
+		return Discovered{
+			Candidate: cand,
+			Device:    device,
+			Info:      info,
+			Key:       key,
+		}, true
+	}
+
+	if c, ok := device.(io.Closer); ok {
+		_ = c.Close()
+	}
+	return Discovered{}, false
+}
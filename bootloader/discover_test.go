@@ -0,0 +1,114 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// probeDevice answers Enter Bootloader only for the given key.
+type probeDevice struct {
+	*MockDevice
+	key    []byte
+	closed bool
+}
+
+func (d *probeDevice) Write(p []byte) (int, error) {
+	if len(p) > 1 && p[1] == protocol.CmdEnterBootloader {
+		if string(p[4:10]) == string(d.key) {
+			d.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		} else {
+			d.AddResponse(protocol.ErrKey, nil)
+		}
+	}
+	return d.MockDevice.Write(p)
+}
+
+func (d *probeDevice) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestDiscover(t *testing.T) {
+	keyA := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	keyB := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+	matching := &probeDevice{MockDevice: NewMockDevice(), key: keyB}
+	wrongKey := &probeDevice{MockDevice: NewMockDevice(), key: []byte{9, 9, 9, 9, 9, 9}}
+	opened := map[string]bool{}
+
+	candidate := func(name string, pid uint16, dev *probeDevice) Candidate {
+		return Candidate{
+			Name:      name,
+			VendorID:  0x04B4,
+			ProductID: pid,
+			Open: func() (io.ReadWriter, error) {
+				opened[name] = true
+				return dev, nil
+			},
+		}
+	}
+	enumerate := func(ctx context.Context) ([]Candidate, error) {
+		return []Candidate{
+			candidate("/dev/ttyACM0", 0xB71D, matching),
+			candidate("/dev/ttyACM1", 0xB71D, wrongKey),
+			candidate("/dev/ttyUSB0", 0x0001, &probeDevice{MockDevice: NewMockDevice()}),
+		}, nil
+	}
+
+	found, err := Discover(context.Background(), enumerate,
+		MatchVIDPID(0x04B4, 0xB71D),
+		WithProbeKeys(keyA, keyB),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(found) != 1 {
+		t.Fatalf("found %d devices, want 1", len(found))
+	}
+	if found[0].Name != "/dev/ttyACM0" || found[0].Info.SiliconID != 0x1E9602AA {
+		t.Errorf("found %s with silicon ID 0x%08X", found[0].Name, found[0].Info.SiliconID)
+	}
+	if string(found[0].Key) != string(keyB) {
+		t.Errorf("Key = % 02X, want % 02X", found[0].Key, keyB)
+	}
+
+	if opened["/dev/ttyUSB0"] {
+		t.Error("device filtered by VID:PID was opened")
+	}
+	if !wrongKey.closed || matching.closed {
+		t.Errorf("closed: matching=%t wrongKey=%t, want false and true", matching.closed, wrongKey.closed)
+	}
+}
+
+func TestDiscoverErrors(t *testing.T) {
+	enumErr := errors.New("permission denied")
+	_, err := Discover(context.Background(), func(ctx context.Context) ([]Candidate, error) {
+		return nil, enumErr
+	}, WithProbeKeys([]byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}))
+	if !errors.Is(err, enumErr) {
+		t.Errorf("error = %v, want enumeration error", err)
+	}
+
+	if _, err := Discover(context.Background(), func(ctx context.Context) ([]Candidate, error) {
+		return nil, nil
+	}); err == nil {
+		t.Error("expected error without probe keys")
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	cfg := discoverConfig{match: func(Candidate) bool { return true }}
+	MatchName("/dev/ttyACM*")(&cfg)
+
+	if !cfg.match(Candidate{Name: "/dev/ttyACM3"}) {
+		t.Error("expected /dev/ttyACM3 to match")
+	}
+	if cfg.match(Candidate{Name: "/dev/ttyUSB0"}) {
+		t.Error("expected /dev/ttyUSB0 not to match")
+	}
+}
@@ -25,8 +25,8 @@
 //	// Create programmer
 //	prog := bootloader.New(device)
 //
-//	// Program with 6-byte key
-//	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+//	// Program with 6-byte key (protocol.NoKey for bootloaders without one)
+//	key := []byte(protocol.DefaultExampleKey)
 //	err = prog.Program(context.Background(), fw, key)
 //	if err != nil {
 //	    log.Fatal(err)
@@ -91,11 +91,19 @@
 //
 // The package provides structured error types:
 //   - DeviceMismatchError: Silicon ID doesn't match firmware
+//   - SiliconRevMismatchError: Silicon revision doesn't match (see WithSiliconRevCheck)
 //   - RowOutOfRangeError: Row number exceeds flash size
+//   - ProtectedRowError: Row lies in a range configured with WithProtectedRows
 //   - ChecksumMismatchError: Row verification failed
 //   - VerificationError: Application checksum failed
+//   - ProgramRowError: Programming or verifying a specific row failed (wraps the cause)
+//   - ErrBusy: Another operation is already in progress on the Programmer
+//   - ErrEncryptionUnsupported: ProgramV2 was given an encrypted image the bootloader cannot accept
 //   - protocol.ProtocolError: Bootloader returned an error status
 //
+// IsRetryable classifies any of these errors as worth retrying (transport
+// failures) or fatal.
+//
 // # Hardware Independence
 //
 // This package does NOT implement hardware communication.
@@ -115,4 +123,8 @@
 //
 // This design allows the library to work with any communication method:
 // USB, HID, UART, SPI, I2C, network, or even mock devices for testing.
+//
+// Devices may optionally implement ContextReader and ContextWriter so that a
+// canceled context (or the configured read/write timeout) interrupts a blocking
+// read or write instead of waiting for the device to answer.
 package bootloader
@@ -0,0 +1,55 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// DefaultEntryInterval is the pause between Enter Bootloader attempts within
+// an entry window (see WithEntryWindow).
+const DefaultEntryInterval = 500 * time.Millisecond
+
+// retryEntry calls enter until it succeeds or the entry window set with
+// WithEntryWindow has passed, sending Sync Bootloader and pausing for the
+// entry interval between attempts. Errors that will not go away on retry,
+// such as a rejected key, end the window early. Without a window, enter is
+// called once.
+func (p *Programmer) retryEntry(ctx context.Context, enter func() (*protocol.DeviceInfo, error)) (*protocol.DeviceInfo, error) {
+	window := p.config.EntryWindow
+	if window <= 0 {
+		return enter()
+	}
+	interval := p.config.EntryInterval
+	if interval <= 0 {
+		interval = DefaultEntryInterval
+	}
+
+	start := p.clock.Now()
+	for attempt := 1; ; attempt++ {
+		info, err := enter()
+		if err == nil {
+			if attempt > 1 {
+				p.logInfo("bootloader entered", "phase", PhaseEntering, "attempt", attempt, "duration", p.clock.Since(start).String())
+			}
+			return info, nil
+		}
+		if ctx.Err() != nil || !IsRetryable(err) {
+			return nil, err
+		}
+		if p.clock.Since(start)+interval > window {
+			return nil, fmt.Errorf("bootloader not ready after %d attempts in %s: %w", attempt, window, err)
+		}
+		p.logDebug("waiting for bootloader", "phase", PhaseEntering, "attempt", attempt, "error", err)
+
+		// Discard anything a half-booted device may have buffered
+		if err := p.resync(ctx); err != nil {
+			p.logDebug("sync before entry failed", "phase", PhaseEntering, "error", err)
+		}
+		if err := p.clock.Sleep(ctx, interval); err != nil {
+			return nil, fmt.Errorf("wait for bootloader: %w", err)
+		}
+	}
+}
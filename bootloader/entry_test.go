@@ -0,0 +1,75 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestEntryWindow(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("device booting", func(t *testing.T) {
+		// The first two Enter Bootloader commands go unanswered
+		device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+			Kind: bootloadertest.FaultDropFrame, Command: protocol.CmdEnterBootloader, Times: 2,
+		}))
+		prog := New(device, WithEntryWindow(5*time.Second, 10*time.Millisecond), WithReadTimeout(20*time.Millisecond))
+
+		info, err := prog.EnterBootloader(context.Background(), key)
+		if err != nil {
+			t.Fatalf("EnterBootloader() error = %v", err)
+		}
+		if info.SiliconID != bootloadertest.DefaultSiliconID {
+			t.Errorf("SiliconID = 0x%08X", info.SiliconID)
+		}
+		want := []byte{protocol.CmdSyncBootloader, protocol.CmdSyncBootloader, protocol.CmdEnterBootloader}
+		if got := device.Commands(); string(got) != string(want) {
+			t.Errorf("commands = % X, want % X", got, want)
+		}
+	})
+
+	t.Run("window expires", func(t *testing.T) {
+		device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+			Kind: bootloadertest.FaultDropFrame, Command: protocol.CmdEnterBootloader, Times: -1,
+		}))
+		prog := New(device, WithEntryWindow(100*time.Millisecond, 10*time.Millisecond), WithReadTimeout(20*time.Millisecond))
+
+		_, err := prog.EnterBootloader(context.Background(), key)
+		if !IsTimeout(err) {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "bootloader not ready after") {
+			t.Errorf("error %q does not count the attempts", err)
+		}
+		if syncs := strings.Count(string(device.Commands()), string([]byte{protocol.CmdSyncBootloader})); syncs < 2 {
+			t.Errorf("%d Sync Bootloader commands, want several", syncs)
+		}
+	})
+
+	t.Run("bad key", func(t *testing.T) {
+		device := bootloadertest.NewDevice(bootloadertest.WithKey(key))
+		prog := New(device, WithEntryWindow(time.Minute, 0))
+
+		_, err := prog.EnterBootloader(context.Background(), []byte{1, 2, 3, 4, 5, 6})
+		var protoErr *protocol.ProtocolError
+		if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrKey {
+			t.Fatalf("expected a key error, got %v", err)
+		}
+		if got := len(device.Commands()); got != 1 {
+			t.Errorf("%d commands, want a single attempt", got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewProgrammer(bootloadertest.NewDevice(), WithEntryWindow(-time.Second, 0))
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected ErrInvalidOption, got %v", err)
+		}
+	})
+}
@@ -1,9 +1,115 @@
 package bootloader
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+
+	"github.com/moffa90/go-cyacd/protocol"
 )
 
+// ErrBusy is returned when an operation is started while another operation
+// on the same Programmer is still in progress.
+var ErrBusy = errors.New("programmer busy: another operation is in progress")
+
+// ErrInvalidOption is wrapped by the errors NewProgrammer returns for option
+// values that are out of range and for options that conflict.
+var ErrInvalidOption = errors.New("invalid option")
+
+// ErrNotConfirmed wraps the error returned by the ConfirmFunc set with
+// WithConfirm when it refuses an operation. Nothing was written to the device.
+var ErrNotConfirmed = errors.New("operation not confirmed")
+
+// ErrAborted is the cancellation cause of an operation stopped with Abort: the
+// error the operation returns wraps both context.Canceled and ErrAborted.
+var ErrAborted = errors.New("operation aborted")
+
+// ErrEncryptionUnsupported is returned by ProgramV2 when an encrypted image is
+// programmed into a bootloader without encryption support.
+var ErrEncryptionUnsupported = errors.New("bootloader does not support encrypted images")
+
+// Targets for errors.Is matching the structured error types below, for
+// callers that only need to know what went wrong, not the details. Each error
+// type reports a match with its target, so
+//
+//	errors.Is(err, bootloader.ErrRowOutOfRange)
+//
+// holds whenever errors.As(err, new(*bootloader.RowOutOfRangeError)) does.
+// The targets are never returned themselves.
+//
+// Example:
+//
+//	switch {
+//	case errors.Is(err, bootloader.ErrDeviceMismatch):
+//	    log.Print("wrong firmware for this device")
+//	case errors.Is(err, bootloader.ErrChecksumMismatch), errors.Is(err, bootloader.ErrVerification):
+//	    log.Print("the device did not read back what was written")
+//	}
+var (
+	ErrDeviceMismatch     = errors.New("device mismatch")
+	ErrSiliconRevMismatch = errors.New("silicon revision mismatch")
+	ErrRowOutOfRange      = errors.New("row out of range")
+	ErrProtectedRow       = errors.New("protected row")
+	ErrChecksumMismatch   = errors.New("row checksum mismatch")
+	ErrVerification       = errors.New("application verification failed")
+	ErrGeometry           = errors.New("flash geometry mismatch")
+)
+
+// TimeoutError is returned when the device does not answer a command within
+// the read timeout (see WithReadTimeout). It implements the Timeout and
+// Temporary methods of net.Error, so generic retry code can recognize it.
+type TimeoutError struct {
+	// Op describes what timed out, e.g. "read response"
+	Op string
+
+	// Err is the underlying error, usually context.DeadlineExceeded
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports true.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary reports true: a timed-out command may succeed when retried.
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// IOError is returned when reading from or writing to the transport fails,
+// e.g. because a serial adapter was unplugged. The operation may succeed when
+// retried after the transport recovers.
+type IOError struct {
+	// Op describes the transfer that failed, e.g. "read response" (empty
+	// for writes, which callers describe)
+	Op string
+
+	// Err is the error returned by the transport
+	Err error
+}
+
+func (e *IOError) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
 // DeviceMismatchError indicates that the device silicon ID doesn't match the firmware.
 type DeviceMismatchError struct {
 	Expected uint32
@@ -15,6 +121,28 @@ func (e *DeviceMismatchError) Error() string {
 		e.Expected, e.Actual)
 }
 
+// Is reports whether target is ErrDeviceMismatch.
+func (e *DeviceMismatchError) Is(target error) bool {
+	return target == ErrDeviceMismatch
+}
+
+// SiliconRevMismatchError indicates that the device silicon revision doesn't match
+// the expected revision. See WithSiliconRevCheck and WithExpectedSiliconRev.
+type SiliconRevMismatchError struct {
+	Expected byte
+	Actual   byte
+}
+
+func (e *SiliconRevMismatchError) Error() string {
+	return fmt.Sprintf("silicon revision mismatch: expected 0x%02X, device has 0x%02X",
+		e.Expected, e.Actual)
+}
+
+// Is reports whether target is ErrSiliconRevMismatch.
+func (e *SiliconRevMismatchError) Is(target error) bool {
+	return target == ErrSiliconRevMismatch
+}
+
 // RowOutOfRangeError indicates that a firmware row is outside the device's flash range.
 type RowOutOfRangeError struct {
 	ArrayID uint8
@@ -28,6 +156,58 @@ func (e *RowOutOfRangeError) Error() string {
 		e.RowNum, e.ArrayID, e.MinRow, e.MaxRow)
 }
 
+// Is reports whether target is ErrRowOutOfRange.
+func (e *RowOutOfRangeError) Is(target error) bool {
+	return target == ErrRowOutOfRange
+}
+
+// ProtectedRowError indicates that an operation would write to a protected flash row.
+// See WithProtectedRows.
+type ProtectedRowError struct {
+	ArrayID uint8
+	RowNum  uint16
+	Range   RowRange
+}
+
+func (e *ProtectedRowError) Error() string {
+	return fmt.Sprintf("row %d (array %d) is protected (%s)", e.RowNum, e.ArrayID, e.Range)
+}
+
+// Is reports whether target is ErrProtectedRow.
+func (e *ProtectedRowError) Is(target error) bool {
+	return target == ErrProtectedRow
+}
+
+// GeometryError indicates that a firmware row does not match the flash row
+// geometry of the device: its data is not one row long, or (for .cyacd2
+// images) it does not start on a row boundary. See WithRowSize.
+type GeometryError struct {
+	// ArrayID and RowNum identify the row of a .cyacd image
+	ArrayID uint8
+	RowNum  uint16
+
+	// Address is the flash address of the row of a .cyacd2 image
+	Address uint32
+
+	// Length is the number of data bytes in the row
+	Length int
+
+	// RowSize is the flash row size of the device
+	RowSize int
+
+	// Reason describes the mismatch
+	Reason string
+}
+
+func (e *GeometryError) Error() string {
+	return fmt.Sprintf("flash geometry mismatch: %s", e.Reason)
+}
+
+// Is reports whether target is ErrGeometry.
+func (e *GeometryError) Is(target error) bool {
+	return target == ErrGeometry
+}
+
 // ChecksumMismatchError indicates that a row checksum verification failed.
 type ChecksumMismatchError struct {
 	RowNum   uint16
@@ -40,6 +220,11 @@ func (e *ChecksumMismatchError) Error() string {
 		e.RowNum, e.Expected, e.Actual)
 }
 
+// Is reports whether target is ErrChecksumMismatch.
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
 // VerificationError indicates that the application checksum verification failed.
 type VerificationError struct {
 	Reason string
@@ -48,3 +233,139 @@ type VerificationError struct {
 func (e *VerificationError) Error() string {
 	return fmt.Sprintf("application verification failed: %s", e.Reason)
 }
+
+// Is reports whether target is ErrVerification.
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrVerification
+}
+
+// ProgramRowError indicates that programming or verifying a flash row failed.
+// It identifies the row and wraps the underlying protocol or I/O error, so callers
+// can find the failing row with errors.As instead of parsing error strings.
+//
+// Example:
+//
+//	var rowErr *bootloader.ProgramRowError
+//	if errors.As(err, &rowErr) {
+//	    log.Printf("row %d (array %d) failed after %d attempts: %v",
+//	        rowErr.RowNum, rowErr.ArrayID, rowErr.Attempts, rowErr.Err)
+//	}
+type ProgramRowError struct {
+	// Index is the position of the row in programming order (0-based)
+	Index int
+
+	// ArrayID is the flash array of the row
+	ArrayID uint8
+
+	// RowNum is the flash row number
+	RowNum uint16
+
+	// Phase is PhaseProgramming if writing the row failed,
+	// or PhaseVerifying if reading back its checksum failed
+	Phase Phase
+
+	// Attempts is the number of times the row was tried, including retries
+	Attempts int
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *ProgramRowError) Error() string {
+	op := "program"
+	if e.Phase == PhaseVerifying {
+		op = "verify"
+	}
+	return fmt.Sprintf("%s row %d (array=%d, row=%d): %v", op, e.Index, e.ArrayID, e.RowNum, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ProgramRowError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether the operation that returned err may succeed if
+// retried, for example on the same device after reconnecting it. The Programmer
+// uses the same classification to decide which row failures to retry, except
+// that a row failing with ChecksumMismatchError is also erased and reprogrammed
+// within the retry budget before the session fails.
+//
+// Only errors known to be transient are retryable: read and write timeouts
+// (see IsTimeout), transport I/O errors (IOError, io.EOF, and
+// io.ErrUnexpectedEOF), malformed or truncated frames (protocol.FrameError),
+// packets the bootloader rejected with a packet checksum error (corrupted in
+// transit), and ErrBusy. Every other error is fatal, including bootloader
+// status errors other than ErrChecksum (bad key, invalid row, unknown
+// command, ...), the mismatch and verification errors of this package,
+// ErrNotConfirmed, ErrInvalidOption, ErrAborted, invalid arguments, and
+// cancellation. Wrapped errors such as ProgramRowError are classified by
+// their cause.
+//
+// Example:
+//
+//	err := prog.Program(ctx, fw, key)
+//	if err != nil && bootloader.IsRetryable(err) {
+//	    // power-cycle the device and try again
+//	}
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var protoErr *protocol.ProtocolError
+	if errors.As(err, &protoErr) {
+		return protoErr.StatusCode == protocol.ErrChecksum
+	}
+
+	switch {
+	case errors.Is(err, ErrDeviceMismatch), errors.Is(err, ErrSiliconRevMismatch), errors.Is(err, ErrRowOutOfRange),
+		errors.Is(err, ErrProtectedRow), errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrVerification),
+		errors.Is(err, ErrGeometry):
+		return false
+	case errors.Is(err, ErrEncryptionUnsupported), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, ErrNotConfirmed), errors.Is(err, ErrInvalidOption), errors.Is(err, ErrAborted):
+		// A refusal, a configuration mistake, or an abort stands until the
+		// caller changes something
+		return false
+	}
+
+	var ioErr *IOError
+	switch {
+	case IsTimeout(err), errors.As(err, &ioErr), errors.Is(err, protocol.ErrMalformedFrame):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, ErrBusy):
+		return true
+	}
+	return false
+}
+
+// IsTimeout reports whether err, or an error it wraps, is a timeout: a
+// *TimeoutError, context.DeadlineExceeded, or any error whose Timeout method
+// (as in net.Error) reports true. Timeouts are also retryable (see
+// IsRetryable).
+//
+// Example:
+//
+//	if bootloader.IsTimeout(err) {
+//	    log.Print("device not responding, check the cable and baud rate")
+//	}
+func IsTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// withCause adds the cause ctx was canceled with (see context.Cause) to the
+// chain of err, so that callers canceling with a reason, such as a user abort
+// or an unplugged device, see it rather than a bare context.Canceled. err is
+// returned unchanged if ctx is not done or was canceled without a cause.
+func withCause(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if cause == nil || cause == ctx.Err() || errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", err, cause)
+}
@@ -1,8 +1,14 @@
 package bootloader
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+
+	"github.com/moffa90/go-cyacd/protocol"
 )
 
 func TestDeviceMismatchError(t *testing.T) {
@@ -111,10 +117,159 @@ func TestVerificationError(t *testing.T) {
 	}
 }
 
+func TestProgramRowError(t *testing.T) {
+	cause := &protocol.ProtocolError{Operation: "verify row", StatusCode: protocol.ErrChecksum}
+	err := &ProgramRowError{
+		Index:    3,
+		ArrayID:  1,
+		RowNum:   42,
+		Phase:    PhaseVerifying,
+		Attempts: 2,
+		Err:      cause,
+	}
+
+	errMsg := err.Error()
+	for _, want := range []string{"verify row 3", "array=1", "row=42", "checksum mismatch"} {
+		if !strings.Contains(errMsg, want) {
+			t.Errorf("error message should contain %q, got: %s", want, errMsg)
+		}
+	}
+
+	var protoErr *protocol.ProtocolError
+	if !errors.As(err, &protoErr) || protoErr != cause {
+		t.Error("errors.As should find the wrapped ProtocolError")
+	}
+
+	err.Phase = PhaseProgramming
+	if !strings.HasPrefix(err.Error(), "program row 3") {
+		t.Errorf("error message should start with 'program row 3', got: %s", err.Error())
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"I/O error", fmt.Errorf("read response: %w", io.ErrUnexpectedEOF), true},
+		{"read timeout", fmt.Errorf("read response: %w", context.DeadlineExceeded), true},
+		{"malformed frame", &protocol.FrameError{Reason: "invalid start of packet: got 0x00, expected 0x01"}, true},
+		{"transport error", &IOError{Op: "read response", Err: errors.New("device disconnected")}, true},
+		{"packet checksum status", &protocol.ProtocolError{StatusCode: protocol.ErrChecksum}, true},
+		{"busy", ErrBusy, true},
+		{"bad key", &protocol.ProtocolError{StatusCode: protocol.ErrKey}, false},
+		{"invalid row", &protocol.ProtocolError{StatusCode: protocol.ErrRow}, false},
+		{"canceled", fmt.Errorf("canceled: %w", context.Canceled), false},
+		{"device mismatch", &DeviceMismatchError{Expected: 1, Actual: 2}, false},
+		{"silicon revision mismatch", &SiliconRevMismatchError{Expected: 1, Actual: 2}, false},
+		{"row out of range", &RowOutOfRangeError{}, false},
+		{"protected row", &ProtectedRowError{}, false},
+		{"row checksum mismatch", &ChecksumMismatchError{}, false},
+		{"verification", &VerificationError{Reason: "invalid"}, false},
+		{"encryption unsupported", ErrEncryptionUnsupported, false},
+		{"wrapped row error", &ProgramRowError{Err: &protocol.ProtocolError{StatusCode: protocol.ErrData}}, false},
+		{"wrapped transport error", &ProgramRowError{Err: io.EOF}, true},
+		{"unclassified", errors.New("firmware cannot be nil"), false},
+		{"bad key length", protocol.ValidateKey([]byte{1, 2}), false},
+		{"aborted", ErrAborted, false},
+		{"not confirmed", fmt.Errorf("confirm program: %w", ErrNotConfirmed), false},
+		{"invalid option", fmt.Errorf("%w: negative chunk size", ErrInvalidOption), false},
+		{"refusal wrapping a timeout", fmt.Errorf("%w: %w", ErrNotConfirmed, context.DeadlineExceeded), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	// Generic retry code checks the net.Error methods
+	type temporary interface {
+		Timeout() bool
+		Temporary() bool
+	}
+
+	timeout := &TimeoutError{Op: "read response", Err: context.DeadlineExceeded}
+	if got := timeout.Error(); got != "read response: context deadline exceeded" {
+		t.Errorf("Error() = %q", got)
+	}
+	var tmp temporary = timeout
+	if !tmp.Timeout() || !tmp.Temporary() {
+		t.Error("TimeoutError is not a temporary timeout")
+	}
+	tmp = &protocol.ProtocolError{StatusCode: protocol.ErrChecksum}
+	if tmp.Timeout() || !tmp.Temporary() {
+		t.Error("packet checksum status is not temporary")
+	}
+	tmp = &protocol.ProtocolError{StatusCode: protocol.ErrKey}
+	if tmp.Temporary() {
+		t.Error("bad key status is temporary")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"timeout error", fmt.Errorf("get metadata: %w", timeout), true},
+		{"deadline exceeded", fmt.Errorf("read response: %w", context.DeadlineExceeded), true},
+		{"canceled", fmt.Errorf("canceled: %w", context.Canceled), false},
+		{"I/O error", io.ErrUnexpectedEOF, false},
+		{"bootloader status", &protocol.ProtocolError{StatusCode: protocol.ErrChecksum}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTimeout(tt.err); got != tt.want {
+				t.Errorf("IsTimeout(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestErrorTypes(t *testing.T) {
 	// Test that all error types implement error interface
 	var _ error = &DeviceMismatchError{}
+	var _ error = &SiliconRevMismatchError{}
 	var _ error = &RowOutOfRangeError{}
 	var _ error = &ChecksumMismatchError{}
 	var _ error = &VerificationError{}
+	var _ error = &ProgramRowError{}
+}
+
+func TestErrorTargets(t *testing.T) {
+	tests := []struct {
+		err    error
+		target error
+	}{
+		{&DeviceMismatchError{Expected: 1, Actual: 2}, ErrDeviceMismatch},
+		{&SiliconRevMismatchError{Expected: 1, Actual: 2}, ErrSiliconRevMismatch},
+		{&RowOutOfRangeError{RowNum: 500}, ErrRowOutOfRange},
+		{&ProtectedRowError{RowNum: 3}, ErrProtectedRow},
+		{&ChecksumMismatchError{RowNum: 7}, ErrChecksumMismatch},
+		{&VerificationError{Reason: "invalid"}, ErrVerification},
+		{&GeometryError{RowSize: 128, Length: 64}, ErrGeometry},
+	}
+	targets := []error{ErrDeviceMismatch, ErrSiliconRevMismatch, ErrRowOutOfRange, ErrProtectedRow, ErrChecksumMismatch, ErrVerification, ErrGeometry}
+
+	for _, tt := range tests {
+		t.Run(tt.target.Error(), func(t *testing.T) {
+			wrapped := fmt.Errorf("program: %w", &ProgramRowError{Err: tt.err})
+			for _, target := range targets {
+				if got := errors.Is(wrapped, target); got != (target == tt.target) {
+					t.Errorf("errors.Is(%v, %v) = %t", wrapped, target, got)
+				}
+			}
+		})
+	}
+
+	if errors.Is(&protocol.ProtocolError{StatusCode: protocol.ErrChecksum}, ErrChecksumMismatch) {
+		t.Error("packet checksum status matches ErrChecksumMismatch")
+	}
 }
@@ -0,0 +1,191 @@
+package bootloader
+
+import (
+	"time"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Data sizes of the row address fields of commands.
+const (
+	// arrayIDSize is the size of the array ID sent with Get Flash Size
+	arrayIDSize = 1
+
+	// rowAddressSize is the size of the array ID and row number sent with
+	// Program Row and Verify Row
+	rowAddressSize = 3
+)
+
+// Link describes the timing of the connection to a bootloader, for Estimate.
+// Measure it on the target setup, e.g. from the Stats of a previous session.
+type Link struct {
+	// Latency is the time from the end of a command until the start of its
+	// response: transport turnaround plus bootloader processing
+	Latency time.Duration
+
+	// BytesPerSecond is the throughput of the link in each direction, e.g.
+	// 11520 for a UART at 115200 baud; 0 for a link whose transfer time is
+	// negligible
+	BytesPerSecond int
+
+	// RowWriteTime is the extra time the device takes to erase and write a
+	// flash row after Program Row, beyond Latency
+	RowWriteTime time.Duration
+}
+
+// PhaseEstimate is the expected cost of one phase of a programming session.
+type PhaseEstimate struct {
+	// Phase is the progress phase the commands are reported in
+	Phase Phase
+
+	// Commands is the number of commands sent
+	Commands int
+
+	// BytesSent and BytesReceived count the bytes on the wire, including
+	// HID report IDs and padding
+	BytesSent     int
+	BytesReceived int
+
+	// Duration is the expected time of the phase
+	Duration time.Duration
+}
+
+// Estimate is the expected duration of programming an image, returned by
+// Programmer.Estimate.
+type Estimate struct {
+	// Total is the expected duration of the whole session
+	Total time.Duration
+
+	// Phases breaks Total down by phase, in the order the phases run
+	Phases []PhaseEstimate
+}
+
+// Phase returns the estimate of the given phase, if the session runs it.
+func (e *Estimate) Phase(phase Phase) (PhaseEstimate, bool) {
+	for _, pe := range e.Phases {
+		if pe.Phase == phase {
+			return pe, true
+		}
+	}
+	return PhaseEstimate{}, false
+}
+
+// Estimate returns the expected duration of programming fw over link, for
+// showing a realistic ETA before starting. It follows the command sequence
+// of Program with the configured chunk size, command delay, write rate
+// limit, packet size, row filter, and verification options, and assumes no
+// retries. Each command costs one round trip, so with pipelining or
+// coalesced writes the estimate is an upper bound. Nothing is sent to the
+// device.
+//
+// Example:
+//
+//	est := prog.Estimate(fw, bootloader.Link{
+//	    Latency:        2 * time.Millisecond,
+//	    BytesPerSecond: 11520,
+//	})
+//	fmt.Printf("about %s\n", est.Total.Round(time.Second))
+func (p *Programmer) Estimate(fw *cyacd.Firmware, link Link) *Estimate {
+	e := &estimator{p: p, link: link}
+	rows := p.filterRows(fw.Rows)
+
+	e.begin(PhaseEntering)
+	e.command(protocol.BootloaderKeySize, protocol.EnterBootloaderResponseSize)
+	if len(rows) > 0 {
+		e.command(arrayIDSize, protocol.GetFlashSizeResponseSize)
+	}
+
+	e.begin(PhaseProgramming)
+	for _, row := range rows {
+		end := p.sendDataEnd(int(row.Size), len(row.Data), protocol.SendDataOverhead)
+		for offset := 0; offset < end; offset += p.chunkSize {
+			e.command(min(p.chunkSize, end-offset), 0)
+		}
+		e.command(rowAddressSize+len(row.Data)-end, 0)
+		e.cur().Duration += link.RowWriteTime
+	}
+
+	e.begin(PhaseVerifying)
+	if n := p.verifyInterval(); n > 0 {
+		for i := 0; i < len(rows); i += n {
+			e.command(rowAddressSize, protocol.VerifyRowResponseSize)
+		}
+	}
+	if !p.config.SkipAppVerify {
+		e.command(0, protocol.VerifyChecksumResponseSize)
+	}
+
+	if !p.config.SkipExit {
+		e.begin(PhaseExiting)
+		e.send(0)
+	}
+	return e.finish()
+}
+
+// estimator accumulates the cost of commands into phases.
+type estimator struct {
+	p    *Programmer
+	link Link
+	est  Estimate
+}
+
+// begin starts accounting commands to phase.
+func (e *estimator) begin(phase Phase) {
+	e.est.Phases = append(e.est.Phases, PhaseEstimate{Phase: phase})
+}
+
+// cur returns the phase commands are accounted to.
+func (e *estimator) cur() *PhaseEstimate {
+	return &e.est.Phases[len(e.est.Phases)-1]
+}
+
+// command adds a command with cmdData bytes of data and its response with
+// respData bytes of data.
+func (e *estimator) command(cmdData, respData int) {
+	e.send(cmdData)
+	n := e.packetSize(protocol.MinFrameSize + respData)
+	pe := e.cur()
+	pe.BytesReceived += n
+	pe.Duration += e.link.Latency + e.transfer(n, e.link.BytesPerSecond)
+}
+
+// send adds a command with cmdData bytes of data that has no response.
+func (e *estimator) send(cmdData int) {
+	n := e.packetSize(protocol.MinFrameSize + cmdData)
+	pe := e.cur()
+	pe.Commands++
+	pe.BytesSent += n
+	pe.Duration += e.p.commandDelay + max(e.transfer(n, e.link.BytesPerSecond), e.transfer(n, e.p.config.MaxBytesPerSecond))
+}
+
+// packetSize returns the size of a frame on the wire, with the HID report ID
+// and padding.
+func (e *estimator) packetSize(frame int) int {
+	if e.p.config.UseReportID {
+		frame++
+	}
+	return max(frame, e.p.config.WritePacketSize)
+}
+
+// transfer returns the time n bytes take at rate bytes per second, or 0 for
+// an unlimited rate.
+func (e *estimator) transfer(n, rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second / time.Duration(rate)
+}
+
+// finish sums the phases and drops those without commands.
+func (e *estimator) finish() *Estimate {
+	phases := e.est.Phases[:0]
+	for _, pe := range e.est.Phases {
+		if pe.Commands > 0 {
+			e.est.Total += pe.Duration
+			phases = append(phases, pe)
+		}
+	}
+	e.est.Phases = phases
+	return &e.est
+}
@@ -0,0 +1,78 @@
+package bootloader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestEstimate(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 3; i++ {
+		data := make([]byte, 200)
+		for j := range data {
+			data[j] = byte(i + j)
+		}
+		fw.Rows = append(fw.Rows, &cyacd.Row{RowNum: uint16(0x10 + i), Size: 200, Data: data, Checksum: protocol.CalculateRowChecksum(data)})
+	}
+
+	// The estimated commands and bytes match a real session
+	device := bootloadertest.NewDevice()
+	prog := New(device)
+	est := prog.Estimate(fw, Link{})
+	report, err := prog.ProgramWithReport(context.Background(), fw, []byte(protocol.DefaultExampleKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands, sent, received int
+	for _, pe := range est.Phases {
+		commands += pe.Commands
+		sent += pe.BytesSent
+		received += pe.BytesReceived
+	}
+	if commands != len(device.Commands()) || sent != report.Stats.BytesSent || received != report.Stats.BytesReceived {
+		t.Errorf("estimate: %d commands, %d bytes sent, %d received; session: %d, %d, %d",
+			commands, sent, received, len(device.Commands()), report.Stats.BytesSent, report.Stats.BytesReceived)
+	}
+	if est.Total != 0 {
+		t.Errorf("Total over an instant link = %s, want 0", est.Total)
+	}
+
+	// Durations follow the link and the command delay
+	link := Link{Latency: time.Millisecond, BytesPerSecond: 10000, RowWriteTime: 10 * time.Millisecond}
+	prog = New(bootloadertest.NewDevice(), WithCommandDelay(time.Millisecond))
+	est = prog.Estimate(fw, link)
+	var total time.Duration
+	for _, pe := range est.Phases {
+		want := time.Duration(pe.Commands)*time.Millisecond + time.Duration(pe.BytesSent+pe.BytesReceived)*100*time.Microsecond
+		if pe.Phase != PhaseExiting {
+			want += time.Duration(pe.Commands) * time.Millisecond
+		}
+		if pe.Phase == PhaseProgramming {
+			want += 3 * link.RowWriteTime
+		}
+		if pe.Duration != want {
+			t.Errorf("%s: %s, want %s", pe.Phase, pe.Duration, want)
+		}
+		total += pe.Duration
+	}
+	if est.Total != total {
+		t.Errorf("Total = %s, sum of phases %s", est.Total, total)
+	}
+
+	// Verification and exit are left out when disabled
+	prog = New(bootloadertest.NewDevice(), WithVerifyAfterProgram(false), WithSkipAppVerify(), WithSkipExit())
+	est = prog.Estimate(fw, link)
+	for _, phase := range []Phase{PhaseVerifying, PhaseExiting} {
+		if _, ok := est.Phase(phase); ok {
+			t.Errorf("estimate has a %s phase", phase)
+		}
+	}
+	if _, ok := est.Phase(PhaseProgramming); !ok {
+		t.Error("estimate has no programming phase")
+	}
+}
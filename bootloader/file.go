@@ -0,0 +1,63 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// ProgramFile parses the .cyacd file at path and programs it into the device
+// behind transport, as Program does, with a Programmer created from opts.
+//
+// The key and the firmware are validated before the device is touched: a key of
+// the wrong size, an unreadable or malformed file, and a file that contains the
+// same row more than once are reported without sending any command. The default
+// configuration (retries, timeouts, and verification after each row) suits most
+// devices, so simple tools need no options beyond a progress callback.
+//
+// Example:
+//
+//	err := bootloader.ProgramFile(ctx, port, "firmware.cyacd", key,
+//	    bootloader.WithProgressCallback(func(p bootloader.Progress) {
+//	        fmt.Printf("\r%.0f%%", p.Percentage)
+//	    }),
+//	)
+func ProgramFile(ctx context.Context, transport io.ReadWriter, path string, key []byte, opts ...Option) error {
+	if transport == nil {
+		return fmt.Errorf("transport cannot be nil")
+	}
+	if err := protocol.ValidateKey(key); err != nil {
+		return err
+	}
+
+	fw, err := cyacd.Parse(path)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := checkDuplicateRows(fw); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return New(transport, opts...).Program(ctx, fw, key)
+}
+
+// checkDuplicateRows reports a row that appears more than once in fw.
+func checkDuplicateRows(fw *cyacd.Firmware) error {
+	type rowKey struct {
+		arrayID byte
+		rowNum  uint16
+	}
+
+	seen := make(map[rowKey]bool, len(fw.Rows))
+	for _, row := range fw.Rows {
+		k := rowKey{row.ArrayID, row.RowNum}
+		if seen[k] {
+			return fmt.Errorf("row %d (array %d) appears more than once", row.RowNum, row.ArrayID)
+		}
+		seen[k] = true
+	}
+	return nil
+}
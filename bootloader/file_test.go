@@ -0,0 +1,76 @@
+package bootloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+)
+
+func TestProgramFile(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	row := "000000040001020304F2\n"
+
+	writeFile := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "firmware.cyacd")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("programs file", func(t *testing.T) {
+		device := bootloadertest.NewDevice()
+		path := writeFile(t, "1E9602AA0000\n"+row)
+
+		// The .cyacd row checksum covers the row header, which the simulated
+		// device does not include; disabling row verification also checks that
+		// options are passed through
+		err := ProgramFile(context.Background(), device, path, key, WithVerifyAfterProgram(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if data, ok := device.Row(0, 0); !ok || string(data) != "\x01\x02\x03\x04" {
+			t.Errorf("row 0 = %X, %t", data, ok)
+		}
+		if device.InBootloader() {
+			t.Error("device still in bootloader")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		key     []byte
+		errMsg  string
+	}{
+		{"invalid key", "1E9602AA0000\n" + row, key[:4], "key must be exactly 6 bytes"},
+		{"malformed file", "1E9602\n" + row, key, "invalid header length"},
+		{"duplicate row", "1E9602AA0000\n" + row + row, key, "appears more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := bootloadertest.NewDevice()
+			path := writeFile(t, tt.content)
+
+			err := ProgramFile(context.Background(), device, path, tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("error = %v, want containing %q", err, tt.errMsg)
+			}
+			if n := len(device.Commands()); n != 0 {
+				t.Errorf("%d commands sent before validation failed", n)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		err := ProgramFile(context.Background(), bootloadertest.NewDevice(), filepath.Join(t.TempDir(), "none.cyacd"), key)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
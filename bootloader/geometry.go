@@ -0,0 +1,76 @@
+package bootloader
+
+import (
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// checkGeometry checks that every firmware row holds exactly one flash row of
+// the device (see WithRowSize and DeviceProfile), so an image built for another device is
+// rejected before anything is written rather than failing mid-update with a
+// length error. Nothing is checked without a row size; rows differing from the
+// row size of a built-in device profile are only logged.
+func (p *Programmer) checkGeometry(rows []*cyacd.Row) error {
+	size := p.rowSize
+	if size <= 0 {
+		for _, row := range rows {
+			if p.rowSizeHint > 0 && len(row.Data) != p.rowSizeHint {
+				p.logInfo("image rows differ from the usual row size of the device",
+					"array", row.ArrayID, "row", row.RowNum, "length", len(row.Data), "row_size", p.rowSizeHint)
+				break
+			}
+		}
+		return nil
+	}
+
+	for _, row := range rows {
+		if len(row.Data) != size {
+			return &GeometryError{
+				ArrayID: row.ArrayID,
+				RowNum:  row.RowNum,
+				Length:  len(row.Data),
+				RowSize: size,
+				Reason:  fmt.Sprintf("row %d (array %d) has %d bytes, expected %d", row.RowNum, row.ArrayID, len(row.Data), size),
+			}
+		}
+	}
+	return nil
+}
+
+// checkGeometryV2 checks that every row of a .cyacd2 image starts on a flash
+// row boundary and holds exactly one flash row of the device. Nothing is
+// checked without a row size; rows differing from the row size of a built-in
+// device profile are only logged.
+func (p *Programmer) checkGeometryV2(rows []*cyacd.Row2) error {
+	size := p.rowSize
+	if size <= 0 {
+		for _, row := range rows {
+			if p.rowSizeHint > 0 && len(row.Data) != p.rowSizeHint {
+				p.logInfo("image rows differ from the usual row size of the device",
+					"address", fmt.Sprintf("0x%08X", row.Address), "length", len(row.Data), "row_size", p.rowSizeHint)
+				break
+			}
+		}
+		return nil
+	}
+
+	for _, row := range rows {
+		var reason string
+		switch {
+		case row.Address%uint32(size) != 0:
+			reason = fmt.Sprintf("row at 0x%08X is not on a %d-byte row boundary", row.Address, size)
+		case len(row.Data) != size:
+			reason = fmt.Sprintf("row at 0x%08X has %d bytes, expected %d", row.Address, len(row.Data), size)
+		default:
+			continue
+		}
+		return &GeometryError{
+			Address: row.Address,
+			Length:  len(row.Data),
+			RowSize: size,
+			Reason:  reason,
+		}
+	}
+	return nil
+}
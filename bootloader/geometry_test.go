@@ -0,0 +1,87 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestGeometry(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	full := bytes.Repeat([]byte{0x5A}, 128)
+	short := full[:64]
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 128, Data: full, Checksum: protocol.CalculateRowChecksum(full)},
+			{ArrayID: 0, RowNum: 0x0011, Size: 64, Data: short, Checksum: protocol.CalculateRowChecksum(short)},
+		},
+	}
+
+	device := bootloadertest.NewDevice()
+	err := New(device, WithRowSize(128)).Program(context.Background(), fw, key)
+	var geomErr *GeometryError
+	if !errors.As(err, &geomErr) {
+		t.Fatalf("expected GeometryError, got %v", err)
+	}
+	if geomErr.RowNum != 0x0011 || geomErr.Length != 64 || geomErr.RowSize != 128 {
+		t.Errorf("GeometryError = %+v", geomErr)
+	}
+	if !errors.Is(err, ErrGeometry) || IsRetryable(err) {
+		t.Errorf("error %v is not a fatal ErrGeometry", err)
+	}
+	for _, cmd := range device.Commands() {
+		if cmd == protocol.CmdSendData || cmd == protocol.CmdProgramRow {
+			t.Fatalf("row data sent before the geometry check (command 0x%02X)", cmd)
+		}
+	}
+
+	// Whole rows pass
+	fw.Rows = fw.Rows[:1]
+	if err := New(bootloadertest.NewDevice(), WithRowSize(128)).Program(context.Background(), fw, key); err != nil {
+		t.Errorf("Program() of whole rows error = %v", err)
+	}
+
+	if _, err := NewProgrammer(bootloadertest.NewDevice(), WithRowSize(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption, got %v", err)
+	}
+}
+
+func TestGeometryV2(t *testing.T) {
+	tests := []struct {
+		name string
+		row  *cyacd.Row2
+		ok   bool
+	}{
+		{"whole row", &cyacd.Row2{Address: 0x10000100, Data: make([]byte, 256)}, true},
+		{"misaligned", &cyacd.Row2{Address: 0x10000080, Data: make([]byte, 256)}, false},
+		{"short", &cyacd.Row2{Address: 0x10000100, Data: make([]byte, 100)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &v2Device{MockDevice: NewMockDevice(), majorVersion: 2}
+			fw := testFirmware2(nil)
+			fw.Rows = []*cyacd.Row2{tt.row}
+
+			err := New(device, WithRowSize(256)).ProgramV2(context.Background(), fw)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var geomErr *GeometryError
+			if !errors.As(err, &geomErr) || geomErr.Address != tt.row.Address {
+				t.Fatalf("expected GeometryError for 0x%08X, got %v", tt.row.Address, err)
+			}
+			if bytes.IndexByte(device.commands, protocol.CmdProgramData) >= 0 {
+				t.Error("Program Data sent before the geometry check")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package bootloader
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// hostLogTimeFormat is the timestamp format of Bootloader Host log lines.
+const hostLogTimeFormat = "3:04:05 PM"
+
+// hostLog writes the log of one programming session in the format of the
+// Bootloader Host application (see WithHostLog). Like the journal, a write
+// failure is logged once and disables the log.
+type hostLog struct {
+	p *Programmer
+	w io.Writer
+}
+
+// openHostLog returns the Bootloader Host log, or nil if none is configured.
+func (p *Programmer) openHostLog() *hostLog {
+	if p.config.HostLog == nil {
+		return nil
+	}
+	return &hostLog{p: p, w: p.config.HostLog}
+}
+
+// line writes a timestamped line.
+func (h *hostLog) line(format string, args ...interface{}) {
+	if h == nil || h.w == nil {
+		return
+	}
+	stamp := h.p.clock.Now().Format(hostLogTimeFormat)
+	if _, err := fmt.Fprintf(h.w, "[%s] %s\r\n", stamp, fmt.Sprintf(format, args...)); err != nil {
+		h.p.logError("host log write failed", "error", err)
+		h.w = nil
+	}
+}
+
+// start logs the start of a programming session of rows rows.
+func (h *hostLog) start(rows int) {
+	h.line("Initializing Communications...")
+	h.line("Programming Started (%d rows)", rows)
+}
+
+// device logs the identification returned by Enter Bootloader.
+func (h *hostLog) device(info *protocol.DeviceInfo) {
+	h.line("Silicon ID: 0x%08X, Silicon Rev: 0x%02X, Bootloader Version: %d.%d.%d",
+		info.SiliconID, info.SiliconRev, info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2])
+}
+
+// end logs the outcome of the session.
+func (h *hostLog) end(duration time.Duration, err error) {
+	if err == nil {
+		h.line("Programming Finished Successfully (%.1f s)", duration.Seconds())
+		return
+	}
+	h.line("Programming Failed")
+	h.line("Error: %v", err)
+}
@@ -0,0 +1,47 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestHostLog(t *testing.T) {
+	fw := journalFirmware()
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	clock := bootloadertest.NewClock(time.Date(2024, 3, 1, 14, 15, 7, 0, time.UTC))
+
+	var log bytes.Buffer
+	prog := New(bootloadertest.NewDevice(), WithClock(clock), WithHostLog(&log))
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+
+	want := "[2:15:07 PM] Initializing Communications...\r\n" +
+		"[2:15:07 PM] Programming Started (4 rows)\r\n" +
+		"[2:15:07 PM] Silicon ID: 0x1E9602AA, Silicon Rev: 0x00, Bootloader Version: 1.30.0\r\n" +
+		"[2:15:07 PM] Programming Finished Successfully (0.0 s)\r\n"
+	if log.String() != want {
+		t.Errorf("log =\n%q\nwant\n%q", log.String(), want)
+	}
+
+	// A failed session ends with the error
+	log.Reset()
+	device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultEOF,
+		Command: protocol.CmdProgramRow,
+	}))
+	prog = New(device, WithClock(clock), WithHostLog(&log), WithRetries(0))
+	if err := prog.Program(context.Background(), fw, key); err == nil {
+		t.Fatal("expected programming to fail")
+	}
+	lines := strings.Split(strings.TrimSuffix(log.String(), "\r\n"), "\r\n")
+	if n := len(lines); n < 2 || lines[n-2] != "[2:15:07 PM] Programming Failed" || !strings.HasPrefix(lines[n-1], "[2:15:07 PM] Error: ") {
+		t.Errorf("log of a failed session:\n%s", log.String())
+	}
+}
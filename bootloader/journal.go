@@ -0,0 +1,230 @@
+package bootloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// JournalEvent identifies the kind of a JournalRecord.
+type JournalEvent string
+
+const (
+	// JournalStart marks the start of a programming session
+	JournalStart JournalEvent = "start"
+
+	// JournalRow records the outcome of programming one row
+	JournalRow JournalEvent = "row"
+
+	// JournalEnd marks the end of a programming session, successful or not
+	JournalEnd JournalEvent = "end"
+)
+
+// JournalRecord is one line of a session journal (see WithJournal).
+// Records are written as JSON, one per line.
+type JournalRecord struct {
+	// Time is when the record was written
+	Time time.Time `json:"time"`
+
+	// Event is the kind of record
+	Event JournalEvent `json:"event"`
+
+	// SiliconID and SiliconRev identify the firmware image (start records)
+	SiliconID  uint32 `json:"silicon_id,omitempty"`
+	SiliconRev byte   `json:"silicon_rev,omitempty"`
+
+	// Rows is the number of rows to program (start records) or the number of
+	// rows programmed (end records)
+	Rows int `json:"rows,omitempty"`
+
+	// Index, ArrayID, RowNum, and Checksum identify the row (row records);
+	// Checksum is the row checksum from the firmware file
+	Index    int    `json:"index,omitempty"`
+	ArrayID  byte   `json:"array_id,omitempty"`
+	RowNum   uint16 `json:"row,omitempty"`
+	Checksum byte   `json:"checksum,omitempty"`
+
+	// Verified and Retries are the row outcome (row records)
+	Verified bool `json:"verified,omitempty"`
+	Retries  int  `json:"retries,omitempty"`
+
+	// Duration is the time spent on the row (row records) or the session (end records)
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Error is the error that failed the row or session, empty on success
+	Error string `json:"error,omitempty"`
+}
+
+// journal appends records to the configured journal for one operation.
+// Write failures are logged once and disable the journal, since a journal
+// problem should not fail a field update.
+type journal struct {
+	p      *Programmer
+	w      io.Writer
+	closer io.Closer
+}
+
+// openJournal opens the configured journal, or returns nil if none is configured.
+func (p *Programmer) openJournal() *journal {
+	if p.config.Journal != nil {
+		return &journal{p: p, w: p.config.Journal}
+	}
+	if p.config.JournalPath == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(p.config.JournalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		p.logError("open journal failed", "path", p.config.JournalPath, "error", err)
+		return nil
+	}
+	return &journal{p: p, w: f, closer: f}
+}
+
+// record appends rec to the journal and, for files, flushes it to stable
+// storage so that it survives a crash of the host.
+func (j *journal) record(rec JournalRecord) {
+	if j == nil || j.w == nil {
+		return
+	}
+
+	rec.Time = j.p.clock.Now()
+	line, err := json.Marshal(rec)
+	if err == nil {
+		_, err = j.w.Write(append(line, '\n'))
+	}
+	if s, ok := j.w.(interface{ Sync() error }); ok && err == nil {
+		err = s.Sync()
+	}
+	if err != nil {
+		j.p.logError("journal write failed", "error", err)
+		j.w = nil
+	}
+}
+
+// start records the start of programming fw, with rows rows selected.
+func (j *journal) start(fw *cyacd.Firmware, rows int) {
+	j.record(JournalRecord{
+		Event:      JournalStart,
+		SiliconID:  fw.SiliconID,
+		SiliconRev: fw.SiliconRev,
+		Rows:       rows,
+	})
+}
+
+// row records the outcome of programming row.
+func (j *journal) row(result RowResult, row *cyacd.Row) {
+	rec := JournalRecord{
+		Event:    JournalRow,
+		Index:    result.Index,
+		ArrayID:  result.ArrayID,
+		RowNum:   result.RowNum,
+		Checksum: row.Checksum,
+		Verified: result.Verified,
+		Retries:  result.Retries,
+		Duration: result.Duration,
+	}
+	if result.Err != nil {
+		rec.Error = result.Err.Error()
+	}
+	j.record(rec)
+}
+
+// end records the end of the session and closes the journal file, if any.
+func (j *journal) end(report *ProgramReport, duration time.Duration, err error) {
+	if j == nil {
+		return
+	}
+
+	rec := JournalRecord{
+		Event:    JournalEnd,
+		Rows:     report.RowsProgrammed,
+		Duration: duration,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	j.record(rec)
+
+	if j.closer != nil {
+		if err := j.closer.Close(); err != nil {
+			j.p.logError("close journal failed", "error", err)
+		}
+	}
+}
+
+// ReadJournal reads the records of a journal written with WithJournal or
+// WithJournalFile. A truncated last line, left by a crash in the middle of a
+// write, is ignored.
+//
+// Example:
+//
+//	f, _ := os.Open("update.journal")
+//	records, err := bootloader.ReadJournal(f)
+func ReadJournal(r io.Reader) ([]JournalRecord, error) {
+	var records []JournalRecord
+	var bad error
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if bad != nil {
+			return nil, bad
+		}
+
+		var rec JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			bad = fmt.Errorf("journal line %d: %w", line, err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return records, nil
+}
+
+// ResumeFilter returns a RowFilterFunc for resuming an update recorded in
+// records. Rows programmed successfully since the last session that completed
+// successfully are skipped, matched by array, row number, and firmware row
+// checksum, so a session that failed or was cut short by a crash (leaving no
+// end record) continues where it stopped, across any number of resumed
+// attempts. If the last session completed, every row is selected.
+//
+// The application checksum is still verified when the resumed session ends,
+// so rows that did not survive on the device are caught there.
+//
+// Example:
+//
+//	records, _ := bootloader.ReadJournal(f)
+//	prog := bootloader.New(device,
+//	    bootloader.WithJournalFile("update.journal"),
+//	    bootloader.WithRowFilter(bootloader.ResumeFilter(records)),
+//	)
+func ResumeFilter(records []JournalRecord) RowFilterFunc {
+	type rowKey struct {
+		arrayID  byte
+		rowNum   uint16
+		checksum byte
+	}
+	done := make(map[rowKey]bool)
+	for _, rec := range records {
+		switch {
+		case rec.Event == JournalRow && rec.Error == "":
+			done[rowKey{rec.ArrayID, rec.RowNum, rec.Checksum}] = true
+		case rec.Event == JournalEnd && rec.Error == "":
+			clear(done)
+		}
+	}
+
+	return func(row *cyacd.Row) bool {
+		return !done[rowKey{row.ArrayID, row.RowNum, row.Checksum}]
+	}
+}
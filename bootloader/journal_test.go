@@ -0,0 +1,144 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func journalFirmware() *cyacd.Firmware {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := uint16(0); i < 4; i++ {
+		data := []byte{byte(i), 0x02, 0x03, 0x04}
+		fw.Rows = append(fw.Rows, &cyacd.Row{
+			ArrayID:  0,
+			RowNum:   0x0010 + i,
+			Size:     4,
+			Data:     data,
+			Checksum: protocol.CalculateRowChecksum(data),
+		})
+	}
+	return fw
+}
+
+func TestJournalResume(t *testing.T) {
+	fw := journalFirmware()
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	path := filepath.Join(t.TempDir(), "update.journal")
+
+	// The third row fails permanently
+	device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultEOF,
+		Command: protocol.CmdProgramRow,
+		Skip:    2,
+	}))
+	prog := New(device, WithJournalFile(path), WithRetries(0))
+	if err := prog.Program(context.Background(), fw, key); err == nil {
+		t.Fatal("expected programming to fail")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadJournal(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("ReadJournal: %v", err)
+	}
+
+	var events []string
+	for _, rec := range records {
+		events = append(events, string(rec.Event))
+	}
+	if got, want := strings.Join(events, ","), "start,row,row,row,end"; got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+	if records[0].Rows != 4 || records[0].SiliconID != fw.SiliconID {
+		t.Errorf("start record = %+v", records[0])
+	}
+	if records[3].Error == "" || records[3].RowNum != 0x0012 {
+		t.Errorf("failed row record = %+v", records[3])
+	}
+	if records[4].Error == "" || records[4].Rows != 2 {
+		t.Errorf("end record = %+v", records[4])
+	}
+
+	// Resume: only the rows that were not programmed are sent
+	var programmed []uint16
+	prog = New(device,
+		WithJournalFile(path),
+		WithRowFilter(ResumeFilter(records)),
+		WithRowCallback(func(r RowResult) { programmed = append(programmed, r.RowNum) }),
+	)
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if len(programmed) != 2 || programmed[0] != 0x0012 || programmed[1] != 0x0013 {
+		t.Errorf("resumed rows = %v, want [18 19]", programmed)
+	}
+
+	// After a successful session nothing is skipped
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = ReadJournal(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadJournal: %v", err)
+	}
+	last := records[len(records)-1]
+	if last.Event != JournalEnd || last.Error != "" {
+		t.Errorf("last record = %+v, want successful end", last)
+	}
+	filter := ResumeFilter(records)
+	for _, row := range fw.Rows {
+		if !filter(row) {
+			t.Errorf("row %d skipped after a completed session", row.RowNum)
+		}
+	}
+}
+
+func TestJournalCrash(t *testing.T) {
+	fw := journalFirmware()
+	journal := strings.Join([]string{
+		`{"time":"2026-01-01T00:00:00Z","event":"start","rows":4}`,
+		`{"time":"2026-01-01T00:00:01Z","event":"row","row":16,"checksum":` + strconv.Itoa(int(fw.Rows[0].Checksum)) + `}`,
+		`{"time":"2026-01-01T00:00:02Z","event":"row","index":1,"row":17,"checksum":` + strconv.Itoa(int(fw.Rows[1].Checksum)) + `}`,
+		`{"time":"2026-01-01T00:00:03Z","ev`,
+	}, "\n")
+
+	records, err := ReadJournal(strings.NewReader(journal))
+	if err != nil {
+		t.Fatalf("ReadJournal: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	filter := ResumeFilter(records)
+	for i, row := range fw.Rows {
+		if want := i >= 2; filter(row) != want {
+			t.Errorf("row %d selected = %t, want %t", row.RowNum, filter(row), want)
+		}
+	}
+
+	// A row whose contents changed is programmed again
+	changed := *fw.Rows[0]
+	changed.Checksum++
+	if !filter(&changed) {
+		t.Error("row with a different checksum was skipped")
+	}
+
+	if _, err := ReadJournal(strings.NewReader("garbage\n" + journal)); err == nil {
+		t.Error("expected an error for a corrupt line before the end")
+	}
+}
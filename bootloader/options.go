@@ -1,6 +1,14 @@
 package bootloader
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/protocol"
+)
 
 // Default configuration values.
 const (
@@ -21,6 +29,9 @@ const (
 
 	// MaxChunkSize is the maximum allowed chunk size per packet
 	MaxChunkSize = 256
+
+	// MaxPipelineWindow is the maximum number of pipelined Send Data commands
+	MaxPipelineWindow = 16
 )
 
 // Config holds the programmer configuration.
@@ -28,9 +39,64 @@ type Config struct {
 	// ProgressCallback is called during programming to report progress (optional)
 	ProgressCallback ProgressCallback
 
+	// PhaseCallback is called once per phase transition (optional)
+	PhaseCallback PhaseCallback
+
+	// ProgressInterval is the minimum time between progress reports
+	// Default is 0 (every report is delivered)
+	ProgressInterval time.Duration
+
+	// MinProgressDelta is the minimum percentage increase between progress reports
+	// Default is 0 (every report is delivered)
+	MinProgressDelta float64
+
+	// RowCallback is called after each row is programmed (optional)
+	RowCallback RowCallback
+
+	// StateCallback is called on every session state change (optional)
+	StateCallback StateCallback
+
+	// StatsCallback is called with the session statistics when programming finishes (optional)
+	StatsCallback StatsCallback
+
 	// Logger is used for logging operations (optional)
 	Logger Logger
 
+	// LogLevel is the minimum severity of messages passed to Logger
+	// Default is LogDebug (all messages)
+	LogLevel LogLevel
+
+	// Clock is the source of time (optional)
+	// Default is nil (the system clock)
+	Clock Clock
+
+	// Confirm is asked before the first row is written (optional)
+	// See WithConfirm
+	Confirm ConfirmFunc
+
+	// DeviceID identifies the device in reports (optional)
+	// See WithDeviceID
+	DeviceID string
+
+	// Journal receives a JSON record per session and row result (optional)
+	// See WithJournal
+	Journal io.Writer
+
+	// JournalPath is the file the journal is appended to when Journal is nil (optional)
+	JournalPath string
+
+	// HostLog receives a log in the format of the Bootloader Host application (optional)
+	// See WithHostLog
+	HostLog io.Writer
+
+	// FrameLogging logs every frame sent and received at debug level
+	// Default is false
+	FrameLogging bool
+
+	// Capture records every frame sent and received in a pcapng capture (optional)
+	// See WithCapture
+	Capture *pcapng.Writer
+
 	// ReadTimeout is the timeout for read operations
 	ReadTimeout time.Duration
 
@@ -42,20 +108,219 @@ type Config struct {
 	ChunkSize int
 
 	// Retries is the number of retry attempts for failed commands
+	// Rows that fail with a retryable error (see IsRetryable) are
+	// resynchronized and reprogrammed up to this many times; rows that fail
+	// verification are also erased first
 	Retries int
 
 	// VerifyAfterProgram enables row verification after each program operation
 	VerifyAfterProgram bool
 
+	// VerifyEvery verifies only every Nth row when VerifyAfterProgram is enabled
+	// Default is 0 (every row)
+	VerifyEvery int
+
+	// PipelineWindow is the number of Send Data commands that may await a
+	// response at once (see WithPipelining)
+	// Default is 0 (each command waits for its response)
+	PipelineWindow int
+
+	// CoalesceMTU is the largest write used to send the frames of a row together
+	// (see WithCoalescedWrites)
+	// Default is 0 (one frame per write)
+	CoalesceMTU int
+
+	// AdaptiveVerify verifies rows that needed retries even when they would not be
+	// verified otherwise (VerifyAfterProgram disabled or skipped by VerifyEvery)
+	// Default is false
+	AdaptiveVerify bool
+
 	// CommandDelay is the delay between consecutive commands
 	// USB/HID typically use 1ms, Serial typically uses 25ms
 	// Default is 0 (no delay)
 	CommandDelay time.Duration
 
+	// ChecksumType is the packet checksum type used for frames outside Program
+	// (protocol.ChecksumBasicSum or protocol.ChecksumCRC16). Program always uses
+	// the checksum type recorded in the firmware file.
+	// Default is protocol.ChecksumBasicSum
+	ChecksumType byte
+
 	// LenientVerifyRow allows accepting 0-byte or 1-byte VerifyRow responses
 	// Default is false (strict: require exactly 1 byte per Infineon spec)
 	// Enable this for legacy or non-standard bootloader firmware that returns 0 bytes
 	LenientVerifyRow bool
+
+	// RowOrder decides the order in which rows are programmed (optional)
+	// Default is nil (rows are programmed in file order)
+	RowOrder RowOrderFunc
+
+	// RowFilter selects which firmware rows are programmed
+	// Default is nil (all rows are programmed)
+	RowFilter RowFilterFunc
+
+	// Rollback restores the previously active application if programming fails
+	// Only supported by multi-application (dual-image) bootloaders
+	// Default is false
+	Rollback bool
+
+	// ProtectedRows lists flash rows that must never be programmed or erased,
+	// such as the rows occupied by the bootloader itself
+	// Default is nil (no protected rows)
+	ProtectedRows []RowRange
+
+	// AllowProtectedRows overrides ProtectedRows and permits writes to them
+	// Default is false
+	AllowProtectedRows bool
+
+	// SkipBootloaderRows drops firmware rows below the first programmable row
+	// instead of failing (see WithSkipBootloaderRows)
+	// Default is false
+	SkipBootloaderRows bool
+
+	// ValidateApp reads back the application metadata and status before exiting
+	// and checks them against the programmed image (see WithAppValidation)
+	// Only supported by multi-application bootloaders
+	// Default is false
+	ValidateApp bool
+
+	// ValidateAppNum is the application number checked when ValidateApp is set
+	ValidateAppNum byte
+
+	// OwnsDevice transfers ownership of the device to the Programmer
+	// When true, Close also closes the device if it implements io.Closer
+	// Default is false (the caller owns and closes the device)
+	OwnsDevice bool
+
+	// UseReportID prepends ReportID to every outgoing frame
+	// Required by HID stacks that expect the report ID as the first byte of each write
+	// Default is false
+	UseReportID bool
+
+	// ReportID is the HID report ID prepended to outgoing frames when UseReportID is set
+	ReportID byte
+
+	// WritePacketSize pads every outgoing write with zeros to this size
+	// (including the report ID, if any), for HID stacks that require fixed-size output reports
+	// Default is 0 (no padding)
+	WritePacketSize int
+
+	// MaxBytesPerSecond limits the rate at which bytes are written to the device
+	// Useful for heavily loaded devices or slow (e.g. opto-isolated) links
+	// Default is 0 (no limit)
+	MaxBytesPerSecond int
+
+	// AllowSiliconIDMismatch programs devices whose silicon ID differs from the firmware
+	// A warning is logged instead of failing with DeviceMismatchError
+	// Default is false
+	AllowSiliconIDMismatch bool
+
+	// CheckSiliconRev validates the device silicon revision after entering the bootloader
+	// Default is false (only the silicon ID is validated)
+	CheckSiliconRev bool
+
+	// ExpectedSiliconRev is the revision checked when CheckSiliconRev is set
+	// Default is nil (the revision in the firmware header)
+	ExpectedSiliconRev *byte
+
+	// AutoChunkSize negotiates the largest Send Data chunk size the bootloader
+	// accepts before programming (see NegotiateChunkSize); ChunkSize is the fallback
+	// Default is false
+	AutoChunkSize bool
+
+	// VersionCompare decides whether UpdateIfNewer programs an image
+	// Default is nil (NewerAppVersion)
+	VersionCompare VersionCompare
+
+	// RowSize is the flash row size of the device in bytes; firmware rows of
+	// another size are rejected with GeometryError before programming
+	// Default is 0 (the row size of the device profile, if any)
+	RowSize int
+
+	// DeviceProfiles applies the registered profile of the entered device
+	// (see RegisterDeviceProfile) for settings not set explicitly
+	// Default is true
+	DeviceProfiles bool
+
+	// Resetter, if set, resets the target into its bootloader before Enter Bootloader
+	Resetter Resetter
+
+	// EntryWindow is how long Enter Bootloader is retried while the target
+	// resets or boots into its bootloader (see WithEntryWindow)
+	// Default is 0 (one attempt)
+	EntryWindow time.Duration
+
+	// EntryInterval is the pause between Enter Bootloader attempts
+	// Default is DefaultEntryInterval
+	EntryInterval time.Duration
+
+	// AppProbe, if set, makes Program wait for the application to start after
+	// exiting the bootloader (see WithWaitForApplication)
+	AppProbe ApplicationProbe
+
+	// AppStartTimeout bounds the wait for the application
+	// Default is DefaultAppStartTimeout
+	AppStartTimeout time.Duration
+
+	// SkipExit leaves the device in bootloader mode after programming
+	// Default is false (Exit Bootloader is sent)
+	SkipExit bool
+
+	// SkipAppVerify skips the final application checksum verification
+	// Default is false
+	SkipAppVerify bool
+
+	// ExitResponse selects whether a response to Exit Bootloader is awaited
+	// Default is ExitNoResponse
+	ExitResponse ExitResponse
+
+	// WriteSegmentSize splits each write into segments of at most this many bytes
+	// Default is 0 (frames are written whole)
+	WriteSegmentSize int
+
+	// WriteSegmentDelay is the pause between the segments of a write
+	// Default is 0
+	WriteSegmentDelay time.Duration
+
+	// chunkSizeSet and commandDelaySet record that ChunkSize and CommandDelay
+	// were set by an option, so a device profile does not override them
+	chunkSizeSet    bool
+	commandDelaySet bool
+
+	// optionErrs records option values that were rejected (see NewProgrammer)
+	optionErrs []error
+}
+
+// invalidOption records an option value that was rejected. New ignores the
+// value and keeps the previous setting; NewProgrammer reports the error.
+func (c *Config) invalidOption(format string, args ...interface{}) {
+	c.optionErrs = append(c.optionErrs, fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidOption}, args...)...))
+}
+
+// validate reports rejected option values and options that conflict.
+func (c *Config) validate() error {
+	errs := append([]error(nil), c.optionErrs...)
+
+	if c.Journal != nil && c.JournalPath != "" {
+		errs = append(errs, fmt.Errorf("%w: WithJournal and WithJournalFile are both set", ErrInvalidOption))
+	}
+	if c.SkipExit && c.AppProbe != nil {
+		errs = append(errs, fmt.Errorf("%w: WithWaitForApplication has no effect with WithSkipExit", ErrInvalidOption))
+	}
+	if c.WriteSegmentSize > 0 && c.WritePacketSize > 0 {
+		errs = append(errs, fmt.Errorf("%w: WithWriteSegments would split the packets of WithWritePacketSize", ErrInvalidOption))
+	}
+	if c.WritePacketSize > 0 && !c.AutoChunkSize {
+		size := c.ChunkSize + protocol.SendDataOverhead
+		if c.UseReportID {
+			size++
+		}
+		if size > c.WritePacketSize {
+			errs = append(errs, fmt.Errorf("%w: chunk size %d does not fit in %d-byte write packets", ErrInvalidOption, c.ChunkSize, c.WritePacketSize))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 // defaultConfig returns the default configuration.
@@ -66,6 +331,7 @@ func defaultConfig() Config {
 		ChunkSize:          DefaultChunkSize,
 		Retries:            DefaultRetries,
 		VerifyAfterProgram: true,
+		DeviceProfiles:     true,
 	}
 }
 
@@ -87,6 +353,75 @@ func WithProgressCallback(callback ProgressCallback) Option {
 	}
 }
 
+// WithPhaseCallback sets a callback fired exactly once per phase transition,
+// independently of the progress callback and its throttling (see PhaseCallback).
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithPhaseCallback(func(old, new bootloader.Phase) {
+//	        log.Printf("phase %s -> %s", old, new)
+//	    }),
+//	)
+func WithPhaseCallback(callback PhaseCallback) Option {
+	return func(c *Config) {
+		c.PhaseCallback = callback
+	}
+}
+
+// WithProgressInterval limits progress reports to at most one per interval, so
+// that a callback forwarding progress over RPC or redrawing a TUI is not invoked
+// for every row of a large image. Reports that start a new phase or step, reach
+// 100%, or go backwards (a new operation) are always delivered.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithProgressCallback(progressFunc),
+//	    bootloader.WithProgressInterval(100*time.Millisecond),
+//	)
+func WithProgressInterval(interval time.Duration) Option {
+	return func(c *Config) {
+		c.ProgressInterval = max(interval, 0)
+	}
+}
+
+// WithMinProgressDelta delivers a progress report only once the percentage has
+// advanced by at least delta points since the last delivered report. Like
+// WithProgressInterval (which it can be combined with, in which case both limits
+// apply), reports that start a new phase or step, reach 100%, or go backwards
+// are always delivered.
+//
+// Example:
+//
+//	// At most ~100 reports per operation
+//	prog := bootloader.New(device,
+//	    bootloader.WithProgressCallback(progressFunc),
+//	    bootloader.WithMinProgressDelta(1.0),
+//	)
+func WithMinProgressDelta(delta float64) Option {
+	return func(c *Config) {
+		c.MinProgressDelta = max(delta, 0)
+	}
+}
+
+// WithRowCallback sets a callback invoked after each row is programmed.
+// The callback receives the row identity, size, duration, verification outcome,
+// and retry count, including for the row that failed (with RowResult.Err set).
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithRowCallback(func(r bootloader.RowResult) {
+//	        log.Printf("row %d: %s (retries=%d)", r.RowNum, r.Duration, r.Retries)
+//	    }),
+//	)
+func WithRowCallback(callback RowCallback) Option {
+	return func(c *Config) {
+		c.RowCallback = callback
+	}
+}
+
 // WithLogger sets a logger for the programmer operations.
 //
 // Example:
@@ -98,6 +433,175 @@ func WithLogger(logger Logger) Option {
 	}
 }
 
+// WithLogLevel sets the minimum severity of the messages passed to the
+// Logger, including frames logged with WithFrameLogging (debug level).
+// Default is LogDebug (all messages).
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithLogger(logger),
+//	    bootloader.WithLogLevel(bootloader.LogInfo), // No per-row detail
+//	)
+func WithLogLevel(level LogLevel) Option {
+	return func(c *Config) {
+		if level < LogDebug || level > LogOff {
+			c.invalidOption("unknown log level %d", int(level))
+			return
+		}
+		c.LogLevel = level
+	}
+}
+
+// WithClock replaces the system clock used for elapsed times, command delays,
+// rate limiting, application polling, LineResetter delays, and plain read
+// timeouts (see Clock).
+//
+// Example:
+//
+//	clock := bootloadertest.NewClock(time.Now())
+//	prog := bootloader.New(device,
+//	    bootloader.WithClock(clock),
+//	    bootloader.WithCommandDelay(25*time.Millisecond),
+//	)
+func WithClock(clock Clock) Option {
+	return func(c *Config) {
+		c.Clock = clock
+	}
+}
+
+// WithConfirm sets a function asked before Program, UpdateIfNewer, and
+// ProgramV2 write the first row, after the device was identified and the
+// image checked against it (silicon ID and revision, flash range, protected
+// rows). Interactive tools can show what is about to happen and let the user
+// refuse: a non-nil error aborts the operation with an error wrapping
+// ErrNotConfirmed and the error returned, and the bootloader is exited so
+// that the untouched application starts again (unless a session was opened
+// with Connect). Default is nil (no confirmation).
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithConfirm(func(d bootloader.Description) error {
+//	        fmt.Printf("About to flash v%d to 0x%08X, %d rows. Continue? [y/N] ",
+//	            d.Metadata.AppVersion, d.DeviceInfo.SiliconID, d.Rows)
+//	        answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+//	        if strings.TrimSpace(answer) != "y" {
+//	            return errors.New("canceled by user")
+//	        }
+//	        return nil
+//	    }),
+//	)
+func WithConfirm(confirm ConfirmFunc) Option {
+	return func(c *Config) {
+		c.Confirm = confirm
+	}
+}
+
+// WithDeviceID labels the device, e.g. with its serial number or the transport
+// address it was opened at, so that ProgramReport.DeviceID and the exports of
+// ProgramReport.WriteJSON and WriteCSV can be matched to the unit on the line.
+//
+// Example:
+//
+//	prog := bootloader.New(port, bootloader.WithDeviceID("SN-0042 @ /dev/ttyUSB0"))
+func WithDeviceID(id string) Option {
+	return func(c *Config) {
+		c.DeviceID = id
+	}
+}
+
+// WithJournal appends a structured record to w at the start of every
+// programming session, after every row (including rows that failed), and when
+// the session ends. Records are JSON lines (see JournalRecord); ReadJournal
+// reads them back and ResumeFilter turns them into a row filter that resumes a
+// failed update. A journal write error is logged and stops journaling, but
+// does not fail programming.
+//
+// Example:
+//
+//	var journal bytes.Buffer
+//	prog := bootloader.New(device, bootloader.WithJournal(&journal))
+func WithJournal(w io.Writer) Option {
+	return func(c *Config) {
+		c.Journal = w
+	}
+}
+
+// WithJournalFile appends the journal described in WithJournal to the file at
+// path, creating it if needed. The file is opened for each programming session
+// and every record is synced to stable storage as it is written, so the journal
+// survives a crash of the host and can be used to diagnose and resume the update.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithJournalFile("/var/lib/updater/update.journal"))
+func WithJournalFile(path string) Option {
+	return func(c *Config) {
+		c.JournalPath = path
+	}
+}
+
+// WithHostLog writes a log of every programming session to w in the format
+// of Cypress's Bootloader Host application, so that QA tools that scrape its
+// logs keep working: timestamped lines such as
+//
+//	[2:15:07 PM] Programming Started (212 rows)
+//	[2:15:07 PM] Silicon ID: 0x1E9602AA, Silicon Rev: 0x00, Bootloader Version: 1.30.0
+//	[2:15:12 PM] Programming Finished Successfully (4.8 s)
+//
+// ending with "Programming Failed" and an "Error:" line when programming
+// fails. Lines end with CRLF, as Bootloader Host writes them. A write error is
+// logged and stops the log, but does not fail programming.
+//
+// Example:
+//
+//	f, _ := os.Create("bootload.log")
+//	prog := bootloader.New(device, bootloader.WithHostLog(f))
+func WithHostLog(w io.Writer) Option {
+	return func(c *Config) {
+		c.HostLog = w
+	}
+}
+
+// WithFrameLogging logs every frame sent to and received from the device with
+// the configured Logger at debug level, annotated with protocol.FormatFrame
+// (command name or status, data length, checksum validity) alongside the raw
+// bytes. The key of Enter Bootloader frames is redacted (see protocol.RedactFrame).
+// Has no effect without WithLogger.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithLogger(debugLogger),
+//	    bootloader.WithFrameLogging(),
+//	)
+func WithFrameLogging() Option {
+	return func(c *Config) {
+		c.FrameLogging = true
+	}
+}
+
+// WithCapture records every frame sent to and received from the device in a
+// pcapng capture, with its direction and a timestamp from the configured
+// Clock, for inspection in Wireshark next to USB or serial captures of the
+// same link. Frames are recorded on an interface named after the WithDeviceID
+// label ("bootloader" without one), so several Programmers can share one
+// capture. The key of Enter Bootloader frames is redacted (and the packet
+// checksum recomputed to match). A write error is
+// logged and stops the capture, but does not fail the operation.
+//
+// Example:
+//
+//	f, _ := os.Create("session.pcapng")
+//	capture, _ := pcapng.NewWriter(f, pcapng.LinkTypeUser0)
+//	prog := bootloader.New(device, bootloader.WithCapture(capture))
+func WithCapture(w *pcapng.Writer) Option {
+	return func(c *Config) {
+		c.Capture = w
+	}
+}
+
 // WithTimeout sets both read and write timeouts.
 //
 // Example:
@@ -134,7 +638,8 @@ func WithWriteTimeout(timeout time.Duration) Option {
 
 // WithChunkSize sets the maximum data size per Send Data command.
 // Default is DefaultChunkSize (64 bytes).
-// Maximum allowed is MaxChunkSize (256 bytes).
+// Maximum allowed is MaxChunkSize (256 bytes). Sizes outside 1-MaxChunkSize
+// are ignored by New and rejected by NewProgrammer.
 //
 // Example:
 //
@@ -143,6 +648,9 @@ func WithChunkSize(size int) Option {
 	return func(c *Config) {
 		if size > 0 && size <= MaxChunkSize {
 			c.ChunkSize = size
+			c.chunkSizeSet = true
+		} else {
+			c.invalidOption("chunk size %d outside 1-%d", size, MaxChunkSize)
 		}
 	}
 }
@@ -156,6 +664,8 @@ func WithRetries(retries int) Option {
 	return func(c *Config) {
 		if retries >= 0 {
 			c.Retries = retries
+		} else {
+			c.invalidOption("negative retries %d", retries)
 		}
 	}
 }
@@ -172,6 +682,100 @@ func WithVerifyAfterProgram(verify bool) Option {
 	}
 }
 
+// WithVerifyEvery verifies only every nth programmed row (the first row, then
+// every nth row after it) instead of every row, trading integrity granularity
+// for speed on very slow links. The application checksum is still verified at
+// the end. Values 0 and 1 verify every row; a negative value is an invalid
+// option. Has no effect when VerifyAfterProgram is disabled.
+//
+// ProgramReport.VerifyEvery and RowsVerified record the sampling applied, and
+// RowResult.Verified marks the sampled rows.
+//
+// Example:
+//
+//	// Verify rows 0, 4, 8, ...
+//	prog := bootloader.New(device, bootloader.WithVerifyEvery(4))
+func WithVerifyEvery(n int) Option {
+	return func(c *Config) {
+		if n < 0 {
+			c.invalidOption("negative verify interval %d", n)
+			return
+		}
+		c.VerifyEvery = n
+	}
+}
+
+// WithAdaptiveVerify verifies the rows that needed retries after a transport
+// error, even when per-row verification is disabled or WithVerifyEvery skips the
+// row. Rows that programmed cleanly are trusted, so on slow transports this gives
+// most of the safety of full verification at a fraction of the time. The
+// application checksum is still verified at the end.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithVerifyAfterProgram(false),
+//	    bootloader.WithAdaptiveVerify(),
+//	)
+func WithAdaptiveVerify() Option {
+	return func(c *Config) {
+		c.AdaptiveVerify = true
+	}
+}
+
+// WithPipelining lets up to window Send Data commands await a response at once:
+// the next chunk of a row is written while the response to the previous one is
+// still in flight, which closes most of the throughput gap on high-latency links
+// such as BLE or TCP bridges. Responses are still checked in order, and each
+// row ends with a strictly sequenced Program Row. Values 0 and 1 disable
+// pipelining; a negative window or one above MaxPipelineWindow is an invalid
+// option.
+//
+// Only use it with bootloaders that buffer incoming commands while they handle
+// the current one. If a pipelined row fails, the in-flight responses are
+// drained and the Programmer falls back to strict command sending for the rest
+// of its lifetime; the row is then retried as usual.
+//
+// Example:
+//
+//	prog := bootloader.New(bleDevice, bootloader.WithPipelining(4))
+func WithPipelining(window int) Option {
+	return func(c *Config) {
+		if window < 0 || window > MaxPipelineWindow {
+			c.invalidOption("pipeline window %d outside 0-%d", window, MaxPipelineWindow)
+			return
+		}
+		c.PipelineWindow = window
+	}
+}
+
+// WithCoalescedWrites writes the Send Data and Program Row frames of each row
+// together, as many as fit in mtu bytes per Write call, and then reads their
+// responses in order. This suits transports where the cost of a write dominates,
+// such as HID stacks with large output reports or TCP bridges. A frame larger
+// than mtu is written on its own. mtu includes the HID report ID, and is capped
+// at the write packet size when WithWritePacketSize is set; 0 and values too
+// small for two frames disable coalescing, and a negative mtu is an invalid
+// option.
+//
+// Like WithPipelining, which it takes precedence over for .cyacd rows, it needs
+// a bootloader that buffers incoming commands while it handles the current one.
+// The chunk size still sets the size of each Send Data frame; with the default
+// 57-byte chunks a 512-byte mtu carries a whole 256-byte row.
+//
+// Example:
+//
+//	prog := bootloader.New(tcpBridge, bootloader.WithCoalescedWrites(1024))
+func WithCoalescedWrites(mtu int) Option {
+	return func(c *Config) {
+		if mtu < 0 {
+			c.invalidOption("negative coalescing MTU %d", mtu)
+			return
+		}
+		c.CoalesceMTU = mtu
+	}
+}
+
 // WithCommandDelay sets the delay between consecutive commands.
 // This is useful for slower transports like Serial which may need 25ms delays,
 // while USB/HID typically work fine with 1ms or no delay.
@@ -187,6 +791,9 @@ func WithCommandDelay(delay time.Duration) Option {
 	return func(c *Config) {
 		if delay >= 0 {
 			c.CommandDelay = delay
+			c.commandDelaySet = true
+		} else {
+			c.invalidOption("negative command delay %s", delay)
 		}
 	}
 }
@@ -207,3 +814,521 @@ func WithLenientVerifyRow() Option {
 		c.LenientVerifyRow = true
 	}
 }
+
+// WithStateCallback sets a callback invoked on every session state change.
+// See State for the possible states.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithStateCallback(func(from, to bootloader.State) {
+//	        log.Printf("programmer: %s -> %s", from, to)
+//	    }),
+//	)
+func WithStateCallback(callback StateCallback) Option {
+	return func(c *Config) {
+		c.StateCallback = callback
+	}
+}
+
+// WithStatsCallback sets a callback invoked with the command timing and
+// throughput statistics when programming finishes. See Stats.
+func WithStatsCallback(callback StatsCallback) Option {
+	return func(c *Config) {
+		c.StatsCallback = callback
+	}
+}
+
+// WithRowOrder sets a function that decides the order in which rows are programmed.
+// By default rows are programmed in file order.
+//
+// Use MetadataRowLast to write the application metadata row last, so that a
+// partially programmed device falls back to the bootloader on the next reset.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithRowOrder(bootloader.MetadataRowLast))
+func WithRowOrder(order RowOrderFunc) Option {
+	return func(c *Config) {
+		c.RowOrder = order
+	}
+}
+
+// WithRowFilter programs only the firmware rows for which filter returns true.
+// Useful for partial or patch updates. Skipped rows are excluded from the
+// progress totals and counted in Progress.RowsSkipped and ProgramReport.RowsSkipped.
+//
+// The application checksum is still verified after programming, so the rows
+// that are skipped must already hold matching contents on the device.
+//
+// Example:
+//
+//	// Only program array 0
+//	prog := bootloader.New(device,
+//	    bootloader.WithRowFilter(func(row *cyacd.Row) bool {
+//	        return row.ArrayID == 0
+//	    }),
+//	)
+func WithRowFilter(filter RowFilterFunc) Option {
+	return func(c *Config) {
+		c.RowFilter = filter
+	}
+}
+
+// WithRollback enables automatic rollback for multi-application (dual-image) bootloaders.
+//
+// Before programming, the programmer records which application is active. If
+// programming the other slot fails, it marks the previous application active
+// again via Set Active Application, so a failed field update never leaves the
+// device without a bootable image. The outcome is reported in
+// ProgramReport.RollbackPerformed.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithRollback())
+//	report, err := prog.ProgramWithReport(ctx, fw, key)
+func WithRollback() Option {
+	return func(c *Config) {
+		c.Rollback = true
+	}
+}
+
+// WithChecksumType sets the packet checksum type for bootloaders built with CRC-16
+// packet checksums. Program follows the checksum type in the .cyacd header
+// automatically; this option covers Connect, Ping, and the other standalone
+// commands, which have no firmware file to take it from.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithChecksumType(protocol.ChecksumCRC16))
+func WithChecksumType(checksumType byte) Option {
+	return func(c *Config) {
+		if checksumType == protocol.ChecksumBasicSum || checksumType == protocol.ChecksumCRC16 {
+			c.ChecksumType = checksumType
+		} else {
+			c.invalidOption("unknown checksum type 0x%02X", checksumType)
+		}
+	}
+}
+
+// WithProtectedRows refuses to program or erase rows in the given ranges.
+//
+// The bootloader's own flash rows are normally outside the range reported by
+// Get Flash Size, but not every bootloader enforces this, and a mis-built
+// firmware file that overlaps the bootloader can brick the device. Listing the
+// bootloader region here makes Program fail with a *ProtectedRowError before
+// anything is written. Calling WithProtectedRows again adds more ranges.
+//
+// Example:
+//
+//	// Bootloader occupies rows 0-63 of array 0
+//	prog := bootloader.New(device,
+//	    bootloader.WithProtectedRows(bootloader.RowRange{ArrayID: 0, First: 0, Last: 63}),
+//	)
+func WithProtectedRows(ranges ...RowRange) Option {
+	return func(c *Config) {
+		c.ProtectedRows = append(c.ProtectedRows, ranges...)
+	}
+}
+
+// WithAllowProtectedRows disables the protected row guard configured with
+// WithProtectedRows. Intended for deliberate bootloader upgrades only.
+func WithAllowProtectedRows() Option {
+	return func(c *Config) {
+		c.AllowProtectedRows = true
+	}
+}
+
+// WithSkipBootloaderRows drops firmware rows that lie below the first
+// programmable row reported by Get Flash Size for their array, instead of
+// failing with a *RowOutOfRangeError, as Cypress's reference host does.
+// Images built for combined bootloader and application projects contain the
+// rows of the bootloader itself, which the bootloader cannot overwrite.
+//
+// The dropped rows are listed in ProgramReport.BootloaderRows and counted in
+// Progress.RowsSkipped and ProgramReport.RowsSkipped. Rows past the end of
+// the flash still fail.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithSkipBootloaderRows())
+//	report, err := prog.ProgramWithReport(ctx, combinedFW, key)
+//	if err == nil && len(report.BootloaderRows) > 0 {
+//	    log.Printf("skipped bootloader rows: %v", report.BootloaderRows)
+//	}
+func WithSkipBootloaderRows() Option {
+	return func(c *Config) {
+		c.SkipBootloaderRows = true
+	}
+}
+
+// WithAppValidation checks the programmed application before leaving the bootloader.
+//
+// After the application checksum is verified, the programmer reads Get Application
+// Status and Get Metadata for appNum and confirms the application is marked valid
+// and that its application ID and version match the metadata embedded in the
+// firmware image. A mismatch is returned as a *VerificationError and the device
+// stays in the bootloader. The metadata read back is reported in
+// ProgramReport.AppMetadata.
+//
+// Get Metadata and Get Application Status are only implemented by
+// multi-application bootloaders.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithAppValidation(1))
+func WithAppValidation(appNum byte) Option {
+	return func(c *Config) {
+		c.ValidateApp = true
+		c.ValidateAppNum = appNum
+	}
+}
+
+// WithDeviceOwnership transfers ownership of the device to the Programmer.
+// When enabled, Close also closes the device if it implements io.Closer.
+// By default the caller owns the device and is responsible for closing it.
+//
+// Example:
+//
+//	port, _ := serial.Open("/dev/ttyUSB0", mode)
+//	prog := bootloader.New(port, bootloader.WithDeviceOwnership())
+//	defer prog.Close(ctx) // exits the bootloader and closes the port
+func WithDeviceOwnership() Option {
+	return func(c *Config) {
+		c.OwnsDevice = true
+	}
+}
+
+// WithWriteSegments splits every frame written to the device into segments of
+// at most size bytes, one Write call each, with delay between them, for
+// transports that cannot accept a whole frame in one write, such as I2C
+// bridges and some BLE stacks with a small MTU. Frames (or coalesced groups of
+// frames, see WithCoalescedWrites) of at most size bytes are written whole.
+// A size of 0 disables splitting. It cannot be combined with
+// WithWritePacketSize, whose packets must stay whole.
+//
+// Example:
+//
+//	// BLE link with a 20-byte ATT payload
+//	prog := bootloader.New(bleDevice, bootloader.WithWriteSegments(20, 5*time.Millisecond))
+func WithWriteSegments(size int, delay time.Duration) Option {
+	return func(c *Config) {
+		if size < 0 || delay < 0 {
+			c.invalidOption("write segments of %d bytes with delay %s", size, delay)
+			return
+		}
+		c.WriteSegmentSize = size
+		c.WriteSegmentDelay = delay
+	}
+}
+
+// WithHIDReportID prepends the given HID report ID to every outgoing frame.
+// Many HID stacks (hidapi, Windows HID) require the report ID as the first byte
+// of each write, even when the device uses a single unnumbered report (ID 0).
+//
+// The read path already detects and strips report IDs from responses.
+//
+// Example:
+//
+//	prog := bootloader.New(hidDevice,
+//	    bootloader.WithHIDReportID(0x00),
+//	    bootloader.WithWritePacketSize(65),
+//	)
+func WithHIDReportID(id byte) Option {
+	return func(c *Config) {
+		c.UseReportID = true
+		c.ReportID = id
+	}
+}
+
+// WithWritePacketSize pads every outgoing write with zeros to a fixed size.
+// The size includes the report ID set with WithHIDReportID, so a device with
+// 64-byte output reports and a report ID typically needs 65.
+// Frames larger than the packet size are rejected.
+//
+// Example:
+//
+//	prog := bootloader.New(hidDevice, bootloader.WithWritePacketSize(64))
+func WithWritePacketSize(size int) Option {
+	return func(c *Config) {
+		if size >= 0 {
+			c.WritePacketSize = size
+		} else {
+			c.invalidOption("negative write packet size %d", size)
+		}
+	}
+}
+
+// WithMaxBytesPerSecond limits the rate at which bytes are written to the device.
+// Unlike WithCommandDelay, the pacing accounts for the size of each write, so
+// large Send Data chunks and small commands are both kept under the limit.
+//
+// Example:
+//
+//	// Slow opto-isolated UART link
+//	prog := bootloader.New(device, bootloader.WithMaxBytesPerSecond(2000))
+func WithMaxBytesPerSecond(rate int) Option {
+	return func(c *Config) {
+		if rate >= 0 {
+			c.MaxBytesPerSecond = rate
+		} else {
+			c.invalidOption("negative rate %d bytes per second", rate)
+		}
+	}
+}
+
+// WithAllowSiliconIDMismatch programs the device even if its silicon ID does not
+// match the firmware header, logging a warning instead of failing with
+// *DeviceMismatchError. It is intended for engineering scenarios where an image
+// intentionally targets a sibling part; programming an image built for an
+// incompatible device can leave it unbootable.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithLogger(logger),
+//	    bootloader.WithAllowSiliconIDMismatch(),
+//	)
+func WithAllowSiliconIDMismatch() Option {
+	return func(c *Config) {
+		c.AllowSiliconIDMismatch = true
+	}
+}
+
+// WithSiliconRevCheck validates the silicon revision reported by the device
+// against the revision in the firmware header, in addition to the silicon ID.
+// Some die revisions are incompatible with builds for another revision.
+// A mismatch fails with *SiliconRevMismatchError before any row is written.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithSiliconRevCheck())
+func WithSiliconRevCheck() Option {
+	return func(c *Config) {
+		c.CheckSiliconRev = true
+	}
+}
+
+// WithExpectedSiliconRev validates the silicon revision reported by the device
+// against rev instead of the firmware header, for images whose header does not
+// record the revision they were built for.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithExpectedSiliconRev(0x11))
+func WithExpectedSiliconRev(rev byte) Option {
+	return func(c *Config) {
+		c.CheckSiliconRev = true
+		c.ExpectedSiliconRev = &rev
+	}
+}
+
+// WithAutoChunkSize makes Program and ProgramV2 negotiate the largest Send Data
+// chunk size the bootloader accepts after entering it, instead of requiring the
+// right size to be configured with WithChunkSize. Negotiation runs once per
+// Programmer; if it fails, the configured chunk size is used.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithAutoChunkSize())
+func WithAutoChunkSize() Option {
+	return func(c *Config) {
+		c.AutoChunkSize = true
+	}
+}
+
+// WithVersionCompare sets the comparison UpdateIfNewer uses to decide whether
+// an image replaces the installed application. Default is NewerAppVersion.
+//
+// Example:
+//
+//	// Also reinstall when the custom ID (e.g. a build number) differs
+//	prog := bootloader.New(device, bootloader.WithVersionCompare(
+//	    func(installed, image *protocol.Metadata) bool {
+//	        return bootloader.NewerAppVersion(installed, image) || image.CustomID != installed.CustomID
+//	    },
+//	))
+func WithVersionCompare(compare VersionCompare) Option {
+	return func(c *Config) {
+		c.VersionCompare = compare
+	}
+}
+
+// WithResetter sets a Resetter that the Programmer calls before every Enter
+// Bootloader, e.g. LineResetter for boards that wire reset and boot pins to the
+// serial DTR and RTS lines. Input received while the target restarts is
+// discarded when the device implements InputFlusher.
+//
+// Example:
+//
+//	prog := bootloader.New(port, bootloader.WithResetter(
+//	    bootloader.LineResetter(port, bootloader.LineReset{Reset: bootloader.LineDTR}),
+//	))
+func WithResetter(resetter Resetter) Option {
+	return func(c *Config) {
+		c.Resetter = resetter
+	}
+}
+
+// WithRowSize sets the flash row size of the device (e.g. 128 bytes for most
+// PSoC 4 devices, 256 for PSoC 5LP, 512 for PSoC 6), so that an image built
+// for another device fails with a GeometryError before anything is written,
+// instead of with a length status from the bootloader in the middle of the
+// update. Rows of .cyacd images must hold exactly size bytes; rows of .cyacd2
+// images must also start on a size-byte boundary. Default is 0: the row size
+// of the device profile (see WithDeviceProfiles), or no check without one.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithRowSize(128))
+//	err := prog.Program(ctx, fw, key)
+//	if errors.Is(err, bootloader.ErrGeometry) {
+//	    log.Print("the image was built for a different device")
+//	}
+func WithRowSize(size int) Option {
+	return func(c *Config) {
+		if size < 0 {
+			c.invalidOption("negative row size %d", size)
+			return
+		}
+		c.RowSize = size
+	}
+}
+
+// WithDeviceProfiles sets whether the profile registered for the device's
+// silicon ID (see RegisterDeviceProfile) is applied after Enter Bootloader.
+// A profile sets the row size, chunk size, and command delay, except those
+// set explicitly with WithRowSize, WithChunkSize, WithCommandDelay, or
+// WithTransportProfile, and except a chunk size found by NegotiateChunkSize.
+// Default is true.
+//
+// Example:
+//
+//	// Use exactly the configured settings
+//	prog := bootloader.New(device, bootloader.WithDeviceProfiles(false))
+func WithDeviceProfiles(enabled bool) Option {
+	return func(c *Config) {
+		c.DeviceProfiles = enabled
+	}
+}
+
+// WithEntryWindow keeps retrying Enter Bootloader for up to window while the
+// operator resets the target or the device finishes booting into its
+// bootloader, like the "waiting for bootloader" prompt of the Cypress host
+// tools. Between attempts the bootloader is sent Sync Bootloader and the
+// Programmer pauses for interval (0 means DefaultEntryInterval). Only
+// transport errors and timeouts are retried; a rejected key fails at once.
+// Each attempt waits up to the read timeout for a response, so lower it with
+// WithReadTimeout to poll more often. Default is a single attempt.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithEntryWindow(30*time.Second, 0),
+//	    bootloader.WithReadTimeout(250*time.Millisecond),
+//	)
+//	fmt.Println("Reset the target now...")
+//	err := prog.Program(ctx, fw, key)
+func WithEntryWindow(window, interval time.Duration) Option {
+	return func(c *Config) {
+		if window < 0 || interval < 0 {
+			c.invalidOption("entry window %s with interval %s", window, interval)
+			return
+		}
+		c.EntryWindow = window
+		c.EntryInterval = interval
+	}
+}
+
+// WithWaitForApplication makes Program and ProgramV2 wait, after exiting the
+// bootloader, until probe reports that the new application is running, as
+// WaitForApplication does. Programming then only succeeds once the application
+// has started; a timeout (0 means DefaultAppStartTimeout) fails the operation.
+// The wait is skipped when the bootloader is not exited (WithSkipExit or Connect).
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithWaitForApplication(probe, 15*time.Second),
+//	)
+func WithWaitForApplication(probe ApplicationProbe, timeout time.Duration) Option {
+	return func(c *Config) {
+		c.AppProbe = probe
+		if timeout > 0 {
+			c.AppStartTimeout = timeout
+		} else {
+			c.AppStartTimeout = DefaultAppStartTimeout
+		}
+	}
+}
+
+// ExitResponse selects how the response to Exit Bootloader is handled (see
+// WithExitResponseExpected).
+type ExitResponse int
+
+const (
+	// ExitNoResponse sends Exit Bootloader without waiting for a response, for
+	// bootloaders that reset immediately. Write errors, e.g. from a USB device
+	// that disconnects as it resets, are logged at debug level and ignored.
+	ExitNoResponse ExitResponse = iota
+
+	// ExitResponseOptional waits up to the read timeout for a response; a
+	// missing response is not an error, but an error status is
+	ExitResponseOptional
+
+	// ExitResponseRequired requires the bootloader to acknowledge Exit
+	// Bootloader before it resets; write errors, a missing response, and an
+	// error status fail the operation
+	ExitResponseRequired
+)
+
+// WithExitResponseExpected sets how the response to Exit Bootloader is
+// handled. Some bootloaders acknowledge Exit Bootloader before resetting,
+// others reset at once. ProgramReport.ExitAcknowledged records whether the
+// bootloader acknowledged it. Default is ExitNoResponse.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithExitResponseExpected(bootloader.ExitResponseRequired))
+func WithExitResponseExpected(mode ExitResponse) Option {
+	return func(c *Config) {
+		if mode < ExitNoResponse || mode > ExitResponseRequired {
+			c.invalidOption("unknown exit response mode %d", mode)
+			return
+		}
+		c.ExitResponse = mode
+	}
+}
+
+// WithSkipExit leaves the device in bootloader mode after programming instead of
+// sending Exit Bootloader, so that further images can be programmed before the
+// device is released, e.g. in manufacturing flows. The bootloader accepts Enter
+// Bootloader again on the next Program call; release the device with Close or
+// a final Program without this option.
+//
+// Example:
+//
+//	prog := bootloader.New(device, bootloader.WithSkipExit())
+//	_ = prog.Program(ctx, stackFW, key) // device stays in bootloader
+func WithSkipExit() Option {
+	return func(c *Config) {
+		c.SkipExit = true
+	}
+}
+
+// WithSkipAppVerify skips the final Verify Checksum of the application. Use it
+// when the application checksum only becomes valid once all images of a
+// multi-image flow are programmed; rows are still verified individually when
+// VerifyAfterProgram is enabled.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithSkipExit(),
+//	    bootloader.WithSkipAppVerify(),
+//	)
+func WithSkipAppVerify() Option {
+	return func(c *Config) {
+		c.SkipAppVerify = true
+	}
+}
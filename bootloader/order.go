@@ -0,0 +1,102 @@
+package bootloader
+
+import (
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// RowOrderFunc decides the order in which firmware rows are programmed.
+// It receives a copy of the firmware rows in file order and returns them in the
+// desired programming order. The returned slice must contain the same rows,
+// each exactly once.
+type RowOrderFunc func(rows []*cyacd.Row) []*cyacd.Row
+
+// RowFilterFunc selects which firmware rows are programmed.
+// It returns true for rows that should be programmed.
+type RowFilterFunc func(row *cyacd.Row) bool
+
+// MetadataRowLast is a RowOrderFunc that programs the bootloadable metadata row last.
+//
+// The application metadata lives in the last flash row of the image (the highest
+// row number in the highest array). The bootloader only launches an application
+// whose metadata marks it valid, so writing that row last makes a partially
+// programmed device fail safe into the bootloader instead of jumping into an
+// incomplete application.
+//
+// All other rows keep their file order.
+func MetadataRowLast(rows []*cyacd.Row) []*cyacd.Row {
+	if len(rows) < 2 {
+		return rows
+	}
+
+	last := metadataRowIndex(rows)
+	ordered := make([]*cyacd.Row, 0, len(rows))
+	ordered = append(ordered, rows[:last]...)
+	ordered = append(ordered, rows[last+1:]...)
+	ordered = append(ordered, rows[last])
+
+	return ordered
+}
+
+// metadataRowIndex returns the index of the row holding the application metadata:
+// the highest row number in the highest array. rows must not be empty.
+func metadataRowIndex(rows []*cyacd.Row) int {
+	last := 0
+	for i, row := range rows {
+		if row.ArrayID > rows[last].ArrayID ||
+			(row.ArrayID == rows[last].ArrayID && row.RowNum > rows[last].RowNum) {
+			last = i
+		}
+	}
+	return last
+}
+
+// orderRows returns the firmware rows in programming order.
+// Rows are returned in file order unless a RowOrder function is configured.
+func (p *Programmer) orderRows(rows []*cyacd.Row) ([]*cyacd.Row, error) {
+	if p.config.RowOrder == nil {
+		return rows, nil
+	}
+
+	// Hand the ordering function a copy so it cannot reorder the caller's firmware
+	ordered := p.config.RowOrder(append([]*cyacd.Row(nil), rows...))
+	if len(ordered) != len(rows) {
+		return nil, fmt.Errorf("row order function returned %d rows, expected %d", len(ordered), len(rows))
+	}
+
+	// Each row must come back exactly once, so no row is skipped or written twice
+	pending := make(map[*cyacd.Row]int, len(rows))
+	for _, row := range rows {
+		pending[row]++
+	}
+	for i, row := range ordered {
+		if row == nil {
+			return nil, fmt.Errorf("row order function returned a nil row at index %d", i)
+		}
+		if pending[row] == 0 {
+			return nil, fmt.Errorf("row order function returned row %d (array %d) at index %d, which is repeated or not in the firmware",
+				row.RowNum, row.ArrayID, i)
+		}
+		pending[row]--
+	}
+
+	return ordered, nil
+}
+
+// filterRows returns the firmware rows selected by the RowFilter.
+// All rows are returned unless a RowFilter is configured.
+func (p *Programmer) filterRows(rows []*cyacd.Row) []*cyacd.Row {
+	if p.config.RowFilter == nil {
+		return rows
+	}
+
+	selected := make([]*cyacd.Row, 0, len(rows))
+	for _, row := range rows {
+		if p.config.RowFilter(row) {
+			selected = append(selected, row)
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,181 @@
+package bootloader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestMetadataRowLast(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []*cyacd.Row
+		want []uint16
+	}{
+		{
+			name: "empty",
+			rows: nil,
+			want: nil,
+		},
+		{
+			name: "metadata row already last",
+			rows: []*cyacd.Row{{RowNum: 1}, {RowNum: 2}, {RowNum: 3}},
+			want: []uint16{1, 2, 3},
+		},
+		{
+			name: "metadata row in the middle",
+			rows: []*cyacd.Row{{RowNum: 1}, {RowNum: 0x1FF}, {RowNum: 3}},
+			want: []uint16{1, 3, 0x1FF},
+		},
+		{
+			name: "highest array wins",
+			rows: []*cyacd.Row{{ArrayID: 1, RowNum: 0}, {ArrayID: 0, RowNum: 0x1FF}},
+			want: []uint16{0x1FF, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MetadataRowLast(tt.rows)
+			if len(got) != len(tt.want) {
+				t.Fatalf("len = %d, want %d", len(got), len(tt.want))
+			}
+			for i, row := range got {
+				if row.RowNum != tt.want[i] {
+					t.Errorf("row[%d] = %d, want %d", i, row.RowNum, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProgramWithRowOrder(t *testing.T) {
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x01FF, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+			{ArrayID: 0x00, RowNum: 0x0010, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+
+	t.Run("metadata row last", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+
+		prog := New(device, WithVerifyAfterProgram(false), WithRowOrder(MetadataRowLast))
+		if err := prog.Program(context.Background(), firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Frames: enter(13) + flash size(8) + program row(14) + program row(14) + ...
+		written := device.writeBuf.Bytes()
+		first := written[21:35]
+		second := written[35:49]
+		if first[1] != protocol.CmdProgramRow || second[1] != protocol.CmdProgramRow {
+			t.Fatalf("unexpected command sequence: % 02X", written)
+		}
+		if first[5] != 0x10 || second[5] != 0xFF || second[6] != 0x01 {
+			t.Errorf("rows programmed in wrong order: first=% 02X second=% 02X", first, second)
+		}
+
+		if firmware.Rows[0].RowNum != 0x01FF {
+			t.Error("row order function modified the caller's firmware")
+		}
+	})
+
+	t.Run("invalid order function", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+
+		prog := New(device, WithRowOrder(func(rows []*cyacd.Row) []*cyacd.Row {
+			return rows[:1]
+		}))
+		if err := prog.Program(context.Background(), firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestProgramWithRowFilter(t *testing.T) {
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0010, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+			{ArrayID: 0x00, RowNum: 0x0011, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+			{ArrayID: 0x00, RowNum: 0x0012, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+	device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+
+	var last Progress
+	prog := New(device,
+		WithVerifyAfterProgram(false),
+		WithRowFilter(func(row *cyacd.Row) bool { return row.RowNum == 0x0011 }),
+		WithProgressCallback(func(p Progress) { last = p }),
+	)
+	report, err := prog.ProgramWithReport(context.Background(), firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.RowsProgrammed != 1 || report.RowsSkipped != 2 {
+		t.Errorf("RowsProgrammed = %d, RowsSkipped = %d, want 1 and 2", report.RowsProgrammed, report.RowsSkipped)
+	}
+	if last.TotalRows != 1 || last.RowsSkipped != 2 || last.TotalBytes != 4 {
+		t.Errorf("final progress TotalRows = %d, RowsSkipped = %d, TotalBytes = %d, want 1, 2, 4",
+			last.TotalRows, last.RowsSkipped, last.TotalBytes)
+	}
+
+	// Frames: enter(13) + flash size(8) + program row(14)
+	row := device.writeBuf.Bytes()[21:35]
+	if row[1] != protocol.CmdProgramRow || row[5] != 0x11 {
+		t.Errorf("programmed row = % 02X, want row 0x11", row)
+	}
+}
+
+func TestOrderRowsPermutation(t *testing.T) {
+	rows := []*cyacd.Row{
+		{ArrayID: 0x00, RowNum: 0x0010, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		{ArrayID: 0x00, RowNum: 0x0011, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		{ArrayID: 0x00, RowNum: 0x0012, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+	}
+	// A row equal to rows[2] is still not one of the firmware rows
+	foreign := &cyacd.Row{ArrayID: 0x00, RowNum: 0x0012, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}}
+
+	tests := []struct {
+		name    string
+		order   RowOrderFunc
+		wantErr bool
+	}{
+		{"reversed", func(r []*cyacd.Row) []*cyacd.Row { return []*cyacd.Row{r[2], r[1], r[0]} }, false},
+		{"nil row", func(r []*cyacd.Row) []*cyacd.Row { return []*cyacd.Row{r[0], nil, r[2]} }, true},
+		{"duplicate row", func(r []*cyacd.Row) []*cyacd.Row { return []*cyacd.Row{r[0], r[0], r[2]} }, true},
+		{"foreign row", func(r []*cyacd.Row) []*cyacd.Row { return []*cyacd.Row{r[0], r[1], foreign} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := New(NewMockDevice(), WithRowOrder(tt.order))
+			ordered, err := prog.orderRows(rows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("orderRows() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (ordered[0] != rows[2] || ordered[2] != rows[0]) {
+				t.Error("orderRows() did not return the rows in the order given")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// pipelineWindow returns the number of Send Data commands that may await a
+// response at once: 1 (strict sending) unless WithPipelining is set and no
+// pipelined row has failed.
+func (p *Programmer) pipelineWindow() int {
+	if p.config.PipelineWindow < 2 || p.pipelineFailed {
+		return 1
+	}
+	return p.config.PipelineWindow
+}
+
+// sendDataPipelined sends data with Send Data commands of at most the chunk
+// size, writing the next chunk while up to window-1 earlier ones await their
+// responses. Responses are read and checked in order.
+//
+// If a chunk fails, the responses still in flight are drained so that they are
+// not mistaken for responses to later commands, and pipelining is disabled for
+// the rest of the Programmer's lifetime.
+func (p *Programmer) sendDataPipelined(ctx context.Context, data []byte, window, chunks int, onChunk func(chunk, chunks int)) error {
+	// Write start times of the commands in flight, oldest first
+	var starts [MaxPipelineWindow]time.Time
+	var sizes [MaxPipelineWindow]int
+	inFlight := 0
+
+	p.pipelined = true
+	defer func() {
+		p.pipelined = false
+		p.rxPending = p.rxPending[:0]
+	}()
+
+	offset, chunk := 0, 0
+	for offset < len(data) || inFlight > 0 {
+		// Fill the window
+		for offset < len(data) && inFlight < window {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("canceled: %w", err)
+			}
+
+			n := min(p.chunkSize, len(data)-offset)
+			cmd, err := protocol.AppendSendDataCmd(p.txBuf[:0], data[offset:offset+n])
+			if err != nil {
+				return err
+			}
+			p.txBuf = cmd
+
+			starts[inFlight] = p.clock.Now()
+			sizes[inFlight] = len(cmd)
+			if _, err := p.write(ctx, cmd); err != nil {
+				p.stats.record(protocol.CmdSendData, len(cmd), p.clock.Since(starts[inFlight]), 0, err)
+				return p.pipelineFailure(ctx, inFlight, fmt.Errorf("send data chunk: write command: %w", err))
+			}
+			inFlight++
+			offset += n
+
+			if err := p.clock.Sleep(ctx, p.commandDelay); err != nil {
+				return err
+			}
+		}
+
+		// Collect the oldest response
+		response, err := p.readFrame(ctx)
+		p.stats.record(protocol.CmdSendData, sizes[0], p.clock.Since(starts[0]), len(response), err)
+		inFlight--
+		copy(starts[:], starts[1:inFlight+1])
+		copy(sizes[:], sizes[1:inFlight+1])
+		if err == nil {
+			err = p.checkSendDataResponse(response)
+		}
+		if err != nil {
+			return p.pipelineFailure(ctx, inFlight, fmt.Errorf("send data chunk: %w", err))
+		}
+
+		chunk++
+		if onChunk != nil {
+			onChunk(chunk, chunks)
+		}
+	}
+
+	return nil
+}
+
+// pipelineFailure drains the inFlight responses still expected after a
+// pipelined chunk failed with err, disables pipelining, and returns err.
+func (p *Programmer) pipelineFailure(ctx context.Context, inFlight int, err error) error {
+	if ctx.Err() != nil {
+		// Canceled: the caller resynchronizes the bootloader
+		return err
+	}
+
+	// Stop at the first read error: a response that never arrives would only
+	// time out again for every remaining chunk
+	for ; inFlight > 0; inFlight-- {
+		if _, readErr := p.readFrame(ctx); readErr != nil {
+			break
+		}
+	}
+
+	p.pipelineFailed = true
+	p.logWarn("pipelined send failed, falling back to strict command sending", "error", err)
+
+	return err
+}
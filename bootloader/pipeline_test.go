@@ -0,0 +1,136 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// pipelineDevice records how many Send Data commands were awaiting a response at once.
+// With stream set, a read returns every queued response at once, like a UART
+// or TCP transport that received several responses before the host read them.
+type pipelineDevice struct {
+	device      *bootloadertest.Device
+	stream      bool
+	outstanding int
+	maxInFlight int
+}
+
+func (d *pipelineDevice) Write(p []byte) (int, error) {
+	if len(p) > 1 && p[1] == protocol.CmdSendData {
+		d.outstanding++
+		d.maxInFlight = max(d.maxInFlight, d.outstanding)
+	} else {
+		d.outstanding = 0
+	}
+	return d.device.Write(p)
+}
+
+func (d *pipelineDevice) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		read, err := d.device.Read(p[n:])
+		n += read
+		if read > 0 && d.outstanding > 0 {
+			d.outstanding--
+		}
+		if err != nil || !d.stream {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// pipelineFirmware returns an image whose rows each need several Send Data chunks.
+func pipelineFirmware() *cyacd.Firmware {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 3; i++ {
+		data := bytes.Repeat([]byte{byte(i + 1)}, 256)
+		fw.Rows = append(fw.Rows, &cyacd.Row{
+			ArrayID: 0, RowNum: uint16(0x0010 + i), Size: 256, Data: data, Checksum: protocol.CalculateRowChecksum(data),
+		})
+	}
+	return fw
+}
+
+func TestProgramPipelining(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name   string
+		window int
+		stream bool
+		want   int
+	}{
+		{"strict", 0, false, 1},
+		{"window 3", 3, false, 3},
+		{"window 3 on a stream", 3, true, 3},
+		{"window larger than the row", 8, true, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := pipelineFirmware()
+			device := &pipelineDevice{device: bootloadertest.NewDevice(), stream: tt.stream}
+
+			if err := New(device, WithPipelining(tt.window)).Program(context.Background(), fw, key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if device.maxInFlight != tt.want {
+				t.Errorf("%d commands in flight, want %d", device.maxInFlight, tt.want)
+			}
+			for _, row := range fw.Rows {
+				if got, _ := device.device.Row(row.ArrayID, row.RowNum); !bytes.Equal(got, row.Data) {
+					t.Errorf("row 0x%04X = %x, want %x", row.RowNum, got, row.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestProgramPipeliningFallback(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	fw := pipelineFirmware()
+
+	// The response to the second Send Data of the first row is corrupted
+	device := &pipelineDevice{device: bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultCorruptChecksum,
+		Command: protocol.CmdSendData,
+		Skip:    1,
+	}))}
+	logger := &warnLogger{}
+
+	var retries int
+	prog := New(device,
+		WithPipelining(4),
+		WithLogger(logger),
+		WithRowCallback(func(r RowResult) { retries += r.Retries }),
+	)
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if retries != 1 {
+		t.Errorf("%d retries, want 1", retries)
+	}
+	if !prog.pipelineFailed {
+		t.Error("pipelining still enabled after a failure")
+	}
+	if len(logger.warnMsgs) != 1 {
+		t.Errorf("warnings = %v, want one fallback warning", logger.warnMsgs)
+	}
+	for _, row := range fw.Rows {
+		if got, _ := device.device.Row(row.ArrayID, row.RowNum); !bytes.Equal(got, row.Data) {
+			t.Errorf("row 0x%04X = %x, want %x", row.RowNum, got, row.Data)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Plan is an ordered list of operations executed by RunPlan in a single
+// bootloader session, e.g. wipe a region, program a stack and an application
+// image, mark the application active, and verify.
+//
+// Plan methods return the plan so that steps can be chained:
+//
+//	plan := bootloader.NewPlan().
+//	    EraseRange(bootloader.RowRange{ArrayID: 0, First: 0x0100, Last: 0x01FF}).
+//	    Program(stackFW).
+//	    Program(appFW).
+//	    SetActiveApp(1).
+//	    Verify()
+type Plan struct {
+	steps []planStep
+}
+
+// planStep is a single plan operation. weight is its share of the combined progress.
+type planStep struct {
+	name   string
+	weight int
+	run    func(ctx context.Context, p *Programmer, result *StepResult) error
+}
+
+// NewPlan creates an empty plan.
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// Len returns the number of steps in the plan.
+func (pl *Plan) Len() int {
+	return len(pl.steps)
+}
+
+// EraseRange adds a step that erases every row of r.
+func (pl *Plan) EraseRange(r RowRange) *Plan {
+	pl.steps = append(pl.steps, planStep{
+		name:   fmt.Sprintf("erase %s", r),
+		weight: int(r.Last) - int(r.First) + 1,
+		run: func(ctx context.Context, p *Programmer, result *StepResult) error {
+			total := int(r.Last) - int(r.First) + 1
+			for i := 0; i < total; i++ {
+				if err := ctx.Err(); err != nil {
+					return fmt.Errorf("canceled: %w", err)
+				}
+
+				rowNum := r.First + uint16(i)
+				if err := p.eraseRow(ctx, r.ArrayID, rowNum); err != nil {
+					return fmt.Errorf("erase row %d (array %d): %w", rowNum, r.ArrayID, err)
+				}
+
+				p.reportProgress(Progress{
+					Phase:      PhaseErasing,
+					CurrentRow: i + 1,
+					TotalRows:  total,
+					Percentage: float64(i+1) / float64(total) * 100,
+				})
+			}
+			return nil
+		},
+	})
+	return pl
+}
+
+// Program adds a step that programs fw, as Program does. The row filter, row
+// order, protected rows, and validation options of the Programmer apply.
+func (pl *Plan) Program(fw *cyacd.Firmware) *Plan {
+	pl.steps = append(pl.steps, planStep{
+		name:   fmt.Sprintf("program %d rows", len(fw.Rows)),
+		weight: len(fw.Rows),
+		run: func(ctx context.Context, p *Programmer, result *StepResult) error {
+			result.Program = &ProgramReport{TotalRows: len(fw.Rows)}
+			start := p.clock.Now()
+			err := p.program(ctx, fw, nil, start, result.Program)
+			result.Program.Duration = p.clock.Since(start)
+			return err
+		},
+	})
+	return pl
+}
+
+// SetActiveApp adds a step that marks an application active (multi-application bootloaders).
+func (pl *Plan) SetActiveApp(appNum byte) *Plan {
+	pl.steps = append(pl.steps, planStep{
+		name:   fmt.Sprintf("set active app %d", appNum),
+		weight: 1,
+		run: func(ctx context.Context, p *Programmer, result *StepResult) error {
+			return p.setActiveApp(ctx, appNum)
+		},
+	})
+	return pl
+}
+
+// Verify adds a step that verifies the application checksum.
+func (pl *Plan) Verify() *Plan {
+	pl.steps = append(pl.steps, planStep{
+		name:   "verify checksum",
+		weight: 1,
+		run: func(ctx context.Context, p *Programmer, result *StepResult) error {
+			p.reportProgress(Progress{Phase: PhaseVerifying})
+			_, err := p.verifyChecksum(ctx)
+			return err
+		},
+	})
+	return pl
+}
+
+// StepResult describes the outcome of a single plan step.
+type StepResult struct {
+	// Name describes the step, e.g. "erase array 0 rows 256-511"
+	Name string
+
+	// Duration is the time spent in the step
+	Duration time.Duration
+
+	// Program is the report of a Program step (nil for other steps)
+	Program *ProgramReport
+
+	// Err is the error that caused the step to fail, or nil on success
+	Err error
+}
+
+// PlanReport summarizes a plan execution.
+// Returned by RunPlan, including when a step fails.
+type PlanReport struct {
+	// DeviceInfo is the identification returned by Enter Bootloader
+	// (nil if the bootloader could not be entered)
+	DeviceInfo *protocol.DeviceInfo
+
+	// Steps holds the results of the steps that ran, in order.
+	// Steps after a failed step are not run and have no result.
+	Steps []StepResult
+
+	// Duration is the total time spent executing the plan
+	Duration time.Duration
+}
+
+// RunPlan executes the steps of plan in a single bootloader session.
+//
+// The bootloader is entered once with key before the first step and exited after
+// the last one. If a session was opened with Connect, it is reused instead and
+// left open, and key is ignored. Execution stops at the first failing step; the
+// device is then left in bootloader mode so the plan can be retried.
+//
+// Progress callbacks report the plan as a whole: Percentage covers all steps,
+// weighted by the rows each step touches, and Step and Steps identify the
+// running step.
+//
+// Example:
+//
+//	report, err := prog.RunPlan(ctx, plan, key)
+//	for _, step := range report.Steps {
+//	    fmt.Printf("%s: %s\n", step.Name, step.Duration)
+//	}
+func (p *Programmer) RunPlan(ctx context.Context, plan *Plan, key []byte) (*PlanReport, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	startTime := p.clock.Now()
+	report := &PlanReport{}
+	err = withCause(ctx, p.runPlan(ctx, plan, key, report))
+	report.Duration = p.clock.Since(startTime)
+
+	if err != nil {
+		p.setState(StateFailed)
+	}
+	return report, err
+}
+
+// ProgramSequence programs several images in order in a single bootloader
+// session, such as the stack image of a BLE device followed by its
+// application image. It runs a plan with one Program step per image, so the
+// session handling and the combined progress are those of RunPlan; use
+// RunPlan directly for a report of each image.
+//
+// Example:
+//
+//	err := prog.ProgramSequence(ctx, []*cyacd.Firmware{stackFW, appFW}, key)
+func (p *Programmer) ProgramSequence(ctx context.Context, images []*cyacd.Firmware, key []byte) error {
+	if len(images) == 0 {
+		return fmt.Errorf("no firmware images to program")
+	}
+	plan := NewPlan()
+	for i, fw := range images {
+		if fw == nil {
+			return fmt.Errorf("firmware image %d cannot be nil", i)
+		}
+		plan.Program(fw)
+	}
+
+	_, err := p.RunPlan(ctx, plan, key)
+	return err
+}
+
+// runPlan runs the plan steps and records their outcome in report.
+func (p *Programmer) runPlan(ctx context.Context, plan *Plan, key []byte, report *PlanReport) error {
+	info := p.sessionInfo()
+	inSession := info != nil
+	if !inSession {
+		var err error
+		info, err = p.enterBootloader(ctx, key)
+		if err != nil {
+			return fmt.Errorf("enter bootloader: %w", err)
+		}
+
+		// Program steps reuse the plan's session, as they do one opened by Connect
+		p.opMu.Lock()
+		p.session = info
+		p.opMu.Unlock()
+		defer func() {
+			p.opMu.Lock()
+			p.session = nil
+			p.opMu.Unlock()
+		}()
+	}
+	report.DeviceInfo = info
+	p.setState(StateInBootloader)
+
+	totalWeight := 0
+	for _, step := range plan.steps {
+		totalWeight += step.weight
+	}
+	defer func() { p.progressHook = nil }()
+
+	done := 0
+	for i, step := range plan.steps {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("canceled: %w", err)
+		}
+
+		// Scale the step's progress into the plan's overall percentage
+		offset, weight := done, step.weight
+		p.progressHook = func(progress Progress) Progress {
+			progress.Step = i
+			progress.Steps = len(plan.steps)
+			if totalWeight > 0 {
+				progress.Percentage = (float64(offset) + float64(weight)*progress.Percentage/100) / float64(totalWeight) * 100
+			}
+			return progress
+		}
+
+		p.logDebug("running plan step", "step", i+1, "name", step.name)
+
+		start := p.clock.Now()
+		result := StepResult{Name: step.name}
+		err := step.run(ctx, p, &result)
+		result.Duration = p.clock.Since(start)
+		result.Err = err
+		report.Steps = append(report.Steps, result)
+
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step.name, err)
+		}
+		done += step.weight
+	}
+	p.progressHook = nil
+
+	if !inSession {
+		if err := p.exitBootloader(ctx); err != nil {
+			return fmt.Errorf("exit bootloader: %w", err)
+		}
+		p.setState(StateDone)
+	} else {
+		p.setState(StateInBootloader)
+	}
+
+	p.reportProgress(Progress{
+		Phase:      PhaseComplete,
+		Percentage: 100,
+		Step:       len(plan.steps) - 1,
+		Steps:      len(plan.steps),
+	})
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestRunPlan(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+
+	var progress []Progress
+	prog := New(device, WithProgressCallback(func(p Progress) {
+		progress = append(progress, p)
+	}))
+
+	plan := NewPlan().
+		EraseRange(RowRange{ArrayID: 0, First: 0x0020, Last: 0x0022}).
+		Program(fw).
+		Verify()
+
+	report, err := prog.RunPlan(context.Background(), plan, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(report.Steps) != plan.Len() {
+		t.Fatalf("report has %d steps, want %d", len(report.Steps), plan.Len())
+	}
+	if report.Steps[1].Program == nil || report.Steps[1].Program.RowsProgrammed != 1 {
+		t.Errorf("program step report = %+v", report.Steps[1].Program)
+	}
+
+	// One session: a single Enter Bootloader and Exit Bootloader
+	enters, exits := 0, 0
+	for _, cmd := range device.Commands() {
+		switch cmd {
+		case protocol.CmdEnterBootloader:
+			enters++
+		case protocol.CmdExitBootloader:
+			exits++
+		}
+	}
+	if enters != 1 || exits != 1 {
+		t.Errorf("enter/exit = %d/%d, want 1/1", enters, exits)
+	}
+	if got, _ := device.Row(0, 0x0010); !bytes.Equal(got, data) {
+		t.Errorf("row 0x0010 = % 02X, want % 02X", got, data)
+	}
+
+	// Combined progress never goes backwards and ends at 100%
+	last := 0.0
+	for _, p := range progress {
+		if p.Percentage < last {
+			t.Fatalf("progress went from %.1f%% to %.1f%% (step %d)", last, p.Percentage, p.Step)
+		}
+		if p.Steps != 3 {
+			t.Fatalf("Steps = %d, want 3", p.Steps)
+		}
+		last = p.Percentage
+	}
+	if last < 100 {
+		t.Errorf("final progress = %.1f%%, want 100%%", last)
+	}
+	if prog.Connected() {
+		t.Error("plan session still open after RunPlan")
+	}
+}
+
+func TestRunPlanStopsAtFailure(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	prog := New(device, WithProtectedRows(RowRange{ArrayID: 0, First: 0, Last: 0x000F}))
+
+	plan := NewPlan().
+		EraseRange(RowRange{ArrayID: 0, First: 0x000E, Last: 0x0010}).
+		Verify()
+
+	report, err := prog.RunPlan(context.Background(), plan, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+
+	var protErr *ProtectedRowError
+	if !errors.As(err, &protErr) {
+		t.Fatalf("error = %v, want ProtectedRowError", err)
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Err == nil {
+		t.Errorf("steps = %+v, want only the failed erase step", report.Steps)
+	}
+	if !device.InBootloader() {
+		t.Error("device left bootloader after failed plan")
+	}
+	if prog.State() != StateFailed {
+		t.Errorf("State() = %s, want %s", prog.State(), StateFailed)
+	}
+}
+
+func TestProgramSequence(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	stack := []byte{0x10, 0x20, 0x30, 0x40}
+	app := []byte{0x50, 0x60, 0x70, 0x80}
+	images := []*cyacd.Firmware{
+		{
+			SiliconID: bootloadertest.DefaultSiliconID,
+			Rows:      []*cyacd.Row{{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: stack, Checksum: protocol.CalculateRowChecksum(stack)}},
+		},
+		{
+			SiliconID: bootloadertest.DefaultSiliconID,
+			Rows: []*cyacd.Row{
+				{ArrayID: 0, RowNum: 0x0020, Size: 4, Data: app, Checksum: protocol.CalculateRowChecksum(app)},
+				{ArrayID: 0, RowNum: 0x0021, Size: 4, Data: app, Checksum: protocol.CalculateRowChecksum(app)},
+			},
+		},
+	}
+
+	var last Progress
+	prog := New(device, WithProgressCallback(func(p Progress) { last = p }))
+	if err := prog.ProgramSequence(context.Background(), images, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	enters := 0
+	for _, cmd := range device.Commands() {
+		if cmd == protocol.CmdEnterBootloader {
+			enters++
+		}
+	}
+	if enters != 1 {
+		t.Errorf("%d Enter Bootloader commands, want 1", enters)
+	}
+	for row, want := range map[uint16][]byte{0x0010: stack, 0x0020: app, 0x0021: app} {
+		if got, _ := device.Row(0, row); !bytes.Equal(got, want) {
+			t.Errorf("row 0x%04X = % 02X, want % 02X", row, got, want)
+		}
+	}
+	if last.Phase != PhaseComplete || last.Steps != 2 || last.Percentage != 100 {
+		t.Errorf("final progress = %+v", last)
+	}
+
+	if err := prog.ProgramSequence(context.Background(), nil, nil); err == nil {
+		t.Error("expected an error for no images")
+	}
+	if err := prog.ProgramSequence(context.Background(), []*cyacd.Firmware{images[0], nil}, nil); err == nil {
+		t.Error("expected an error for a nil image")
+	}
+}
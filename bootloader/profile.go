@@ -0,0 +1,126 @@
+package bootloader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// TransportProfile selects a set of settings known to work on one kind of
+// link, applied with WithTransportProfile.
+type TransportProfile int
+
+// Transport profiles.
+const (
+	// USBHID is a full-speed USB HID bootloader with 64-byte reports:
+	// every write is padded to 64 bytes and a Send Data frame fills one
+	// report. Add WithHIDReportID and WithWritePacketSize(65) for HID stacks
+	// that need the report ID in front of each report.
+	USBHID TransportProfile = iota + 1
+
+	// UART115200 is a UART bootloader at 115200 baud, 8N1.
+	UART115200
+
+	// I2C400k is an I2C bootloader on a 400 kHz bus behind a USB bridge. The
+	// command delay gives the device time to prepare its response before
+	// the bridge reads it.
+	I2C400k
+
+	// BLE is a bootloader reached over Bluetooth Low Energy with the default
+	// 23-byte ATT MTU: frames are split into 20-byte writes, one per
+	// connection event, and responses may take several connection intervals.
+	BLE
+)
+
+// profileSettings are the values a TransportProfile sets.
+type profileSettings struct {
+	name         string
+	chunkSize    int
+	commandDelay time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	packetSize   int
+	segmentSize  int
+	segmentDelay time.Duration
+	link         Link
+}
+
+var profiles = map[TransportProfile]profileSettings{
+	USBHID: {
+		name:         "usb-hid",
+		chunkSize:    protocol.MaxPacketSize - protocol.SendDataOverhead,
+		readTimeout:  time.Second,
+		writeTimeout: time.Second,
+		packetSize:   protocol.MaxPacketSize,
+		link:         Link{Latency: 2 * time.Millisecond, BytesPerSecond: 64000, RowWriteTime: 5 * time.Millisecond},
+	},
+	UART115200: {
+		name:         "uart-115200",
+		chunkSize:    DefaultChunkSize,
+		readTimeout:  time.Second,
+		writeTimeout: time.Second,
+		link:         Link{Latency: time.Millisecond, BytesPerSecond: 11520, RowWriteTime: 5 * time.Millisecond},
+	},
+	I2C400k: {
+		name:         "i2c-400k",
+		chunkSize:    DefaultChunkSize,
+		commandDelay: 10 * time.Millisecond,
+		readTimeout:  time.Second,
+		writeTimeout: time.Second,
+		link:         Link{Latency: 2 * time.Millisecond, BytesPerSecond: 40000, RowWriteTime: 5 * time.Millisecond},
+	},
+	BLE: {
+		name:         "ble",
+		chunkSize:    DefaultChunkSize,
+		readTimeout:  3 * time.Second,
+		writeTimeout: 3 * time.Second,
+		segmentSize:  20,
+		segmentDelay: 8 * time.Millisecond,
+		link:         Link{Latency: 30 * time.Millisecond, BytesPerSecond: 2000, RowWriteTime: 5 * time.Millisecond},
+	},
+}
+
+// String returns the name of the profile, e.g. "uart-115200".
+func (t TransportProfile) String() string {
+	if s, ok := profiles[t]; ok {
+		return s.name
+	}
+	return fmt.Sprintf("TransportProfile(%d)", int(t))
+}
+
+// Link returns the typical timing of the link, for Estimate. Measure the
+// actual link for accurate estimates.
+func (t TransportProfile) Link() Link {
+	return profiles[t].link
+}
+
+// WithTransportProfile sets the chunk size, command delay, read and write
+// timeouts, write packet size, and write segments to values that suit the
+// link, in place of tuning each option by hand. Options after it override
+// single values.
+//
+// Example:
+//
+//	prog := bootloader.New(port,
+//	    bootloader.WithTransportProfile(bootloader.UART115200),
+//	    bootloader.WithReadTimeout(2*time.Second), // slow flash
+//	)
+func WithTransportProfile(profile TransportProfile) Option {
+	return func(c *Config) {
+		s, ok := profiles[profile]
+		if !ok {
+			c.invalidOption("unknown transport profile %d", int(profile))
+			return
+		}
+		c.ChunkSize = s.chunkSize
+		c.CommandDelay = s.commandDelay
+		c.chunkSizeSet = true
+		c.commandDelaySet = true
+		c.ReadTimeout = s.readTimeout
+		c.WriteTimeout = s.writeTimeout
+		c.WritePacketSize = s.packetSize
+		c.WriteSegmentSize = s.segmentSize
+		c.WriteSegmentDelay = s.segmentDelay
+	}
+}
@@ -0,0 +1,48 @@
+package bootloader
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+)
+
+func TestTransportProfile(t *testing.T) {
+	for _, profile := range []TransportProfile{USBHID, UART115200, I2C400k, BLE} {
+		prog, err := NewProgrammer(bootloadertest.NewDevice(), WithTransportProfile(profile))
+		if err != nil {
+			t.Errorf("%s: %v", profile, err)
+			continue
+		}
+		if prog.config.ChunkSize <= 0 || prog.config.ReadTimeout <= 0 || prog.config.WriteTimeout <= 0 {
+			t.Errorf("%s: config %+v", profile, prog.config)
+		}
+		if profile.Link().BytesPerSecond <= 0 {
+			t.Errorf("%s: link %+v", profile, profile.Link())
+		}
+	}
+
+	prog := New(bootloadertest.NewDevice(), WithTransportProfile(BLE), WithReadTimeout(time.Minute))
+	if prog.config.ReadTimeout != time.Minute || prog.config.WriteSegmentSize != 20 {
+		t.Errorf("BLE with read timeout: %s, segments of %d", prog.config.ReadTimeout, prog.config.WriteSegmentSize)
+	}
+
+	// USB HID pads to 64-byte reports; a report ID needs 65-byte writes
+	if _, err := NewProgrammer(bootloadertest.NewDevice(), WithTransportProfile(USBHID), WithHIDReportID(0)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("USB HID with a report ID in 64-byte packets: %v", err)
+	}
+	if _, err := NewProgrammer(bootloadertest.NewDevice(), WithTransportProfile(USBHID), WithHIDReportID(0), WithWritePacketSize(65)); err != nil {
+		t.Errorf("USB HID with a report ID in 65-byte packets: %v", err)
+	}
+
+	if _, err := NewProgrammer(bootloadertest.NewDevice(), WithTransportProfile(0)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("unknown profile: %v", err)
+	}
+	if got := TransportProfile(0).String(); got != "TransportProfile(0)" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := UART115200.String(); got != "uart-115200" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -1,27 +1,111 @@
 package bootloader
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/pcapng"
 	"github.com/moffa90/go-cyacd/protocol"
 )
 
 // Programmer orchestrates firmware programming operations for Cypress microcontrollers.
 // It handles the complete programming sequence including verification and progress tracking.
 //
-// Programmer is safe for concurrent use after initialization.
+// A Programmer runs one operation at a time. Calls that would talk to the device
+// while another operation is in progress (for example a second Program from another
+// goroutine) fail immediately with ErrBusy instead of interleaving frames on the wire.
+// Abort, State, Connected, and Config may be called concurrently with an operation.
 type Programmer struct {
 	device io.ReadWriter
 	config Config
+	clock  Clock
+
+	// opMu guards the in-flight operation and session fields below
+	opMu     sync.Mutex
+	opCancel context.CancelCauseFunc
+	opDone   chan struct{}
+	session  *protocol.DeviceInfo
+	state    State
+
+	// flashSizes caches the Get Flash Size result of each array until the
+	// bootloader is entered or exited again (see InvalidateCaches)
+	flashSizes map[byte]protocol.FlashSize
+
+	// nextWrite is the earliest time the next write may start (see WithMaxBytesPerSecond)
+	nextWrite time.Time
+
+	// checksumType is the packet checksum type used for frames; Program switches
+	// it to the firmware's checksum type for the duration of the operation
+	checksumType byte
+
+	// txBuf, rxBuf, and pktBuf are reused across commands to avoid allocating
+	// frames in the programming loop. Only one operation runs at a time, so they
+	// need no locking; response data sliced from rxBuf is only valid until the
+	// next command.
+	txBuf  []byte
+	rxBuf  []byte
+	pktBuf []byte
+
+	// chunkSize is the Send Data chunk size in use: Config.ChunkSize, or the
+	// size found by NegotiateChunkSize once chunkNegotiated is set
+	chunkSize       int
+	chunkNegotiated bool
+
+	// rowSize and commandDelay are the row size and command delay in use:
+	// the configured ones, or those of the device profile (see WithDeviceProfiles)
+	rowSize      int
+	commandDelay time.Duration
+
+	// rowSizeHint is the row size of a built-in device profile, which is
+	// warned about rather than checked
+	rowSizeHint int
+
+	// pipelined is set while several responses are in flight; readFrame then
+	// keeps bytes following a response in rxPending for the next read.
+	// pipelineFailed records the fallback to strict sending after a failure.
+	pipelined      bool
+	pipelineFailed bool
+	rxPending      []byte
+
+	// batchBuf and batchEnds hold the frames of a coalesced write (see
+	// WithCoalescedWrites) and the end offset of each
+	batchBuf  []byte
+	batchEnds []int
+
+	// capture is the interface frames are recorded on (see WithCapture), added
+	// on the first frame; captureOff is set once it fails
+	capture    *pcapng.Interface
+	captureOff bool
+
+	// stats collects command timing while Program runs (nil otherwise)
+	stats *statsCollector
+
+	// phase is the phase of the last progress report (see WithPhaseCallback)
+	phase Phase
+
+	// lastProgress and lastProgressAt record the last delivered progress report
+	// (once progressSent is set) for progress throttling
+	lastProgress   Progress
+	lastProgressAt time.Time
+	progressSent   bool
+
+	// progressHook (optional) adjusts progress reports before the callback;
+	// RunPlan uses it to scale each step into the plan's overall progress
+	progressHook func(Progress) Progress
 }
 
 // New creates a new Programmer with the given device and options.
 // The device must implement io.ReadWriter for communication with the bootloader.
 //
+// New panics if device is nil, and ignores out-of-range option values (keeping
+// the default). Use NewProgrammer to have both reported as errors.
+//
 // Example:
 //
 //	device := myusb.OpenDevice("serial-number")
@@ -39,21 +123,90 @@ func New(device io.ReadWriter, opts ...Option) *Programmer {
 		opt(&cfg)
 	}
 
+	return newProgrammer(device, cfg)
+}
+
+// NewProgrammer creates a new Programmer like New, but validates its arguments
+// instead of panicking or silently ignoring bad values. It returns an error for
+// a nil device, for out-of-range option values such as WithChunkSize(0) or
+// WithRetries(-1), and for options that conflict, such as a chunk size that
+// does not fit in the packets set with WithWritePacketSize. Option errors wrap
+// ErrInvalidOption; all of them are reported at once.
+//
+// Example:
+//
+//	prog, err := bootloader.NewProgrammer(device, bootloader.WithChunkSize(size))
+//	if err != nil {
+//	    log.Fatalf("bad configuration: %v", err)
+//	}
+func NewProgrammer(device io.ReadWriter, opts ...Option) (*Programmer, error) {
+	if device == nil {
+		return nil, fmt.Errorf("device cannot be nil")
+	}
+
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return newProgrammer(device, cfg), nil
+}
+
+// newProgrammer creates a Programmer from a complete configuration.
+func newProgrammer(device io.ReadWriter, cfg Config) *Programmer {
+	cfg.optionErrs = nil
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
 	return &Programmer{
-		device: device,
-		config: cfg,
+		device:       device,
+		config:       cfg,
+		clock:        clock,
+		checksumType: cfg.ChecksumType,
+		chunkSize:    cfg.ChunkSize,
+		rowSize:      cfg.RowSize,
+		commandDelay: cfg.CommandDelay,
+	}
+}
+
+// Config returns a copy of the programmer configuration.
+// The configuration is fixed at construction, so Config is safe to call at any time.
+func (p *Programmer) Config() Config {
+	cfg := p.config
+	cfg.ProtectedRows = append([]RowRange(nil), p.config.ProtectedRows...)
+	if p.config.ExpectedSiliconRev != nil {
+		rev := *p.config.ExpectedSiliconRev
+		cfg.ExpectedSiliconRev = &rev
 	}
+	return cfg
 }
 
 // Program performs the complete firmware programming sequence:
 //  1. Enter bootloader with the provided key
-//  2. Validate device silicon ID matches firmware
+//  2. Validate device silicon ID (and revision, if enabled) matches firmware
 //  3. Get flash size and validate all rows are in range
 //  4. Program all rows with progress tracking
-//  5. Verify application checksum
-//  6. Exit bootloader
+//  5. Verify application checksum (unless WithSkipAppVerify is set)
+//  6. Exit bootloader (unless WithSkipExit is set)
+//  7. Wait for the application to start (if WithWaitForApplication is set)
 //
-// The operation can be canceled via context.
+// If a session was opened with Connect, steps 1 and 6 are skipped: the existing
+// session is reused, key is ignored (and may be nil), and the device stays in
+// bootloader mode until Close is called.
+//
+// The operation can be canceled via context. Cancellation takes effect between
+// the chunks of a row (and within reads for devices implementing ContextReader);
+// an interrupted row is discarded with Sync Bootloader before Program returns.
+// When ctx is canceled with a cause (context.WithCancelCause, or
+// context.WithTimeoutCause), the returned error wraps the cause along with
+// context.Canceled or context.DeadlineExceeded, and the report of
+// ProgramWithReport records it in CancelCause. Abort cancels with ErrAborted.
 //
 // Example:
 //
@@ -61,64 +214,180 @@ func New(device io.ReadWriter, opts ...Option) *Programmer {
 //	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
 //	err := prog.Program(context.Background(), fw, key)
 func (p *Programmer) Program(ctx context.Context, fw *cyacd.Firmware, key []byte) error {
+	_, err := p.ProgramWithReport(ctx, fw, key)
+	return err
+}
+
+// ProgramWithReport performs the same sequence as Program and additionally returns
+// a ProgramReport describing the session. The report is returned even when
+// programming fails, so callers can inspect how far the operation got and whether
+// a rollback was performed.
+//
+// Example:
+//
+//	report, err := prog.ProgramWithReport(ctx, fw, key)
+//	if err != nil && report.RollbackPerformed {
+//	    log.Printf("update failed, application %d restored", report.RollbackApp)
+//	}
+func (p *Programmer) ProgramWithReport(ctx context.Context, fw *cyacd.Firmware, key []byte) (*ProgramReport, error) {
 	if fw == nil {
-		return fmt.Errorf("firmware cannot be nil")
+		return nil, fmt.Errorf("firmware cannot be nil")
+	}
+	if p.sessionInfo() == nil {
+		if err := protocol.ValidateKey(key); err != nil {
+			return nil, err
+		}
 	}
-	if len(key) != protocol.BootloaderKeySize {
-		return fmt.Errorf("key must be exactly %d bytes, got %d", protocol.BootloaderKeySize, len(key))
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	startTime := p.clock.Now()
+	report := &ProgramReport{TotalRows: len(fw.Rows)}
+
+	err = p.program(ctx, fw, key, startTime, report)
+	report.Duration = p.clock.Since(startTime)
+	if err != nil {
+		p.setState(StateFailed)
+	}
+
+	return report, err
+}
+
+// program runs the programming sequence and records its outcome in report.
+func (p *Programmer) program(ctx context.Context, fw *cyacd.Firmware, key []byte, startTime time.Time, report *ProgramReport) (err error) {
+	// The .cyacd header records the packet checksum the bootloader was built with
+	p.checksumType = fw.ChecksumType
+	defer func() { p.checksumType = p.config.ChecksumType }()
+
+	p.stats = newStatsCollector()
+	defer func() {
+		stats := p.stats.result()
+		p.stats = nil
+		report.Stats = &stats
+		if p.config.StatsCallback != nil {
+			p.config.StatsCallback(stats)
+		}
+	}()
+
+	report.DeviceID = p.config.DeviceID
+	report.FirmwareFingerprint = fw.Fingerprint()
+	defer func() { report.Err = err }()
+
+	selected := p.filterRows(fw.Rows)
+	report.RowsSkipped = len(fw.Rows) - len(selected)
+	if report.RowsSkipped > 0 {
+		p.logDebug("rows filtered", "selected", len(selected), "skipped", report.RowsSkipped)
 	}
 
-	startTime := time.Now()
+	jnl := p.openJournal()
+	jnl.start(fw, len(selected))
+	defer func() { jnl.end(report, p.clock.Since(startTime), err) }()
+
+	hlog := p.openHostLog()
+	hlog.start(len(selected))
+	defer func() { hlog.end(p.clock.Since(startTime), err) }()
+
+	// Report why the session was canceled, if the caller gave a reason
+	defer func() {
+		err = withCause(ctx, err)
+		if err != nil && ctx.Err() != nil {
+			report.CancelCause = context.Cause(ctx)
+		}
+	}()
+
+	progress := p.newProgressTracker(startTime, selected, report.RowsSkipped)
 
 	// Phase 1: Enter bootloader
-	p.reportProgress(Progress{
+	progress.report(Progress{
 		Phase:      PhaseEntering,
 		Percentage: 0,
-		TotalRows:  len(fw.Rows),
 	})
 
-	deviceInfo, err := p.EnterBootloader(ctx, key)
-	if err != nil {
-		return fmt.Errorf("enter bootloader: %w", err)
-	}
+	// Reuse the open session if Connect was called, otherwise enter the bootloader
+	deviceInfo := p.sessionInfo()
+	inSession := deviceInfo != nil
+	if !inSession {
+		deviceInfo, err = p.enterBootloader(ctx, key)
+		if err != nil {
+			return fmt.Errorf("enter bootloader: %w", err)
+		}
 
-	p.logDebug("entered bootloader",
-		"silicon_id", fmt.Sprintf("0x%08X", deviceInfo.SiliconID),
-		"silicon_rev", fmt.Sprintf("0x%02X", deviceInfo.SiliconRev),
-		"bootloader_ver", fmt.Sprintf("%d.%d.%d",
-			deviceInfo.BootloaderVer[0], deviceInfo.BootloaderVer[1], deviceInfo.BootloaderVer[2]),
-	)
+		p.logDebug("entered bootloader",
+			"silicon_id", fmt.Sprintf("0x%08X", deviceInfo.SiliconID),
+			"silicon_rev", fmt.Sprintf("0x%02X", deviceInfo.SiliconRev),
+			"bootloader_ver", fmt.Sprintf("%d.%d.%d",
+				deviceInfo.BootloaderVer[0], deviceInfo.BootloaderVer[1], deviceInfo.BootloaderVer[2]),
+		)
+	}
+	report.DeviceInfo = deviceInfo
+	hlog.device(deviceInfo)
+	p.setState(StateInBootloader)
 
 	// Phase 2: Validate device silicon ID
-	if deviceInfo.SiliconID != fw.SiliconID {
-		return &DeviceMismatchError{
-			Expected: fw.SiliconID,
-			Actual:   deviceInfo.SiliconID,
+	if err := p.checkSiliconID(deviceInfo, fw.SiliconID); err != nil {
+		return err
+	}
+	if err := p.checkSiliconRev(deviceInfo, fw.SiliconRev); err != nil {
+		return err
+	}
+
+	// Record the active application so a failed update can be rolled back
+	// (only while the device is still in the bootloader)
+	exited := false
+	if p.config.Rollback {
+		activeApp, found, appErr := p.findActiveApp(ctx)
+		if appErr != nil {
+			return fmt.Errorf("get active application: %w", appErr)
+		}
+
+		if found {
+			defer func() {
+				if err != nil && !exited {
+					p.rollback(ctx, activeApp, report)
+				}
+			}()
+		} else {
+			p.logInfo("no active application found, rollback disabled")
 		}
 	}
 
 	// Phase 3: Get flash size and validate rows
-	p.reportProgress(Progress{
+	progress.report(Progress{
 		Phase:      PhaseProgramming,
 		Percentage: 2,
-		TotalRows:  len(fw.Rows),
 	})
 
+	// Drop the rows of the bootloader from combined images
+	if p.config.SkipBootloaderRows && len(selected) > 0 {
+		var skipped []RowRange
+		selected, skipped, err = p.skipBootloaderRows(ctx, selected)
+		if err != nil {
+			return err
+		}
+		report.BootloaderRows = skipped
+		report.RowsSkipped = len(fw.Rows) - len(selected)
+		progress.skipRows(skipped, selected)
+	}
+
 	// Validate all rows are in range (check first row's array)
-	if len(fw.Rows) > 0 {
-		flashSize, err := p.GetFlashSize(ctx, fw.Rows[0].ArrayID)
+	if len(selected) > 0 {
+		flashSize, err := p.getFlashSize(ctx, selected[0].ArrayID)
 		if err != nil {
 			return fmt.Errorf("get flash size: %w", err)
 		}
 
 		p.logDebug("flash size",
-			"array_id", fw.Rows[0].ArrayID,
+			"array", selected[0].ArrayID,
 			"start_row", flashSize.StartRow,
 			"end_row", flashSize.EndRow,
 		)
 
 		// Validate all rows are in range
-		for _, row := range fw.Rows {
+		for _, row := range selected {
 			if row.RowNum < flashSize.StartRow || row.RowNum > flashSize.EndRow {
 				return &RowOutOfRangeError{
 					ArrayID: row.ArrayID,
@@ -130,109 +399,474 @@ func (p *Programmer) Program(ctx context.Context, fw *cyacd.Firmware, key []byte
 		}
 	}
 
+	if err := p.checkGeometry(selected); err != nil {
+		return err
+	}
+	if err := p.checkProtectedRows(selected); err != nil {
+		return err
+	}
+
+	desc := Description{
+		DeviceInfo:          deviceInfo,
+		DeviceID:            p.config.DeviceID,
+		Rows:                len(selected),
+		FirmwareFingerprint: report.FirmwareFingerprint,
+	}
+	for _, row := range selected {
+		desc.Bytes += len(row.Data)
+	}
+	desc.Metadata, _ = imageMetadata(fw)
+	if err := p.confirm(desc); err != nil {
+		if !inSession {
+			exited = p.leaveUnconfirmed(ctx)
+		}
+		return err
+	}
+
+	if err := p.autoChunkSize(ctx); err != nil {
+		return err
+	}
+
 	// Phase 4: Program rows
+	rows, err := p.orderRows(selected)
+	if err != nil {
+		return err
+	}
+
+	report.VerifyEvery = p.verifyInterval()
+	p.setState(StateProgramming)
+	progress.beginRows()
 	bytesWritten := 0
-	for i, row := range fw.Rows {
+	for i, row := range rows {
 		if err := ctx.Err(); err != nil {
 			return fmt.Errorf("canceled: %w", err)
 		}
 
-		if err := p.programRow(ctx, row); err != nil {
-			return fmt.Errorf("program row %d (array=%d, row=%d): %w",
-				i, row.ArrayID, row.RowNum, err)
+		// Report intermediate chunks of rows that need several packets
+		onChunk := func(chunk, chunks int) {
+			if chunk < chunks {
+				progress.report(Progress{
+					Phase:      PhaseProgramming,
+					CurrentRow: i,
+					Percentage: 2 + (float64(i)+float64(chunk)/float64(chunks))/float64(len(rows))*88,
+					ChunkIndex: chunk,
+					ChunkCount: chunks,
+				})
+			}
 		}
 
-		// Verify if enabled
-		if p.config.VerifyAfterProgram {
-			if err := p.verifyRow(ctx, row); err != nil {
-				return fmt.Errorf("verify row %d (array=%d, row=%d): %w",
-					i, row.ArrayID, row.RowNum, err)
-			}
+		result, err := p.programRowWithRetry(ctx, i, row, onChunk)
+		p.stats.recordRow(result.Bytes, result.Retries, result.Duration)
+		p.reportRow(result)
+		jnl.row(result, row)
+		report.Rows = append(report.Rows, result)
+		if err != nil {
+			return err
 		}
 
 		bytesWritten += len(row.Data)
+		report.RowsProgrammed = i + 1
+		report.BytesWritten = bytesWritten
+		if result.Verified {
+			report.RowsVerified++
+		}
 
 		// Report progress (2% to 90%)
-		percentage := 2 + (float64(i+1)/float64(len(fw.Rows)))*88
-		p.reportProgress(Progress{
+		percentage := 2 + (float64(i+1)/float64(len(rows)))*88
+		chunks := p.chunkCount(row)
+		progress.report(Progress{
 			Phase:        PhaseProgramming,
 			CurrentRow:   i + 1,
-			TotalRows:    len(fw.Rows),
 			Percentage:   percentage,
 			BytesWritten: bytesWritten,
-			ElapsedTime:  time.Since(startTime),
+			ChunkIndex:   chunks,
+			ChunkCount:   chunks,
 		})
 	}
 
 	// Phase 5: Verify application checksum
-	p.reportProgress(Progress{
-		Phase:       PhaseVerifying,
-		CurrentRow:  len(fw.Rows),
-		TotalRows:   len(fw.Rows),
-		Percentage:  92,
-		ElapsedTime: time.Since(startTime),
+	progress.report(Progress{
+		Phase:      PhaseVerifying,
+		CurrentRow: len(rows),
+		Percentage: 92,
 	})
 
-	if _, err := p.VerifyChecksum(ctx); err != nil {
-		return fmt.Errorf("verify application: %w", err)
+	p.setState(StateVerifying)
+	if !p.config.SkipAppVerify {
+		if _, err := p.verifyChecksum(ctx); err != nil {
+			return fmt.Errorf("verify application: %w", err)
+		}
 	}
 
-	// Phase 6: Exit bootloader
-	p.reportProgress(Progress{
-		Phase:       PhaseExiting,
-		CurrentRow:  len(fw.Rows),
-		TotalRows:   len(fw.Rows),
-		Percentage:  95,
-		ElapsedTime: time.Since(startTime),
-	})
+	if p.config.ValidateApp {
+		metadata, err := p.validateApp(ctx, fw)
+		report.AppMetadata = metadata
+		if err != nil {
+			return fmt.Errorf("validate application: %w", err)
+		}
+	}
 
-	if err := p.ExitBootloader(ctx); err != nil {
-		return fmt.Errorf("exit bootloader: %w", err)
+	// Phase 6: Exit bootloader (an open session is left running until Close)
+	if !inSession && !p.config.SkipExit {
+		progress.report(Progress{
+			Phase:      PhaseExiting,
+			CurrentRow: len(rows),
+			Percentage: 95,
+		})
+
+		acked, err := p.exitBootloaderAck(ctx)
+		report.ExitAcknowledged = acked
+		if err != nil {
+			return fmt.Errorf("exit bootloader: %w", err)
+		}
+		p.setState(StateDone)
+		exited = true
+
+		if p.config.AppProbe != nil {
+			progress.report(Progress{
+				Phase:      PhaseWaiting,
+				CurrentRow: len(rows),
+				Percentage: 97,
+			})
+
+			if err := p.waitForApplication(ctx, p.config.AppProbe, p.config.AppStartTimeout); err != nil {
+				return err
+			}
+		}
+	} else {
+		p.setState(StateInBootloader)
 	}
 
 	// Complete
-	p.reportProgress(Progress{
-		Phase:        PhaseComplete,
-		CurrentRow:   len(fw.Rows),
-		TotalRows:    len(fw.Rows),
-		Percentage:   100,
-		BytesWritten: bytesWritten,
-		ElapsedTime:  time.Since(startTime),
+	progress.report(Progress{
+		Phase:      PhaseComplete,
+		CurrentRow: len(rows),
+		Percentage: 100,
 	})
 
 	p.logInfo("programming complete",
-		"rows", len(fw.Rows),
+		"rows", len(rows),
 		"bytes", bytesWritten,
-		"elapsed", time.Since(startTime).String(),
+		"duration", p.clock.Since(startTime).String(),
 	)
 
 	return nil
 }
 
+// checkSiliconID validates the device silicon ID against the firmware header,
+// unless the check was overridden with WithAllowSiliconIDMismatch.
+func (p *Programmer) checkSiliconID(info *protocol.DeviceInfo, fwID uint32) error {
+	if info.SiliconID == fwID {
+		return nil
+	}
+
+	if p.config.AllowSiliconIDMismatch {
+		p.logWarn("silicon ID mismatch ignored",
+			"firmware", fmt.Sprintf("0x%08X", fwID),
+			"device", fmt.Sprintf("0x%08X", info.SiliconID),
+		)
+		return nil
+	}
+
+	return &DeviceMismatchError{
+		Expected: fwID,
+		Actual:   info.SiliconID,
+	}
+}
+
+// checkSiliconRev validates the device silicon revision when CheckSiliconRev is set.
+// fwRev is the revision recorded in the firmware header.
+func (p *Programmer) checkSiliconRev(info *protocol.DeviceInfo, fwRev byte) error {
+	if !p.config.CheckSiliconRev {
+		return nil
+	}
+
+	expected := fwRev
+	if p.config.ExpectedSiliconRev != nil {
+		expected = *p.config.ExpectedSiliconRev
+	}
+	if info.SiliconRev != expected {
+		return &SiliconRevMismatchError{
+			Expected: expected,
+			Actual:   info.SiliconRev,
+		}
+	}
+	return nil
+}
+
+// findActiveApp queries both application slots of a dual-application bootloader
+// and returns the number of the active one.
+func (p *Programmer) findActiveApp(ctx context.Context) (appNum byte, found bool, err error) {
+	for app := byte(0); app < protocol.MaxApplications; app++ {
+		status, err := p.getAppStatus(ctx, app)
+		if err != nil {
+			return 0, false, err
+		}
+		if status.Active {
+			return app, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// rollback marks the previously active application active again after a failed update.
+// It runs even when ctx has been canceled, since leaving the device without a valid
+// active application is worse than a slightly delayed return.
+func (p *Programmer) rollback(ctx context.Context, appNum byte, report *ProgramReport) {
+	ctx = context.WithoutCancel(ctx)
+
+	if err := p.setActiveApp(ctx, appNum); err != nil {
+		p.logError("rollback failed", "app", appNum, "error", err)
+		return
+	}
+
+	report.RollbackPerformed = true
+	report.RollbackApp = appNum
+	p.logInfo("rolled back to previous application", "app", appNum)
+}
+
+// Abort stops the in-flight operation (if any) and leaves the bootloader in a
+// recoverable state. It cancels the running operation, waits for it to return,
+// sends Sync Bootloader to discard any partially buffered row data, and drains
+// unread input from the device when it implements InputFlusher.
+//
+// After Abort returns, the device remains in bootloader mode and a new
+// operation can be started without re-entering the bootloader.
+//
+// Example:
+//
+//	go func() {
+//	    <-userPressedStop
+//	    _ = prog.Abort(context.Background())
+//	}()
+//	err := prog.Program(ctx, fw, key) // errors.Is(err, bootloader.ErrAborted)
+func (p *Programmer) Abort(ctx context.Context) error {
+	p.opMu.Lock()
+	cancel, done := p.opCancel, p.opDone
+	p.opMu.Unlock()
+
+	if cancel != nil {
+		cancel(ErrAborted)
+		p.logInfo("aborted in-flight operation")
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return fmt.Errorf("abort: waiting for operation: %w", ctx.Err())
+		}
+	}
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	return p.resync(ctx)
+}
+
+// resync sends Sync Bootloader and drains stale input from the device.
+// The Sync response (if the bootloader sends one) is discarded with the rest
+// of the pending input.
+func (p *Programmer) resync(ctx context.Context) error {
+	cmd, err := protocol.BuildSyncBootloaderCmd()
+	if err != nil {
+		return err
+	}
+
+	if err := p.sendCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("sync bootloader: %w", err)
+	}
+
+	if f, ok := p.device.(InputFlusher); ok {
+		if err := f.ResetInputBuffer(); err != nil {
+			return fmt.Errorf("drain input: %w", err)
+		}
+	}
+
+	p.logDebug("bootloader resynchronized")
+
+	return nil
+}
+
+// resyncCanceled sends Sync Bootloader after ctx was canceled in the middle of a row,
+// so that the chunks the bootloader has buffered are discarded and the next operation
+// starts from a clean state. The resync is bounded by the write timeout.
+func (p *Programmer) resyncCanceled(ctx context.Context) {
+	timeout := p.config.WriteTimeout
+	if timeout <= 0 {
+		timeout = DefaultWriteTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	if err := p.resync(ctx); err != nil {
+		p.logError("resync after cancellation failed", "error", err)
+	}
+}
+
+// beginOperation registers ctx as the in-flight operation so that Abort can cancel it.
+// Returns ErrBusy if another operation is already in progress.
+// The returned finish function must be called when the operation returns.
+func (p *Programmer) beginOperation(ctx context.Context) (context.Context, func(), error) {
+	p.opMu.Lock()
+	if p.opDone != nil {
+		p.opMu.Unlock()
+		return nil, nil, ErrBusy
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	p.opCancel = cancel
+	p.opDone = done
+	p.opMu.Unlock()
+
+	return ctx, func() {
+		p.opMu.Lock()
+		p.opCancel = nil
+		p.opDone = nil
+		p.opMu.Unlock()
+
+		cancel(nil)
+		close(done)
+	}, nil
+}
+
+// programRowWithRetry programs and (if enabled) verifies a row, retrying transient
+// transport failures up to Config.Retries times. The bootloader is resynchronized
+// before each retry so that partially buffered chunks are discarded. A row whose
+// checksum does not match after programming is erased and reprogrammed within
+// the same retry budget.
+func (p *Programmer) programRowWithRetry(ctx context.Context, index int, row *cyacd.Row, onChunk func(chunk, chunks int)) (RowResult, error) {
+	result := RowResult{
+		Index:   index,
+		ArrayID: row.ArrayID,
+		RowNum:  row.RowNum,
+		Bytes:   len(row.Data),
+	}
+	start := p.clock.Now()
+
+	for {
+		phase := PhaseProgramming
+		err := p.programRow(ctx, row, onChunk)
+		if err == nil && (p.shouldVerifyRow(index) || (p.config.AdaptiveVerify && result.Retries > 0)) {
+			// Verify if enabled
+			phase = PhaseVerifying
+			result.DeviceChecksum, err = p.verifyRow(ctx, row)
+			result.Verified = err == nil
+		}
+
+		if err != nil && ctx.Err() != nil {
+			p.resyncCanceled(ctx)
+		}
+
+		// A row that reads back wrong is erased and programmed again: a transient
+		// flash write glitch should not abort the whole update
+		var mismatchErr *ChecksumMismatchError
+		reprogram := errors.As(err, &mismatchErr)
+
+		if err == nil || result.Retries >= p.config.Retries || !(reprogram || IsRetryable(err)) || ctx.Err() != nil {
+			if err != nil {
+				err = &ProgramRowError{
+					Index:    index,
+					ArrayID:  row.ArrayID,
+					RowNum:   row.RowNum,
+					Phase:    phase,
+					Attempts: result.Retries + 1,
+					Err:      err,
+				}
+			}
+			result.Duration = p.clock.Since(start)
+			result.Err = err
+			if err == nil {
+				p.logDebug("row programmed",
+					"phase", PhaseProgramming,
+					"array", row.ArrayID,
+					"row", row.RowNum,
+					"attempt", result.Retries+1,
+					"duration", result.Duration.String(),
+				)
+			}
+			return result, err
+		}
+
+		result.Retries++
+		p.logDebug("retrying row",
+			"phase", phase,
+			"array", row.ArrayID,
+			"row", row.RowNum,
+			"attempt", result.Retries+1,
+			"error", err,
+		)
+
+		if err := p.resync(ctx); err != nil {
+			result.Duration = p.clock.Since(start)
+			result.Err = fmt.Errorf("resync before retry: %w", err)
+			return result, result.Err
+		}
+
+		if reprogram {
+			p.logInfo("row verification failed, reprogramming",
+				"phase", PhaseVerifying, "array", row.ArrayID, "row", row.RowNum, "attempt", result.Retries+1)
+			if err := p.eraseRow(ctx, row.ArrayID, row.RowNum); err != nil {
+				result.Duration = p.clock.Since(start)
+				result.Err = fmt.Errorf("erase before reprogram: %w", err)
+				return result, result.Err
+			}
+		}
+	}
+}
+
+// verifyInterval returns the row verification interval: 0 if rows are not
+// verified, 1 if every row is, n for every nth row.
+func (p *Programmer) verifyInterval() int {
+	if !p.config.VerifyAfterProgram {
+		return 0
+	}
+	return max(p.config.VerifyEvery, 1)
+}
+
+// shouldVerifyRow reports whether the row at index (in programming order) is verified.
+func (p *Programmer) shouldVerifyRow(index int) bool {
+	n := p.verifyInterval()
+	return n > 0 && index%n == 0
+}
+
+// reportRow calls the row callback if configured.
+func (p *Programmer) reportRow(result RowResult) {
+	if p.config.RowCallback != nil {
+		p.config.RowCallback(result)
+	}
+}
+
 // programRow programs a single flash row, handling data chunking if necessary.
-func (p *Programmer) programRow(ctx context.Context, row *cyacd.Row) error {
-	chunkSize := p.config.ChunkSize
+// onChunk (optional) is called after each chunk is acknowledged, with the number
+// of chunks sent so far and the total number of chunks for the row.
+func (p *Programmer) programRow(ctx context.Context, row *cyacd.Row, onChunk func(chunk, chunks int)) error {
+	if mtu := p.coalesceMTU(); mtu > 0 {
+		return p.programRowCoalesced(ctx, row, mtu, onChunk)
+	}
+
 	data := row.Data
-	offset := 0
+	chunks := p.chunkCount(row)
 
 	// Send chunks using SendData while (remaining + SendData overhead) exceeds packet size
 	// Uses row.Size (from CYACD file) instead of len(data) to match reference implementation
 	// This is critical for hybrid CYACD files where Size field may differ from actual data length
 	// Reference: for (r.Size()-offset+7) > PacketSize
-	for (int(row.Size) - offset + protocol.SendDataOverhead) > protocol.MaxPacketSize {
-		chunk := data[offset : offset+chunkSize]
-		if err := p.sendData(ctx, chunk); err != nil {
-			return fmt.Errorf("send data chunk: %w", err)
-		}
-		offset += chunkSize
+	offset := p.sendDataEnd(int(row.Size), len(data), protocol.SendDataOverhead)
+	if err := p.sendDataChunks(ctx, data[:offset], chunks, onChunk); err != nil {
+		return err
 	}
 
 	// Program the remaining data with ProgramRow command
 	remainingData := data[offset:]
-	cmd, err := protocol.BuildProgramRowCmd(row.ArrayID, row.RowNum, remainingData)
+	cmd, err := protocol.AppendProgramRowCmd(p.txBuf[:0], row.ArrayID, row.RowNum, remainingData)
 	if err != nil {
 		return err
 	}
+	p.txBuf = cmd
 
 	// Send command and wait for response
 	response, err := p.sendCommandWithResponse(ctx, cmd)
@@ -240,46 +874,79 @@ func (p *Programmer) programRow(ctx context.Context, row *cyacd.Row) error {
 		return err
 	}
 
-	// Check for success status
-	statusCode, _, err := protocol.ParseResponse(response)
-	if err != nil {
+	if err := p.checkProgramRowResponse(response); err != nil {
 		return err
 	}
 
-	if statusCode != protocol.StatusSuccess {
-		return &protocol.ProtocolError{StatusCode: statusCode}
+	if onChunk != nil {
+		onChunk(chunks, chunks)
 	}
 
 	return nil
 }
 
-// verifyRow verifies a programmed row's checksum.
-func (p *Programmer) verifyRow(ctx context.Context, row *cyacd.Row) error {
-	cmd, err := protocol.BuildVerifyRowCmd(row.ArrayID, row.RowNum)
+// checkProgramRowResponse parses and checks the response to a Program Row command.
+func (p *Programmer) checkProgramRowResponse(response []byte) error {
+	statusCode, _, err := p.parseResponse(response)
 	if err != nil {
 		return err
 	}
 
-	response, err := p.sendCommandWithResponse(ctx, cmd)
-	if err != nil {
-		return err
+	if statusCode != protocol.StatusSuccess {
+		return &protocol.ProtocolError{StatusCode: statusCode}
 	}
 
-	statusCode, data, err := protocol.ParseResponse(response)
-	if err != nil {
-		return err
+	return nil
+}
+
+// chunkCount returns the number of packets needed to program row:
+// one per Send Data chunk plus the final Program Row command.
+func (p *Programmer) chunkCount(row *cyacd.Row) int {
+	end := p.sendDataEnd(int(row.Size), len(row.Data), protocol.SendDataOverhead)
+	return 1 + (end+p.chunkSize-1)/p.chunkSize
+}
+
+// sendDataEnd returns how many leading bytes of a length-byte payload are sent
+// with Send Data before the final command, which carries the rest (at least
+// one byte). Chunks are sent while size bytes from the current offset plus the
+// final command's overhead would exceed the packet size; with large (e.g.
+// negotiated) chunk sizes this ends early once only the kept-back byte remains.
+func (p *Programmer) sendDataEnd(size, length, overhead int) int {
+	offset := 0
+	for size-offset+overhead > protocol.MaxPacketSize && offset < length-1 {
+		offset += min(p.chunkSize, length-offset-1)
 	}
+	return offset
+}
 
-	if statusCode != protocol.StatusSuccess {
-		return &protocol.ProtocolError{
-			Operation:  "verify row",
-			StatusCode: statusCode,
-		}
+// VerifyRow returns the checksum the bootloader computes for a programmed flash row.
+// The checksum covers the row data plus its array ID, row number, and size, so it
+// can be compared with protocol.CalculateRowChecksumWithMetadata for the expected row.
+// The device must already be in bootloader mode (see EnterBootloader).
+//
+// Example:
+//
+//	checksum, err := prog.VerifyRow(ctx, row.ArrayID, row.RowNum)
+//	expected := protocol.CalculateRowChecksumWithMetadata(row.Checksum, row.ArrayID, row.RowNum, uint16(len(row.Data)))
+//	if err == nil && checksum != expected {
+//	    log.Printf("row %d differs from the image", row.RowNum)
+//	}
+func (p *Programmer) VerifyRow(ctx context.Context, arrayID uint8, rowNum uint16) (byte, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return 0, err
 	}
+	defer finish()
+
+	return p.rowChecksum(ctx, arrayID, rowNum)
+}
 
-	deviceChecksum, err := protocol.ParseVerifyRowResponse(data, p.config.LenientVerifyRow)
+// verifyRow verifies a programmed row's checksum.
+// Returns the checksum reported by the device.
+func (p *Programmer) verifyRow(ctx context.Context, row *cyacd.Row) (byte, error) {
+	deviceChecksum, err := p.rowChecksum(ctx, row.ArrayID, row.RowNum)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Calculate expected checksum: the device verifies checksum WITH metadata
@@ -291,64 +958,158 @@ func (p *Programmer) verifyRow(ctx context.Context, row *cyacd.Row) error {
 		uint16(len(row.Data)),
 	)
 	if deviceChecksum != expectedChecksum {
-		return &ChecksumMismatchError{
+		return deviceChecksum, &ChecksumMismatchError{
 			RowNum:   row.RowNum,
 			Expected: expectedChecksum,
 			Actual:   deviceChecksum,
 		}
 	}
 
-	return nil
+	return deviceChecksum, nil
 }
 
-// sendData sends a data chunk using the Send Data command.
-// It waits for and validates the response to ensure the bootloader is synchronized.
-func (p *Programmer) sendData(ctx context.Context, data []byte) error {
-	cmd, err := protocol.BuildSendDataCmd(data)
-	if err != nil {
-		return err
-	}
+// rowChecksum implements VerifyRow within an operation already in progress.
+func (p *Programmer) rowChecksum(ctx context.Context, arrayID uint8, rowNum uint16) (byte, error) {
+	cmd := protocol.AppendVerifyRowCmd(p.txBuf[:0], arrayID, rowNum)
+	p.txBuf = cmd
 
 	response, err := p.sendCommandWithResponse(ctx, cmd)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Parse and check response
-	statusCode, _, err := protocol.ParseResponse(response)
+	statusCode, data, err := p.parseResponse(response)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if statusCode != protocol.StatusSuccess {
-		return &protocol.ProtocolError{
-			Operation:  "send data",
+		return 0, &protocol.ProtocolError{
+			Operation:  "verify row",
 			StatusCode: statusCode,
 		}
 	}
 
-	return nil
+	return protocol.ParseVerifyRowResponse(data, p.config.LenientVerifyRow)
 }
 
-// EnterBootloader sends the Enter Bootloader command with the specified key.
-// Returns device identification information.
-//
-// Example:
-//
-//	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
-//	info, err := prog.EnterBootloader(ctx, key)
-func (p *Programmer) EnterBootloader(ctx context.Context, key []byte) (*protocol.DeviceInfo, error) {
-	cmd, err := protocol.BuildEnterBootloaderCmd(key)
-	if err != nil {
-		return nil, err
+// sendDataChunks sends data with Send Data commands of at most the chunk size,
+// pipelining them when WithPipelining is set. onChunk (optional) is called after
+// each chunk is acknowledged, with the number of chunks acknowledged so far and
+// chunks, the total for the row.
+func (p *Programmer) sendDataChunks(ctx context.Context, data []byte, chunks int, onChunk func(chunk, chunks int)) error {
+	if window := p.pipelineWindow(); window > 1 && len(data) > p.chunkSize {
+		return p.sendDataPipelined(ctx, data, window, chunks, onChunk)
 	}
 
-	response, err := p.sendCommandWithResponse(ctx, cmd)
-	if err != nil {
-		return nil, err
+	chunk := 0
+	for offset := 0; offset < len(data); {
+		// Stop between chunks rather than after the whole row on slow links
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("canceled: %w", err)
+		}
+
+		n := min(p.chunkSize, len(data)-offset)
+		if err := p.sendData(ctx, data[offset:offset+n]); err != nil {
+			return fmt.Errorf("send data chunk: %w", err)
+		}
+		offset += n
+
+		chunk++
+		if onChunk != nil {
+			onChunk(chunk, chunks)
+		}
+	}
+
+	return nil
+}
+
+// sendData sends a data chunk using the Send Data command.
+// It waits for and validates the response to ensure the bootloader is synchronized.
+func (p *Programmer) sendData(ctx context.Context, data []byte) error {
+	cmd, err := protocol.AppendSendDataCmd(p.txBuf[:0], data)
+	if err != nil {
+		return err
+	}
+	p.txBuf = cmd
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	return p.checkSendDataResponse(response)
+}
+
+// checkSendDataResponse parses and checks the response to a Send Data command.
+func (p *Programmer) checkSendDataResponse(response []byte) error {
+	statusCode, _, err := p.parseResponse(response)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != protocol.StatusSuccess {
+		return &protocol.ProtocolError{
+			Operation:  "send data",
+			StatusCode: statusCode,
+		}
+	}
+
+	return nil
+}
+
+// EnterBootloader sends the Enter Bootloader command with the specified key.
+// Returns device identification information.
+//
+// The key is never logged, and internal frame buffers holding it are zeroed once
+// sent. The caller's key slice is not modified; wiping it is the caller's job.
+//
+// Example:
+//
+//	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+//	info, err := prog.EnterBootloader(ctx, key)
+func (p *Programmer) EnterBootloader(ctx context.Context, key []byte) (*protocol.DeviceInfo, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	return p.enterBootloader(ctx, key)
+}
+
+// enterBootloader implements EnterBootloader within an operation already in progress.
+func (p *Programmer) enterBootloader(ctx context.Context, key []byte) (*protocol.DeviceInfo, error) {
+	p.InvalidateCaches()
+	if err := p.resetTarget(ctx); err != nil {
+		return nil, err
 	}
 
-	statusCode, data, err := protocol.ParseResponse(response)
+	info, err := p.retryEntry(ctx, func() (*protocol.DeviceInfo, error) {
+		return p.sendEnterBootloader(ctx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.applyDeviceProfile(info)
+	return info, nil
+}
+
+// sendEnterBootloader sends Enter Bootloader once.
+func (p *Programmer) sendEnterBootloader(ctx context.Context, key []byte) (*protocol.DeviceInfo, error) {
+	cmd, err := protocol.BuildEnterBootloaderCmd(key)
+	if err != nil {
+		return nil, err
+	}
+	// The frame holds a copy of the key; wipe it once sent
+	defer clear(cmd)
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, data, err := p.parseResponse(response)
 	if err != nil {
 		return nil, err
 	}
@@ -366,18 +1127,115 @@ func (p *Programmer) EnterBootloader(ctx context.Context, key []byte) (*protocol
 // ExitBootloader sends the Exit Bootloader command.
 // The bootloader will verify the application and reset the device.
 func (p *Programmer) ExitBootloader(ctx context.Context) error {
-	cmd, err := protocol.BuildExitBootloaderCmd()
+	ctx, finish, err := p.beginOperation(ctx)
 	if err != nil {
 		return err
 	}
+	defer finish()
 
-	// Exit bootloader may not send a response (device resets)
-	_ = p.sendCommand(ctx, cmd)
-	return nil
+	return p.exitBootloader(ctx)
+}
+
+// exitBootloader implements ExitBootloader within an operation already in progress.
+func (p *Programmer) exitBootloader(ctx context.Context) error {
+	_, err := p.exitBootloaderAck(ctx)
+	return err
+}
+
+// exitBootloaderAck sends Exit Bootloader, handling the response as selected
+// with WithExitResponseExpected, and reports whether it was acknowledged.
+func (p *Programmer) exitBootloaderAck(ctx context.Context) (bool, error) {
+	p.InvalidateCaches()
+	cmd, err := protocol.BuildExitBootloaderCmd()
+	if err != nil {
+		return false, err
+	}
+
+	mode := p.config.ExitResponse
+	if mode == ExitNoResponse {
+		// The device resets without responding and may drop off the bus while
+		// the command is written
+		if err := p.sendCommand(ctx, cmd); err != nil {
+			p.logDebug("exit bootloader write failed", "error", err)
+		}
+		return false, nil
+	}
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		if mode == ExitResponseOptional && ctx.Err() == nil {
+			p.logDebug("no response to exit bootloader", "error", err)
+			return false, nil
+		}
+		return false, err
+	}
+
+	statusCode, _, err := p.parseResponse(response)
+	if err != nil {
+		return false, err
+	}
+	if statusCode != protocol.StatusSuccess {
+		return false, &protocol.ProtocolError{
+			Operation:  "exit bootloader",
+			StatusCode: statusCode,
+		}
+	}
+	return true, nil
 }
 
 // GetFlashSize queries the valid flash row range for the specified array.
+//
+// The range is cached per array until the bootloader is entered or exited
+// again: only the first call for an array sends Get Flash Size, and later
+// calls (and operations such as Program) return the cached range without
+// contacting the device, so they cannot fail with a timeout or a protocol
+// error. Call InvalidateCaches to query the device again.
 func (p *Programmer) GetFlashSize(ctx context.Context, arrayID byte) (*protocol.FlashSize, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	return p.getFlashSize(ctx, arrayID)
+}
+
+// getFlashSize implements GetFlashSize within an operation already in progress.
+func (p *Programmer) getFlashSize(ctx context.Context, arrayID byte) (*protocol.FlashSize, error) {
+	p.opMu.Lock()
+	cached, ok := p.flashSizes[arrayID]
+	p.opMu.Unlock()
+	if ok {
+		return &cached, nil
+	}
+
+	flashSize, err := p.queryFlashSize(ctx, arrayID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.opMu.Lock()
+	if p.flashSizes == nil {
+		p.flashSizes = make(map[byte]protocol.FlashSize)
+	}
+	p.flashSizes[arrayID] = *flashSize
+	p.opMu.Unlock()
+	return flashSize, nil
+}
+
+// InvalidateCaches discards the flash ranges cached by GetFlashSize, for
+// long-lived sessions in which the bootloader may have been replaced or the
+// device reset behind the Programmer's back. The caches are also discarded
+// whenever the bootloader is entered or exited. It may be called
+// concurrently with an operation.
+func (p *Programmer) InvalidateCaches() {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	p.flashSizes = nil
+}
+
+// queryFlashSize sends Get Flash Size, bypassing the cache.
+func (p *Programmer) queryFlashSize(ctx context.Context, arrayID byte) (*protocol.FlashSize, error) {
 	cmd, err := protocol.BuildGetFlashSizeCmd(arrayID)
 	if err != nil {
 		return nil, err
@@ -388,7 +1246,7 @@ func (p *Programmer) GetFlashSize(ctx context.Context, arrayID byte) (*protocol.
 		return nil, err
 	}
 
-	statusCode, data, err := protocol.ParseResponse(response)
+	statusCode, data, err := p.parseResponse(response)
 	if err != nil {
 		return nil, err
 	}
@@ -403,9 +1261,215 @@ func (p *Programmer) GetFlashSize(ctx context.Context, arrayID byte) (*protocol.
 	return protocol.ParseGetFlashSizeResponse(data)
 }
 
+// Ping checks that the bootloader is responsive and measures the round-trip latency.
+// It sends a lightweight Get Flash Size query for array 0, which every bootloader
+// answers without side effects, making it suitable for pre-flight checks and monitoring.
+//
+// The device must already be in bootloader mode (see EnterBootloader).
+//
+// Example:
+//
+//	rtt, err := prog.Ping(ctx)
+//	if err != nil {
+//	    log.Fatalf("bootloader not responding: %v", err)
+//	}
+//	fmt.Printf("bootloader responded in %s\n", rtt)
+func (p *Programmer) Ping(ctx context.Context) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("canceled: %w", err)
+	}
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer finish()
+
+	start := p.clock.Now()
+	if _, err := p.queryFlashSize(ctx, 0); err != nil {
+		return 0, fmt.Errorf("ping: %w", err)
+	}
+	rtt := p.clock.Since(start)
+
+	p.logDebug("ping", "duration", rtt.String())
+
+	return rtt, nil
+}
+
+// GetMetadata reads the metadata of the specified application.
+// Single-application bootloaders use application number 0.
+func (p *Programmer) GetMetadata(ctx context.Context, appNum byte) (*protocol.Metadata, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	return p.getMetadata(ctx, appNum)
+}
+
+// getMetadata implements GetMetadata within an operation already in progress.
+func (p *Programmer) getMetadata(ctx context.Context, appNum byte) (*protocol.Metadata, error) {
+	cmd, err := protocol.BuildGetMetadataCmd(appNum)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, data, err := p.parseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != protocol.StatusSuccess {
+		return nil, &protocol.ProtocolError{
+			Operation:  "get metadata",
+			StatusCode: statusCode,
+		}
+	}
+
+	return protocol.ParseGetMetadataResponse(data)
+}
+
+// GetAppStatus returns the status of the specified application.
+// Only supported by multi-application (dual-image) bootloaders.
+func (p *Programmer) GetAppStatus(ctx context.Context, appNum byte) (*protocol.AppStatus, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	return p.getAppStatus(ctx, appNum)
+}
+
+// getAppStatus implements GetAppStatus within an operation already in progress.
+func (p *Programmer) getAppStatus(ctx context.Context, appNum byte) (*protocol.AppStatus, error) {
+	cmd, err := protocol.BuildGetAppStatusCmd(appNum)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, data, err := p.parseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != protocol.StatusSuccess {
+		return nil, &protocol.ProtocolError{
+			Operation:  "get app status",
+			StatusCode: statusCode,
+		}
+	}
+
+	return protocol.ParseGetAppStatusResponse(data)
+}
+
+// EraseRow erases a single flash row.
+// Rows configured with WithProtectedRows are refused with a *ProtectedRowError.
+func (p *Programmer) EraseRow(ctx context.Context, arrayID uint8, rowNum uint16) error {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	return p.eraseRow(ctx, arrayID, rowNum)
+}
+
+// eraseRow implements EraseRow within an operation already in progress.
+func (p *Programmer) eraseRow(ctx context.Context, arrayID uint8, rowNum uint16) error {
+	if err := p.checkProtected(arrayID, rowNum); err != nil {
+		return err
+	}
+
+	cmd, err := protocol.BuildEraseRowCmd(arrayID, rowNum)
+	if err != nil {
+		return err
+	}
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	statusCode, _, err := p.parseResponse(response)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != protocol.StatusSuccess {
+		return &protocol.ProtocolError{
+			Operation:  "erase row",
+			StatusCode: statusCode,
+		}
+	}
+
+	return nil
+}
+
+// SetActiveApp marks the specified application as active.
+// Only supported by multi-application (dual-image) bootloaders.
+func (p *Programmer) SetActiveApp(ctx context.Context, appNum byte) error {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	return p.setActiveApp(ctx, appNum)
+}
+
+// setActiveApp implements SetActiveApp within an operation already in progress.
+func (p *Programmer) setActiveApp(ctx context.Context, appNum byte) error {
+	cmd, err := protocol.BuildSetActiveAppCmd(appNum)
+	if err != nil {
+		return err
+	}
+
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	statusCode, _, err := p.parseResponse(response)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != protocol.StatusSuccess {
+		return &protocol.ProtocolError{
+			Operation:  "set active app",
+			StatusCode: statusCode,
+		}
+	}
+
+	return nil
+}
+
 // VerifyChecksum verifies the entire application checksum.
 // Returns true if the application checksum is valid, false otherwise.
 func (p *Programmer) VerifyChecksum(ctx context.Context) (bool, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer finish()
+
+	return p.verifyChecksum(ctx)
+}
+
+// verifyChecksum implements VerifyChecksum within an operation already in progress.
+func (p *Programmer) verifyChecksum(ctx context.Context) (bool, error) {
 	cmd, err := protocol.BuildVerifyChecksumCmd()
 	if err != nil {
 		return false, err
@@ -416,7 +1480,7 @@ func (p *Programmer) VerifyChecksum(ctx context.Context) (bool, error) {
 		return false, err
 	}
 
-	statusCode, data, err := protocol.ParseResponse(response)
+	statusCode, data, err := p.parseResponse(response)
 	if err != nil {
 		return false, err
 	}
@@ -442,98 +1506,330 @@ func (p *Programmer) VerifyChecksum(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
+// SendCommand sends an arbitrary command and returns the raw response status and data.
+// It is an escape hatch for vendor-extended bootloaders: the frame is built and sent
+// with the same framing, command delay, HID report handling, and rate limiting as the
+// standard commands, and transient transport errors are retried up to Config.Retries
+// times after resynchronizing the bootloader.
+//
+// A non-success status is not treated as an error; interpreting status and data is
+// left to the caller. The device should be in bootloader mode (see Connect).
+//
+// Example:
+//
+//	status, data, err := prog.SendCommand(ctx, 0x50, []byte{0x01})
+//	if err == nil && status != protocol.StatusSuccess {
+//	    log.Printf("vendor command failed with status 0x%02X", status)
+//	}
+func (p *Programmer) SendCommand(ctx context.Context, cmd byte, payload []byte) (byte, []byte, error) {
+	frame, err := protocol.BuildCommand(cmd, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer clear(frame)
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer finish()
+
+	for attempt := 0; ; attempt++ {
+		var response []byte
+		response, err = p.sendCommandWithResponse(ctx, frame)
+		if err == nil {
+			var status byte
+			var data []byte
+			status, data, err = p.parseResponse(response)
+			if err == nil {
+				// data points into the reused receive buffer
+				return status, append([]byte(nil), data...), nil
+			}
+		}
+
+		if attempt >= p.config.Retries || !IsRetryable(err) || ctx.Err() != nil {
+			return 0, nil, fmt.Errorf("command 0x%02X: %w", cmd, err)
+		}
+
+		p.logDebug("retrying command", "cmd", fmt.Sprintf("0x%02X", cmd), "attempt", attempt+2, "error", err)
+
+		if err := p.resync(ctx); err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
 // sendCommand sends a command and expects no response (fire-and-forget).
 func (p *Programmer) sendCommand(ctx context.Context, cmd []byte) error {
-	if _, err := p.device.Write(cmd); err != nil {
+	start := p.clock.Now()
+	_, err := p.write(ctx, cmd)
+	p.stats.recordCommand(cmd, p.clock.Since(start), 0, err)
+	if err != nil {
 		return err
 	}
 
 	// Apply inter-command delay if configured
-	if p.config.CommandDelay > 0 {
-		time.Sleep(p.config.CommandDelay)
-	}
-
-	return nil
+	return p.clock.Sleep(ctx, p.commandDelay)
 }
 
 // sendCommandWithResponse sends a command and waits for a response.
 // Handles HID packet padding and report IDs by extracting only the actual protocol frame.
 func (p *Programmer) sendCommandWithResponse(ctx context.Context, cmd []byte) ([]byte, error) {
+	start := p.clock.Now()
+
 	// Write command
-	if _, err := p.device.Write(cmd); err != nil {
+	if _, err := p.write(ctx, cmd); err != nil {
+		p.stats.recordCommand(cmd, p.clock.Since(start), 0, err)
 		return nil, fmt.Errorf("write command: %w", err)
 	}
 
 	// Apply inter-command delay if configured
-	if p.config.CommandDelay > 0 {
-		time.Sleep(p.config.CommandDelay)
+	if err := p.clock.Sleep(ctx, p.commandDelay); err != nil {
+		return nil, err
 	}
 
-	// Read response (HID devices may return fixed-size packets like 64 bytes)
-	response := make([]byte, protocol.DefaultResponseBufferSize)
-	n, err := p.device.Read(response)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
+	response, err := p.readFrame(ctx)
+	p.stats.recordCommand(cmd, p.clock.Since(start), len(response), err)
+	return response, err
+}
 
-	// Extract the actual protocol frame from the HID packet
-	// Frame format: [SOP][STATUS][LEN_L][LEN_H][DATA...][CHECKSUM_L][CHECKSUM_H][EOP]
-	// Some HID devices prepend a Report ID byte (often 0x00), so we need to detect and skip it
-	if n < protocol.MinFrameSize {
-		return nil, fmt.Errorf("response too short: got %d bytes, minimum is %d", n, protocol.MinFrameSize)
+// readFrame reads one response frame from the device.
+//
+// The frame may arrive in a single read (HID devices return fixed-size packets
+// like 64 bytes, possibly with a report ID and padding) or spread across many
+// reads (UART transports may deliver it byte by byte). Reads are accumulated
+// until the complete frame, as declared by its length field, has been received
+// or the read timeout expires.
+func (p *Programmer) readFrame(ctx context.Context) ([]byte, error) {
+	// Plain readers are checked against the deadline between reads; a timeout
+	// context (which allocates) is only needed to interrupt a ContextReader
+	var deadline time.Time
+	if p.config.ReadTimeout > 0 {
+		deadline = p.clock.Now().Add(p.config.ReadTimeout)
+		if _, ok := p.device.(ContextReader); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.config.ReadTimeout)
+			defer cancel()
+		}
 	}
 
-	// Detect HID Report ID: if byte 0 is not SOP but byte 1 is, then byte 0 is a report ID
-	offset := 0
-	if response[0] != protocol.StartOfPacket && n > protocol.MinFrameSize && response[1] == protocol.StartOfPacket {
-		// HID Report ID detected at byte 0, skip it
-		offset = 1
-		p.logDebug("HID report ID detected", "report_id", fmt.Sprintf("0x%02X", response[0]))
+	if p.rxBuf == nil {
+		p.rxBuf = make([]byte, protocol.DefaultResponseBufferSize)
 	}
+	response := p.rxBuf
 
-	// Validate start of packet
-	if response[offset] != protocol.StartOfPacket {
-		return nil, fmt.Errorf("invalid start of packet: got 0x%02X, expected 0x%02X", response[offset], protocol.StartOfPacket)
-	}
+	// A previous pipelined read may already have received (part of) this frame
+	n := copy(response, p.rxPending)
+	p.rxPending = p.rxPending[:0]
 
-	// Read data length from frame (bytes 2-3 after offset, little-endian)
-	dataLen := uint16(response[offset+2]) | uint16(response[offset+3])<<8
+	// offset is the position of SOP in the response (-1 until known)
+	// Frame format: [SOP][STATUS][LEN_L][LEN_H][DATA...][CHECKSUM_L][CHECKSUM_H][EOP]
+	offset := -1
+	frameSize := 0
+
+	for pending := n > 0; ; pending = false {
+		if !pending {
+			read, err := p.read(ctx, response[n:])
+			n += read
+			if err != nil {
+				return nil, readError(n, err)
+			}
+		}
 
-	// Calculate actual frame size
-	frameSize := int(protocol.MinFrameSize + dataLen)
+		// Locate the start of packet.
+		// Some HID devices prepend a Report ID byte (often 0x00), so we need to detect and skip it:
+		// if byte 0 is not SOP but byte 1 is, then byte 0 is a report ID
+		if offset < 0 && n > 0 {
+			if response[0] == protocol.StartOfPacket {
+				offset = 0
+			} else if n > 1 {
+				if response[1] != protocol.StartOfPacket {
+					return nil, &protocol.FrameError{Reason: fmt.Sprintf("invalid start of packet: got 0x%02X, expected 0x%02X", response[0], protocol.StartOfPacket)}
+				}
+				offset = 1
+				p.logDebug("HID report ID detected", "report_id", fmt.Sprintf("0x%02X", response[0]))
+			}
+		}
+
+		// Read data length from frame (bytes 2-3 after offset, little-endian)
+		if offset >= 0 && frameSize == 0 && n >= offset+4 {
+			dataLen := uint16(response[offset+2]) | uint16(response[offset+3])<<8
+			frameSize = int(protocol.MinFrameSize + dataLen)
+
+			if offset+frameSize > len(response) {
+				return nil, &protocol.FrameError{Reason: fmt.Sprintf("response frame too large: %d bytes declared, buffer is %d", frameSize, len(response)-offset)}
+			}
+		}
 
-	// Ensure we have enough data
-	if n < offset+frameSize {
-		return nil, fmt.Errorf("incomplete frame: got %d bytes, expected %d (with offset %d)", n, offset+frameSize, offset)
+		if frameSize > 0 && n >= offset+frameSize {
+			break
+		}
+
+		err := ctx.Err()
+		if err == nil && !deadline.IsZero() && p.clock.Now().After(deadline) {
+			err = context.DeadlineExceeded
+		}
+		if err != nil {
+			return nil, readError(n, err)
+		}
 	}
 
 	// Validate end of packet
 	if response[offset+frameSize-1] != protocol.EndOfPacket {
-		return nil, fmt.Errorf("invalid end of packet at position %d: got 0x%02X, expected 0x%02X",
-			offset+frameSize-1, response[offset+frameSize-1], protocol.EndOfPacket)
+		return nil, &protocol.FrameError{Reason: fmt.Sprintf("invalid end of packet at position %d: got 0x%02X, expected 0x%02X",
+			offset+frameSize-1, response[offset+frameSize-1], protocol.EndOfPacket)}
+	}
+
+	// Stream transports may deliver the next pipelined response in the same
+	// read; keep it, skipping any HID padding in between
+	if p.pipelined {
+		rest := response[offset+frameSize : n]
+		if i := bytes.IndexByte(rest, protocol.StartOfPacket); i >= 0 {
+			p.rxPending = append(p.rxPending, rest[i:]...)
+		}
 	}
 
 	// Return only the actual protocol frame (not the report ID or HID padding)
-	return response[offset : offset+frameSize], nil
+	frame := response[offset : offset+frameSize]
+	p.logFrame("frame received", frame)
+	p.captureFrame(pcapng.Inbound, frame)
+	return frame, nil
 }
 
-// reportProgress calls the progress callback if configured.
+// readError wraps an error that ended the read of a response after n bytes,
+// as a *TimeoutError if the response timed out and as an *IOError otherwise.
+func readError(n int, err error) error {
+	op := "read response"
+	if n > 0 {
+		op = fmt.Sprintf("read response: incomplete frame after %d bytes", n)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	return &IOError{Op: op, Err: err}
+}
+
+// reportProgress calls the progress callback if configured, unless the report
+// is throttled (see WithProgressInterval and WithMinProgressDelta).
 func (p *Programmer) reportProgress(progress Progress) {
-	if p.config.ProgressCallback != nil {
-		p.config.ProgressCallback(progress)
+	if progress.Phase != p.phase {
+		old := p.phase
+		p.phase = progress.Phase
+		if p.config.PhaseCallback != nil {
+			p.config.PhaseCallback(old, progress.Phase)
+		}
+	}
+
+	if p.config.ProgressCallback == nil {
+		return
+	}
+	if p.progressHook != nil {
+		progress = p.progressHook(progress)
 	}
+	if p.throttleProgress(progress) {
+		return
+	}
+	p.config.ProgressCallback(progress)
+}
+
+// throttleProgress reports whether progress should be dropped because it
+// follows the last delivered report too closely, and records it otherwise.
+func (p *Programmer) throttleProgress(progress Progress) bool {
+	if p.config.ProgressInterval <= 0 && p.config.MinProgressDelta <= 0 {
+		return false
+	}
+
+	now := p.clock.Now()
+	last := p.lastProgress
+	if p.progressSent && progress.Phase == last.Phase && progress.Step == last.Step &&
+		progress.Percentage < 100 && progress.Percentage >= last.Percentage {
+		if now.Sub(p.lastProgressAt) < p.config.ProgressInterval ||
+			progress.Percentage-last.Percentage < p.config.MinProgressDelta {
+			return true
+		}
+	}
+
+	p.progressSent = true
+	p.lastProgress = progress
+	p.lastProgressAt = now
+	return false
+}
+
+// logs reports whether messages of level are passed to the logger.
+func (p *Programmer) logs(level LogLevel) bool {
+	return p.config.Logger != nil && level >= p.config.LogLevel
 }
 
 // logDebug logs a debug message if a logger is configured.
 func (p *Programmer) logDebug(msg string, keysAndValues ...interface{}) {
-	if p.config.Logger != nil {
+	if p.logs(LogDebug) {
 		p.config.Logger.Debug(msg, keysAndValues...)
 	}
 }
 
 // logInfo logs an info message if a logger is configured.
 func (p *Programmer) logInfo(msg string, keysAndValues ...interface{}) {
-	if p.config.Logger != nil {
+	if p.logs(LogInfo) {
 		p.config.Logger.Info(msg, keysAndValues...)
 	}
 }
+
+// logWarn logs a warning if a logger is configured, at Info level if the
+// logger has no warning level.
+func (p *Programmer) logWarn(msg string, keysAndValues ...interface{}) {
+	if !p.logs(LogWarn) {
+		return
+	}
+	if w, ok := p.config.Logger.(WarnLogger); ok {
+		w.Warn(msg, keysAndValues...)
+	} else {
+		p.config.Logger.Info(msg, keysAndValues...)
+	}
+}
+
+// logFrame logs a frame at debug level if frame logging is enabled.
+func (p *Programmer) logFrame(msg string, frame []byte) {
+	if !p.config.FrameLogging || !p.logs(LogDebug) {
+		return
+	}
+	p.config.Logger.Debug(msg,
+		"frame", protocol.FormatFrame(frame, p.checksumType),
+		"bytes", fmt.Sprintf("% X", protocol.RedactFrame(frame)),
+	)
+}
+
+// captureFrame records a frame in the capture, if one is configured.
+func (p *Programmer) captureFrame(dir pcapng.Direction, frame []byte) {
+	if p.config.Capture == nil || p.captureOff {
+		return
+	}
+	if p.capture == nil {
+		name := p.config.DeviceID
+		if name == "" {
+			name = "bootloader"
+		}
+		iface, err := p.config.Capture.Interface(name)
+		if err != nil {
+			p.logError("capture write failed", "error", err)
+			p.captureOff = true
+			return
+		}
+		p.capture = iface
+	}
+	redacted := protocol.RedactFrame(frame)
+	if !bytes.Equal(redacted, frame) {
+		// Keep the redacted frame valid for dissectors
+		_ = protocol.SetPacketChecksum(redacted, p.checksumType)
+	}
+	if err := p.capture.WriteFrame(p.clock.Now(), dir, redacted); err != nil {
+		p.logError("capture write failed", "error", err)
+		p.captureOff = true
+	}
+}
+
+// logError logs an error message if a logger is configured.
+func (p *Programmer) logError(msg string, keysAndValues ...interface{}) {
+	if p.logs(LogError) {
+		p.config.Logger.Error(msg, keysAndValues...)
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/moffa90/go-cyacd/bootloadertest"
 	"github.com/moffa90/go-cyacd/cyacd"
 	"github.com/moffa90/go-cyacd/protocol"
 )
@@ -125,6 +128,16 @@ func (l *MockLogger) Error(msg string, kv ...interface{}) {
 	l.errorMsgs = append(l.errorMsgs, msg)
 }
 
+// warnLogger records warnings in addition to the MockLogger levels
+type warnLogger struct {
+	MockLogger
+	warnMsgs []string
+}
+
+func (l *warnLogger) Warn(msg string, kv ...interface{}) {
+	l.warnMsgs = append(l.warnMsgs, msg)
+}
+
 func TestNew(t *testing.T) {
 	device := NewMockDevice()
 
@@ -165,6 +178,60 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewProgrammer(t *testing.T) {
+	device := NewMockDevice()
+
+	if _, err := NewProgrammer(device, WithChunkSize(64), WithRetries(5)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewProgrammer(nil); err == nil {
+		t.Error("expected an error for a nil device")
+	}
+
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"zero chunk size", []Option{WithChunkSize(0)}},
+		{"chunk size too large", []Option{WithChunkSize(MaxChunkSize + 1)}},
+		{"negative retries", []Option{WithRetries(-1)}},
+		{"negative command delay", []Option{WithCommandDelay(-time.Millisecond)}},
+		{"unknown checksum type", []Option{WithChecksumType(0x07)}},
+		{"negative packet size", []Option{WithWritePacketSize(-1)}},
+		{"negative rate", []Option{WithMaxBytesPerSecond(-1)}},
+		{"negative verify interval", []Option{WithVerifyEvery(-1)}},
+		{"negative pipeline window", []Option{WithPipelining(-1)}},
+		{"pipeline window too large", []Option{WithPipelining(MaxPipelineWindow + 1)}},
+		{"negative coalescing MTU", []Option{WithCoalescedWrites(-1)}},
+		{"chunk exceeds packet", []Option{WithHIDReportID(0), WithWritePacketSize(64), WithChunkSize(57)}},
+		{"two journals", []Option{WithJournal(io.Discard), WithJournalFile("update.journal")}},
+		{"wait without exit", []Option{WithSkipExit(), WithWaitForApplication(func(context.Context) error { return nil }, 0)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := NewProgrammer(device, tt.options...)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("error = %v, want ErrInvalidOption", err)
+			}
+			if prog != nil {
+				t.Error("NewProgrammer returned a Programmer with an error")
+			}
+
+			// New keeps ignoring bad values
+			if New(device, tt.options...) == nil {
+				t.Error("New() returned nil")
+			}
+		})
+	}
+
+	// Every problem is reported
+	_, err := NewProgrammer(device, WithChunkSize(0), WithRetries(-1))
+	if err == nil || !strings.Contains(err.Error(), "chunk size") || !strings.Contains(err.Error(), "retries") {
+		t.Errorf("error = %v, want both problems", err)
+	}
+}
+
 func TestEnterBootloader(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -244,6 +311,35 @@ func TestExitBootloader(t *testing.T) {
 	}
 }
 
+func TestExitResponseExpected(t *testing.T) {
+	fw := journalFirmware()
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	ctx := context.Background()
+
+	// A device that acknowledges Exit Bootloader
+	for _, mode := range []ExitResponse{ExitResponseOptional, ExitResponseRequired} {
+		prog := New(bootloadertest.NewDevice(bootloadertest.WithExitAck()), WithExitResponseExpected(mode))
+		report, err := prog.ProgramWithReport(ctx, fw, key)
+		if err != nil || !report.ExitAcknowledged {
+			t.Errorf("mode %d: err = %v, ExitAcknowledged = %t", mode, err, report.ExitAcknowledged)
+		}
+	}
+
+	// A device that resets at once
+	prog := New(bootloadertest.NewDevice(), WithExitResponseExpected(ExitResponseOptional), WithReadTimeout(10*time.Millisecond))
+	if report, err := prog.ProgramWithReport(ctx, fw, key); err != nil || report.ExitAcknowledged {
+		t.Errorf("optional without response: err = %v, ExitAcknowledged = %t", err, report.ExitAcknowledged)
+	}
+	prog = New(bootloadertest.NewDevice(), WithExitResponseExpected(ExitResponseRequired), WithReadTimeout(10*time.Millisecond), WithRetries(0))
+	if _, err := prog.ProgramWithReport(ctx, fw, key); err == nil {
+		t.Error("required without response: expected an error")
+	}
+
+	if _, err := NewProgrammer(bootloadertest.NewDevice(), WithExitResponseExpected(ExitResponse(7))); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("unknown mode: err = %v, want ErrInvalidOption", err)
+	}
+}
+
 func TestGetFlashSize(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -274,29 +370,560 @@ func TestGetFlashSize(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			device := NewMockDevice()
-			device.AddResponse(tt.statusCode, tt.data)
-
-			prog := New(device)
-			size, err := prog.GetFlashSize(context.Background(), tt.arrayID)
+			device := NewMockDevice()
+			device.AddResponse(tt.statusCode, tt.data)
+
+			prog := New(device)
+			size, err := prog.GetFlashSize(context.Background(), tt.arrayID)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if size.StartRow != tt.wantStart {
+				t.Errorf("StartRow = %d, want %d", size.StartRow, tt.wantStart)
+			}
+
+			if size.EndRow != tt.wantEnd {
+				t.Errorf("EndRow = %d, want %d", size.EndRow, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode byte
+		data       []byte
+		wantErr    bool
+	}{
+		{
+			name:       "responsive bootloader",
+			statusCode: protocol.StatusSuccess,
+			data:       []byte{0x00, 0x00, 0xFF, 0x01},
+			wantErr:    false,
+		},
+		{
+			name:       "bootloader error",
+			statusCode: protocol.ErrUnknown,
+			data:       nil,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := NewMockDevice()
+			device.AddResponse(tt.statusCode, tt.data)
+
+			prog := New(device)
+			rtt, err := prog.Ping(context.Background())
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if rtt < 0 {
+				t.Errorf("rtt = %v, want >= 0", rtt)
+			}
+
+			if device.writeBuf.Bytes()[1] != protocol.CmdGetFlashSize {
+				t.Errorf("command = 0x%02X, want 0x%02X", device.writeBuf.Bytes()[1], protocol.CmdGetFlashSize)
+			}
+		})
+	}
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		prog := New(NewMockDevice())
+		if _, err := prog.Ping(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	})
+}
+
+// flushingDevice is a MockDevice that records ResetInputBuffer calls
+type flushingDevice struct {
+	*MockDevice
+	flushes int
+}
+
+func (d *flushingDevice) ResetInputBuffer() error {
+	d.flushes++
+	return nil
+}
+
+// signalLogger closes aborted when the programmer logs an abort
+type signalLogger struct {
+	MockLogger
+	aborted chan struct{}
+}
+
+func (l *signalLogger) Info(msg string, kv ...interface{}) {
+	if msg == "aborted in-flight operation" {
+		close(l.aborted)
+	}
+}
+
+func TestConcurrentOperationBusy(t *testing.T) {
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+	device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0000, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	var busyErrs []error
+	var prog *Programmer
+	prog = New(device,
+		WithVerifyAfterProgram(false),
+		WithProgressCallback(func(p Progress) {
+			if p.Phase == PhaseProgramming && p.CurrentRow == 0 && len(busyErrs) == 0 {
+				_, metaErr := prog.GetMetadata(context.Background(), 0)
+				progErr := prog.Program(context.Background(), firmware, key)
+				busyErrs = append(busyErrs, metaErr, progErr)
+			}
+		}),
+	)
+
+	if err := prog.Program(context.Background(), firmware, key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(busyErrs) != 2 {
+		t.Fatalf("progress callback ran %d checks, want 2", len(busyErrs))
+	}
+	for _, err := range busyErrs {
+		if !errors.Is(err, ErrBusy) {
+			t.Errorf("concurrent call error = %v, want ErrBusy", err)
+		}
+	}
+
+	// The programmer is usable again once the operation returns
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	if _, err := prog.GetFlashSize(context.Background(), 0); err != nil {
+		t.Errorf("GetFlashSize after Program: %v", err)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	t.Run("raw status and data", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.ErrCommand, []byte{0xCA, 0xFE})
+
+		prog := New(device)
+		status, data, err := prog.SendCommand(context.Background(), 0x50, []byte{0x01, 0x02})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if status != protocol.ErrCommand || !bytes.Equal(data, []byte{0xCA, 0xFE}) {
+			t.Errorf("status = 0x%02X, data = % 02X", status, data)
+		}
+
+		want, _ := protocol.BuildCommand(0x50, []byte{0x01, 0x02})
+		if !bytes.Equal(device.writeBuf.Bytes(), want) {
+			t.Errorf("written = % 02X, want % 02X", device.writeBuf.Bytes(), want)
+		}
+	})
+
+	t.Run("transient error retried", func(t *testing.T) {
+		device := &flakyDevice{MockDevice: NewMockDevice(), failRead: 1}
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+
+		prog := New(device, WithRetries(1))
+		status, data, err := prog.SendCommand(context.Background(), 0x50, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if status != protocol.StatusSuccess || !bytes.Equal(data, []byte{0x01}) {
+			t.Errorf("status = 0x%02X, data = % 02X", status, data)
+		}
+	})
+}
+
+func TestVerifyRow(t *testing.T) {
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, []byte{0x5C})
+	device.AddResponse(protocol.ErrRow, nil)
+
+	prog := New(device)
+	checksum, err := prog.VerifyRow(context.Background(), 0x00, 0x0010)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checksum != 0x5C {
+		t.Errorf("checksum = 0x%02X, want 0x5C", checksum)
+	}
+
+	want, _ := protocol.BuildVerifyRowCmd(0x00, 0x0010)
+	if !bytes.Equal(device.writeBuf.Bytes(), want) {
+		t.Errorf("written = % 02X, want % 02X", device.writeBuf.Bytes(), want)
+	}
+
+	_, err = prog.VerifyRow(context.Background(), 0x00, 0x0FFF)
+	var protoErr *protocol.ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrRow {
+		t.Errorf("error = %v, want ProtocolError with ErrRow", err)
+	}
+}
+
+// cancelingDevice cancels the operation when the first Send Data frame is written
+type cancelingDevice struct {
+	*MockDevice
+	cancel   context.CancelFunc
+	commands []byte
+}
+
+func (d *cancelingDevice) Write(p []byte) (int, error) {
+	d.commands = append(d.commands, p[1])
+	if p[1] == protocol.CmdSendData {
+		d.cancel()
+	}
+	return d.MockDevice.Write(p)
+}
+
+func TestProgramCancelMidRow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	device := &cancelingDevice{MockDevice: NewMockDevice(), cancel: cancel}
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+
+	// 128-byte row: two Send Data chunks and a final Program Row
+	data := bytes.Repeat([]byte{0xA5}, 128)
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0010, Size: 128, Data: data},
+		},
+	}
+
+	err := New(device).Program(ctx, firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+
+	// Stops after the first chunk and resynchronizes instead of finishing the row
+	want := []byte{
+		protocol.CmdEnterBootloader,
+		protocol.CmdGetFlashSize,
+		protocol.CmdSendData,
+		protocol.CmdSyncBootloader,
+	}
+	if !bytes.Equal(device.commands, want) {
+		t.Errorf("commands = % 02X, want % 02X", device.commands, want)
+	}
+}
+
+func TestProgramCancelCause(t *testing.T) {
+	unplugged := errors.New("device unplugged")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	device := &cancelingDevice{MockDevice: NewMockDevice(), cancel: func() { cancel(unplugged) }}
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0010, Size: 128, Data: bytes.Repeat([]byte{0xA5}, 128)},
+		},
+	}
+
+	report, err := New(device).ProgramWithReport(ctx, firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, unplugged) {
+		t.Fatalf("error = %v, want context.Canceled and the cause", err)
+	}
+	if !strings.Contains(err.Error(), "device unplugged") {
+		t.Errorf("error message %q lacks the cause", err)
+	}
+	if report.CancelCause != unplugged || !errors.Is(report.Err, unplugged) {
+		t.Errorf("report: CancelCause %v, Err %v", report.CancelCause, report.Err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"cancel_cause": "device unplugged"`) {
+		t.Errorf("JSON report lacks the cancel cause: %s", buf.String())
+	}
+}
+
+func TestAbort(t *testing.T) {
+	t.Run("idle programmer", func(t *testing.T) {
+		device := &flushingDevice{MockDevice: NewMockDevice()}
+
+		prog := New(device)
+		if err := prog.Abort(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		written := device.writeBuf.Bytes()
+		if len(written) == 0 || written[1] != protocol.CmdSyncBootloader {
+			t.Fatalf("expected Sync Bootloader frame, got % 02X", written)
+		}
+		if device.flushes != 1 {
+			t.Errorf("flushes = %d, want 1", device.flushes)
+		}
+	})
+
+	t.Run("in-flight program", func(t *testing.T) {
+		device := &flushingDevice{MockDevice: NewMockDevice()}
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+
+		firmware := &cyacd.Firmware{
+			SiliconID: 0x1E9602AA,
+			Rows: []*cyacd.Row{
+				{ArrayID: 0x00, RowNum: 0x0000, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+				{ArrayID: 0x00, RowNum: 0x0001, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+			},
+		}
+
+		logger := &signalLogger{aborted: make(chan struct{})}
+		abortErr := make(chan error, 1)
+
+		var prog *Programmer
+		prog = New(device,
+			WithLogger(logger),
+			WithVerifyAfterProgram(false),
+			WithProgressCallback(func(p Progress) {
+				if p.Phase == PhaseProgramming && p.CurrentRow == 1 {
+					go func() { abortErr <- prog.Abort(context.Background()) }()
+					<-logger.aborted
+				}
+			}),
+		)
+
+		err := prog.Program(context.Background(), firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+		if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrAborted) {
+			t.Fatalf("error = %v, want context.Canceled and ErrAborted", err)
+		}
+
+		if err := <-abortErr; err != nil {
+			t.Fatalf("abort error: %v", err)
+		}
+
+		written := device.writeBuf.Bytes()
+		if written[len(written)-protocol.MinFrameSize+1] != protocol.CmdSyncBootloader {
+			t.Errorf("last command is not Sync Bootloader: % 02X", written)
+		}
+		if device.flushes != 1 {
+			t.Errorf("flushes = %d, want 1", device.flushes)
+		}
+	})
+}
+
+func TestGetMetadata(t *testing.T) {
+	data := make([]byte, protocol.GetMetadataResponseSize)
+	binary.LittleEndian.PutUint16(data[22:24], 0x0102) // AppVersion
+
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, data)
+
+	prog := New(device)
+	meta, err := prog.GetMetadata(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if meta.AppVersion != 0x0102 {
+		t.Errorf("AppVersion = 0x%04X, want 0x0102", meta.AppVersion)
+	}
+}
+
+func TestGetAppStatus(t *testing.T) {
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, []byte{0x01, 0x00})
+
+	prog := New(device)
+	status, err := prog.GetAppStatus(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !status.Valid || status.Active {
+		t.Errorf("status = %+v, want valid and inactive", status)
+	}
+}
+
+func TestSetActiveApp(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode byte
+		wantErr    bool
+	}{
+		{name: "success", statusCode: protocol.StatusSuccess, wantErr: false},
+		{name: "invalid application", statusCode: protocol.ErrApp, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := NewMockDevice()
+			device.AddResponse(tt.statusCode, nil)
+
+			prog := New(device)
+			err := prog.SetActiveApp(context.Background(), 1)
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProgramWithRollback(t *testing.T) {
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0100, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("failed update restores active application", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		// App 0 is valid and active
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01, 0x01})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		// Program row fails
+		device.AddResponse(protocol.ErrRow, nil)
+		// Set active app
+		device.AddResponse(protocol.StatusSuccess, nil)
+
+		prog := New(device, WithRollback())
+		report, err := prog.ProgramWithReport(context.Background(), firmware, key)
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		if !report.RollbackPerformed {
+			t.Error("RollbackPerformed = false, want true")
+		}
+		if report.RollbackApp != 0 {
+			t.Errorf("RollbackApp = %d, want 0", report.RollbackApp)
+		}
+
+		written := device.writeBuf.Bytes()
+		last := written[len(written)-protocol.MinFrameSize-1:]
+		if last[1] != protocol.CmdSetActiveApp || last[4] != 0 {
+			t.Errorf("last command = % 02X, want Set Active App 0", last)
+		}
+	})
+
+	t.Run("successful update does not roll back", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		// App 0 inactive, app 1 active
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01, 0x01})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+
+		prog := New(device, WithRollback(), WithVerifyAfterProgram(false))
+		report, err := prog.ProgramWithReport(context.Background(), firmware, key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if report.RollbackPerformed {
+			t.Error("RollbackPerformed = true, want false")
+		}
+		if report.RowsProgrammed != 1 {
+			t.Errorf("RowsProgrammed = %d, want 1", report.RowsProgrammed)
+		}
+	})
+}
+
+func TestProgramWithAppValidation(t *testing.T) {
+	// Metadata row with app ID 0x0102 and app version 0x0304
+	data := make([]byte, 64)
+	data[20], data[21] = 0x02, 0x01
+	data[22], data[23] = 0x04, 0x03
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x01FF, Size: 64, Data: data},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name       string
+		status     []byte
+		appVersion uint16
+		wantErr    bool
+	}{
+		{name: "matching version", status: []byte{0x01, 0x00}, appVersion: 0x0304},
+		{name: "version mismatch", status: []byte{0x01, 0x00}, appVersion: 0x0303, wantErr: true},
+		{name: "application not valid", status: []byte{0x00, 0x00}, appVersion: 0x0304, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := make([]byte, protocol.GetMetadataResponseSize)
+			metadata[20], metadata[21] = 0x02, 0x01
+			metadata[22], metadata[23] = byte(tt.appVersion), byte(tt.appVersion>>8)
 
-			if tt.wantErr {
-				if err == nil {
-					t.Fatal("expected error, got nil")
-				}
-				return
+			device := NewMockDevice()
+			device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+			device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+			device.AddResponse(protocol.StatusSuccess, nil) // send data
+			device.AddResponse(protocol.StatusSuccess, nil) // program row
+			device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+			device.AddResponse(protocol.StatusSuccess, tt.status)
+			device.AddResponse(protocol.StatusSuccess, metadata)
+			device.AddResponse(protocol.StatusSuccess, nil)
+
+			prog := New(device, WithVerifyAfterProgram(false), WithAppValidation(1))
+			report, err := prog.ProgramWithReport(context.Background(), firmware, key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-
-			if size.StartRow != tt.wantStart {
-				t.Errorf("StartRow = %d, want %d", size.StartRow, tt.wantStart)
+				var verr *VerificationError
+				if !errors.As(err, &verr) {
+					t.Errorf("error type = %T, want *VerificationError", err)
+				}
+				return
 			}
 
-			if size.EndRow != tt.wantEnd {
-				t.Errorf("EndRow = %d, want %d", size.EndRow, tt.wantEnd)
+			if report.AppMetadata == nil || report.AppMetadata.AppVersion != 0x0304 {
+				t.Errorf("AppMetadata = %+v, want app version 0x0304", report.AppMetadata)
 			}
 		})
 	}
@@ -612,6 +1239,180 @@ func TestReadWriteErrors(t *testing.T) {
 	}
 }
 
+// flakyDevice fails the Nth Read (1-based) with a transient I/O error
+type flakyDevice struct {
+	*MockDevice
+	failRead int
+	reads    int
+}
+
+func (d *flakyDevice) Read(p []byte) (int, error) {
+	d.reads++
+	if d.reads == d.failRead {
+		return 0, errors.New("usb: transfer timed out")
+	}
+	return d.MockDevice.Read(p)
+}
+
+func TestProgramWithRowCallback(t *testing.T) {
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0000, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}, Checksum: 0xF2},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("transient failure is retried", func(t *testing.T) {
+		// The third read (first Program Row response) fails
+		device := &flakyDevice{MockDevice: NewMockDevice(), failRead: 3}
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, []byte{0xF6})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+
+		var results []RowResult
+		prog := New(device, WithRowCallback(func(r RowResult) {
+			results = append(results, r)
+		}))
+
+		if err := prog.Program(context.Background(), firmware, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(results) != 1 {
+			t.Fatalf("row callbacks = %d, want 1", len(results))
+		}
+
+		r := results[0]
+		if r.RowNum != 0 || r.Bytes != 4 || r.Err != nil {
+			t.Errorf("result = %+v", r)
+		}
+		if !r.Verified || r.DeviceChecksum != 0xF6 {
+			t.Errorf("Verified = %v, DeviceChecksum = 0x%02X, want true, 0xF6", r.Verified, r.DeviceChecksum)
+		}
+		if r.Retries != 1 {
+			t.Errorf("Retries = %d, want 1", r.Retries)
+		}
+	})
+
+	t.Run("packet checksum status is retried", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.ErrChecksum, nil)
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, []byte{0xF6})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+
+		var results []RowResult
+		prog := New(device, WithRowCallback(func(r RowResult) {
+			results = append(results, r)
+		}))
+
+		if err := prog.Program(context.Background(), firmware, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != 1 || results[0].Retries != 1 {
+			t.Errorf("results = %+v, want one row with 1 retry", results)
+		}
+	})
+
+	t.Run("protocol error is not retried", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.ErrRow, nil)
+
+		var results []RowResult
+		prog := New(device, WithRowCallback(func(r RowResult) {
+			results = append(results, r)
+		}))
+
+		if err := prog.Program(context.Background(), firmware, key); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		if len(results) != 1 {
+			t.Fatalf("row callbacks = %d, want 1", len(results))
+		}
+		if results[0].Err == nil || results[0].Retries != 0 {
+			t.Errorf("result = %+v, want failure without retries", results[0])
+		}
+
+		var rowErr *ProgramRowError
+		if !errors.As(results[0].Err, &rowErr) {
+			t.Fatalf("error type = %T, want *ProgramRowError", results[0].Err)
+		}
+		if rowErr.RowNum != 0 || rowErr.Phase != PhaseProgramming || rowErr.Attempts != 1 {
+			t.Errorf("row error = %+v", rowErr)
+		}
+	})
+}
+
+// dribbleDevice delivers queued responses a few bytes per Read, like a UART
+type dribbleDevice struct {
+	*MockDevice
+	pending []byte
+	step    int
+}
+
+func (d *dribbleDevice) Read(p []byte) (int, error) {
+	if len(d.pending) == 0 {
+		if d.respIdx >= len(d.responses) {
+			// Nothing more to send: behave like a serial port with no data
+			return 0, nil
+		}
+		d.pending = d.responses[d.respIdx]
+		d.respIdx++
+	}
+
+	n := copy(p[:min(len(p), d.step)], d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func TestResponseReassembly(t *testing.T) {
+	for _, step := range []int{1, 2, 5} {
+		device := &dribbleDevice{MockDevice: NewMockDevice(), step: step}
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+
+		prog := New(device)
+		size, err := prog.GetFlashSize(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", step, err)
+		}
+		if size.EndRow != 0x01FF {
+			t.Errorf("step %d: EndRow = 0x%04X, want 0x01FF", step, size.EndRow)
+		}
+	}
+
+	t.Run("report ID", func(t *testing.T) {
+		device := &dribbleDevice{MockDevice: NewMockDevice(), step: 1}
+		frame := buildResponseFrame(protocol.StatusSuccess, []byte{0x01})
+		device.responses = append(device.responses, append([]byte{0x00}, frame...))
+
+		prog := New(device)
+		if _, err := prog.VerifyChecksum(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("incomplete frame times out", func(t *testing.T) {
+		device := &dribbleDevice{MockDevice: NewMockDevice(), step: 1}
+		frame := buildResponseFrame(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.responses = append(device.responses, frame[:6])
+
+		prog := New(device, WithReadTimeout(20*time.Millisecond))
+		_, err := prog.GetFlashSize(context.Background(), 0)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
+
 func BenchmarkProgram(b *testing.B) {
 	firmware := &cyacd.Firmware{
 		SiliconID:    0x1E9602AA,
@@ -628,6 +1429,7 @@ func BenchmarkProgram(b *testing.B) {
 		},
 	}
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		device := NewMockDevice()
@@ -642,3 +1444,387 @@ func BenchmarkProgram(b *testing.B) {
 		_ = prog.Program(context.Background(), firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
 	}
 }
+
+// ackDevice acknowledges every command with an empty success response,
+// without buffering writes, so benchmarks measure only the programmer
+type ackDevice struct {
+	ack []byte
+}
+
+func (d *ackDevice) Write(p []byte) (int, error) { return len(p), nil }
+
+func (d *ackDevice) Read(p []byte) (int, error) {
+	return copy(p, d.ack), nil
+}
+
+func BenchmarkProgramRows(b *testing.B) {
+	// 256-byte rows: four Send Data chunks and a Program Row each
+	rows := make([]*cyacd.Row, 64)
+	for i := range rows {
+		rows[i] = &cyacd.Row{RowNum: uint16(i), Size: 256, Data: make([]byte, 256)}
+	}
+
+	ack, _ := protocol.BuildCommand(protocol.StatusSuccess, nil)
+	prog := New(&ackDevice{ack: ack}, WithVerifyAfterProgram(false))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, row := range rows {
+			if err := prog.programRow(context.Background(), row, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestProgramSkipExitAndAppVerify(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantVerify bool
+		wantExit   bool
+		wantState  State
+	}{
+		{"default", nil, true, true, StateDone},
+		{"skip exit", []Option{WithSkipExit()}, true, false, StateInBootloader},
+		{"skip app verify", []Option{WithSkipAppVerify()}, false, true, StateDone},
+		{"skip both", []Option{WithSkipExit(), WithSkipAppVerify()}, false, false, StateInBootloader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := bootloadertest.NewDevice()
+			prog := New(device, tt.opts...)
+
+			if err := prog.Program(context.Background(), fw, key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			commands := device.Commands()
+			if got := bytes.IndexByte(commands, protocol.CmdVerifyChecksum) >= 0; got != tt.wantVerify {
+				t.Errorf("Verify Checksum sent = %t, want %t", got, tt.wantVerify)
+			}
+			if got := bytes.IndexByte(commands, protocol.CmdExitBootloader) >= 0; got != tt.wantExit {
+				t.Errorf("Exit Bootloader sent = %t, want %t", got, tt.wantExit)
+			}
+			if device.InBootloader() == tt.wantExit {
+				t.Errorf("device in bootloader = %t, want %t", device.InBootloader(), !tt.wantExit)
+			}
+			if prog.State() != tt.wantState {
+				t.Errorf("state = %s, want %s", prog.State(), tt.wantState)
+			}
+		})
+	}
+}
+
+func TestProgramSiliconRevCheck(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID:  bootloadertest.DefaultSiliconID,
+		SiliconRev: 0x11,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name      string
+		deviceRev byte
+		opts      []Option
+		wantErr   *SiliconRevMismatchError
+	}{
+		{"not checked by default", 0x22, nil, nil},
+		{"matches firmware", 0x11, []Option{WithSiliconRevCheck()}, nil},
+		{"differs from firmware", 0x22, []Option{WithSiliconRevCheck()}, &SiliconRevMismatchError{Expected: 0x11, Actual: 0x22}},
+		{"matches explicit", 0x22, []Option{WithExpectedSiliconRev(0x22)}, nil},
+		{"differs from explicit", 0x11, []Option{WithExpectedSiliconRev(0x22)}, &SiliconRevMismatchError{Expected: 0x22, Actual: 0x11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := bootloadertest.NewDevice(bootloadertest.WithSiliconRev(tt.deviceRev))
+			err := New(device, tt.opts...).Program(context.Background(), fw, key)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var revErr *SiliconRevMismatchError
+			if !errors.As(err, &revErr) {
+				t.Fatalf("error = %v, want *SiliconRevMismatchError", err)
+			}
+			if *revErr != *tt.wantErr {
+				t.Errorf("error = %+v, want %+v", *revErr, *tt.wantErr)
+			}
+			if len(device.Rows()) != 0 {
+				t.Error("rows were written after a revision mismatch")
+			}
+		})
+	}
+}
+
+func TestProgramAllowSiliconIDMismatch(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: 0x2E1234AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("mismatch fails by default", func(t *testing.T) {
+		err := New(bootloadertest.NewDevice()).Program(context.Background(), fw, key)
+		var mismatchErr *DeviceMismatchError
+		if !errors.As(err, &mismatchErr) {
+			t.Fatalf("error = %v, want *DeviceMismatchError", err)
+		}
+	})
+
+	t.Run("override logs warning", func(t *testing.T) {
+		device := bootloadertest.NewDevice()
+		logger := &warnLogger{}
+		prog := New(device, WithLogger(logger), WithAllowSiliconIDMismatch())
+
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := device.Row(0, 0x0010); !ok {
+			t.Error("row was not programmed")
+		}
+		if len(logger.warnMsgs) != 1 {
+			t.Errorf("warnings = %v, want one", logger.warnMsgs)
+		}
+	})
+
+	t.Run("warning falls back to info", func(t *testing.T) {
+		logger := &MockLogger{}
+		prog := New(bootloadertest.NewDevice(), WithLogger(logger), WithAllowSiliconIDMismatch())
+
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		found := false
+		for _, msg := range logger.infoMsgs {
+			found = found || msg == "silicon ID mismatch ignored"
+		}
+		if !found {
+			t.Errorf("info messages = %v, want the mismatch warning", logger.infoMsgs)
+		}
+	})
+}
+
+func TestProgramVerifyEvery(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 7; i++ {
+		data := []byte{byte(i), 0x02, 0x03, 0x04}
+		fw.Rows = append(fw.Rows, &cyacd.Row{
+			ArrayID: 0, RowNum: uint16(0x0010 + i), Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data),
+		})
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantEvery    int
+		wantVerified []int
+	}{
+		{"default verifies every row", nil, 1, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"every third row", []Option{WithVerifyEvery(3)}, 3, []int{0, 3, 6}},
+		{"verification disabled", []Option{WithVerifyEvery(3), WithVerifyAfterProgram(false)}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := bootloadertest.NewDevice()
+			var verified []int
+			opts := append(tt.opts, WithRowCallback(func(r RowResult) {
+				if r.Verified {
+					verified = append(verified, r.Index)
+				}
+			}))
+
+			report, err := New(device, opts...).ProgramWithReport(context.Background(), fw, key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if report.VerifyEvery != tt.wantEvery {
+				t.Errorf("VerifyEvery = %d, want %d", report.VerifyEvery, tt.wantEvery)
+			}
+			if report.RowsVerified != len(tt.wantVerified) {
+				t.Errorf("RowsVerified = %d, want %d", report.RowsVerified, len(tt.wantVerified))
+			}
+			if fmt.Sprint(verified) != fmt.Sprint(tt.wantVerified) {
+				t.Errorf("verified rows = %v, want %v", verified, tt.wantVerified)
+			}
+			if n := bytes.Count(device.Commands(), []byte{protocol.CmdVerifyRow}); n != len(tt.wantVerified) {
+				t.Errorf("%d Verify Row commands, want %d", n, len(tt.wantVerified))
+			}
+			if bytes.IndexByte(device.Commands(), protocol.CmdVerifyChecksum) < 0 {
+				t.Error("application checksum not verified")
+			}
+		})
+	}
+}
+
+func TestProgramAdaptiveVerify(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 4; i++ {
+		data := []byte{byte(i), 0x02, 0x03, 0x04}
+		fw.Rows = append(fw.Rows, &cyacd.Row{
+			ArrayID: 0, RowNum: uint16(0x0010 + i), Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data),
+		})
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	// The response to the third row's Program Row is corrupted, so that row is retried
+	device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultCorruptChecksum,
+		Command: protocol.CmdProgramRow,
+		Skip:    2,
+	}))
+
+	var verified []int
+	prog := New(device,
+		WithVerifyAfterProgram(false),
+		WithAdaptiveVerify(),
+		WithRowCallback(func(r RowResult) {
+			if r.Verified {
+				verified = append(verified, r.Index)
+			}
+		}),
+	)
+
+	report, err := prog.ProgramWithReport(context.Background(), fw, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fmt.Sprint(verified) != "[2]" {
+		t.Errorf("verified rows = %v, want only the retried row 2", verified)
+	}
+	if report.RowsVerified != 1 {
+		t.Errorf("RowsVerified = %d, want 1", report.RowsVerified)
+	}
+	if n := bytes.Count(device.Commands(), []byte{protocol.CmdVerifyRow}); n != 1 {
+		t.Errorf("%d Verify Row commands, want 1", n)
+	}
+}
+
+func TestProgramReprogramsOnVerifyFailure(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	t.Run("glitch is repaired", func(t *testing.T) {
+		device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+			Kind:    bootloadertest.FaultFlashGlitch,
+			Command: protocol.CmdProgramRow,
+		}))
+
+		if err := New(device).Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := device.Row(0, 0x0010); !bytes.Equal(got, data) {
+			t.Errorf("row = % 02X, want % 02X", got, data)
+		}
+
+		want := []byte{protocol.CmdProgramRow, protocol.CmdVerifyRow, protocol.CmdSyncBootloader,
+			protocol.CmdEraseRow, protocol.CmdProgramRow, protocol.CmdVerifyRow}
+		if !bytes.Contains(device.Commands(), want) {
+			t.Errorf("commands = % 02X, want erase and reprogram after the mismatch", device.Commands())
+		}
+	})
+
+	t.Run("persistent mismatch fails after retries", func(t *testing.T) {
+		device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+			Kind:    bootloadertest.FaultFlashGlitch,
+			Command: protocol.CmdProgramRow,
+			Times:   -1,
+		}))
+
+		err := New(device, WithRetries(2)).Program(context.Background(), fw, key)
+
+		var mismatchErr *ChecksumMismatchError
+		if !errors.As(err, &mismatchErr) {
+			t.Fatalf("error = %v, want *ChecksumMismatchError", err)
+		}
+		var rowErr *ProgramRowError
+		if !errors.As(err, &rowErr) || rowErr.Attempts != 3 {
+			t.Errorf("error = %v, want 3 attempts", err)
+		}
+	})
+}
+
+// fieldLogger records the key-value pairs of debug messages by message
+type fieldLogger struct {
+	MockLogger
+	fields map[string][]interface{}
+}
+
+func (l *fieldLogger) Debug(msg string, kv ...interface{}) {
+	l.MockLogger.Debug(msg, kv...)
+	if l.fields == nil {
+		l.fields = make(map[string][]interface{})
+	}
+	l.fields[msg] = kv
+}
+
+func TestLogLevel(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	logger := &fieldLogger{}
+	prog := New(bootloadertest.NewDevice(), WithLogger(logger))
+	if err := prog.Program(context.Background(), journalFirmware(), key); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	kv, ok := logger.fields["row programmed"]
+	if !ok {
+		t.Fatal("no row programmed message at LogDebug")
+	}
+	var keys []string
+	for i := 0; i < len(kv); i += 2 {
+		keys = append(keys, kv[i].(string))
+	}
+	if got, want := strings.Join(keys, ","), "phase,array,row,attempt,duration"; got != want {
+		t.Errorf("row programmed keys = %s, want %s", got, want)
+	}
+
+	quiet := &warnLogger{}
+	prog = New(bootloadertest.NewDevice(), WithLogger(quiet), WithLogLevel(LogInfo))
+	if err := prog.Program(context.Background(), journalFirmware(), key); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	if len(quiet.debugMsgs) != 0 {
+		t.Errorf("debug messages at LogInfo: %v", quiet.debugMsgs)
+	}
+	if len(quiet.infoMsgs) == 0 {
+		t.Error("no info messages at LogInfo")
+	}
+
+	if _, err := NewProgrammer(bootloadertest.NewDevice(), WithLogLevel(LogOff+1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("WithLogLevel(LogOff+1): err = %v, want ErrInvalidOption", err)
+	}
+}
@@ -0,0 +1,372 @@
+package bootloader
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// MinEncryptionBootloaderVersion is the lowest bootloader major version
+// (as reported by Enter Bootloader) that accepts encrypted images.
+const MinEncryptionBootloaderVersion = 2
+
+// ProgramV2 programs a .cyacd2 image into a bootloader SDK v2.x device:
+//  1. Enter bootloader with the image's product ID
+//  2. Validate device silicon ID matches firmware
+//  3. Set the application metadata (@APPINFO)
+//  4. For encrypted images, load the initialization vector with Set EIV
+//  5. Program all rows with Program Data, verifying each with Verify Data
+//     when VerifyAfterProgram is enabled (see also WithVerifyEvery)
+//  6. Verify the application (unless WithSkipAppVerify is set)
+//  7. Exit bootloader (unless WithSkipExit is set)
+//  8. Wait for the application to start (if WithWaitForApplication is set)
+//
+// Encrypted row data is streamed as-is; the bootloader decrypts it. Because
+// the flash then holds plaintext that the host cannot reproduce, rows of
+// encrypted images are not verified individually and integrity is checked by
+// the bootloader in step 6 instead. Encrypted images require a bootloader
+// reporting at least MinEncryptionBootloaderVersion; older bootloaders, and
+// bootloaders that reject Set EIV, fail with ErrEncryptionUnsupported before
+// any row is written.
+//
+// Example:
+//
+//	fw, err := cyacd.Parse2("firmware.cyacd2")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := prog.ProgramV2(ctx, fw); err != nil {
+//	    log.Fatal(err)
+//	}
+func (p *Programmer) ProgramV2(ctx context.Context, fw *cyacd.Firmware2) error {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	err = withCause(ctx, p.programV2(ctx, fw))
+	if err != nil {
+		p.setState(StateFailed)
+	}
+	return err
+}
+
+// programV2 implements ProgramV2 within an operation already in progress.
+func (p *Programmer) programV2(ctx context.Context, fw *cyacd.Firmware2) error {
+	if len(fw.Rows) == 0 {
+		return fmt.Errorf("firmware has no rows")
+	}
+
+	// Packets use the checksum type the image was built for
+	prevChecksumType := p.checksumType
+	p.checksumType = fw.ChecksumType
+	defer func() { p.checksumType = prevChecksumType }()
+
+	startTime := p.clock.Now()
+	totalBytes := 0
+	for _, row := range fw.Rows {
+		totalBytes += len(row.Data)
+	}
+
+	p.reportProgress(Progress{
+		Phase:       PhaseEntering,
+		TotalRows:   len(fw.Rows),
+		TotalBytes:  totalBytes,
+		ElapsedTime: p.clock.Since(startTime),
+	})
+
+	info, err := p.enterBootloaderV2(ctx, fw.ProductID)
+	if err != nil {
+		return fmt.Errorf("enter bootloader: %w", err)
+	}
+	p.setState(StateInBootloader)
+
+	if err := p.checkSiliconID(info, fw.SiliconID); err != nil {
+		return err
+	}
+	if err := p.checkSiliconRev(info, fw.SiliconRev); err != nil {
+		return err
+	}
+
+	if err := p.checkGeometryV2(fw.Rows); err != nil {
+		return err
+	}
+
+	if fw.Encrypted() && info.BootloaderVer[0] < MinEncryptionBootloaderVersion {
+		return fmt.Errorf("%w: bootloader version %d.%d.%d", ErrEncryptionUnsupported,
+			info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2])
+	}
+
+	desc := Description{
+		DeviceInfo: info,
+		DeviceID:   p.config.DeviceID,
+		Rows:       len(fw.Rows),
+		Bytes:      totalBytes,
+		AppID:      fw.AppID,
+	}
+	if err := p.confirm(desc); err != nil {
+		p.leaveUnconfirmed(ctx)
+		return err
+	}
+
+	// Negotiate before Set App Metadata: the trial ends with Sync Bootloader
+	if err := p.autoChunkSize(ctx); err != nil {
+		return err
+	}
+
+	cmd, err := protocol.BuildSetAppMetadataCmd(fw.AppID, fw.AppStart, fw.AppLength)
+	if err != nil {
+		return err
+	}
+	if _, err := p.transact(ctx, "set app metadata", cmd); err != nil {
+		return err
+	}
+
+	if fw.Encrypted() {
+		if err := p.setEIV(ctx, fw.EIV); err != nil {
+			return err
+		}
+	}
+
+	p.setState(StateProgramming)
+
+	bytesWritten := 0
+	for i, row := range fw.Rows {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("canceled: %w", err)
+		}
+
+		retries, err := p.writeDataWithRetry(ctx, protocol.CmdProgramData, row)
+		if err != nil {
+			return fmt.Errorf("program row at 0x%08X: %w", row.Address, err)
+		}
+
+		verify := p.shouldVerifyRow(i) || (p.config.AdaptiveVerify && retries > 0)
+		if verify && !fw.Encrypted() {
+			if _, err := p.writeDataWithRetry(ctx, protocol.CmdVerifyData, row); err != nil {
+				return fmt.Errorf("verify row at 0x%08X: %w", row.Address, err)
+			}
+		}
+
+		bytesWritten += len(row.Data)
+		p.reportProgress(Progress{
+			Phase:        PhaseProgramming,
+			CurrentRow:   i,
+			TotalRows:    len(fw.Rows),
+			Percentage:   float64(i+1) / float64(len(fw.Rows)) * 100.0,
+			BytesWritten: bytesWritten,
+			TotalBytes:   totalBytes,
+			ElapsedTime:  p.clock.Since(startTime),
+		})
+	}
+
+	p.setState(StateVerifying)
+	p.reportProgress(Progress{
+		Phase:        PhaseVerifying,
+		TotalRows:    len(fw.Rows),
+		Percentage:   100.0,
+		BytesWritten: bytesWritten,
+		TotalBytes:   totalBytes,
+		ElapsedTime:  p.clock.Since(startTime),
+	})
+
+	if !p.config.SkipAppVerify {
+		if err := p.verifyApp(ctx, fw.AppID); err != nil {
+			return err
+		}
+	}
+
+	if p.config.SkipExit {
+		p.setState(StateInBootloader)
+	} else {
+		p.reportProgress(Progress{
+			Phase:        PhaseExiting,
+			TotalRows:    len(fw.Rows),
+			Percentage:   100.0,
+			BytesWritten: bytesWritten,
+			TotalBytes:   totalBytes,
+			ElapsedTime:  p.clock.Since(startTime),
+		})
+
+		if err := p.exitBootloader(ctx); err != nil {
+			return fmt.Errorf("exit bootloader: %w", err)
+		}
+		p.setState(StateDone)
+
+		if p.config.AppProbe != nil {
+			p.reportProgress(Progress{
+				Phase:        PhaseWaiting,
+				TotalRows:    len(fw.Rows),
+				Percentage:   100.0,
+				BytesWritten: bytesWritten,
+				TotalBytes:   totalBytes,
+				ElapsedTime:  p.clock.Since(startTime),
+			})
+
+			if err := p.waitForApplication(ctx, p.config.AppProbe, p.config.AppStartTimeout); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.reportProgress(Progress{
+		Phase:        PhaseComplete,
+		TotalRows:    len(fw.Rows),
+		Percentage:   100.0,
+		BytesWritten: bytesWritten,
+		TotalBytes:   totalBytes,
+		ElapsedTime:  p.clock.Since(startTime),
+	})
+
+	p.logInfo("programming complete", "rows", len(fw.Rows), "encrypted", fw.Encrypted(), "duration", p.clock.Since(startTime).String())
+
+	return nil
+}
+
+// enterBootloaderV2 sends Enter Bootloader with a v2 product ID instead of a key.
+func (p *Programmer) enterBootloaderV2(ctx context.Context, productID uint32) (*protocol.DeviceInfo, error) {
+	if err := p.resetTarget(ctx); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, productID)
+
+	cmd, err := protocol.BuildCommand(protocol.CmdEnterBootloader, data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := p.retryEntry(ctx, func() (*protocol.DeviceInfo, error) {
+		resp, err := p.transact(ctx, "enter bootloader", cmd)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.ParseEnterBootloaderResponse(resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.applyDeviceProfile(info)
+	return info, nil
+}
+
+// setEIV loads the initialization vector of an encrypted image.
+// A bootloader that does not recognize the command fails with ErrEncryptionUnsupported.
+func (p *Programmer) setEIV(ctx context.Context, eiv []byte) error {
+	cmd, err := protocol.BuildSetEIVCmd(eiv)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transact(ctx, "set EIV", cmd)
+
+	var protoErr *protocol.ProtocolError
+	if errors.As(err, &protoErr) && protoErr.StatusCode == protocol.ErrCommand {
+		return fmt.Errorf("%w: %v", ErrEncryptionUnsupported, err)
+	}
+	return err
+}
+
+// writeDataWithRetry sends a row with Program Data or Verify Data, retrying
+// transient transport failures up to Config.Retries times. It returns the
+// number of retries needed.
+func (p *Programmer) writeDataWithRetry(ctx context.Context, cmd byte, row *cyacd.Row2) (int, error) {
+	for attempt := 0; ; attempt++ {
+		err := p.writeData(ctx, cmd, row)
+		if err != nil && ctx.Err() != nil {
+			p.resyncCanceled(ctx)
+		}
+		if err == nil || attempt >= p.config.Retries || !IsRetryable(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		p.logDebug("retrying row", "phase", PhaseProgramming, "address", fmt.Sprintf("0x%08X", row.Address), "attempt", attempt+2, "error", err)
+
+		if err := p.resync(ctx); err != nil {
+			return attempt, err
+		}
+	}
+}
+
+// writeData sends a row with Program Data or Verify Data. Rows that do not fit
+// in one packet are sent as Send Data chunks followed by the final command,
+// which carries the CRC-32C of the complete row.
+func (p *Programmer) writeData(ctx context.Context, cmd byte, row *cyacd.Row2) error {
+	data := row.Data
+	offset := p.sendDataEnd(len(data), len(data), protocol.ProgramDataOverhead)
+	if err := p.sendDataChunks(ctx, data[:offset], 0, nil); err != nil {
+		return err
+	}
+
+	crc := protocol.CalculateDataCRC(data)
+
+	var frame []byte
+	var err error
+	op := "program data"
+	if cmd == protocol.CmdVerifyData {
+		op = "verify data"
+		frame, err = protocol.BuildVerifyDataCmd(row.Address, crc, data[offset:])
+	} else {
+		frame, err = protocol.BuildProgramDataCmd(row.Address, crc, data[offset:])
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transact(ctx, op, frame)
+	return err
+}
+
+// verifyApp asks the bootloader to verify the application in slot appID.
+func (p *Programmer) verifyApp(ctx context.Context, appID byte) error {
+	cmd, err := protocol.BuildVerifyAppCmd(appID)
+	if err != nil {
+		return err
+	}
+
+	data, err := p.transact(ctx, "verify application", cmd)
+	if err != nil {
+		return err
+	}
+
+	valid, err := protocol.ParseVerifyChecksumResponse(data)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return &VerificationError{
+			Reason: fmt.Sprintf("application %d is invalid", appID),
+		}
+	}
+
+	return nil
+}
+
+// transact sends a command frame and returns the response data,
+// converting a non-success status into a *protocol.ProtocolError for op.
+func (p *Programmer) transact(ctx context.Context, op string, cmd []byte) ([]byte, error) {
+	response, err := p.sendCommandWithResponse(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, data, err := p.parseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != protocol.StatusSuccess {
+		return nil, &protocol.ProtocolError{
+			Operation:  op,
+			StatusCode: statusCode,
+		}
+	}
+
+	return data, nil
+}
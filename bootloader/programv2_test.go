@@ -0,0 +1,126 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// v2Device answers bootloader SDK v2.x commands and records the command codes.
+type v2Device struct {
+	*MockDevice
+	majorVersion byte
+	reject       byte
+	commands     []byte
+}
+
+func (d *v2Device) Write(p []byte) (int, error) {
+	cmd := p[1]
+	d.commands = append(d.commands, cmd)
+
+	switch cmd {
+	case d.reject:
+		d.AddResponse(protocol.ErrCommand, nil)
+	case protocol.CmdEnterBootloader:
+		d.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, d.majorVersion, 0x00, 0x00})
+	case protocol.CmdVerifyChecksum:
+		d.AddResponse(protocol.StatusSuccess, []byte{0x01})
+	case protocol.CmdExitBootloader:
+		// Device resets without responding
+	default:
+		d.AddResponse(protocol.StatusSuccess, nil)
+	}
+
+	return d.MockDevice.Write(p)
+}
+
+func testFirmware2(eiv []byte) *cyacd.Firmware2 {
+	return &cyacd.Firmware2{
+		FileVersion: cyacd.FileVersion2,
+		SiliconID:   0x1E9602AA,
+		AppStart:    0x10000000,
+		AppLength:   0x100,
+		EIV:         eiv,
+		Rows: []*cyacd.Row2{
+			{Address: 0x10000000, Data: bytes.Repeat([]byte{0x5A}, 100)},
+		},
+	}
+}
+
+func TestProgramV2(t *testing.T) {
+	device := &v2Device{MockDevice: NewMockDevice(), majorVersion: 2}
+	prog := New(device)
+
+	if err := prog.ProgramV2(context.Background(), testFirmware2(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []byte{
+		protocol.CmdEnterBootloader,
+		protocol.CmdSetAppMetadata,
+		protocol.CmdSendData, protocol.CmdProgramData,
+		protocol.CmdSendData, protocol.CmdVerifyData,
+		protocol.CmdVerifyChecksum,
+		protocol.CmdExitBootloader,
+	}
+	if !bytes.Equal(device.commands, want) {
+		t.Errorf("commands = % 02X, want % 02X", device.commands, want)
+	}
+	if prog.State() != StateDone {
+		t.Errorf("State() = %s, want %s", prog.State(), StateDone)
+	}
+}
+
+func TestProgramV2Encrypted(t *testing.T) {
+	device := &v2Device{MockDevice: NewMockDevice(), majorVersion: 2}
+	prog := New(device)
+
+	if err := prog.ProgramV2(context.Background(), testFirmware2(make([]byte, 16))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Set EIV precedes the rows, and rows are not verified individually
+	want := []byte{
+		protocol.CmdEnterBootloader,
+		protocol.CmdSetAppMetadata,
+		protocol.CmdSetEIV,
+		protocol.CmdSendData, protocol.CmdProgramData,
+		protocol.CmdVerifyChecksum,
+		protocol.CmdExitBootloader,
+	}
+	if !bytes.Equal(device.commands, want) {
+		t.Errorf("commands = % 02X, want % 02X", device.commands, want)
+	}
+}
+
+func TestProgramV2EncryptionUnsupported(t *testing.T) {
+	t.Run("old bootloader", func(t *testing.T) {
+		device := &v2Device{MockDevice: NewMockDevice(), majorVersion: 1}
+		err := New(device).ProgramV2(context.Background(), testFirmware2(make([]byte, 16)))
+
+		if !errors.Is(err, ErrEncryptionUnsupported) {
+			t.Errorf("error = %v, want ErrEncryptionUnsupported", err)
+		}
+		if len(device.commands) != 1 {
+			t.Errorf("sent % 02X, want only Enter Bootloader", device.commands)
+		}
+	})
+
+	t.Run("Set EIV rejected", func(t *testing.T) {
+		device := &v2Device{MockDevice: NewMockDevice(), majorVersion: 2, reject: protocol.CmdSetEIV}
+		err := New(device).ProgramV2(context.Background(), testFirmware2(make([]byte, 16)))
+
+		if !errors.Is(err, ErrEncryptionUnsupported) {
+			t.Errorf("error = %v, want ErrEncryptionUnsupported", err)
+		}
+		for _, cmd := range device.commands {
+			if cmd == protocol.CmdProgramData {
+				t.Fatal("row programmed after Set EIV was rejected")
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package bootloader
+
+import (
+	"time"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// progressTracker fills in the derived Progress fields (elapsed time, throughput,
+// ETA, phase start) so that every report of a session is consistent across phases.
+type progressTracker struct {
+	p           *Programmer
+	start       time.Time
+	totalRows   int
+	totalBytes  int
+	rowsSkipped int
+
+	phase      Phase
+	phaseStart time.Time
+
+	// programStart is when the first row started programming;
+	// throughput is measured from here so that entry time does not skew it
+	programStart time.Time
+	bytesWritten int
+	rate         float64
+}
+
+// newProgressTracker creates a tracker for programming rows, starting at start.
+// skipped is the number of firmware rows excluded by the row filter.
+func (p *Programmer) newProgressTracker(start time.Time, rows []*cyacd.Row, skipped int) *progressTracker {
+	t := &progressTracker{
+		p:           p,
+		start:       start,
+		totalRows:   len(rows),
+		rowsSkipped: skipped,
+	}
+	for _, row := range rows {
+		t.totalBytes += len(row.Data)
+	}
+	return t
+}
+
+// skipRows removes rows found to be outside the programmable flash after the
+// session started (see WithSkipBootloaderRows) from the totals.
+func (t *progressTracker) skipRows(skipped []RowRange, rows []*cyacd.Row) {
+	for _, r := range skipped {
+		t.rowsSkipped += int(r.Last-r.First) + 1
+	}
+	t.totalRows = len(rows)
+	t.totalBytes = 0
+	for _, row := range rows {
+		t.totalBytes += len(row.Data)
+	}
+}
+
+// beginRows marks the start of row programming for throughput measurement.
+func (t *progressTracker) beginRows() {
+	t.programStart = t.p.clock.Now()
+}
+
+// report completes progress with the derived fields and passes it to the callback.
+// Phase, CurrentRow, Percentage, BytesWritten, and the chunk fields come from the caller;
+// BytesWritten carries over from earlier reports when not set.
+func (t *progressTracker) report(progress Progress) {
+	now := t.p.clock.Now()
+
+	if progress.Phase != t.phase {
+		t.phase = progress.Phase
+		t.phaseStart = now
+	}
+
+	if progress.BytesWritten > t.bytesWritten {
+		t.bytesWritten = progress.BytesWritten
+
+		if elapsed := now.Sub(t.programStart); !t.programStart.IsZero() && elapsed > 0 {
+			t.rate = float64(t.bytesWritten) / elapsed.Seconds()
+		}
+	}
+
+	progress.TotalRows = t.totalRows
+	progress.TotalBytes = t.totalBytes
+	progress.RowsSkipped = t.rowsSkipped
+	progress.BytesWritten = t.bytesWritten
+	progress.BytesPerSecond = t.rate
+	progress.ElapsedTime = now.Sub(t.start)
+	progress.PhaseStartedAt = t.phaseStart
+
+	if progress.Phase == PhaseProgramming && t.rate > 0 {
+		remaining := t.totalBytes - t.bytesWritten
+		progress.EstimatedRemaining = time.Duration(float64(remaining) / t.rate * float64(time.Second))
+	}
+
+	t.p.reportProgress(progress)
+}
@@ -0,0 +1,266 @@
+package bootloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestProgressDerivedFields(t *testing.T) {
+	data := make([]byte, 200)
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0000, Size: 200, Data: data},
+		},
+	}
+
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	// 200 bytes = 3 Send Data chunks of 57 bytes + Program Row with 29 bytes
+	for i := 0; i < 4; i++ {
+		device.AddResponse(protocol.StatusSuccess, nil)
+	}
+	device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+
+	var reports []Progress
+	prog := New(device,
+		WithVerifyAfterProgram(false),
+		WithProgressCallback(func(p Progress) { reports = append(reports, p) }),
+	)
+
+	if err := prog.Program(context.Background(), firmware, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var chunks []int
+	for _, p := range reports {
+		if p.TotalBytes != 200 {
+			t.Errorf("[%s] TotalBytes = %d, want 200", p.Phase, p.TotalBytes)
+		}
+		if p.PhaseStartedAt.IsZero() {
+			t.Errorf("[%s] PhaseStartedAt not set", p.Phase)
+		}
+		if p.ChunkCount > 0 {
+			if p.ChunkCount != 4 {
+				t.Errorf("ChunkCount = %d, want 4", p.ChunkCount)
+			}
+			chunks = append(chunks, p.ChunkIndex)
+		}
+	}
+
+	if want := []int{1, 2, 3, 4}; len(chunks) != len(want) {
+		t.Errorf("chunk reports = %v, want %v", chunks, want)
+	} else {
+		for i := range want {
+			if chunks[i] != want[i] {
+				t.Errorf("chunk reports = %v, want %v", chunks, want)
+				break
+			}
+		}
+	}
+
+	last := reports[len(reports)-1]
+	if last.Phase != PhaseComplete {
+		t.Fatalf("last phase = %s, want %s", last.Phase, PhaseComplete)
+	}
+	if last.BytesWritten != 200 {
+		t.Errorf("BytesWritten = %d, want 200", last.BytesWritten)
+	}
+	if last.BytesPerSecond <= 0 {
+		t.Errorf("BytesPerSecond = %f, want > 0", last.BytesPerSecond)
+	}
+	if last.EstimatedRemaining != 0 {
+		t.Errorf("EstimatedRemaining = %v, want 0 after programming", last.EstimatedRemaining)
+	}
+}
+
+func TestProgressThrottling(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 50; i++ {
+		data := []byte{byte(i), 0x02, 0x03, 0x04}
+		fw.Rows = append(fw.Rows, &cyacd.Row{
+			ArrayID: 0, RowNum: uint16(0x0010 + i), Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data),
+		})
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name string
+		opt  Option
+		// maximum number of PhaseProgramming reports
+		max int
+	}{
+		{"unthrottled", WithProgressInterval(0), 100},
+		{"interval", WithProgressInterval(time.Hour), 1},
+		{"delta", WithMinProgressDelta(10), 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []Progress
+			prog := New(bootloadertest.NewDevice(), tt.opt, WithProgressCallback(func(p Progress) {
+				reports = append(reports, p)
+			}))
+			if err := prog.Program(context.Background(), fw, key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			programming := 0
+			phases := map[Phase]bool{}
+			for _, r := range reports {
+				phases[r.Phase] = true
+				if r.Phase == PhaseProgramming {
+					programming++
+				}
+			}
+			if programming == 0 || programming > tt.max {
+				t.Errorf("%d programming reports, want 1 to %d", programming, tt.max)
+			}
+			for _, phase := range []Phase{PhaseEntering, PhaseProgramming, PhaseVerifying, PhaseExiting} {
+				if !phases[phase] {
+					t.Errorf("no %s report", phase)
+				}
+			}
+			if last := reports[len(reports)-1]; last.Percentage != 100 {
+				t.Errorf("last report at %.1f%%, want 100%%", last.Percentage)
+			}
+		})
+	}
+}
+
+func TestPhaseCallback(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+			{ArrayID: 0, RowNum: 0x0011, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	// Expected transitions, derived from an unthrottled progress callback
+	var want []string
+	var last Phase
+	var got []string
+	prog := New(bootloadertest.NewDevice(),
+		WithProgressCallback(func(p Progress) {
+			if p.Phase != last {
+				want = append(want, fmt.Sprintf("%s->%s", last, p.Phase))
+				last = p.Phase
+			}
+		}),
+		WithPhaseCallback(func(old, new Phase) {
+			got = append(got, fmt.Sprintf("%s->%s", old, new))
+		}),
+	)
+
+	for i := 0; i < 2; i++ {
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(got) < 5 || got[0] != "->entering" {
+		t.Errorf("transitions = %v", got)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("transitions = %v, want %v", got, want)
+	}
+
+	// Throttled progress does not affect phase transitions
+	var throttled []string
+	prog = New(bootloadertest.NewDevice(),
+		WithProgressCallback(func(Progress) {}),
+		WithProgressInterval(time.Hour),
+		WithPhaseCallback(func(old, new Phase) {
+			throttled = append(throttled, fmt.Sprintf("%s->%s", old, new))
+		}),
+	)
+	for i := 0; i < 2; i++ {
+		if err := prog.Program(context.Background(), fw, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fmt.Sprint(throttled) != fmt.Sprint(want) {
+		t.Errorf("throttled transitions = %v, want %v", throttled, want)
+	}
+}
+
+func TestProgressString(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Progress
+		want string
+	}{
+		{"entering", Progress{Phase: PhaseEntering}, "entering 0.0%"},
+		{"programming", Progress{
+			Phase: PhaseProgramming, Percentage: 42, CurrentRow: 21, TotalRows: 50,
+			BytesWritten: 2688, TotalBytes: 6400, BytesPerSecond: 1344, EstimatedRemaining: 2762 * time.Millisecond,
+		}, "programming 42.0% (row 21/50, 2688/6400 bytes, 1344 B/s, 3s left)"},
+		{"plan step", Progress{Phase: PhaseErasing, Percentage: 10, Step: 1, Steps: 3},
+			"step 2/3 erasing 10.0%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := fmt.Sprint(PhaseVerifying); got != "verifying" {
+		t.Errorf("Phase String() = %q", got)
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	started := time.Date(2024, 3, 1, 14, 15, 7, 0, time.FixedZone("CET", 3600))
+	data, err := json.Marshal(Progress{
+		Phase:              PhaseProgramming,
+		Percentage:         42.5,
+		CurrentRow:         85,
+		TotalRows:          200,
+		BytesWritten:       10880,
+		TotalBytes:         25600,
+		ElapsedTime:        1500 * time.Millisecond,
+		BytesPerSecond:     7253.3,
+		EstimatedRemaining: 2 * time.Second,
+		ChunkIndex:         1,
+		ChunkCount:         3,
+		PhaseStartedAt:     started,
+	})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"phase":"programming","percentage":42.5,"current_row":85,"total_rows":200,"rows_skipped":0,` +
+		`"bytes_written":10880,"total_bytes":25600,"elapsed_ms":1500,"bytes_per_second":7253.3,"remaining_ms":2000,` +
+		`"chunk_index":1,"chunk_count":3,"phase_started_at":"2024-03-01T13:15:07Z","step":0,"steps":0}`
+	if string(data) != want {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", data, want)
+	}
+
+	// A pointer marshals the same way, and an unset phase start is omitted
+	data, err = json.Marshal(&Progress{Phase: PhaseEntering})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["phase"] != "entering" {
+		t.Errorf("phase = %v", fields["phase"])
+	}
+	if _, ok := fields["phase_started_at"]; ok {
+		t.Error("unset phase_started_at is included")
+	}
+}
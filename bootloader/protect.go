@@ -0,0 +1,54 @@
+package bootloader
+
+import (
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// RowRange is an inclusive range of flash rows in one flash array.
+type RowRange struct {
+	ArrayID uint8
+	First   uint16
+	Last    uint16
+}
+
+// Contains reports whether the row lies within the range.
+func (r RowRange) Contains(arrayID uint8, rowNum uint16) bool {
+	return arrayID == r.ArrayID && rowNum >= r.First && rowNum <= r.Last
+}
+
+func (r RowRange) String() string {
+	return fmt.Sprintf("array %d rows %d-%d", r.ArrayID, r.First, r.Last)
+}
+
+// checkProtected returns a *ProtectedRowError if the row lies in a protected range
+// and writes to protected rows have not been explicitly allowed.
+func (p *Programmer) checkProtected(arrayID uint8, rowNum uint16) error {
+	if p.config.AllowProtectedRows {
+		return nil
+	}
+
+	for _, r := range p.config.ProtectedRows {
+		if r.Contains(arrayID, rowNum) {
+			return &ProtectedRowError{
+				ArrayID: arrayID,
+				RowNum:  rowNum,
+				Range:   r,
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkProtectedRows checks every firmware row against the protected ranges,
+// so a mis-built image is rejected before anything is written.
+func (p *Programmer) checkProtectedRows(rows []*cyacd.Row) error {
+	for _, row := range rows {
+		if err := p.checkProtected(row.ArrayID, row.RowNum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
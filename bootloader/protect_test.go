@@ -0,0 +1,80 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestProgramProtectedRows(t *testing.T) {
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0040, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+			{ArrayID: 0x00, RowNum: 0x0010, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	bootloaderRows := RowRange{ArrayID: 0, First: 0, Last: 0x3F}
+
+	t.Run("refused", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+
+		prog := New(device, WithProtectedRows(bootloaderRows))
+		report, err := prog.ProgramWithReport(context.Background(), firmware, key)
+
+		var protErr *ProtectedRowError
+		if !errors.As(err, &protErr) {
+			t.Fatalf("error = %v, want *ProtectedRowError", err)
+		}
+		if protErr.RowNum != 0x0010 {
+			t.Errorf("RowNum = %d, want 16", protErr.RowNum)
+		}
+		if report.RowsProgrammed != 0 {
+			t.Errorf("RowsProgrammed = %d, want 0", report.RowsProgrammed)
+		}
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		device := NewMockDevice()
+		device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+		device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, nil)
+		device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+		device.AddResponse(protocol.StatusSuccess, nil)
+
+		prog := New(device, WithVerifyAfterProgram(false),
+			WithProtectedRows(bootloaderRows), WithAllowProtectedRows())
+		if err := prog.Program(context.Background(), firmware, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestEraseRowProtected(t *testing.T) {
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, nil)
+
+	prog := New(device, WithProtectedRows(RowRange{ArrayID: 0, First: 0, Last: 0x3F}))
+
+	var protErr *ProtectedRowError
+	if err := prog.EraseRow(context.Background(), 0, 0x20); !errors.As(err, &protErr) {
+		t.Fatalf("error = %v, want *ProtectedRowError", err)
+	}
+	if device.writeBuf.Len() != 0 {
+		t.Error("protected row erase was sent to the device")
+	}
+
+	if err := prog.EraseRow(context.Background(), 0, 0x40); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written := device.writeBuf.Bytes(); written[1] != protocol.CmdEraseRow {
+		t.Errorf("command = 0x%02X, want Erase Row", written[1])
+	}
+}
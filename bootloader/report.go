@@ -0,0 +1,257 @@
+package bootloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// ProgramReport summarizes a programming session.
+// Returned by ProgramWithReport, including when programming fails.
+type ProgramReport struct {
+	// DeviceID identifies the programmed device (see WithDeviceID)
+	DeviceID string
+
+	// FirmwareFingerprint identifies the programmed image (see cyacd.Firmware.Fingerprint)
+	FirmwareFingerprint string
+
+	// DeviceInfo is the identification returned by Enter Bootloader
+	// (nil if the bootloader could not be entered)
+	DeviceInfo *protocol.DeviceInfo
+
+	// TotalRows is the number of rows in the firmware image
+	TotalRows int
+
+	// RowsSkipped is the number of rows excluded by the row filter (see WithRowFilter)
+	// or dropped as bootloader rows (see WithSkipBootloaderRows)
+	RowsSkipped int
+
+	// BootloaderRows lists the ranges of firmware rows that were not programmed
+	// because they lie in the bootloader (see WithSkipBootloaderRows)
+	BootloaderRows []RowRange
+
+	// RowsProgrammed is the number of rows successfully programmed
+	RowsProgrammed int
+
+	// BytesWritten is the number of row data bytes successfully programmed
+	BytesWritten int
+
+	// VerifyEvery is the row verification interval applied: 1 if every row was
+	// verified, n for every nth row (see WithVerifyEvery), 0 if rows were not verified
+	VerifyEvery int
+
+	// RowsVerified is the number of rows whose checksum was read back and matched,
+	// including retried rows verified by WithAdaptiveVerify
+	RowsVerified int
+
+	// Duration is the total time spent in the programming session
+	Duration time.Duration
+
+	// ExitAcknowledged reports whether the bootloader acknowledged Exit
+	// Bootloader (see WithExitResponseExpected); always false with
+	// ExitNoResponse or when the bootloader was not exited
+	ExitAcknowledged bool
+
+	// RollbackPerformed reports whether the previously active application was
+	// restored after a failed update (see WithRollback)
+	RollbackPerformed bool
+
+	// RollbackApp is the application number that was restored as active.
+	// Only meaningful when RollbackPerformed is true.
+	RollbackApp byte
+
+	// AppMetadata is the application metadata read back from the device
+	// (nil unless WithAppValidation is enabled and the metadata was read)
+	AppMetadata *protocol.Metadata
+
+	// Stats contains command timing and throughput statistics of the session
+	Stats *Stats
+
+	// Rows holds the outcome of every row programmed or attempted, in programming order
+	Rows []RowResult
+
+	// Err is the error that failed the session, or nil on success
+	Err error
+
+	// CancelCause is the reason the session was canceled (see context.Cause):
+	// the cause given to the cancel function, ErrAborted after Abort, or
+	// context.DeadlineExceeded. Nil unless the session was canceled.
+	CancelCause error
+}
+
+// ReportSchemaVersion is the version of the schema written by
+// ProgramReport.WriteJSON and WriteCSV. Fields and columns are only ever
+// added; a change that renames or removes one increments the version.
+const ReportSchemaVersion = 1
+
+// reportJSON is the stable JSON representation of a ProgramReport.
+type reportJSON struct {
+	SchemaVersion       int             `json:"schema_version"`
+	DeviceID            string          `json:"device_id"`
+	SiliconID           string          `json:"silicon_id"`
+	SiliconRev          string          `json:"silicon_rev"`
+	BootloaderVersion   string          `json:"bootloader_version"`
+	FirmwareFingerprint string          `json:"firmware_fingerprint"`
+	Success             bool            `json:"success"`
+	Error               string          `json:"error"`
+	CancelCause         string          `json:"cancel_cause,omitempty"`
+	TotalRows           int             `json:"total_rows"`
+	RowsSkipped         int             `json:"rows_skipped"`
+	BootloaderRows      []string        `json:"bootloader_rows,omitempty"`
+	RowsProgrammed      int             `json:"rows_programmed"`
+	RowsVerified        int             `json:"rows_verified"`
+	BytesWritten        int             `json:"bytes_written"`
+	DurationMs          float64         `json:"duration_ms"`
+	ExitAcknowledged    bool            `json:"exit_acknowledged"`
+	RollbackPerformed   bool            `json:"rollback_performed"`
+	RollbackApp         byte            `json:"rollback_app"`
+	Rows                []rowReportJSON `json:"rows"`
+}
+
+// rowReportJSON is the stable JSON representation of a RowResult.
+type rowReportJSON struct {
+	Index          int     `json:"index"`
+	ArrayID        byte    `json:"array_id"`
+	RowNum         uint16  `json:"row"`
+	Bytes          int     `json:"bytes"`
+	DurationMs     float64 `json:"duration_ms"`
+	Verified       bool    `json:"verified"`
+	DeviceChecksum string  `json:"device_checksum"`
+	Retries        int     `json:"retries"`
+	Error          string  `json:"error"`
+}
+
+// reportCSVHeader lists the columns written by WriteCSV.
+var reportCSVHeader = []string{
+	"schema_version", "device_id", "silicon_id", "firmware_fingerprint",
+	"index", "array_id", "row", "bytes", "duration_ms", "verified",
+	"device_checksum", "retries", "error",
+}
+
+// WriteJSON writes the report as a single JSON object with a stable schema
+// (see ReportSchemaVersion), for ingestion by manufacturing execution systems.
+// Durations are in milliseconds; silicon ID, revision, and checksums are
+// hex strings such as "0x1E9602AA".
+//
+// Example:
+//
+//	report, err := prog.ProgramWithReport(ctx, fw, key)
+//	_ = report.WriteJSON(resultFile)
+func (r *ProgramReport) WriteJSON(w io.Writer) error {
+	out := reportJSON{
+		SchemaVersion:       ReportSchemaVersion,
+		DeviceID:            r.DeviceID,
+		FirmwareFingerprint: r.FirmwareFingerprint,
+		Success:             r.Err == nil,
+		TotalRows:           r.TotalRows,
+		RowsSkipped:         r.RowsSkipped,
+		RowsProgrammed:      r.RowsProgrammed,
+		RowsVerified:        r.RowsVerified,
+		BytesWritten:        r.BytesWritten,
+		DurationMs:          durationMs(r.Duration),
+		ExitAcknowledged:    r.ExitAcknowledged,
+		RollbackPerformed:   r.RollbackPerformed,
+		RollbackApp:         r.RollbackApp,
+		Rows:                make([]rowReportJSON, 0, len(r.Rows)),
+	}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	if r.CancelCause != nil {
+		out.CancelCause = r.CancelCause.Error()
+	}
+	for _, rr := range r.BootloaderRows {
+		out.BootloaderRows = append(out.BootloaderRows, rr.String())
+	}
+	if info := r.DeviceInfo; info != nil {
+		out.SiliconID = fmt.Sprintf("0x%08X", info.SiliconID)
+		out.SiliconRev = fmt.Sprintf("0x%02X", info.SiliconRev)
+		out.BootloaderVersion = fmt.Sprintf("%d.%d.%d", info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2])
+	}
+
+	for _, row := range r.Rows {
+		rj := rowReportJSON{
+			Index:      row.Index,
+			ArrayID:    row.ArrayID,
+			RowNum:     row.RowNum,
+			Bytes:      row.Bytes,
+			DurationMs: durationMs(row.Duration),
+			Verified:   row.Verified,
+			Retries:    row.Retries,
+		}
+		if row.Verified {
+			rj.DeviceChecksum = fmt.Sprintf("0x%02X", row.DeviceChecksum)
+		}
+		if row.Err != nil {
+			rj.Error = row.Err.Error()
+		}
+		out.Rows = append(out.Rows, rj)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteCSV writes one CSV record per row result, preceded by a header line,
+// with a stable set of columns (see ReportSchemaVersion). Every record repeats
+// the device ID, silicon ID, and firmware fingerprint so that records from
+// many devices can be concatenated. Session totals and the session error are
+// only part of WriteJSON.
+//
+// Example:
+//
+//	report, _ := prog.ProgramWithReport(ctx, fw, key)
+//	_ = report.WriteCSV(rowLog)
+func (r *ProgramReport) WriteCSV(w io.Writer) error {
+	siliconID := ""
+	if r.DeviceInfo != nil {
+		siliconID = fmt.Sprintf("0x%08X", r.DeviceInfo.SiliconID)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(reportCSVHeader); err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		checksum, errText := "", ""
+		if row.Verified {
+			checksum = fmt.Sprintf("0x%02X", row.DeviceChecksum)
+		}
+		if row.Err != nil {
+			errText = row.Err.Error()
+		}
+
+		record := []string{
+			strconv.Itoa(ReportSchemaVersion),
+			r.DeviceID,
+			siliconID,
+			r.FirmwareFingerprint,
+			strconv.Itoa(row.Index),
+			strconv.Itoa(int(row.ArrayID)),
+			strconv.Itoa(int(row.RowNum)),
+			strconv.Itoa(row.Bytes),
+			strconv.FormatFloat(durationMs(row.Duration), 'f', -1, 64),
+			strconv.FormatBool(row.Verified),
+			checksum,
+			strconv.Itoa(row.Retries),
+			errText,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// durationMs converts d to fractional milliseconds.
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,100 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestReportExport(t *testing.T) {
+	fw := journalFirmware()
+	device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultEOF,
+		Command: protocol.CmdProgramRow,
+		Skip:    1,
+	}))
+
+	prog := New(device, WithDeviceID("SN-0042"), WithRetries(0))
+	report, err := prog.ProgramWithReport(context.Background(), fw, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	if err == nil {
+		t.Fatal("expected programming to fail")
+	}
+	if report.Err != err {
+		t.Errorf("report.Err = %v, want %v", report.Err, err)
+	}
+	if len(report.Rows) != 2 {
+		t.Fatalf("report has %d rows, want 2", len(report.Rows))
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJSON(&buf); err != nil {
+			t.Fatalf("WriteJSON: %v", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+
+		want := map[string]interface{}{
+			"schema_version":       float64(ReportSchemaVersion),
+			"device_id":            "SN-0042",
+			"silicon_id":           "0x1E9602AA",
+			"firmware_fingerprint": fw.Fingerprint(),
+			"success":              false,
+			"rows_programmed":      float64(1),
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%s = %v, want %v", key, got[key], value)
+			}
+		}
+		if got["error"] == "" {
+			t.Error("error is empty")
+		}
+
+		rows, _ := got["rows"].([]interface{})
+		if len(rows) != 2 {
+			t.Fatalf("rows = %v, want 2 entries", got["rows"])
+		}
+		first := rows[0].(map[string]interface{})
+		if first["row"] != float64(0x0010) || first["verified"] != true || first["error"] != "" {
+			t.Errorf("rows[0] = %v", first)
+		}
+		if second := rows[1].(map[string]interface{}); second["error"] == "" {
+			t.Errorf("rows[1] = %v, want an error", second)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			t.Fatalf("WriteCSV: %v", err)
+		}
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV: %v", err)
+		}
+		if len(records) != 3 {
+			t.Fatalf("got %d records, want header and 2 rows", len(records))
+		}
+		if len(records[0]) != len(reportCSVHeader) || records[0][0] != "schema_version" {
+			t.Errorf("header = %v", records[0])
+		}
+
+		first := records[1]
+		if first[1] != "SN-0042" || first[2] != "0x1E9602AA" || first[6] != "16" || first[9] != "true" || first[12] != "" {
+			t.Errorf("first record = %v", first)
+		}
+		if records[2][12] == "" {
+			t.Errorf("failed row has no error: %v", records[2])
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Resetter resets the target into its bootloader. When configured with
+// WithResetter, the Programmer calls it before every Enter Bootloader, so boards
+// that only start the bootloader after a reset can be programmed without manual
+// intervention.
+type Resetter func(ctx context.Context) error
+
+// Line identifies a serial modem control line.
+type Line int
+
+// Modem control lines used by LineResetter.
+const (
+	// LineNone leaves the signal unconnected
+	LineNone Line = iota
+
+	// LineDTR is Data Terminal Ready
+	LineDTR
+
+	// LineRTS is Request To Send
+	LineRTS
+)
+
+// String returns the name of the line.
+func (l Line) String() string {
+	switch l {
+	case LineDTR:
+		return "DTR"
+	case LineRTS:
+		return "RTS"
+	default:
+		return "none"
+	}
+}
+
+// Default LineReset timing.
+const (
+	// DefaultResetPulse is how long the reset line is held active
+	DefaultResetPulse = 100 * time.Millisecond
+
+	// DefaultResetSettle is how long to wait after reset for the bootloader to start
+	DefaultResetSettle = 50 * time.Millisecond
+)
+
+// LineReset describes how a board wires its reset and boot pins to the serial
+// modem control lines.
+//
+// A line is "active" when the pin it drives is in the state that resets the
+// target (or selects the bootloader). USB-UART bridges drive the pins low when a
+// line is asserted, so an active-low pin like XRES uses the default polarity;
+// set the Invert flag for pins that are active when the line is deasserted.
+type LineReset struct {
+	// Reset is the line wired to the target reset pin
+	Reset Line
+
+	// InvertReset makes the reset pin active when the line is deasserted
+	InvertReset bool
+
+	// Boot is the line wired to a bootloader-select pin (LineNone if the
+	// bootloader always runs after reset)
+	Boot Line
+
+	// InvertBoot makes the boot pin active when the line is deasserted
+	InvertBoot bool
+
+	// Pulse is how long reset is held active
+	// Default is DefaultResetPulse
+	Pulse time.Duration
+
+	// Settle is the delay after releasing reset before Enter Bootloader is sent
+	// Default is DefaultResetSettle
+	Settle time.Duration
+}
+
+// LineResetter returns a Resetter that toggles the DTR and RTS lines of port:
+// it activates the boot line (if any) and the reset line, holds reset for
+// cfg.Pulse, releases reset, waits cfg.Settle for the bootloader to start, and
+// then releases the boot line. When run by a Programmer, the pulse and settle
+// delays follow its Clock (see WithClock).
+//
+// Example:
+//
+//	port, _ := serial.Open("/dev/ttyUSB0", mode)
+//	prog := bootloader.New(port, bootloader.WithResetter(
+//	    bootloader.LineResetter(port, bootloader.LineReset{
+//	        Reset: bootloader.LineDTR,
+//	        Boot:  bootloader.LineRTS,
+//	    }),
+//	))
+func LineResetter(port ModemControl, cfg LineReset) Resetter {
+	if cfg.Pulse <= 0 {
+		cfg.Pulse = DefaultResetPulse
+	}
+	if cfg.Settle <= 0 {
+		cfg.Settle = DefaultResetSettle
+	}
+
+	set := func(line Line, active, invert bool) error {
+		level := active != invert
+		var err error
+		switch line {
+		case LineDTR:
+			err = port.SetDTR(level)
+		case LineRTS:
+			err = port.SetRTS(level)
+		default:
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("set %s: %w", line, err)
+		}
+		return nil
+	}
+
+	return func(ctx context.Context) error {
+		clock := contextClock(ctx)
+		if err := set(cfg.Boot, true, cfg.InvertBoot); err != nil {
+			return err
+		}
+		// Release the boot line however the sequence ends
+		defer func() { _ = set(cfg.Boot, false, cfg.InvertBoot) }()
+
+		if err := set(cfg.Reset, true, cfg.InvertReset); err != nil {
+			return err
+		}
+		pulseErr := clock.Sleep(ctx, cfg.Pulse)
+		if err := set(cfg.Reset, false, cfg.InvertReset); err != nil {
+			return err
+		}
+		if pulseErr != nil {
+			return pulseErr
+		}
+
+		return clock.Sleep(ctx, cfg.Settle)
+	}
+}
+
+// resetTarget runs the configured Resetter before entering the bootloader and
+// discards anything the target sent while restarting.
+func (p *Programmer) resetTarget(ctx context.Context) error {
+	if p.config.Resetter == nil {
+		return nil
+	}
+
+	p.logDebug("resetting target into bootloader")
+	if err := p.config.Resetter(withClock(ctx, p.clock)); err != nil {
+		return fmt.Errorf("reset target: %w", err)
+	}
+
+	if f, ok := p.device.(InputFlusher); ok {
+		_ = f.ResetInputBuffer()
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+)
+
+// modemPort records modem control line changes
+type modemPort struct {
+	*bootloadertest.Device
+	events []string
+	err    error
+}
+
+func (m *modemPort) SetDTR(dtr bool) error {
+	m.events = append(m.events, fmt.Sprintf("DTR=%t", dtr))
+	return m.err
+}
+
+func (m *modemPort) SetRTS(rts bool) error {
+	m.events = append(m.events, fmt.Sprintf("RTS=%t", rts))
+	return m.err
+}
+
+func TestLineResetter(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LineReset
+		want []string
+	}{
+		{
+			name: "reset only",
+			cfg:  LineReset{Reset: LineDTR},
+			want: []string{"DTR=true", "DTR=false"},
+		},
+		{
+			name: "reset and boot",
+			cfg:  LineReset{Reset: LineDTR, Boot: LineRTS},
+			want: []string{"RTS=true", "DTR=true", "DTR=false", "RTS=false"},
+		},
+		{
+			name: "inverted polarity",
+			cfg:  LineReset{Reset: LineRTS, InvertReset: true, Boot: LineDTR, InvertBoot: true},
+			want: []string{"DTR=false", "RTS=false", "RTS=true", "DTR=true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &modemPort{}
+			tt.cfg.Pulse = time.Millisecond
+			tt.cfg.Settle = time.Millisecond
+
+			if err := LineResetter(port, tt.cfg)(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(port.events, tt.want) {
+				t.Errorf("events = %v, want %v", port.events, tt.want)
+			}
+		})
+	}
+
+	t.Run("line error", func(t *testing.T) {
+		port := &modemPort{err: errors.New("not a tty")}
+		err := LineResetter(port, LineReset{Reset: LineDTR})(context.Background())
+		if err == nil || err.Error() != "set DTR: not a tty" {
+			t.Errorf("error = %v, want set DTR failure", err)
+		}
+	})
+
+	t.Run("canceled pulse releases reset", func(t *testing.T) {
+		port := &modemPort{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := LineResetter(port, LineReset{Reset: LineDTR, Pulse: time.Hour})(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("error = %v, want context.Canceled", err)
+		}
+		if want := []string{"DTR=true", "DTR=false"}; !reflect.DeepEqual(port.events, want) {
+			t.Errorf("events = %v, want %v", port.events, want)
+		}
+	})
+}
+
+func TestProgrammerResetsBeforeEnter(t *testing.T) {
+	port := &modemPort{Device: bootloadertest.NewDevice()}
+	prog := New(port, WithResetter(LineResetter(port, LineReset{
+		Reset:  LineDTR,
+		Pulse:  time.Millisecond,
+		Settle: time.Millisecond,
+	})))
+
+	if _, err := prog.EnterBootloader(context.Background(), []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(port.events) != 2 {
+		t.Errorf("events = %v, want a reset pulse", port.events)
+	}
+
+	t.Run("delays follow the programmer clock", func(t *testing.T) {
+		port := &modemPort{Device: bootloadertest.NewDevice()}
+		clock := bootloadertest.NewClock(time.Unix(0, 0))
+		prog := New(port, WithClock(clock), WithResetter(LineResetter(port, LineReset{Reset: LineDTR})))
+
+		if _, err := prog.EnterBootloader(context.Background(), []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sleeps := clock.Sleeps()
+		if len(sleeps) < 2 || sleeps[0] != DefaultResetPulse || sleeps[1] != DefaultResetSettle {
+			t.Errorf("sleeps = %v, want the reset pulse and settle delays first", sleeps)
+		}
+	})
+
+	t.Run("reset failure aborts entry", func(t *testing.T) {
+		device := bootloadertest.NewDevice()
+		prog := New(device, WithResetter(func(ctx context.Context) error {
+			return errors.New("port closed")
+		}))
+
+		_, err := prog.EnterBootloader(context.Background(), []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if n := len(device.Commands()); n != 0 {
+			t.Errorf("%d commands sent after reset failed", n)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// skipBootloaderRows drops the rows that lie below the first programmable row
+// of their flash array, as reported by Get Flash Size: in an image that
+// combines the bootloader with the application, those rows hold the
+// bootloader itself. It returns the remaining rows and the dropped rows as
+// ranges of consecutive rows.
+func (p *Programmer) skipBootloaderRows(ctx context.Context, rows []*cyacd.Row) ([]*cyacd.Row, []RowRange, error) {
+	startRows := make(map[byte]uint16)
+	kept := make([]*cyacd.Row, 0, len(rows))
+	var dropped []RowRange
+	for _, row := range rows {
+		start, ok := startRows[row.ArrayID]
+		if !ok {
+			flashSize, err := p.getFlashSize(ctx, row.ArrayID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("get flash size of array %d: %w", row.ArrayID, err)
+			}
+			start = flashSize.StartRow
+			startRows[row.ArrayID] = start
+		}
+
+		if row.RowNum >= start {
+			kept = append(kept, row)
+			continue
+		}
+		if n := len(dropped); n > 0 && dropped[n-1].ArrayID == row.ArrayID && dropped[n-1].Last+1 == row.RowNum {
+			dropped[n-1].Last = row.RowNum
+		} else {
+			dropped = append(dropped, RowRange{ArrayID: row.ArrayID, First: row.RowNum, Last: row.RowNum})
+		}
+	}
+
+	for _, r := range dropped {
+		p.logInfo("skipping bootloader rows", "array", r.ArrayID, "first", r.First, "last", r.Last)
+	}
+	return kept, dropped, nil
+}
@@ -0,0 +1,48 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+)
+
+func TestSkipBootloaderRows(t *testing.T) {
+	fw := journalFirmware() // rows 0x10-0x13
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	// Without the option, rows in the bootloader fail the update
+	device := bootloadertest.NewDevice(bootloadertest.WithFlashRange(0x0012, 0x01FF))
+	var rangeErr *RowOutOfRangeError
+	if err := New(device).Program(context.Background(), fw, key); !errors.As(err, &rangeErr) {
+		t.Fatalf("Program = %v, want *RowOutOfRangeError", err)
+	}
+
+	device = bootloadertest.NewDevice(bootloadertest.WithFlashRange(0x0012, 0x01FF))
+	var last Progress
+	prog := New(device, WithSkipBootloaderRows(), WithProgressCallback(func(p Progress) { last = p }))
+	report, err := prog.ProgramWithReport(context.Background(), fw, key)
+	if err != nil {
+		t.Fatalf("ProgramWithReport: %v", err)
+	}
+
+	want := RowRange{ArrayID: 0, First: 0x10, Last: 0x11}
+	if len(report.BootloaderRows) != 1 || report.BootloaderRows[0] != want {
+		t.Errorf("BootloaderRows = %v, want [%v]", report.BootloaderRows, want)
+	}
+	if report.RowsSkipped != 2 || report.RowsProgrammed != 2 {
+		t.Errorf("RowsSkipped = %d, RowsProgrammed = %d, want 2 and 2", report.RowsSkipped, report.RowsProgrammed)
+	}
+	if last.TotalRows != 2 || last.RowsSkipped != 2 {
+		t.Errorf("progress TotalRows = %d, RowsSkipped = %d, want 2 and 2", last.TotalRows, last.RowsSkipped)
+	}
+	for _, row := range []uint16{0x10, 0x11} {
+		if _, ok := device.Row(0, row); ok {
+			t.Errorf("bootloader row 0x%02X was programmed", row)
+		}
+	}
+	if _, ok := device.Row(0, 0x13); !ok {
+		t.Error("row 0x13 was not programmed")
+	}
+}
@@ -0,0 +1,103 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Connect enters the bootloader and holds the session open across multiple operations.
+// While connected, Program reuses the session instead of entering the bootloader
+// again, and does not exit the bootloader when it finishes. Other operations such
+// as GetMetadata, VerifyChecksum, or Ping can be freely interleaved.
+//
+// Call Close to exit the bootloader and end the session.
+//
+// Example:
+//
+//	info, err := prog.Connect(ctx, key)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer prog.Close(ctx)
+//
+//	meta, _ := prog.GetMetadata(ctx, 0)
+//	err = prog.Program(ctx, fw, nil)
+func (p *Programmer) Connect(ctx context.Context, key []byte) (*protocol.DeviceInfo, error) {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	if p.sessionInfo() != nil {
+		return nil, fmt.Errorf("already connected")
+	}
+
+	info, err := p.enterBootloader(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("enter bootloader: %w", err)
+	}
+
+	p.opMu.Lock()
+	p.session = info
+	p.opMu.Unlock()
+	p.setState(StateInBootloader)
+
+	p.logDebug("session opened",
+		"silicon_id", fmt.Sprintf("0x%08X", info.SiliconID),
+		"silicon_rev", fmt.Sprintf("0x%02X", info.SiliconRev),
+	)
+
+	return info, nil
+}
+
+// Close ends the session opened by Connect by exiting the bootloader.
+// Calling Close without an open session is a no-op for the bootloader.
+//
+// The device passed to New is owned by the caller and is not closed, unless
+// ownership was transferred with WithDeviceOwnership, in which case Close also
+// closes the device if it implements io.Closer.
+func (p *Programmer) Close(ctx context.Context) error {
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	p.opMu.Lock()
+	connected := p.session != nil
+	p.session = nil
+	p.opMu.Unlock()
+
+	var exitErr error
+	if connected {
+		exitErr = p.exitBootloader(ctx)
+		p.logDebug("session closed")
+	}
+	p.setState(StateIdle)
+
+	if p.config.OwnsDevice {
+		if c, ok := p.device.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return fmt.Errorf("close device: %w", err)
+			}
+		}
+	}
+
+	return exitErr
+}
+
+// Connected reports whether a session opened by Connect is active.
+func (p *Programmer) Connected() bool {
+	return p.sessionInfo() != nil
+}
+
+// sessionInfo returns the device information of the open session, or nil.
+func (p *Programmer) sessionInfo() *protocol.DeviceInfo {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	return p.session
+}
@@ -0,0 +1,181 @@
+package bootloader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// closingDevice is a MockDevice that records Close calls
+type closingDevice struct {
+	*MockDevice
+	closed bool
+}
+
+func (d *closingDevice) Close() error {
+	d.closed = true
+	return nil
+}
+
+// commandsWritten returns the command byte of every frame written to the device
+func commandsWritten(t *testing.T, written []byte) []byte {
+	t.Helper()
+
+	var cmds []byte
+	for len(written) > 0 {
+		if len(written) < protocol.MinFrameSize {
+			t.Fatalf("truncated frame: % 02X", written)
+		}
+		dataLen := int(written[2]) | int(written[3])<<8
+		cmds = append(cmds, written[1])
+		written = written[protocol.MinFrameSize+dataLen:]
+	}
+	return cmds
+}
+
+func TestSession(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0000, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+
+	device := &closingDevice{MockDevice: NewMockDevice()}
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+	// Program: flash size, program row, verify checksum
+	device.AddResponse(protocol.StatusSuccess, []byte{0x00, 0x00, 0xFF, 0x01})
+	device.AddResponse(protocol.StatusSuccess, nil)
+	device.AddResponse(protocol.StatusSuccess, []byte{0x01})
+	// Exit bootloader
+	device.AddResponse(protocol.StatusSuccess, nil)
+
+	prog := New(device, WithVerifyAfterProgram(false), WithDeviceOwnership())
+	ctx := context.Background()
+
+	info, err := prog.Connect(ctx, key)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if info.SiliconID != 0x1E9602AA {
+		t.Errorf("SiliconID = 0x%08X, want 0x1E9602AA", info.SiliconID)
+	}
+	if !prog.Connected() {
+		t.Error("Connected() = false after Connect")
+	}
+
+	if _, err := prog.Connect(ctx, key); err == nil {
+		t.Error("expected error connecting twice")
+	}
+
+	if err := prog.Program(ctx, firmware, nil); err != nil {
+		t.Fatalf("program in session: %v", err)
+	}
+	if !prog.Connected() {
+		t.Error("Program ended the session")
+	}
+
+	if err := prog.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if prog.Connected() {
+		t.Error("Connected() = true after Close")
+	}
+	if !device.closed {
+		t.Error("owned device was not closed")
+	}
+
+	want := []byte{
+		protocol.CmdEnterBootloader,
+		protocol.CmdGetFlashSize,
+		protocol.CmdProgramRow,
+		protocol.CmdVerifyChecksum,
+		protocol.CmdExitBootloader,
+	}
+	got := commandsWritten(t, device.writeBuf.Bytes())
+	if string(got) != string(want) {
+		t.Errorf("commands = % 02X, want % 02X", got, want)
+	}
+}
+
+func TestCloseDoesNotCloseCallerDevice(t *testing.T) {
+	device := &closingDevice{MockDevice: NewMockDevice()}
+
+	prog := New(device)
+	if err := prog.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if device.closed {
+		t.Error("device closed without ownership")
+	}
+	if device.writeBuf.Len() != 0 {
+		t.Error("Close without a session wrote to the device")
+	}
+}
+
+func TestFlashSizeCache(t *testing.T) {
+	ctx := context.Background()
+	key := []byte(protocol.DefaultExampleKey)
+	device := bootloadertest.NewDevice()
+	prog := New(device)
+
+	flashSizeQueries := func() int {
+		n := 0
+		for _, cmd := range device.Commands() {
+			if cmd == protocol.CmdGetFlashSize {
+				n++
+			}
+		}
+		return n
+	}
+
+	if _, err := prog.Connect(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := prog.GetFlashSize(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := prog.Program(ctx, journalFirmware(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := flashSizeQueries(); n != 1 {
+		t.Errorf("%d Get Flash Size commands in a session, want 1", n)
+	}
+
+	// Ping always reaches the device
+	if _, err := prog.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := flashSizeQueries(); n != 2 {
+		t.Errorf("%d Get Flash Size commands after Ping, want 2", n)
+	}
+
+	prog.InvalidateCaches()
+	if _, err := prog.GetFlashSize(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := flashSizeQueries(); n != 3 {
+		t.Errorf("%d Get Flash Size commands after InvalidateCaches, want 3", n)
+	}
+
+	// A new session starts with an empty cache
+	if err := prog.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prog.Connect(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prog.GetFlashSize(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := flashSizeQueries(); n != 4 {
+		t.Errorf("%d Get Flash Size commands in a new session, want 4", n)
+	}
+}
@@ -0,0 +1,75 @@
+package bootloader
+
+// State is the session state of a Programmer.
+// Use the exported State constants for comparisons.
+type State string
+
+// State constants reported by Programmer.State and StateCallback.
+//
+// Typical transitions:
+//
+//	Idle -> InBootloader -> Programming -> Verifying -> Done
+//	                                    \-> Failed
+//
+// With a session opened by Connect, a successful Program returns to
+// InBootloader instead of Done, and Close returns to Idle.
+const (
+	// StateIdle indicates no operation is running and the device is not held in the bootloader
+	StateIdle State = "idle"
+
+	// StateInBootloader indicates the device is in bootloader mode and no rows are being written
+	StateInBootloader State = "in_bootloader"
+
+	// StateProgramming indicates flash rows are being written
+	StateProgramming State = "programming"
+
+	// StateVerifying indicates the application checksum is being verified
+	StateVerifying State = "verifying"
+
+	// StateFailed indicates the last operation failed; the device may still be in the bootloader
+	StateFailed State = "failed"
+
+	// StateDone indicates the last programming operation completed and the bootloader was exited
+	StateDone State = "done"
+)
+
+// StateCallback is called on every state change with the previous and new state.
+// It is called synchronously from the goroutine running the operation and should
+// return quickly.
+type StateCallback func(from, to State)
+
+// State returns the current session state.
+//
+// Abort is only useful while the state is StateProgramming or StateVerifying
+// (or while entering the bootloader); Close is needed whenever the device may
+// still be held in the bootloader, i.e. StateInBootloader or StateFailed.
+func (p *Programmer) State() State {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+
+	if p.state == "" {
+		return StateIdle
+	}
+	return p.state
+}
+
+// setState records a state change and notifies the StateCallback.
+func (p *Programmer) setState(to State) {
+	p.opMu.Lock()
+	from := p.state
+	if from == "" {
+		from = StateIdle
+	}
+	p.state = to
+	p.opMu.Unlock()
+
+	if from == to {
+		return
+	}
+
+	p.logDebug("state changed", "from", string(from), "to", string(to))
+
+	if p.config.StateCallback != nil {
+		p.config.StateCallback(from, to)
+	}
+}
@@ -0,0 +1,94 @@
+package bootloader
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestStateTransitions(t *testing.T) {
+	firmware := &cyacd.Firmware{
+		SiliconID: 0x1E9602AA,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0x00, RowNum: 0x0010, Size: 4, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name      string
+		responses []byte // status codes; nil data except for enter/flash size/checksum
+		want      []State
+		wantFinal State
+	}{
+		{
+			name:      "success",
+			responses: []byte{protocol.StatusSuccess, protocol.StatusSuccess, protocol.StatusSuccess, protocol.StatusSuccess, protocol.StatusSuccess},
+			want:      []State{StateInBootloader, StateProgramming, StateVerifying, StateDone},
+			wantFinal: StateDone,
+		},
+		{
+			name:      "row failure",
+			responses: []byte{protocol.StatusSuccess, protocol.StatusSuccess, protocol.ErrRow},
+			want:      []State{StateInBootloader, StateProgramming, StateFailed},
+			wantFinal: StateFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := NewMockDevice()
+			data := [][]byte{
+				{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00},
+				{0x00, 0x00, 0xFF, 0x01},
+				nil,
+				{0x01},
+				nil,
+			}
+			for i, status := range tt.responses {
+				device.AddResponse(status, data[i])
+			}
+
+			var got []State
+			prog := New(device,
+				WithVerifyAfterProgram(false),
+				WithStateCallback(func(from, to State) { got = append(got, to) }),
+			)
+			if prog.State() != StateIdle {
+				t.Fatalf("initial State() = %s, want %s", prog.State(), StateIdle)
+			}
+
+			_ = prog.Program(context.Background(), firmware, key)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+			if prog.State() != tt.wantFinal {
+				t.Errorf("State() = %s, want %s", prog.State(), tt.wantFinal)
+			}
+		})
+	}
+}
+
+func TestStateSession(t *testing.T) {
+	device := NewMockDevice()
+	device.AddResponse(protocol.StatusSuccess, []byte{0xAA, 0x02, 0x96, 0x1E, 0x00, 0x01, 0x1E, 0x00})
+
+	prog := New(device)
+	if _, err := prog.Connect(context.Background(), []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if prog.State() != StateInBootloader {
+		t.Errorf("State() after Connect = %s, want %s", prog.State(), StateInBootloader)
+	}
+
+	if err := prog.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if prog.State() != StateIdle {
+		t.Errorf("State() after Close = %s, want %s", prog.State(), StateIdle)
+	}
+}
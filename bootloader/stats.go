@@ -0,0 +1,152 @@
+package bootloader
+
+import (
+	"sort"
+	"time"
+)
+
+// CommandStats summarizes the round trips of one command code during a session.
+type CommandStats struct {
+	// Command is the command code
+	Command byte
+
+	// Count is the number of times the command was sent
+	Count int
+
+	// Errors is the number of sends that failed at the transport level
+	// (write error, read timeout, malformed response)
+	Errors int
+
+	// Total, Min, and Max are the round-trip latencies: from the start of the
+	// write until the complete response was read (write only for commands
+	// without a response)
+	Total time.Duration
+	Min   time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average round-trip latency of the command.
+func (s CommandStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Stats contains timing and throughput statistics of a programming session,
+// intended for tuning chunk size, command delay, and timeouts from measurements.
+type Stats struct {
+	// Commands holds per-command statistics, ordered by command code
+	Commands []CommandStats
+
+	// Retries is the number of row retries after transient failures
+	Retries int
+
+	// BytesSent and BytesReceived count the protocol frame bytes on the wire
+	// (excluding HID report IDs and padding)
+	BytesSent     int
+	BytesReceived int
+
+	// RowTime is the time spent programming and verifying rows
+	RowTime time.Duration
+
+	// BytesPerSecond is the effective row data throughput over RowTime
+	BytesPerSecond float64
+}
+
+// Command returns the statistics of the given command code, if it was sent.
+func (s *Stats) Command(cmd byte) (CommandStats, bool) {
+	for _, c := range s.Commands {
+		if c.Command == cmd {
+			return c, true
+		}
+	}
+	return CommandStats{}, false
+}
+
+// StatsCallback is called with the session statistics when programming finishes,
+// including when it fails.
+//
+// Example:
+//
+//	prog := bootloader.New(device,
+//	    bootloader.WithStatsCallback(func(s bootloader.Stats) {
+//	        if c, ok := s.Command(protocol.CmdSendData); ok {
+//	            log.Printf("send data: %d x %s avg, %.0f B/s", c.Count, c.Mean(), s.BytesPerSecond)
+//	        }
+//	    }),
+//	)
+type StatsCallback func(Stats)
+
+// statsCollector accumulates statistics while an operation runs.
+type statsCollector struct {
+	commands map[byte]*CommandStats
+	stats    Stats
+	rowBytes int
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{commands: make(map[byte]*CommandStats)}
+}
+
+// recordCommand records one command round trip. frame is the command frame sent.
+func (c *statsCollector) recordCommand(frame []byte, latency time.Duration, received int, err error) {
+	if c == nil || len(frame) < 2 {
+		return
+	}
+
+	c.record(frame[1], len(frame), latency, received, err)
+}
+
+// record records one round trip of command cmd whose frame was sent bytes long.
+func (c *statsCollector) record(cmd byte, sent int, latency time.Duration, received int, err error) {
+	if c == nil {
+		return
+	}
+
+	s, ok := c.commands[cmd]
+	if !ok {
+		s = &CommandStats{Command: cmd, Min: latency}
+		c.commands[cmd] = s
+	}
+
+	s.Count++
+	s.Total += latency
+	s.Min = min(s.Min, latency)
+	s.Max = max(s.Max, latency)
+	if err != nil {
+		s.Errors++
+	}
+
+	c.stats.BytesSent += sent
+	c.stats.BytesReceived += received
+}
+
+// recordRow records a programmed row.
+func (c *statsCollector) recordRow(bytes, retries int, duration time.Duration) {
+	if c == nil {
+		return
+	}
+
+	c.rowBytes += bytes
+	c.stats.Retries += retries
+	c.stats.RowTime += duration
+}
+
+// result returns the accumulated statistics.
+func (c *statsCollector) result() Stats {
+	stats := c.stats
+	stats.Commands = make([]CommandStats, 0, len(c.commands))
+	for _, s := range c.commands {
+		stats.Commands = append(stats.Commands, *s)
+	}
+	sort.Slice(stats.Commands, func(i, j int) bool {
+		return stats.Commands[i].Command < stats.Commands[j].Command
+	})
+
+	if stats.RowTime > 0 {
+		stats.BytesPerSecond = float64(c.rowBytes) / stats.RowTime.Seconds()
+	}
+
+	return stats
+}
@@ -0,0 +1,106 @@
+package bootloader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestProgramStats(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+			{ArrayID: 0, RowNum: 0x0011, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+
+	var callbackStats *Stats
+	prog := New(device, WithStatsCallback(func(s Stats) {
+		callbackStats = &s
+	}))
+
+	report, err := prog.ProgramWithReport(context.Background(), fw, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Stats == nil {
+		t.Fatal("report has no stats")
+	}
+	if callbackStats == nil {
+		t.Fatal("stats callback was not called")
+	}
+	if callbackStats.BytesSent != report.Stats.BytesSent {
+		t.Errorf("callback BytesSent = %d, report BytesSent = %d", callbackStats.BytesSent, report.Stats.BytesSent)
+	}
+
+	stats := report.Stats
+	c, ok := stats.Command(protocol.CmdProgramRow)
+	if !ok {
+		t.Fatal("no stats for Program Row")
+	}
+	if c.Count != 2 || c.Errors != 0 {
+		t.Errorf("Program Row count = %d, errors = %d, want 2 and 0", c.Count, c.Errors)
+	}
+	if c.Min > c.Mean() || c.Mean() > c.Max {
+		t.Errorf("latencies out of order: min %s, mean %s, max %s", c.Min, c.Mean(), c.Max)
+	}
+
+	if _, ok := stats.Command(protocol.CmdExitBootloader); !ok {
+		t.Error("no stats for Exit Bootloader")
+	}
+	for i := 1; i < len(stats.Commands); i++ {
+		if stats.Commands[i-1].Command >= stats.Commands[i].Command {
+			t.Errorf("commands not ordered by code: %+v", stats.Commands)
+		}
+	}
+
+	if stats.BytesSent == 0 || stats.BytesReceived == 0 {
+		t.Errorf("BytesSent = %d, BytesReceived = %d, want both > 0", stats.BytesSent, stats.BytesReceived)
+	}
+	if stats.Retries != 0 {
+		t.Errorf("Retries = %d, want 0", stats.Retries)
+	}
+}
+
+func TestStatsCollector(t *testing.T) {
+	c := newStatsCollector()
+	frame := []byte{protocol.StartOfPacket, protocol.CmdSendData, 0x00, 0x00, 0x00, 0x00, protocol.EndOfPacket}
+
+	c.recordCommand(frame, 2*time.Millisecond, 7, nil)
+	c.recordCommand(frame, 4*time.Millisecond, 0, context.DeadlineExceeded)
+	c.recordRow(100, 1, 500*time.Millisecond)
+
+	stats := c.result()
+	s, ok := stats.Command(protocol.CmdSendData)
+	if !ok {
+		t.Fatal("no stats for Send Data")
+	}
+	if s.Count != 2 || s.Errors != 1 {
+		t.Errorf("count = %d, errors = %d, want 2 and 1", s.Count, s.Errors)
+	}
+	if s.Min != 2*time.Millisecond || s.Max != 4*time.Millisecond || s.Mean() != 3*time.Millisecond {
+		t.Errorf("min/mean/max = %s/%s/%s, want 2ms/3ms/4ms", s.Min, s.Mean(), s.Max)
+	}
+	if stats.BytesSent != 14 || stats.BytesReceived != 7 {
+		t.Errorf("BytesSent = %d, BytesReceived = %d, want 14 and 7", stats.BytesSent, stats.BytesReceived)
+	}
+	if stats.Retries != 1 {
+		t.Errorf("Retries = %d, want 1", stats.Retries)
+	}
+	if stats.BytesPerSecond != 200 {
+		t.Errorf("BytesPerSecond = %f, want 200", stats.BytesPerSecond)
+	}
+
+	// A nil collector ignores records
+	var nilCollector *statsCollector
+	nilCollector.recordCommand(frame, time.Millisecond, 0, nil)
+	nilCollector.recordRow(1, 0, time.Millisecond)
+}
@@ -0,0 +1,133 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// VersionCompare reports whether the image should replace the installed
+// application, given the metadata read from the device and the metadata
+// embedded in the image. See WithVersionCompare.
+type VersionCompare func(installed, image *protocol.Metadata) bool
+
+// NewerAppVersion is the default VersionCompare: the image is installed if it
+// is a different application (AppID) or has a higher AppVersion.
+func NewerAppVersion(installed, image *protocol.Metadata) bool {
+	return image.AppID != installed.AppID || image.AppVersion > installed.AppVersion
+}
+
+// UpdateIfNewer programs fw only if it is newer than the installed application,
+// for idempotent fleet update jobs that may run more than once per device.
+//
+// The bootloader is entered with key, the metadata of the active application is
+// read with Get Metadata and compared with the metadata embedded in the image
+// using the VersionCompare set with WithVersionCompare (NewerAppVersion by
+// default). A device without a valid active application is always updated.
+// If the image is not newer, the bootloader is exited again (unless a session
+// was opened with Connect) and UpdateIfNewer returns false. Otherwise fw is
+// programmed as Program does and UpdateIfNewer returns true.
+//
+// Single-application bootloaders that do not implement Get Application Status
+// are queried for application 0.
+//
+// Example:
+//
+//	updated, err := prog.UpdateIfNewer(ctx, fw, key)
+//	if err == nil && !updated {
+//	    log.Println("device already up to date")
+//	}
+func (p *Programmer) UpdateIfNewer(ctx context.Context, fw *cyacd.Firmware, key []byte) (bool, error) {
+	if fw == nil {
+		return false, fmt.Errorf("firmware cannot be nil")
+	}
+	if p.sessionInfo() == nil {
+		if err := protocol.ValidateKey(key); err != nil {
+			return false, err
+		}
+	}
+
+	image, err := imageMetadata(fw)
+	if err != nil {
+		return false, fmt.Errorf("read image metadata: %w", err)
+	}
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer finish()
+
+	updated, err := p.updateIfNewer(ctx, fw, key, image)
+	err = withCause(ctx, err)
+	if err != nil {
+		p.setState(StateFailed)
+	}
+	return updated, err
+}
+
+// updateIfNewer implements UpdateIfNewer within an operation already in progress.
+func (p *Programmer) updateIfNewer(ctx context.Context, fw *cyacd.Firmware, key []byte, image *protocol.Metadata) (bool, error) {
+	inSession := p.sessionInfo() != nil
+	if !inSession {
+		if _, err := p.enterBootloader(ctx, key); err != nil {
+			return false, fmt.Errorf("enter bootloader: %w", err)
+		}
+		p.setState(StateInBootloader)
+	}
+
+	installed, err := p.installedMetadata(ctx)
+	if err != nil {
+		return false, fmt.Errorf("read installed metadata: %w", err)
+	}
+
+	compare := p.config.VersionCompare
+	if compare == nil {
+		compare = NewerAppVersion
+	}
+
+	if installed != nil && !compare(installed, image) {
+		p.logInfo("application up to date",
+			"installed_version", installed.AppVersion,
+			"image_version", image.AppVersion,
+		)
+
+		if !inSession {
+			if err := p.exitBootloader(ctx); err != nil {
+				return false, fmt.Errorf("exit bootloader: %w", err)
+			}
+			p.setState(StateDone)
+		}
+		return false, nil
+	}
+
+	if installed != nil {
+		p.logInfo("updating application",
+			"installed_version", installed.AppVersion,
+			"image_version", image.AppVersion,
+		)
+	}
+
+	report := &ProgramReport{TotalRows: len(fw.Rows)}
+	return true, p.program(ctx, fw, key, p.clock.Now(), report)
+}
+
+// installedMetadata reads the metadata of the active application.
+// Returns nil if no application is active.
+func (p *Programmer) installedMetadata(ctx context.Context) (*protocol.Metadata, error) {
+	appNum, found, err := p.findActiveApp(ctx)
+
+	var protoErr *protocol.ProtocolError
+	if errors.As(err, &protoErr) && protoErr.StatusCode == protocol.ErrCommand {
+		// Single-application bootloader
+		appNum, found, err = 0, true, nil
+	}
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return p.getMetadata(ctx, appNum)
+}
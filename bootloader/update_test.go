@@ -0,0 +1,84 @@
+package bootloader
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// versionedFirmware returns an image whose metadata row carries app ID 0x0102
+// and the given app version
+func versionedFirmware(version uint16) *cyacd.Firmware {
+	data := make([]byte, protocol.MetadataSize)
+	data[20], data[21] = 0x02, 0x01
+	data[22], data[23] = byte(version), byte(version>>8)
+	return &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x01FF, Size: uint16(len(data)), Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+}
+
+func TestUpdateIfNewer(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	tests := []struct {
+		name        string
+		installed   uint16
+		image       uint16
+		opts        []Option
+		wantUpdated bool
+	}{
+		{"newer image", 0x0100, 0x0101, nil, true},
+		{"same version", 0x0100, 0x0100, nil, false},
+		{"older image", 0x0200, 0x0100, nil, false},
+		{
+			name:      "custom comparison",
+			installed: 0x0200,
+			image:     0x0100,
+			opts: []Option{WithVersionCompare(func(installed, image *protocol.Metadata) bool {
+				return image.AppVersion != installed.AppVersion
+			})},
+			wantUpdated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := bootloadertest.NewDevice()
+			if err := New(device).Program(context.Background(), versionedFirmware(tt.installed), key); err != nil {
+				t.Fatalf("install: %v", err)
+			}
+			installed := len(device.Commands())
+
+			prog := New(device, tt.opts...)
+			updated, err := prog.UpdateIfNewer(context.Background(), versionedFirmware(tt.image), key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if updated != tt.wantUpdated {
+				t.Errorf("updated = %t, want %t", updated, tt.wantUpdated)
+			}
+
+			commands := device.Commands()[installed:]
+			if programmed := bytes.IndexByte(commands, protocol.CmdProgramRow) >= 0; programmed != tt.wantUpdated {
+				t.Errorf("Program Row sent = %t, want %t", programmed, tt.wantUpdated)
+			}
+			if device.InBootloader() {
+				t.Error("device left in bootloader")
+			}
+		})
+	}
+
+	t.Run("image without metadata", func(t *testing.T) {
+		fw := &cyacd.Firmware{Rows: []*cyacd.Row{{Data: []byte{0x01}}}}
+		if _, err := New(bootloadertest.NewDevice()).UpdateIfNewer(context.Background(), fw, key); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// imageMetadata extracts the application metadata embedded in the firmware image.
+// The metadata occupies the last protocol.MetadataSize bytes of the metadata row.
+func imageMetadata(fw *cyacd.Firmware) (*protocol.Metadata, error) {
+	if len(fw.Rows) == 0 {
+		return nil, fmt.Errorf("firmware has no rows")
+	}
+
+	row := fw.Rows[metadataRowIndex(fw.Rows)]
+	if len(row.Data) < protocol.MetadataSize {
+		return nil, fmt.Errorf("metadata row %d is %d bytes, expected at least %d",
+			row.RowNum, len(row.Data), protocol.MetadataSize)
+	}
+
+	start := len(row.Data) - protocol.MetadataSize
+	return protocol.ParseGetMetadataResponse(row.Data[start : start+protocol.GetMetadataResponseSize])
+}
+
+// validateApp confirms that the device reports the freshly programmed application
+// as valid and that its metadata matches the firmware image.
+// Returns the metadata read from the device.
+func (p *Programmer) validateApp(ctx context.Context, fw *cyacd.Firmware) (*protocol.Metadata, error) {
+	appNum := p.config.ValidateAppNum
+
+	expected, err := imageMetadata(fw)
+	if err != nil {
+		return nil, fmt.Errorf("read image metadata: %w", err)
+	}
+
+	status, err := p.getAppStatus(ctx, appNum)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Valid {
+		return nil, &VerificationError{
+			Reason: fmt.Sprintf("application %d is not marked valid", appNum),
+		}
+	}
+
+	actual, err := p.getMetadata(ctx, appNum)
+	if err != nil {
+		return nil, err
+	}
+
+	if actual.AppID != expected.AppID {
+		return actual, &VerificationError{
+			Reason: fmt.Sprintf("application ID mismatch: image 0x%04X, device 0x%04X", expected.AppID, actual.AppID),
+		}
+	}
+	if actual.AppVersion != expected.AppVersion {
+		return actual, &VerificationError{
+			Reason: fmt.Sprintf("application version mismatch: image 0x%04X, device 0x%04X", expected.AppVersion, actual.AppVersion),
+		}
+	}
+
+	p.logDebug("application validated",
+		"app", appNum,
+		"app_id", actual.AppID,
+		"app_version", actual.AppVersion,
+	)
+
+	return actual, nil
+}
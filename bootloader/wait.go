@@ -0,0 +1,98 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Defaults for waiting on the application after Exit Bootloader.
+const (
+	// DefaultAppStartTimeout bounds WaitForApplication when ctx has no deadline
+	DefaultAppStartTimeout = 10 * time.Second
+
+	// DefaultAppPollInterval is the delay between application probes
+	DefaultAppPollInterval = 250 * time.Millisecond
+)
+
+// ApplicationProbe reports whether the freshly programmed application is running.
+// It returns nil once the application answers, and an error while it does not
+// (e.g. the device has not re-enumerated yet, or its application interface does
+// not respond). The probe is called repeatedly and should return promptly; ctx
+// carries the overall wait deadline.
+//
+// Example:
+//
+//	probe := func(ctx context.Context) error {
+//	    port, err := serial.Open("/dev/ttyACM0", appMode)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    defer port.Close()
+//	    return pingApplication(ctx, port)
+//	}
+type ApplicationProbe func(ctx context.Context) error
+
+// WaitForApplication waits for the application to start after the bootloader
+// was exited, polling probe every DefaultAppPollInterval until it succeeds.
+// The first probe runs after one interval, giving the device time to reset.
+//
+// The wait ends when ctx is done; without a deadline it is bounded by
+// DefaultAppStartTimeout. On timeout the error wraps context.DeadlineExceeded
+// and includes the last probe error.
+//
+// Example:
+//
+//	if err := prog.Program(ctx, fw, key); err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := prog.WaitForApplication(ctx, probe); err != nil {
+//	    log.Fatalf("application did not start: %v", err)
+//	}
+func (p *Programmer) WaitForApplication(ctx context.Context, probe ApplicationProbe) error {
+	if probe == nil {
+		return fmt.Errorf("probe cannot be nil")
+	}
+
+	ctx, finish, err := p.beginOperation(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	return p.waitForApplication(ctx, probe, DefaultAppStartTimeout)
+}
+
+// waitForApplication implements WaitForApplication within an operation already in
+// progress. timeout applies when ctx has no deadline.
+func (p *Programmer) waitForApplication(ctx context.Context, probe ApplicationProbe, timeout time.Duration) error {
+	// The timeout is also checked against the clock, which may not be the system clock
+	_, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := p.clock.Now()
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		err := p.clock.Sleep(ctx, DefaultAppPollInterval)
+		if err == nil && !hasDeadline && p.clock.Since(start) > timeout {
+			err = context.DeadlineExceeded
+		}
+		if err != nil {
+			if lastErr != nil {
+				return fmt.Errorf("wait for application: %w (last probe error: %v)", err, lastErr)
+			}
+			return fmt.Errorf("wait for application: %w", err)
+		}
+
+		lastErr = probe(ctx)
+		if lastErr == nil {
+			p.logInfo("application started", "phase", PhaseWaiting, "attempt", attempt, "duration", p.clock.Since(start).String())
+			return nil
+		}
+		p.logDebug("application not ready", "phase", PhaseWaiting, "attempt", attempt, "error", lastErr)
+	}
+}
@@ -0,0 +1,97 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestWaitForApplication(t *testing.T) {
+	t.Run("succeeds once probe answers", func(t *testing.T) {
+		prog := New(NewMockDevice())
+		calls := 0
+		probe := func(ctx context.Context) error {
+			calls++
+			if calls < 2 {
+				return errors.New("device not enumerated")
+			}
+			return nil
+		}
+
+		if err := prog.WaitForApplication(context.Background(), probe); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("probe called %d times, want 2", calls)
+		}
+	})
+
+	t.Run("times out with last probe error", func(t *testing.T) {
+		prog := New(NewMockDevice())
+		probe := func(ctx context.Context) error {
+			return errors.New("no response on application interface")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*DefaultAppPollInterval/2)
+		defer cancel()
+
+		err := prog.WaitForApplication(ctx, probe)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+		}
+		if !strings.Contains(err.Error(), "no response on application interface") {
+			t.Errorf("error %q does not include the last probe error", err)
+		}
+	})
+
+	t.Run("nil probe", func(t *testing.T) {
+		if err := New(NewMockDevice()).WaitForApplication(context.Background(), nil); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestProgramWaitForApplication(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: 4, Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+	device := bootloadertest.NewDevice()
+	probed := false
+	probe := func(ctx context.Context) error {
+		probed = true
+		if device.InBootloader() {
+			return errors.New("still in bootloader")
+		}
+		return nil
+	}
+
+	var phases []Phase
+	prog := New(device,
+		WithWaitForApplication(probe, time.Second),
+		WithProgressCallback(func(p Progress) {
+			phases = append(phases, p.Phase)
+		}),
+	)
+
+	if err := prog.Program(context.Background(), fw, key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !probed {
+		t.Error("application was not probed")
+	}
+	if n := len(phases); n < 2 || phases[n-2] != PhaseWaiting || phases[n-1] != PhaseComplete {
+		t.Errorf("phases = %v, want waiting before complete", phases)
+	}
+}
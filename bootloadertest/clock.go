@@ -0,0 +1,69 @@
+package bootloadertest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is a manual clock for tests that satisfies bootloader.Clock. Time only
+// moves when Advance or Sleep is called: Sleep advances the clock by the
+// requested duration and returns immediately, so command delays, polling, and
+// timeouts are simulated without waiting. Clock is safe for concurrent use.
+//
+//	clock := bootloadertest.NewClock(time.Unix(0, 0))
+//	prog := bootloader.New(device, bootloader.WithClock(clock))
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// NewClock returns a Clock reading start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current simulated time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the simulated time elapsed since t.
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep advances the clock by d and records the sleep, or returns ctx.Err()
+// without advancing if ctx is already done.
+func (c *Clock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	return nil
+}
+
+// Advance moves the clock forward by d, e.g. to simulate the time a slow
+// device takes to answer.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Sleeps returns the durations passed to Sleep so far, in order.
+func (c *Clock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
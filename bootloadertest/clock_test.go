@@ -0,0 +1,37 @@
+package bootloadertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewClock(start)
+
+	if err := clock.Sleep(context.Background(), time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if err := clock.Sleep(context.Background(), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := clock.Since(start); got != 1500*time.Millisecond {
+		t.Errorf("Since(start) = %s, want 1.5s", got)
+	}
+	if got := clock.Sleeps(); len(got) != 1 || got[0] != time.Second {
+		t.Errorf("Sleeps() = %v, want [1s]", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := clock.Sleep(ctx, time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep on a canceled context = %v, want context.Canceled", err)
+	}
+	if got := clock.Now(); !got.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Errorf("canceled Sleep advanced the clock to %s", got)
+	}
+}
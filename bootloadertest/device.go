@@ -0,0 +1,577 @@
+package bootloadertest
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Default identity and geometry of a Device.
+const (
+	// DefaultSiliconID is the silicon ID reported by Enter Bootloader
+	DefaultSiliconID = 0x1E9602AA
+
+	// DefaultFlashStart is the first row reported by Get Flash Size
+	DefaultFlashStart = 0x0000
+
+	// DefaultFlashEnd is the last row reported by Get Flash Size
+	DefaultFlashEnd = 0x01FF
+)
+
+// RowAddress identifies a flash row.
+type RowAddress struct {
+	ArrayID uint8
+	RowNum  uint16
+}
+
+// Device simulates a Cypress bootloader behind an io.ReadWriter.
+//
+// Each frame written to the device is validated (start/end of packet, length,
+// checksum) and answered like a real bootloader would: Enter Bootloader checks the
+// key, Send Data chunks are buffered until Program Row, rows are stored in simulated
+// flash, Verify Row returns the checksum the device would compute, and Exit
+// Bootloader sends no response unless WithExitAck is set. Each Read returns the
+// next queued response frame.
+//
+// Faults can be injected at the I/O level with WithFault or InjectFault to exercise
+// retry and resynchronization logic, and WithLatency, WithCommandLatency, and
+// WithDribble give responses the timing of a real link.
+//
+// Device is safe for concurrent use.
+type Device struct {
+	mu sync.Mutex
+
+	siliconID  uint32
+	siliconRev byte
+	blVersion  [3]byte
+	flashStart uint16
+	flashEnd   uint16
+	key        []byte
+
+	rowSize      int
+	maxSendData  int
+	applications byte
+	checksumType byte
+	exitAck      bool
+
+	latency        Latency
+	commandLatency map[byte]Latency
+	dribble        Dribble
+	rand           *rand.Rand
+
+	inBootloader bool
+	activeApp    byte
+	pending      []byte
+	flash        map[RowAddress][]byte
+	responses    []chunk
+	commands     []byte
+	faults       []*faultState
+
+	// written is signaled after every Write, waking a blocked ReadContext
+	written chan struct{}
+}
+
+// chunk is a unit of response data returned by one Read,
+// optionally delivered after a delay.
+type chunk struct {
+	data  []byte
+	delay time.Duration
+}
+
+// Option configures a Device.
+type Option func(*Device)
+
+// WithSiliconID sets the silicon ID reported by Enter Bootloader.
+func WithSiliconID(id uint32) Option {
+	return func(d *Device) {
+		d.siliconID = id
+	}
+}
+
+// WithSiliconRev sets the silicon revision reported by Enter Bootloader.
+func WithSiliconRev(rev byte) Option {
+	return func(d *Device) {
+		d.siliconRev = rev
+	}
+}
+
+// WithBootloaderVersion sets the bootloader version reported by Enter Bootloader.
+func WithBootloaderVersion(version [3]byte) Option {
+	return func(d *Device) {
+		d.blVersion = version
+	}
+}
+
+// WithFlashRange sets the row range reported by Get Flash Size.
+// Program Row and Erase Row reject rows outside the range.
+func WithFlashRange(start, end uint16) Option {
+	return func(d *Device) {
+		d.flashStart = start
+		d.flashEnd = end
+	}
+}
+
+// WithRowSize makes Program Row reject rows that are not exactly size bytes,
+// like a device with fixed flash row geometry. By default any row size is accepted.
+func WithRowSize(size int) Option {
+	return func(d *Device) {
+		d.rowSize = size
+	}
+}
+
+// WithMaxSendData makes Send Data reject chunks larger than size bytes with
+// protocol.ErrLength, like a device with a small receive buffer.
+// By default chunks of any size are accepted.
+func WithMaxSendData(size int) Option {
+	return func(d *Device) {
+		d.maxSendData = size
+	}
+}
+
+// WithApplications sets the number of application slots (1 or 2).
+// Single-application devices reject Get Metadata, Get Application Status, and
+// Set Active Application as unknown commands. Default is 2.
+func WithApplications(n byte) Option {
+	return func(d *Device) {
+		d.applications = n
+	}
+}
+
+// WithChecksumType sets the packet checksum type the device was built with
+// (protocol.ChecksumBasicSum or protocol.ChecksumCRC16). Frames with the wrong
+// checksum are rejected. Default is protocol.ChecksumBasicSum.
+func WithChecksumType(checksumType byte) Option {
+	return func(d *Device) {
+		d.checksumType = checksumType
+	}
+}
+
+// WithKey makes Enter Bootloader reject any key other than key, including
+// protocol.NoKey. By default every key is accepted, as is NoKey.
+func WithKey(key []byte) Option {
+	return func(d *Device) {
+		// A copy of protocol.NoKey is empty but not nil, so only NoKey is accepted
+		d.key = append([]byte{}, key...)
+	}
+}
+
+// WithExitAck makes the device acknowledge Exit Bootloader before it
+// resets, as some bootloaders do. By default Exit Bootloader sends no response.
+func WithExitAck() Option {
+	return func(d *Device) {
+		d.exitAck = true
+	}
+}
+
+// NewDevice creates a simulated bootloader device with empty flash.
+//
+// Example:
+//
+//	device := bootloadertest.NewDevice(bootloadertest.WithSiliconID(fw.SiliconID))
+//	prog := bootloader.New(device)
+//	err := prog.Program(ctx, fw, key)
+func NewDevice(opts ...Option) *Device {
+	d := &Device{
+		siliconID:    DefaultSiliconID,
+		blVersion:    [3]byte{0x01, 0x1E, 0x00},
+		flashStart:   DefaultFlashStart,
+		flashEnd:     DefaultFlashEnd,
+		applications: protocol.MaxApplications,
+		flash:        make(map[RowAddress][]byte),
+		written:      make(chan struct{}, 1),
+		rand:         rand.New(rand.NewSource(1)),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Read returns the next queued response frame.
+// Returns io.EOF when no response is pending.
+func (d *Device) Read(p []byte) (int, error) {
+	return d.read(context.Background(), p, false)
+}
+
+// ReadContext returns the next queued response frame, waiting until one is
+// written or ctx is done. Like a real device that never answers, a dropped
+// response makes ReadContext block until the read timeout expires.
+func (d *Device) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return d.read(ctx, p, true)
+}
+
+func (d *Device) read(ctx context.Context, p []byte, wait bool) (int, error) {
+	for {
+		d.mu.Lock()
+		if len(d.responses) == 0 {
+			d.mu.Unlock()
+			if !wait {
+				return 0, io.EOF
+			}
+
+			select {
+			case <-d.written:
+				continue
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+
+		next := &d.responses[0]
+		if delay := next.delay; delay > 0 {
+			next.delay = 0
+			d.mu.Unlock()
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, ctx.Err()
+			}
+		}
+
+		n := copy(p, next.data)
+		next.data = next.data[n:]
+		if len(next.data) == 0 {
+			d.responses = d.responses[1:]
+		}
+		d.mu.Unlock()
+		return n, nil
+	}
+}
+
+// ResetInputBuffer discards all queued responses, like flushing a serial port.
+func (d *Device) ResetInputBuffer() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.responses = nil
+	return nil
+}
+
+// Write accepts one command frame and queues the bootloader's response.
+// A leading HID report ID byte and trailing padding are ignored.
+func (d *Device) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.signalWritten()
+
+	frame := p
+	if len(frame) > 1 && frame[0] != protocol.StartOfPacket && frame[1] == protocol.StartOfPacket {
+		frame = frame[1:]
+	}
+	if len(frame) >= 4 {
+		if size := protocol.MinFrameSize + int(binary.LittleEndian.Uint16(frame[2:4])); size <= len(frame) {
+			frame = frame[:size]
+		}
+	}
+
+	cmd, data, err := protocol.ParseResponseWithChecksum(frame, d.checksumType)
+	if err != nil {
+		d.respond(protocol.ErrChecksum, nil)
+		return len(p), nil
+	}
+
+	fault := d.matchFault(cmd, data)
+	if fault != nil {
+		switch fault.Kind {
+		case FaultEOF:
+			return 0, io.EOF
+		case FaultDropFrame:
+			return len(p), nil
+		}
+	}
+
+	d.commands = append(d.commands, cmd)
+
+	queued := len(d.responses)
+	d.handle(cmd, data)
+	if fault != nil {
+		if fault.Kind == FaultFlashGlitch {
+			d.glitchRow(cmd, data)
+		}
+		d.applyFault(fault, queued)
+	}
+	d.applyTiming(cmd, queued)
+
+	return len(p), nil
+}
+
+// signalWritten wakes a ReadContext waiting for a response.
+func (d *Device) signalWritten() {
+	select {
+	case d.written <- struct{}{}:
+	default:
+	}
+}
+
+// handle executes a command and queues its response. Must be called with mu held.
+func (d *Device) handle(cmd byte, data []byte) {
+	if cmd != protocol.CmdEnterBootloader && !d.inBootloader {
+		d.respond(protocol.ErrActive, nil)
+		return
+	}
+
+	switch cmd {
+	case protocol.CmdEnterBootloader:
+		d.enterBootloader(data)
+	case protocol.CmdGetFlashSize:
+		d.getFlashSize(data)
+	case protocol.CmdSendData:
+		if d.maxSendData > 0 && len(data) > d.maxSendData {
+			d.respond(protocol.ErrLength, nil)
+			return
+		}
+		d.pending = append(d.pending, data...)
+		d.respond(protocol.StatusSuccess, nil)
+	case protocol.CmdProgramRow:
+		d.programRow(data)
+	case protocol.CmdEraseRow:
+		d.eraseRow(data)
+	case protocol.CmdVerifyRow:
+		d.verifyRow(data)
+	case protocol.CmdVerifyChecksum:
+		valid := byte(0)
+		if len(d.flash) > 0 {
+			valid = 1
+		}
+		d.respond(protocol.StatusSuccess, []byte{valid})
+	case protocol.CmdSyncBootloader:
+		// Discards buffered data; no response
+		d.pending = nil
+	case protocol.CmdExitBootloader:
+		// The device resets, acknowledging first if configured to
+		if d.exitAck {
+			d.respond(protocol.StatusSuccess, nil)
+		}
+		d.inBootloader = false
+		d.pending = nil
+	case protocol.CmdGetMetadata, protocol.CmdGetAppStatus, protocol.CmdSetActiveApp:
+		d.handleMultiApp(cmd, data)
+	default:
+		d.respond(protocol.ErrCommand, nil)
+	}
+}
+
+// handleMultiApp executes the commands only implemented by multi-application bootloaders.
+func (d *Device) handleMultiApp(cmd byte, data []byte) {
+	if d.applications < 2 {
+		d.respond(protocol.ErrCommand, nil)
+		return
+	}
+	if len(data) != 1 || data[0] >= d.applications {
+		d.respond(protocol.ErrApp, nil)
+		return
+	}
+
+	switch cmd {
+	case protocol.CmdGetMetadata:
+		d.getMetadata()
+	case protocol.CmdGetAppStatus:
+		d.getAppStatus(data[0])
+	case protocol.CmdSetActiveApp:
+		d.activeApp = data[0]
+		d.respond(protocol.StatusSuccess, nil)
+	}
+}
+
+func (d *Device) enterBootloader(key []byte) {
+	// protocol.NoKey arrives as a command without data
+	if len(key) != protocol.BootloaderKeySize && len(key) != 0 {
+		d.respond(protocol.ErrLength, nil)
+		return
+	}
+	if d.key != nil && string(key) != string(d.key) {
+		d.respond(protocol.ErrKey, nil)
+		return
+	}
+
+	d.inBootloader = true
+	d.pending = nil
+
+	data := make([]byte, protocol.EnterBootloaderResponseSize)
+	binary.LittleEndian.PutUint32(data[0:4], d.siliconID)
+	data[4] = d.siliconRev
+	copy(data[5:8], d.blVersion[:])
+	d.respond(protocol.StatusSuccess, data)
+}
+
+func (d *Device) getFlashSize(data []byte) {
+	if len(data) != 1 {
+		d.respond(protocol.ErrLength, nil)
+		return
+	}
+
+	resp := make([]byte, protocol.GetFlashSizeResponseSize)
+	binary.LittleEndian.PutUint16(resp[0:2], d.flashStart)
+	binary.LittleEndian.PutUint16(resp[2:4], d.flashEnd)
+	d.respond(protocol.StatusSuccess, resp)
+}
+
+// rowAddress parses the [ARRAY_ID][ROW_L][ROW_H] prefix shared by row commands.
+func (d *Device) rowAddress(data []byte) (RowAddress, bool) {
+	if len(data) < 3 {
+		d.respond(protocol.ErrLength, nil)
+		return RowAddress{}, false
+	}
+
+	addr := RowAddress{ArrayID: data[0], RowNum: binary.LittleEndian.Uint16(data[1:3])}
+	if addr.RowNum < d.flashStart || addr.RowNum > d.flashEnd {
+		d.respond(protocol.ErrRow, nil)
+		return RowAddress{}, false
+	}
+
+	return addr, true
+}
+
+func (d *Device) programRow(data []byte) {
+	addr, ok := d.rowAddress(data)
+	if !ok {
+		d.pending = nil
+		return
+	}
+
+	row := append(d.pending, data[3:]...)
+	d.pending = nil
+	if d.rowSize > 0 && len(row) != d.rowSize {
+		d.respond(protocol.ErrLength, nil)
+		return
+	}
+	d.flash[addr] = append([]byte(nil), row...)
+	d.respond(protocol.StatusSuccess, nil)
+}
+
+func (d *Device) eraseRow(data []byte) {
+	addr, ok := d.rowAddress(data)
+	if !ok {
+		return
+	}
+
+	delete(d.flash, addr)
+	d.respond(protocol.StatusSuccess, nil)
+}
+
+func (d *Device) verifyRow(data []byte) {
+	addr, ok := d.rowAddress(data)
+	if !ok {
+		return
+	}
+
+	row, exists := d.flash[addr]
+	if !exists {
+		d.respond(protocol.ErrRow, nil)
+		return
+	}
+
+	checksum := protocol.CalculateRowChecksumWithMetadata(
+		protocol.CalculateRowChecksum(row), addr.ArrayID, addr.RowNum, uint16(len(row)))
+	d.respond(protocol.StatusSuccess, []byte{checksum})
+}
+
+// getMetadata reports the metadata region at the end of the highest programmed row.
+func (d *Device) getMetadata() {
+	resp := make([]byte, protocol.GetMetadataResponseSize)
+	if addrs := d.sortedRows(); len(addrs) > 0 {
+		row := d.flash[addrs[len(addrs)-1]]
+		if len(row) >= protocol.MetadataSize {
+			copy(resp, row[len(row)-protocol.MetadataSize:])
+		}
+	}
+	d.respond(protocol.StatusSuccess, resp)
+}
+
+func (d *Device) getAppStatus(appNum byte) {
+	var valid, active byte
+	if len(d.flash) > 0 {
+		valid = 1
+	}
+	if appNum == d.activeApp {
+		active = 1
+	}
+	d.respond(protocol.StatusSuccess, []byte{valid, active})
+}
+
+// respond queues a response frame. Must be called with mu held.
+func (d *Device) respond(status byte, data []byte) {
+	frame, _ := protocol.BuildCommand(status, data)
+	_ = protocol.SetPacketChecksum(frame, d.checksumType)
+	d.responses = append(d.responses, chunk{data: frame})
+}
+
+// sortedRows returns the programmed row addresses in flash order. Must be called with mu held.
+func (d *Device) sortedRows() []RowAddress {
+	addrs := make([]RowAddress, 0, len(d.flash))
+	for addr := range d.flash {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].ArrayID != addrs[j].ArrayID {
+			return addrs[i].ArrayID < addrs[j].ArrayID
+		}
+		return addrs[i].RowNum < addrs[j].RowNum
+	})
+	return addrs
+}
+
+// InBootloader reports whether the device is in bootloader mode.
+func (d *Device) InBootloader() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inBootloader
+}
+
+// ActiveApp returns the application number last set with Set Active Application.
+func (d *Device) ActiveApp() byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.activeApp
+}
+
+// Row returns a copy of the data programmed into a flash row.
+func (d *Device) Row(arrayID uint8, rowNum uint16) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	row, ok := d.flash[RowAddress{ArrayID: arrayID, RowNum: rowNum}]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), row...), true
+}
+
+// Rows returns the addresses of all programmed rows in flash order.
+func (d *Device) Rows() []RowAddress {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sortedRows()
+}
+
+// Commands returns the command codes received so far, in order.
+// Frames that failed validation are not included.
+func (d *Device) Commands() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]byte(nil), d.commands...)
+}
+
+// Reset erases the simulated flash and returns the device to application mode,
+// clearing any queued responses, injected faults, and the command log.
+func (d *Device) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inBootloader = false
+	d.activeApp = 0
+	d.pending = nil
+	d.flash = make(map[RowAddress][]byte)
+	d.responses = nil
+	d.commands = nil
+	d.faults = nil
+}
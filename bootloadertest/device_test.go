@@ -0,0 +1,184 @@
+package bootloadertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+var testKey = []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+func testFirmware() *cyacd.Firmware {
+	small := []byte{0x01, 0x02, 0x03, 0x04}
+	large := bytes.Repeat([]byte{0xA5}, 128)
+	return &cyacd.Firmware{
+		SiliconID: DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x0010, Size: uint16(len(small)), Data: small, Checksum: protocol.CalculateRowChecksum(small)},
+			{ArrayID: 0, RowNum: 0x0011, Size: uint16(len(large)), Data: large, Checksum: protocol.CalculateRowChecksum(large)},
+		},
+	}
+}
+
+func TestDeviceProgram(t *testing.T) {
+	device := NewDevice(WithKey(testKey))
+	fw := testFirmware()
+
+	prog := bootloader.New(device)
+	if err := prog.Program(context.Background(), fw, testKey); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+
+	for _, row := range fw.Rows {
+		data, ok := device.Row(row.ArrayID, row.RowNum)
+		if !ok {
+			t.Fatalf("row %d not programmed", row.RowNum)
+		}
+		if !bytes.Equal(data, row.Data) {
+			t.Errorf("row %d = % 02X, want % 02X", row.RowNum, data, row.Data)
+		}
+	}
+
+	if device.InBootloader() {
+		t.Error("device still in bootloader after Program")
+	}
+	if got := len(device.Rows()); got != 2 {
+		t.Errorf("Rows() = %d rows, want 2", got)
+	}
+
+	cmds := device.Commands()
+	if cmds[0] != protocol.CmdEnterBootloader || cmds[len(cmds)-1] != protocol.CmdExitBootloader {
+		t.Errorf("commands = % 02X", cmds)
+	}
+}
+
+func TestDeviceWrongKey(t *testing.T) {
+	device := NewDevice(WithKey(testKey))
+
+	prog := bootloader.New(device)
+	_, err := prog.EnterBootloader(context.Background(), []byte{0, 0, 0, 0, 0, 0})
+
+	var protoErr *protocol.ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrKey {
+		t.Fatalf("error = %v, want key error", err)
+	}
+	if device.InBootloader() {
+		t.Error("device entered bootloader with wrong key")
+	}
+}
+
+func TestDeviceNoKey(t *testing.T) {
+	fw := testFirmware()
+	if err := bootloader.New(NewDevice()).Program(context.Background(), fw, protocol.NoKey); err != nil {
+		t.Fatalf("Program without a key: %v", err)
+	}
+
+	device := NewDevice(WithKey([]byte(protocol.DefaultExampleKey)))
+	_, err := bootloader.New(device).EnterBootloader(context.Background(), protocol.NoKey)
+	var protoErr *protocol.ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrKey {
+		t.Fatalf("error = %v, want key error", err)
+	}
+
+	device = NewDevice(WithKey(protocol.NoKey))
+	_, err = bootloader.New(device).EnterBootloader(context.Background(), testKey)
+	if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrKey {
+		t.Fatalf("key sent to a device without one: error = %v, want key error", err)
+	}
+	if _, err := bootloader.New(device).EnterBootloader(context.Background(), protocol.NoKey); err != nil {
+		t.Fatalf("EnterBootloader without a key: %v", err)
+	}
+}
+
+func TestDeviceSiliconMismatch(t *testing.T) {
+	device := NewDevice(WithSiliconID(0x12345678))
+
+	prog := bootloader.New(device)
+	err := prog.Program(context.Background(), testFirmware(), testKey)
+
+	var mismatch *bootloader.DeviceMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("error = %v, want *bootloader.DeviceMismatchError", err)
+	}
+}
+
+func TestDeviceFlashRange(t *testing.T) {
+	device := NewDevice(WithFlashRange(0x0000, 0x000F))
+
+	prog := bootloader.New(device)
+	err := prog.Program(context.Background(), testFirmware(), testKey)
+
+	var rangeErr *bootloader.RowOutOfRangeError
+	if !errors.As(err, &rangeErr) {
+		t.Fatalf("error = %v, want *bootloader.RowOutOfRangeError", err)
+	}
+	if len(device.Rows()) != 0 {
+		t.Error("rows programmed despite range error")
+	}
+}
+
+func TestDeviceRejectsCorruptFrame(t *testing.T) {
+	device := NewDevice()
+
+	frame, _ := protocol.BuildEnterBootloaderCmd(testKey)
+	frame[len(frame)-2] ^= 0xFF
+	if _, err := device.Write(frame); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	n, _ := device.Read(buf)
+	status, _, err := protocol.ParseResponse(buf[:n])
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if status != protocol.ErrChecksum {
+		t.Errorf("status = 0x%02X, want ErrChecksum", status)
+	}
+}
+
+func TestDeviceEraseAndReset(t *testing.T) {
+	device := NewDevice()
+
+	prog := bootloader.New(device)
+	if _, err := prog.Connect(context.Background(), testKey); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := prog.Program(context.Background(), testFirmware(), nil); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	if err := prog.EraseRow(context.Background(), 0, 0x0010); err != nil {
+		t.Fatalf("EraseRow: %v", err)
+	}
+	if _, ok := device.Row(0, 0x0010); ok {
+		t.Error("row still programmed after EraseRow")
+	}
+
+	device.Reset()
+	if len(device.Rows()) != 0 || device.InBootloader() {
+		t.Error("Reset did not clear the device")
+	}
+}
+
+func TestDeviceMaxSendData(t *testing.T) {
+	device := NewDevice(WithMaxSendData(64))
+
+	prog := bootloader.New(device, bootloader.WithChunkSize(128))
+	err := prog.Program(context.Background(), testFirmware(), testKey)
+
+	var protoErr *protocol.ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrLength {
+		t.Fatalf("error = %v, want length error", err)
+	}
+
+	device = NewDevice(WithMaxSendData(64))
+	prog = bootloader.New(device, bootloader.WithChunkSize(64))
+	if err := prog.Program(context.Background(), testFirmware(), testKey); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+}
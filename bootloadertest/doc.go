@@ -0,0 +1,77 @@
+// Package bootloadertest provides a simulated Cypress bootloader for testing
+// code that programs devices with the bootloader package.
+//
+// # Overview
+//
+// Device implements io.ReadWriter and answers command frames like a real
+// bootloader: it validates framing and checksums, checks the key, buffers
+// Send Data chunks, stores programmed rows in simulated flash, and computes
+// Verify Row checksums the same way the device does. Tests can then inspect
+// the flash contents and the commands received.
+//
+// # Usage
+//
+//	device := bootloadertest.NewDevice(
+//	    bootloadertest.WithSiliconID(fw.SiliconID),
+//	    bootloadertest.WithFlashRange(0x0000, 0x01FF),
+//	)
+//
+//	prog := bootloader.New(device)
+//	if err := prog.Program(ctx, fw, key); err != nil {
+//	    t.Fatal(err)
+//	}
+//
+//	data, ok := device.Row(0, 0x0010)
+//
+// By default the simulated device has no timing behavior: every response is
+// available immediately. Read returns io.EOF when no response is pending, while
+// ReadContext (used by the Programmer) waits for the read timeout.
+//
+// Clock is a manual clock for bootloader.WithClock: sleeps advance it
+// instantly, so timing behavior such as command delays and timeouts can be
+// checked deterministically.
+//
+// Serve and ServeConn put a Device behind a network listener or any byte
+// stream, reassembling command frames however the stream splits them, so
+// hosts in other processes or languages can be tested against it.
+//
+// # Presets
+//
+// Presets configure realistic device geometries by name: "psoc4" (128-byte
+// rows), "psoc4-crc" (CRC-16 packet checksums), "psoc5lp" (256-byte rows), and
+// "psoc5lp-dual" (multi-application bootloader):
+//
+//	for _, preset := range bootloadertest.Presets() {
+//	    device, _ := bootloadertest.NewPresetDevice(preset.Name)
+//	    // program and assert ...
+//	}
+//
+// # Fault Injection
+//
+// Faults make retry and resynchronization logic testable deterministically:
+//
+//	device := bootloadertest.NewDevice(
+//	    bootloadertest.WithFault(bootloadertest.Fault{
+//	        Kind:    bootloadertest.FaultDropFrame,
+//	        Command: protocol.CmdVerifyRow,
+//	        Row:     &bootloadertest.RowAddress{ArrayID: 0, RowNum: 0x0011},
+//	    }),
+//	)
+//
+// Available faults are torn reads, delayed responses, dropped frames,
+// corrupted response checksums, and EOF (device disconnect).
+//
+// # Timing
+//
+// Latency distributions, per command or for all commands, and dribbled reads
+// exercise timeouts, frame reassembly, and throughput without hardware:
+//
+//	device := bootloadertest.NewDevice(
+//	    bootloadertest.WithLatency(bootloadertest.Latency{Base: time.Millisecond, Jitter: time.Millisecond}),
+//	    bootloadertest.WithCommandLatency(protocol.CmdProgramRow, bootloadertest.Latency{Base: 10 * time.Millisecond}),
+//	    bootloadertest.WithDribble(bootloadertest.Dribble{Bytes: 3, Interval: 100 * time.Microsecond}),
+//	)
+//
+// Jitter is drawn from a seeded source (WithJitterSeed), so runs are
+// repeatable.
+package bootloadertest
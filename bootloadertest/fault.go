@@ -0,0 +1,168 @@
+package bootloadertest
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// FaultKind selects the I/O fault injected by a Fault.
+type FaultKind int
+
+const (
+	// FaultTornRead delivers the response in two Reads, split in the middle of the frame
+	FaultTornRead FaultKind = iota + 1
+
+	// FaultDelay delivers the response after Fault.Delay
+	FaultDelay
+
+	// FaultDropFrame discards the command frame: it is not executed and no response is sent
+	FaultDropFrame
+
+	// FaultCorruptChecksum executes the command but flips a bit in the response checksum
+	FaultCorruptChecksum
+
+	// FaultEOF fails the Write with io.EOF, as if the device was disconnected
+	FaultEOF
+
+	// FaultFlashGlitch executes a Program Row command successfully but flips a bit
+	// in the stored row, like a flash write glitch caught only by Verify Row
+	FaultFlashGlitch
+)
+
+// Fault describes an I/O fault injected into the simulated device.
+// A fault triggers on command frames matching Command and Row, after Skip
+// matching frames have been let through.
+type Fault struct {
+	// Kind is the fault to inject
+	Kind FaultKind
+
+	// Command restricts the fault to frames with this command code
+	// (0 matches any command)
+	Command byte
+
+	// Row restricts the fault to Program Row, Verify Row, and Erase Row frames
+	// addressing this row (nil matches any frame)
+	Row *RowAddress
+
+	// Skip is the number of matching frames passed through before the fault triggers
+	Skip int
+
+	// Times is the number of times the fault triggers
+	// (0 triggers once, a negative value triggers on every match)
+	Times int
+
+	// Delay is the response delay for FaultDelay
+	Delay time.Duration
+}
+
+// faultState tracks how often a fault has matched and triggered.
+type faultState struct {
+	Fault
+	seen  int
+	fired int
+}
+
+// WithFault injects a fault into the device. See Fault.
+//
+// Example:
+//
+//	// Corrupt the response to the second Program Row command
+//	device := bootloadertest.NewDevice(
+//	    bootloadertest.WithFault(bootloadertest.Fault{
+//	        Kind:    bootloadertest.FaultCorruptChecksum,
+//	        Command: protocol.CmdProgramRow,
+//	        Skip:    1,
+//	    }),
+//	)
+func WithFault(f Fault) Option {
+	return func(d *Device) {
+		d.faults = append(d.faults, &faultState{Fault: f})
+	}
+}
+
+// InjectFault adds a fault to a running device. See Fault.
+func (d *Device) InjectFault(f Fault) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.faults = append(d.faults, &faultState{Fault: f})
+}
+
+// matchFault returns the first fault triggered by a command frame, if any.
+// Must be called with mu held.
+func (d *Device) matchFault(cmd byte, data []byte) *faultState {
+	for _, f := range d.faults {
+		if f.Command != 0 && f.Command != cmd {
+			continue
+		}
+		if f.Row != nil && !addressesRow(cmd, data, *f.Row) {
+			continue
+		}
+
+		f.seen++
+		if f.seen <= f.Skip {
+			continue
+		}
+
+		limit := f.Times
+		if limit == 0 {
+			limit = 1
+		}
+		if limit > 0 && f.fired >= limit {
+			continue
+		}
+
+		f.fired++
+		return f
+	}
+	return nil
+}
+
+// addressesRow reports whether a row command frame addresses row.
+func addressesRow(cmd byte, data []byte, row RowAddress) bool {
+	switch cmd {
+	case protocol.CmdProgramRow, protocol.CmdVerifyRow, protocol.CmdEraseRow:
+	default:
+		return false
+	}
+
+	return len(data) >= 3 &&
+		data[0] == row.ArrayID &&
+		binary.LittleEndian.Uint16(data[1:3]) == row.RowNum
+}
+
+// glitchRow flips a bit in the flash row addressed by a Program Row frame.
+// Must be called with mu held.
+func (d *Device) glitchRow(cmd byte, data []byte) {
+	if cmd != protocol.CmdProgramRow || len(data) < 3 {
+		return
+	}
+
+	addr := RowAddress{ArrayID: data[0], RowNum: binary.LittleEndian.Uint16(data[1:3])}
+	if row := d.flash[addr]; len(row) > 0 {
+		row[0] ^= 0x01
+	}
+}
+
+// applyFault alters the responses queued from index queued onwards.
+// Must be called with mu held.
+func (d *Device) applyFault(f *faultState, queued int) {
+	if queued >= len(d.responses) {
+		// The command sent no response
+		return
+	}
+
+	resp := d.responses[queued]
+	switch f.Kind {
+	case FaultTornRead:
+		half := len(resp.data) / 2
+		torn := []chunk{{data: resp.data[:half]}, {data: resp.data[half:]}}
+		d.responses = append(d.responses[:queued], append(torn, d.responses[queued+1:]...)...)
+	case FaultDelay:
+		d.responses[queued].delay = f.Delay
+	case FaultCorruptChecksum:
+		// Checksum is the two bytes before EOP
+		resp.data[len(resp.data)-3] ^= 0x01
+	}
+}
@@ -0,0 +1,117 @@
+package bootloadertest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestFaults(t *testing.T) {
+	row := &RowAddress{ArrayID: 0, RowNum: 0x0011}
+
+	tests := []struct {
+		name        string
+		fault       Fault
+		wantRetries int
+	}{
+		{
+			name:  "torn read",
+			fault: Fault{Kind: FaultTornRead, Times: -1},
+		},
+		{
+			name:        "corrupt checksum",
+			fault:       Fault{Kind: FaultCorruptChecksum, Command: protocol.CmdProgramRow, Row: row},
+			wantRetries: 1,
+		},
+		{
+			name:        "dropped frame",
+			fault:       Fault{Kind: FaultDropFrame, Command: protocol.CmdVerifyRow, Row: row},
+			wantRetries: 1,
+		},
+		{
+			name:        "delayed response",
+			fault:       Fault{Kind: FaultDelay, Command: protocol.CmdProgramRow, Row: row, Delay: 200 * time.Millisecond},
+			wantRetries: 1,
+		},
+		{
+			name:        "flash glitch",
+			fault:       Fault{Kind: FaultFlashGlitch, Command: protocol.CmdProgramRow, Row: row},
+			wantRetries: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := NewDevice(WithFault(tt.fault))
+			fw := testFirmware()
+
+			retries := map[uint16]int{}
+			prog := bootloader.New(device,
+				bootloader.WithReadTimeout(50*time.Millisecond),
+				bootloader.WithRowCallback(func(r bootloader.RowResult) {
+					retries[r.RowNum] = r.Retries
+				}),
+			)
+			if err := prog.Program(context.Background(), fw, testKey); err != nil {
+				t.Fatalf("Program: %v", err)
+			}
+
+			if retries[row.RowNum] != tt.wantRetries {
+				t.Errorf("row %d retries = %d, want %d", row.RowNum, retries[row.RowNum], tt.wantRetries)
+			}
+			if retries[0x0010] != 0 {
+				t.Errorf("row 16 retries = %d, want 0", retries[0x0010])
+			}
+		})
+	}
+}
+
+func TestFaultEOFAtRow(t *testing.T) {
+	device := NewDevice(WithFault(Fault{
+		Kind:  FaultEOF,
+		Row:   &RowAddress{ArrayID: 0, RowNum: 0x0010},
+		Times: -1,
+	}))
+
+	prog := bootloader.New(device)
+	err := prog.Program(context.Background(), testFirmware(), testKey)
+
+	var rowErr *bootloader.ProgramRowError
+	if !errors.As(err, &rowErr) {
+		t.Fatalf("error = %v, want *bootloader.ProgramRowError", err)
+	}
+	if rowErr.RowNum != 0x0010 || !errors.Is(err, io.EOF) {
+		t.Errorf("error = %v, want io.EOF at row 16", err)
+	}
+	if _, ok := device.Row(0, 0x0010); ok {
+		t.Error("row programmed despite EOF")
+	}
+}
+
+func TestFaultSkip(t *testing.T) {
+	device := NewDevice()
+	device.InjectFault(Fault{Kind: FaultDropFrame, Command: protocol.CmdGetFlashSize, Skip: 1})
+
+	prog := bootloader.New(device, bootloader.WithReadTimeout(20*time.Millisecond))
+	if _, err := prog.Connect(context.Background(), testKey); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	if _, err := prog.GetFlashSize(context.Background(), 0); err != nil {
+		t.Fatalf("first GetFlashSize: %v", err)
+	}
+	// Flash sizes are cached; make each call reach the device
+	prog.InvalidateCaches()
+	if _, err := prog.GetFlashSize(context.Background(), 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second GetFlashSize error = %v, want context.DeadlineExceeded", err)
+	}
+	prog.InvalidateCaches()
+	if _, err := prog.GetFlashSize(context.Background(), 0); err != nil {
+		t.Fatalf("third GetFlashSize: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package bootloadertest
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Latency is the distribution of the time a device takes to answer a command:
+// each response is delayed by Base plus a uniformly distributed random
+// duration in [0, Jitter].
+type Latency struct {
+	// Base is the fixed part of the delay
+	Base time.Duration
+
+	// Jitter is the maximum random delay added to Base
+	Jitter time.Duration
+}
+
+// Dribble makes the device deliver responses a few bytes at a time, like a
+// slow UART or a USB-serial bridge flushing small packets.
+type Dribble struct {
+	// Bytes is the maximum number of bytes returned by one Read
+	Bytes int
+
+	// Interval is the delay before each piece after the first
+	Interval time.Duration
+}
+
+// WithLatency delays every response by the given distribution. Use
+// WithCommandLatency for commands that take longer, such as Program Row.
+// Default is no delay.
+//
+// Example:
+//
+//	device := bootloadertest.NewDevice(
+//	    bootloadertest.WithLatency(bootloadertest.Latency{Base: 2 * time.Millisecond, Jitter: time.Millisecond}),
+//	    bootloadertest.WithCommandLatency(protocol.CmdProgramRow, bootloadertest.Latency{Base: 20 * time.Millisecond}),
+//	)
+func WithLatency(l Latency) Option {
+	return func(d *Device) {
+		d.latency = l
+	}
+}
+
+// WithCommandLatency delays responses to cmd by the given distribution in
+// place of the one set by WithLatency.
+func WithCommandLatency(cmd byte, l Latency) Option {
+	return func(d *Device) {
+		if d.commandLatency == nil {
+			d.commandLatency = make(map[byte]Latency)
+		}
+		d.commandLatency[cmd] = l
+	}
+}
+
+// WithJitterSeed seeds the random source of the jitter, so a failing test
+// can be replayed with the same delays. Default is 1.
+func WithJitterSeed(seed int64) Option {
+	return func(d *Device) {
+		d.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithDribble splits every response into pieces of at most dr.Bytes bytes,
+// each returned by its own Read after dr.Interval, to exercise frame
+// reassembly. Default is one Read per response.
+func WithDribble(dr Dribble) Option {
+	return func(d *Device) {
+		d.dribble = dr
+	}
+}
+
+// delay draws the response delay of cmd. Must be called with mu held.
+func (d *Device) delay(cmd byte) time.Duration {
+	l, ok := d.commandLatency[cmd]
+	if !ok {
+		l = d.latency
+	}
+	delay := l.Base
+	if l.Jitter > 0 {
+		delay += time.Duration(d.rand.Int63n(int64(l.Jitter) + 1))
+	}
+	return delay
+}
+
+// applyTiming delays the responses queued from index queued onwards and
+// splits them into dribbled pieces. Must be called with mu held.
+func (d *Device) applyTiming(cmd byte, queued int) {
+	if queued >= len(d.responses) {
+		return
+	}
+
+	d.responses[queued].delay += d.delay(cmd)
+
+	n := d.dribble.Bytes
+	if n <= 0 {
+		return
+	}
+	var pieces []chunk
+	for _, c := range d.responses[queued:] {
+		for first := true; len(c.data) > 0; first = false {
+			size := min(n, len(c.data))
+			piece := chunk{data: c.data[:size], delay: c.delay}
+			if !first {
+				piece.delay = d.dribble.Interval
+			}
+			pieces = append(pieces, piece)
+			c.data = c.data[size:]
+		}
+	}
+	d.responses = append(d.responses[:queued], pieces...)
+}
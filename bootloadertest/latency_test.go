@@ -0,0 +1,98 @@
+package bootloadertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestLatency(t *testing.T) {
+	device := NewDevice(
+		WithLatency(Latency{Base: 5 * time.Millisecond, Jitter: 5 * time.Millisecond}),
+		WithCommandLatency(protocol.CmdGetFlashSize, Latency{Base: 30 * time.Millisecond}),
+	)
+	prog := bootloader.New(device, bootloader.WithReadTimeout(time.Second))
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := prog.Connect(ctx, testKey); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("Enter Bootloader answered after %s, want at least 5ms", elapsed)
+	}
+
+	start = time.Now()
+	if _, err := prog.GetFlashSize(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Get Flash Size answered after %s, want at least 30ms", elapsed)
+	}
+
+	// A command slower than the read timeout times out
+	slow := NewDevice(WithCommandLatency(protocol.CmdEnterBootloader, Latency{Base: 200 * time.Millisecond}))
+	prog = bootloader.New(slow, bootloader.WithReadTimeout(20*time.Millisecond), bootloader.WithSkipExit())
+	if _, err := prog.Connect(ctx, testKey); !bootloader.IsTimeout(err) {
+		t.Errorf("Connect with a slow device: %v", err)
+	}
+}
+
+func TestJitterSeed(t *testing.T) {
+	draw := func(seed int64) []time.Duration {
+		d := NewDevice(WithLatency(Latency{Base: time.Millisecond, Jitter: time.Millisecond}), WithJitterSeed(seed))
+		var delays []time.Duration
+		for i := 0; i < 20; i++ {
+			delay := d.delay(protocol.CmdVerifyRow)
+			if delay < time.Millisecond || delay > 2*time.Millisecond {
+				t.Fatalf("delay %s outside [1ms, 2ms]", delay)
+			}
+			delays = append(delays, delay)
+		}
+		return delays
+	}
+
+	a, b, c := draw(7), draw(7), draw(8)
+	same := true
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("delay %d: %s and %s with the same seed", i, a[i], b[i])
+		}
+		same = same && a[i] == c[i]
+	}
+	if same {
+		t.Error("different seeds drew the same delays")
+	}
+}
+
+func TestDribble(t *testing.T) {
+	device := NewDevice(WithDribble(Dribble{Bytes: 3, Interval: 100 * time.Microsecond}))
+	prog := bootloader.New(device, bootloader.WithReadTimeout(time.Second))
+	if err := prog.Program(context.Background(), testFirmware(), testKey); err != nil {
+		t.Fatalf("Program with dribbled responses: %v", err)
+	}
+	if len(device.Rows()) != len(testFirmware().Rows) {
+		t.Errorf("programmed %d rows", len(device.Rows()))
+	}
+
+	// Each Read returns at most 3 bytes
+	frame, _ := protocol.BuildCommand(protocol.CmdEnterBootloader, testKey)
+	if _, err := device.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 64)
+	total := 0
+	for total < protocol.MinFrameSize+protocol.EnterBootloaderResponseSize {
+		n, err := device.ReadContext(context.Background(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 3 {
+			t.Fatalf("Read returned %d bytes", n)
+		}
+		total += n
+	}
+}
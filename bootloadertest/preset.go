@@ -0,0 +1,127 @@
+package bootloadertest
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Preset is a named device configuration with realistic geometry.
+type Preset struct {
+	// Name selects the preset in LookupPreset and NewPresetDevice
+	Name string
+
+	// Description summarizes the simulated device
+	Description string
+
+	// SiliconID and SiliconRev are reported by Enter Bootloader
+	SiliconID  uint32
+	SiliconRev byte
+
+	// FlashStart and FlashEnd are the application rows reported by Get Flash Size;
+	// rows below FlashStart are occupied by the bootloader
+	FlashStart uint16
+	FlashEnd   uint16
+
+	// RowSize is the flash row size in bytes
+	RowSize int
+
+	// Applications is the number of application slots (1 or 2)
+	Applications byte
+
+	// ChecksumType is the packet checksum type the bootloader was built with
+	ChecksumType byte
+}
+
+// Options returns the device options that configure the preset.
+func (p Preset) Options() []Option {
+	return []Option{
+		WithSiliconID(p.SiliconID),
+		WithSiliconRev(p.SiliconRev),
+		WithFlashRange(p.FlashStart, p.FlashEnd),
+		WithRowSize(p.RowSize),
+		WithApplications(p.Applications),
+		WithChecksumType(p.ChecksumType),
+	}
+}
+
+var presets = map[string]Preset{
+	"psoc4": {
+		Name:         "psoc4",
+		Description:  "PSoC 4 (32 KB flash, 128-byte rows, single application)",
+		SiliconID:    0x04C81193,
+		SiliconRev:   0x11,
+		FlashStart:   0x0020,
+		FlashEnd:     0x00FF,
+		RowSize:      128,
+		Applications: 1,
+		ChecksumType: protocol.ChecksumBasicSum,
+	},
+	"psoc4-crc": {
+		Name:         "psoc4-crc",
+		Description:  "PSoC 4 bootloader built with CRC-16 packet checksums",
+		SiliconID:    0x04C81193,
+		SiliconRev:   0x11,
+		FlashStart:   0x0020,
+		FlashEnd:     0x00FF,
+		RowSize:      128,
+		Applications: 1,
+		ChecksumType: protocol.ChecksumCRC16,
+	},
+	"psoc5lp": {
+		Name:         "psoc5lp",
+		Description:  "PSoC 5LP (256-byte rows, single application)",
+		SiliconID:    DefaultSiliconID,
+		SiliconRev:   0x00,
+		FlashStart:   0x0018,
+		FlashEnd:     0x00FF,
+		RowSize:      256,
+		Applications: 1,
+		ChecksumType: protocol.ChecksumBasicSum,
+	},
+	"psoc5lp-dual": {
+		Name:         "psoc5lp-dual",
+		Description:  "PSoC 5LP with a multi-application (dual-image) bootloader",
+		SiliconID:    DefaultSiliconID,
+		SiliconRev:   0x00,
+		FlashStart:   0x0018,
+		FlashEnd:     0x00FF,
+		RowSize:      256,
+		Applications: 2,
+		ChecksumType: protocol.ChecksumBasicSum,
+	},
+}
+
+// Presets returns all device presets, sorted by name.
+func Presets() []Preset {
+	list := make([]Preset, 0, len(presets))
+	for _, p := range presets {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// LookupPreset returns the preset with the given name.
+func LookupPreset(name string) (Preset, bool) {
+	p, ok := presets[name]
+	return p, ok
+}
+
+// NewPresetDevice creates a device configured by the named preset.
+// Additional options are applied after the preset and override it.
+//
+// Example:
+//
+//	for _, preset := range bootloadertest.Presets() {
+//	    device, _ := bootloadertest.NewPresetDevice(preset.Name)
+//	    // ...
+//	}
+func NewPresetDevice(name string, opts ...Option) (*Device, error) {
+	p, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown device preset %q", name)
+	}
+	return NewDevice(append(p.Options(), opts...)...), nil
+}
@@ -0,0 +1,98 @@
+package bootloadertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// presetFirmware builds a two-row image matching the preset geometry.
+func presetFirmware(p Preset) *cyacd.Firmware {
+	fw := &cyacd.Firmware{SiliconID: p.SiliconID, SiliconRev: p.SiliconRev, ChecksumType: p.ChecksumType}
+	for _, rowNum := range []uint16{p.FlashStart, p.FlashEnd} {
+		data := bytes.Repeat([]byte{byte(rowNum)}, p.RowSize)
+		fw.Rows = append(fw.Rows, &cyacd.Row{
+			RowNum:   rowNum,
+			Size:     uint16(len(data)),
+			Data:     data,
+			Checksum: protocol.CalculateRowChecksum(data),
+		})
+	}
+	return fw
+}
+
+func TestPresets(t *testing.T) {
+	for _, preset := range Presets() {
+		t.Run(preset.Name, func(t *testing.T) {
+			device, err := NewPresetDevice(preset.Name)
+			if err != nil {
+				t.Fatalf("NewPresetDevice: %v", err)
+			}
+
+			fw := presetFirmware(preset)
+			prog := bootloader.New(device)
+			if err := prog.Program(context.Background(), fw, testKey); err != nil {
+				t.Fatalf("Program: %v", err)
+			}
+			if got := len(device.Rows()); got != len(fw.Rows) {
+				t.Errorf("programmed %d rows, want %d", got, len(fw.Rows))
+			}
+
+			// Multi-application commands are only answered by dual-application presets
+			prog = bootloader.New(device, bootloader.WithChecksumType(preset.ChecksumType))
+			if _, err := prog.Connect(context.Background(), testKey); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			_, err = prog.GetAppStatus(context.Background(), 0)
+			if preset.Applications > 1 && err != nil {
+				t.Errorf("GetAppStatus: %v", err)
+			}
+			var protoErr *protocol.ProtocolError
+			if preset.Applications == 1 && (!errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrCommand) {
+				t.Errorf("GetAppStatus error = %v, want ErrCommand", err)
+			}
+		})
+	}
+}
+
+func TestPresetRowSize(t *testing.T) {
+	preset, _ := LookupPreset("psoc4")
+	device, _ := NewPresetDevice("psoc4")
+
+	fw := presetFirmware(preset)
+	fw.Rows[0].Data = fw.Rows[0].Data[:64]
+	fw.Rows[0].Size = 64
+
+	prog := bootloader.New(device)
+	err := prog.Program(context.Background(), fw, testKey)
+
+	var protoErr *protocol.ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.StatusCode != protocol.ErrLength {
+		t.Fatalf("error = %v, want ErrLength", err)
+	}
+}
+
+func TestPresetChecksumMismatch(t *testing.T) {
+	preset, _ := LookupPreset("psoc4-crc")
+	device, _ := NewPresetDevice(preset.Name)
+
+	// A file claiming basic-sum checksums cannot talk to a CRC-16 bootloader
+	fw := presetFirmware(preset)
+	fw.ChecksumType = protocol.ChecksumBasicSum
+
+	prog := bootloader.New(device)
+	if err := prog.Program(context.Background(), fw, testKey); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestNewPresetDeviceUnknown(t *testing.T) {
+	if _, err := NewPresetDevice("psoc99"); err == nil {
+		t.Fatal("expected error for unknown preset")
+	}
+}
@@ -0,0 +1,129 @@
+package bootloadertest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Serve accepts connections on l and serves d to each of them in turn, like
+// a TCP-to-UART bridge in front of a real bootloader. Flash contents persist
+// across connections. Serve returns when ctx is done (closing l) or when
+// Accept fails.
+//
+// Example:
+//
+//	l, _ := net.Listen("tcp", "127.0.0.1:0")
+//	go bootloadertest.Serve(ctx, l, bootloadertest.NewDevice())
+//	conn, _ := net.Dial("tcp", l.Addr().String())
+//	prog := bootloader.New(conn)
+func Serve(ctx context.Context, l net.Listener, d *Device) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		closeConn := context.AfterFunc(ctx, func() { conn.Close() })
+		_ = ServeConn(conn, d)
+		closeConn()
+		conn.Close()
+	}
+}
+
+// ServeConn serves d over a byte stream until it returns an error or EOF.
+// Command frames are reassembled from the stream however it splits them,
+// written to d, and d's responses are written back. A FaultEOF injected into
+// d ends the connection, like an unplugged device.
+func ServeConn(conn io.ReadWriter, d *Device) error {
+	buf := make([]byte, 0, protocol.MinFrameSize+protocol.MaxDataSize)
+	read := make([]byte, 4096)
+	for {
+		n, err := conn.Read(read)
+		buf = append(buf, read[:n]...)
+
+		for {
+			frame, rest, ok := nextFrame(buf)
+			if !ok {
+				buf = append(buf[:0], rest...)
+				break
+			}
+			if _, werr := d.Write(frame); werr != nil {
+				return werr
+			}
+			if werr := forwardResponses(conn, d); werr != nil {
+				return werr
+			}
+			buf = append(buf[:0], rest...)
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// nextFrame splits the first complete frame off buf. Bytes before a start of
+// packet, other than a HID report ID directly in front of it, are dropped, as
+// are start of packet bytes whose length field exceeds the maximum frame size.
+func nextFrame(buf []byte) (frame, rest []byte, ok bool) {
+	for {
+		start := 0
+		for start < len(buf) && buf[start] != protocol.StartOfPacket {
+			start++
+		}
+		if start > 0 {
+			start-- // keep a possible report ID
+		}
+		buf = buf[start:]
+
+		offset := 0
+		if len(buf) > 1 && buf[0] != protocol.StartOfPacket {
+			offset = 1
+		}
+		if len(buf) < offset+4 {
+			return nil, buf, false
+		}
+
+		dataLen := int(binary.LittleEndian.Uint16(buf[offset+2 : offset+4]))
+		if dataLen > protocol.MaxDataSize {
+			buf = buf[offset+1:]
+			continue
+		}
+		size := offset + protocol.MinFrameSize + dataLen
+		if len(buf) < size {
+			return nil, buf, false
+		}
+		return buf[:size], buf[size:], true
+	}
+}
+
+// forwardResponses writes every queued response of d to w.
+func forwardResponses(w io.Writer, d *Device) error {
+	p := make([]byte, protocol.MinFrameSize+protocol.MaxDataSize)
+	for {
+		n, err := d.Read(p)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package bootloadertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	device := NewDevice(WithKey(testKey))
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, l, device) }()
+
+	fw := testFirmware()
+	for i := 0; i < 2; i++ { // flash persists across connections
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog := bootloader.New(conn, bootloader.WithReadTimeout(2*time.Second))
+		if err := prog.Program(context.Background(), fw, testKey); err != nil {
+			t.Fatalf("connection %d: Program: %v", i, err)
+		}
+		conn.Close()
+	}
+
+	data, ok := device.Row(0, 0x0011)
+	if !ok || !bytes.Equal(data, fw.Rows[1].Data) {
+		t.Errorf("row 0x0011 = % 02X, %t", data, ok)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Serve returned %v, want context.Canceled", err)
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	sync, _ := protocol.BuildSyncBootloaderCmd()
+	stream := append([]byte{0xAA, 0xBB, 0x00}, sync...) // garbage, then a report ID
+	stream = append(stream, sync[:3]...)
+
+	frame, rest, ok := nextFrame(stream)
+	if !ok || !bytes.Equal(frame, append([]byte{0x00}, sync...)) {
+		t.Fatalf("frame = % 02X, %t", frame, ok)
+	}
+	if _, rest, ok = nextFrame(rest); ok || !bytes.Equal(rest, sync[:3]) {
+		t.Errorf("partial frame: rest = % 02X, ok = %t", rest, ok)
+	}
+}
@@ -0,0 +1,150 @@
+//go:build js && wasm
+
+package browser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"syscall/js"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// respond writes a frame to device and returns its responses.
+func respond(device *bootloadertest.Device, frame []byte) []byte {
+	device.Write(frame)
+	var out bytes.Buffer
+	buf := make([]byte, 512)
+	for {
+		n, err := device.Read(buf)
+		if errors.Is(err, io.EOF) {
+			return out.Bytes()
+		}
+		out.Write(buf[:n])
+	}
+}
+
+// fakeSerialPort returns a JavaScript object with the readable and writable
+// streams of a SerialPort, backed by device.
+func fakeSerialPort(device *bootloadertest.Device) js.Value {
+	var controller js.Value
+	start := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		controller = args[0]
+		return nil
+	})
+	readable := js.Global().Get("ReadableStream").New(map[string]any{"start": start})
+
+	write := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if resp := respond(device, goBytes(args[0])); len(resp) > 0 {
+			controller.Call("enqueue", uint8Array(resp))
+		}
+		return nil
+	})
+	writable := js.Global().Get("WritableStream").New(map[string]any{"write": write})
+
+	port := js.Global().Get("Object").New()
+	port.Set("readable", readable)
+	port.Set("writable", writable)
+	return port
+}
+
+// fakeUSBDevice returns a JavaScript object with the transfer methods of a
+// USBDevice, backed by device.
+func fakeUSBDevice(device *bootloadertest.Device) js.Value {
+	promise := js.Global().Get("Promise")
+	var queued []byte
+	transferOut := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		data := goBytes(args[1])
+		queued = append(queued, respond(device, data)...)
+		return promise.Call("resolve", map[string]any{"status": "ok", "bytesWritten": len(data)})
+	})
+	transferIn := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		n := min(args[1].Int(), len(queued))
+		data := js.Global().Get("DataView").New(uint8Array(queued[:n]).Get("buffer"))
+		queued = queued[n:]
+		return promise.Call("resolve", map[string]any{"status": "ok", "data": data})
+	})
+
+	usb := js.Global().Get("Object").New()
+	usb.Set("transferOut", transferOut)
+	usb.Set("transferIn", transferIn)
+	return usb
+}
+
+func testFirmware() *cyacd.Firmware {
+	fw := &cyacd.Firmware{SiliconID: 0x1E9602AA}
+	for i := 0; i < 4; i++ {
+		fw.Rows = append(fw.Rows, cyacd.NewRow(0, uint16(0x10+i), bytes.Repeat([]byte{byte(i)}, 64)))
+	}
+	return fw
+}
+
+func TestSerial(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	port, err := NewSerial(fakeSerialPort(device))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+
+	prog := bootloader.New(port, bootloader.WithVerifyAfterProgram(false))
+	if err := prog.Program(context.Background(), testFirmware(), []byte(protocol.DefaultExampleKey)); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	if got := len(device.Rows()); got != 4 {
+		t.Errorf("device has %d rows, want 4", got)
+	}
+
+	if _, err := NewSerial(js.Global().Get("Object").New()); err == nil {
+		t.Error("NewSerial accepted a closed port")
+	}
+}
+
+func TestSerialReadTimeout(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	port, err := NewSerial(fakeSerialPort(device))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	buf := make([]byte, 64)
+	if _, err := port.ReadContext(ctx, buf); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ReadContext of a silent port: %v", err)
+	}
+
+	// The read left pending receives the response to the next command
+	cmd, err := protocol.BuildEnterBootloaderCmd([]byte(protocol.DefaultExampleKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := port.Write(cmd); err != nil {
+		t.Fatal(err)
+	}
+	n, err := port.Read(buf)
+	if err != nil || n == 0 || buf[0] != protocol.StartOfPacket {
+		t.Errorf("Read after timeout = %d, %v (% X)", n, err, buf[:n])
+	}
+}
+
+func TestUSB(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	usb := NewUSB(fakeUSBDevice(device), 1, 2, 0)
+
+	prog := bootloader.New(usb, bootloader.WithVerifyAfterProgram(false))
+	if err := prog.Program(context.Background(), testFirmware(), []byte(protocol.DefaultExampleKey)); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	if got := len(device.Rows()); got != 4 {
+		t.Errorf("device has %d rows, want 4", got)
+	}
+}
@@ -0,0 +1,46 @@
+// Package browser adapts the Web Serial and WebUSB APIs to the io.ReadWriter
+// the bootloader package programs through, for browser-based field-update
+// tools compiled to WebAssembly (GOOS=js GOARCH=wasm). The cyacd, protocol,
+// and bootloader packages build for js/wasm unchanged, so the page runs the
+// same protocol implementation as native tools.
+//
+// The page requests and opens the device in JavaScript, since browsers only
+// grant access in response to a user gesture, and hands it to Go:
+//
+//	// JavaScript
+//	const port = await navigator.serial.requestPort();
+//	await port.open({ baudRate: 115200 });
+//	flash(port, new Uint8Array(await file.arrayBuffer()));
+//
+//	// Go
+//	js.Global().Set("flash", js.FuncOf(func(this js.Value, args []js.Value) any {
+//	    go func() {
+//	        port, err := browser.NewSerial(args[0])
+//	        if err != nil {
+//	            log.Print(err)
+//	            return
+//	        }
+//	        defer port.Close()
+//	        image := make([]byte, args[1].Length())
+//	        js.CopyBytesToGo(image, args[1])
+//	        fw, err := cyacd.ParseReader(bytes.NewReader(image))
+//	        if err != nil {
+//	            log.Print(err)
+//	            return
+//	        }
+//	        prog := bootloader.New(port)
+//	        err = prog.Program(context.Background(), fw, []byte(protocol.DefaultExampleKey))
+//	        ...
+//	    }()
+//	    return nil
+//	}))
+//
+// Every call waits for JavaScript promises, so it must run on its own
+// goroutine, never directly in a js.FuncOf callback, which would deadlock the
+// event loop.
+//
+// NewSerial wraps a Web Serial SerialPort; NewUSB wraps a WebUSB USBDevice
+// with a claimed interface and its bulk or interrupt endpoints. Both
+// implement bootloader.ContextReader and bootloader.ContextWriter, so read
+// timeouts and cancellation take effect while a promise is pending.
+package browser
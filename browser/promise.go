@@ -0,0 +1,76 @@
+//go:build js && wasm
+
+package browser
+
+import (
+	"context"
+	"syscall/js"
+)
+
+// settled is the outcome of a JavaScript promise.
+type settled struct {
+	value js.Value
+	err   error
+}
+
+// await subscribes to p and returns a channel that receives its outcome.
+// The channel is buffered, so a promise whose caller gave up does not block
+// the event loop when it settles.
+func await(p js.Value) <-chan settled {
+	ch := make(chan settled, 1)
+	var resolve, reject js.Func
+	release := func() {
+		resolve.Release()
+		reject.Release()
+	}
+	resolve = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		ch <- settled{value: arg(args)}
+		release()
+		return nil
+	})
+	reject = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		ch <- settled{err: js.Error{Value: arg(args)}}
+		release()
+		return nil
+	})
+	p.Call("then", resolve, reject)
+	return ch
+}
+
+// wait waits for p to settle or ctx to be done.
+func wait(ctx context.Context, p js.Value) (js.Value, error) {
+	select {
+	case s := <-await(p):
+		return s.value, s.err
+	case <-ctx.Done():
+		return js.Undefined(), ctx.Err()
+	}
+}
+
+func arg(args []js.Value) js.Value {
+	if len(args) == 0 {
+		return js.Undefined()
+	}
+	return args[0]
+}
+
+// uint8Array copies b into a new Uint8Array.
+func uint8Array(b []byte) js.Value {
+	a := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(a, b)
+	return a
+}
+
+// goBytes copies the bytes of a Uint8Array, ArrayBuffer, or DataView.
+func goBytes(v js.Value) []byte {
+	if !v.InstanceOf(js.Global().Get("Uint8Array")) {
+		if buffer := v.Get("buffer"); buffer.Truthy() {
+			v = js.Global().Get("Uint8Array").New(buffer, v.Get("byteOffset"), v.Get("byteLength"))
+		} else {
+			v = js.Global().Get("Uint8Array").New(v)
+		}
+	}
+	b := make([]byte, v.Length())
+	js.CopyBytesToGo(b, v)
+	return b
+}
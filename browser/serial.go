@@ -0,0 +1,108 @@
+//go:build js && wasm
+
+package browser
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall/js"
+)
+
+// Serial is a Web Serial port opened by the page.
+type Serial struct {
+	port   js.Value
+	reader js.Value
+	writer js.Value
+
+	// pending holds bytes of a chunk not yet returned by Read; inflight is
+	// a read that was still pending when an earlier Read gave up
+	pending  []byte
+	inflight <-chan settled
+}
+
+// NewSerial wraps a SerialPort the page has opened with port.open(). It
+// locks the readable and writable streams of the port until Close.
+func NewSerial(port js.Value) (*Serial, error) {
+	readable, writable := port.Get("readable"), port.Get("writable")
+	if !readable.Truthy() || !writable.Truthy() {
+		return nil, errors.New("serial port is not open")
+	}
+	return &Serial{
+		port:   port,
+		reader: readable.Call("getReader"),
+		writer: writable.Call("getWriter"),
+	}, nil
+}
+
+func (s *Serial) Read(p []byte) (int, error) {
+	return s.ReadContext(context.Background(), p)
+}
+
+// ReadContext returns the bytes of the next chunk the port delivers. A read
+// interrupted by ctx stays pending and delivers its chunk to the next call.
+func (s *Serial) ReadContext(ctx context.Context, p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.inflight == nil {
+			s.inflight = await(s.reader.Call("read"))
+		}
+		select {
+		case r := <-s.inflight:
+			s.inflight = nil
+			if r.err != nil {
+				return 0, r.err
+			}
+			if r.value.Get("done").Bool() {
+				return 0, io.EOF
+			}
+			s.pending = goBytes(r.value.Get("value"))
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *Serial) Write(p []byte) (int, error) {
+	return s.WriteContext(context.Background(), p)
+}
+
+// WriteContext writes p to the port.
+func (s *Serial) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if _, err := wait(ctx, s.writer.Call("write", uint8Array(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ResetInputBuffer drops the bytes received but not yet read.
+func (s *Serial) ResetInputBuffer() error {
+	s.pending = nil
+	return nil
+}
+
+// SetDTR sets the Data Terminal Ready signal, for bootloader.LineResetter.
+func (s *Serial) SetDTR(dtr bool) error {
+	return s.setSignal("dataTerminalReady", dtr)
+}
+
+// SetRTS sets the Request To Send signal, for bootloader.LineResetter.
+func (s *Serial) SetRTS(rts bool) error {
+	return s.setSignal("requestToSend", rts)
+}
+
+func (s *Serial) setSignal(name string, value bool) error {
+	_, err := wait(context.Background(), s.port.Call("setSignals", map[string]any{name: value}))
+	return err
+}
+
+// Close cancels a pending read and releases the streams of the port. The
+// port stays open; the page closes it with port.close().
+func (s *Serial) Close() error {
+	_, err := wait(context.Background(), s.reader.Call("cancel"))
+	s.reader.Call("releaseLock")
+	s.writer.Call("releaseLock")
+	return err
+}
@@ -0,0 +1,114 @@
+//go:build js && wasm
+
+package browser
+
+import (
+	"context"
+	"fmt"
+	"syscall/js"
+)
+
+// DefaultUSBPacketSize is the default length requested by each WebUSB IN
+// transfer, the maximum packet size of a full-speed bulk endpoint.
+const DefaultUSBPacketSize = 64
+
+// USB is a WebUSB device with a claimed interface, exchanging frames over
+// one IN and one OUT endpoint.
+type USB struct {
+	device     js.Value
+	in, out    int
+	packetSize int
+
+	// pending holds bytes of a transfer not yet returned by Read; inflight
+	// is a transfer that was still pending when an earlier Read gave up
+	pending  []byte
+	inflight <-chan settled
+}
+
+// NewUSB wraps a USBDevice the page has opened, configured, and claimed an
+// interface of, exchanging data over the endpoints numbered in and out.
+// packetSize is the length of each IN transfer; 0 selects
+// DefaultUSBPacketSize.
+//
+// Example (JavaScript):
+//
+//	const device = await navigator.usb.requestDevice({ filters: [{ vendorId: 0x04b4 }] });
+//	await device.open();
+//	await device.selectConfiguration(1);
+//	await device.claimInterface(0);
+//	flashUSB(device);  // calls browser.NewUSB(device, 1, 2, 0) in Go
+func NewUSB(device js.Value, in, out, packetSize int) *USB {
+	if packetSize <= 0 {
+		packetSize = DefaultUSBPacketSize
+	}
+	return &USB{device: device, in: in, out: out, packetSize: packetSize}
+}
+
+func (u *USB) Read(p []byte) (int, error) {
+	return u.ReadContext(context.Background(), p)
+}
+
+// ReadContext returns the bytes of the next IN transfer. A transfer
+// interrupted by ctx stays pending and delivers its data to the next call.
+func (u *USB) ReadContext(ctx context.Context, p []byte) (int, error) {
+	for len(u.pending) == 0 {
+		if u.inflight == nil {
+			u.inflight = await(u.device.Call("transferIn", u.in, u.packetSize))
+		}
+		select {
+		case r := <-u.inflight:
+			u.inflight = nil
+			if r.err != nil {
+				return 0, r.err
+			}
+			if err := transferStatus(r.value); err != nil {
+				return 0, err
+			}
+			if data := r.value.Get("data"); data.Truthy() {
+				u.pending = goBytes(data)
+			}
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	n := copy(p, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+func (u *USB) Write(p []byte) (int, error) {
+	return u.WriteContext(context.Background(), p)
+}
+
+// WriteContext sends p in one OUT transfer.
+func (u *USB) WriteContext(ctx context.Context, p []byte) (int, error) {
+	result, err := wait(ctx, u.device.Call("transferOut", u.out, uint8Array(p)))
+	if err != nil {
+		return 0, err
+	}
+	if err := transferStatus(result); err != nil {
+		return 0, err
+	}
+	return result.Get("bytesWritten").Int(), nil
+}
+
+// ResetInputBuffer drops the bytes received but not yet read.
+func (u *USB) ResetInputBuffer() error {
+	u.pending = nil
+	return nil
+}
+
+// Close does nothing: the page owns the device and closes it with
+// device.close().
+func (u *USB) Close() error {
+	return nil
+}
+
+// transferStatus returns an error for a USBInTransferResult or
+// USBOutTransferResult whose status is not "ok".
+func transferStatus(result js.Value) error {
+	if status := result.Get("status").String(); status != "ok" {
+		return fmt.Errorf("usb transfer: %s", status)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Device is one device of the inventory.
+type Device struct {
+	// ID names the device in results and logs, e.g. its serial number. It
+	// is also passed to the Programmer with bootloader.WithDeviceID.
+	ID string
+
+	// Open opens the transport of the device. A transport that implements
+	// io.Closer is closed after each attempt.
+	Open func(ctx context.Context) (io.ReadWriter, error)
+}
+
+// Policy configures a rollout.
+type Policy struct {
+	// MaxParallel is the number of devices updated at the same time.
+	// Default (0) is 1: one device after another.
+	MaxParallel int
+
+	// Retries is the number of times a device is retried after an attempt
+	// fails with an error bootloader.IsRetryable accepts. Default is 0.
+	Retries int
+
+	// RetryDelay is the pause before each retry, e.g. to let a device
+	// restart. Default is no pause.
+	RetryDelay time.Duration
+
+	// VersionGate updates a device only if the image is newer than the
+	// installed application, with bootloader.Programmer.UpdateIfNewer.
+	// Devices already up to date are reported as UpToDate. The image must
+	// embed application metadata. Default is false: every device is
+	// programmed.
+	VersionGate bool
+
+	// MaxFailures stops the rollout once that many devices have failed:
+	// devices not started yet are reported as NotStarted, while devices
+	// already being updated finish. Default (0) is no limit.
+	MaxFailures int
+
+	// ProgrammerOptions are applied to the Programmer of every device, e.g.
+	// a transport profile or bootloader.WithVersionCompare
+	ProgrammerOptions []bootloader.Option
+
+	// OnResult, if set, is called with the result of each device as soon as
+	// it is known, for dashboards and logs. Calls are not concurrent.
+	OnResult func(Result)
+}
+
+// Status is the outcome of a device.
+type Status int
+
+// Device outcomes.
+const (
+	// NotStarted means the device was not attempted, because the rollout
+	// stopped (see Policy.MaxFailures) or its context was done
+	NotStarted Status = iota
+
+	// Updated means the image was programmed
+	Updated
+
+	// UpToDate means the device already ran the image's version and was
+	// left alone (see Policy.VersionGate)
+	UpToDate
+
+	// Failed means the last attempt failed; Result.Err says how
+	Failed
+)
+
+// String returns "not started", "updated", "up to date", or "failed".
+func (s Status) String() string {
+	switch s {
+	case NotStarted:
+		return "not started"
+	case Updated:
+		return "updated"
+	case UpToDate:
+		return "up to date"
+	case Failed:
+		return "failed"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// Result is the outcome of one device.
+type Result struct {
+	// ID is the ID of the device
+	ID string
+
+	// Status is the outcome
+	Status Status
+
+	// Err is why the last attempt failed (nil unless Status is Failed)
+	Err error
+
+	// Attempts is the number of attempts made, including retries
+	Attempts int
+
+	// Report is the report of the last programming attempt (nil if the
+	// device was not programmed, or with Policy.VersionGate)
+	Report *bootloader.ProgramReport
+
+	// Duration is the time spent on the device, including retry delays
+	Duration time.Duration
+}
+
+// Summary counts the outcomes of a rollout.
+type Summary struct {
+	// Devices is the number of devices in the inventory
+	Devices int
+
+	// Updated, UpToDate, Failed, and NotStarted count the devices with
+	// each Status
+	Updated    int
+	UpToDate   int
+	Failed     int
+	NotStarted int
+
+	// Retries is the number of attempts beyond the first, over all devices
+	Retries int
+}
+
+// Report is the outcome of a rollout. Returned by Run.
+type Report struct {
+	// Results holds the result of every device, in inventory order
+	Results []Result
+
+	// Summary counts the outcomes
+	Summary Summary
+
+	// Halted reports whether the rollout stopped after Policy.MaxFailures
+	// failures
+	Halted bool
+
+	// Duration is the time the whole rollout took
+	Duration time.Duration
+}
+
+// Succeeded reports whether every device was updated or already up to date.
+func (r *Report) Succeeded() bool {
+	return r.Summary.Failed == 0 && r.Summary.NotStarted == 0
+}
+
+// WriteText writes the report as a table with one line per device, followed
+// by the summary.
+func (r *Report) WriteText(w io.Writer) error {
+	width := 0
+	for _, res := range r.Results {
+		width = max(width, len(res.ID))
+	}
+	for _, res := range r.Results {
+		attempts := fmt.Sprintf("%d attempt", res.Attempts)
+		if res.Attempts != 1 {
+			attempts += "s"
+		}
+		line := fmt.Sprintf("%-*s  %-11s  %-10s  %8s", width, res.ID, res.Status, attempts, res.Duration.Round(10*time.Millisecond))
+		if res.Err != nil {
+			line += "  error: " + res.Err.Error()
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	s := r.Summary
+	_, err := fmt.Fprintf(w, "%d devices: %d updated, %d up to date, %d failed, %d not started\n",
+		s.Devices, s.Updated, s.UpToDate, s.Failed, s.NotStarted)
+	if err == nil && r.Halted {
+		_, err = fmt.Fprintln(w, "rollout halted after too many failures")
+	}
+	return err
+}
+
+// Run rolls fw out to devices under policy and returns the report. Devices
+// are started in inventory order. Failed devices do not stop the rollout
+// unless Policy.MaxFailures is reached; when ctx is done, devices being
+// updated are canceled and the others are not started. The returned error
+// is only for invalid arguments; the outcome of every device is in the
+// report. fw is shared by all devices and must not be changed during Run.
+func Run(ctx context.Context, devices []Device, fw *cyacd.Firmware, key []byte, policy Policy) (*Report, error) {
+	if fw == nil {
+		return nil, errors.New("firmware cannot be nil")
+	}
+	if err := protocol.ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if policy.MaxParallel < 0 || policy.Retries < 0 || policy.RetryDelay < 0 || policy.MaxFailures < 0 {
+		return nil, errors.New("invalid policy: negative limit")
+	}
+	if policy.MaxParallel == 0 {
+		policy.MaxParallel = 1
+	}
+	seen := make(map[string]bool, len(devices))
+	for i, d := range devices {
+		if d.Open == nil {
+			return nil, fmt.Errorf("device %d (%q) has no Open function", i, d.ID)
+		}
+		if seen[d.ID] {
+			return nil, fmt.Errorf("duplicate device ID %q", d.ID)
+		}
+		seen[d.ID] = true
+	}
+
+	r := &runner{fw: fw, key: key, policy: policy, report: &Report{Results: make([]Result, len(devices))}}
+	for i, d := range devices {
+		r.report.Results[i] = Result{ID: d.ID, Status: NotStarted}
+	}
+
+	start := time.Now()
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < min(policy.MaxParallel, len(devices)); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// The rollout may have stopped while i was handed over
+				if r.halted() || ctx.Err() != nil {
+					continue
+				}
+				r.finish(i, r.update(ctx, devices[i]))
+			}
+		}()
+	}
+feed:
+	for i := range devices {
+		if r.halted() {
+			break
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	r.report.Duration = time.Since(start)
+	r.report.Summary = summarize(r.report.Results)
+	return r.report, nil
+}
+
+// runner holds the state shared by the workers of one rollout.
+type runner struct {
+	fw     *cyacd.Firmware
+	key    []byte
+	policy Policy
+
+	mu       sync.Mutex
+	report   *Report
+	failures int
+}
+
+// halted reports whether the rollout reached Policy.MaxFailures.
+func (r *runner) halted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report.Halted
+}
+
+// finish records the result of device i and calls OnResult.
+func (r *runner) finish(i int, res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Results[i] = res
+	if res.Status == Failed {
+		r.failures++
+		if r.policy.MaxFailures > 0 && r.failures >= r.policy.MaxFailures {
+			r.report.Halted = true
+		}
+	}
+	if r.policy.OnResult != nil {
+		r.policy.OnResult(res)
+	}
+}
+
+// update updates one device, retrying failed attempts as the policy allows.
+func (r *runner) update(ctx context.Context, d Device) Result {
+	res := Result{ID: d.ID}
+	start := time.Now()
+	for {
+		res.Attempts++
+		res.Status, res.Report, res.Err = r.attempt(ctx, d)
+		if res.Err == nil || res.Attempts > r.policy.Retries || ctx.Err() != nil || !bootloader.IsRetryable(res.Err) {
+			break
+		}
+		if err := sleep(ctx, r.policy.RetryDelay); err != nil {
+			break
+		}
+	}
+	res.Duration = time.Since(start)
+	return res
+}
+
+// attempt opens the transport of d and programs it once.
+func (r *runner) attempt(ctx context.Context, d Device) (Status, *bootloader.ProgramReport, error) {
+	device, err := d.Open(ctx)
+	if err != nil {
+		// A transport that cannot be opened yet, e.g. while the device
+		// enumerates, is worth retrying
+		return Failed, nil, &bootloader.IOError{Op: "open transport", Err: err}
+	}
+	if c, ok := device.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	opts := append([]bootloader.Option{bootloader.WithDeviceID(d.ID)}, r.policy.ProgrammerOptions...)
+	prog, err := bootloader.NewProgrammer(device, opts...)
+	if err != nil {
+		return Failed, nil, err
+	}
+
+	if r.policy.VersionGate {
+		updated, err := prog.UpdateIfNewer(ctx, r.fw, r.key)
+		switch {
+		case err != nil:
+			return Failed, nil, err
+		case !updated:
+			return UpToDate, nil, nil
+		}
+		return Updated, nil, nil
+	}
+
+	report, err := prog.ProgramWithReport(ctx, r.fw, r.key)
+	if err != nil {
+		return Failed, report, err
+	}
+	return Updated, report, nil
+}
+
+// summarize counts the outcomes of results.
+func summarize(results []Result) Summary {
+	s := Summary{Devices: len(results)}
+	for _, res := range results {
+		switch res.Status {
+		case Updated:
+			s.Updated++
+		case UpToDate:
+			s.UpToDate++
+		case Failed:
+			s.Failed++
+		case NotStarted:
+			s.NotStarted++
+		}
+		s.Retries += max(0, res.Attempts-1)
+	}
+	return s
+}
+
+// sleep pauses for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,263 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+var testKey = []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+// versionedFirmware returns an image whose metadata row carries app ID 0x0102
+// and the given app version
+func versionedFirmware(version uint16) *cyacd.Firmware {
+	data := make([]byte, protocol.MetadataSize)
+	data[20], data[21] = 0x02, 0x01
+	data[22], data[23] = byte(version), byte(version>>8)
+	return &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows: []*cyacd.Row{
+			{ArrayID: 0, RowNum: 0x01FF, Size: uint16(len(data)), Data: data, Checksum: protocol.CalculateRowChecksum(data)},
+		},
+	}
+}
+
+// inventory returns n simulated devices named dev0, dev1, ...
+func inventory(n int) ([]Device, []*bootloadertest.Device) {
+	devices := make([]Device, n)
+	sims := make([]*bootloadertest.Device, n)
+	for i := range devices {
+		sim := bootloadertest.NewDevice()
+		sims[i] = sim
+		devices[i] = Device{
+			ID:   "dev" + string(rune('0'+i)),
+			Open: func(ctx context.Context) (io.ReadWriter, error) { return sim, nil },
+		}
+	}
+	return devices, sims
+}
+
+func TestRun(t *testing.T) {
+	devices, sims := inventory(5)
+	var mu sync.Mutex
+	var open, peak int
+	var seen []string
+	for i := range devices {
+		sim := sims[i]
+		devices[i].Open = func(ctx context.Context) (io.ReadWriter, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			open++
+			peak = max(peak, open)
+			return &closingDevice{ReadWriter: sim, close: func() {
+				mu.Lock()
+				open--
+				mu.Unlock()
+			}}, nil
+		}
+	}
+
+	report, err := Run(context.Background(), devices, versionedFirmware(0x0100), testKey, Policy{
+		MaxParallel: 2,
+		OnResult: func(res Result) {
+			mu.Lock()
+			seen = append(seen, res.ID)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !report.Succeeded() || report.Summary.Updated != 5 {
+		t.Errorf("Summary = %+v, want 5 updated", report.Summary)
+	}
+	for i, res := range report.Results {
+		if res.ID != devices[i].ID || res.Status != Updated || res.Attempts != 1 || res.Report == nil {
+			t.Errorf("Results[%d] = %+v", i, res)
+		}
+		if _, ok := sims[i].Row(0, 0x01FF); !ok {
+			t.Errorf("%s: row not programmed", res.ID)
+		}
+	}
+	if peak > 2 || open != 0 {
+		t.Errorf("%d devices updated at once (want at most 2), %d left open", peak, open)
+	}
+	if len(seen) != 5 {
+		t.Errorf("OnResult called %d times, want 5", len(seen))
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "5 devices: 5 updated, 0 up to date, 0 failed, 0 not started") {
+		t.Errorf("WriteText() =\n%s", text.String())
+	}
+}
+
+// closingDevice is a transport that reports being closed.
+type closingDevice struct {
+	io.ReadWriter
+	close func()
+}
+
+func (d *closingDevice) Close() error {
+	d.close()
+	return nil
+}
+
+func TestRunRetries(t *testing.T) {
+	devices, _ := inventory(2)
+	attempts := 0
+	flaky := devices[0].Open
+	devices[0].Open = func(ctx context.Context) (io.ReadWriter, error) {
+		if attempts++; attempts < 3 {
+			return nil, errors.New("port busy")
+		}
+		return flaky(ctx)
+	}
+	devices[1].Open = func(ctx context.Context) (io.ReadWriter, error) {
+		return nil, errors.New("no such port")
+	}
+
+	report, err := Run(context.Background(), devices, versionedFirmware(0x0100), testKey, Policy{Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := report.Results[0]; res.Status != Updated || res.Attempts != 3 {
+		t.Errorf("flaky device = %+v, want updated after 3 attempts", res)
+	}
+	if res := report.Results[1]; res.Status != Failed || res.Attempts != 3 || res.Err == nil {
+		t.Errorf("missing device = %+v, want failed after 3 attempts", res)
+	}
+	if s := report.Summary; s.Retries != 4 || s.Failed != 1 || report.Succeeded() {
+		t.Errorf("Summary = %+v", s)
+	}
+
+	// A device with the wrong silicon ID is not retried
+	devices, _ = inventory(1)
+	fw := versionedFirmware(0x0100)
+	fw.SiliconID = 0x12345678
+	report, _ = Run(context.Background(), devices, fw, testKey, Policy{Retries: 2})
+	if res := report.Results[0]; res.Status != Failed || res.Attempts != 1 || !errors.Is(res.Err, bootloader.ErrDeviceMismatch) {
+		t.Errorf("mismatched device = %+v, want one failed attempt", res)
+	}
+}
+
+func TestRunNotRetriedAfterRefusal(t *testing.T) {
+	devices, _ := inventory(1)
+	asked := 0
+	report, err := Run(context.Background(), devices, versionedFirmware(0x0100), testKey, Policy{
+		Retries: 3,
+		ProgrammerOptions: []bootloader.Option{bootloader.WithConfirm(func(bootloader.Description) error {
+			asked++
+			return errors.New("operator said no")
+		})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := report.Results[0]; res.Status != Failed || res.Attempts != 1 || !errors.Is(res.Err, bootloader.ErrNotConfirmed) {
+		t.Errorf("refused device = %+v, want one failed attempt", res)
+	}
+	if asked != 1 {
+		t.Errorf("confirmation asked %d times, want 1", asked)
+	}
+}
+
+func TestRunVersionGate(t *testing.T) {
+	devices, sims := inventory(3)
+	for _, v := range []struct {
+		sim     *bootloadertest.Device
+		version uint16
+	}{{sims[0], 0x0100}, {sims[1], 0x0200}} {
+		if err := bootloader.New(v.sim).Program(context.Background(), versionedFirmware(v.version), testKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Run(context.Background(), devices, versionedFirmware(0x0200), testKey, Policy{VersionGate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Status{Updated, UpToDate, Updated}
+	for i, res := range report.Results {
+		if res.Status != want[i] {
+			t.Errorf("%s: status %s, want %s (err %v)", res.ID, res.Status, want[i], res.Err)
+		}
+	}
+	if s := report.Summary; s.Updated != 2 || s.UpToDate != 1 || !report.Succeeded() {
+		t.Errorf("Summary = %+v", s)
+	}
+}
+
+func TestRunMaxFailures(t *testing.T) {
+	devices, _ := inventory(4)
+	for i := range devices[:2] {
+		devices[i].Open = func(ctx context.Context) (io.ReadWriter, error) {
+			return nil, errors.New("no such port")
+		}
+	}
+
+	report, err := Run(context.Background(), devices, versionedFirmware(0x0100), testKey, Policy{MaxFailures: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Halted {
+		t.Error("rollout not halted")
+	}
+	if s := report.Summary; s.Failed != 2 || s.NotStarted != 2 || s.Updated != 0 {
+		t.Errorf("Summary = %+v, want 2 failed and 2 not started", s)
+	}
+	for _, res := range report.Results[2:] {
+		if res.Status != NotStarted || res.Attempts != 0 {
+			t.Errorf("%s = %+v, want not started", res.ID, res)
+		}
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	devices, _ := inventory(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := Run(ctx, devices, versionedFirmware(0x0100), testKey, Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary.NotStarted != 3 {
+		t.Errorf("Summary = %+v, want 3 not started", report.Summary)
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	devices, _ := inventory(2)
+	fw := versionedFirmware(0x0100)
+	dup := []Device{devices[0], devices[0]}
+	tests := []struct {
+		name    string
+		devices []Device
+		fw      *cyacd.Firmware
+		key     []byte
+		policy  Policy
+	}{
+		{"nil firmware", devices, nil, testKey, Policy{}},
+		{"short key", devices, fw, []byte{1, 2}, Policy{}},
+		{"negative parallelism", devices, fw, testKey, Policy{MaxParallel: -1}},
+		{"duplicate ID", dup, fw, testKey, Policy{}},
+		{"no Open", []Device{{ID: "x"}}, fw, testKey, Policy{}},
+	}
+	for _, tt := range tests {
+		if _, err := Run(context.Background(), tt.devices, tt.fw, tt.key, tt.policy); err == nil {
+			t.Errorf("%s: Run() succeeded", tt.name)
+		}
+	}
+}
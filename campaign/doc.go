@@ -0,0 +1,35 @@
+// Package campaign rolls a firmware image out to a fleet of devices: it
+// programs every device of an inventory, a few at a time, retries devices
+// that fail with transient errors, optionally skips devices that already run
+// the image's version, and stops starting new devices once too many have
+// failed. The outcome is a result per device and a summary of the rollout.
+//
+// Where bootloader.Programmer updates one device, a campaign decides which
+// devices to update, in what order, and when to give up.
+//
+// Example:
+//
+//	devices := []campaign.Device{
+//	    {ID: "line1", Open: openSerial("/dev/ttyUSB0")},
+//	    {ID: "line2", Open: openSerial("/dev/ttyUSB1")},
+//	    {ID: "line3", Open: openSerial("/dev/ttyUSB2")},
+//	}
+//	report, err := campaign.Run(ctx, devices, fw, key, campaign.Policy{
+//	    MaxParallel: 2,
+//	    Retries:     2,
+//	    RetryDelay:  5 * time.Second,
+//	    VersionGate: true,
+//	    MaxFailures: 1,
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	report.WriteText(os.Stdout)
+//
+// prints
+//
+//	line1  updated      1 attempt      4.21s
+//	line2  up to date   1 attempt      350ms
+//	line3  updated      2 attempts     9.87s
+//	3 devices: 2 updated, 1 up to date, 0 failed, 0 not started
+package campaign
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/progressui"
+)
+
+// session is an open device with a Programmer for it.
+type session struct {
+	prog   *bootloader.Programmer
+	device io.Closer
+}
+
+// open opens the device selected by the common flags and creates a Programmer
+// for it with the common options followed by extra.
+func open(ctx context.Context, e *env, c *commonFlags, extra ...bootloader.Option) (*session, error) {
+	tlsConf, err := c.tls.config()
+	if err != nil {
+		return nil, err
+	}
+	device, err := openDevice(ctx, c.device, tlsConf)
+	if err != nil {
+		return nil, fmt.Errorf("open device: %w", err)
+	}
+
+	prog, err := bootloader.NewProgrammer(device, append(c.options(e.stderr), extra...)...)
+	if err != nil {
+		device.Close()
+		return nil, err
+	}
+	return &session{prog: prog, device: device}, nil
+}
+
+// close closes the device.
+func (s *session) close() {
+	s.device.Close()
+}
+
+// fail prints err, emits it with -json, and returns the failure exit code.
+func fail(e *env, err error) int {
+	printError(e.stderr, err)
+	if e.events != nil {
+		e.events.failure(err, exitFailure)
+	}
+	return exitFailure
+}
+
+func runFlash(ctx context.Context, e *env, args []string) int {
+	var (
+		common      commonFlags
+		noVerify    bool
+		verifyEvery int
+		skipExit    bool
+		rollback    bool
+		skipBoot    bool
+		reportPath  string
+		hostLogPath string
+		capturePath string
+		deviceID    string
+		quiet       bool
+		watch       bool
+		interval    time.Duration
+		debounce    time.Duration
+	)
+	fs := newFlagSet(e, "flash", "<firmware.cyacd|firmware.cyacd2>", &common)
+	fs.BoolVar(&noVerify, "no-verify", false, "do not read back each row after programming it")
+	fs.IntVar(&verifyEvery, "verify-every", 0, "read back only every nth row")
+	fs.BoolVar(&skipExit, "skip-exit", false, "leave the device in the bootloader")
+	fs.BoolVar(&rollback, "rollback", false, "restore the previous application if programming fails (dual-application bootloaders)")
+	fs.BoolVar(&skipBoot, "skip-bootloader-rows", false, "drop rows below the first programmable row (images combined with the bootloader)")
+	fs.StringVar(&reportPath, "report", "", "write a JSON report of the session to this file")
+	fs.StringVar(&hostLogPath, "host-log", "", "append a log in the format of Cypress's Bootloader Host to this file")
+	fs.StringVar(&capturePath, "capture", "", "record every frame in a pcapng capture at this path (for Wireshark)")
+	fs.StringVar(&deviceID, "device-id", "", "device label recorded in the report (e.g. a serial number)")
+	fs.BoolVar(&quiet, "q", false, "do not show progress")
+	fs.BoolVar(&watch, "watch", false, "keep running and reflash the device every time the firmware file changes")
+	fs.DurationVar(&interval, "watch-interval", 250*time.Millisecond, "how often -watch checks the firmware file")
+	fs.DurationVar(&debounce, "debounce", time.Second, "how long the firmware file must stay unchanged before -watch flashes it")
+	if !parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	path := fs.Arg(0)
+
+	opts := []bootloader.Option{
+		bootloader.WithVerifyAfterProgram(!noVerify),
+		bootloader.WithVerifyEvery(verifyEvery),
+		bootloader.WithDeviceID(deviceID),
+	}
+	bar := progressui.New(e.stderr)
+	switch {
+	case quiet:
+	case e.events != nil:
+		opts = append(opts, bootloader.WithProgressCallback(e.events.progress))
+	default:
+		opts = append(opts, bootloader.WithProgressCallback(bar.Update))
+	}
+	if skipExit {
+		opts = append(opts, bootloader.WithSkipExit())
+	}
+	if rollback {
+		opts = append(opts, bootloader.WithRollback())
+	}
+	if skipBoot {
+		opts = append(opts, bootloader.WithSkipBootloaderRows())
+	}
+	if hostLogPath != "" {
+		f, err := os.OpenFile(hostLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return fail(e, fmt.Errorf("open host log: %w", err))
+		}
+		defer f.Close()
+		opts = append(opts, bootloader.WithHostLog(f))
+	}
+	if capturePath != "" {
+		f, err := os.Create(capturePath)
+		if err != nil {
+			return fail(e, fmt.Errorf("create capture: %w", err))
+		}
+		defer f.Close()
+		capture, err := pcapng.NewWriter(f, pcapng.LinkTypeUser0)
+		if err != nil {
+			return fail(e, fmt.Errorf("create capture: %w", err))
+		}
+		opts = append(opts, bootloader.WithCapture(capture))
+	}
+
+	flash := func(ctx context.Context) int {
+		ctx, cancel := context.WithTimeout(ctx, common.timeout)
+		defer cancel()
+		if strings.EqualFold(filepath.Ext(path), ".cyacd2") {
+			return flashV2(ctx, e, &common, path, bar, opts)
+		}
+		return flashV1(ctx, e, &common, path, bar, opts, reportPath)
+	}
+	if watch {
+		return watchFile(ctx, e, path, interval, debounce, flash)
+	}
+	return flash(ctx)
+}
+
+// flashV1 programs a .cyacd file.
+func flashV1(ctx context.Context, e *env, common *commonFlags, path string, bar *progressui.Bar, opts []bootloader.Option, reportPath string) int {
+
+	key, err := parseKey(common.key)
+	if err != nil {
+		return fail(e, err)
+	}
+	fw, err := cyacd.Parse(path)
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", path, err))
+	}
+
+	s, err := open(ctx, e, common, opts...)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	report, err := s.prog.ProgramWithReport(ctx, fw, key)
+	bar.Finish()
+
+	if reportPath != "" && report != nil {
+		if werr := writeReport(reportPath, report); werr != nil {
+			fmt.Fprintf(e.stderr, "warning: write report: %v\n", werr)
+		}
+	}
+	if e.events != nil && report != nil {
+		e.events.report(report)
+	}
+	if err != nil {
+		if report != nil && report.RollbackPerformed {
+			fmt.Fprintf(e.stderr, "rolled back to application %d\n", report.RollbackApp)
+		}
+		return fail(e, err)
+	}
+
+	if e.events != nil {
+		return exitOK
+	}
+	fmt.Fprintf(e.stdout, "programmed %d rows (%d bytes) in %s\n",
+		report.RowsProgrammed, report.BytesWritten, report.Duration.Round(time.Millisecond))
+	return exitOK
+}
+
+// flashV2 programs a .cyacd2 file, which carries its own product ID instead of
+// needing a key.
+func flashV2(ctx context.Context, e *env, common *commonFlags, path string, bar *progressui.Bar, opts []bootloader.Option) int {
+	fw, err := cyacd.Parse2(path)
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", path, err))
+	}
+
+	s, err := open(ctx, e, common, opts...)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	start := time.Now()
+	err = s.prog.ProgramV2(ctx, fw)
+	bar.Finish()
+	if err != nil {
+		return fail(e, err)
+	}
+
+	elapsed := time.Since(start)
+	if e.events != nil {
+		e.events.emit(flashResult{resultHeader: result("flash", true), Rows: len(fw.Rows), DurationMs: elapsed.Milliseconds()})
+		return exitOK
+	}
+	fmt.Fprintf(e.stdout, "programmed %d rows in %s\n", len(fw.Rows), elapsed.Round(time.Millisecond))
+	return exitOK
+}
+
+// writeReport writes report as JSON to the file at path.
+func writeReport(path string, report *bootloader.ProgramReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runVerify(ctx context.Context, e *env, args []string) int {
+	var common commonFlags
+	fs := newFlagSet(e, "verify", "<firmware.cyacd>", &common)
+	if !parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+
+	key, err := parseKey(common.key)
+	if err != nil {
+		return fail(e, err)
+	}
+	fw, err := cyacd.Parse(fs.Arg(0))
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", fs.Arg(0), err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, common.timeout)
+	defer cancel()
+
+	s, err := open(ctx, e, &common)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	if _, err := s.prog.Connect(ctx, key); err != nil {
+		return fail(e, err)
+	}
+	defer s.prog.Close(context.WithoutCancel(ctx))
+
+	mismatches, err := compareDevice(ctx, e, s.prog, fw)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	_, appErr := s.prog.VerifyChecksum(ctx)
+	if e.events != nil {
+		ok := mismatches == 0 && appErr == nil
+		e.events.emit(verifyResult{resultHeader: result("verify", ok), Rows: len(fw.Rows),
+			Mismatches: mismatches, ApplicationValid: appErr == nil})
+		if !ok {
+			return exitFailure
+		}
+		return exitOK
+	}
+	if mismatches > 0 {
+		fmt.Fprintf(e.stdout, "%d of %d rows differ\n", mismatches, len(fw.Rows))
+		return exitFailure
+	}
+	if appErr != nil {
+		return fail(e, appErr)
+	}
+
+	fmt.Fprintf(e.stdout, "all %d rows match, application checksum valid\n", len(fw.Rows))
+	return exitOK
+}
+
+// compareDevice compares the checksums of the rows of fw in the flash of a
+// connected device with the file and reports every mismatch as a row event
+// or line. It returns the number of mismatching rows.
+func compareDevice(ctx context.Context, e *env, prog *bootloader.Programmer, fw *cyacd.Firmware) (int, error) {
+	result, err := prog.Compare(ctx, fw, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range result.Mismatching {
+		expected := fmt.Sprintf("0x%02X", row.Expected)
+		switch {
+		case e.events != nil && row.Err != nil:
+			// The bootloader refused to checksum the row, e.g. it was never programmed
+			e.events.emit(rowEvent{eventHeader: header("row"), ArrayID: row.ArrayID, Row: row.RowNum,
+				Expected: expected, Error: row.Err.Error()})
+		case e.events != nil:
+			e.events.emit(rowEvent{eventHeader: header("row"), ArrayID: row.ArrayID, Row: row.RowNum,
+				DeviceChecksum: fmt.Sprintf("0x%02X", row.Actual), Expected: expected})
+		case row.Err != nil:
+			fmt.Fprintf(e.stdout, "row %d (array %d): %v\n", row.RowNum, row.ArrayID, row.Err)
+		default:
+			fmt.Fprintf(e.stdout, "row %d (array %d): device checksum 0x%02X, expected %s\n",
+				row.RowNum, row.ArrayID, row.Actual, expected)
+		}
+	}
+	return len(result.Mismatching), nil
+}
+
+func runErase(ctx context.Context, e *env, args []string) int {
+	var (
+		common commonFlags
+		array  int
+		rows   string
+	)
+	fs := newFlagSet(e, "erase", "", &common)
+	fs.IntVar(&array, "array", 0, "flash array")
+	fs.StringVar(&rows, "rows", "", "rows to erase, as FIRST-LAST or a single row (decimal or 0x hex)")
+	if !parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+
+	r, err := parseRowRange(byte(array), rows)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "cyacdflash erase: %v\n", err)
+		return exitUsage
+	}
+	key, err := parseKey(common.key)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, common.timeout)
+	defer cancel()
+
+	s, err := open(ctx, e, &common)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	if _, err := s.prog.RunPlan(ctx, bootloader.NewPlan().EraseRange(r), key); err != nil {
+		return fail(e, err)
+	}
+
+	if e.events != nil {
+		e.events.emit(eraseResult{resultHeader: result("erase", true), ArrayID: r.ArrayID, FirstRow: r.First, LastRow: r.Last})
+		return exitOK
+	}
+	fmt.Fprintf(e.stdout, "erased %d rows (%s)\n", int(r.Last)-int(r.First)+1, r)
+	return exitOK
+}
+
+// parseRowRange parses FIRST-LAST or a single row number in array.
+func parseRowRange(array byte, s string) (bootloader.RowRange, error) {
+	if s == "" {
+		return bootloader.RowRange{}, fmt.Errorf("no rows given (use -rows)")
+	}
+
+	first, last, found := strings.Cut(s, "-")
+	if !found {
+		last = first
+	}
+	f, err := strconv.ParseUint(strings.TrimSpace(first), 0, 16)
+	if err != nil {
+		return bootloader.RowRange{}, fmt.Errorf("invalid first row %q", first)
+	}
+	l, err := strconv.ParseUint(strings.TrimSpace(last), 0, 16)
+	if err != nil {
+		return bootloader.RowRange{}, fmt.Errorf("invalid last row %q", last)
+	}
+	if l < f {
+		return bootloader.RowRange{}, fmt.Errorf("last row %d is before first row %d", l, f)
+	}
+	return bootloader.RowRange{ArrayID: array, First: uint16(f), Last: uint16(l)}, nil
+}
+
+func runInfo(ctx context.Context, e *env, args []string) int {
+	var (
+		common commonFlags
+		array  int
+	)
+	fs := newFlagSet(e, "info", "", &common)
+	fs.IntVar(&array, "array", 0, "flash array whose row range is shown")
+	if !parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+
+	key, err := parseKey(common.key)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, common.timeout)
+	defer cancel()
+
+	s, err := open(ctx, e, &common)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	info, err := s.prog.Connect(ctx, key)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.prog.Close(context.WithoutCancel(ctx))
+
+	flash, err := s.prog.GetFlashSize(ctx, byte(array))
+	if err != nil {
+		return fail(e, err)
+	}
+
+	if e.events != nil {
+		e.events.emit(infoResult{
+			resultHeader:      result("info", true),
+			SiliconID:         fmt.Sprintf("0x%08X", info.SiliconID),
+			SiliconRev:        fmt.Sprintf("0x%02X", info.SiliconRev),
+			BootloaderVersion: fmt.Sprintf("%d.%d.%d", info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2]),
+			ArrayID:           byte(array),
+			StartRow:          flash.StartRow,
+			EndRow:            flash.EndRow,
+		})
+		return exitOK
+	}
+	fmt.Fprintf(e.stdout, "Silicon ID:         0x%08X\n", info.SiliconID)
+	fmt.Fprintf(e.stdout, "Silicon revision:   0x%02X\n", info.SiliconRev)
+	fmt.Fprintf(e.stdout, "Bootloader version: %d.%d.%d\n", info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2])
+	fmt.Fprintf(e.stdout, "Flash rows:         %d-%d (array %d)\n", flash.StartRow, flash.EndRow, array)
+	return exitOK
+}
+
+func runMetadata(ctx context.Context, e *env, args []string) int {
+	var (
+		common commonFlags
+		app    int
+	)
+	fs := newFlagSet(e, "metadata", "", &common)
+	fs.IntVar(&app, "app", 0, "application number (0 for single-application bootloaders)")
+	if !parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+
+	key, err := parseKey(common.key)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, common.timeout)
+	defer cancel()
+
+	s, err := open(ctx, e, &common)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	if _, err := s.prog.Connect(ctx, key); err != nil {
+		return fail(e, err)
+	}
+	defer s.prog.Close(context.WithoutCancel(ctx))
+
+	m, err := s.prog.GetMetadata(ctx, byte(app))
+	if err != nil {
+		return fail(e, err)
+	}
+
+	if e.events != nil {
+		e.events.emit(metadataResult{
+			resultHeader:      result("metadata", true),
+			Application:       byte(app),
+			AppID:             m.AppID,
+			AppVersion:        m.AppVersion,
+			CustomID:          m.CustomID,
+			Checksum:          fmt.Sprintf("0x%02X", m.Checksum),
+			StartAddr:         m.StartAddr,
+			Length:            m.Length,
+			LastRow:           m.LastRow,
+			Active:            m.Active != 0,
+			Verified:          m.Verified != 0,
+			BootloaderVersion: m.BootloaderVersion,
+		})
+		return exitOK
+	}
+	fmt.Fprintf(e.stdout, "Application:        %d\n", app)
+	fmt.Fprintf(e.stdout, "App ID:             0x%04X\n", m.AppID)
+	fmt.Fprintf(e.stdout, "App version:        0x%04X\n", m.AppVersion)
+	fmt.Fprintf(e.stdout, "Custom ID:          0x%08X\n", m.CustomID)
+	fmt.Fprintf(e.stdout, "Checksum:           0x%02X\n", m.Checksum)
+	fmt.Fprintf(e.stdout, "Start address:      0x%08X\n", m.StartAddr)
+	fmt.Fprintf(e.stdout, "Length:             %d bytes\n", m.Length)
+	fmt.Fprintf(e.stdout, "Last row:           %d\n", m.LastRow)
+	fmt.Fprintf(e.stdout, "Active:             %t\n", m.Active != 0)
+	fmt.Fprintf(e.stdout, "Verified:           %t\n", m.Verified != 0)
+	fmt.Fprintf(e.stdout, "Bootloader version: 0x%04X\n", m.BootloaderVersion)
+	return exitOK
+}
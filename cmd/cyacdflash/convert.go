@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// File formats known to convert, selected by extension or -from/-to.
+const (
+	formatHex    = "hex"
+	formatSREC   = "srec"
+	formatCyacd  = "cyacd"
+	formatCyacd2 = "cyacd2"
+	formatBin    = "bin"
+)
+
+// formatOf returns the format of path by its extension.
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hex", ".ihex", ".ihx":
+		return formatHex
+	case ".srec", ".s19", ".s28", ".s37", ".mot":
+		return formatSREC
+	case ".cyacd":
+		return formatCyacd
+	case ".cyacd2":
+		return formatCyacd2
+	case ".bin":
+		return formatBin
+	}
+	return ""
+}
+
+// layout maps .cyacd rows to flash addresses for the address-based formats.
+type layout struct {
+	base         uint32
+	rowSize      int
+	rowsPerArray int
+}
+
+// address returns the flash address of row.
+func (l layout) address(row *cyacd.Row) uint32 {
+	index := int(row.RowNum)
+	if l.rowsPerArray > 0 {
+		index += int(row.ArrayID) * l.rowsPerArray
+	}
+	return l.base + uint32(index*l.rowSize)
+}
+
+func runConvert(ctx context.Context, e *env, args []string) int {
+	var (
+		from, to     string
+		siliconID    uint64
+		siliconRev   uint64
+		checksum     string
+		rowSize      int
+		rowsPerArray int
+		flashBase    uint64
+		flashSize    uint64
+		fill         uint64
+		appID        uint64
+		productID    uint64
+	)
+	fs := newFlagSet(e, "convert", "<input> <output>", nil)
+	fs.StringVar(&from, "from", "", "input format: hex, srec, or cyacd (default from the extension)")
+	fs.StringVar(&to, "to", "", "output format: cyacd, cyacd2, or bin (default from the extension)")
+	uintFlag(fs, "silicon-id", 32, "silicon ID of the device (required for hex and srec input)", &siliconID)
+	uintFlag(fs, "silicon-rev", 8, "silicon revision of the device", &siliconRev)
+	fs.StringVar(&checksum, "checksum", "sum", "packet checksum type of the bootloader: sum or crc")
+	fs.IntVar(&rowSize, "row-size", 0, "flash row size in bytes (required for hex and srec input; default for cyacd input is the size of its first row)")
+	fs.IntVar(&rowsPerArray, "rows-per-array", 0, "rows per flash array (0 for a single array)")
+	uintFlag(fs, "flash-base", 32, "address of the first byte of flash", &flashBase)
+	uintFlag(fs, "flash-size", 32, "flash size in bytes; hex and srec data beyond it is dropped (0 keeps all data)", &flashSize)
+	uintFlag(fs, "fill", 8, "value of bytes not covered by the input", &fill)
+	uintFlag(fs, "app-id", 8, "application ID written to cyacd2 output", &appID)
+	uintFlag(fs, "product-id", 32, "product ID written to cyacd2 output", &productID)
+	if !parseFlags(fs, args, 2) {
+		return exitUsage
+	}
+	in, out := fs.Arg(0), fs.Arg(1)
+
+	if from == "" {
+		from = formatOf(in)
+	}
+	if to == "" {
+		to = formatOf(out)
+	}
+	var checksumType byte
+	switch checksum {
+	case "sum":
+		checksumType = protocol.ChecksumBasicSum
+	case "crc":
+		checksumType = protocol.ChecksumCRC16
+	default:
+		fmt.Fprintf(e.stderr, "cyacdflash convert: unknown checksum type %q (use sum or crc)\n", checksum)
+		return exitUsage
+	}
+
+	var fw *cyacd.Firmware
+	var err error
+	switch from {
+	case formatCyacd:
+		fw, err = cyacd.Parse(in)
+		if err == nil && rowSize == 0 {
+			rowSize = len(fw.Rows[0].Data)
+		}
+	case formatHex, formatSREC:
+		if siliconID == 0 || rowSize == 0 {
+			fmt.Fprintf(e.stderr, "cyacdflash convert: -silicon-id and -row-size are required for %s input\n", from)
+			return exitUsage
+		}
+		fw, err = importImage(in, from, cyacd.ImportOptions{
+			SiliconID:    uint32(siliconID),
+			SiliconRev:   byte(siliconRev),
+			ChecksumType: checksumType,
+			RowSize:      rowSize,
+			RowsPerArray: rowsPerArray,
+			FlashBase:    uint32(flashBase),
+			FlashSize:    uint32(flashSize),
+			Fill:         byte(fill),
+		})
+	default:
+		fmt.Fprintf(e.stderr, "cyacdflash convert: cannot convert from %q (use -from hex, srec, or cyacd)\n", in)
+		return exitUsage
+	}
+	if err != nil {
+		return fail(e, fmt.Errorf("read %s: %w", in, err))
+	}
+
+	l := layout{base: uint32(flashBase), rowSize: rowSize, rowsPerArray: rowsPerArray}
+	var write func(io.Writer) error
+	switch to {
+	case formatCyacd:
+		write = func(w io.Writer) error {
+			_, err := fw.WriteTo(w)
+			return err
+		}
+	case formatCyacd2:
+		write = func(w io.Writer) error {
+			fw2, err := fw.ToFirmware2(cyacd.Firmware2Options{RowSize: rowSize, RowsPerArray: rowsPerArray,
+				FlashBase: uint32(flashBase), AppID: byte(appID), ProductID: uint32(productID)})
+			if err != nil {
+				return err
+			}
+			_, err = fw2.WriteTo(w)
+			return err
+		}
+	case formatBin:
+		write = func(w io.Writer) error {
+			return writeBin(w, fw, l, byte(fill))
+		}
+	default:
+		fmt.Fprintf(e.stderr, "cyacdflash convert: cannot convert to %q (use -to cyacd, cyacd2, or bin)\n", out)
+		return exitUsage
+	}
+
+	if err := writeFile(out, write); err != nil {
+		return fail(e, fmt.Errorf("write %s: %w", out, err))
+	}
+
+	if e.events != nil {
+		e.events.emit(convertResult{resultHeader: result("convert", true), Input: in, Output: out, Format: to, Rows: len(fw.Rows)})
+		return exitOK
+	}
+	fmt.Fprintf(e.stdout, "converted %d rows from %s to %s\n", len(fw.Rows), from, to)
+	return exitOK
+}
+
+// importImage reads a hex or srec memory image.
+func importImage(path, format string, opts cyacd.ImportOptions) (*cyacd.Firmware, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == formatSREC {
+		return cyacd.ImportSREC(f, opts)
+	}
+	return cyacd.ImportIntelHex(f, opts)
+}
+
+// writeFile creates the file at path and writes it with write, removing it
+// again if write fails.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err = write(w); err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// writeBin writes fw as a flat binary from its lowest to its highest
+// address, with gaps between rows set to fill.
+func writeBin(w io.Writer, fw *cyacd.Firmware, l layout, fill byte) error {
+	start, end := span(fw, l)
+	image := make([]byte, end-start)
+	for i := range image {
+		image[i] = fill
+	}
+	for _, row := range fw.Rows {
+		copy(image[l.address(row)-start:], row.Data)
+	}
+	_, err := w.Write(image)
+	return err
+}
+
+// span returns the address range covered by the rows of fw.
+func span(fw *cyacd.Firmware, l layout) (start, end uint32) {
+	start = ^uint32(0)
+	for _, row := range fw.Rows {
+		addr := l.address(row)
+		start = min(start, addr)
+		end = max(end, addr+uint32(len(row.Data)))
+	}
+	return start, end
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// cyflashTimeout bounds a whole cyflash run, which has no flag for it.
+const cyflashTimeout = 10 * time.Minute
+
+// runCyflash accepts the command line of the Python cyflash tool, so that
+// scripts written for it can run cyacdflash instead:
+//
+//	cyflash --serial /dev/ttyACM0 --serial_baudrate 115200 --key 0x0A1B2C3D4E5F app.cyacd
+//
+// It is also run when the executable is invoked as cyflash, e.g. through a
+// symlink. The output follows cyflash's messages.
+func runCyflash(ctx context.Context, e *env, args []string) int {
+	var (
+		serial    string
+		baud      int
+		timeout   float64
+		key       string
+		downgrade = true
+		newApp    = true
+		verbose   bool
+		canbus    string
+	)
+	fs := flag.NewFlagSet("cyflash", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: cyacdflash cyflash [flags] <image.cyacd>\n\n"+
+			"Flags of the Python cyflash tool. Flags may start with - or --.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&serial, "serial", "", "serial port to program through; also accepts tcp://host:port and mock[:preset]")
+	fs.IntVar(&baud, "serial_baudrate", 115200, "serial port baud rate")
+	fs.IntVar(&baud, "baud", 115200, "alias of -serial_baudrate")
+	fs.Float64Var(&timeout, "timeout", 1.0, "seconds to wait for each response")
+	fs.StringVar(&key, "key", "", "bootloader key, 12 hex digits (e.g. 0x0A1B2C3D4E5F); none if omitted")
+	fs.BoolVar(&downgrade, "downgrade", true, "allow installing an older version of the application")
+	fs.BoolFunc("nodowngrade", "refuse to install an older version of the application", func(string) error {
+		downgrade = false
+		return nil
+	})
+	fs.BoolVar(&newApp, "newapp", true, "allow replacing the application with one of a different application ID")
+	fs.BoolFunc("nonewapp", "refuse to replace the application with one of a different application ID", func(string) error {
+		newApp = false
+		return nil
+	})
+	fs.BoolVar(&verbose, "v", false, "log bootloader operations to stderr")
+	fs.BoolVar(&verbose, "verbose", false, "alias of -v")
+	fs.Bool("psoc5", false, "accepted for compatibility: the checksum type is read from the image")
+	fs.StringVar(&canbus, "canbus", "", "not supported: CAN bus interfaces cannot be used")
+	if !parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	path := fs.Arg(0)
+
+	if canbus != "" {
+		fmt.Fprintln(e.stderr, "cyacdflash cyflash: CAN bus is not supported, use --serial")
+		return exitUsage
+	}
+	if serial == "" {
+		fmt.Fprintln(e.stderr, "cyacdflash cyflash: no serial port given (use --serial)")
+		return exitUsage
+	}
+	if timeout <= 0 {
+		fmt.Fprintln(e.stderr, "cyacdflash cyflash: --timeout must be positive")
+		return exitUsage
+	}
+
+	// Like cyflash, no --key enters the bootloader without a key
+	k := protocol.NoKey
+	if key != "" {
+		var err error
+		if k, err = parseKey(key); err != nil {
+			return fail(e, err)
+		}
+	}
+	fw, err := cyacd.Parse(path)
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", path, err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cyflashTimeout)
+	defer cancel()
+
+	if isDevicePath(serial) {
+		if err := configureSerial(ctx, serial, baud); err != nil {
+			return fail(e, fmt.Errorf("configure %s: %w", serial, err))
+		}
+	}
+
+	// cyflash always installs the image; the checks only refuse it
+	var refusal string
+	check := func(installed, image *protocol.Metadata) bool {
+		fmt.Fprintf(e.stdout, "Device application_id %d, version %d.\n", installed.AppID, installed.AppVersion)
+		switch {
+		case !newApp && image.AppID != installed.AppID:
+			refusal = fmt.Sprintf("device application ID is %d, image is %d (use --newapp to replace it)",
+				installed.AppID, image.AppID)
+		case !downgrade && image.AppID == installed.AppID && image.AppVersion < installed.AppVersion:
+			refusal = fmt.Sprintf("device has version %d, image is older version %d (use --downgrade to install it)",
+				installed.AppVersion, image.AppVersion)
+		}
+		return refusal == ""
+	}
+
+	common := commonFlags{
+		device:      serial,
+		readTimeout: time.Duration(timeout * float64(time.Second)),
+		retries:     bootloader.DefaultRetries,
+		chunkSize:   bootloader.DefaultChunkSize,
+		reportID:    -1,
+		verbose:     verbose,
+	}
+	uploaded := false
+	s, err := open(ctx, e, &common,
+		bootloader.WithVersionCompare(check),
+		bootloader.WithProgressCallback(func(p bootloader.Progress) {
+			if p.Phase == bootloader.PhaseProgramming {
+				fmt.Fprintf(e.stdout, "\rUploading data (%d/%d)", p.CurrentRow, p.TotalRows)
+				uploaded = true
+			}
+		}))
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	fmt.Fprintln(e.stdout, "Initialising bootloader.")
+	info, err := s.prog.Connect(ctx, k)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.prog.Close(context.WithoutCancel(ctx))
+	fmt.Fprintf(e.stdout, "Silicon ID 0x%08x, revision %d.\n", info.SiliconID, info.SiliconRev)
+
+	if !downgrade || !newApp {
+		var installed bool
+		installed, err = s.prog.UpdateIfNewer(ctx, fw, nil)
+		if err == nil && !installed {
+			err = errors.New(refusal)
+		}
+	} else {
+		err = s.prog.Program(ctx, fw, nil)
+	}
+	if uploaded {
+		fmt.Fprintln(e.stdout)
+	}
+	if err != nil {
+		return fail(e, err)
+	}
+
+	if _, err := s.prog.VerifyChecksum(ctx); err != nil {
+		return fail(e, err)
+	}
+	fmt.Fprintln(e.stdout, "Device checksum verifies OK.")
+
+	fmt.Fprintln(e.stdout, "Rebooting device.")
+	if err := s.prog.Close(ctx); err != nil {
+		return fail(e, err)
+	}
+	return exitOK
+}
+
+// isDevicePath reports whether a device spec names a device node rather than
+// a TCP bridge or a simulated bootloader.
+func isDevicePath(spec string) bool {
+	return !strings.HasPrefix(spec, "tcp://") && !strings.HasPrefix(spec, "tls://") &&
+		spec != "mock" && !strings.HasPrefix(spec, "mock:")
+}
+
+// configureSerial sets a serial port to raw 8N1 mode at baud with the
+// system's stty (mode on Windows), as cyflash does through pyserial.
+func configureSerial(ctx context.Context, path string, baud int) error {
+	rate := strconv.Itoa(baud)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.CommandContext(ctx, "mode", path, "BAUD="+rate, "PARITY=n", "DATA=8", "STOP=1")
+	case "linux":
+		cmd = exec.CommandContext(ctx, "stty", "-F", path, rate, "raw", "-echo", "cs8", "-cstopb", "-parenb", "clocal")
+	default:
+		cmd = exec.CommandContext(ctx, "stty", "-f", path, rate, "raw", "-echo", "cs8", "-cstopb", "-parenb", "clocal")
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w", msg, err)
+		}
+		return err
+	}
+	return nil
+}
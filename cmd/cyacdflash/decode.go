@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func runDecode(ctx context.Context, e *env, args []string) int {
+	var checksum string
+	fs := newFlagSet(e, "decode", "<capture.txt|->", nil)
+	fs.StringVar(&checksum, "checksum", "sum", "packet checksum type of the bootloader: sum or crc")
+	if !parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+
+	d := &decoder{e: e}
+	switch checksum {
+	case "sum":
+		d.checksumType = protocol.ChecksumBasicSum
+	case "crc":
+		d.checksumType = protocol.ChecksumCRC16
+	default:
+		fmt.Fprintf(e.stderr, "cyacdflash decode: unknown checksum type %q (use sum or crc)\n", checksum)
+		return exitUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fail(e, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		d.feed(extractHex(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return fail(e, err)
+	}
+	d.skip(len(d.buf))
+
+	if e.events != nil {
+		e.events.emit(decodeResult{resultHeader: result("decode", d.frames > 0),
+			Frames: d.frames, BadChecksums: d.bad, SkippedBytes: d.skipped})
+	} else {
+		fmt.Fprintf(e.stdout, "%d frames, %d with bad checksums, %d bytes skipped\n", d.frames, d.bad, d.skipped)
+	}
+	if d.frames == 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// extractHex returns the bytes of the hex run on a line of a capture. It
+// understands the frame logs of -frames (the bytes= field), xxd and
+// hexdump -C output (a leading offset and a trailing text column), and
+// plain hex with or without separators and 0x prefixes. Words before the
+// hex run, such as timestamps or TX/RX markers, are skipped.
+func extractHex(line string) []byte {
+	if i := strings.Index(line, "bytes="); i >= 0 {
+		line = line[i+len("bytes="):]
+	}
+
+	tokens := strings.Fields(strings.NewReplacer(",", " ", "|", " | ").Replace(line))
+	var out []byte
+	started := false
+	for i, tok := range tokens {
+		tok = strings.TrimPrefix(strings.TrimPrefix(tok, "0x"), "0X")
+		b, err := hex.DecodeString(tok)
+		if err != nil {
+			if started {
+				break
+			}
+			continue
+		}
+		// A long first number followed by more hex is the offset column of a dump
+		if !started && len(tok) >= 6 && len(tok) <= 8 && i+1 < len(tokens) {
+			if _, err := hex.DecodeString(tokens[i+1]); err == nil {
+				started = true
+				continue
+			}
+		}
+		started = true
+		out = append(out, b...)
+	}
+	return out
+}
+
+// decoder splits a byte stream into frames and prints them.
+type decoder struct {
+	e            *env
+	checksumType byte
+	buf          []byte
+
+	// command is the code of the last command frame, which the next
+	// response answers
+	command byte
+
+	frames  int
+	bad     int
+	skipped int
+}
+
+// feed appends data to the stream and prints every complete frame.
+func (d *decoder) feed(data []byte) {
+	d.buf = append(d.buf, data...)
+	for len(d.buf) > 0 {
+		i := bytes.IndexByte(d.buf, protocol.StartOfPacket)
+		if i < 0 {
+			d.skip(len(d.buf))
+			return
+		}
+		d.skip(i)
+
+		if len(d.buf) < 4 {
+			return
+		}
+		n := protocol.MinFrameSize + int(binary.LittleEndian.Uint16(d.buf[2:4]))
+		if n > protocol.MinFrameSize+protocol.MaxDataSize {
+			d.skip(1)
+			continue
+		}
+		if len(d.buf) < n {
+			return
+		}
+		if d.buf[n-1] != protocol.EndOfPacket {
+			d.skip(1)
+			continue
+		}
+
+		d.frame(d.buf[:n])
+		d.buf = d.buf[n:]
+	}
+}
+
+// skip drops n bytes that are not part of a frame.
+func (d *decoder) skip(n int) {
+	if n == 0 {
+		return
+	}
+	if d.e.events == nil {
+		fmt.Fprintf(d.e.stdout, "    (skipped %d bytes)\n", n)
+	}
+	d.skipped += n
+	d.buf = d.buf[n:]
+}
+
+// frame prints one frame with its decoded fields.
+func (d *decoder) frame(frame []byte) {
+	d.frames++
+	code := frame[1]
+	response := code < protocol.CmdVerifyChecksum
+
+	command := d.command
+	if !response {
+		d.command = code
+		command = 0
+	}
+	fields := protocol.DecodeFields(frame, command)
+
+	checksumOK := binary.LittleEndian.Uint16(frame[len(frame)-3:]) ==
+		protocol.PacketChecksum(frame[:len(frame)-3], d.checksumType)
+	if !checksumOK {
+		d.bad++
+	}
+
+	if d.e.events != nil {
+		ev := frameEvent{eventHeader: header("frame"), Index: d.frames, Code: code,
+			Name: protocol.CommandName(code), ChecksumOK: checksumOK, Bytes: fmt.Sprintf("%X", frame)}
+		ev.Direction = "command"
+		if response {
+			ev.Direction = "response"
+			ev.Name = protocol.StatusName(code)
+		}
+		for _, f := range fields {
+			ev.Fields = append(ev.Fields, fieldJSON{Name: f.Name, Value: f.Value})
+		}
+		d.e.events.emit(ev)
+		return
+	}
+
+	arrow := ">"
+	if response {
+		arrow = "<"
+	}
+	fmt.Fprintf(d.e.stdout, "#%-4d %s %s\n", d.frames, arrow, protocol.FormatFrame(frame, d.checksumType))
+	for _, f := range fields {
+		fmt.Fprintf(d.e.stdout, "        %s: %s\n", f.Name, f.Value)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+func runDiff(ctx context.Context, e *env, args []string) int {
+	var (
+		common commonFlags
+		device bool
+	)
+	fs := newFlagSet(e, "diff", "<old.cyacd> <new.cyacd> | -device <firmware.cyacd>", &common)
+	fs.BoolVar(&device, "device", false, "compare the file with the flash of the device selected by -d, using row checksums")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if device {
+		if !checkNArg(fs, 1) {
+			return exitUsage
+		}
+		return diffDevice(ctx, e, &common, fs.Arg(0))
+	}
+	if !checkNArg(fs, 2) {
+		return exitUsage
+	}
+
+	a, err := cyacd.Parse(fs.Arg(0))
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", fs.Arg(0), err))
+	}
+	b, err := cyacd.Parse(fs.Arg(1))
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", fs.Arg(1), err))
+	}
+
+	var headers []string
+	if a.SiliconID != b.SiliconID {
+		headers = append(headers, fmt.Sprintf("silicon ID 0x%08X -> 0x%08X", a.SiliconID, b.SiliconID))
+	}
+	if a.SiliconRev != b.SiliconRev {
+		headers = append(headers, fmt.Sprintf("silicon revision 0x%02X -> 0x%02X", a.SiliconRev, b.SiliconRev))
+	}
+	if a.ChecksumType != b.ChecksumType {
+		headers = append(headers, fmt.Sprintf("checksum type 0x%02X -> 0x%02X", a.ChecksumType, b.ChecksumType))
+	}
+
+	diffs := cyacd.Diff(a, b)
+	counts := map[cyacd.Change]int{}
+	for _, d := range diffs {
+		counts[d.Change]++
+		if e.events != nil {
+			ev := diffEvent{eventHeader: header("diff"), ArrayID: d.ArrayID, Row: d.RowNum, Change: d.Change.String()}
+			if d.Change == cyacd.RowChanged {
+				offset := d.FirstDifference()
+				ev.FirstDifference = &offset
+			}
+			e.events.emit(ev)
+			continue
+		}
+
+		switch d.Change {
+		case cyacd.RowChanged:
+			fmt.Fprintf(e.stdout, "~ row 0x%04X (array %d): %d bytes differ, first at offset %d\n",
+				d.RowNum, d.ArrayID, countDifferences(d.Old.Data, d.New.Data), d.FirstDifference())
+		case cyacd.RowAdded:
+			fmt.Fprintf(e.stdout, "+ row 0x%04X (array %d): only in %s\n", d.RowNum, d.ArrayID, fs.Arg(1))
+		case cyacd.RowRemoved:
+			fmt.Fprintf(e.stdout, "- row 0x%04X (array %d): only in %s\n", d.RowNum, d.ArrayID, fs.Arg(0))
+		}
+	}
+
+	same := len(diffs) == 0 && len(headers) == 0
+	if e.events != nil {
+		e.events.emit(diffResult{resultHeader: result("diff", same), Headers: headers,
+			Changed: counts[cyacd.RowChanged], Added: counts[cyacd.RowAdded], Removed: counts[cyacd.RowRemoved]})
+	} else {
+		for _, h := range headers {
+			fmt.Fprintf(e.stdout, "header: %s\n", h)
+		}
+		if same {
+			fmt.Fprintf(e.stdout, "no differences (%d rows)\n", len(b.Rows))
+		} else {
+			fmt.Fprintf(e.stdout, "%d rows differ: %d changed, %d added, %d removed\n",
+				len(diffs), counts[cyacd.RowChanged], counts[cyacd.RowAdded], counts[cyacd.RowRemoved])
+		}
+	}
+	if !same {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// countDifferences returns the number of differing bytes of two rows,
+// counting bytes beyond the end of the shorter one.
+func countDifferences(a, b []byte) int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	n := len(b) - len(a)
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// diffDevice compares the file at path with the flash of the device using
+// the Verify Row checksums, like verify but without checking the
+// application checksum.
+func diffDevice(ctx context.Context, e *env, common *commonFlags, path string) int {
+	key, err := parseKey(common.key)
+	if err != nil {
+		return fail(e, err)
+	}
+	fw, err := cyacd.Parse(path)
+	if err != nil {
+		return fail(e, fmt.Errorf("parse %s: %w", path, err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, common.timeout)
+	defer cancel()
+
+	s, err := open(ctx, e, common)
+	if err != nil {
+		return fail(e, err)
+	}
+	defer s.close()
+
+	if _, err := s.prog.Connect(ctx, key); err != nil {
+		return fail(e, err)
+	}
+	defer s.prog.Close(context.WithoutCancel(ctx))
+
+	mismatches, err := compareDevice(ctx, e, s.prog, fw)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	if e.events != nil {
+		e.events.emit(diffResult{resultHeader: result("diff", mismatches == 0), Changed: mismatches})
+	} else if mismatches == 0 {
+		fmt.Fprintf(e.stdout, "no differences (%d rows)\n", len(fw.Rows))
+	} else {
+		fmt.Fprintf(e.stdout, "%d of %d rows differ\n", mismatches, len(fw.Rows))
+	}
+	if mismatches > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
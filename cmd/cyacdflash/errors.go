@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// explain returns a message for err tailored to its type and, where one
+// helps, hints on how to fix the problem.
+func explain(err error) (msg string, hints []string) {
+	var (
+		mismatchErr  *bootloader.DeviceMismatchError
+		revErr       *bootloader.SiliconRevMismatchError
+		rangeErr     *bootloader.RowOutOfRangeError
+		protectedErr *bootloader.ProtectedRowError
+		geometryErr  *bootloader.GeometryError
+		checksumErr  *bootloader.ChecksumMismatchError
+		verifyErr    *bootloader.VerificationError
+		rowErr       *bootloader.ProgramRowError
+		protoErr     *protocol.ProtocolError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "interrupted", nil
+
+	case errors.As(err, &mismatchErr):
+		return fmt.Sprintf("wrong device: the firmware is built for silicon ID 0x%08X, the device is 0x%08X",
+				mismatchErr.Expected, mismatchErr.Actual),
+			[]string{"check that the firmware file matches the connected device"}
+
+	case errors.As(err, &revErr):
+		return fmt.Sprintf("wrong silicon revision: expected 0x%02X, the device is 0x%02X", revErr.Expected, revErr.Actual), nil
+
+	case errors.As(err, &rangeErr):
+		return fmt.Sprintf("firmware does not fit the device: row %d (array %d) is outside the flash range %d-%d",
+				rangeErr.RowNum, rangeErr.ArrayID, rangeErr.MinRow, rangeErr.MaxRow),
+			[]string{"use a firmware file built for this device"}
+
+	case errors.As(err, &geometryErr):
+		return "firmware does not fit the device's flash rows: " + geometryErr.Reason,
+			[]string{"use a firmware file built for this device"}
+
+	case errors.As(err, &protectedErr):
+		return fmt.Sprintf("refusing to write protected row %d (array %d)", protectedErr.RowNum, protectedErr.ArrayID), nil
+
+	case errors.As(err, &protoErr) && protoErr.StatusCode == protocol.ErrKey:
+		return "the bootloader rejected the key", []string{"check the -key value against the bootloader project"}
+
+	case errors.As(err, &checksumErr):
+		msg = fmt.Sprintf("data corruption: row %d reads back 0x%02X, expected 0x%02X",
+			checksumErr.RowNum, checksumErr.Actual, checksumErr.Expected)
+		return msg, []string{
+			"reduce -chunk-size or add -command-delay",
+			"check cables and the power supply",
+		}
+
+	case errors.As(err, &verifyErr):
+		return "application verification failed: " + verifyErr.Reason,
+			[]string{"program the device again; the firmware may be incomplete"}
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out waiting for the device: " + err.Error(), []string{
+			"check that the device is in bootloader mode",
+			"increase -read-timeout or add -command-delay for slow links",
+		}
+
+	case errors.As(err, &rowErr):
+		return err.Error(), []string{"retry; if it keeps failing reduce -chunk-size or add -command-delay"}
+	}
+
+	return err.Error(), nil
+}
+
+// printError prints err with its explanation and hints.
+func printError(w io.Writer, err error) {
+	msg, hints := explain(err)
+	fmt.Fprintf(w, "error: %s\n", msg)
+	for _, hint := range hints {
+		fmt.Fprintf(w, "  hint: %s\n", hint)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+)
+
+// events writes the JSON Lines output selected with -json: one JSON object
+// per line on stdout, each with an "event" field naming its kind.
+//
+// Event kinds:
+//
+//	progress  programming progress (flash)
+//	report    the ProgramReport of a flash, in the bootloader.ProgramReport.WriteJSON schema
+//	row       a row whose device checksum differs from the file (verify, diff -device)
+//	diff      a row that differs between two files (diff)
+//	frame     a decoded frame (decode)
+//	device    an enumerated device (list)
+//	listening the address of the simulated bootloader (mockserve)
+//	result    the outcome of a command other than a report
+//	error     the error that ended the command, with hints
+type events struct {
+	enc *json.Encoder
+}
+
+func newEvents(w io.Writer) *events {
+	return &events{enc: json.NewEncoder(w)}
+}
+
+// emit writes v as one line. Write errors are ignored; there is nowhere left
+// to report them.
+func (ev *events) emit(v interface{}) {
+	_ = ev.enc.Encode(v)
+}
+
+// eventHeader is embedded in every event.
+type eventHeader struct {
+	Event string `json:"event"`
+	Time  string `json:"time"`
+}
+
+func header(event string) eventHeader {
+	return eventHeader{Event: event, Time: time.Now().UTC().Format(time.RFC3339Nano)}
+}
+
+type progressEvent struct {
+	eventHeader
+	Phase          bootloader.Phase `json:"phase"`
+	Percentage     float64          `json:"percentage"`
+	CurrentRow     int              `json:"current_row"`
+	TotalRows      int              `json:"total_rows"`
+	BytesWritten   int              `json:"bytes_written"`
+	TotalBytes     int              `json:"total_bytes"`
+	ElapsedMs      int64            `json:"elapsed_ms"`
+	BytesPerSecond float64          `json:"bytes_per_second"`
+	RemainingMs    int64            `json:"remaining_ms"`
+}
+
+// progress emits p. It is used as a bootloader.ProgressCallback.
+func (ev *events) progress(p bootloader.Progress) {
+	ev.emit(progressEvent{
+		eventHeader:    header("progress"),
+		Phase:          p.Phase,
+		Percentage:     p.Percentage,
+		CurrentRow:     p.CurrentRow,
+		TotalRows:      p.TotalRows,
+		BytesWritten:   p.BytesWritten,
+		TotalBytes:     p.TotalBytes,
+		ElapsedMs:      p.ElapsedTime.Milliseconds(),
+		BytesPerSecond: p.BytesPerSecond,
+		RemainingMs:    p.EstimatedRemaining.Milliseconds(),
+	})
+}
+
+type reportEvent struct {
+	eventHeader
+	Report json.RawMessage `json:"report"`
+}
+
+// report emits report in the schema of bootloader.ProgramReport.WriteJSON.
+func (ev *events) report(report *bootloader.ProgramReport) {
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		ev.failure(err, exitFailure)
+		return
+	}
+	ev.emit(reportEvent{eventHeader: header("report"), Report: buf.Bytes()})
+}
+
+type rowEvent struct {
+	eventHeader
+	ArrayID        byte   `json:"array_id"`
+	Row            uint16 `json:"row"`
+	DeviceChecksum string `json:"device_checksum,omitempty"`
+	Expected       string `json:"expected_checksum"`
+	Error          string `json:"error,omitempty"`
+}
+
+// resultHeader is embedded in the result event of every command other
+// than a flash with a report.
+type resultHeader struct {
+	eventHeader
+	Command string `json:"command"`
+	Success bool   `json:"success"`
+}
+
+func result(command string, success bool) resultHeader {
+	return resultHeader{eventHeader: header("result"), Command: command, Success: success}
+}
+
+type flashResult struct {
+	resultHeader
+	Rows       int   `json:"rows"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+type verifyResult struct {
+	resultHeader
+	Rows             int  `json:"rows"`
+	Mismatches       int  `json:"mismatches"`
+	ApplicationValid bool `json:"application_valid"`
+}
+
+type eraseResult struct {
+	resultHeader
+	ArrayID  byte   `json:"array_id"`
+	FirstRow uint16 `json:"first_row"`
+	LastRow  uint16 `json:"last_row"`
+}
+
+type infoResult struct {
+	resultHeader
+	SiliconID         string `json:"silicon_id"`
+	SiliconRev        string `json:"silicon_rev"`
+	BootloaderVersion string `json:"bootloader_version"`
+	ArrayID           byte   `json:"array_id"`
+	StartRow          uint16 `json:"start_row"`
+	EndRow            uint16 `json:"end_row"`
+}
+
+type metadataResult struct {
+	resultHeader
+	Application       byte   `json:"application"`
+	AppID             uint16 `json:"app_id"`
+	AppVersion        uint16 `json:"app_version"`
+	CustomID          uint32 `json:"custom_id"`
+	Checksum          string `json:"checksum"`
+	StartAddr         uint32 `json:"start_address"`
+	Length            uint32 `json:"length"`
+	LastRow           uint16 `json:"last_row"`
+	Active            bool   `json:"active"`
+	Verified          bool   `json:"verified"`
+	BootloaderVersion uint16 `json:"bootloader_version"`
+}
+
+type convertResult struct {
+	resultHeader
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Format string `json:"format"`
+	Rows   int    `json:"rows"`
+}
+
+type decodeResult struct {
+	resultHeader
+	Frames       int `json:"frames"`
+	BadChecksums int `json:"bad_checksums"`
+	SkippedBytes int `json:"skipped_bytes"`
+}
+
+type transcriptResult struct {
+	resultHeader
+	Frames        int `json:"frames"`
+	Commands      int `json:"commands"`
+	Responses     int `json:"responses"`
+	ErrorStatuses int `json:"error_statuses"`
+	BadChecksums  int `json:"bad_checksums"`
+	Retries       int `json:"retries"`
+	Unanswered    int `json:"unanswered"`
+}
+
+type frameEvent struct {
+	eventHeader
+	Index      int         `json:"index"`
+	Direction  string      `json:"direction"`
+	Code       byte        `json:"code"`
+	Name       string      `json:"name"`
+	ChecksumOK bool        `json:"checksum_ok"`
+	Fields     []fieldJSON `json:"fields,omitempty"`
+	Bytes      string      `json:"bytes"`
+}
+
+type fieldJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type mockServeEvent struct {
+	eventHeader
+	Address string `json:"address"`
+	Device  string `json:"device"`
+}
+
+type deviceEvent struct {
+	eventHeader
+	Device       string `json:"device"`
+	Kind         string `json:"kind"`
+	VIDPID       string `json:"vid_pid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	Description  string `json:"description,omitempty"`
+	SiliconID    string `json:"silicon_id,omitempty"`
+}
+
+type diffEvent struct {
+	eventHeader
+	ArrayID         byte   `json:"array_id"`
+	Row             uint16 `json:"row"`
+	Change          string `json:"change"`
+	FirstDifference *int   `json:"first_difference,omitempty"`
+}
+
+type diffResult struct {
+	resultHeader
+	Headers []string `json:"headers,omitempty"`
+	Changed int      `json:"changed"`
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+}
+
+type listResult struct {
+	resultHeader
+	Devices     int `json:"devices"`
+	Bootloaders int `json:"bootloaders"`
+}
+
+type errorEvent struct {
+	eventHeader
+	Message  string   `json:"message"`
+	Hints    []string `json:"hints,omitempty"`
+	Error    string   `json:"error"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// failure emits err with its explanation and hints.
+func (ev *events) failure(err error, code int) {
+	msg, hints := explain(err)
+	ev.emit(errorEvent{eventHeader: header("error"), Message: msg, Hints: hints, Error: err.Error(), ExitCode: code})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// commonFlags are the connection and protocol flags shared by all commands.
+type commonFlags struct {
+	device       string
+	key          string
+	timeout      time.Duration
+	readTimeout  time.Duration
+	retries      int
+	chunkSize    int
+	commandDelay time.Duration
+	entryWindow  time.Duration
+	rowSize      int
+	reportID     int
+	packetSize   int
+	verbose      bool
+	frames       bool
+	tls          tlsFlags
+}
+
+// newFlagSet creates the flag set of a command with -json and, unless common
+// is nil, the common device flags registered. usage describes the positional
+// arguments.
+func newFlagSet(e *env, name, usage string, common *commonFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: cyacdflash %s [flags] %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+
+	fs.BoolFunc("json", "write progress and results to stdout as JSON Lines", func(s string) error {
+		on, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		e.events = nil
+		if on {
+			e.events = newEvents(e.stdout)
+		}
+		return nil
+	})
+	if common == nil {
+		return fs
+	}
+
+	fs.StringVar(&common.device, "d", "", describeDevice())
+	fs.StringVar(&common.key, "key", "", "bootloader key, 12 hex digits (e.g. 0A1B2C3D4E5F or 0a:1b:2c:3d:4e:5f), example for the code example key, or none")
+	fs.DurationVar(&common.timeout, "timeout", 10*time.Minute, "overall timeout of the command")
+	fs.DurationVar(&common.readTimeout, "read-timeout", bootloader.DefaultReadTimeout, "timeout waiting for each response")
+	fs.IntVar(&common.retries, "retries", bootloader.DefaultRetries, "retries of rows and commands after transient errors")
+	fs.IntVar(&common.chunkSize, "chunk-size", bootloader.DefaultChunkSize, "bytes per Send Data command")
+	fs.DurationVar(&common.commandDelay, "command-delay", 0, "delay between commands (e.g. 25ms for serial)")
+	fs.DurationVar(&common.entryWindow, "wait-bootloader", 0, "keep retrying Enter Bootloader for this long while the target is reset into its bootloader (0 to try once)")
+	fs.IntVar(&common.rowSize, "row-size", 0, "flash row size of the device in bytes; firmware rows of another size are rejected before programming (0 to skip the check)")
+	fs.IntVar(&common.reportID, "report-id", -1, "HID report ID prepended to every write (-1 for none)")
+	fs.IntVar(&common.packetSize, "packet-size", 0, "pad every write to this size, including the report ID (0 for no padding)")
+	fs.BoolVar(&common.verbose, "v", false, "log bootloader operations to stderr")
+	fs.BoolVar(&common.frames, "frames", false, "log every frame to stderr (implies -v)")
+	fs.StringVar(&common.tls.ca, "tls-ca", "", "PEM file of the CAs that sign the certificate of a tls:// device (default: the system roots)")
+	fs.StringVar(&common.tls.cert, "tls-cert", "", "PEM client certificate for mutual TLS with a tls:// device (with -tls-key)")
+	fs.StringVar(&common.tls.key, "tls-key", "", "PEM private key of -tls-cert")
+	fs.StringVar(&common.tls.serverName, "tls-server-name", "", "server name sent with SNI and verified (default: the host of the tls:// device)")
+	return fs
+}
+
+// parseFlags parses args and checks the number of positional arguments.
+// It returns false after printing a message if the command line is invalid.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	return checkNArg(fs, nargs)
+}
+
+// checkNArg checks the number of positional arguments of a parsed flag set,
+// for commands whose arguments depend on their flags.
+func checkNArg(fs *flag.FlagSet, nargs int) bool {
+	if fs.NArg() != nargs {
+		fmt.Fprintf(fs.Output(), "cyacdflash %s: expected %d argument(s), got %d\n", fs.Name(), nargs, fs.NArg())
+		fs.Usage()
+		return false
+	}
+	return true
+}
+
+// uintFlag defines a flag for an unsigned integer of the given bit size,
+// accepting decimal or 0x-prefixed hex.
+func uintFlag(fs *flag.FlagSet, name string, bitSize int, usage string, p *uint64) {
+	fs.Func(name, usage, func(s string) error {
+		v, err := strconv.ParseUint(s, 0, bitSize)
+		if err != nil {
+			return fmt.Errorf("not a %d-bit number: %q", bitSize, s)
+		}
+		*p = v
+		return nil
+	})
+}
+
+// options returns the programmer options selected by the common flags.
+func (c *commonFlags) options(stderr io.Writer) []bootloader.Option {
+	opts := []bootloader.Option{
+		bootloader.WithReadTimeout(c.readTimeout),
+		bootloader.WithRetries(c.retries),
+		bootloader.WithChunkSize(c.chunkSize),
+		bootloader.WithCommandDelay(c.commandDelay),
+		bootloader.WithWritePacketSize(c.packetSize),
+		bootloader.WithEntryWindow(c.entryWindow, 0),
+		bootloader.WithRowSize(c.rowSize),
+	}
+	if c.reportID >= 0 {
+		opts = append(opts, bootloader.WithHIDReportID(byte(c.reportID)))
+	}
+	if c.verbose || c.frames {
+		opts = append(opts, bootloader.WithLogger(&logger{log.New(stderr, "", log.Ltime|log.Lmicroseconds)}))
+	}
+	if c.frames {
+		opts = append(opts, bootloader.WithFrameLogging())
+	}
+	return opts
+}
+
+// parseKey parses a bootloader key as protocol.ParseKey does, or "example"
+// for protocol.DefaultExampleKey.
+func parseKey(s string) ([]byte, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return nil, fmt.Errorf("no bootloader key given (use -key)")
+	case "example":
+		return []byte(protocol.DefaultExampleKey), nil
+	}
+	return protocol.ParseKey(s)
+}
+
+// logger implements bootloader.Logger with the standard log package.
+type logger struct {
+	l *log.Logger
+}
+
+func (l *logger) Debug(msg string, kv ...interface{}) { l.print("DEBUG", msg, kv) }
+func (l *logger) Info(msg string, kv ...interface{})  { l.print("INFO", msg, kv) }
+func (l *logger) Warn(msg string, kv ...interface{})  { l.print("WARN", msg, kv) }
+func (l *logger) Error(msg string, kv ...interface{}) { l.print("ERROR", msg, kv) }
+
+func (l *logger) print(level, msg string, kv []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-5s %s", level, msg)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+	}
+	l.l.Print(b.String())
+}
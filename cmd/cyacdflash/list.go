@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+)
+
+// sysfsRoot and devRoot locate the Linux device tree; tests point them at a
+// fake one.
+var (
+	sysfsRoot = "/sys"
+	devRoot   = "/dev"
+)
+
+// listedDevice is an enumerated device with the details shown by list.
+type listedDevice struct {
+	bootloader.Candidate
+	kind        string // "serial" or "hid"
+	description string
+}
+
+func runList(ctx context.Context, e *env, args []string) int {
+	var (
+		probe       bool
+		keyFlag     string
+		match       string
+		readTimeout time.Duration
+	)
+	fs := newFlagSet(e, "list", "", nil)
+	fs.BoolVar(&probe, "probe", false, "probe each device for a bootloader with Enter Bootloader (needs -key); responsive devices are left in the bootloader")
+	fs.StringVar(&keyFlag, "key", "", "bootloader key used by -probe")
+	fs.StringVar(&match, "match", "", "only list devices whose path matches this shell pattern (e.g. /dev/ttyACM*)")
+	fs.DurationVar(&readTimeout, "read-timeout", 500*time.Millisecond, "time to wait for each probe response")
+	if !parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+
+	devices, err := enumerateDevices()
+	if err != nil {
+		return fail(e, err)
+	}
+	if match != "" {
+		kept := devices[:0]
+		for _, d := range devices {
+			if ok, _ := filepath.Match(match, d.Name); ok {
+				kept = append(kept, d)
+			}
+		}
+		devices = kept
+	}
+
+	// Probe results by device name
+	found := map[string]bootloader.Discovered{}
+	if probe {
+		key, err := parseKey(keyFlag)
+		if err != nil {
+			return fail(e, err)
+		}
+		discovered, err := bootloader.Discover(ctx, func(context.Context) ([]bootloader.Candidate, error) {
+			candidates := make([]bootloader.Candidate, len(devices))
+			for i, d := range devices {
+				candidates[i] = d.Candidate
+			}
+			return candidates, nil
+		}, bootloader.WithProbeKeys(key), bootloader.WithProbeOptions(bootloader.WithReadTimeout(readTimeout)))
+		if err != nil {
+			return fail(e, err)
+		}
+		for _, d := range discovered {
+			found[d.Name] = d
+			if c, ok := d.Device.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+
+	if e.events != nil {
+		for _, d := range devices {
+			ev := deviceEvent{eventHeader: header("device"), Device: d.Name, Kind: d.kind,
+				SerialNumber: d.SerialNumber, Description: d.description}
+			if d.VendorID != 0 || d.ProductID != 0 {
+				ev.VIDPID = fmt.Sprintf("%04X:%04X", d.VendorID, d.ProductID)
+			}
+			if b, ok := found[d.Name]; ok {
+				ev.SiliconID = fmt.Sprintf("0x%08X", b.Info.SiliconID)
+			}
+			e.events.emit(ev)
+		}
+		e.events.emit(listResult{resultHeader: result("list", true), Devices: len(devices), Bootloaders: len(found)})
+		return exitOK
+	}
+
+	if len(devices) == 0 {
+		fmt.Fprintln(e.stdout, "no serial or HID devices found")
+		if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+			fmt.Fprintf(e.stdout, "(device enumeration is not supported on %s; pass the port name to -d)\n", runtime.GOOS)
+		}
+		return exitOK
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	columns := "DEVICE\tKIND\tVID:PID\tSERIAL\tDESCRIPTION"
+	if probe {
+		columns += "\tBOOTLOADER"
+	}
+	fmt.Fprintln(tw, columns)
+	for _, d := range devices {
+		vidpid := "-"
+		if d.VendorID != 0 || d.ProductID != 0 {
+			vidpid = fmt.Sprintf("%04X:%04X", d.VendorID, d.ProductID)
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", d.Name, d.kind, vidpid, orDash(d.SerialNumber), orDash(d.description))
+		if probe {
+			status := "-"
+			if b, ok := found[d.Name]; ok {
+				status = fmt.Sprintf("silicon ID 0x%08X", b.Info.SiliconID)
+			}
+			line += "\t" + status
+		}
+		fmt.Fprintln(tw, line)
+	}
+	tw.Flush()
+	return exitOK
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// enumerateDevices lists the USB serial ports and HID devices of this
+// machine. On Linux the USB identifiers come from sysfs; on macOS only the
+// USB serial device nodes are listed. Other systems list nothing.
+func enumerateDevices() ([]listedDevice, error) {
+	var devices []listedDevice
+	switch runtime.GOOS {
+	case "linux":
+		for _, pattern := range []string{"ttyACM*", "ttyUSB*"} {
+			paths, _ := filepath.Glob(filepath.Join(sysfsRoot, "class", "tty", pattern))
+			for _, p := range paths {
+				devices = append(devices, serialDevice(p))
+			}
+		}
+		paths, _ := filepath.Glob(filepath.Join(sysfsRoot, "class", "hidraw", "hidraw*"))
+		for _, p := range paths {
+			devices = append(devices, hidDevice(p))
+		}
+
+	case "darwin":
+		for _, pattern := range []string{"cu.usbmodem*", "cu.usbserial*"} {
+			paths, _ := filepath.Glob(filepath.Join(devRoot, pattern))
+			for _, p := range paths {
+				devices = append(devices, newListedDevice(p, "serial"))
+			}
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices, nil
+}
+
+func newListedDevice(path, kind string) listedDevice {
+	return listedDevice{
+		Candidate: bootloader.Candidate{
+			Name: path,
+			Open: func() (io.ReadWriter, error) { return openDevice(context.Background(), path, nil) },
+		},
+		kind: kind,
+	}
+}
+
+// serialDevice describes the tty at sysPath (/sys/class/tty/NAME) from the
+// attributes of its USB device, found by walking up from the interface.
+func serialDevice(sysPath string) listedDevice {
+	d := newListedDevice(filepath.Join(devRoot, filepath.Base(sysPath)), "serial")
+
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysPath, "device"))
+	if err != nil {
+		return d
+	}
+	for i := 0; i < 4 && dir != "/" && dir != "."; i, dir = i+1, filepath.Dir(dir) {
+		vid, err := readHex(filepath.Join(dir, "idVendor"))
+		if err != nil {
+			continue
+		}
+		d.VendorID = vid
+		d.ProductID, _ = readHex(filepath.Join(dir, "idProduct"))
+		d.SerialNumber = readAttr(filepath.Join(dir, "serial"))
+		d.description = readAttr(filepath.Join(dir, "product"))
+		break
+	}
+	return d
+}
+
+// hidDevice describes the hidraw node at sysPath (/sys/class/hidraw/NAME)
+// from the uevent of its HID device:
+//
+//	HID_ID=0003:000004B4:0000F13B
+//	HID_NAME=Cypress KitProg3
+//	HID_UNIQ=0123456789
+func hidDevice(sysPath string) listedDevice {
+	d := newListedDevice(filepath.Join(devRoot, filepath.Base(sysPath)), "hid")
+
+	f, err := os.Open(filepath.Join(sysPath, "device", "uevent"))
+	if err != nil {
+		return d
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, _ := strings.Cut(scanner.Text(), "=")
+		switch name {
+		case "HID_ID":
+			if parts := strings.Split(value, ":"); len(parts) == 3 {
+				vid, _ := strconv.ParseUint(parts[1], 16, 32)
+				pid, _ := strconv.ParseUint(parts[2], 16, 32)
+				d.VendorID, d.ProductID = uint16(vid), uint16(pid)
+			}
+		case "HID_NAME":
+			d.description = value
+		case "HID_UNIQ":
+			d.SerialNumber = value
+		}
+	}
+	return d
+}
+
+// readAttr returns the trimmed contents of a sysfs attribute, or "" if it
+// cannot be read.
+func readAttr(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readHex reads a sysfs attribute holding a 16-bit hex number.
+func readHex(path string) (uint16, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 16)
+	return uint16(v), err
+}
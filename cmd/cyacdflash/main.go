@@ -0,0 +1,136 @@
+// Command cyacdflash programs Cypress/Infineon microcontrollers with .cyacd
+// and .cyacd2 firmware files through their bootloader.
+//
+// Usage:
+//
+//	cyacdflash <command> [flags] [arguments]
+//
+// Commands:
+//
+//	flash      program a firmware file into the device
+//	verify     compare the device flash with a firmware file
+//	diff       show the rows that differ between two firmware files or a file and the device
+//	erase      erase a range of flash rows
+//	info       show the bootloader identification and flash range
+//	list       list serial and HID devices, optionally probing for bootloaders
+//	metadata   show the metadata of an application
+//	convert    convert between firmware formats (hex, srec, cyacd, cyacd2, bin)
+//	decode     annotate the frames in a hex dump or frame log
+//	transcript render a pcapng capture of a session as an annotated log
+//	mockserve  serve a simulated bootloader over TCP
+//	cyflash    program a device with the flags of the Python cyflash tool
+//
+// The device is selected with -d: a device node such as /dev/ttyACM0 or
+// /dev/hidraw0 (serial ports must already be configured, e.g. with stty),
+// tcp://host:port for a network bridge, tls://host:port for a bridge behind
+// TLS (with -tls-ca, and -tls-cert and -tls-key for mutual TLS), or
+// mock[:preset] for a simulated bootloader from the bootloadertest package.
+//
+// With -json, progress, the final report or result, and errors are written to
+// stdout as JSON Lines (one object per line, with an "event" field) for
+// supervising software. Diagnostics still go to stderr.
+//
+// Scripts written for the Python cyflash tool can run "cyacdflash cyflash"
+// with their existing flags, or run cyacdflash through a symlink named cyflash.
+//
+// Example:
+//
+//	cyacdflash flash -d /dev/hidraw0 -report-id 0 -packet-size 65 -key 0A1B2C3D4E5F firmware.cyacd
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// command is a cyacdflash subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, env *env, args []string) int
+}
+
+var commands = []command{
+	{"flash", "program a firmware file into the device", runFlash},
+	{"verify", "compare the device flash with a firmware file", runVerify},
+	{"diff", "show the rows that differ between two firmware files or a file and the device", runDiff},
+	{"erase", "erase a range of flash rows", runErase},
+	{"info", "show the bootloader identification and flash range", runInfo},
+	{"list", "list serial and HID devices, optionally probing for bootloaders", runList},
+	{"metadata", "show the metadata of an application", runMetadata},
+	{"convert", "convert between firmware formats (hex, srec, cyacd, cyacd2, bin)", runConvert},
+	{"decode", "annotate the frames in a hex dump or frame log", runDecode},
+	{"transcript", "render a pcapng capture of a session as an annotated log", runTranscript},
+	{"mockserve", "serve a simulated bootloader over TCP", runMockServe},
+	{"cyflash", "program a device with the flags of the Python cyflash tool", runCyflash},
+}
+
+// env holds the output streams of a command.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	// events is set by the -json flag; results then go to stdout as JSON
+	// Lines instead of text.
+	events *events
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	args := os.Args[1:]
+	if name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"); name == "cyflash" {
+		args = append([]string{"cyflash"}, args...)
+	}
+	code := run(ctx, args, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line args and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	e := &env{stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, e, args[1:])
+		}
+	}
+
+	fmt.Fprintf(stderr, "cyacdflash: unknown command %q\n\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: cyacdflash <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'cyacdflash <command> -h' for the flags of a command.")
+}
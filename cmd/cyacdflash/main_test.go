@@ -0,0 +1,700 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// writeFirmware writes a .cyacd file for siliconID with the given number of
+// 64-byte rows, starting at row 0x0010, and returns its path.
+func writeFirmware(t *testing.T, siliconID uint32, rows int) string {
+	t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%08X0000\n", siliconID)
+	for i := 0; i < rows; i++ {
+		rowNum := 0x0010 + i
+		line := []byte{0x00, byte(rowNum), byte(rowNum >> 8), 64, 0}
+		for j := 0; j < 64; j++ {
+			line = append(line, byte(i+j))
+		}
+		var sum byte
+		for _, c := range line {
+			sum += c
+		}
+		line = append(line, ^sum+1)
+		b.WriteString(strings.ToUpper(hex.EncodeToString(line)) + "\n")
+	}
+
+	path := filepath.Join(t.TempDir(), "firmware.cyacd")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCLI runs the command line and returns its exit code, stdout, and stderr.
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, _ := runCLI(); code != exitUsage {
+		t.Errorf("no arguments: exit code %d, want %d", code, exitUsage)
+	}
+	if code, _, stderr := runCLI("bogus"); code != exitUsage || !strings.Contains(stderr, "unknown command") {
+		t.Errorf("unknown command: exit code %d, stderr %q", code, stderr)
+	}
+	if code, stdout, _ := runCLI("help"); code != exitOK || !strings.Contains(stdout, "flash") {
+		t.Errorf("help: exit code %d, stdout %q", code, stdout)
+	}
+	if code, _, _ := runCLI("flash", "-d", "mock"); code != exitUsage {
+		t.Errorf("missing firmware: exit code %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runCLI("erase", "-d", "mock", "-key", "0A1B2C3D4E5F", "-rows", "9-3"); code != exitUsage {
+		t.Errorf("reversed rows: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestFlash(t *testing.T) {
+	path := writeFirmware(t, 0x1E9602AA, 4)
+	report := filepath.Join(t.TempDir(), "report.json")
+	capture := filepath.Join(t.TempDir(), "session.pcapng")
+
+	// The simulated device checksums rows differently from real files, so rows are not read back
+	code, stdout, stderr := runCLI("flash", "-d", "mock", "-key", "0a:1b:2c:3d:4e:5f", "-no-verify", "-report", report, "-capture", capture, path)
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+	if !strings.Contains(stdout, "programmed 4 rows") {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if !strings.Contains(stderr, "100.0%") {
+		t.Errorf("no progress on stderr: %q", stderr)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Success bool       `json:"success"`
+		Rows    []struct{} `json:"rows"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil || !got.Success || len(got.Rows) != 4 {
+		t.Errorf("report = %s (%v)", data, err)
+	}
+
+	// The capture is a pcapng section with a packet per frame
+	data, err = os.ReadFile(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte{0x0A, 0x0D, 0x0D, 0x0A}) || len(data) < 1000 {
+		t.Errorf("capture of %d bytes does not look like pcapng", len(data))
+	}
+}
+
+func TestFlashErrors(t *testing.T) {
+	path := writeFirmware(t, 0x04C81193, 1)
+
+	code, _, stderr := runCLI("flash", "-d", "mock", "-key", "0A1B2C3D4E5F", "-q", path)
+	if code != exitFailure || !strings.Contains(stderr, "wrong device") || !strings.Contains(stderr, "hint:") {
+		t.Errorf("silicon ID mismatch: exit code %d, stderr %q", code, stderr)
+	}
+
+	code, _, stderr = runCLI("flash", "-d", "mock", "-key", "0A1B2C", path)
+	if code != exitFailure || !strings.Contains(stderr, "must be 6 bytes") {
+		t.Errorf("short key: exit code %d, stderr %q", code, stderr)
+	}
+
+	code, _, stderr = runCLI("flash", "-d", "mock", "-key", "0A1B2C3D4E5F", "-chunk-size", "0", path)
+	if code != exitFailure || !strings.Contains(stderr, "chunk size") {
+		t.Errorf("bad chunk size: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := writeFirmware(t, 0x1E9602AA, 2)
+
+	// A fresh simulated device holds none of the rows
+	code, stdout, _ := runCLI("verify", "-d", "mock", "-key", "0A1B2C3D4E5F", path)
+	if code != exitFailure || !strings.Contains(stdout, "2 of 2 rows differ") {
+		t.Errorf("exit code %d, stdout %q", code, stdout)
+	}
+}
+
+func TestInfoAndMetadata(t *testing.T) {
+	code, stdout, stderr := runCLI("info", "-d", "mock:psoc4", "-key", "0A1B2C3D4E5F")
+	if code != exitOK {
+		t.Fatalf("info: exit code %d, stderr %q", code, stderr)
+	}
+	if !strings.Contains(stdout, "0x04C81193") || !strings.Contains(stdout, "32-255") {
+		t.Errorf("info stdout = %q", stdout)
+	}
+
+	code, stdout, stderr = runCLI("metadata", "-d", "mock:psoc5lp-dual", "-key", "0A1B2C3D4E5F", "-app", "1")
+	if code != exitOK || !strings.Contains(stdout, "Application:        1") {
+		t.Errorf("metadata: exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
+
+func TestErase(t *testing.T) {
+	code, stdout, stderr := runCLI("erase", "-d", "mock", "-key", "0A1B2C3D4E5F", "-rows", "0x10-0x1F")
+	if code != exitOK || !strings.Contains(stdout, "erased 16 rows") {
+		t.Errorf("exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, s := range []string{"0A1B2C3D4E5F", "0x0a1b2c3d4e5f", "0A:1B:2C:3D:4E:5F", "0A-1B-2C-3D-4E-5F"} {
+		key, err := parseKey(s)
+		if err != nil || !bytes.Equal(key, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}) {
+			t.Errorf("parseKey(%q) = %X, %v", s, key, err)
+		}
+	}
+	if key, err := parseKey("example"); err != nil || string(key) != protocol.DefaultExampleKey {
+		t.Errorf("parseKey(example) = %X, %v", key, err)
+	}
+	if key, err := parseKey("none"); err != nil || !protocol.IsNoKey(key) {
+		t.Errorf("parseKey(none) = %X, %v", key, err)
+	}
+	for _, s := range []string{"", "0A1B2C", "0A1B2C3D4E5G"} {
+		if _, err := parseKey(s); err == nil {
+			t.Errorf("parseKey(%q) succeeded", s)
+		}
+	}
+}
+
+// decodeEvents decodes JSON Lines output into one map per line.
+func decodeEvents(t *testing.T, out string) []map[string]interface{} {
+	t.Helper()
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestJSON(t *testing.T) {
+	path := writeFirmware(t, 0x1E9602AA, 3)
+
+	code, stdout, stderr := runCLI("flash", "--json", "-d", "mock", "-key", "0A1B2C3D4E5F", "-no-verify", path)
+	if code != exitOK {
+		t.Fatalf("flash: exit code %d, stderr %q", code, stderr)
+	}
+	if strings.Contains(stderr, "%") {
+		t.Errorf("progress bar drawn with -json: %q", stderr)
+	}
+	events := decodeEvents(t, stdout)
+	last := events[len(events)-1]
+	if last["event"] != "report" {
+		t.Fatalf("last event = %v", last)
+	}
+	if report := last["report"].(map[string]interface{}); report["success"] != true || report["rows_programmed"] != 3.0 {
+		t.Errorf("report = %v", report)
+	}
+	for _, ev := range events[:len(events)-1] {
+		if ev["event"] != "progress" {
+			t.Errorf("unexpected event %v", ev)
+		}
+	}
+
+	code, stdout, _ = runCLI("verify", "-json", "-d", "mock", "-key", "0A1B2C3D4E5F", path)
+	events = decodeEvents(t, stdout)
+	if code != exitFailure || len(events) != 4 || events[0]["event"] != "row" {
+		t.Fatalf("verify: exit code %d, events %v", code, events)
+	}
+	if res := events[3]; res["event"] != "result" || res["success"] != false || res["mismatches"] != 3.0 {
+		t.Errorf("verify result = %v", res)
+	}
+
+	code, stdout, _ = runCLI("info", "-json", "-d", "mock", "-key", "0A1B2C3D4E5F")
+	events = decodeEvents(t, stdout)
+	if code != exitOK || len(events) != 1 || events[0]["silicon_id"] != "0x1E9602AA" {
+		t.Errorf("info: exit code %d, events %v", code, events)
+	}
+
+	code, stdout, _ = runCLI("flash", "-json", "-d", "mock", "-key", "0A1B2C", path)
+	events = decodeEvents(t, stdout)
+	if code != exitFailure || len(events) != 1 || events[0]["event"] != "error" || events[0]["exit_code"] != 1.0 {
+		t.Errorf("error: exit code %d, events %v", code, events)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "app.hex")
+	// 6 bytes at 0x0000 and 2 bytes at 0x0100, then end of file
+	hexFile := ":06000000010203040506E5\n:02010000AABB98\n:00000001FF\n"
+	if err := os.WriteFile(in, []byte(hexFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "app.cyacd")
+	code, stdout, stderr := runCLI("convert", "-silicon-id", "0x1E9602AA", "-row-size", "128", "-fill", "0xFF", in, out)
+	if code != exitOK || !strings.Contains(stdout, "converted 2 rows") {
+		t.Fatalf("hex to cyacd: exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	fw, err := cyacd.Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw.SiliconID != 0x1E9602AA || len(fw.Rows) != 2 || fw.Rows[1].RowNum != 2 || fw.Rows[0].Data[6] != 0xFF {
+		t.Errorf("converted firmware = %+v", fw)
+	}
+
+	out2 := filepath.Join(dir, "app.cyacd2")
+	if code, _, stderr := runCLI("convert", "-flash-base", "0x10000000", "-product-id", "0x01020304", out, out2); code != exitOK {
+		t.Fatalf("cyacd to cyacd2: exit code %d, stderr %q", code, stderr)
+	}
+	fw2, err := cyacd.Parse2(out2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw2.ProductID != 0x01020304 || fw2.AppStart != 0x10000000 || fw2.AppLength != 0x180 || fw2.Rows[1].Address != 0x10000100 {
+		t.Errorf("cyacd2 = %+v", fw2)
+	}
+
+	bin := filepath.Join(dir, "app.bin")
+	if code, _, stderr := runCLI("convert", "-fill", "0xFF", out, bin); code != exitOK {
+		t.Fatalf("cyacd to bin: exit code %d, stderr %q", code, stderr)
+	}
+	data, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0x180 || data[0] != 0x01 || data[0x100] != 0xAA || data[0x102] != 0xFF {
+		t.Errorf("bin is %d bytes", len(data))
+	}
+
+	if code, _, _ := runCLI("convert", in, out); code != exitUsage {
+		t.Errorf("hex without silicon ID: exit code %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runCLI("convert", out, filepath.Join(dir, "app.txt")); code != exitUsage {
+		t.Errorf("unknown output format: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	enter, _ := protocol.BuildEnterBootloaderCmd([]byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	verify, _ := protocol.BuildVerifyRowCmd(0, 0x0010)
+	response := []byte{protocol.StartOfPacket, protocol.StatusSuccess, 0x01, 0x00, 0xAB, 0x54, 0xFF, protocol.EndOfPacket} // bad checksum
+	hexOf := func(b []byte) string { return fmt.Sprintf("% X", b) }
+
+	capture := "12:00:01.000000 DEBUG frame sent frame=Enter Bootloader (0x38) len=6 checksum=ok bytes=" + hexOf(enter) + "\n" +
+		"00000000: " + hexOf(verify) + "  .8......\n" +
+		"RX " + hexOf(response[:3]) + "\n" + // a response split across lines
+		hexOf(response[3:]) + " FF FF\n"
+	path := filepath.Join(t.TempDir(), "capture.txt")
+	if err := os.WriteFile(path, []byte(capture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCLI("decode", path)
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{
+		"> Enter Bootloader (0x38) len=6 checksum=ok",
+		"key: 0A 1B 2C 3D 4E 5F",
+		"> Verify Row (0x3A)",
+		"row: 0x0010 (16)",
+		"< status success (0x00) len=1 checksum=bad",
+		"row checksum: 0xAB",
+		"3 frames, 1 with bad checksums, 2 bytes skipped",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	path := writeFirmware(t, 0x1E9602AA, 2)
+	capture := filepath.Join(t.TempDir(), "session.pcapng")
+	if code, _, stderr := runCLI("flash", "-d", "mock", "-key", "example", "-no-verify", "-q", "-capture", capture, path); code != exitOK {
+		t.Fatalf("flash: exit code %d, stderr %q", code, stderr)
+	}
+
+	code, stdout, stderr := runCLI("transcript", "-utc", capture)
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{
+		"UTC to ",
+		">  Enter Bootloader (0x38) len=6 checksum=ok",
+		"key: FF FF FF FF FF FF",
+		"<  status success (0x00) len=8 checksum=ok  [",
+		">  Program Row (0x39)",
+		"0 error statuses, 0 retries, 0 unanswered",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+
+	code, stdout, _ = runCLI("transcript", "-json", capture)
+	events := decodeEvents(t, stdout)
+	if code != exitOK || len(events) != 1 || events[0]["unanswered"] != 0.0 || events[0]["commands"].(float64) < 4 {
+		t.Errorf("-json: exit code %d, events %v", code, events)
+	}
+
+	if code, _, _ := runCLI("transcript", path); code != exitFailure {
+		t.Errorf("transcript of a firmware file: exit code %d, want %d", code, exitFailure)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMockServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stdout, stderr syncBuffer
+	done := make(chan int, 1)
+	go func() {
+		done <- run(ctx, []string{"mockserve", "-listen", "127.0.0.1:0", "-preset", "psoc4"}, &stdout, &stderr)
+	}()
+
+	var device string
+	for deadline := time.Now().Add(5 * time.Second); device == "" && time.Now().Before(deadline); {
+		if _, rest, ok := strings.Cut(stdout.String(), "(use -d "); ok {
+			device, _, _ = strings.Cut(rest, ")")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if device == "" {
+		t.Fatalf("server did not start: stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+
+	code, out, errOut := runCLI("info", "-d", device, "-key", "0A1B2C3D4E5F")
+	if code != exitOK || !strings.Contains(out, "0x04C81193") {
+		t.Errorf("info over TCP: exit code %d, stdout %q, stderr %q", code, out, errOut)
+	}
+
+	cancel()
+	if code := <-done; code != exitOK {
+		t.Errorf("mockserve exit code %d, stderr %q", code, stderr.String())
+	}
+}
+
+func TestList(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("device enumeration from sysfs is Linux-only")
+	}
+
+	root := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("sys/devices/usb1/1-1/idVendor", "04b4\n")
+	write("sys/devices/usb1/1-1/idProduct", "f155\n")
+	write("sys/devices/usb1/1-1/serial", "1C1C0A\n")
+	write("sys/devices/usb1/1-1/product", "KitProg3 CMSIS-DAP\n")
+	write("sys/devices/usb1/1-1/1-1:1.0/interface", "")
+	write("sys/class/hidraw/hidraw0/device/uevent", "HID_ID=0003:000004B4:0000B71D\nHID_NAME=Cypress Bootloader\n")
+	if err := os.MkdirAll(filepath.Join(root, "sys/class/tty/ttyACM0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sys/devices/usb1/1-1/1-1:1.0"), filepath.Join(root, "sys/class/tty/ttyACM0/device")); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(sys, dev string) { sysfsRoot, devRoot = sys, dev }(sysfsRoot, devRoot)
+	sysfsRoot, devRoot = filepath.Join(root, "sys"), "/dev"
+
+	code, stdout, stderr := runCLI("list")
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{
+		"/dev/hidraw0  hid     04B4:B71D  -       Cypress Bootloader",
+		"/dev/ttyACM0  serial  04B4:F155  1C1C0A  KitProg3 CMSIS-DAP",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+
+	code, stdout, _ = runCLI("list", "-json", "-match", "/dev/tty*")
+	events := decodeEvents(t, stdout)
+	if code != exitOK || len(events) != 2 || events[0]["vid_pid"] != "04B4:F155" {
+		t.Errorf("-json -match: exit code %d, events %v", code, events)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := writeFirmware(t, 0x1E9602AA, 2)
+
+	fw, err := cyacd.Parse(writeFirmware(t, 0x1E9602AA, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Rows[1].Data[5] ^= 0xFF
+	path := filepath.Join(t.TempDir(), "new.cyacd")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	code, stdout, stderr := runCLI("diff", old, path)
+	if code != exitFailure {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{
+		"~ row 0x0011 (array 0): 1 bytes differ, first at offset 5",
+		"+ row 0x0012 (array 0): only in " + path,
+		"2 rows differ: 1 changed, 1 added, 0 removed",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+
+	if code, stdout, _ := runCLI("diff", old, old); code != exitOK || !strings.Contains(stdout, "no differences (2 rows)") {
+		t.Errorf("identical files: exit code %d, stdout %q", code, stdout)
+	}
+
+	// A fresh simulated device holds none of the rows
+	code, stdout, _ = runCLI("diff", "--device", "-d", "mock", "-key", "0A1B2C3D4E5F", old)
+	if code != exitFailure || !strings.Contains(stdout, "2 of 2 rows differ") {
+		t.Errorf("-device: exit code %d, stdout %q", code, stdout)
+	}
+	if code, _, _ := runCLI("diff", "-device", old, path); code != exitUsage {
+		t.Errorf("-device with two files: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestFlashWatch(t *testing.T) {
+	path := writeFirmware(t, 0x1E9602AA, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stdout, stderr syncBuffer
+	done := make(chan int, 1)
+	go func() {
+		done <- run(ctx, []string{"flash", "-watch", "-watch-interval", "10ms", "-debounce", "30ms",
+			"-d", "mock", "-key", "0A1B2C3D4E5F", "-no-verify", "-q", path}, &stdout, &stderr)
+	}()
+
+	waitFor := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if strings.Count(stdout.String(), "programmed 2 rows") >= n {
+				return
+			}
+		}
+		t.Fatalf("no flash #%d; stdout %q, stderr %q", n, stdout.String(), stderr.String())
+	}
+	waitFor(1)
+
+	// A rebuild, with a new modification time
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(2)
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Errorf("exit code %d, stderr %q", code, stderr.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("flash -watch did not stop when canceled")
+	}
+	if n := strings.Count(stdout.String(), "programmed"); n != 2 {
+		t.Errorf("flashed %d times, want 2", n)
+	}
+}
+
+func TestCyflash(t *testing.T) {
+	// Rows whose header bytes sum to zero, so the simulated device's row
+	// checksums match the file and rows can be read back
+	fw := &cyacd.Firmware{SiliconID: 0x1E9602AA}
+	fw.Rows = append(fw.Rows,
+		cyacd.NewRow(0, 0x00C0, bytes.Repeat([]byte{0x11}, 64)),
+		cyacd.NewRow(0, 0x01BF, bytes.Repeat([]byte{0x22}, 64)))
+	path := filepath.Join(t.TempDir(), "app.cyacd")
+	var image bytes.Buffer
+	if _, err := fw.WriteTo(&image); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, image.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCLI("cyflash", "--serial", "mock", "--serial_baudrate", "57600",
+		"--timeout", "0.5", "--key", "0x0A1B2C3D4E5F", "--nodowngrade", "--psoc5", path)
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{"Initialising bootloader.", "Silicon ID 0x1e9602aa", "Uploading data (2/2)",
+		"Device checksum verifies OK.", "Rebooting device."} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout %q does not contain %q", stdout, want)
+		}
+	}
+
+	if code, _, _ := runCLI("cyflash", "--canbus", "can0", "--key", "0A1B2C3D4E5F", path); code != exitUsage {
+		t.Errorf("--canbus: exit code %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runCLI("cyflash", "--key", "0A1B2C3D4E5F", path); code != exitUsage {
+		t.Errorf("no --serial: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+// writeCert issues a certificate for name signed by parent (self-signed if
+// parent is nil), writes it and its key as PEM files to dir, and returns it.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "bridge.local", ca, caKey)
+	writeCert(t, dir, "client", ca, caKey)
+
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "bridge.local.pem"), filepath.Join(dir, "bridge.local.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bootloadertest.Serve(ctx, l, bootloadertest.NewDevice())
+
+	path := writeFirmware(t, 0x1E9602AA, 2)
+	device := "tls://" + l.Addr().String()
+	tlsArgs := []string{"-tls-ca", filepath.Join(dir, "ca.pem"), "-tls-server-name", "bridge.local"}
+	clientArgs := []string{"-tls-cert", filepath.Join(dir, "client.pem"), "-tls-key", filepath.Join(dir, "client.key")}
+
+	args := append([]string{"flash", "-d", device, "-key", "0A1B2C3D4E5F", "-no-verify", "-q"}, tlsArgs...)
+	code, _, stderr := runCLI(append(append(args, clientArgs...), path)...)
+	if code != exitOK {
+		t.Fatalf("flash over mutual TLS: exit code %d, stderr %q", code, stderr)
+	}
+
+	// Without a client certificate the bridge refuses the handshake
+	if code, _, _ := runCLI(append(args, path)...); code == exitOK {
+		t.Error("flash without a client certificate succeeded")
+	}
+	// The server name must match the certificate of the bridge
+	wrongName := []string{"flash", "-d", device, "-key", "0A1B2C3D4E5F", "-no-verify", "-q",
+		"-tls-ca", filepath.Join(dir, "ca.pem"), "-tls-server-name", "other.local"}
+	if code, _, _ := runCLI(append(append(wrongName, clientArgs...), path)...); code == exitOK {
+		t.Error("flash with a mismatched server name succeeded")
+	}
+	// A certificate needs its key
+	if code, _, stderr := runCLI(append(append(args, clientArgs[:2]...), path)...); code == exitOK || !strings.Contains(stderr, "-tls-key") {
+		t.Errorf("-tls-cert without -tls-key: exit code %d, stderr %q", code, stderr)
+	}
+}
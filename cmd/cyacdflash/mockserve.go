@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+)
+
+func runMockServe(ctx context.Context, e *env, args []string) int {
+	var (
+		listen string
+		preset string
+	)
+	fs := newFlagSet(e, "mockserve", "", nil)
+	fs.StringVar(&listen, "listen", "127.0.0.1:5000", "TCP address to listen on")
+	fs.StringVar(&preset, "preset", "", "device preset of the simulated bootloader (default: the bootloadertest defaults)")
+	if !parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+
+	device := bootloadertest.NewDevice()
+	if preset != "" {
+		var err error
+		if device, err = bootloadertest.NewPresetDevice(preset); err != nil {
+			return fail(e, err)
+		}
+	}
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fail(e, err)
+	}
+	addr := l.Addr().String()
+	if e.events != nil {
+		e.events.emit(mockServeEvent{eventHeader: header("listening"), Address: addr, Device: "tcp://" + addr})
+	} else {
+		fmt.Fprintf(e.stdout, "serving a simulated bootloader on %s (use -d tcp://%s); interrupt to stop\n", addr, addr)
+	}
+
+	if err := bootloadertest.Serve(ctx, l, device); err != nil && !errors.Is(err, context.Canceled) {
+		return fail(e, err)
+	}
+	return exitOK
+}
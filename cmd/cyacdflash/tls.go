@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// tlsFlags configure the TLS client of tls:// devices.
+type tlsFlags struct {
+	ca         string
+	cert       string
+	key        string
+	serverName string
+}
+
+// config returns the TLS client configuration selected by the flags: the
+// system roots or the CA file, a client certificate for mutual TLS, and the
+// server name sent with SNI and verified (by default the host of the device).
+func (f *tlsFlags) config() (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: f.serverName,
+	}
+
+	if f.ca != "" {
+		pem, err := os.ReadFile(f.ca)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("read CA: no PEM certificates in %s", f.ca)
+		}
+	}
+
+	switch {
+	case f.cert != "" && f.key != "":
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	case f.cert != "" || f.key != "":
+		return nil, errors.New("-tls-cert and -tls-key must be given together")
+	}
+	return conf, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/moffa90/go-cyacd/protocol"
+	"github.com/moffa90/go-cyacd/transcript"
+)
+
+func runTranscript(ctx context.Context, e *env, args []string) int {
+	var (
+		checksum string
+		bytes    bool
+		utc      bool
+	)
+	fs := newFlagSet(e, "transcript", "<capture.pcapng|->", nil)
+	fs.StringVar(&checksum, "checksum", "sum", "packet checksum type of the bootloader: sum or crc")
+	fs.BoolVar(&bytes, "bytes", false, "show the raw bytes of every frame")
+	fs.BoolVar(&utc, "utc", false, "show timestamps in UTC instead of local time")
+	if !parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+
+	opts := transcript.Options{Bytes: bytes}
+	switch checksum {
+	case "sum":
+		opts.ChecksumType = protocol.ChecksumBasicSum
+	case "crc":
+		opts.ChecksumType = protocol.ChecksumCRC16
+	default:
+		fmt.Fprintf(e.stderr, "cyacdflash transcript: unknown checksum type %q (use sum or crc)\n", checksum)
+		return exitUsage
+	}
+	if utc {
+		opts.Location = time.UTC
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fail(e, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	entries, err := transcript.ReadCapture(r)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	out := e.stdout
+	if e.events != nil {
+		out = io.Discard
+	}
+	summary, err := transcript.Render(out, entries, opts)
+	if err != nil {
+		return fail(e, err)
+	}
+	if e.events != nil {
+		e.events.emit(transcriptResult{resultHeader: result("transcript", true),
+			Frames: len(entries), Commands: summary.Commands, Responses: summary.Responses,
+			ErrorStatuses: summary.ErrorStatuses, BadChecksums: summary.BadChecksums,
+			Retries: summary.Retries, Unanswered: summary.Unanswered})
+	}
+	return exitOK
+}
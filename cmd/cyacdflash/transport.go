@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+)
+
+// dialTimeout bounds the connection to a tcp:// or tls:// device.
+const dialTimeout = 10 * time.Second
+
+// openDevice opens the device selected by spec:
+//
+//	tcp://host:port   a TCP bridge to the bootloader
+//	tls://host:port   a TCP bridge behind TLS, configured by tlsConf
+//	mock[:preset]     a simulated bootloader (see bootloadertest.Presets)
+//	anything else     a device node or file, opened read-write
+//
+// tlsConf may be nil for the default TLS configuration.
+func openDevice(ctx context.Context, spec string, tlsConf *tls.Config) (io.ReadWriteCloser, error) {
+	switch {
+	case spec == "":
+		return nil, errors.New("no device given (use -d)")
+
+	case strings.HasPrefix(spec, "tcp://"):
+		dialer := net.Dialer{Timeout: dialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", strings.TrimPrefix(spec, "tcp://"))
+		if err != nil {
+			return nil, err
+		}
+		return &deadlineDevice{conn: conn}, nil
+
+	case strings.HasPrefix(spec, "tls://"):
+		dialer := tls.Dialer{NetDialer: &net.Dialer{Timeout: dialTimeout}, Config: tlsConf}
+		conn, err := dialer.DialContext(ctx, "tcp", strings.TrimPrefix(spec, "tls://"))
+		if err != nil {
+			return nil, err
+		}
+		return &deadlineDevice{conn: conn.(*tls.Conn)}, nil
+
+	case spec == "mock" || strings.HasPrefix(spec, "mock:"):
+		device := bootloadertest.NewDevice()
+		if name, ok := strings.CutPrefix(spec, "mock:"); ok {
+			var err error
+			if device, err = bootloadertest.NewPresetDevice(name); err != nil {
+				return nil, err
+			}
+		}
+		return mockDevice{device}, nil
+
+	default:
+		f, err := os.OpenFile(spec, os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &deadlineDevice{conn: f}, nil
+	}
+}
+
+// deadlineConn is a connection with read deadlines, such as a net.Conn or an
+// *os.File for a device node that supports polling.
+type deadlineConn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+}
+
+// deadlineDevice implements bootloader.ContextReader with read deadlines, so
+// that read timeouts and cancellation interrupt a blocked read.
+type deadlineDevice struct {
+	conn deadlineConn
+}
+
+func (d *deadlineDevice) Read(p []byte) (int, error)  { return d.conn.Read(p) }
+func (d *deadlineDevice) Write(p []byte) (int, error) { return d.conn.Write(p) }
+func (d *deadlineDevice) Close() error                { return d.conn.Close() }
+
+func (d *deadlineDevice) ReadContext(ctx context.Context, p []byte) (int, error) {
+	deadline, _ := ctx.Deadline()
+	if err := d.conn.SetReadDeadline(deadline); err != nil {
+		// Files without polling support block until data arrives
+		return d.conn.Read(p)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = d.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	n, err := d.conn.Read(p)
+	if err != nil && ctx.Err() != nil {
+		return n, ctx.Err()
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, context.DeadlineExceeded
+	}
+	return n, err
+}
+
+// mockDevice adds a no-op Close to a simulated device.
+type mockDevice struct {
+	*bootloadertest.Device
+}
+
+func (mockDevice) Close() error { return nil }
+
+// describeDevice returns the device kinds accepted by -d, for flag help.
+func describeDevice() string {
+	names := make([]string, 0, len(bootloadertest.Presets()))
+	for _, p := range bootloadertest.Presets() {
+		names = append(names, p.Name)
+	}
+	return fmt.Sprintf("device: a device node (e.g. /dev/ttyACM0, /dev/hidraw0), tcp://host:port, tls://host:port (see -tls-ca), or mock[:preset] (presets: %s)",
+		strings.Join(names, ", "))
+}
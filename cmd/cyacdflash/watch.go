@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileStamp identifies a version of a file by its size and modification time.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// watchFile runs flash for the file at path now and again every time it
+// changes, until ctx is done. A change is acted on once the file has kept the
+// same size and modification time for debounce, so a build that writes the
+// file in several steps is flashed once, when complete. A failed flash is
+// reported and the next change awaited (touch the file to retry); flash opens
+// the device again every time, since it may re-enumerate when the
+// application starts.
+func watchFile(ctx context.Context, e *env, path string, interval, debounce time.Duration, flash func(context.Context) int) int {
+	var flashed fileStamp
+	for {
+		stamp, err := waitForChange(ctx, path, flashed, interval, debounce)
+		if err != nil {
+			// Interrupted: stopping is the normal way to leave watch mode
+			return exitOK
+		}
+		flashed = stamp
+
+		if e.events == nil {
+			fmt.Fprintf(e.stderr, "%s flashing %s\n", time.Now().Format("15:04:05"), path)
+		}
+		if code := flash(ctx); code != exitOK && ctx.Err() == nil && e.events == nil {
+			fmt.Fprintln(e.stderr, "flash failed; fix the problem and rebuild or touch the file to retry")
+		}
+		if ctx.Err() != nil {
+			return exitOK
+		}
+		if e.events == nil {
+			fmt.Fprintf(e.stderr, "watching %s for changes (interrupt to stop)\n", path)
+		}
+	}
+}
+
+// waitForChange polls path every interval until it differs from last and has
+// stayed the same for debounce, and returns its new stamp. A missing file,
+// e.g. one deleted by a clean build, counts as not yet changed.
+func waitForChange(ctx context.Context, path string, last fileStamp, interval, debounce time.Duration) (fileStamp, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pending fileStamp
+	var since time.Time
+	for {
+		if stamp, err := statFile(path); err == nil && stamp != last {
+			now := time.Now()
+			if stamp != pending {
+				pending, since = stamp, now
+			}
+			if now.Sub(since) >= debounce {
+				return stamp, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fileStamp{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Return codes, matching the CYACD_ERR_* values of the C header.
+const (
+	codeArg     = -1
+	codeFile    = -2
+	codeDevice  = -3
+	codeProgram = -4
+	codeVerify  = -5
+)
+
+// codeError is an error with the return code it maps to. Errors without one
+// map to codeProgram.
+type codeError struct {
+	code int
+	err  error
+}
+
+func (e *codeError) Error() string { return e.err.Error() }
+func (e *codeError) Unwrap() error { return e.err }
+
+func argError(msg string) error {
+	return &codeError{code: codeArg, err: errors.New(msg)}
+}
+
+// dialTimeout bounds the connection to a tcp:// device.
+const dialTimeout = 10 * time.Second
+
+// parse reads the .cyacd file at path.
+func parse(path string) (*cyacd.Firmware, error) {
+	fw, err := cyacd.Parse(path)
+	if err != nil {
+		return nil, &codeError{code: codeFile, err: fmt.Errorf("parse %s: %w", path, err)}
+	}
+	return fw, nil
+}
+
+// parseKey parses a key as protocol.ParseKey does, reporting a bad one as an
+// argument error.
+func parseKey(s string) ([]byte, error) {
+	key, err := protocol.ParseKey(s)
+	if err != nil {
+		return nil, argError(err.Error())
+	}
+	return key, nil
+}
+
+// openDevice opens the device selected by spec: tcp://host:port, mock for a
+// simulated bootloader, or a device node.
+func openDevice(ctx context.Context, spec string) (io.ReadWriteCloser, error) {
+	var (
+		device io.ReadWriteCloser
+		err    error
+	)
+	switch {
+	case strings.HasPrefix(spec, "tcp://"):
+		dialer := net.Dialer{Timeout: dialTimeout}
+		device, err = dialer.DialContext(ctx, "tcp", strings.TrimPrefix(spec, "tcp://"))
+	case spec == "mock":
+		device = mockDevice{bootloadertest.NewDevice()}
+	default:
+		device, err = os.OpenFile(spec, os.O_RDWR, 0)
+	}
+	if err != nil {
+		return nil, &codeError{code: codeDevice, err: fmt.Errorf("open %s: %w", spec, err)}
+	}
+	return device, nil
+}
+
+// mockDevice adds a no-op Close to a simulated device.
+type mockDevice struct {
+	*bootloadertest.Device
+}
+
+func (mockDevice) Close() error { return nil }
+
+// session parses the file and key and opens the device.
+func session(ctx context.Context, spec, path, keyHex string, opts ...bootloader.Option) (*bootloader.Programmer, *cyacd.Firmware, []byte, io.Closer, error) {
+	key, err := parseKey(keyHex)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	fw, err := parse(path)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	device, err := openDevice(ctx, spec)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	prog, err := bootloader.NewProgrammer(device, opts...)
+	if err != nil {
+		device.Close()
+		return nil, nil, nil, nil, &codeError{code: codeArg, err: err}
+	}
+	return prog, fw, key, device, nil
+}
+
+// program programs the file at path into the device.
+func program(ctx context.Context, spec, path, keyHex string, progress bootloader.ProgressCallback) error {
+	var opts []bootloader.Option
+	if progress != nil {
+		opts = append(opts, bootloader.WithProgressCallback(progress))
+	}
+	prog, fw, key, device, err := session(ctx, spec, path, keyHex, opts...)
+	if err != nil {
+		return err
+	}
+	defer device.Close()
+
+	return prog.Program(ctx, fw, key)
+}
+
+// verify compares the file at path with the device flash using row
+// checksums, then checks the application checksum.
+func verify(ctx context.Context, spec, path, keyHex string) error {
+	prog, fw, key, device, err := session(ctx, spec, path, keyHex)
+	if err != nil {
+		return err
+	}
+	defer device.Close()
+
+	if _, err := prog.Connect(ctx, key); err != nil {
+		return err
+	}
+	defer prog.Close(context.WithoutCancel(ctx))
+
+	for _, row := range fw.Rows {
+		checksum, err := prog.VerifyRow(ctx, row.ArrayID, row.RowNum)
+		var protoErr *protocol.ProtocolError
+		if errors.As(err, &protoErr) {
+			return &codeError{code: codeVerify, err: fmt.Errorf("row %d (array %d): %w", row.RowNum, row.ArrayID, err)}
+		}
+		if err != nil {
+			return err
+		}
+		expected := protocol.CalculateRowChecksumWithMetadata(row.Checksum, row.ArrayID, row.RowNum, uint16(len(row.Data)))
+		if checksum != expected {
+			return &codeError{code: codeVerify, err: &bootloader.ChecksumMismatchError{RowNum: row.RowNum, Expected: expected, Actual: checksum}}
+		}
+	}
+
+	valid, err := prog.VerifyChecksum(ctx)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return &codeError{code: codeVerify, err: &bootloader.VerificationError{Reason: "application checksum invalid"}}
+	}
+	return nil
+}
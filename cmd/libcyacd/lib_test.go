@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// writeFirmware writes a .cyacd file with one 64-byte row and returns its
+// path. The header bytes of row 0x00C0 sum to zero, so the file checksum
+// matches the one the simulated device computes.
+func writeFirmware(t *testing.T) string {
+	t.Helper()
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID, Rows: []*cyacd.Row{cyacd.NewRow(0, 0x00C0, data)}}
+
+	path := filepath.Join(t.TempDir(), "app.cyacd")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := fw.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func code(err error) int {
+	var codeErr *codeError
+	if errors.As(err, &codeErr) {
+		return codeErr.code
+	}
+	if err != nil {
+		return codeProgram
+	}
+	return 0
+}
+
+func TestProgram(t *testing.T) {
+	path := writeFirmware(t)
+	ctx := context.Background()
+
+	var phases []bootloader.Phase
+	err := program(ctx, "mock", path, "0a:1b:2c:3d:4e:5f", func(p bootloader.Progress) { phases = append(phases, p.Phase) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(phases) == 0 || phases[len(phases)-1] != bootloader.PhaseComplete {
+		t.Errorf("progress phases %v", phases)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"bad key", program(ctx, "mock", path, "0A1B", nil), codeArg},
+		{"empty key", program(ctx, "mock", path, "", nil), codeArg},
+		{"no key", program(ctx, "mock", path, "none", nil), 0},
+		{"missing file", program(ctx, "mock", filepath.Join(t.TempDir(), "none.cyacd"), "0A1B2C3D4E5F", nil), codeFile},
+		{"missing device", program(ctx, filepath.Join(t.TempDir(), "tty"), path, "0A1B2C3D4E5F", nil), codeDevice},
+		// Every mock call gets a fresh device with empty flash
+		{"verify empty flash", verify(ctx, "mock", path, "0A1B2C3D4E5F"), codeVerify},
+	}
+	for _, tt := range tests {
+		if got := code(tt.err); got != tt.want {
+			t.Errorf("%s: code %d (%v), want %d", tt.name, got, tt.err, tt.want)
+		}
+	}
+}
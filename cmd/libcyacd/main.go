@@ -0,0 +1,155 @@
+// Command libcyacd builds a C shared library for parsing firmware files and
+// programming devices, for C, C++, LabVIEW, and other software that can call
+// a C ABI:
+//
+//	go build -buildmode=c-shared -o libcyacd.so ./cmd/libcyacd
+//
+// The build also writes libcyacd.h, which declares:
+//
+//	int cyacd_parse(const char* path, cyacd_info* info);
+//	int cyacd_program(const char* device, const char* path, const char* key,
+//	                  cyacd_progress_fn progress, void* user);
+//	int cyacd_verify(const char* device, const char* path, const char* key);
+//	const char* cyacd_last_error(void);
+//
+// device is a device node (/dev/ttyACM0, /dev/hidraw0, COM3), tcp://host:port,
+// or mock for a simulated bootloader. key is the bootloader key as 12 hex
+// digits, optionally with a 0x prefix and ':', '-', or ' ' separators, or
+// "none" for a bootloader built without a key. The functions return CYACD_OK or a negative CYACD_ERR_* code;
+// cyacd_last_error describes the last failure of the calling process. The
+// progress callback, which may be NULL, is called on the calling thread.
+//
+// Example (C):
+//
+//	static void progress(const char* phase, double percent, int row, int rows, void* user) {
+//	    printf("\r%-12s %5.1f%%", phase, percent);
+//	}
+//
+//	if (cyacd_program("/dev/ttyACM0", "app.cyacd", "0A1B2C3D4E5F", progress, NULL) != CYACD_OK) {
+//	    fprintf(stderr, "program: %s\n", cyacd_last_error());
+//	}
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// Return codes.
+enum {
+	CYACD_OK          = 0,
+	CYACD_ERR_ARG     = -1, // invalid argument, such as a malformed key
+	CYACD_ERR_FILE    = -2, // the firmware file could not be read or parsed
+	CYACD_ERR_DEVICE  = -3, // the device could not be opened
+	CYACD_ERR_PROGRAM = -4, // the bootloader operation failed
+	CYACD_ERR_VERIFY  = -5, // the device flash differs from the file
+};
+
+// cyacd_info describes a parsed .cyacd file.
+typedef struct {
+	uint32_t silicon_id;
+	uint8_t  silicon_rev;
+	uint8_t  checksum_type;
+	int32_t  rows;
+	int32_t  bytes;
+} cyacd_info;
+
+// cyacd_progress_fn receives progress reports of cyacd_program.
+typedef void (*cyacd_progress_fn)(const char* phase, double percent, int row, int rows, void* user);
+
+static inline void cyacd_call_progress(cyacd_progress_fn fn, const char* phase, double percent, int row, int rows, void* user) {
+	fn(phase, percent, row, rows, user);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"unsafe"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+)
+
+// lastError holds the message returned by cyacd_last_error, allocated in C
+// so it stays valid after the call returns.
+var lastError struct {
+	sync.Mutex
+	msg *C.char
+}
+
+// result records err and returns its code.
+func result(err error) C.int {
+	lastError.Lock()
+	defer lastError.Unlock()
+	if lastError.msg != nil {
+		C.free(unsafe.Pointer(lastError.msg))
+		lastError.msg = nil
+	}
+	if err == nil {
+		return C.CYACD_OK
+	}
+	lastError.msg = C.CString(err.Error())
+
+	var codeErr *codeError
+	if errors.As(err, &codeErr) {
+		return C.int(codeErr.code)
+	}
+	return C.CYACD_ERR_PROGRAM
+}
+
+//export cyacd_last_error
+func cyacd_last_error() *C.char {
+	lastError.Lock()
+	defer lastError.Unlock()
+	return lastError.msg
+}
+
+//export cyacd_parse
+func cyacd_parse(path *C.char, info *C.cyacd_info) C.int {
+	if path == nil || info == nil {
+		return result(argError("path and info must not be NULL"))
+	}
+	fw, err := parse(C.GoString(path))
+	if err != nil {
+		return result(err)
+	}
+
+	info.silicon_id = C.uint32_t(fw.SiliconID)
+	info.silicon_rev = C.uint8_t(fw.SiliconRev)
+	info.checksum_type = C.uint8_t(fw.ChecksumType)
+	info.rows = C.int32_t(len(fw.Rows))
+	bytes := 0
+	for _, row := range fw.Rows {
+		bytes += len(row.Data)
+	}
+	info.bytes = C.int32_t(bytes)
+	return result(nil)
+}
+
+//export cyacd_program
+func cyacd_program(device, path, key *C.char, progress C.cyacd_progress_fn, user unsafe.Pointer) C.int {
+	if device == nil || path == nil || key == nil {
+		return result(argError("device, path, and key must not be NULL"))
+	}
+
+	var callback bootloader.ProgressCallback
+	if progress != nil {
+		callback = func(p bootloader.Progress) {
+			phase := C.CString(string(p.Phase))
+			defer C.free(unsafe.Pointer(phase))
+			C.cyacd_call_progress(progress, phase, C.double(p.Percentage), C.int(p.CurrentRow), C.int(p.TotalRows), user)
+		}
+	}
+	return result(program(context.Background(), C.GoString(device), C.GoString(path), C.GoString(key), callback))
+}
+
+//export cyacd_verify
+func cyacd_verify(device, path, key *C.char) C.int {
+	if device == nil || path == nil || key == nil {
+		return result(argError("device, path, and key must not be NULL"))
+	}
+	return result(verify(context.Background(), C.GoString(device), C.GoString(path), C.GoString(key)))
+}
+
+func main() {}
@@ -0,0 +1,365 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// DefaultRowSize is the row size used without Options.RowSize, that of
+// PSoC 4 flash.
+const DefaultRowSize = 128
+
+// unassignedCommand is a command code in the range of the v1 protocol that
+// no bootloader implements.
+const unassignedCommand = 0x3F
+
+// Check names, in the order Run performs them.
+const (
+	CheckEnter            = "enter bootloader"
+	CheckFlashSize        = "flash size"
+	CheckAppChecksum      = "application checksum"
+	CheckUnknownCommand   = "unknown command"
+	CheckRowOutOfRange    = "row out of range"
+	CheckEraseRow         = "erase row"
+	CheckProgramAndVerify = "program and verify row"
+	CheckExit             = "exit bootloader"
+)
+
+// Options configures Run.
+type Options struct {
+	// Key is the bootloader key, or protocol.NoKey for a bootloader
+	// built without one. It is required.
+	Key []byte
+
+	// ArrayID is the flash array of the scratch row. Default is 0.
+	ArrayID byte
+
+	// ScratchRow is the row erased and programmed by the checks. Default
+	// (0) is the last row of the array's flash range.
+	ScratchRow uint16
+
+	// RowSize is the flash row size of the device in bytes.
+	// Default is DefaultRowSize (128).
+	RowSize int
+
+	// ChecksumType is the packet checksum type of the bootloader
+	// (protocol.ChecksumBasicSum or protocol.ChecksumCRC16). Default is the
+	// basic sum.
+	ChecksumType byte
+
+	// ProgrammerOptions are applied to the Programmer running the checks,
+	// e.g. a transport profile or a logger
+	ProgrammerOptions []bootloader.Option
+}
+
+// Status is the outcome of a check.
+type Status int
+
+// Check outcomes.
+const (
+	// Pass means the bootloader behaved as the library expects
+	Pass Status = iota
+
+	// Fail means it did not; Result.Err says how
+	Fail
+
+	// Skip means the check could not run, e.g. because the bootloader
+	// could not be entered
+	Skip
+)
+
+// String returns "pass", "fail", or "skip".
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "pass"
+	case Fail:
+		return "fail"
+	case Skip:
+		return "skip"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	// Name is the check, one of the Check constants
+	Name string
+
+	// Status is the outcome
+	Status Status
+
+	// Detail describes what was observed, e.g. the reported flash range
+	Detail string
+
+	// Err is why the check failed or was skipped (nil if it passed)
+	Err error
+
+	// Duration is how long the check took
+	Duration time.Duration
+}
+
+// Report is the outcome of a conformance run. Returned by Run.
+type Report struct {
+	// DeviceInfo is the identification returned by Enter Bootloader (nil if
+	// the bootloader could not be entered)
+	DeviceInfo *protocol.DeviceInfo
+
+	// Results holds the result of every check, in the order they ran
+	Results []Result
+
+	// Duration is the time the whole run took
+	Duration time.Duration
+}
+
+// Passed reports whether no check failed or was skipped.
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Status != Pass {
+			return false
+		}
+	}
+	return len(r.Results) > 0
+}
+
+// Result returns the result of the named check, if it ran.
+func (r *Report) Result(name string) (Result, bool) {
+	for _, res := range r.Results {
+		if res.Name == name {
+			return res, true
+		}
+	}
+	return Result{}, false
+}
+
+// WriteText writes the report as a table with one line per check.
+func (r *Report) WriteText(w io.Writer) error {
+	if info := r.DeviceInfo; info != nil {
+		if _, err := fmt.Fprintf(w, "device: silicon ID 0x%08X, revision 0x%02X, bootloader %d.%d.%d\n",
+			info.SiliconID, info.SiliconRev, info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2]); err != nil {
+			return err
+		}
+	}
+	passed := 0
+	for _, res := range r.Results {
+		line := fmt.Sprintf("%-4s  %-24s %8s", res.Status, res.Name, res.Duration.Round(time.Millisecond))
+		if res.Detail != "" {
+			line += "  " + res.Detail
+		}
+		if res.Err != nil {
+			line += "  error: " + res.Err.Error()
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if res.Status == Pass {
+			passed++
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d of %d checks passed\n", passed, len(r.Results))
+	return err
+}
+
+// Run performs the checks against the bootloader behind device and returns
+// the report. Checks that fail do not stop the run, but once the bootloader
+// cannot be entered or its flash range is unknown, the checks that depend on
+// it are skipped. The returned error is only for invalid options; the
+// outcome of the checks is in the report.
+func Run(ctx context.Context, device io.ReadWriter, opts Options) (*Report, error) {
+	if err := protocol.ValidateKey(opts.Key); err != nil {
+		return nil, err
+	}
+	if opts.RowSize == 0 {
+		opts.RowSize = DefaultRowSize
+	}
+	if opts.RowSize < 0 || opts.RowSize > protocol.MaxDataSize {
+		return nil, fmt.Errorf("invalid row size %d", opts.RowSize)
+	}
+	progOpts := append([]bootloader.Option{
+		bootloader.WithChecksumType(opts.ChecksumType),
+		bootloader.WithVerifyAfterProgram(false),
+		bootloader.WithSkipAppVerify(),
+	}, opts.ProgrammerOptions...)
+	prog, err := bootloader.NewProgrammer(device, progOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &runner{ctx: ctx, prog: prog, opts: opts, report: &Report{}}
+	start := time.Now()
+	r.run()
+	r.report.Duration = time.Since(start)
+	return r.report, nil
+}
+
+// runner holds the state shared by the checks of one run.
+type runner struct {
+	ctx    context.Context
+	prog   *bootloader.Programmer
+	opts   Options
+	report *Report
+
+	// flashSize is the range reported by Get Flash Size (nil if unknown)
+	flashSize *protocol.FlashSize
+}
+
+// errSkipped is the reason checks are skipped after an earlier failure.
+var errSkipped = errors.New("skipped after an earlier failure")
+
+// check runs fn as the named check, or skips it if ok is false.
+func (r *runner) check(name string, ok bool, fn func() (string, error)) bool {
+	res := Result{Name: name}
+	if !ok {
+		res.Status, res.Err = Skip, errSkipped
+		r.report.Results = append(r.report.Results, res)
+		return false
+	}
+	start := time.Now()
+	res.Detail, res.Err = fn()
+	res.Duration = time.Since(start)
+	if res.Err != nil {
+		res.Status = Fail
+	}
+	r.report.Results = append(r.report.Results, res)
+	return res.Err == nil
+}
+
+func (r *runner) run() {
+	entered := r.check(CheckEnter, true, r.enter)
+	sized := r.check(CheckFlashSize, entered, r.checkFlashSize)
+	r.check(CheckAppChecksum, entered, r.checkAppChecksum)
+	r.check(CheckUnknownCommand, entered, r.checkUnknownCommand)
+	r.check(CheckRowOutOfRange, sized, r.checkRowOutOfRange)
+	r.check(CheckEraseRow, sized, r.checkEraseRow)
+	r.check(CheckProgramAndVerify, sized, r.checkProgramAndVerify)
+	r.check(CheckExit, entered, func() (string, error) {
+		return "", r.prog.Close(r.ctx)
+	})
+}
+
+func (r *runner) enter() (string, error) {
+	info, err := r.prog.Connect(r.ctx, r.opts.Key)
+	if err != nil {
+		return "", err
+	}
+	r.report.DeviceInfo = info
+	return fmt.Sprintf("silicon ID 0x%08X, revision 0x%02X", info.SiliconID, info.SiliconRev), nil
+}
+
+func (r *runner) checkFlashSize() (string, error) {
+	fs, err := r.prog.GetFlashSize(r.ctx, r.opts.ArrayID)
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("array %d, rows %d-%d", r.opts.ArrayID, fs.StartRow, fs.EndRow)
+	if fs.StartRow > fs.EndRow {
+		return detail, fmt.Errorf("first row %d is after last row %d", fs.StartRow, fs.EndRow)
+	}
+	if r.opts.ScratchRow == 0 {
+		r.opts.ScratchRow = fs.EndRow
+	}
+	if r.opts.ScratchRow < fs.StartRow || r.opts.ScratchRow > fs.EndRow {
+		return detail, fmt.Errorf("scratch row %d is outside the flash range", r.opts.ScratchRow)
+	}
+	r.flashSize = fs
+	return detail, nil
+}
+
+func (r *runner) checkAppChecksum() (string, error) {
+	valid, err := r.prog.VerifyChecksum(r.ctx)
+	switch {
+	case errors.Is(err, bootloader.ErrVerification):
+		return "application invalid", nil
+	case err != nil:
+		return "", err
+	case valid:
+		return "application valid", nil
+	default:
+		return "application invalid", nil
+	}
+}
+
+func (r *runner) checkUnknownCommand() (string, error) {
+	status, _, err := r.prog.SendCommand(r.ctx, unassignedCommand, nil)
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("command 0x%02X: status 0x%02X", unassignedCommand, status)
+	if status != protocol.ErrCommand {
+		return detail, fmt.Errorf("want ERR_CMD (0x%02X)", protocol.ErrCommand)
+	}
+	return detail, nil
+}
+
+func (r *runner) checkRowOutOfRange() (string, error) {
+	if r.flashSize.EndRow == 0xFFFF {
+		return "flash range ends at the last row number", nil
+	}
+	row := r.flashSize.EndRow + 1
+	_, err := r.prog.VerifyRow(r.ctx, r.opts.ArrayID, row)
+	var protoErr *protocol.ProtocolError
+	if errors.As(err, &protoErr) {
+		return fmt.Sprintf("row %d: status 0x%02X", row, protoErr.StatusCode), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("Verify Row of row %d succeeded", row)
+}
+
+func (r *runner) checkEraseRow() (string, error) {
+	return fmt.Sprintf("row %d", r.opts.ScratchRow), r.prog.EraseRow(r.ctx, r.opts.ArrayID, r.opts.ScratchRow)
+}
+
+func (r *runner) checkProgramAndVerify() (string, error) {
+	first, err := r.programPattern(0x00)
+	if err != nil {
+		return "", err
+	}
+	second, err := r.programPattern(0xFF)
+	if err != nil {
+		return "", err
+	}
+	again, err := r.programPattern(0x00)
+	if err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("row %d: checksums 0x%02X, 0x%02X, 0x%02X", r.opts.ScratchRow, first, second, again)
+	switch {
+	case first == second:
+		return detail, errors.New("different data reads back with the same checksum")
+	case first != again:
+		return detail, errors.New("the same data reads back with a different checksum")
+	}
+	return detail, r.prog.EraseRow(r.ctx, r.opts.ArrayID, r.opts.ScratchRow)
+}
+
+// programPattern programs the scratch row with a counting pattern that starts
+// with first and returns the checksum the bootloader reports for it. The row
+// checksum is a byte sum, so patterns differing in one byte never collide.
+func (r *runner) programPattern(first byte) (byte, error) {
+	data := make([]byte, r.opts.RowSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	data[0] = first
+	fw := &cyacd.Firmware{
+		SiliconID:    r.report.DeviceInfo.SiliconID,
+		SiliconRev:   r.report.DeviceInfo.SiliconRev,
+		ChecksumType: r.opts.ChecksumType,
+		Rows:         []*cyacd.Row{cyacd.NewRow(r.opts.ArrayID, r.opts.ScratchRow, data)},
+	}
+	if err := r.prog.Program(r.ctx, fw, r.opts.Key); err != nil {
+		return 0, err
+	}
+	return r.prog.VerifyRow(r.ctx, r.opts.ArrayID, r.opts.ScratchRow)
+}
@@ -0,0 +1,64 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestRun(t *testing.T) {
+	device := bootloadertest.NewDevice()
+	report, err := Run(context.Background(), device, Options{Key: []byte(protocol.DefaultExampleKey), RowSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed() {
+		t.Fatalf("conformance failed:\n%s", buf.String())
+	}
+	if len(report.Results) != 8 || report.DeviceInfo == nil || report.DeviceInfo.SiliconID != bootloadertest.DefaultSiliconID {
+		t.Errorf("report:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "8 of 8 checks passed") {
+		t.Errorf("text report:\n%s", buf.String())
+	}
+	if cmds := device.Commands(); cmds[len(cmds)-1] != protocol.CmdExitBootloader {
+		t.Errorf("last command 0x%02X, want Exit Bootloader", cmds[len(cmds)-1])
+	}
+}
+
+func TestRunWrongKey(t *testing.T) {
+	device := bootloadertest.NewDevice(bootloadertest.WithKey([]byte{1, 2, 3, 4, 5, 6}))
+	report, err := Run(context.Background(), device, Options{Key: []byte(protocol.DefaultExampleKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed() {
+		t.Fatal("conformance passed with the wrong key")
+	}
+	if res, _ := report.Result(CheckEnter); res.Status != Fail {
+		t.Errorf("%s: %s", CheckEnter, res.Status)
+	}
+	for _, res := range report.Results[1:] {
+		if res.Status != Skip || !errors.Is(res.Err, errSkipped) {
+			t.Errorf("%s: %s (%v)", res.Name, res.Status, res.Err)
+		}
+	}
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	if _, err := Run(context.Background(), bootloadertest.NewDevice(), Options{RowSize: protocol.MaxDataSize + 1}); err == nil {
+		t.Error("row size over the maximum accepted")
+	}
+	if _, err := Run(context.Background(), bootloadertest.NewDevice(), Options{Key: []byte{1}}); err == nil {
+		t.Error("short key accepted")
+	}
+}
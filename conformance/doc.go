@@ -0,0 +1,34 @@
+// Package conformance qualifies a bootloader build against this library. Run
+// drives a connected device through a scripted battery of checks and returns
+// a pass/fail report:
+//
+//   - enter bootloader: Enter Bootloader succeeds and identifies the device
+//   - flash size: Get Flash Size reports a sane range holding the scratch row
+//   - application checksum: Verify Checksum answers
+//   - unknown command: an unassigned command code fails with ERR_CMD
+//   - row out of range: Verify Row of the row after the range fails with a
+//     bootloader error status
+//   - erase row: the scratch row can be erased
+//   - program and verify row: two patterns programmed into the scratch row
+//     read back with distinct checksums, and reprogramming the first
+//     reproduces its checksum
+//   - exit bootloader: Exit Bootloader is accepted
+//
+// The checks erase and program the scratch row, so the application on the
+// device is no longer valid afterwards: run them on a bench unit and program
+// the application again when done.
+//
+// Example:
+//
+//	report, err := conformance.Run(ctx, port, conformance.Options{
+//	    Key:     []byte(protocol.DefaultExampleKey),
+//	    RowSize: 128,
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	report.WriteText(os.Stdout)
+//	if !report.Passed() {
+//	    os.Exit(1)
+//	}
+package conformance
@@ -0,0 +1,255 @@
+package cyacd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Constants for CYACD2 file format parsing.
+const (
+	// Header2Length is the expected length of the .cyacd2 header line in hex characters
+	Header2Length = 24
+
+	// Row2AddressSize is the size of the address field of a .cyacd2 data row
+	Row2AddressSize = 4
+
+	// FileVersion2 is the .cyacd2 file format version supported by Parse2
+	FileVersion2 = 0x01
+)
+
+// Firmware2 represents a complete parsed .cyacd2 firmware file, the image format
+// of bootloader SDK v2.x (PSoC 6 and later PSoC 4 devices). Unlike .cyacd, rows
+// are addressed by flash address and images may be encrypted.
+type Firmware2 struct {
+	// FileVersion is the .cyacd2 file format version
+	FileVersion byte
+
+	// SiliconID is the device silicon ID (4 bytes)
+	SiliconID uint32
+
+	// SiliconRev is the silicon revision (1 byte)
+	SiliconRev byte
+
+	// ChecksumType is the packet checksum type of the bootloader:
+	//   0x00 = Basic summation
+	//   0x01 = CRC-16-CCITT
+	ChecksumType byte
+
+	// AppID is the application slot the image is built for
+	AppID byte
+
+	// ProductID identifies the product; the bootloader rejects images
+	// built for a different product
+	ProductID uint32
+
+	// AppStart and AppLength are the flash region of the application (@APPINFO)
+	AppStart  uint32
+	AppLength uint32
+
+	// EIV is the encryption initialization vector (@EIV).
+	// Empty for unencrypted images.
+	EIV []byte
+
+	// Rows contains all data rows to be programmed
+	Rows []*Row2
+}
+
+// Encrypted reports whether the image row data is encrypted,
+// i.e. whether the file carries an initialization vector.
+func (f *Firmware2) Encrypted() bool {
+	return len(f.EIV) > 0
+}
+
+// Row2 represents a single data row from the .cyacd2 file.
+type Row2 struct {
+	// Address is the flash address of the row
+	Address uint32
+
+	// Data is the row data to be programmed (encrypted for encrypted images)
+	Data []byte
+}
+
+// Parse2 parses a .cyacd2 file from the given file path.
+//
+// Example:
+//
+//	fw, err := cyacd.Parse2("firmware.cyacd2")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Encrypted: %t\n", fw.Encrypted())
+func Parse2(path string) (*Firmware2, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return ParseReader2(f)
+}
+
+// IsCyacd2 reports whether an image is a .cyacd2 file rather than a .cyacd
+// file. name, a file name or URL, decides by its extension; without a known
+// extension (or with an empty name), data decides by the length of its header
+// line, which is longer than the HeaderLength hex characters of .cyacd.
+//
+// Example:
+//
+//	if cyacd.IsCyacd2(upload.Filename, data) {
+//	    fw2, err = cyacd.ParseReader2(bytes.NewReader(data))
+//	} else {
+//	    fw, err = cyacd.ParseReader(bytes.NewReader(data))
+//	}
+func IsCyacd2(name string, data []byte) bool {
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	if ext := strings.ToLower(path.Ext(name)); ext == ".cyacd2" || ext == ".cyacd" {
+		return ext == ".cyacd2"
+	}
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	return len(bytes.TrimSpace(header)) > HeaderLength
+}
+
+// ParseReader2 parses a .cyacd2 file from any io.Reader.
+func ParseReader2(r io.Reader) (*Firmware2, error) {
+	scanner := bufio.NewScanner(r)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		return nil, fmt.Errorf("empty file")
+	}
+
+	fw, err := parseHeader2(strings.TrimSpace(scanner.Text()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+
+	lineNum := 1
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "@APPINFO:"):
+			err = parseAppInfo(fw, strings.TrimPrefix(line, "@APPINFO:"))
+		case strings.HasPrefix(line, "@EIV:"):
+			fw.EIV, err = hex.DecodeString(strings.TrimPrefix(line, "@EIV:"))
+		case line[0] == ':':
+			var row *Row2
+			row, err = parseRow2(line[1:])
+			if err == nil {
+				fw.Rows = append(fw.Rows, row)
+			}
+		default:
+			err = fmt.Errorf("unrecognized line")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if len(fw.Rows) == 0 {
+		return nil, fmt.Errorf("no rows found in file")
+	}
+
+	return fw, nil
+}
+
+// parseHeader2 parses the .cyacd2 file header.
+//
+// Header format (24 hex characters):
+//
+//	[FileVersion(1)][SiliconID(4)][SiliconRev(1)][ChecksumType(1)][AppID(1)][ProductID(4)]
+//
+// SiliconID and ProductID are little-endian.
+func parseHeader2(line string) (*Firmware2, error) {
+	if len(line) != Header2Length {
+		return nil, fmt.Errorf("invalid header length: got %d characters, expected %d", len(line), Header2Length)
+	}
+
+	data, err := hex.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %w", err)
+	}
+
+	fw := &Firmware2{
+		FileVersion:  data[0],
+		SiliconID:    binary.LittleEndian.Uint32(data[1:5]),
+		SiliconRev:   data[5],
+		ChecksumType: data[6],
+		AppID:        data[7],
+		ProductID:    binary.LittleEndian.Uint32(data[8:12]),
+		Rows:         make([]*Row2, 0, DefaultRowCapacity),
+	}
+
+	if fw.FileVersion != FileVersion2 {
+		return nil, fmt.Errorf("unsupported file version: 0x%02X", fw.FileVersion)
+	}
+
+	if fw.ChecksumType != 0x00 && fw.ChecksumType != 0x01 {
+		return nil, fmt.Errorf("invalid checksum type: 0x%02X (must be 0x00 or 0x01)", fw.ChecksumType)
+	}
+
+	return fw, nil
+}
+
+// parseAppInfo parses the value of an @APPINFO line: "<start>,<length>",
+// both hex with a 0x prefix or decimal.
+func parseAppInfo(fw *Firmware2, value string) error {
+	start, length, ok := strings.Cut(value, ",")
+	if !ok {
+		return fmt.Errorf("invalid @APPINFO: %q", value)
+	}
+
+	s, err := strconv.ParseUint(strings.TrimSpace(start), 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid @APPINFO start: %w", err)
+	}
+	l, err := strconv.ParseUint(strings.TrimSpace(length), 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid @APPINFO length: %w", err)
+	}
+
+	fw.AppStart = uint32(s)
+	fw.AppLength = uint32(l)
+	return nil
+}
+
+// parseRow2 parses a .cyacd2 data row (without the leading ':').
+//
+// Row format:
+//
+//	[Address(4 bytes, little-endian)][Data(N bytes)]
+func parseRow2(line string) (*Row2, error) {
+	data, err := hex.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %w", err)
+	}
+
+	if len(data) <= Row2AddressSize {
+		return nil, fmt.Errorf("row too short: %d bytes", len(data))
+	}
+
+	return &Row2{
+		Address: binary.LittleEndian.Uint32(data[:Row2AddressSize]),
+		Data:    data[Row2AddressSize:],
+	}, nil
+}
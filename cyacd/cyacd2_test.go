@@ -0,0 +1,107 @@
+package cyacd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseReader2(t *testing.T) {
+	input := "01AA02961E00000100112233\n" +
+		"@APPINFO:0x10000000,0x8000\n" +
+		"@EIV:000102030405060708090A0B0C0D0E0F\n" +
+		":00000010DEADBEEF\n" +
+		":80000010CAFE\n"
+
+	fw, err := ParseReader2(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fw.SiliconID != 0x1E9602AA || fw.SiliconRev != 0x00 || fw.ChecksumType != 0x00 {
+		t.Errorf("header = 0x%08X/0x%02X/0x%02X", fw.SiliconID, fw.SiliconRev, fw.ChecksumType)
+	}
+	if fw.AppID != 0x01 || fw.ProductID != 0x33221100 {
+		t.Errorf("AppID = %d, ProductID = 0x%08X", fw.AppID, fw.ProductID)
+	}
+	if fw.AppStart != 0x10000000 || fw.AppLength != 0x8000 {
+		t.Errorf("APPINFO = 0x%08X,0x%X", fw.AppStart, fw.AppLength)
+	}
+	if !fw.Encrypted() || len(fw.EIV) != 16 {
+		t.Errorf("EIV = % 02X, want 16 bytes", fw.EIV)
+	}
+
+	if len(fw.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(fw.Rows))
+	}
+	if fw.Rows[0].Address != 0x10000000 || !bytes.Equal(fw.Rows[0].Data, []byte{0xDE, 0xAD, 0xBE, 0xEF}) {
+		t.Errorf("row 0 = 0x%08X % 02X", fw.Rows[0].Address, fw.Rows[0].Data)
+	}
+	if fw.Rows[1].Address != 0x10000080 {
+		t.Errorf("row 1 address = 0x%08X, want 0x10000080", fw.Rows[1].Address)
+	}
+}
+
+func TestParseReader2Unencrypted(t *testing.T) {
+	input := "01AA02961E00000000000000\n" +
+		"@APPINFO:0x10000000,0x100\n" +
+		"@EIV:\n" +
+		":0000001001\n"
+
+	fw, err := ParseReader2(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fw.Encrypted() {
+		t.Error("image with empty @EIV reported as encrypted")
+	}
+}
+
+func TestParseReader2Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		errMsg string
+	}{
+		{"empty file", "", "empty file"},
+		{"short header", "01AA02961E\n", "invalid header length"},
+		{"bad version", "02AA02961E00000000000000\n:0000001001\n", "unsupported file version"},
+		{"bad checksum type", "01AA02961E00050000000000\n:0000001001\n", "invalid checksum type"},
+		{"bad appinfo", "01AA02961E00000000000000\n@APPINFO:0x10000000\n", "line 2: invalid @APPINFO"},
+		{"short row", "01AA02961E00000000000000\n:00000010\n", "line 2: row too short"},
+		{"unknown line", "01AA02961E00000000000000\n0000001001\n", "line 2: unrecognized line"},
+		{"no rows", "01AA02961E00000000000000\n@APPINFO:0,0\n", "no rows found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseReader2(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("error = %v, want containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestIsCyacd2(t *testing.T) {
+	v1 := []byte("1E9602AA0000\r\n:0000000040...\r\n")
+	v2 := []byte("01AA02961E00000100112233\n:00000010...\n")
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"app.cyacd2", v1, true},
+		{"APP.CYACD", v2, false},
+		{"https://updates.example.com/app.cyacd2?token=x", v1, true},
+		{"upload.bin", v2, true},
+		{"", v1, false},
+		{"", v2, true},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsCyacd2(tt.name, tt.data); got != tt.want {
+			t.Errorf("IsCyacd2(%q, %.12q) = %t, want %t", tt.name, tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cyacd
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Change is the kind of difference between a row of two firmware images.
+type Change int
+
+const (
+	// RowChanged marks a row present in both images with different data.
+	RowChanged Change = iota
+
+	// RowAdded marks a row present only in the second image.
+	RowAdded
+
+	// RowRemoved marks a row present only in the first image.
+	RowRemoved
+)
+
+// String returns "changed", "added", or "removed".
+func (c Change) String() string {
+	switch c {
+	case RowChanged:
+		return "changed"
+	case RowAdded:
+		return "added"
+	case RowRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// RowDiff is a row that differs between two firmware images.
+type RowDiff struct {
+	ArrayID byte
+	RowNum  uint16
+	Change  Change
+
+	// Old and New are the row in the first and second image; Old is nil
+	// for an added row and New is nil for a removed one.
+	Old, New *Row
+}
+
+// FirstDifference returns the offset of the first byte that differs between
+// the data of a changed row, or -1 for added and removed rows.
+func (d RowDiff) FirstDifference() int {
+	if d.Old == nil || d.New == nil {
+		return -1
+	}
+	n := len(d.Old.Data)
+	if len(d.New.Data) < n {
+		n = len(d.New.Data)
+	}
+	for i := 0; i < n; i++ {
+		if d.Old.Data[i] != d.New.Data[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// Diff compares the rows of a and b by array ID and row number and returns
+// the rows whose data differ, sorted by array ID and row number. Rows with
+// the same data are equal even if their checksums differ, since only the
+// data is programmed. The header fields are not compared.
+//
+// Example:
+//
+//	for _, d := range cyacd.Diff(old, new) {
+//	    fmt.Printf("row %d (array %d): %s\n", d.RowNum, d.ArrayID, d.Change)
+//	}
+func Diff(a, b *Firmware) []RowDiff {
+	type key struct {
+		array byte
+		row   uint16
+	}
+	oldRows := make(map[key]*Row, len(a.Rows))
+	for _, row := range a.Rows {
+		oldRows[key{row.ArrayID, row.RowNum}] = row
+	}
+
+	var diffs []RowDiff
+	seen := make(map[key]bool, len(b.Rows))
+	for _, row := range b.Rows {
+		k := key{row.ArrayID, row.RowNum}
+		seen[k] = true
+		old, ok := oldRows[k]
+		switch {
+		case !ok:
+			diffs = append(diffs, RowDiff{ArrayID: row.ArrayID, RowNum: row.RowNum, Change: RowAdded, New: row})
+		case !bytes.Equal(old.Data, row.Data):
+			diffs = append(diffs, RowDiff{ArrayID: row.ArrayID, RowNum: row.RowNum, Change: RowChanged, Old: old, New: row})
+		}
+	}
+	for _, row := range a.Rows {
+		if !seen[key{row.ArrayID, row.RowNum}] {
+			diffs = append(diffs, RowDiff{ArrayID: row.ArrayID, RowNum: row.RowNum, Change: RowRemoved, Old: row})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].ArrayID != diffs[j].ArrayID {
+			return diffs[i].ArrayID < diffs[j].ArrayID
+		}
+		return diffs[i].RowNum < diffs[j].RowNum
+	})
+	return diffs
+}
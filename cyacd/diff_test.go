@@ -0,0 +1,42 @@
+package cyacd
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	a := &Firmware{Rows: []*Row{
+		NewRow(0, 2, []byte{1, 2, 3, 4}),
+		NewRow(0, 1, []byte{1, 2, 3, 4}),
+		NewRow(1, 0, []byte{9, 9}),
+	}}
+	b := &Firmware{Rows: []*Row{
+		NewRow(0, 1, []byte{1, 2, 3, 4}),
+		NewRow(0, 2, []byte{1, 2, 7, 4}),
+		NewRow(0, 3, []byte{5}),
+	}}
+
+	diffs := Diff(a, b)
+	want := []struct {
+		array  byte
+		row    uint16
+		change Change
+		offset int
+	}{
+		{0, 2, RowChanged, 2},
+		{0, 3, RowAdded, -1},
+		{1, 0, RowRemoved, -1},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("got %d diffs, want %d: %+v", len(diffs), len(want), diffs)
+	}
+	for i, w := range want {
+		d := diffs[i]
+		if d.ArrayID != w.array || d.RowNum != w.row || d.Change != w.change || d.FirstDifference() != w.offset {
+			t.Errorf("diff %d = array %d row %d %s at %d, want array %d row %d %s at %d",
+				i, d.ArrayID, d.RowNum, d.Change, d.FirstDifference(), w.array, w.row, w.change, w.offset)
+		}
+	}
+
+	if diffs := Diff(a, a); len(diffs) != 0 {
+		t.Errorf("Diff(a, a) = %+v, want none", diffs)
+	}
+}
@@ -51,6 +51,76 @@
 //	data := strings.NewReader(cyacdContent)
 //	fw, err := cyacd.ParseReader(data)
 //
+// Large files can be parsed on several cores: ParseWithOptions and
+// ParseReaderWithOptions decode and verify row lines in parallel as set by
+// ParseOptions.Parallelism, with the same rows and errors as Parse:
+//
+//	fw, err := cyacd.ParseWithOptions(path, cyacd.ParseOptions{Parallelism: -1})
+//
+// # CYACD2 Files
+//
+// Images for bootloader SDK v2.x use the .cyacd2 format: a 12-byte header
+// (file version, silicon ID, revision, checksum type, application ID, product ID),
+// optional @APPINFO and @EIV lines, and data rows prefixed with ':' that carry a
+// 4-byte flash address followed by the row data. Parse2 and ParseReader2 read
+// them into a Firmware2; a non-empty @EIV marks the row data as encrypted:
+//
+//	fw, err := cyacd.Parse2("firmware.cyacd2")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Encrypted: %t\n", fw.Encrypted())
+//
+// # Importing and Writing
+//
+// ImportIntelHex and ImportSREC build a Firmware from a raw memory image,
+// splitting it into rows as described by ImportOptions, and Firmware.WriteTo
+// writes a Firmware in .cyacd format:
+//
+//	fw, err := cyacd.ImportIntelHex(f, cyacd.ImportOptions{SiliconID: 0x04C81193, RowSize: 128})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	_, err = fw.WriteTo(out)
+//
+// Firmware.ToFirmware2 upgrades a .cyacd image to a Firmware2, placing its
+// rows in flash as described by Firmware2Options, and Firmware2.WriteTo
+// writes a Firmware2 in .cyacd2 format with its @APPINFO and @EIV lines:
+//
+//	fw2, err := fw.ToFirmware2(cyacd.Firmware2Options{FlashBase: 0x10000000, ProductID: 0x01020304})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	_, err = fw2.WriteTo(out)
+//
+// Rechunk re-splits an image into rows of another size, for memory variants
+// with a different flash row size, padding or rejecting partly covered rows
+// as selected by RechunkOptions:
+//
+//	small, err := cyacd.Rechunk(fw, 128, cyacd.RechunkOptions{Fill: 0xFF})
+//
+// Firmware.Flatten returns the application region as one contiguous binary,
+// e.g. for hashing or external signing tools:
+//
+//	bin, err := fw.Flatten(0, 0x00)
+//
+// # Comparing
+//
+// Diff lists the rows that were changed, added, or removed between two
+// images, matched by array ID and row number:
+//
+//	for _, d := range cyacd.Diff(old, new) {
+//	    fmt.Printf("row %d (array %d): %s\n", d.RowNum, d.ArrayID, d.Change)
+//	}
+//
+// Firmware.Equal reports whether two images have the same contents, with
+// IgnoreRowOrder for images whose rows were reordered. Firmware.Clone returns
+// a deep copy that can be patched without changing the original:
+//
+//	patched := fw.Clone()
+//	patched.Rows[0].Data[4] = 0x01
+//	changed := !patched.Equal(fw) // true
+//
 // # Error Handling
 //
 // Parse returns detailed errors for invalid files:
@@ -1,5 +1,13 @@
 package cyacd
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+)
+
 // Firmware represents a complete parsed .cyacd firmware file.
 type Firmware struct {
 	// SiliconID is the device silicon ID (4 bytes)
@@ -35,3 +43,147 @@ type Row struct {
 	// Checksum is the row checksum (for validation)
 	Checksum byte
 }
+
+// Fingerprint returns a stable identifier of the firmware contents: the
+// hex-encoded SHA-256 of the header fields and every row (array ID, row
+// number, size, data, and checksum) in file order. Two images with the same
+// fingerprint program identical flash contents, regardless of how the files
+// were formatted.
+func (f *Firmware) Fingerprint() string {
+	h := sha256.New()
+	var buf [8]byte
+
+	binary.BigEndian.PutUint32(buf[:4], f.SiliconID)
+	buf[4] = f.SiliconRev
+	buf[5] = f.ChecksumType
+	h.Write(buf[:6])
+
+	for _, row := range f.Rows {
+		buf[0] = row.ArrayID
+		binary.BigEndian.PutUint16(buf[1:3], row.RowNum)
+		binary.BigEndian.PutUint16(buf[3:5], row.Size)
+		binary.BigEndian.PutUint16(buf[5:7], uint16(len(row.Data)))
+		h.Write(buf[:7])
+		h.Write(row.Data)
+		h.Write([]byte{row.Checksum})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EqualOption changes how Firmware.Equal compares two images.
+type EqualOption func(*equalConfig)
+
+type equalConfig struct {
+	ignoreRowOrder bool
+}
+
+// IgnoreRowOrder makes Equal compare the rows regardless of their order in
+// the images, e.g. for images rewritten with their rows sorted.
+func IgnoreRowOrder() EqualOption {
+	return func(c *equalConfig) {
+		c.ignoreRowOrder = true
+	}
+}
+
+// Equal reports whether f and other have the same contents: the same header
+// fields and the same rows (array ID, row number, size, data, and checksum),
+// in the same order unless IgnoreRowOrder is given. Like Fingerprint, it does
+// not depend on how the files were formatted.
+//
+// Example:
+//
+//	if !cached.Equal(fw, cyacd.IgnoreRowOrder()) {
+//	    // the image changed
+//	}
+func (f *Firmware) Equal(other *Firmware, opts ...EqualOption) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+	var c equalConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if f.SiliconID != other.SiliconID || f.SiliconRev != other.SiliconRev ||
+		f.ChecksumType != other.ChecksumType || len(f.Rows) != len(other.Rows) {
+		return false
+	}
+
+	a, b := f.Rows, other.Rows
+	if c.ignoreRowOrder {
+		a, b = sortedRows(a), sortedRows(b)
+	}
+	for i := range a {
+		if !a[i].equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a deep copy of the firmware, whose rows can be changed (e.g.
+// patched) without affecting f.
+//
+// Example:
+//
+//	patched := fw.Clone()
+//	patched.Rows[0].Data[4] = 0x01
+func (f *Firmware) Clone() *Firmware {
+	if f == nil {
+		return nil
+	}
+	clone := *f
+	if f.Rows != nil {
+		clone.Rows = make([]*Row, len(f.Rows))
+		for i, row := range f.Rows {
+			clone.Rows[i] = row.Clone()
+		}
+	}
+	return &clone
+}
+
+// Clone returns a deep copy of the row.
+func (r *Row) Clone() *Row {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	if r.Data != nil {
+		clone.Data = append([]byte{}, r.Data...)
+	}
+	return &clone
+}
+
+// equal reports whether two rows have the same contents.
+func (r *Row) equal(other *Row) bool {
+	if r == nil || other == nil {
+		return r == other
+	}
+	return r.ArrayID == other.ArrayID && r.RowNum == other.RowNum && r.Size == other.Size &&
+		r.Checksum == other.Checksum && bytes.Equal(r.Data, other.Data)
+}
+
+// sortedRows returns the rows sorted by array ID and row number, and by
+// contents for rows with the same address, so that equal sets of rows sort
+// identically.
+func sortedRows(rows []*Row) []*Row {
+	sorted := append([]*Row(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case a == nil || b == nil:
+			return a == nil && b != nil
+		case a.ArrayID != b.ArrayID:
+			return a.ArrayID < b.ArrayID
+		case a.RowNum != b.RowNum:
+			return a.RowNum < b.RowNum
+		case a.Size != b.Size:
+			return a.Size < b.Size
+		case a.Checksum != b.Checksum:
+			return a.Checksum < b.Checksum
+		}
+		return bytes.Compare(a.Data, b.Data) < 0
+	})
+	return sorted
+}
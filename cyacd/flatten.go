@@ -0,0 +1,59 @@
+package cyacd
+
+import "fmt"
+
+// maxFlattenSize limits the binary built by Flatten, so that an image with a
+// stray row far from the others fails instead of allocating gigabytes.
+const maxFlattenSize = 64 << 20
+
+// Flatten returns the application region of the firmware as one contiguous
+// binary, for hashing, comparing with the output of a linker, or feeding
+// external signing tools. Row N is placed at flash offset N times the row
+// size (the size of the first row); the binary starts at offset baseAddr and
+// ends with the last byte of the highest row. Bytes not covered by a row are
+// set to fill.
+//
+// Flatten needs an image of a single flash array with rows of equal size; a
+// row below baseAddr is an error.
+//
+// Example:
+//
+//	bin, err := fw.Flatten(0, 0x00)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("SHA-256: %x\n", sha256.Sum256(bin))
+func (f *Firmware) Flatten(baseAddr uint32, fill byte) ([]byte, error) {
+	if len(f.Rows) == 0 {
+		return nil, fmt.Errorf("firmware has no rows")
+	}
+
+	rowSize := len(f.Rows[0].Data)
+	arrayID := f.Rows[0].ArrayID
+	end := uint64(baseAddr)
+	for _, row := range f.Rows {
+		if row.ArrayID != arrayID {
+			return nil, fmt.Errorf("rows of arrays %d and %d: Flatten needs a single flash array", arrayID, row.ArrayID)
+		}
+		if len(row.Data) != rowSize {
+			return nil, fmt.Errorf("row %d: %d bytes, but the first row has %d", row.RowNum, len(row.Data), rowSize)
+		}
+		start := uint64(row.RowNum) * uint64(rowSize)
+		if start < uint64(baseAddr) {
+			return nil, fmt.Errorf("row %d at offset 0x%X is below the base address 0x%X", row.RowNum, start, baseAddr)
+		}
+		end = max(end, start+uint64(rowSize))
+	}
+	if end-uint64(baseAddr) > maxFlattenSize {
+		return nil, fmt.Errorf("flattened image of %d bytes exceeds %d bytes", end-uint64(baseAddr), maxFlattenSize)
+	}
+
+	bin := make([]byte, end-uint64(baseAddr))
+	for i := range bin {
+		bin[i] = fill
+	}
+	for _, row := range f.Rows {
+		copy(bin[uint64(row.RowNum)*uint64(rowSize)-uint64(baseAddr):], row.Data)
+	}
+	return bin, nil
+}
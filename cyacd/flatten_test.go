@@ -0,0 +1,34 @@
+package cyacd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	fw := &Firmware{Rows: []*Row{
+		NewRow(0, 2, []byte{0x01, 0x02}),
+		NewRow(0, 4, []byte{0x03, 0x04}),
+	}}
+
+	bin, err := fw.Flatten(4, 0xFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x01, 0x02, 0xFF, 0xFF, 0x03, 0x04}
+	if !bytes.Equal(bin, want) {
+		t.Errorf("Flatten(4) = % 02X, want % 02X", bin, want)
+	}
+
+	if bin, _ := fw.Flatten(0, 0x00); len(bin) != 10 || bin[0] != 0x00 {
+		t.Errorf("Flatten(0) = % 02X", bin)
+	}
+	if _, err := fw.Flatten(6, 0x00); err == nil {
+		t.Error("expected an error for a row below the base address")
+	}
+
+	fw.Rows = append(fw.Rows, NewRow(1, 0, []byte{0x05, 0x06}))
+	if _, err := fw.Flatten(0, 0x00); err == nil {
+		t.Error("expected an error for several flash arrays")
+	}
+}
@@ -0,0 +1,298 @@
+package cyacd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ImportOptions describes the device a raw memory image (Intel HEX or
+// Motorola S-record) is imported for. Those formats carry only addresses
+// and data, so the .cyacd header fields and the flash geometry must be
+// given here.
+type ImportOptions struct {
+	// SiliconID, SiliconRev, and ChecksumType become the .cyacd header
+	SiliconID    uint32
+	SiliconRev   byte
+	ChecksumType byte
+
+	// RowSize is the flash row size in bytes (e.g. 128 for most PSoC 4
+	// devices, 256 for PSoC 5LP). Required.
+	RowSize int
+
+	// RowsPerArray is the number of rows in each flash array. Row N of the
+	// image goes to array N / RowsPerArray. 0 puts all rows in array 0.
+	RowsPerArray int
+
+	// FlashBase is the address of the first byte of flash; data below it is
+	// an error. Default is 0.
+	FlashBase uint32
+
+	// FlashSize is the size of flash in bytes. Data at or beyond
+	// FlashBase+FlashSize, such as the checksum, protection, and metadata
+	// sections PSoC Creator places at 0x90000000 and above, is ignored.
+	// 0 imports all data.
+	FlashSize uint32
+
+	// Fill is the value of row bytes not covered by the image. Default is 0x00.
+	Fill byte
+}
+
+// image collects the data records of a memory image by flash row.
+type image struct {
+	opts ImportOptions
+	rows map[int][]byte
+}
+
+func newImage(opts ImportOptions) (*image, error) {
+	if opts.RowSize <= 0 {
+		return nil, fmt.Errorf("row size must be positive, got %d", opts.RowSize)
+	}
+	if opts.ChecksumType != 0x00 && opts.ChecksumType != 0x01 {
+		return nil, fmt.Errorf("invalid checksum type: 0x%02X (must be 0x00 or 0x01)", opts.ChecksumType)
+	}
+	return &image{opts: opts, rows: make(map[int][]byte)}, nil
+}
+
+// write stores data at addr.
+func (m *image) write(addr uint64, data []byte) error {
+	base := uint64(m.opts.FlashBase)
+	for i, b := range data {
+		a := addr + uint64(i)
+		if m.opts.FlashSize > 0 && a >= base+uint64(m.opts.FlashSize) {
+			continue
+		}
+		if a < base {
+			return fmt.Errorf("address 0x%08X is below the flash base 0x%08X", a, base)
+		}
+
+		offset := a - base
+		index := int(offset / uint64(m.opts.RowSize))
+		row, ok := m.rows[index]
+		if !ok {
+			row = make([]byte, m.opts.RowSize)
+			for j := range row {
+				row[j] = m.opts.Fill
+			}
+			m.rows[index] = row
+		}
+		row[offset%uint64(m.opts.RowSize)] = b
+	}
+	return nil
+}
+
+// firmware returns the collected rows as a Firmware, in address order.
+func (m *image) firmware() (*Firmware, error) {
+	if len(m.rows) == 0 {
+		return nil, fmt.Errorf("no data in flash range")
+	}
+
+	indexes := make([]int, 0, len(m.rows))
+	for index := range m.rows {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	fw := &Firmware{
+		SiliconID:    m.opts.SiliconID,
+		SiliconRev:   m.opts.SiliconRev,
+		ChecksumType: m.opts.ChecksumType,
+		Rows:         make([]*Row, 0, len(indexes)),
+	}
+	for _, index := range indexes {
+		arrayID, rowNum := 0, index
+		if m.opts.RowsPerArray > 0 {
+			arrayID, rowNum = index/m.opts.RowsPerArray, index%m.opts.RowsPerArray
+		}
+		if arrayID > 0xFF || rowNum > 0xFFFF {
+			return nil, fmt.Errorf("row %d is outside the .cyacd address space", index)
+		}
+		fw.Rows = append(fw.Rows, NewRow(byte(arrayID), uint16(rowNum), m.rows[index]))
+	}
+	return fw, nil
+}
+
+// NewRow returns a row holding data with its Size and Checksum fields set
+// as they would be in a .cyacd file.
+func NewRow(arrayID byte, rowNum uint16, data []byte) *Row {
+	row := &Row{
+		ArrayID: arrayID,
+		RowNum:  rowNum,
+		Size:    uint16(len(data)),
+		Data:    make([]byte, len(data)),
+	}
+	copy(row.Data, data)
+	encoded := row.encode()
+	row.Checksum = encoded[len(encoded)-1]
+	return row
+}
+
+// ImportIntelHex converts an Intel HEX image into a Firmware, splitting it
+// into flash rows as described by opts. Data (00), extended segment (02),
+// and extended linear address (04) records are used; start address records
+// are ignored.
+//
+// Example:
+//
+//	fw, err := cyacd.ImportIntelHex(f, cyacd.ImportOptions{
+//	    SiliconID: 0x04C81193,
+//	    RowSize:   128,
+//	    FlashSize: 32 * 1024,
+//	})
+func ImportIntelHex(r io.Reader, opts ImportOptions) (*Firmware, error) {
+	img, err := newImage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	var base uint64
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		rec, err := decodeHexRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		length := int(rec[0])
+		offset := uint64(rec[1])<<8 | uint64(rec[2])
+		data := rec[4 : 4+length]
+
+		switch rec[3] {
+		case 0x00:
+			err = img.write(base+offset, data)
+		case 0x01:
+			return img.firmware()
+		case 0x02:
+			if length != 2 {
+				err = fmt.Errorf("extended segment address record with %d bytes", length)
+				break
+			}
+			base = (uint64(data[0])<<8 | uint64(data[1])) << 4
+		case 0x04:
+			if length != 2 {
+				err = fmt.Errorf("extended linear address record with %d bytes", length)
+				break
+			}
+			base = (uint64(data[0])<<8 | uint64(data[1])) << 16
+		case 0x03, 0x05:
+		default:
+			err = fmt.Errorf("unknown record type 0x%02X", rec[3])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return nil, fmt.Errorf("missing end of file record")
+}
+
+// decodeHexRecord decodes and checks an Intel HEX record:
+//
+//	:[Length(1)][Offset(2)][Type(1)][Data(Length)][Checksum(1)]
+func decodeHexRecord(line string) ([]byte, error) {
+	if line[0] != ':' {
+		return nil, fmt.Errorf("record must start with ':'")
+	}
+	rec, err := hex.DecodeString(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %w", err)
+	}
+	if len(rec) < 5 || len(rec) != 5+int(rec[0]) {
+		return nil, fmt.Errorf("invalid record length: %d bytes", len(rec))
+	}
+
+	var sum byte
+	for _, b := range rec {
+		sum += b
+	}
+	if sum != 0 {
+		return nil, fmt.Errorf("checksum mismatch: got 0x%02X, expected 0x%02X",
+			rec[len(rec)-1], calculateRowChecksum(rec[:len(rec)-1]))
+	}
+	return rec, nil
+}
+
+// ImportSREC converts a Motorola S-record image into a Firmware, splitting
+// it into flash rows as described by opts. S1, S2, and S3 data records are
+// used; header, count, and termination records are ignored.
+//
+// Example:
+//
+//	fw, err := cyacd.ImportSREC(f, cyacd.ImportOptions{SiliconID: 0x2E123069, RowSize: 256})
+func ImportSREC(r io.Reader, opts ImportOptions) (*Firmware, error) {
+	img, err := newImage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if len(line) < 4 || line[0] != 'S' {
+			return nil, fmt.Errorf("line %d: record must start with 'S'", lineNum)
+		}
+		rec, err := hex.DecodeString(line[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid hex data: %w", lineNum, err)
+		}
+		if len(rec) < 2 || len(rec) != 1+int(rec[0]) {
+			return nil, fmt.Errorf("line %d: invalid record length: %d bytes", lineNum, len(rec))
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0xFF {
+			return nil, fmt.Errorf("line %d: checksum mismatch", lineNum)
+		}
+
+		var addrLen int
+		switch line[1] {
+		case '1':
+			addrLen = 2
+		case '2':
+			addrLen = 3
+		case '3':
+			addrLen = 4
+		case '0', '5', '6', '7', '8', '9':
+			continue
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type S%c", lineNum, line[1])
+		}
+		if len(rec) < 2+addrLen {
+			return nil, fmt.Errorf("line %d: record too short for its address", lineNum)
+		}
+
+		var addr uint64
+		for _, b := range rec[1 : 1+addrLen] {
+			addr = addr<<8 | uint64(b)
+		}
+		if err := img.write(addr, rec[1+addrLen:len(rec)-1]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return img.firmware()
+}
@@ -0,0 +1,121 @@
+package cyacd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// hexRecord formats an Intel HEX record with its checksum.
+func hexRecord(typ byte, offset uint16, data ...byte) string {
+	rec := append([]byte{byte(len(data)), byte(offset >> 8), byte(offset), typ}, data...)
+	return fmt.Sprintf(":%X%02X\n", rec, calculateRowChecksum(rec))
+}
+
+// srecRecord formats an S-record with a 2-byte address and its checksum.
+func srecRecord(typ byte, addr uint16, data ...byte) string {
+	rec := append([]byte{byte(len(data) + 3), byte(addr >> 8), byte(addr)}, data...)
+	var sum byte
+	for _, b := range rec {
+		sum += b
+	}
+	return fmt.Sprintf("S%c%X%02X\n", typ, rec, ^sum)
+}
+
+func TestImportIntelHex(t *testing.T) {
+	input := hexRecord(0x00, 0x0000, 1, 2, 3, 4) +
+		hexRecord(0x00, 0x0006, 5, 6) +
+		hexRecord(0x00, 0x0010, 7) +
+		hexRecord(0x04, 0x0000, 0x90, 0x30) + // checksum section, outside flash
+		hexRecord(0x00, 0x0000, 0xAA, 0xBB) +
+		hexRecord(0x01, 0x0000)
+
+	fw, err := ImportIntelHex(strings.NewReader(input), ImportOptions{
+		SiliconID:    0x1E9602AA,
+		RowSize:      4,
+		RowsPerArray: 4,
+		FlashSize:    0x100,
+		Fill:         0xFF,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		arrayID byte
+		rowNum  uint16
+		data    []byte
+	}{
+		{0, 0, []byte{1, 2, 3, 4}},
+		{0, 1, []byte{0xFF, 0xFF, 5, 6}},
+		{1, 0, []byte{7, 0xFF, 0xFF, 0xFF}},
+	}
+	if len(fw.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(fw.Rows), len(want))
+	}
+	for i, w := range want {
+		row := fw.Rows[i]
+		if row.ArrayID != w.arrayID || row.RowNum != w.rowNum || !bytes.Equal(row.Data, w.data) {
+			t.Errorf("row %d = array %d row %d % 02X, want array %d row %d % 02X",
+				i, row.ArrayID, row.RowNum, row.Data, w.arrayID, w.rowNum, w.data)
+		}
+	}
+
+	// The imported rows must survive a round trip through the .cyacd parser
+	var buf bytes.Buffer
+	if _, err := fw.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseReader(&buf)
+	if err != nil {
+		t.Fatalf("parse written file: %v", err)
+	}
+	if parsed.Fingerprint() != fw.Fingerprint() {
+		t.Error("fingerprint changed in the round trip")
+	}
+}
+
+func TestImportIntelHexErrors(t *testing.T) {
+	opts := ImportOptions{RowSize: 4}
+	tests := []struct {
+		name  string
+		input string
+		opts  ImportOptions
+	}{
+		{"no row size", hexRecord(0x01, 0), ImportOptions{}},
+		{"bad checksum", ":0400000001020304F1\n" + hexRecord(0x01, 0), opts},
+		{"no end record", hexRecord(0x00, 0, 1), opts},
+		{"no data", hexRecord(0x01, 0), opts},
+		{"below flash base", hexRecord(0x00, 0, 1) + hexRecord(0x01, 0), ImportOptions{RowSize: 4, FlashBase: 0x100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportIntelHex(strings.NewReader(tt.input), tt.opts); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestImportSREC(t *testing.T) {
+	input := "S00600004844521B\n" +
+		srecRecord('1', 0x1000, 1, 2, 3) +
+		srecRecord('1', 0x1003, 4, 5) +
+		srecRecord('9', 0x0000)
+
+	fw, err := ImportSREC(strings.NewReader(input), ImportOptions{RowSize: 4, FlashBase: 0x1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fw.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(fw.Rows))
+	}
+	if !bytes.Equal(fw.Rows[0].Data, []byte{1, 2, 3, 4}) || !bytes.Equal(fw.Rows[1].Data, []byte{5, 0, 0, 0}) {
+		t.Errorf("rows = % 02X, % 02X", fw.Rows[0].Data, fw.Rows[1].Data)
+	}
+
+	if _, err := ImportSREC(strings.NewReader("S1050000010200\n"), ImportOptions{RowSize: 4}); err == nil {
+		t.Error("bad checksum accepted")
+	}
+}
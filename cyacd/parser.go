@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"sync"
 )
 
 // Constants for CYACD file format parsing.
@@ -32,6 +34,16 @@ const (
 	DefaultRowCapacity = 256
 )
 
+// ParseOptions configures ParseWithOptions and ParseReaderWithOptions.
+type ParseOptions struct {
+	// Parallelism is the number of goroutines that decode and verify row
+	// lines, for large files on multi-core machines; the header is always
+	// parsed first and rows keep their file order. A negative value uses
+	// runtime.GOMAXPROCS. Default is 0 (rows are parsed sequentially as they
+	// are read).
+	Parallelism int
+}
+
 // Parse parses a .cyacd file from the given file path.
 // Returns the complete firmware structure or an error if parsing fails.
 //
@@ -43,13 +55,23 @@ const (
 //	}
 //	fmt.Printf("Silicon ID: 0x%08X\n", fw.SiliconID)
 func Parse(path string) (*Firmware, error) {
+	return ParseWithOptions(path, ParseOptions{})
+}
+
+// ParseWithOptions parses a .cyacd file from the given file path as
+// configured by opts.
+//
+// Example:
+//
+//	fw, err := cyacd.ParseWithOptions("large.cyacd", cyacd.ParseOptions{Parallelism: -1})
+func ParseWithOptions(path string, opts ParseOptions) (*Firmware, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() { _ = f.Close() }()
 
-	return ParseReader(f)
+	return ParseReaderWithOptions(f, opts)
 }
 
 // ParseReader parses a .cyacd file from any io.Reader.
@@ -60,6 +82,13 @@ func Parse(path string) (*Firmware, error) {
 //	data := strings.NewReader(cyacdContent)
 //	fw, err := cyacd.ParseReader(data)
 func ParseReader(r io.Reader) (*Firmware, error) {
+	return ParseReaderWithOptions(r, ParseOptions{})
+}
+
+// ParseReaderWithOptions parses a .cyacd file from any io.Reader as
+// configured by opts. The result and errors do not depend on
+// opts.Parallelism: an invalid file reports its first invalid line.
+func ParseReaderWithOptions(r io.Reader, opts ParseOptions) (*Firmware, error) {
 	scanner := bufio.NewScanner(r)
 
 	// Parse header (first line)
@@ -76,31 +105,34 @@ func ParseReader(r io.Reader) (*Firmware, error) {
 		return nil, fmt.Errorf("failed to parse header: %w", err)
 	}
 
-	// Parse rows
-	lineNum := 1
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-
-		// Skip empty lines
-		if line == "" {
-			continue
-		}
-
-		// Check if this is Intel HEX format (starts with ':')
-		var row *Row
-		var err error
-		if line != "" && line[0] == ':' {
-			row, err = parseIntelHexRow(line)
-		} else {
-			row, err = parseRow(line)
-		}
-
+	workers := opts.Parallelism
+	if workers < 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > 1 {
+		fw.Rows, err = parseRowsParallel(scanner, workers)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			return nil, err
+		}
+	} else {
+		// Parse rows
+		lineNum := 1
+		for scanner.Scan() {
+			lineNum++
+			line := scanner.Text()
+
+			// Skip empty lines
+			if line == "" {
+				continue
+			}
+
+			row, err := parseLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+
+			fw.Rows = append(fw.Rows, row)
 		}
-
-		fw.Rows = append(fw.Rows, row)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -114,6 +146,60 @@ func ParseReader(r io.Reader) (*Firmware, error) {
 	return fw, nil
 }
 
+// parseLine parses a row line in .cyacd or PSoC hybrid (':') format.
+func parseLine(line string) (*Row, error) {
+	// Check if this is Intel HEX format (starts with ':')
+	if line[0] == ':' {
+		return parseIntelHexRow(line)
+	}
+	return parseRow(line)
+}
+
+// parseRowsParallel reads the remaining row lines and parses them with
+// workers goroutines, each taking a contiguous share of the lines. Rows are
+// returned in file order; on error, the first invalid line is reported. A
+// read error of the scanner is left to the caller.
+func parseRowsParallel(scanner *bufio.Scanner, workers int) ([]*Row, error) {
+	type rowLine struct {
+		num  int
+		text string
+	}
+	var lines []rowLine
+	lineNum := 1
+	for scanner.Scan() {
+		lineNum++
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, rowLine{lineNum, line})
+		}
+	}
+
+	rows := make([]*Row, len(lines))
+	errs := make([]error, len(lines))
+	share := (len(lines) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(lines); start += share {
+		end := min(start+share, len(lines))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				if rows[i], errs[i] = parseLine(lines[i].text); errs[i] != nil {
+					// Later lines of the share cannot be the first error
+					return
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lines[i].num, err)
+		}
+	}
+	return rows, nil
+}
+
 // parseHeader parses the .cyacd file header.
 //
 // Header format (12 hex characters):
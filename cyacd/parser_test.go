@@ -431,3 +431,106 @@ func BenchmarkParseRow(b *testing.B) {
 		_, _ = parseRow(line)
 	}
 }
+
+func TestFingerprint(t *testing.T) {
+	parse := func(input string) *Firmware {
+		t.Helper()
+		fw, err := ParseReader(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("ParseReader: %v", err)
+		}
+		return fw
+	}
+
+	fw := parse("1E9602AA0000\n000000040001020304F2\n")
+	if got := fw.Fingerprint(); len(got) != 64 {
+		t.Fatalf("Fingerprint() = %q, want 64 hex characters", got)
+	}
+
+	// Formatting does not change the fingerprint
+	same := parse("1e9602aa0000\r\n\r\n000000040001020304f2\r\n")
+	if fw.Fingerprint() != same.Fingerprint() {
+		t.Error("fingerprint depends on file formatting")
+	}
+
+	// Contents do
+	other := parse("1E9602AA0000\n000000040001020305F1\n")
+	if fw.Fingerprint() == other.Fingerprint() {
+		t.Error("different row data has the same fingerprint")
+	}
+}
+
+func TestEqualAndClone(t *testing.T) {
+	fw, err := ParseReader(strings.NewReader("1E9602AA0000\n000000040001020304F2\n000100040005060708E1\n"))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+
+	clone := fw.Clone()
+	if !fw.Equal(clone) {
+		t.Fatal("clone is not equal to the original")
+	}
+	clone.Rows[0].Data[0] = 0xFF
+	if fw.Rows[0].Data[0] != 0x01 {
+		t.Error("changing the clone changed the original")
+	}
+	if fw.Equal(clone) {
+		t.Error("images with different row data are equal")
+	}
+
+	reordered := fw.Clone()
+	reordered.Rows[0], reordered.Rows[1] = reordered.Rows[1], reordered.Rows[0]
+	if fw.Equal(reordered) {
+		t.Error("reordered rows are equal without IgnoreRowOrder")
+	}
+	if !fw.Equal(reordered, IgnoreRowOrder()) {
+		t.Error("reordered rows are not equal with IgnoreRowOrder")
+	}
+	if fw.Rows[0].RowNum != 0 {
+		t.Error("IgnoreRowOrder reordered the rows of the image")
+	}
+
+	other := fw.Clone()
+	other.SiliconRev = 1
+	if fw.Equal(other) {
+		t.Error("images with different headers are equal")
+	}
+
+	var none *Firmware
+	if fw.Equal(none) || !none.Equal(nil) || none.Clone() != nil {
+		t.Error("nil firmware handling")
+	}
+}
+
+func TestParseParallelism(t *testing.T) {
+	fw := &Firmware{SiliconID: 0x1E9602AA}
+	for i := 0; i < 1000; i++ {
+		fw.Rows = append(fw.Rows, NewRow(0, uint16(i), bytes.Repeat([]byte{byte(i)}, 64)))
+	}
+	var buf bytes.Buffer
+	if _, err := fw.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	content := buf.String()
+
+	for _, parallelism := range []int{-1, 2, 3, 7, 2000} {
+		got, err := ParseReaderWithOptions(strings.NewReader(content), ParseOptions{Parallelism: parallelism})
+		if err != nil {
+			t.Fatalf("Parallelism %d: %v", parallelism, err)
+		}
+		if !got.Equal(fw) {
+			t.Errorf("Parallelism %d: rows differ from the sequential parse", parallelism)
+		}
+	}
+
+	// The first invalid line is reported, as when parsing sequentially
+	lines := strings.Split(content, "\n")
+	lines[900] = "00"
+	lines[500] = lines[500][:20] + "ZZ" + lines[500][22:]
+	corrupt := strings.Join(lines, "\n")
+	_, want := ParseReader(strings.NewReader(corrupt))
+	_, err := ParseReaderWithOptions(strings.NewReader(corrupt), ParseOptions{Parallelism: 4})
+	if err == nil || want == nil || err.Error() != want.Error() {
+		t.Errorf("err = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,117 @@
+package cyacd
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GapPolicy decides how Rechunk handles a new row that the data of the image
+// covers only in part.
+type GapPolicy int
+
+const (
+	// GapFill pads the bytes of the row not covered by the image with
+	// RechunkOptions.Fill
+	GapFill GapPolicy = iota
+
+	// GapError fails the conversion, for images that must map exactly onto
+	// the new rows
+	GapError
+)
+
+// RechunkOptions configures Rechunk.
+type RechunkOptions struct {
+	// SourceRowSize is the row size the image was built for: row N of an
+	// array starts at byte N*SourceRowSize of the array. Default is the size
+	// of the first row of the image.
+	SourceRowSize int
+
+	// Fill is the value of padding bytes (see GapFill). Default is 0x00.
+	Fill byte
+
+	// Gaps selects how partly covered rows are handled. Default is GapFill.
+	Gaps GapPolicy
+}
+
+// Rechunk splits the data of fw into rows of rowSize bytes, for devices whose
+// flash row size differs from the one the image was built for, so that one
+// build serves several memory variants. The rows of each flash array are laid
+// out by their row numbers as described by opts and re-split at the new row
+// size; rows that hold no data of the image are left out. The header is kept.
+//
+// Example:
+//
+//	// An image built for 256-byte rows, for a variant with 128-byte rows
+//	small, err := cyacd.Rechunk(fw, 128, cyacd.RechunkOptions{Fill: 0xFF})
+func Rechunk(fw *Firmware, rowSize int, opts RechunkOptions) (*Firmware, error) {
+	if rowSize <= 0 {
+		return nil, fmt.Errorf("row size must be positive, got %d", rowSize)
+	}
+	if len(fw.Rows) == 0 {
+		return nil, fmt.Errorf("firmware has no rows")
+	}
+	srcSize := opts.SourceRowSize
+	if srcSize == 0 {
+		srcSize = len(fw.Rows[0].Data)
+	}
+	if srcSize <= 0 {
+		return nil, fmt.Errorf("source row size must be positive, got %d", srcSize)
+	}
+
+	type rowKey struct {
+		arrayID byte
+		index   int
+	}
+	rows := make(map[rowKey][]byte)
+	covered := make(map[rowKey]int)
+	for _, row := range fw.Rows {
+		if len(row.Data) > srcSize {
+			return nil, fmt.Errorf("row %d (array %d): %d bytes exceed the source row size %d",
+				row.RowNum, row.ArrayID, len(row.Data), srcSize)
+		}
+
+		start := int(row.RowNum) * srcSize
+		for i, b := range row.Data {
+			addr := start + i
+			k := rowKey{row.ArrayID, addr / rowSize}
+			data, ok := rows[k]
+			if !ok {
+				data = make([]byte, rowSize)
+				for j := range data {
+					data[j] = opts.Fill
+				}
+				rows[k] = data
+			}
+			data[addr%rowSize] = b
+			covered[k]++
+		}
+	}
+
+	keys := make([]rowKey, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].arrayID != keys[j].arrayID {
+			return keys[i].arrayID < keys[j].arrayID
+		}
+		return keys[i].index < keys[j].index
+	})
+
+	out := &Firmware{
+		SiliconID:    fw.SiliconID,
+		SiliconRev:   fw.SiliconRev,
+		ChecksumType: fw.ChecksumType,
+		Rows:         make([]*Row, 0, len(keys)),
+	}
+	for _, k := range keys {
+		if k.index > 0xFFFF {
+			return nil, fmt.Errorf("row %d (array %d) is outside the .cyacd address space", k.index, k.arrayID)
+		}
+		if opts.Gaps == GapError && covered[k] < rowSize {
+			return nil, fmt.Errorf("row %d (array %d): image covers %d of %d bytes", k.index, k.arrayID, covered[k], rowSize)
+		}
+		out.Rows = append(out.Rows, NewRow(k.arrayID, uint16(k.index), rows[k]))
+	}
+	return out, nil
+}
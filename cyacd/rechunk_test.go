@@ -0,0 +1,59 @@
+package cyacd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRechunk(t *testing.T) {
+	fw := &Firmware{SiliconID: 0x1E9602AA, Rows: []*Row{
+		NewRow(0, 1, []byte{0x01, 0x02, 0x03, 0x04}),
+		NewRow(0, 2, []byte{0x05, 0x06, 0x07, 0x08}),
+		NewRow(1, 0, []byte{0x09, 0x0A}),
+	}}
+
+	// Smaller rows
+	small, err := Rechunk(fw, 2, RechunkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small.Rows) != 5 || small.SiliconID != fw.SiliconID {
+		t.Fatalf("got %d rows, want 5", len(small.Rows))
+	}
+	if r := small.Rows[0]; r.ArrayID != 0 || r.RowNum != 2 || !bytes.Equal(r.Data, []byte{0x01, 0x02}) {
+		t.Errorf("first row = array %d row %d % 02X", r.ArrayID, r.RowNum, r.Data)
+	}
+	if r := small.Rows[4]; r.ArrayID != 1 || r.RowNum != 0 || !bytes.Equal(r.Data, []byte{0x09, 0x0A}) {
+		t.Errorf("last row = array %d row %d % 02X", r.ArrayID, r.RowNum, r.Data)
+	}
+	if _, err := ParseReader(writeString(t, small)); err != nil {
+		t.Errorf("rechunked image does not write and parse: %v", err)
+	}
+
+	// Larger rows are padded
+	large, err := Rechunk(fw, 8, RechunkOptions{Fill: 0xFF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x01, 0x02, 0x03, 0x04}
+	if len(large.Rows) != 3 || large.Rows[0].RowNum != 0 || !bytes.Equal(large.Rows[0].Data, want) {
+		t.Errorf("rows = %d, first = % 02X, want % 02X", len(large.Rows), large.Rows[0].Data, want)
+	}
+
+	if _, err := Rechunk(fw, 8, RechunkOptions{Gaps: GapError}); err == nil {
+		t.Error("expected an error for partly covered rows with GapError")
+	}
+	if _, err := Rechunk(fw, 0, RechunkOptions{}); err == nil {
+		t.Error("expected an error for row size 0")
+	}
+}
+
+// writeString writes fw in .cyacd format and returns a reader of the result.
+func writeString(t *testing.T, fw *Firmware) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := fw.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
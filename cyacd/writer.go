@@ -0,0 +1,178 @@
+package cyacd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTo writes the firmware in .cyacd format: the header line followed by
+// one line per row, with little-endian row numbers and lengths. Row
+// checksums are computed from the row contents, so rows whose data was
+// changed after parsing are written consistently.
+//
+// Example:
+//
+//	f, err := os.Create("firmware.cyacd")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer f.Close()
+//	if _, err := fw.WriteTo(f); err != nil {
+//	    log.Fatal(err)
+//	}
+func (f *Firmware) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	fmt.Fprintf(cw, "%08X%02X%02X\n", f.SiliconID, f.SiliconRev, f.ChecksumType)
+	for _, row := range f.Rows {
+		if len(row.Data) > 0xFFFF {
+			return cw.n, fmt.Errorf("row %d (array %d): %d bytes do not fit a .cyacd row", row.RowNum, row.ArrayID, len(row.Data))
+		}
+		fmt.Fprintf(cw, "%s\n", strings.ToUpper(hex.EncodeToString(row.encode())))
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// WriteTo writes the firmware in .cyacd2 format: the header line, the
+// @APPINFO and @EIV lines, and one line per row with its little-endian flash
+// address. The @EIV line is empty for unencrypted images.
+//
+// Example:
+//
+//	f, err := os.Create("firmware.cyacd2")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer f.Close()
+//	if _, err := fw.WriteTo(f); err != nil {
+//	    log.Fatal(err)
+//	}
+func (f *Firmware2) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	version := f.FileVersion
+	if version == 0 {
+		version = FileVersion2
+	}
+	header := []byte{version}
+	header = binary.LittleEndian.AppendUint32(header, f.SiliconID)
+	header = append(header, f.SiliconRev, f.ChecksumType, f.AppID)
+	header = binary.LittleEndian.AppendUint32(header, f.ProductID)
+
+	fmt.Fprintf(cw, "%X\n", header)
+	fmt.Fprintf(cw, "@APPINFO:0x%X,0x%X\n", f.AppStart, f.AppLength)
+	fmt.Fprintf(cw, "@EIV:%X\n", f.EIV)
+	for _, row := range f.Rows {
+		fmt.Fprintf(cw, ":%X%X\n", binary.LittleEndian.AppendUint32(nil, row.Address), row.Data)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// Firmware2Options describes how ToFirmware2 places the rows of a .cyacd
+// image in flash and fills in the .cyacd2 header fields a .cyacd file lacks.
+type Firmware2Options struct {
+	// RowSize is the flash row size in bytes. Default is the size of the
+	// first row of the image.
+	RowSize int
+
+	// RowsPerArray is the number of rows in each flash array; row N of
+	// array A is at row index A*RowsPerArray+N. 0 ignores the array ID.
+	RowsPerArray int
+
+	// FlashBase is the address of the first byte of flash (e.g. 0x10000000
+	// for PSoC 6). Default is 0.
+	FlashBase uint32
+
+	// AppID is the application slot the image is built for
+	AppID byte
+
+	// ProductID identifies the product the bootloader accepts
+	ProductID uint32
+}
+
+// ToFirmware2 converts the firmware to a .cyacd2 image, addressing each row
+// as described by opts. The application region (@APPINFO) spans the rows.
+//
+// Example:
+//
+//	fw2, err := fw.ToFirmware2(cyacd.Firmware2Options{FlashBase: 0x10000000, ProductID: 0x01020304})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	_, err = fw2.WriteTo(out)
+func (f *Firmware) ToFirmware2(opts Firmware2Options) (*Firmware2, error) {
+	if len(f.Rows) == 0 {
+		return nil, fmt.Errorf("firmware has no rows")
+	}
+	rowSize := opts.RowSize
+	if rowSize == 0 {
+		rowSize = len(f.Rows[0].Data)
+	}
+	if rowSize <= 0 || opts.RowsPerArray < 0 {
+		return nil, fmt.Errorf("invalid row layout: row size %d, %d rows per array", rowSize, opts.RowsPerArray)
+	}
+
+	fw2 := &Firmware2{
+		FileVersion:  FileVersion2,
+		SiliconID:    f.SiliconID,
+		SiliconRev:   f.SiliconRev,
+		ChecksumType: f.ChecksumType,
+		AppID:        opts.AppID,
+		ProductID:    opts.ProductID,
+		Rows:         make([]*Row2, 0, len(f.Rows)),
+	}
+	start, end := ^uint32(0), uint32(0)
+	for _, row := range f.Rows {
+		index := int(row.RowNum)
+		if opts.RowsPerArray > 0 {
+			index += int(row.ArrayID) * opts.RowsPerArray
+		}
+		addr := opts.FlashBase + uint32(index*rowSize)
+		fw2.Rows = append(fw2.Rows, &Row2{Address: addr, Data: row.Data})
+		start = min(start, addr)
+		end = max(end, addr+uint32(len(row.Data)))
+	}
+	fw2.AppStart, fw2.AppLength = start, end-start
+	return fw2, nil
+}
+
+// encode returns the row as stored in a .cyacd file:
+//
+//	[ArrayID(1)][RowNum(2)][DataLen(2)][Data(N)][Checksum(1)]
+func (r *Row) encode() []byte {
+	buf := make([]byte, 0, RowHeaderSize+len(r.Data)+RowChecksumSize)
+	buf = append(buf, r.ArrayID, byte(r.RowNum), byte(r.RowNum>>8), byte(len(r.Data)), byte(len(r.Data)>>8))
+	buf = append(buf, r.Data...)
+	return append(buf, calculateRowChecksum(buf))
+}
+
+// countingWriter counts the bytes written to w and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
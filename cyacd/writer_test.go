@@ -0,0 +1,95 @@
+package cyacd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	input := "1E9602AA0000\n" +
+		"000000040001020304F2\n" +
+		"000100040005060708E1\n"
+
+	fw, err := ParseReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := fw.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input || n != int64(len(input)) {
+		t.Errorf("wrote %d bytes:\n%s\nwant:\n%s", n, buf.String(), input)
+	}
+
+	// Changed data gets a matching checksum
+	fw.Rows[0].Data[0] = 0x10
+	buf.Reset()
+	if _, err := fw.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseReader(&buf); err != nil {
+		t.Errorf("written file does not parse: %v", err)
+	}
+}
+
+func TestWriteTo2(t *testing.T) {
+	input := "01AA02961E00000100112233\n" +
+		"@APPINFO:0x10000000,0x8000\n" +
+		"@EIV:000102030405060708090A0B0C0D0E0F\n" +
+		":00000010DEADBEEF\n" +
+		":80000010CAFE\n"
+
+	fw, err := ParseReader2(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := fw.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input || n != int64(len(input)) {
+		t.Errorf("wrote %d bytes:\n%s\nwant:\n%s", n, buf.String(), input)
+	}
+}
+
+func TestToFirmware2(t *testing.T) {
+	fw := &Firmware{SiliconID: 0x1E9602AA, ChecksumType: 0x01, Rows: []*Row{
+		NewRow(0, 0x0002, []byte{0x01, 0x02, 0x03, 0x04}),
+		NewRow(1, 0x0000, []byte{0x05, 0x06, 0x07, 0x08}),
+	}}
+
+	fw2, err := fw.ToFirmware2(Firmware2Options{RowsPerArray: 8, FlashBase: 0x10000000, AppID: 1, ProductID: 0x33221100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw2.Rows[0].Address != 0x10000008 || fw2.Rows[1].Address != 0x10000020 {
+		t.Errorf("addresses = 0x%08X, 0x%08X", fw2.Rows[0].Address, fw2.Rows[1].Address)
+	}
+	if fw2.AppStart != 0x10000008 || fw2.AppLength != 0x1C {
+		t.Errorf("APPINFO = 0x%08X,0x%X", fw2.AppStart, fw2.AppLength)
+	}
+
+	// The written image parses back
+	var buf bytes.Buffer
+	if _, err := fw2.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseReader2(&buf)
+	if err != nil {
+		t.Fatalf("written file does not parse: %v", err)
+	}
+	if back.SiliconID != fw.SiliconID || back.ChecksumType != 0x01 || back.AppID != 1 || back.ProductID != 0x33221100 ||
+		back.Encrypted() || len(back.Rows) != 2 {
+		t.Errorf("parsed back %+v", back)
+	}
+
+	if _, err := (&Firmware{}).ToFirmware2(Firmware2Options{}); err == nil {
+		t.Error("expected an error for firmware without rows")
+	}
+}
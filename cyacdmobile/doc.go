@@ -0,0 +1,37 @@
+// Package cyacdmobile wraps the bootloader for gomobile, so that Android and
+// iOS service apps can flash PSoC accessories attached over USB-serial or
+// BLE. Its API only uses types gomobile can bind: strings, numbers, []byte,
+// errors, and structs of those, plus two small interfaces the app implements
+// to supply the link to the device and receive progress. There are no
+// channels, contexts, or io interfaces in its signatures.
+//
+// Build the bindings with gomobile:
+//
+//	gomobile bind -target=android -o cyacd.aar ./cyacdmobile
+//	gomobile bind -target=ios -o Cyacd.xcframework ./cyacdmobile
+//
+// # Transport
+//
+// The app implements Transport on top of the platform's serial or BLE API.
+// Read waits at most the given time for data and returns an empty slice if
+// none arrived, so that operations can time out and be canceled while the
+// platform read is pending.
+//
+// Example (Kotlin):
+//
+//	class UsbTransport(private val port: UsbSerialPort) : Transport {
+//	    override fun write(data: ByteArray) { port.write(data, 1000) }
+//	    override fun read(timeoutMillis: Long): ByteArray {
+//	        val buf = ByteArray(512)
+//	        val n = port.read(buf, timeoutMillis.toInt())
+//	        return buf.copyOf(n)
+//	    }
+//	}
+//
+//	val flasher = Cyacdmobile.newFlasher(UsbTransport(port))
+//	flasher.setKey("0A1B2C3D4E5F")
+//	flasher.program(firmwareBytes) // throws on failure
+//
+// A Flasher runs one operation at a time; call it from a worker thread and
+// Cancel it from any thread.
+package cyacdmobile
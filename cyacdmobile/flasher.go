@@ -0,0 +1,258 @@
+package cyacdmobile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// ProgressListener receives progress reports while a Flasher runs. It is
+// called on the thread that called Program or Verify.
+type ProgressListener interface {
+	// OnProgress reports the phase (e.g. "programming"), the overall
+	// percentage, and the current row of rows
+	OnProgress(phase string, percent float64, row, rows int)
+}
+
+// FirmwareInfo describes a firmware image. Returned by ParseFirmware.
+type FirmwareInfo struct {
+	// Format is "cyacd" or "cyacd2"
+	Format string
+
+	// SiliconID is the silicon ID of the target device
+	SiliconID int64
+
+	// SiliconRev is the silicon revision of the target device
+	SiliconRev int
+
+	// Rows is the number of flash rows in the image
+	Rows int
+
+	// Bytes is the number of data bytes in the image
+	Bytes int
+}
+
+// ParseFirmware parses a .cyacd or .cyacd2 image, telling them apart by
+// their header, so the app can check it before flashing.
+func ParseFirmware(image []byte) (*FirmwareInfo, error) {
+	v1, v2, err := parseImage(image)
+	if err != nil {
+		return nil, err
+	}
+	if v2 != nil {
+		info := &FirmwareInfo{Format: "cyacd2", SiliconID: int64(v2.SiliconID), SiliconRev: int(v2.SiliconRev), Rows: len(v2.Rows)}
+		for _, row := range v2.Rows {
+			info.Bytes += len(row.Data)
+		}
+		return info, nil
+	}
+	info := &FirmwareInfo{Format: "cyacd", SiliconID: int64(v1.SiliconID), SiliconRev: int(v1.SiliconRev), Rows: len(v1.Rows)}
+	for _, row := range v1.Rows {
+		info.Bytes += len(row.Data)
+	}
+	return info, nil
+}
+
+// parseImage parses a .cyacd image into v1 or a .cyacd2 image into v2.
+func parseImage(image []byte) (v1 *cyacd.Firmware, v2 *cyacd.Firmware2, err error) {
+	if cyacd.IsCyacd2("", image) {
+		v2, err = cyacd.ParseReader2(bytes.NewReader(image))
+	} else {
+		v1, err = cyacd.ParseReader(bytes.NewReader(image))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse firmware: %w", err)
+	}
+	return v1, v2, nil
+}
+
+// Flasher programs and verifies the device behind a Transport. Configure it
+// with the setters before starting an operation; only one operation runs at
+// a time.
+type Flasher struct {
+	device *transportDevice
+
+	mu           sync.Mutex
+	key          []byte
+	timeout      time.Duration
+	chunkSize    int
+	retries      int
+	verify       bool
+	segmentSize  int
+	segmentDelay time.Duration
+	listener     ProgressListener
+	cancel       context.CancelFunc
+}
+
+// NewFlasher returns a Flasher for the device behind t. It enters the
+// bootloader without a key until SetKey is called.
+func NewFlasher(t Transport) *Flasher {
+	return &Flasher{
+		device:    &transportDevice{t: t},
+		key:       protocol.NoKey,
+		timeout:   bootloader.DefaultReadTimeout,
+		chunkSize: bootloader.DefaultChunkSize,
+		retries:   bootloader.DefaultRetries,
+		verify:    true,
+	}
+}
+
+// SetKey sets the bootloader key in any form protocol.ParseKey accepts, such
+// as 12 hex digits or "none" for a bootloader built without a key. Ignored for
+// .cyacd2 images.
+func (f *Flasher) SetKey(key string) error {
+	k, err := protocol.ParseKey(key)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key = k
+	return nil
+}
+
+// SetTimeoutMillis sets how long to wait for each response of the device.
+// Default is 5000.
+func (f *Flasher) SetTimeoutMillis(timeout int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timeout = time.Duration(timeout) * time.Millisecond
+}
+
+// SetChunkSize sets the number of bytes sent per Send Data command. Default
+// is 57.
+func (f *Flasher) SetChunkSize(size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunkSize = size
+}
+
+// SetRetries sets how many times rows and commands are retried after
+// transient errors. Default is 3.
+func (f *Flasher) SetRetries(retries int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retries = retries
+}
+
+// SetVerify selects whether each row is read back after programming it.
+// Default is true.
+func (f *Flasher) SetVerify(verify bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.verify = verify
+}
+
+// SetWriteSegments splits every frame into writes of at most size bytes,
+// delayMillis apart, for links such as BLE whose writes are limited by the
+// MTU. 0 sends every frame in one write. Default is 0.
+func (f *Flasher) SetWriteSegments(size, delayMillis int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.segmentSize = size
+	f.segmentDelay = time.Duration(delayMillis) * time.Millisecond
+}
+
+// SetProgressListener sets the listener of progress reports; nil removes it.
+func (f *Flasher) SetProgressListener(listener ProgressListener) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listener = listener
+}
+
+// Program programs a .cyacd or .cyacd2 image into the device and starts the
+// new application.
+func (f *Flasher) Program(image []byte) error {
+	v1, v2, err := parseImage(image)
+	if err != nil {
+		return err
+	}
+	return f.run(func(ctx context.Context, prog *bootloader.Programmer, key []byte) error {
+		if v2 != nil {
+			return prog.ProgramV2(ctx, v2)
+		}
+		return prog.Program(ctx, v1, key)
+	})
+}
+
+// Verify compares the flash of the device with a .cyacd image using row
+// checksums, without writing anything, and fails if any row differs.
+func (f *Flasher) Verify(image []byte) error {
+	v1, v2, err := parseImage(image)
+	if err != nil {
+		return err
+	}
+	if v2 != nil {
+		return errors.New("verify: .cyacd2 images can only be verified while programming")
+	}
+	return f.run(func(ctx context.Context, prog *bootloader.Programmer, key []byte) error {
+		result, err := prog.Compare(ctx, v1, key)
+		if err != nil {
+			return err
+		}
+		if !result.Match() {
+			row := result.Mismatching[0]
+			return fmt.Errorf("verify: %d of %d rows differ, first row %d (array %d)",
+				len(result.Mismatching), len(v1.Rows), row.RowNum, row.ArrayID)
+		}
+		return nil
+	})
+}
+
+// Cancel stops the operation in progress, which then fails. It does nothing
+// if no operation is running.
+func (f *Flasher) Cancel() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// run runs op with a Programmer configured by the setters.
+func (f *Flasher) run(op func(ctx context.Context, prog *bootloader.Programmer, key []byte) error) error {
+	f.mu.Lock()
+	if f.cancel != nil {
+		f.mu.Unlock()
+		return errors.New("an operation is already in progress")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	key := f.key
+	opts := []bootloader.Option{
+		bootloader.WithReadTimeout(f.timeout),
+		bootloader.WithChunkSize(f.chunkSize),
+		bootloader.WithRetries(f.retries),
+		bootloader.WithVerifyAfterProgram(f.verify),
+	}
+	if f.segmentSize > 0 {
+		opts = append(opts, bootloader.WithWriteSegments(f.segmentSize, f.segmentDelay))
+	}
+	if listener := f.listener; listener != nil {
+		opts = append(opts, bootloader.WithProgressCallback(func(p bootloader.Progress) {
+			listener.OnProgress(string(p.Phase), p.Percentage, p.CurrentRow, p.TotalRows)
+		}))
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.cancel = nil
+		cancel()
+	}()
+
+	prog, err := bootloader.NewProgrammer(f.device, opts...)
+	if err != nil {
+		return err
+	}
+	return op(ctx, prog, key)
+}
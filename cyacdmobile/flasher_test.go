@@ -0,0 +1,124 @@
+package cyacdmobile
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacdtest"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// mockTransport implements Transport with a simulated bootloader, returning
+// responses a few bytes per read like a slow serial link.
+type mockTransport struct {
+	device *bootloadertest.Device
+	silent bool
+}
+
+func (m *mockTransport) Write(data []byte) error {
+	_, err := m.device.Write(data)
+	return err
+}
+
+func (m *mockTransport) Read(timeoutMillis int) ([]byte, error) {
+	if m.silent {
+		time.Sleep(time.Duration(timeoutMillis) * time.Millisecond)
+		return nil, nil
+	}
+	buf := make([]byte, 5)
+	n, err := m.device.Read(buf)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	return buf[:n], err
+}
+
+type progressRecorder struct {
+	mu     sync.Mutex
+	phases []string
+}
+
+func (r *progressRecorder) OnProgress(phase string, percent float64, row, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phases = append(r.phases, phase)
+}
+
+func TestFlasher(t *testing.T) {
+	image, err := cyacdtest.Generate(cyacdtest.Options{FirstRow: 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ParseFirmware(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "cyacd" || info.SiliconID != cyacdtest.DefaultSiliconID ||
+		info.Rows != cyacdtest.DefaultRows || info.Bytes != cyacdtest.DefaultRows*cyacdtest.DefaultRowSize {
+		t.Errorf("ParseFirmware = %+v", info)
+	}
+	if _, err := ParseFirmware([]byte("not a firmware image")); err == nil {
+		t.Error("ParseFirmware accepted garbage")
+	}
+
+	key := []byte(protocol.DefaultExampleKey)
+	device := bootloadertest.NewDevice(bootloadertest.WithKey(key))
+	f := NewFlasher(&mockTransport{device: device})
+	for _, k := range []string{"0A1B2C", ""} {
+		if err := f.SetKey(k); err == nil {
+			t.Errorf("SetKey(%q) succeeded", k)
+		}
+	}
+	if err := f.SetKey("none"); err != nil {
+		t.Errorf("SetKey(none): %v", err)
+	}
+	if err := f.SetKey("0a:1b:2c:3d:4e:5f"); err != nil {
+		t.Fatal(err)
+	}
+	var progress progressRecorder
+	f.SetProgressListener(&progress)
+	f.SetVerify(false)
+
+	if err := f.Program(image); err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	if len(device.Rows()) != cyacdtest.DefaultRows {
+		t.Errorf("device has %d rows, want %d", len(device.Rows()), cyacdtest.DefaultRows)
+	}
+	if !strings.Contains(strings.Join(progress.phases, " "), "programming") {
+		t.Errorf("progress phases %v lack programming", progress.phases)
+	}
+
+	blank := NewFlasher(&mockTransport{device: bootloadertest.NewDevice()})
+	if err := blank.Verify(image); err == nil || !strings.Contains(err.Error(), "4 of 4 rows differ") {
+		t.Errorf("Verify of a blank device: %v", err)
+	}
+}
+
+func TestFlasherCancel(t *testing.T) {
+	image, err := cyacdtest.Generate(cyacdtest.Options{FirstRow: 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFlasher(&mockTransport{device: bootloadertest.NewDevice(), silent: true})
+	done := make(chan error, 1)
+	go func() { done <- f.Program(image) }()
+
+	time.Sleep(50 * time.Millisecond)
+	f.Cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("canceled Program succeeded")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Program did not stop after Cancel")
+	}
+}
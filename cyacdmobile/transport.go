@@ -0,0 +1,64 @@
+package cyacdmobile
+
+import (
+	"context"
+	"time"
+)
+
+// pollInterval bounds each Transport.Read, so that a canceled operation
+// stops within about this long even if the device stays silent.
+const pollInterval = 100 * time.Millisecond
+
+// Transport is the link to the device, implemented by the app on top of the
+// platform's USB-serial or BLE API. Its methods are called from the thread
+// running the operation.
+type Transport interface {
+	// Write sends data to the device
+	Write(data []byte) error
+
+	// Read returns the bytes received from the device, waiting at most
+	// timeoutMillis for the first one. It returns an empty slice if none
+	// arrived in time.
+	Read(timeoutMillis int) ([]byte, error)
+}
+
+// transportDevice adapts a Transport to the io.ReadWriter and
+// bootloader.ContextReader the Programmer uses, keeping bytes a read
+// returned beyond what the caller asked for.
+type transportDevice struct {
+	t       Transport
+	pending []byte
+}
+
+func (d *transportDevice) Write(p []byte) (int, error) {
+	if err := d.t.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (d *transportDevice) Read(p []byte) (int, error) {
+	return d.ReadContext(context.Background(), p)
+}
+
+// ReadContext polls the Transport in steps of at most pollInterval until
+// data arrives or ctx is done.
+func (d *transportDevice) ReadContext(ctx context.Context, p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		wait := pollInterval
+		if deadline, ok := ctx.Deadline(); ok {
+			wait = min(wait, time.Until(deadline))
+		}
+		data, err := d.t.Read(int(max(wait, time.Millisecond) / time.Millisecond))
+		d.pending = append(d.pending, data...)
+		if err != nil && len(d.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
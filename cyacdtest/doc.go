@@ -0,0 +1,31 @@
+// Package cyacdtest generates .cyacd firmware images for tests and fuzzers,
+// so that fixtures can be built in code instead of committed as files.
+//
+// # Usage
+//
+//	content, err := cyacdtest.Generate(cyacdtest.Options{
+//	    SiliconID: 0x04C81193,
+//	    Rows:      16,
+//	    RowSize:   128,
+//	})
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	fw, err := cyacd.ParseReader(bytes.NewReader(content))
+//
+// Row data is pseudo-random but deterministic for a given Options.Seed, so
+// the same options always produce the same image. Firmware returns the image
+// as a *cyacd.Firmware without going through the text format.
+//
+// # Defects
+//
+// Defects corrupt the generated text to exercise error paths of parsers:
+//
+//	content, _ := cyacdtest.Generate(cyacdtest.Options{
+//	    Defects: []cyacdtest.Defect{{Kind: cyacdtest.DefectChecksum, Row: 2}},
+//	})
+//	_, err := cyacd.ParseReader(bytes.NewReader(content)) // checksum mismatch
+//
+// Available defects are wrong row checksums, wrong data lengths, non-hex
+// characters, truncated rows, duplicated rows, and a malformed header.
+package cyacdtest
@@ -0,0 +1,196 @@
+package cyacdtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// Defaults of the generated image.
+const (
+	// DefaultSiliconID is the silicon ID of images generated without Options.SiliconID
+	DefaultSiliconID = 0x1E9602AA
+
+	// DefaultRows is the number of rows of images generated without Options.Rows
+	DefaultRows = 4
+
+	// DefaultRowSize is the row size of images generated without Options.RowSize
+	DefaultRowSize = 128
+)
+
+// DefectKind selects the corruption applied by a Defect.
+type DefectKind int
+
+const (
+	// DefectChecksum increments the checksum byte of the row
+	DefectChecksum DefectKind = iota + 1
+
+	// DefectLength increments the data length field of the row, so that it
+	// no longer matches the data
+	DefectLength
+
+	// DefectHex replaces the first data digit of the row with a non-hex character
+	DefectHex
+
+	// DefectTruncated cuts the row line to half its length
+	DefectTruncated
+
+	// DefectDuplicateRow writes the row line twice. The image still parses;
+	// the defect is for code that validates row numbers.
+	DefectDuplicateRow
+
+	// DefectHeader drops the checksum type from the header line (Row is ignored)
+	DefectHeader
+)
+
+// Defect describes a corruption of the generated text.
+type Defect struct {
+	// Kind is the corruption to apply
+	Kind DefectKind
+
+	// Row is the index of the affected row in the image, from 0
+	Row int
+}
+
+// Options configures the generated image.
+type Options struct {
+	// SiliconID and SiliconRev are written to the header
+	// Default SiliconID is DefaultSiliconID
+	SiliconID  uint32
+	SiliconRev byte
+
+	// ChecksumType is the packet checksum type written to the header
+	// Default is 0 (basic sum)
+	ChecksumType byte
+
+	// ArrayID is the flash array of all rows
+	// Default is 0
+	ArrayID byte
+
+	// FirstRow is the row number of the first row; rows are consecutive
+	// Default is 0
+	FirstRow uint16
+
+	// Rows is the number of rows
+	// Default is DefaultRows
+	Rows int
+
+	// RowSize is the number of data bytes of every row
+	// Default is DefaultRowSize
+	RowSize int
+
+	// Seed selects the pseudo-random row data
+	// Default is 0
+	Seed int64
+
+	// Defects are applied to the text produced by Generate, in order
+	// (ignored by Firmware)
+	Defects []Defect
+}
+
+// Firmware returns the image described by opts, without defects.
+//
+// Example:
+//
+//	fw, err := cyacdtest.Firmware(cyacdtest.Options{Rows: 8, RowSize: 256})
+func Firmware(opts Options) (*cyacd.Firmware, error) {
+	opts = opts.withDefaults()
+	if opts.Rows < 0 || opts.RowSize < 0 {
+		return nil, fmt.Errorf("negative row count %d or row size %d", opts.Rows, opts.RowSize)
+	}
+	if opts.RowSize > 0xFFFF {
+		return nil, fmt.Errorf("row size %d does not fit a .cyacd row", opts.RowSize)
+	}
+	if int(opts.FirstRow)+opts.Rows-1 > 0xFFFF {
+		return nil, fmt.Errorf("%d rows from row %d exceed the .cyacd row numbers", opts.Rows, opts.FirstRow)
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	fw := &cyacd.Firmware{
+		SiliconID:    opts.SiliconID,
+		SiliconRev:   opts.SiliconRev,
+		ChecksumType: opts.ChecksumType,
+		Rows:         make([]*cyacd.Row, 0, opts.Rows),
+	}
+	data := make([]byte, opts.RowSize)
+	for i := 0; i < opts.Rows; i++ {
+		rng.Read(data)
+		fw.Rows = append(fw.Rows, cyacd.NewRow(opts.ArrayID, opts.FirstRow+uint16(i), data))
+	}
+	return fw, nil
+}
+
+// Generate returns the .cyacd text of the image described by opts, with the
+// defects of opts applied.
+//
+// Example:
+//
+//	content, err := cyacdtest.Generate(cyacdtest.Options{
+//	    Defects: []cyacdtest.Defect{{Kind: cyacdtest.DefectLength, Row: 0}},
+//	})
+func Generate(opts Options) ([]byte, error) {
+	fw, err := Firmware(opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := fw.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	// lines[0] is the header, lines[i+1] is row i
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	for _, d := range opts.Defects {
+		if d.Kind == DefectHeader {
+			lines[0] = lines[0][:len(lines[0])-2]
+			continue
+		}
+		if d.Row < 0 || d.Row >= len(fw.Rows) {
+			return nil, fmt.Errorf("defect row %d outside the %d rows of the image", d.Row, len(fw.Rows))
+		}
+		line := lines[d.Row+1]
+		switch d.Kind {
+		case DefectChecksum:
+			line = setByte(line, len(line)/2-1, func(b byte) byte { return b + 1 })
+		case DefectLength:
+			line = setByte(line, 3, func(b byte) byte { return b + 1 })
+		case DefectHex:
+			line = append([]byte(nil), line...)
+			line[2*cyacd.RowHeaderSize] = 'X'
+		case DefectTruncated:
+			line = line[:len(line)/2]
+		case DefectDuplicateRow:
+			line = append(append(append([]byte(nil), line...), '\n'), line...)
+		default:
+			return nil, fmt.Errorf("unknown defect kind %d", d.Kind)
+		}
+		lines[d.Row+1] = line
+	}
+	return append(bytes.Join(lines, []byte("\n")), '\n'), nil
+}
+
+// withDefaults fills in the defaults of unset options.
+func (o Options) withDefaults() Options {
+	if o.SiliconID == 0 {
+		o.SiliconID = DefaultSiliconID
+	}
+	if o.Rows == 0 {
+		o.Rows = DefaultRows
+	}
+	if o.RowSize == 0 {
+		o.RowSize = DefaultRowSize
+	}
+	return o
+}
+
+// setByte returns a copy of the hex line with byte i replaced by f of its value.
+func setByte(line []byte, i int, f func(byte) byte) []byte {
+	line = append([]byte(nil), line...)
+	var b [1]byte
+	hex.Decode(b[:], line[2*i:2*i+2])
+	copy(line[2*i:], fmt.Sprintf("%02X", f(b[0])))
+	return line
+}
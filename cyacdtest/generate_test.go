@@ -0,0 +1,87 @@
+package cyacdtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+func TestGenerate(t *testing.T) {
+	opts := Options{SiliconID: 0x04C81193, SiliconRev: 0x11, ChecksumType: 1, ArrayID: 1, FirstRow: 0x20, Rows: 8, RowSize: 64, Seed: 7}
+	content, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	fw, err := cyacd.ParseReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if fw.SiliconID != 0x04C81193 || fw.SiliconRev != 0x11 || fw.ChecksumType != 1 {
+		t.Errorf("header = 0x%08X/0x%02X/%d", fw.SiliconID, fw.SiliconRev, fw.ChecksumType)
+	}
+	if len(fw.Rows) != 8 {
+		t.Fatalf("rows = %d, want 8", len(fw.Rows))
+	}
+	for i, row := range fw.Rows {
+		if row.ArrayID != 1 || row.RowNum != uint16(0x20+i) || len(row.Data) != 64 {
+			t.Errorf("row %d = array %d row 0x%04X (%d bytes)", i, row.ArrayID, row.RowNum, len(row.Data))
+		}
+	}
+
+	// The same options produce the same image, another seed another one
+	again, _ := Generate(opts)
+	if !bytes.Equal(content, again) {
+		t.Error("same options generated different images")
+	}
+	opts.Seed++
+	other, _ := Generate(opts)
+	if bytes.Equal(content, other) {
+		t.Error("different seeds generated the same image")
+	}
+
+	want, err := Firmware(Options{})
+	if err != nil {
+		t.Fatalf("Firmware: %v", err)
+	}
+	if want.SiliconID != DefaultSiliconID || len(want.Rows) != DefaultRows || len(want.Rows[0].Data) != DefaultRowSize {
+		t.Errorf("defaults: 0x%08X, %d rows of %d bytes", want.SiliconID, len(want.Rows), len(want.Rows[0].Data))
+	}
+}
+
+func TestGenerateDefects(t *testing.T) {
+	tests := []struct {
+		kind DefectKind
+		want string // parse error substring, "" if the image still parses
+	}{
+		{DefectChecksum, "checksum mismatch"},
+		{DefectLength, "data length mismatch"},
+		{DefectHex, "invalid hex"},
+		{DefectTruncated, "line 3"},
+		{DefectDuplicateRow, ""},
+		{DefectHeader, "header"},
+	}
+	for _, tt := range tests {
+		content, err := Generate(Options{Defects: []Defect{{Kind: tt.kind, Row: 1}}})
+		if err != nil {
+			t.Fatalf("kind %d: Generate: %v", tt.kind, err)
+		}
+		fw, err := cyacd.ParseReader(bytes.NewReader(content))
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("kind %d: unexpected error %v", tt.kind, err)
+		case tt.want == "" && len(fw.Rows) != DefaultRows+1:
+			t.Errorf("kind %d: %d rows, want %d", tt.kind, len(fw.Rows), DefaultRows+1)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("kind %d: err = %v, want %q", tt.kind, err, tt.want)
+		}
+	}
+
+	if _, err := Generate(Options{Defects: []Defect{{Kind: DefectChecksum, Row: DefaultRows}}}); err == nil {
+		t.Error("defect outside the image: no error")
+	}
+	if _, err := Generate(Options{RowSize: 0x10000}); err == nil {
+		t.Error("oversized rows: no error")
+	}
+}
@@ -0,0 +1,339 @@
+package cybtldr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Status codes returned by the functions of this package, with the values of
+// the CYRET_* codes of the C library.
+const (
+	Success     = 0x00 // CYRET_SUCCESS
+	ErrFile     = 0x01 // CYRET_ERR_FILE: the file could not be opened or parsed
+	ErrEOF      = 0x02 // CYRET_ERR_EOF: the file ended unexpectedly
+	ErrLength   = 0x03 // CYRET_ERR_LENGTH: data amount outside the expected range
+	ErrData     = 0x04 // CYRET_ERR_DATA: data not of the proper form
+	ErrCmd      = 0x05 // CYRET_ERR_CMD: command not recognized
+	ErrDevice   = 0x06 // CYRET_ERR_DEVICE: the silicon ID does not match the file
+	ErrVersion  = 0x07 // CYRET_ERR_VERSION: the silicon revision does not match the file
+	ErrChecksum = 0x08 // CYRET_ERR_CHECKSUM: a row or application checksum does not match
+	ErrArray    = 0x09 // CYRET_ERR_ARRAY: invalid flash array
+	ErrRow      = 0x0A // CYRET_ERR_ROW: invalid flash row
+	ErrBtldr    = 0x0B // CYRET_ERR_BTLDR: the bootloader is not ready
+	ErrActive   = 0x0C // CYRET_ERR_ACTIVE: the application is active and cannot be replaced
+	ErrUnk      = 0x0F // CYRET_ERR_UNK: unknown error
+	Aborted     = 0xFF // CYRET_ABORT: the operation was stopped by Abort
+
+	// CommErrMask is set in codes returned by a CommunicationsData callback
+	// or caused by a transport failure such as a read timeout.
+	CommErrMask = 0x2000 // CYRET_ERR_COMM_MASK
+
+	// BtldrErrMask is set in codes reporting a status returned by the
+	// bootloader, held in the low byte.
+	BtldrErrMask = 0x4000 // CYRET_ERR_BTLDR_MASK
+)
+
+// NoApp is passed as the application ID of Program for single-application
+// bootloaders (INVALID_APP in the C library).
+const NoApp = 0xFF
+
+// CommunicationsData holds the transport callbacks, like
+// CyBtldr_CommunicationsData. Each callback returns Success or an error code,
+// which is returned with CommErrMask set.
+type CommunicationsData struct {
+	// OpenConnection is called before the operation starts.
+	OpenConnection func() int
+
+	// CloseConnection is called when the operation ends.
+	CloseConnection func() int
+
+	// ReadData fills buf with data received from the device. buf is never
+	// longer than MaxTransferSize.
+	ReadData func(buf []byte) int
+
+	// WriteData sends buf to the device. buf is never longer than
+	// MaxTransferSize.
+	WriteData func(buf []byte) int
+
+	// MaxTransferSize is the largest transfer of the transport, e.g. 64 for
+	// USB HID. Send Data chunks are sized to fit.
+	MaxTransferSize int
+}
+
+// ProgressUpdate is called after each row is processed, like
+// CyBtldr_ProgressUpdate.
+type ProgressUpdate func(arrayID byte, rowNum uint16)
+
+// Program programs the .cyacd or .cyacd2 file into the device and verifies
+// it, like CyBtldr_Program. For multi-application bootloaders, appID names the
+// application slot, which must not be the active one and is made active once
+// programmed; pass NoApp otherwise. The key is ignored for .cyacd2 files,
+// which carry their own product ID. update may be nil.
+func Program(file string, securityKey []byte, appID byte, comm *CommunicationsData, update ProgressUpdate) int {
+	if strings.EqualFold(filepath.Ext(file), ".cyacd2") {
+		fw, err := cyacd.Parse2(file)
+		if err != nil {
+			return ErrFile
+		}
+		return run(comm, update, func(ctx context.Context, prog *bootloader.Programmer) error {
+			return prog.ProgramV2(ctx, fw)
+		})
+	}
+
+	fw, err := cyacd.Parse(file)
+	if err != nil {
+		return ErrFile
+	}
+	return run(comm, update, func(ctx context.Context, prog *bootloader.Programmer) error {
+		if _, err := prog.Connect(ctx, securityKey); err != nil {
+			return err
+		}
+		defer prog.Close(context.WithoutCancel(ctx))
+
+		if appID != NoApp {
+			status, err := prog.GetAppStatus(ctx, appID)
+			if err != nil {
+				return err
+			}
+			if status.Active {
+				return errActive
+			}
+		}
+		if err := prog.Program(ctx, fw, nil); err != nil {
+			return err
+		}
+		if appID != NoApp {
+			return prog.SetActiveApp(ctx, appID)
+		}
+		return nil
+	})
+}
+
+// Verify compares the rows of the .cyacd file with the device flash using
+// row checksums and then checks the application checksum, like
+// CyBtldr_Verify. update may be nil.
+func Verify(file string, securityKey []byte, comm *CommunicationsData, update ProgressUpdate) int {
+	fw, err := cyacd.Parse(file)
+	if err != nil {
+		return ErrFile
+	}
+	return run(comm, nil, func(ctx context.Context, prog *bootloader.Programmer) error {
+		if _, err := prog.Connect(ctx, securityKey); err != nil {
+			return err
+		}
+		defer prog.Close(context.WithoutCancel(ctx))
+
+		for _, row := range fw.Rows {
+			checksum, err := prog.VerifyRow(ctx, row.ArrayID, row.RowNum)
+			if err != nil {
+				return err
+			}
+			expected := protocol.CalculateRowChecksumWithMetadata(row.Checksum, row.ArrayID, row.RowNum, uint16(len(row.Data)))
+			if checksum != expected {
+				return &bootloader.ChecksumMismatchError{RowNum: row.RowNum, Expected: expected, Actual: checksum}
+			}
+			if update != nil {
+				update(row.ArrayID, row.RowNum)
+			}
+		}
+
+		valid, err := prog.VerifyChecksum(ctx)
+		if err == nil && !valid {
+			err = &bootloader.VerificationError{Reason: "application checksum invalid"}
+		}
+		return err
+	})
+}
+
+// Erase erases the flash rows used by the .cyacd file, like CyBtldr_Erase.
+// update may be nil.
+func Erase(file string, securityKey []byte, comm *CommunicationsData, update ProgressUpdate) int {
+	fw, err := cyacd.Parse(file)
+	if err != nil {
+		return ErrFile
+	}
+	return run(comm, nil, func(ctx context.Context, prog *bootloader.Programmer) error {
+		if _, err := prog.Connect(ctx, securityKey); err != nil {
+			return err
+		}
+		defer prog.Close(context.WithoutCancel(ctx))
+
+		for _, row := range fw.Rows {
+			if err := prog.EraseRow(ctx, row.ArrayID, row.RowNum); err != nil {
+				return err
+			}
+			if update != nil {
+				update(row.ArrayID, row.RowNum)
+			}
+		}
+		return nil
+	})
+}
+
+// errAborted is the cancellation cause of operations stopped by Abort.
+var errAborted = errors.New("aborted")
+
+// errActive reports that Program was asked to replace the active application.
+var errActive = errors.New("application is active")
+
+// running holds the cancel functions of the operations in progress.
+var running struct {
+	sync.Mutex
+	next    int
+	cancels map[int]context.CancelCauseFunc
+}
+
+// Abort stops the operations in progress, like CyBtldr_Abort. They return
+// Aborted once the command in flight completes.
+func Abort() int {
+	running.Lock()
+	defer running.Unlock()
+	for _, cancel := range running.cancels {
+		cancel(errAborted)
+	}
+	return Success
+}
+
+// run opens the connection, runs op with a Programmer for it, closes the
+// connection, and returns the status code of the outcome.
+func run(comm *CommunicationsData, update ProgressUpdate, op func(context.Context, *bootloader.Programmer) error) int {
+	if comm == nil || comm.ReadData == nil || comm.WriteData == nil {
+		return ErrUnk
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	running.Lock()
+	if running.cancels == nil {
+		running.cancels = make(map[int]context.CancelCauseFunc)
+	}
+	id := running.next
+	running.next++
+	running.cancels[id] = cancel
+	running.Unlock()
+	defer func() {
+		running.Lock()
+		delete(running.cancels, id)
+		running.Unlock()
+		cancel(nil)
+	}()
+
+	if comm.OpenConnection != nil {
+		if code := comm.OpenConnection(); code != Success {
+			return CommErrMask | code
+		}
+	}
+
+	var opts []bootloader.Option
+	if comm.MaxTransferSize > 0 {
+		opts = append(opts, bootloader.WithChunkSize(min(comm.MaxTransferSize-protocol.SendDataOverhead, bootloader.MaxChunkSize)))
+	}
+	if update != nil {
+		opts = append(opts, bootloader.WithRowCallback(func(r bootloader.RowResult) {
+			if r.Err == nil {
+				update(r.ArrayID, r.RowNum)
+			}
+		}))
+	}
+
+	prog, err := bootloader.NewProgrammer(&transport{comm: comm}, opts...)
+	if err == nil {
+		err = op(ctx, prog)
+	}
+
+	if comm.CloseConnection != nil {
+		if code := comm.CloseConnection(); code != Success && err == nil {
+			return CommErrMask | code
+		}
+	}
+	if err != nil && errors.Is(context.Cause(ctx), errAborted) {
+		return Aborted
+	}
+	return status(err)
+}
+
+// status maps the error of an operation to a status code.
+func status(err error) int {
+	if err == nil {
+		return Success
+	}
+
+	var (
+		commErr  *commError
+		protoErr *protocol.ProtocolError
+	)
+	switch {
+	case errors.As(err, &commErr):
+		return CommErrMask | commErr.code
+	case errors.As(err, &protoErr):
+		return BtldrErrMask | int(protoErr.StatusCode)
+	case errors.Is(err, bootloader.ErrDeviceMismatch):
+		return ErrDevice
+	case errors.Is(err, bootloader.ErrSiliconRevMismatch):
+		return ErrVersion
+	case errors.Is(err, bootloader.ErrRowOutOfRange):
+		return ErrRow
+	case errors.Is(err, bootloader.ErrChecksumMismatch), errors.Is(err, bootloader.ErrVerification):
+		return ErrChecksum
+	case errors.Is(err, errActive):
+		return ErrActive
+	case errors.Is(err, bootloader.ErrInvalidOption), errors.Is(err, bootloader.ErrGeometry):
+		return ErrLength
+	case errors.Is(err, bootloader.ErrEncryptionUnsupported):
+		return ErrData
+	case errors.Is(err, context.DeadlineExceeded):
+		return CommErrMask | ErrUnk
+	default:
+		return ErrUnk
+	}
+}
+
+// StatusName returns a description of a status code for messages.
+func StatusName(code int) string {
+	switch {
+	case code&BtldrErrMask != 0:
+		return fmt.Sprintf("bootloader error: %s", protocol.StatusName(byte(code)))
+	case code&CommErrMask != 0:
+		return fmt.Sprintf("communication error 0x%02X", code&^CommErrMask)
+	}
+
+	switch code {
+	case Success:
+		return "success"
+	case ErrFile:
+		return "file error"
+	case ErrEOF:
+		return "unexpected end of file"
+	case ErrLength:
+		return "invalid length"
+	case ErrData:
+		return "invalid data"
+	case ErrCmd:
+		return "unrecognized command"
+	case ErrDevice:
+		return "silicon ID mismatch"
+	case ErrVersion:
+		return "silicon revision mismatch"
+	case ErrChecksum:
+		return "checksum mismatch"
+	case ErrArray:
+		return "invalid flash array"
+	case ErrRow:
+		return "invalid flash row"
+	case ErrBtldr:
+		return "bootloader not ready"
+	case ErrActive:
+		return "application is active"
+	case Aborted:
+		return "aborted"
+	default:
+		return fmt.Sprintf("unknown error 0x%02X", code)
+	}
+}
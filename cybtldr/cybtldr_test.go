@@ -0,0 +1,127 @@
+package cybtldr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+var testKey = []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+
+// writeFirmware writes a .cyacd file with two 64-byte rows and returns its
+// path. The row numbers are chosen so that the header bytes of each row sum
+// to zero, making the file checksums match those of the simulated device.
+func writeFirmware(t *testing.T) string {
+	t.Helper()
+
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fw := &cyacd.Firmware{
+		SiliconID: bootloadertest.DefaultSiliconID,
+		Rows:      []*cyacd.Row{cyacd.NewRow(0, 0x00C0, data), cyacd.NewRow(0, 0x01BF, data)},
+	}
+
+	path := filepath.Join(t.TempDir(), "app.cyacd")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := fw.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newComm returns callbacks for a simulated device, failing the test if a
+// transfer exceeds 64 bytes.
+func newComm(t *testing.T, device *bootloadertest.Device) *CommunicationsData {
+	opened := false
+	return &CommunicationsData{
+		OpenConnection:  func() int { opened = true; return Success },
+		CloseConnection: func() int { opened = false; return Success },
+		ReadData: func(buf []byte) int {
+			if !opened {
+				t.Error("ReadData called on a closed connection")
+			}
+			n, err := device.Read(buf)
+			if err != nil {
+				return ErrUnk
+			}
+			clear(buf[n:])
+			return Success
+		},
+		WriteData: func(buf []byte) int {
+			if len(buf) > 64 {
+				t.Errorf("WriteData of %d bytes exceeds MaxTransferSize", len(buf))
+			}
+			device.Write(buf)
+			return Success
+		},
+		MaxTransferSize: 64,
+	}
+}
+
+func TestProgramVerifyErase(t *testing.T) {
+	path := writeFirmware(t)
+	device := bootloadertest.NewDevice()
+	comm := newComm(t, device)
+
+	var rows []uint16
+	update := func(arrayID byte, rowNum uint16) { rows = append(rows, rowNum) }
+
+	if code := Program(path, testKey, 1, comm, update); code != Success {
+		t.Fatalf("Program = 0x%04X (%s)", code, StatusName(code))
+	}
+	if len(rows) != 2 || rows[0] != 0x00C0 || rows[1] != 0x01BF {
+		t.Errorf("progress updates for rows %v", rows)
+	}
+	if _, ok := device.Row(0, 0x01BF); !ok {
+		t.Error("row 0x01BF not programmed")
+	}
+
+	// Application 1 is now active and cannot be replaced
+	if code := Program(path, testKey, 1, comm, nil); code != ErrActive {
+		t.Errorf("Program over the active application = 0x%04X, want ErrActive", code)
+	}
+
+	if code := Verify(path, testKey, comm, nil); code != Success {
+		t.Errorf("Verify = 0x%04X (%s)", code, StatusName(code))
+	}
+	if code := Erase(path, testKey, comm, nil); code != Success {
+		t.Errorf("Erase = 0x%04X (%s)", code, StatusName(code))
+	}
+	if code := Verify(path, testKey, comm, nil); code != BtldrErrMask|protocol.ErrRow {
+		t.Errorf("Verify after Erase = 0x%04X, want bootloader ErrRow", code)
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	path := writeFirmware(t)
+
+	if code := Program(filepath.Join(t.TempDir(), "missing.cyacd"), testKey, NoApp, newComm(t, bootloadertest.NewDevice()), nil); code != ErrFile {
+		t.Errorf("missing file = 0x%04X, want ErrFile", code)
+	}
+
+	device := bootloadertest.NewDevice(bootloadertest.WithSiliconID(0x04C81193))
+	if code := Program(path, testKey, NoApp, newComm(t, device), nil); code != ErrDevice {
+		t.Errorf("wrong silicon ID = 0x%04X, want ErrDevice", code)
+	}
+
+	comm := newComm(t, bootloadertest.NewDevice())
+	comm.OpenConnection = func() int { return 0x42 }
+	if code := Program(path, testKey, NoApp, comm, nil); code != CommErrMask|0x42 {
+		t.Errorf("failed OpenConnection = 0x%04X, want CommErrMask|0x42", code)
+	}
+
+	aborting := func(byte, uint16) { Abort() }
+	if code := Program(path, testKey, NoApp, newComm(t, bootloadertest.NewDevice()), aborting); code != Aborted {
+		t.Errorf("Program aborted after the first row = 0x%04X, want Aborted", code)
+	}
+}
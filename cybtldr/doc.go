@@ -0,0 +1,43 @@
+// Package cybtldr is a compatibility layer for code ported from the
+// Infineon/Cypress C host library (cybtldr_api2.h). It exposes Program,
+// Verify, Erase, and Abort with the arguments and integer status codes of
+// CyBtldr_Program, CyBtldr_Verify, CyBtldr_Erase, and CyBtldr_Abort, and a
+// CommunicationsData struct of transport callbacks in place of
+// CyBtldr_CommunicationsData, so call sites can be migrated one by one.
+//
+// New code should use the bootloader package directly: it returns typed
+// errors instead of status codes and offers progress, retry, and session
+// options that this package does not expose.
+//
+// # Migrating
+//
+// The C call
+//
+//	CyBtldr_CommunicationsData comm = {
+//	    .OpenConnection = &OpenConnection,
+//	    .CloseConnection = &CloseConnection,
+//	    .ReadData = &ReadData,
+//	    .WriteData = &WriteData,
+//	    .MaxTransferSize = 64,
+//	};
+//	int err = CyBtldr_Program("app.cyacd", key, 0xFF, &comm, &ProgressUpdate);
+//
+// becomes
+//
+//	comm := &cybtldr.CommunicationsData{
+//	    OpenConnection:  openConnection,
+//	    CloseConnection: closeConnection,
+//	    ReadData:        readData,
+//	    WriteData:       writeData,
+//	    MaxTransferSize: 64,
+//	}
+//	err := cybtldr.Program("app.cyacd", key, cybtldr.NoApp, comm, progressUpdate)
+//	if err != cybtldr.Success {
+//	    log.Fatalf("program: %s", cybtldr.StatusName(err))
+//	}
+//
+// ReadData and WriteData receive a slice instead of a pointer and length.
+// Status codes are the CYRET_* values of the C library, including the
+// CommErrMask and BtldrErrMask flags that mark transport and bootloader
+// errors.
+package cybtldr
@@ -0,0 +1,46 @@
+package cybtldr
+
+import "fmt"
+
+// commError is a failure status returned by a CommunicationsData callback.
+type commError struct {
+	op   string
+	code int
+}
+
+func (e *commError) Error() string {
+	return fmt.Sprintf("%s failed with status 0x%02X", e.op, e.code)
+}
+
+// transport adapts the ReadData and WriteData callbacks to the io.ReadWriter
+// the Programmer uses.
+type transport struct {
+	comm *CommunicationsData
+}
+
+// Read reads one transfer of at most MaxTransferSize bytes.
+func (t *transport) Read(p []byte) (int, error) {
+	if t.comm.MaxTransferSize > 0 && len(p) > t.comm.MaxTransferSize {
+		p = p[:t.comm.MaxTransferSize]
+	}
+	if code := t.comm.ReadData(p); code != Success {
+		return 0, &commError{op: "ReadData", code: code}
+	}
+	return len(p), nil
+}
+
+// Write writes p in transfers of at most MaxTransferSize bytes.
+func (t *transport) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		end := len(p)
+		if t.comm.MaxTransferSize > 0 && end-n > t.comm.MaxTransferSize {
+			end = n + t.comm.MaxTransferSize
+		}
+		if code := t.comm.WriteData(p[n:end]); code != Success {
+			return n, &commError{op: "WriteData", code: code}
+		}
+		n = end
+	}
+	return n, nil
+}
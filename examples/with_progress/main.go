@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/moffa90/go-cyacd/bootloader"
 	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/progressui"
 )
 
 // MockDevice simulates a bootloader device for demonstration
@@ -25,25 +25,6 @@ func (d *MockDevice) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
-// ProgressBar renders a visual progress bar
-type ProgressBar struct {
-	width int
-}
-
-func NewProgressBar(width int) *ProgressBar {
-	return &ProgressBar{width: width}
-}
-
-func (pb *ProgressBar) Render(percentage float64) string {
-	filled := int(float64(pb.width) * percentage / 100.0)
-	if filled > pb.width {
-		filled = pb.width
-	}
-
-	bar := strings.Repeat("█", filled) + strings.Repeat("░", pb.width-filled)
-	return fmt.Sprintf("[%s] %.1f%%", bar, percentage)
-}
-
 func main() {
 	fmt.Println("=== Cypress Bootloader - Progress Tracking Example ===")
 
@@ -55,8 +36,7 @@ func main() {
 		fmt.Println("  - Visual progress bar")
 		fmt.Println("  - Current phase (entering, programming, verifying, etc.)")
 		fmt.Println("  - Row count and percentage")
-		fmt.Println("  - Bytes written")
-		fmt.Println("  - Elapsed time")
+		fmt.Println("  - Throughput")
 		fmt.Println("  - Estimated time remaining")
 		os.Exit(1)
 	}
@@ -73,49 +53,13 @@ func main() {
 	// Create mock device (replace with your actual hardware)
 	device := &MockDevice{}
 
-	// Setup progress tracking
-	progressBar := NewProgressBar(40)
+	// Render progress with the progressui package: phase, bar, rows,
+	// throughput, and ETA, redrawn in place on a terminal
+	bar := progressui.New(os.Stdout, progressui.WithWidth(40))
 	startTime := time.Now()
-	var lastPhase bootloader.Phase
-
-	progressCallback := func(p bootloader.Progress) {
-		// Clear line and move cursor to beginning
-		fmt.Print("\r\033[K")
-
-		// Print phase header if changed
-		if p.Phase != lastPhase {
-			if lastPhase != "" {
-				fmt.Println() // New line after previous phase
-			}
-			fmt.Printf("\n📦 Phase: %s\n", strings.ToUpper(string(p.Phase)))
-			lastPhase = p.Phase
-		}
-
-		// Calculate ETA
-		elapsed := p.ElapsedTime
-		var eta time.Duration
-		if p.Percentage > 0 {
-			totalEstimate := time.Duration(float64(elapsed) * 100.0 / p.Percentage)
-			eta = totalEstimate - elapsed
-		}
-
-		// Render progress bar
-		bar := progressBar.Render(p.Percentage)
-
-		// Print detailed progress
-		fmt.Printf("%s | Row %d/%d | %d bytes | Elapsed: %s | ETA: %s",
-			bar,
-			p.CurrentRow,
-			p.TotalRows,
-			p.BytesWritten,
-			elapsed.Round(time.Second),
-			eta.Round(time.Second),
-		)
-	}
 
-	// Create programmer with progress callback
 	prog := bootloader.New(device,
-		bootloader.WithProgressCallback(progressCallback),
+		bootloader.WithProgressCallback(bar.Update),
 		bootloader.WithVerifyAfterProgram(true),
 	)
 
@@ -125,9 +69,7 @@ func main() {
 
 	ctx := context.Background()
 	err = prog.Program(ctx, fw, key)
-
-	// Final status
-	fmt.Println() // New line after progress
+	bar.Finish()
 	fmt.Println()
 
 	if err != nil {
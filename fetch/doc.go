@@ -0,0 +1,34 @@
+// Package fetch downloads firmware images over HTTPS for OTA agents that pull
+// updates from a release server. Downloads are bounded in size, checked
+// against an expected SHA-256 digest and ETag, and resumed with HTTP range
+// requests when the connection drops part way through, so a flaky cellular
+// link does not have to start a large image over.
+//
+// Example:
+//
+//	fw, err := fetch.Firmware(ctx, "https://updates.example.com/app-1.4.cyacd",
+//	    fetch.WithSHA256("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"),
+//	    fetch.WithHeader("Authorization", "Bearer "+token),
+//	)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = prog.Program(ctx, fw, key)
+//
+// # Resuming
+//
+// A transfer that times out, loses its connection, is cut short, or gets a
+// 5xx, 408 or 429 status is retried (see WithRetries); other errors, such as
+// a failed TLS handshake, are returned at once. When the server identified the image
+// with a strong ETag or a Last-Modified date, the retry asks only for the
+// missing bytes with a Range request guarded by If-Range; if the image
+// changed in the meantime, the server sends it whole and the download starts
+// over. Servers without range support are downloaded from the start.
+//
+// # Security
+//
+// Plain http:// URLs are refused unless WithAllowHTTP is given, including
+// redirects from an https:// URL to an http:// one. TLS protects
+// the transfer; WithSHA256 additionally pins the content to the digest
+// published with the release, which is what a device should trust.
+package fetch
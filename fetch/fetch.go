@@ -0,0 +1,391 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// Default configuration values.
+const (
+	// DefaultMaxSize is the default limit on the size of a download
+	DefaultMaxSize = 16 << 20
+
+	// DefaultRetries is the default number of retries after a failed transfer
+	DefaultRetries = 3
+
+	// DefaultRetryDelay is the default pause before each retry
+	DefaultRetryDelay = time.Second
+)
+
+var (
+	// ErrTooLarge is returned when a download exceeds the size limit set
+	// with WithMaxSize.
+	ErrTooLarge = errors.New("download exceeds the size limit")
+
+	// ErrDigestMismatch is returned when the downloaded image does not match
+	// the digest set with WithSHA256.
+	ErrDigestMismatch = errors.New("download does not match the expected digest")
+
+	// ErrETagMismatch is returned when the server identifies the image with
+	// an ETag other than the one set with WithETag.
+	ErrETagMismatch = errors.New("download does not match the expected ETag")
+)
+
+// StatusError is returned when the server answers with an unexpected HTTP
+// status. Server errors (5xx), 408, and 429 are retried; other statuses are not.
+type StatusError struct {
+	// URL is the requested URL
+	URL string
+
+	// StatusCode is the HTTP status code, e.g. 404
+	StatusCode int
+
+	// Status is the status line, e.g. "404 Not Found"
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URL, e.Status)
+}
+
+// Temporary reports whether the request may succeed when retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Option configures a download.
+type Option func(*config)
+
+type config struct {
+	client     *http.Client
+	header     http.Header
+	maxSize    int64
+	digest     []byte
+	digestHex  string
+	etag       string
+	retries    int
+	retryDelay time.Duration
+	allowHTTP  bool
+	optionErr  error
+}
+
+// WithHTTPClient sets the client used for requests, e.g. one with a custom
+// TLS configuration or a proxy. Default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithHeader adds a request header, e.g. an Authorization token of the
+// release server.
+func WithHeader(key, value string) Option {
+	return func(c *config) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithMaxSize limits the size of the download; larger images fail with
+// ErrTooLarge. Default is DefaultMaxSize (16 MiB).
+func WithMaxSize(size int64) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.maxSize = size
+		}
+	}
+}
+
+// WithSHA256 sets the expected SHA-256 digest of the image as a hex string;
+// a download that does not match fails with ErrDigestMismatch. Default is no
+// digest check.
+func WithSHA256(digest string) Option {
+	return func(c *config) {
+		sum, err := hex.DecodeString(digest)
+		if err != nil || len(sum) != sha256.Size {
+			c.optionErr = fmt.Errorf("invalid SHA-256 digest %q", digest)
+			return
+		}
+		c.digest, c.digestHex = sum, strings.ToLower(digest)
+	}
+}
+
+// WithETag sets the ETag the server must identify the image with, such as
+// the one recorded when the release was published; any other ETag fails with
+// ErrETagMismatch before the body is read. Default is no ETag check.
+func WithETag(etag string) Option {
+	return func(c *config) {
+		c.etag = etag
+	}
+}
+
+// WithRetries sets how many times a failed transfer is retried, pausing for
+// delay before each retry. Retries resume where the transfer stopped when the
+// server supports it. Default is DefaultRetries after DefaultRetryDelay.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(c *config) {
+		if retries >= 0 {
+			c.retries = retries
+		}
+		if delay >= 0 {
+			c.retryDelay = delay
+		}
+	}
+}
+
+// WithAllowHTTP allows plain http:// URLs, e.g. for a server on a trusted
+// local network. Use it together with WithSHA256. Default is HTTPS only.
+func WithAllowHTTP() Option {
+	return func(c *config) {
+		c.allowHTTP = true
+	}
+}
+
+// Result is a completed download. Returned by Fetch.
+type Result struct {
+	// Data is the downloaded image
+	Data []byte
+
+	// ETag is the ETag the server identified the image with (empty if none)
+	ETag string
+
+	// SHA256 is the hex SHA-256 digest of Data
+	SHA256 string
+
+	// Resumes is the number of times the transfer was resumed with a range
+	// request after an interruption
+	Resumes int
+}
+
+// Fetch downloads the image at rawURL.
+//
+// Example:
+//
+//	res, err := fetch.Fetch(ctx, url, fetch.WithSHA256(digest), fetch.WithMaxSize(4<<20))
+//	if errors.Is(err, fetch.ErrDigestMismatch) {
+//	    log.Print("corrupted or tampered image")
+//	}
+func Fetch(ctx context.Context, rawURL string, opts ...Option) (*Result, error) {
+	cfg := config{
+		client:     http.DefaultClient,
+		header:     make(http.Header),
+		maxSize:    DefaultMaxSize,
+		retries:    DefaultRetries,
+		retryDelay: DefaultRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.optionErr != nil {
+		return nil, cfg.optionErr
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && cfg.allowHTTP:
+	default:
+		return nil, fmt.Errorf("fetch %s: only https URLs are allowed", u.Redacted())
+	}
+
+	// Hold redirects to the same rule as the URL, on a copy of the client so
+	// that a shared one is left alone
+	client := *cfg.client
+	checkRedirect := cfg.client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" && !(req.URL.Scheme == "http" && cfg.allowHTTP) {
+			return fmt.Errorf("redirect to %s: only https URLs are allowed", req.URL.Redacted())
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	cfg.client = &client
+
+	d := &download{cfg: &cfg, url: u.String()}
+	for attempt := 0; ; attempt++ {
+		resumed, err := d.get(ctx)
+		if resumed {
+			d.resumes++
+		}
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil || !retryable(err) || attempt >= cfg.retries {
+			return nil, err
+		}
+		if err := sleep(ctx, cfg.retryDelay); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := sha256.Sum256(d.data)
+	if cfg.digest != nil && !bytes.Equal(sum[:], cfg.digest) {
+		return nil, fmt.Errorf("%w: got %x, want %s", ErrDigestMismatch, sum, cfg.digestHex)
+	}
+	return &Result{Data: d.data, ETag: d.etag, SHA256: hex.EncodeToString(sum[:]), Resumes: d.resumes}, nil
+}
+
+// Firmware downloads and parses a .cyacd image.
+func Firmware(ctx context.Context, rawURL string, opts ...Option) (*cyacd.Firmware, error) {
+	res, err := Fetch(ctx, rawURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cyacd.ParseReader(bytes.NewReader(res.Data))
+}
+
+// Firmware2 downloads and parses a .cyacd2 image.
+func Firmware2(ctx context.Context, rawURL string, opts ...Option) (*cyacd.Firmware2, error) {
+	res, err := Fetch(ctx, rawURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cyacd.ParseReader2(bytes.NewReader(res.Data))
+}
+
+// download is the state of a transfer across retries.
+type download struct {
+	cfg     *config
+	url     string
+	data    []byte
+	etag    string
+	resumes int
+
+	// validator is the strong ETag or Last-Modified date of the image, for
+	// If-Range on resume (empty if the transfer cannot be resumed)
+	validator string
+}
+
+// get requests the image, or its missing part if some of it was received,
+// and appends the body to d.data. resumed reports whether the server
+// continued a partial transfer.
+func (d *download) get(ctx context.Context) (resumed bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return false, err
+	}
+	for key, values := range d.cfg.header {
+		req.Header[key] = values
+	}
+	if len(d.data) > 0 && d.validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(d.data)))
+		req.Header.Set("If-Range", d.validator)
+	} else {
+		d.data = d.data[:0]
+	}
+
+	resp, err := d.cfg.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		d.data = d.data[:0]
+	case http.StatusPartialContent:
+		if start, ok := rangeStart(resp.Header.Get("Content-Range")); !ok || start != int64(len(d.data)) {
+			d.data, d.validator = d.data[:0], ""
+			return false, fmt.Errorf("fetch %s: %w %q", d.url, errUnexpectedRange, resp.Header.Get("Content-Range"))
+		}
+		resumed = true
+	default:
+		return false, &StatusError{URL: d.url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	d.etag = resp.Header.Get("ETag")
+	if d.cfg.etag != "" && d.etag != d.cfg.etag {
+		return resumed, fmt.Errorf("%w: got %q, want %q", ErrETagMismatch, d.etag, d.cfg.etag)
+	}
+	d.validator = resp.Header.Get("Last-Modified")
+	if d.etag != "" && !strings.HasPrefix(d.etag, "W/") {
+		d.validator = d.etag
+	}
+
+	remaining := d.cfg.maxSize - int64(len(d.data))
+	if resp.ContentLength > remaining {
+		return resumed, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, int64(len(d.data))+resp.ContentLength, d.cfg.maxSize)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, remaining+1))
+	d.data = append(d.data, body...)
+	if int64(len(d.data)) > d.cfg.maxSize {
+		return resumed, fmt.Errorf("%w: limit %d bytes", ErrTooLarge, d.cfg.maxSize)
+	}
+	if err != nil {
+		return resumed, fmt.Errorf("fetch %s: %w", d.url, err)
+	}
+	return resumed, nil
+}
+
+// errUnexpectedRange reports a partial response that does not continue the
+// transfer. The received data is dropped, so a retry starts over.
+var errUnexpectedRange = errors.New("unexpected range")
+
+// retryable reports whether a transfer that failed with err may succeed when
+// retried: timeouts, cut off or reset connections, temporary HTTP statuses
+// and unusable partial responses. Any other error, such as a TLS failure or
+// a refused redirect, is final.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, errUnexpectedRange)
+}
+
+// rangeStart returns the first byte position of a Content-Range header such
+// as "bytes 1024-2047/4096".
+func rangeStart(contentRange string) (int64, bool) {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	return start, err == nil
+}
+
+// sleep pauses for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,262 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// server serves image with an ETag and range support. The first interrupt
+// requests are cut off after half of the body.
+type server struct {
+	image     []byte
+	etag      string
+	interrupt int
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	cut := len(s.requests) <= s.interrupt
+	s.mu.Unlock()
+
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	if cut && r.Header.Get("Range") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.image)))
+		w.Write(s.image[:len(s.image)/2])
+		return
+	}
+	http.ServeContent(w, r, "app.cyacd", time.Time{}, bytes.NewReader(s.image))
+}
+
+func testImage(t *testing.T) ([]byte, string) {
+	t.Helper()
+	fw := &cyacd.Firmware{SiliconID: 0x1E9602AA}
+	for i := 0; i < 32; i++ {
+		fw.Rows = append(fw.Rows, cyacd.NewRow(0, uint16(0x10+i), bytes.Repeat([]byte{byte(i)}, 128)))
+	}
+	var image bytes.Buffer
+	if _, err := fw.WriteTo(&image); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(image.Bytes())
+	return image.Bytes(), hex.EncodeToString(sum[:])
+}
+
+func TestFetch(t *testing.T) {
+	image, digest := testImage(t)
+	s := &server{image: image, etag: `"v1.4"`}
+	ts := httptest.NewTLSServer(s)
+	defer ts.Close()
+
+	res, err := Fetch(context.Background(), ts.URL+"/app.cyacd", WithHTTPClient(ts.Client()), WithSHA256(digest), WithETag(`"v1.4"`))
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if !bytes.Equal(res.Data, image) || res.SHA256 != digest || res.ETag != `"v1.4"` || res.Resumes != 0 {
+		t.Errorf("Fetch() = %d bytes, digest %s, ETag %s, %d resumes", len(res.Data), res.SHA256, res.ETag, res.Resumes)
+	}
+
+	fw, err := Firmware(context.Background(), ts.URL+"/app.cyacd", WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatalf("Firmware() error = %v", err)
+	}
+	if len(fw.Rows) != 32 {
+		t.Errorf("Firmware() has %d rows, want 32", len(fw.Rows))
+	}
+}
+
+func TestFetchResume(t *testing.T) {
+	image, digest := testImage(t)
+
+	t.Run("range", func(t *testing.T) {
+		s := &server{image: image, etag: `"v1.4"`, interrupt: 1}
+		ts := httptest.NewTLSServer(s)
+		defer ts.Close()
+
+		res, err := Fetch(context.Background(), ts.URL, WithHTTPClient(ts.Client()), WithSHA256(digest), WithRetries(1, 0))
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if res.Resumes != 1 || !bytes.Equal(res.Data, image) {
+			t.Errorf("%d resumes, %d bytes", res.Resumes, len(res.Data))
+		}
+		if len(s.requests) != 2 {
+			t.Fatalf("%d requests, want 2", len(s.requests))
+		}
+		resume := s.requests[1]
+		if want := "bytes=" + strconv.Itoa(len(image)/2) + "-"; resume.Header.Get("Range") != want {
+			t.Errorf("Range = %q, want %q", resume.Header.Get("Range"), want)
+		}
+		if resume.Header.Get("If-Range") != `"v1.4"` {
+			t.Errorf("If-Range = %q", resume.Header.Get("If-Range"))
+		}
+	})
+
+	t.Run("no validator", func(t *testing.T) {
+		s := &server{image: image, interrupt: 1}
+		ts := httptest.NewTLSServer(s)
+		defer ts.Close()
+
+		res, err := Fetch(context.Background(), ts.URL, WithHTTPClient(ts.Client()), WithSHA256(digest), WithRetries(1, 0))
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if res.Resumes != 0 || s.requests[1].Header.Get("Range") != "" {
+			t.Error("transfer without a validator resumed instead of starting over")
+		}
+	})
+
+	t.Run("out of retries", func(t *testing.T) {
+		s := &server{image: image, interrupt: 3}
+		ts := httptest.NewTLSServer(s)
+		defer ts.Close()
+
+		if _, err := Fetch(context.Background(), ts.URL, WithHTTPClient(ts.Client()), WithRetries(2, 0)); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(s.requests) != 3 {
+			t.Errorf("%d requests, want 3", len(s.requests))
+		}
+	})
+}
+
+func TestFetchErrors(t *testing.T) {
+	image, _ := testImage(t)
+	s := &server{image: image, etag: `"v1.4"`}
+	ts := httptest.NewTLSServer(s)
+	defer ts.Close()
+	ctx := context.Background()
+	client := WithHTTPClient(ts.Client())
+
+	if _, err := Fetch(ctx, ts.URL, client, WithSHA256(hex.EncodeToString(make([]byte, sha256.Size)))); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("wrong digest: got %v", err)
+	}
+	if _, err := Fetch(ctx, ts.URL, client, WithETag(`"v1.3"`)); !errors.Is(err, ErrETagMismatch) {
+		t.Errorf("wrong ETag: got %v", err)
+	}
+	if _, err := Fetch(ctx, ts.URL, client, WithMaxSize(1024)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("too large: got %v", err)
+	}
+	if _, err := Fetch(ctx, ts.URL, client, WithSHA256("abc")); err == nil {
+		t.Error("invalid digest accepted")
+	}
+
+	plain := httptest.NewServer(s)
+	defer plain.Close()
+	if _, err := Fetch(ctx, plain.URL, WithRetries(0, 0)); err == nil {
+		t.Error("http URL accepted without WithAllowHTTP")
+	}
+	if _, err := Fetch(ctx, plain.URL, WithAllowHTTP()); err != nil {
+		t.Errorf("http URL with WithAllowHTTP: %v", err)
+	}
+
+	// Not found is final; server errors are retried
+	for _, code := range []int{http.StatusNotFound, http.StatusServiceUnavailable} {
+		requests := 0
+		failing := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(code)
+		}))
+		_, err := Fetch(ctx, failing.URL, WithHTTPClient(failing.Client()), WithRetries(2, 0))
+		failing.Close()
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != code {
+			t.Errorf("status %d: got %v", code, err)
+		}
+		want := 1
+		if code >= 500 {
+			want = 3
+		}
+		if requests != want {
+			t.Errorf("status %d: %d requests, want %d", code, requests, want)
+		}
+	}
+}
+
+func TestFetchRedirectToHTTP(t *testing.T) {
+	image, _ := testImage(t)
+	plain := httptest.NewServer(&server{image: image})
+	defer plain.Close()
+	redirect := httptest.NewTLSServer(http.RedirectHandler(plain.URL+"/app.cyacd", http.StatusFound))
+	defer redirect.Close()
+	ctx := context.Background()
+
+	client := redirect.Client()
+	if _, err := Fetch(ctx, redirect.URL, WithHTTPClient(client), WithRetries(2, 0)); err == nil {
+		t.Error("redirect to http followed without WithAllowHTTP")
+	}
+	if client.CheckRedirect != nil {
+		t.Error("Fetch() changed the configured client")
+	}
+	res, err := Fetch(ctx, redirect.URL, WithHTTPClient(client), WithAllowHTTP())
+	if err != nil {
+		t.Fatalf("redirect to http with WithAllowHTTP: %v", err)
+	}
+	if !bytes.Equal(res.Data, image) {
+		t.Errorf("Fetch() = %d bytes, want %d", len(res.Data), len(image))
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	image, _ := testImage(t)
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(image)
+	}))
+	defer ts.Close()
+
+	// The default client does not trust the test certificate
+	if _, err := Fetch(context.Background(), ts.URL, WithRetries(2, 0)); err == nil {
+		t.Fatal("untrusted certificate accepted")
+	}
+	if requests != 0 {
+		t.Errorf("%d requests reached the handler", requests)
+	}
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("fetch: %w", io.ErrUnexpectedEOF), true},
+		{&url.Error{Op: "Get", URL: "https://x", Err: syscall.ECONNRESET}, true},
+		{&url.Error{Op: "Get", URL: "https://x", Err: timeoutError{}}, true},
+		{&StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&StatusError{StatusCode: http.StatusForbidden}, false},
+		{fmt.Errorf("fetch: %w", ErrTooLarge), false},
+		{&url.Error{Op: "Get", URL: "ftp://x", Err: errors.New("unsupported protocol scheme")}, false},
+		{errors.New("malformed HTTP response"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
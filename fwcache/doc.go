@@ -0,0 +1,34 @@
+// Package fwcache caches firmware images on disk by content, so an agent that
+// flashes the same release to many devices downloads, parses, and checks it
+// once.
+//
+// Downloaded files are stored under their SHA-256 digest, the digest an
+// update command already carries, and parsed .cyacd images under their
+// cyacd.Firmware.Fingerprint. Every entry is checked against its key when it
+// is read back, so a truncated or corrupted file is dropped and fetched again
+// rather than programmed. Parsed images are also kept in memory for the life
+// of the Cache.
+//
+// Example:
+//
+//	cache, err := fwcache.Open("/var/cache/cyacd")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	// Downloaded on the first call, read from the cache on the next ones
+//	fw, err := cache.Firmware(ctx, "https://updates.example.com/app-1.4.cyacd",
+//	    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = prog.Program(ctx, fw, key)
+//
+// # Layout
+//
+// The cache directory holds two subdirectories: artifacts, with downloaded
+// files named by their digest, and firmware, with images stored by Put in
+// canonical .cyacd form named by their fingerprint. Files are written to a
+// temporary name and renamed into place, so several processes can share a
+// directory. Nothing is evicted; remove entries with Remove, or the directory
+// itself, when a release is retired.
+package fwcache
@@ -0,0 +1,328 @@
+package fwcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/fetch"
+)
+
+// Subdirectories of the cache directory.
+const (
+	artifactDir = "artifacts"
+	firmwareDir = "firmware"
+)
+
+// ErrNotFound is returned when an entry is not in the cache, or was dropped
+// because it no longer matched its key.
+var ErrNotFound = errors.New("not in the firmware cache")
+
+// Cache is a content-addressed store of firmware images in a directory.
+// Cache is safe for concurrent use; concurrent downloads of the same digest
+// share one transfer.
+type Cache struct {
+	dir string
+
+	mu sync.Mutex
+	// firmware holds the parsed images by fingerprint
+	firmware map[string]*cyacd.Firmware
+	// digests maps the digest of a downloaded file to its fingerprint
+	digests map[string]string
+	// inflight holds the downloads in progress by digest
+	inflight map[string]*download
+}
+
+// download is a transfer shared by the callers asking for the same digest.
+type download struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// Open returns the cache stored in dir, creating the directory if needed.
+func Open(dir string) (*Cache, error) {
+	for _, sub := range []string{artifactDir, firmwareDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("open firmware cache: %w", err)
+		}
+	}
+	return &Cache{
+		dir:      dir,
+		firmware: make(map[string]*cyacd.Firmware),
+		digests:  make(map[string]string),
+		inflight: make(map[string]*download),
+	}, nil
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Put stores fw under its fingerprint and returns the fingerprint.
+//
+// Example:
+//
+//	fp, err := cache.Put(merged)
+//	// later, in this process or another one
+//	fw, err := cache.Get(fp)
+func (c *Cache) Put(fw *cyacd.Firmware) (string, error) {
+	var buf bytes.Buffer
+	if _, err := fw.WriteTo(&buf); err != nil {
+		return "", fmt.Errorf("cache firmware: %w", err)
+	}
+	fp := fw.Fingerprint()
+	if err := c.write(c.firmwarePath(fp), buf.Bytes()); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.firmware[fp] = fw.Clone()
+	c.mu.Unlock()
+	return fp, nil
+}
+
+// Get returns a copy of the image with the given fingerprint. An entry whose
+// contents no longer match the fingerprint is removed and reported as
+// ErrNotFound.
+func (c *Cache) Get(fingerprint string) (*cyacd.Firmware, error) {
+	fingerprint = strings.ToLower(fingerprint)
+	if !validKey(fingerprint) {
+		return nil, fmt.Errorf("invalid fingerprint %q", fingerprint)
+	}
+	c.mu.Lock()
+	fw, ok := c.firmware[fingerprint]
+	c.mu.Unlock()
+	if ok {
+		return fw.Clone(), nil
+	}
+
+	path := c.firmwarePath(fingerprint)
+	data, err := c.read(path)
+	if err != nil {
+		return nil, err
+	}
+	fw, err = cyacd.ParseReader(bytes.NewReader(data))
+	if err != nil || fw.Fingerprint() != fingerprint {
+		os.Remove(path)
+		return nil, ErrNotFound
+	}
+	c.mu.Lock()
+	c.firmware[fingerprint] = fw
+	c.mu.Unlock()
+	return fw.Clone(), nil
+}
+
+// PutArtifact stores a downloaded file under its SHA-256 digest and returns
+// the hex digest.
+func (c *Cache) PutArtifact(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if err := c.write(c.artifactPath(digest), data); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Artifact returns the file with the given hex SHA-256 digest. A file whose
+// contents no longer match the digest is removed and reported as
+// ErrNotFound.
+func (c *Cache) Artifact(digest string) ([]byte, error) {
+	digest = strings.ToLower(digest)
+	if !validKey(digest) {
+		return nil, fmt.Errorf("invalid SHA-256 digest %q", digest)
+	}
+	path := c.artifactPath(digest)
+	data, err := c.read(path)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != digest {
+		os.Remove(path)
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Download returns the file with the given hex SHA-256 digest, downloading it
+// from rawURL with fetch.Fetch if it is not in the cache. The options are
+// passed to fetch.Fetch, which also checks the download against the digest.
+// Callers asking for a digest that is being downloaded wait for that
+// transfer instead of starting their own.
+//
+// Example:
+//
+//	data, err := cache.Download(ctx, cmd.URL, cmd.SHA256, fetch.WithMaxSize(4<<20))
+func (c *Cache) Download(ctx context.Context, rawURL, digest string, opts ...fetch.Option) ([]byte, error) {
+	data, err := c.Artifact(digest)
+	if !errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+	digest = strings.ToLower(digest)
+
+	c.mu.Lock()
+	if d, ok := c.inflight[digest]; ok {
+		c.mu.Unlock()
+		select {
+		case <-d.done:
+			return bytes.Clone(d.data), d.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	d := &download{done: make(chan struct{})}
+	c.inflight[digest] = d
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, digest)
+		c.mu.Unlock()
+		close(d.done)
+	}()
+
+	res, err := fetch.Fetch(ctx, rawURL, append(opts[:len(opts):len(opts)], fetch.WithSHA256(digest))...)
+	if err != nil {
+		d.err = err
+		return nil, err
+	}
+	if _, err := c.PutArtifact(res.Data); err != nil {
+		d.err = err
+		return nil, err
+	}
+	d.data = res.Data
+	return bytes.Clone(res.Data), nil
+}
+
+// Firmware returns a copy of the .cyacd image with the given hex SHA-256
+// digest, downloading it with Download and parsing it on first use. The
+// parsed image is also stored under its fingerprint (see Put), and later
+// calls for the same digest skip the download and the parsing.
+func (c *Cache) Firmware(ctx context.Context, rawURL, digest string, opts ...fetch.Option) (*cyacd.Firmware, error) {
+	c.mu.Lock()
+	fw, ok := c.firmware[c.digests[strings.ToLower(digest)]]
+	c.mu.Unlock()
+	if ok {
+		return fw.Clone(), nil
+	}
+
+	data, err := c.Download(ctx, rawURL, digest, opts...)
+	if err != nil {
+		return nil, err
+	}
+	fw, err = cyacd.ParseReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", rawURL, err)
+	}
+	fp, err := c.Put(fw)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.digests[strings.ToLower(digest)] = fp
+	c.mu.Unlock()
+	return fw, nil
+}
+
+// Firmware2 returns the .cyacd2 image with the given hex SHA-256 digest,
+// downloading it with Download if it is not in the cache.
+func (c *Cache) Firmware2(ctx context.Context, rawURL, digest string, opts ...fetch.Option) (*cyacd.Firmware2, error) {
+	data, err := c.Download(ctx, rawURL, digest, opts...)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := cyacd.ParseReader2(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", rawURL, err)
+	}
+	return fw, nil
+}
+
+// Remove removes the entries stored under key, a digest or a fingerprint.
+// Removing a key that is not in the cache is not an error.
+func (c *Cache) Remove(key string) error {
+	key = strings.ToLower(key)
+	if !validKey(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+	c.mu.Lock()
+	delete(c.firmware, key)
+	delete(c.digests, key)
+	for digest, fp := range c.digests {
+		if fp == key {
+			delete(c.digests, digest)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, path := range []string{c.artifactPath(key), c.firmwarePath(key)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove cache entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Cache) artifactPath(digest string) string {
+	return filepath.Join(c.dir, artifactDir, digest)
+}
+
+func (c *Cache) firmwarePath(fingerprint string) string {
+	return filepath.Join(c.dir, firmwareDir, fingerprint+".cyacd")
+}
+
+// read returns the contents of a cache file, or ErrNotFound if there is none.
+func (c *Cache) read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cache entry: %w", err)
+	}
+	return data, nil
+}
+
+// write replaces the file at path with data, writing it to a temporary file
+// first so readers never see a partial entry.
+func (c *Cache) write(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
+
+// validKey reports whether key is a lowercase hex SHA-256 digest, so keys
+// cannot name files outside the cache.
+func validKey(key string) bool {
+	if len(key) != 2*sha256.Size {
+		return false
+	}
+	for _, r := range key {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
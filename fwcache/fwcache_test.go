@@ -0,0 +1,234 @@
+package fwcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/fetch"
+)
+
+func testFirmware() *cyacd.Firmware {
+	fw := &cyacd.Firmware{SiliconID: 0x1E9602AA}
+	for i := 0; i < 16; i++ {
+		fw.Rows = append(fw.Rows, cyacd.NewRow(0, uint16(0x10+i), bytes.Repeat([]byte{byte(i)}, 128)))
+	}
+	return fw
+}
+
+func testImage(t *testing.T) ([]byte, string) {
+	t.Helper()
+	var image bytes.Buffer
+	if _, err := testFirmware().WriteTo(&image); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(image.Bytes())
+	return image.Bytes(), hex.EncodeToString(sum[:])
+}
+
+// countingServer serves image and counts the requests.
+func countingServer(image []byte, requests *int32) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Write(image)
+	}))
+}
+
+func TestPutGet(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw := testFirmware()
+	fp, err := cache.Put(fw)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if fp != fw.Fingerprint() {
+		t.Errorf("Put() = %s, want the fingerprint %s", fp, fw.Fingerprint())
+	}
+
+	// A new Cache on the same directory reads the entry from disk
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(fp)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !got.Equal(fw) {
+		t.Error("Get() returned different firmware")
+	}
+
+	// Copies are returned, so callers cannot change the cached image
+	got.Rows[0].Data[0] = 0xFF
+	if again, _ := reopened.Get(fp); !again.Equal(fw) {
+		t.Error("changing a returned image changed the cache")
+	}
+
+	if _, err := cache.Get(unknownFingerprint()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(unknown) error = %v, want ErrNotFound", err)
+	}
+	if _, err := cache.Get("../../etc/passwd"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(path) error = %v, want an invalid fingerprint", err)
+	}
+}
+
+// unknownFingerprint returns a fingerprint that is not in the cache.
+func unknownFingerprint() string {
+	fw := testFirmware()
+	fw.SiliconRev = 1
+	return fw.Fingerprint()
+}
+
+func TestCorruptEntries(t *testing.T) {
+	dir := t.TempDir()
+	cache, _ := Open(dir)
+	image, digest := testImage(t)
+	if _, err := cache.PutArtifact(image); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cache.artifactPath(digest), image[:len(image)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Artifact(digest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Artifact(truncated) error = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(cache.artifactPath(digest)); !os.IsNotExist(err) {
+		t.Error("truncated artifact was not removed")
+	}
+
+	fp, _ := cache.Put(testFirmware())
+	if err := os.WriteFile(cache.firmwarePath(fp), []byte("garbage\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reopened, _ := Open(dir)
+	if _, err := reopened.Get(fp); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(corrupt) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFirmware(t *testing.T) {
+	image, digest := testImage(t)
+	var requests int32
+	ts := countingServer(image, &requests)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	cache, _ := Open(dir)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		fw, err := cache.Firmware(ctx, ts.URL+"/app.cyacd", digest, fetch.WithHTTPClient(ts.Client()))
+		if err != nil {
+			t.Fatalf("Firmware() error = %v", err)
+		}
+		if !fw.Equal(testFirmware()) {
+			t.Fatal("Firmware() returned different firmware")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+	if _, err := cache.Get(testFirmware().Fingerprint()); err != nil {
+		t.Errorf("parsed image not stored by fingerprint: %v", err)
+	}
+
+	// Another process on the same directory finds the download
+	reopened, _ := Open(dir)
+	if _, err := reopened.Firmware(ctx, ts.URL+"/app.cyacd", digest, fetch.WithHTTPClient(ts.Client())); err != nil {
+		t.Fatalf("Firmware() after reopening error = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests after reopening, want 1", requests)
+	}
+
+	// A digest that does not match is not cached
+	wrong := unknownFingerprint()
+	if _, err := cache.Firmware(ctx, ts.URL+"/app.cyacd", wrong, fetch.WithHTTPClient(ts.Client())); !errors.Is(err, fetch.ErrDigestMismatch) {
+		t.Errorf("Firmware(wrong digest) error = %v, want ErrDigestMismatch", err)
+	}
+	if _, err := cache.Artifact(wrong); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Artifact(wrong digest) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDownloadShared(t *testing.T) {
+	image, digest := testImage(t)
+	var requests int32
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Write(image)
+	}))
+	defer ts.Close()
+
+	cache, _ := Open(t.TempDir())
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var data []byte
+			data, errs[i] = cache.Download(context.Background(), ts.URL, digest, fetch.WithHTTPClient(ts.Client()))
+			if errs[i] == nil && !bytes.Equal(data, image) {
+				errs[i] = errors.New("wrong data")
+			}
+		}(i)
+	}
+	<-started
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Download() %d error = %v", i, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	image, digest := testImage(t)
+	var requests int32
+	ts := countingServer(image, &requests)
+	defer ts.Close()
+
+	cache, _ := Open(t.TempDir())
+	ctx := context.Background()
+	fw, err := cache.Firmware(ctx, ts.URL, digest, fetch.WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Remove(digest); err != nil {
+		t.Fatalf("Remove(digest) error = %v", err)
+	}
+	if err := cache.Remove(fw.Fingerprint()); err != nil {
+		t.Fatalf("Remove(fingerprint) error = %v", err)
+	}
+	if _, err := cache.Get(fw.Fingerprint()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Remove error = %v, want ErrNotFound", err)
+	}
+	if _, err := cache.Firmware(ctx, ts.URL, digest, fetch.WithHTTPClient(ts.Client())); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("server got %d requests, want 2 (downloaded again after Remove)", requests)
+	}
+}
@@ -0,0 +1,45 @@
+// Package httpserver exposes firmware programming over HTTP, for web
+// dashboards and fleet tools that should not each implement their own HTTP
+// layer around the bootloader package.
+//
+// # Endpoints
+//
+//	POST   /firmware           upload a .cyacd or .cyacd2 file (request body)
+//	GET    /firmware           list the uploaded firmware
+//	DELETE /firmware/{id}      remove an uploaded firmware file
+//	POST   /jobs               start programming: {"firmware": ID, "transport": NAME, "key": HEX}
+//	GET    /jobs               list the jobs
+//	GET    /jobs/{id}          the state and latest progress of a job
+//	DELETE /jobs/{id}          stop a running job
+//	GET    /jobs/{id}/events   a Server-Sent Events stream of the job's progress
+//
+// Requests and responses are JSON. The key of a .cyacd job is 12 hex digits in
+// any form protocol.ParseKey accepts, or "none" for a bootloader built without
+// a key. A transport is a name, such
+// as a serial port path, that the Opener passed to New turns into a device;
+// one job at a time may use each transport.
+//
+// The events stream sends a "state" event with the current job state when
+// it opens, a "progress" event for every progress report, and a final
+// "state" event when the job ends, after which the stream is closed:
+//
+//	event: progress
+//	data: {"phase":"programming","percentage":42.5,"current_row":85,...}
+//
+// In a browser:
+//
+//	const events = new EventSource("/jobs/" + id + "/events");
+//	events.addEventListener("progress", e => render(JSON.parse(e.data)));
+//
+// # Usage
+//
+//	srv := httpserver.New(func(ctx context.Context, name string) (io.ReadWriter, error) {
+//	    return openSerialPort(name)
+//	}, httpserver.WithProgrammerOptions(bootloader.WithCommandDelay(25*time.Millisecond)))
+//	log.Fatal(http.ListenAndServe(":8080", srv))
+//
+// The server keeps uploads and jobs in memory: uploads until they are
+// deleted, and the most recent ended jobs (see WithJobHistory). It has no
+// authentication; wrap it in middleware before exposing it beyond a trusted
+// network.
+package httpserver
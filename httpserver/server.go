@@ -0,0 +1,571 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// DefaultMaxUploadSize is the default limit on the size of uploaded firmware files.
+const DefaultMaxUploadSize = 16 << 20
+
+// DefaultJobHistory is the default number of ended jobs kept for GET /jobs.
+const DefaultJobHistory = 100
+
+// Job states.
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCanceled  = "canceled"
+)
+
+// Opener opens the device behind a named transport, such as a serial port
+// path. A device that implements io.Closer is closed when its job ends.
+type Opener func(ctx context.Context, name string) (io.ReadWriter, error)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithProgrammerOptions sets options applied to the Programmer of every job,
+// such as timeouts, packet sizes, or a logger. The progress callback is set
+// by the server.
+//
+// Example:
+//
+//	srv := httpserver.New(open, httpserver.WithProgrammerOptions(
+//	    bootloader.WithHIDReportID(0x00),
+//	    bootloader.WithWritePacketSize(65),
+//	))
+func WithProgrammerOptions(opts ...bootloader.Option) Option {
+	return func(s *Server) {
+		s.progOpts = append(s.progOpts, opts...)
+	}
+}
+
+// WithMaxUploadSize limits the size of uploaded firmware files.
+// Default is DefaultMaxUploadSize (16 MiB).
+func WithMaxUploadSize(size int64) Option {
+	return func(s *Server) {
+		if size > 0 {
+			s.maxUpload = size
+		}
+	}
+}
+
+// WithJobHistory sets how many ended jobs are kept, so their state can still
+// be read; older ended jobs are removed. Running jobs are always kept.
+// Default is DefaultJobHistory (100).
+//
+// Example:
+//
+//	// Forget each job as soon as it ends; clients follow its events stream
+//	srv := httpserver.New(open, httpserver.WithJobHistory(0))
+func WithJobHistory(n int) Option {
+	return func(s *Server) {
+		if n >= 0 {
+			s.jobHistory = n
+		}
+	}
+}
+
+// Server is an http.Handler serving the endpoints described in the package
+// documentation. It is safe for concurrent use.
+type Server struct {
+	open       Opener
+	progOpts   []bootloader.Option
+	maxUpload  int64
+	jobHistory int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	firmware map[string]*firmware
+	jobs     map[string]*job
+	busy     map[string]*job // running job by transport name
+	ended    []string        // IDs of the ended jobs kept, oldest first
+	nextJob  int
+}
+
+// New returns a Server that opens transports with open.
+// It panics if open is nil.
+//
+// Example:
+//
+//	srv := httpserver.New(openPort)
+//	defer srv.Close()
+//	log.Fatal(http.ListenAndServe(":8080", srv))
+func New(open Opener, opts ...Option) *Server {
+	if open == nil {
+		panic("httpserver: nil Opener")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		open:       open,
+		maxUpload:  DefaultMaxUploadSize,
+		jobHistory: DefaultJobHistory,
+		ctx:        ctx,
+		cancel:     cancel,
+		firmware:   make(map[string]*firmware),
+		jobs:       make(map[string]*job),
+		busy:       make(map[string]*job),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Close stops the running jobs and waits for them to end.
+func (s *Server) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// firmware is an uploaded firmware file.
+type firmware struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Format    string    `json:"format"`
+	SiliconID string    `json:"silicon_id"`
+	Rows      int       `json:"rows"`
+	Size      int       `json:"size"`
+	Uploaded  time.Time `json:"uploaded"`
+
+	v1 *cyacd.Firmware
+	v2 *cyacd.Firmware2
+}
+
+// jobStatus is the JSON representation of a job.
+type jobStatus struct {
+	ID        string               `json:"id"`
+	Firmware  string               `json:"firmware"`
+	Transport string               `json:"transport"`
+	State     string               `json:"state"`
+	Error     string               `json:"error,omitempty"`
+	Progress  *bootloader.Progress `json:"progress,omitempty"`
+	Started   time.Time            `json:"started"`
+	Ended     *time.Time           `json:"ended,omitempty"`
+}
+
+// job is a programming run. Its fields are guarded by Server.mu.
+type job struct {
+	status jobStatus
+	cancel context.CancelFunc
+	subs   map[chan []byte]struct{}
+}
+
+// ServeHTTP routes a request to its endpoint.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "firmware":
+		switch r.Method {
+		case http.MethodGet:
+			s.listFirmware(w)
+		case http.MethodPost:
+			s.uploadFirmware(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+
+	case len(parts) == 2 && parts[0] == "firmware":
+		if r.Method != http.MethodDelete {
+			methodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		s.deleteFirmware(w, parts[1])
+
+	case len(parts) == 1 && parts[0] == "jobs":
+		switch r.Method {
+		case http.MethodGet:
+			s.listJobs(w)
+		case http.MethodPost:
+			s.startJob(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+
+	case len(parts) == 2 && parts[0] == "jobs":
+		switch r.Method {
+		case http.MethodGet:
+			s.getJob(w, parts[1])
+		case http.MethodDelete:
+			s.stopJob(w, parts[1])
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+
+	case len(parts) == 3 && parts[0] == "jobs" && parts[2] == "events":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.streamEvents(w, r, parts[1])
+
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) uploadFirmware(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxUpload))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("firmware larger than %d bytes", s.maxUpload))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	fw := &firmware{
+		ID:       hex.EncodeToString(sum[:8]),
+		Name:     path.Base(r.URL.Query().Get("name")),
+		Size:     len(body),
+		Uploaded: time.Now().UTC(),
+	}
+	if fw.Name == "." || fw.Name == "/" {
+		fw.Name = ""
+	}
+
+	if cyacd.IsCyacd2(fw.Name, body) {
+		fw.Format = "cyacd2"
+		fw.v2, err = cyacd.ParseReader2(bytes.NewReader(body))
+		if err == nil {
+			fw.SiliconID = fmt.Sprintf("0x%08X", fw.v2.SiliconID)
+			fw.Rows = len(fw.v2.Rows)
+		}
+	} else {
+		fw.Format = "cyacd"
+		fw.v1, err = cyacd.ParseReader(bytes.NewReader(body))
+		if err == nil {
+			fw.SiliconID = fmt.Sprintf("0x%08X", fw.v1.SiliconID)
+			fw.Rows = len(fw.v1.Rows)
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("parse firmware: %v", err))
+		return
+	}
+
+	s.mu.Lock()
+	s.firmware[fw.ID] = fw
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, fw)
+}
+
+func (s *Server) listFirmware(w http.ResponseWriter) {
+	s.mu.Lock()
+	list := make([]*firmware, 0, len(s.firmware))
+	for _, fw := range s.firmware {
+		list = append(list, fw)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Uploaded.Before(list[j].Uploaded) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// deleteFirmware removes an uploaded firmware file. Jobs already programming
+// it are not affected.
+func (s *Server) deleteFirmware(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	fw := s.firmware[id]
+	delete(s.firmware, id)
+	s.mu.Unlock()
+	if fw == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown firmware %q", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, fw)
+}
+
+// jobRequest is the body of POST /jobs.
+type jobRequest struct {
+	Firmware  string `json:"firmware"`
+	Transport string `json:"transport"`
+	Key       string `json:"key"`
+}
+
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if req.Transport == "" {
+		writeError(w, http.StatusBadRequest, "no transport given")
+		return
+	}
+
+	s.mu.Lock()
+	fw := s.firmware[req.Firmware]
+	s.mu.Unlock()
+	if fw == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown firmware %q", req.Firmware))
+		return
+	}
+
+	var key []byte
+	if fw.v1 != nil {
+		var err error
+		if key, err = protocol.ParseKey(req.Key); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if running := s.busy[req.Transport]; running != nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Sprintf("transport %q is in use by job %s", req.Transport, running.status.ID))
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.nextJob++
+	j := &job{
+		status: jobStatus{
+			ID:        fmt.Sprintf("job-%d", s.nextJob),
+			Firmware:  fw.ID,
+			Transport: req.Transport,
+			State:     StateRunning,
+			Started:   time.Now().UTC(),
+		},
+		cancel: cancel,
+		subs:   make(map[chan []byte]struct{}),
+	}
+	s.jobs[j.status.ID] = j
+	s.busy[req.Transport] = j
+	status := j.status
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.finish(ctx, j, s.run(ctx, j, fw, key))
+	}()
+
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// run programs fw through the transport of j.
+func (s *Server) run(ctx context.Context, j *job, fw *firmware, key []byte) error {
+	device, err := s.open(ctx, j.status.Transport)
+	if err != nil {
+		return fmt.Errorf("open transport: %w", err)
+	}
+	if c, ok := device.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	opts := append(append([]bootloader.Option(nil), s.progOpts...),
+		bootloader.WithProgressCallback(func(p bootloader.Progress) { s.publish(j, p) }))
+	prog, err := bootloader.NewProgrammer(device, opts...)
+	if err != nil {
+		return err
+	}
+
+	if fw.v2 != nil {
+		return prog.ProgramV2(ctx, fw.v2)
+	}
+	return prog.Program(ctx, fw.v1, key)
+}
+
+// publish records a progress report of j and sends it to the event streams.
+// Streams that fall behind miss reports rather than slowing programming.
+func (s *Server) publish(j *job, p bootloader.Progress) {
+	data, _ := json.Marshal(p)
+	event := formatEvent("progress", data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.status.Progress = &p
+	for ch := range j.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// finish records the outcome of j, closes its event streams, and removes the
+// ended jobs beyond the job history.
+func (s *Server) finish(ctx context.Context, j *job, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	j.status.Ended = &now
+	switch {
+	case err == nil:
+		j.status.State = StateSucceeded
+	case ctx.Err() != nil:
+		j.status.State = StateCanceled
+		j.status.Error = err.Error()
+	default:
+		j.status.State = StateFailed
+		j.status.Error = err.Error()
+	}
+	j.cancel()
+
+	delete(s.busy, j.status.Transport)
+	for ch := range j.subs {
+		close(ch)
+	}
+	j.subs = nil
+
+	s.ended = append(s.ended, j.status.ID)
+	for len(s.ended) > s.jobHistory {
+		delete(s.jobs, s.ended[0])
+		s.ended = s.ended[1:]
+	}
+}
+
+// lookup returns the job with the given ID, or writes a 404 and returns nil.
+func (s *Server) lookup(w http.ResponseWriter, id string) *job {
+	s.mu.Lock()
+	j := s.jobs[id]
+	s.mu.Unlock()
+	if j == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown job %q", id))
+	}
+	return j
+}
+
+func (s *Server) listJobs(w http.ResponseWriter) {
+	s.mu.Lock()
+	list := make([]jobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j.status)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, id string) {
+	j := s.lookup(w, id)
+	if j == nil {
+		return
+	}
+	s.mu.Lock()
+	status := j.status
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// stopJob cancels a running job. The job ends, with state canceled, once the
+// command in flight completes; stopping an ended job has no effect.
+func (s *Server) stopJob(w http.ResponseWriter, id string) {
+	j := s.lookup(w, id)
+	if j == nil {
+		return
+	}
+	s.mu.Lock()
+	j.cancel()
+	status := j.status
+	s.mu.Unlock()
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, id string) {
+	j := s.lookup(w, id)
+	if j == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	s.mu.Lock()
+	var ch chan []byte
+	if j.subs != nil {
+		ch = make(chan []byte, 64)
+		j.subs[ch] = struct{}{}
+	}
+	status := j.status
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	writeState(w, status)
+	flusher.Flush()
+	if ch == nil {
+		// The job had already ended
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			s.mu.Lock()
+			delete(j.subs, ch)
+			s.mu.Unlock()
+			return
+
+		case event, ok := <-ch:
+			if !ok {
+				s.mu.Lock()
+				status := j.status
+				s.mu.Unlock()
+				writeState(w, status)
+				flusher.Flush()
+				return
+			}
+			w.Write(event)
+			flusher.Flush()
+		}
+	}
+}
+
+// formatEvent formats a Server-Sent Event. data must not contain newlines,
+// which JSON encoding guarantees.
+func formatEvent(name string, data []byte) []byte {
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", name, data))
+}
+
+// writeState writes a state event for status.
+func writeState(w io.Writer, status jobStatus) {
+	data, _ := json.Marshal(status)
+	w.Write(formatEvent("state", data))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
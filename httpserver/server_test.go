@@ -0,0 +1,240 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+)
+
+// testFirmware returns a .cyacd file with three rows for the simulated device.
+func testFirmware(t *testing.T) []byte {
+	t.Helper()
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 3; i++ {
+		fw.Rows = append(fw.Rows, cyacd.NewRow(0, uint16(0x10+i), bytes.Repeat([]byte{byte(i)}, 64)))
+	}
+	var buf bytes.Buffer
+	if _, err := fw.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// do sends a request and decodes the JSON response into v.
+func do(t *testing.T, method, url string, body io.Reader, wantCode int, v interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != wantCode {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, url, resp.StatusCode, wantCode, data)
+	}
+	if v != nil {
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, url, err, data)
+		}
+	}
+}
+
+// readEvents reads a Server-Sent Events stream until it ends and returns the
+// event names and data.
+func readEvents(t *testing.T, url string) (names []string, data []string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+		} else if d, ok := strings.CutPrefix(line, "data: "); ok {
+			data = append(data, d)
+		}
+	}
+	return names, data
+}
+
+func TestServer(t *testing.T) {
+	// Each job waits for the test to subscribe to its events before opening the device
+	subscribed := make(chan struct{})
+	devices := map[string]*bootloadertest.Device{"port0": bootloadertest.NewDevice()}
+	srv := New(func(ctx context.Context, name string) (io.ReadWriter, error) {
+		<-subscribed
+		return devices[name], nil
+	}, WithProgrammerOptions(bootloader.WithVerifyAfterProgram(false)))
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var fw struct {
+		ID     string `json:"id"`
+		Format string `json:"format"`
+		Rows   int    `json:"rows"`
+	}
+	do(t, http.MethodPost, ts.URL+"/firmware?name=app.cyacd", bytes.NewReader(testFirmware(t)), http.StatusCreated, &fw)
+	if fw.Format != "cyacd" || fw.Rows != 3 {
+		t.Errorf("uploaded firmware = %+v", fw)
+	}
+
+	var job jobStatus
+	do(t, http.MethodPost, ts.URL+"/jobs",
+		strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"0A1B2C3D4E5F"}`), http.StatusAccepted, &job)
+	if job.State != StateRunning {
+		t.Errorf("new job state = %q", job.State)
+	}
+
+	// The transport is taken until the job ends
+	do(t, http.MethodPost, ts.URL+"/jobs",
+		strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"0A1B2C3D4E5F"}`), http.StatusConflict, nil)
+
+	go func() {
+		// Let the stream below subscribe first
+		for {
+			srv.mu.Lock()
+			n := len(srv.jobs[job.ID].subs)
+			srv.mu.Unlock()
+			if n > 0 {
+				close(subscribed)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	names, data := readEvents(t, ts.URL+"/jobs/"+job.ID+"/events")
+
+	if len(names) < 3 || names[0] != "state" || names[len(names)-1] != "state" {
+		t.Fatalf("events = %v", names)
+	}
+	progress := 0
+	for _, name := range names {
+		if name == "progress" {
+			progress++
+		}
+	}
+	if progress == 0 {
+		t.Error("no progress events")
+	}
+	var final jobStatus
+	if err := json.Unmarshal([]byte(data[len(data)-1]), &final); err != nil {
+		t.Fatal(err)
+	}
+	if final.State != StateSucceeded || final.Progress == nil || final.Progress.Phase != bootloader.PhaseComplete {
+		t.Errorf("final state = %+v", final)
+	}
+	if _, ok := devices["port0"].Row(0, 0x12); !ok {
+		t.Error("row 0x12 not programmed")
+	}
+
+	// An ended job streams its state only
+	names, _ = readEvents(t, ts.URL+"/jobs/"+job.ID+"/events")
+	if len(names) != 1 {
+		t.Errorf("events of an ended job = %v", names)
+	}
+}
+
+func TestServerStopJob(t *testing.T) {
+	srv := New(func(ctx context.Context, name string) (io.ReadWriter, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var fw struct{ ID string }
+	do(t, http.MethodPost, ts.URL+"/firmware", bytes.NewReader(testFirmware(t)), http.StatusCreated, &fw)
+
+	var job jobStatus
+	do(t, http.MethodPost, ts.URL+"/jobs",
+		strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"0A1B2C3D4E5F"}`), http.StatusAccepted, &job)
+	do(t, http.MethodDelete, ts.URL+"/jobs/"+job.ID, nil, http.StatusAccepted, nil)
+
+	names, data := readEvents(t, ts.URL+"/jobs/"+job.ID+"/events")
+	var final jobStatus
+	if len(data) > 0 {
+		json.Unmarshal([]byte(data[len(data)-1]), &final)
+	}
+	if final.State != StateCanceled {
+		t.Errorf("events %v, final state %+v", names, final)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := New(func(context.Context, string) (io.ReadWriter, error) { return bootloadertest.NewDevice(), nil })
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	do(t, http.MethodPost, ts.URL+"/firmware", strings.NewReader("not a firmware file"), http.StatusBadRequest, nil)
+	do(t, http.MethodPost, ts.URL+"/jobs", strings.NewReader(`{"firmware":"nope","transport":"port0"}`), http.StatusBadRequest, nil)
+	do(t, http.MethodGet, ts.URL+"/jobs/job-9", nil, http.StatusNotFound, nil)
+	do(t, http.MethodPut, ts.URL+"/firmware", nil, http.StatusMethodNotAllowed, nil)
+
+	var fw struct{ ID string }
+	do(t, http.MethodPost, ts.URL+"/firmware", bytes.NewReader(testFirmware(t)), http.StatusCreated, &fw)
+	do(t, http.MethodPost, ts.URL+"/jobs", strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"0A1B"}`), http.StatusBadRequest, nil)
+	do(t, http.MethodPost, ts.URL+"/jobs", strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0"}`), http.StatusBadRequest, nil)
+	do(t, http.MethodPost, ts.URL+"/jobs", strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"none"}`), http.StatusAccepted, nil)
+}
+
+func TestServerCleanup(t *testing.T) {
+	srv := New(func(context.Context, string) (io.ReadWriter, error) { return bootloadertest.NewDevice(), nil },
+		WithJobHistory(1), WithProgrammerOptions(bootloader.WithVerifyAfterProgram(false)))
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var fw struct{ ID string }
+	do(t, http.MethodPost, ts.URL+"/firmware", bytes.NewReader(testFirmware(t)), http.StatusCreated, &fw)
+
+	// Only the latest ended job is kept
+	var ids []string
+	for i := 0; i < 2; i++ {
+		var job jobStatus
+		do(t, http.MethodPost, ts.URL+"/jobs",
+			strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"0A1B2C3D4E5F"}`), http.StatusAccepted, &job)
+		readEvents(t, ts.URL+"/jobs/"+job.ID+"/events") // until the job ends
+		ids = append(ids, job.ID)
+	}
+	do(t, http.MethodGet, ts.URL+"/jobs/"+ids[0], nil, http.StatusNotFound, nil)
+	var list []jobStatus
+	do(t, http.MethodGet, ts.URL+"/jobs", nil, http.StatusOK, &list)
+	if len(list) != 1 || list[0].ID != ids[1] || list[0].State != StateSucceeded {
+		t.Errorf("jobs = %+v, want %s only", list, ids[1])
+	}
+
+	do(t, http.MethodDelete, ts.URL+"/firmware/"+fw.ID, nil, http.StatusOK, nil)
+	do(t, http.MethodDelete, ts.URL+"/firmware/"+fw.ID, nil, http.StatusNotFound, nil)
+	var firmware []struct{ ID string }
+	do(t, http.MethodGet, ts.URL+"/firmware", nil, http.StatusOK, &firmware)
+	if len(firmware) != 0 {
+		t.Errorf("firmware after delete = %+v", firmware)
+	}
+	do(t, http.MethodPost, ts.URL+"/jobs",
+		strings.NewReader(`{"firmware":"`+fw.ID+`","transport":"port0","key":"0A1B2C3D4E5F"}`), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,188 @@
+// Package pcapng writes bootloader traffic as pcapng captures, so a session
+// can be opened in Wireshark and lined up with USB or serial captures of the
+// same link.
+//
+// Frames are recorded with their direction and a nanosecond timestamp under
+// one of the user link types reserved for private use, such as LinkTypeUser0.
+// Wireshark shows them as raw bytes; map the link type to a dissector under
+// Preferences > Protocols > DLT_USER to decode them.
+//
+// Example:
+//
+//	f, _ := os.Create("session.pcapng")
+//	defer f.Close()
+//	capture, err := pcapng.NewWriter(f, pcapng.LinkTypeUser0)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	prog := bootloader.New(device, bootloader.WithCapture(capture))
+package pcapng
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// User link types (DLT_USER0 to DLT_USER15) reserved for private use.
+const (
+	LinkTypeUser0  = 147
+	LinkTypeUser15 = 162
+)
+
+// Block types.
+const (
+	blockSectionHeader  = 0x0A0D0D0A
+	blockInterface      = 0x00000001
+	blockEnhancedPacket = 0x00000006
+	byteOrderMagic      = 0x1A2B3C4D
+
+	// blockOverhead is the block type and the leading and trailing total length
+	blockOverhead = 12
+)
+
+// Option codes.
+const (
+	optEndOfOpt   = 0
+	optShbUserApp = 4
+	optIfName     = 2
+	optIfTsResol  = 9
+	optEpbFlags   = 2
+)
+
+// tsResolNanoseconds is the if_tsresol value for 10^-9 second timestamps.
+const tsResolNanoseconds = 9
+
+// Direction is the direction of a frame, from the host's point of view.
+type Direction int
+
+// Frame directions.
+const (
+	// Inbound frames were received from the device (responses)
+	Inbound Direction = 1
+
+	// Outbound frames were sent to the device (commands)
+	Outbound Direction = 2
+)
+
+// Writer writes a pcapng section to an io.Writer. Frames are recorded on
+// interfaces, one per link (see Interface), so the traffic of several devices
+// can share one capture. Writer is safe for concurrent use.
+type Writer struct {
+	mu       sync.Mutex
+	w        io.Writer
+	linkType uint16
+	ifaces   map[string]uint32
+	err      error
+}
+
+// NewWriter writes the section header of a capture to w and returns a Writer
+// recording frames under linkType, one of the user link types
+// LinkTypeUser0 to LinkTypeUser15.
+func NewWriter(w io.Writer, linkType int) (*Writer, error) {
+	if linkType < LinkTypeUser0 || linkType > LinkTypeUser15 {
+		return nil, fmt.Errorf("link type %d is not a user link type (%d-%d)", linkType, LinkTypeUser0, LinkTypeUser15)
+	}
+
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, byteOrderMagic)
+	body = binary.LittleEndian.AppendUint16(body, 1) // major version
+	body = binary.LittleEndian.AppendUint16(body, 0) // minor version
+	body = binary.LittleEndian.AppendUint64(body, ^uint64(0))
+	body = appendOption(body, optShbUserApp, []byte("go-cyacd"))
+	body = appendOption(body, optEndOfOpt, nil)
+
+	cw := &Writer{w: w, linkType: uint16(linkType), ifaces: make(map[string]uint32)}
+	if err := cw.writeBlock(blockSectionHeader, body); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Interface returns the interface recording the frames of the named link,
+// e.g. a device serial number, adding it to the capture on first use.
+func (w *Writer) Interface(name string) (*Interface, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if id, ok := w.ifaces[name]; ok {
+		return &Interface{w: w, id: id}, nil
+	}
+
+	var body []byte
+	body = binary.LittleEndian.AppendUint16(body, w.linkType)
+	body = binary.LittleEndian.AppendUint16(body, 0) // reserved
+	body = binary.LittleEndian.AppendUint32(body, 0) // no snap length limit
+	if name != "" {
+		body = appendOption(body, optIfName, []byte(name))
+	}
+	body = appendOption(body, optIfTsResol, []byte{tsResolNanoseconds})
+	body = appendOption(body, optEndOfOpt, nil)
+	if err := w.writeBlock(blockInterface, body); err != nil {
+		return nil, err
+	}
+
+	id := uint32(len(w.ifaces))
+	w.ifaces[name] = id
+	return &Interface{w: w, id: id}, nil
+}
+
+// writeBlock writes one block. Once a write fails, every later write returns
+// the same error. Must be called with mu held.
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	total := uint32(blockOverhead + len(body))
+	block := make([]byte, 0, total)
+	block = binary.LittleEndian.AppendUint32(block, blockType)
+	block = binary.LittleEndian.AppendUint32(block, total)
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, total)
+	if _, err := w.w.Write(block); err != nil {
+		w.err = fmt.Errorf("write capture: %w", err)
+	}
+	return w.err
+}
+
+// Interface records the frames of one link. Returned by Writer.Interface.
+type Interface struct {
+	w  *Writer
+	id uint32
+}
+
+// WriteFrame records a frame sent or received at t.
+func (i *Interface) WriteFrame(t time.Time, dir Direction, frame []byte) error {
+	ts := uint64(t.UnixNano())
+
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, i.id)
+	body = binary.LittleEndian.AppendUint32(body, uint32(ts>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(ts))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(frame)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(frame)))
+	body = append(body, frame...)
+	body = append(body, make([]byte, padding(len(frame)))...)
+	body = appendOption(body, optEpbFlags, binary.LittleEndian.AppendUint32(nil, uint32(dir)))
+	body = appendOption(body, optEndOfOpt, nil)
+
+	i.w.mu.Lock()
+	defer i.w.mu.Unlock()
+	return i.w.writeBlock(blockEnhancedPacket, body)
+}
+
+// appendOption appends an option with its value padded to 32 bits.
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, padding(len(value)))...)
+}
+
+// padding returns the bytes needed to pad n bytes to 32 bits.
+func padding(n int) int {
+	return (4 - n%4) % 4
+}
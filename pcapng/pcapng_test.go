@@ -0,0 +1,194 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// block is a decoded pcapng block.
+type block struct {
+	typ  uint32
+	body []byte
+}
+
+func readBlocks(t *testing.T, b []byte) []block {
+	t.Helper()
+	var blocks []block
+	for len(b) > 0 {
+		if len(b) < blockOverhead {
+			t.Fatalf("truncated block: % X", b)
+		}
+		typ := binary.LittleEndian.Uint32(b)
+		total := binary.LittleEndian.Uint32(b[4:])
+		if total%4 != 0 || int(total) > len(b) || binary.LittleEndian.Uint32(b[total-4:]) != total {
+			t.Fatalf("block 0x%08X: bad total length %d", typ, total)
+		}
+		blocks = append(blocks, block{typ: typ, body: b[8 : total-4]})
+		b = b[total:]
+	}
+	return blocks
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, LinkTypeUser0+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev1, err := w.Interface("SN-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev2, _ := w.Interface("SN-2")
+	again, _ := w.Interface("SN-1")
+
+	at := time.Unix(1700000000, 123456789)
+	sent := []byte{0x01, 0x38, 0x00, 0x00, 0xC7, 0xFF, 0x17} // 7 bytes, padded to 8
+	if err := dev1.WriteFrame(at, Outbound, sent); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev2.WriteFrame(at, Inbound, []byte{0x01, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.WriteFrame(at.Add(time.Millisecond), Inbound, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := readBlocks(t, buf.Bytes())
+	wantTypes := []uint32{blockSectionHeader, blockInterface, blockInterface, blockEnhancedPacket, blockEnhancedPacket, blockEnhancedPacket}
+	if len(blocks) != len(wantTypes) {
+		t.Fatalf("%d blocks, want %d", len(blocks), len(wantTypes))
+	}
+	for i, b := range blocks {
+		if b.typ != wantTypes[i] {
+			t.Errorf("block %d: type 0x%08X, want 0x%08X", i, b.typ, wantTypes[i])
+		}
+	}
+
+	if magic := binary.LittleEndian.Uint32(blocks[0].body); magic != byteOrderMagic {
+		t.Errorf("byte-order magic 0x%08X", magic)
+	}
+	if lt := binary.LittleEndian.Uint16(blocks[1].body); lt != LinkTypeUser0+1 {
+		t.Errorf("link type %d", lt)
+	}
+	if !bytes.Contains(blocks[2].body, []byte("SN-2")) {
+		t.Error("second interface is not named SN-2")
+	}
+
+	tests := []struct {
+		iface uint32
+		ts    time.Time
+		dir   Direction
+		frame []byte
+	}{
+		{0, at, Outbound, sent},
+		{1, at, Inbound, []byte{0x01, 0x00, 0x00, 0x00}},
+		{0, at.Add(time.Millisecond), Inbound, nil},
+	}
+	for i, tt := range tests {
+		body := blocks[3+i].body
+		if id := binary.LittleEndian.Uint32(body); id != tt.iface {
+			t.Errorf("packet %d: interface %d, want %d", i, id, tt.iface)
+		}
+		ts := uint64(binary.LittleEndian.Uint32(body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:]))
+		if ts != uint64(tt.ts.UnixNano()) {
+			t.Errorf("packet %d: timestamp %d, want %d", i, ts, tt.ts.UnixNano())
+		}
+		n := int(binary.LittleEndian.Uint32(body[12:]))
+		if !bytes.Equal(body[20:20+n], tt.frame) {
+			t.Errorf("packet %d: data % X", i, body[20:20+n])
+		}
+		opts := body[20+n+padding(n):]
+		if code := binary.LittleEndian.Uint16(opts); code != optEpbFlags {
+			t.Fatalf("packet %d: option %d, want epb_flags", i, code)
+		}
+		if flags := binary.LittleEndian.Uint32(opts[4:]); Direction(flags) != tt.dir {
+			t.Errorf("packet %d: flags %d, want direction %d", i, flags, tt.dir)
+		}
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	for _, lt := range []int{1, LinkTypeUser0 - 1, LinkTypeUser15 + 1} {
+		if _, err := NewWriter(&bytes.Buffer{}, lt); err == nil {
+			t.Errorf("link type %d accepted", lt)
+		}
+	}
+
+	fw := &failingWriter{n: 2}
+	w, err := NewWriter(fw, LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface, err := w.Interface("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iface.WriteFrame(time.Now(), Outbound, []byte{1}); !errors.Is(err, errWrite) {
+		t.Errorf("WriteFrame: %v", err)
+	}
+	if err := iface.WriteFrame(time.Now(), Outbound, []byte{1}); !errors.Is(err, errWrite) || fw.calls != 3 {
+		t.Errorf("WriteFrame after a failure: %v (%d writes)", err, fw.calls)
+	}
+}
+
+var errWrite = errors.New("disk full")
+
+// failingWriter fails every write after the first n.
+type failingWriter struct {
+	n     int
+	calls int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	f.calls++
+	if f.calls > f.n {
+		return 0, errWrite
+	}
+	return len(p), nil
+}
+
+func TestReader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := w.Interface("SN-1")
+	b, _ := w.Interface("SN-2")
+	at := time.Unix(1700000000, 123456789)
+	a.WriteFrame(at, Outbound, []byte{0x01, 0x38, 0x00})
+	b.WriteFrame(at.Add(time.Second), Inbound, []byte{0x01, 0x00, 0x00, 0x00, 0x00})
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Time: at, Direction: Outbound, Interface: "SN-1", Data: []byte{0x01, 0x38, 0x00}},
+		{Time: at.Add(time.Second), Direction: Inbound, Interface: "SN-2", Data: []byte{0x01, 0x00, 0x00, 0x00, 0x00}},
+	}
+	for i, w := range want {
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if !rec.Time.Equal(w.Time) || rec.Direction != w.Direction || rec.Interface != w.Interface || !bytes.Equal(rec.Data, w.Data) {
+			t.Errorf("record %d = %+v, want %+v", i, rec, w)
+		}
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("Read at the end: %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture at all"))); err == nil {
+		t.Error("NewReader accepted text")
+	}
+	if tsUnit(6) != time.Microsecond || tsUnit(0x80|10) != time.Second/1024 {
+		t.Errorf("tsUnit(6) = %s, tsUnit(2^-10) = %s", tsUnit(6), tsUnit(0x80|10))
+	}
+}
@@ -0,0 +1,195 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxBlockSize bounds the blocks Reader accepts, so a corrupt length cannot
+// make it allocate without limit.
+const maxBlockSize = 1 << 20
+
+// Record is a frame read from a capture.
+type Record struct {
+	// Time is when the frame was sent or received
+	Time time.Time
+
+	// Direction is Inbound or Outbound (0 if the capture does not say)
+	Direction Direction
+
+	// Interface is the name of the interface the frame was recorded on,
+	// e.g. the device ID of the Programmer
+	Interface string
+
+	// Data is the frame
+	Data []byte
+}
+
+// readerIface is an interface described in the current section.
+type readerIface struct {
+	name string
+	// unit is the duration of one timestamp tick
+	unit time.Duration
+}
+
+// Reader reads the frames of a pcapng capture, such as one written by Writer.
+// Blocks other than interface descriptions and enhanced packets are skipped.
+type Reader struct {
+	r      io.Reader
+	order  binary.ByteOrder
+	ifaces []readerIface
+}
+
+// NewReader reads the section header of the capture in r.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: r}
+	typ, _, err := cr.readBlock()
+	if err != nil {
+		return nil, err
+	}
+	if typ != blockSectionHeader {
+		return nil, errors.New("not a pcapng capture")
+	}
+	return cr, nil
+}
+
+// Read returns the next frame, or io.EOF at the end of the capture.
+func (r *Reader) Read() (*Record, error) {
+	for {
+		typ, body, err := r.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case blockSectionHeader:
+			// A new section starts over with its own interfaces
+			r.ifaces = nil
+		case blockInterface:
+			if len(body) < 8 {
+				return nil, errors.New("read capture: truncated interface description")
+			}
+			iface := readerIface{unit: time.Microsecond}
+			r.options(body[8:], func(code uint16, value []byte) {
+				switch {
+				case code == optIfName:
+					iface.name = string(value)
+				case code == optIfTsResol && len(value) == 1:
+					iface.unit = tsUnit(value[0])
+				}
+			})
+			r.ifaces = append(r.ifaces, iface)
+		case blockEnhancedPacket:
+			return r.packet(body)
+		}
+	}
+}
+
+// packet decodes an enhanced packet block.
+func (r *Reader) packet(body []byte) (*Record, error) {
+	if len(body) < 20 {
+		return nil, errors.New("read capture: truncated packet")
+	}
+	id := r.order.Uint32(body)
+	if int(id) >= len(r.ifaces) {
+		return nil, fmt.Errorf("read capture: packet on undescribed interface %d", id)
+	}
+	iface := r.ifaces[id]
+	ticks := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+	n := int(r.order.Uint32(body[12:]))
+	if 20+n > len(body) {
+		return nil, errors.New("read capture: truncated packet data")
+	}
+
+	rec := &Record{
+		Time:      time.Unix(0, int64(ticks)*int64(iface.unit)),
+		Interface: iface.name,
+		Data:      append([]byte(nil), body[20:20+n]...),
+	}
+	if end := 20 + n + padding(n); end <= len(body) {
+		r.options(body[end:], func(code uint16, value []byte) {
+			if code == optEpbFlags && len(value) == 4 {
+				rec.Direction = Direction(r.order.Uint32(value) & 0x3)
+			}
+		})
+	}
+	return rec, nil
+}
+
+// options calls fn for each option in b.
+func (r *Reader) options(b []byte, fn func(code uint16, value []byte)) {
+	for len(b) >= 4 {
+		code, n := r.order.Uint16(b), int(r.order.Uint16(b[2:]))
+		if code == optEndOfOpt || 4+n > len(b) {
+			return
+		}
+		fn(code, b[4:4+n])
+		b = b[min(len(b), 4+n+padding(n)):]
+	}
+}
+
+// readBlock reads one block, taking the byte order from section headers.
+func (r *Reader) readBlock() (uint32, []byte, error) {
+	var head [12]byte
+	if _, err := io.ReadFull(r.r, head[:8]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.New("read capture: truncated block")
+		}
+		return 0, nil, err
+	}
+
+	if binary.LittleEndian.Uint32(head[:]) == blockSectionHeader {
+		// The byte-order magic follows the length
+		if _, err := io.ReadFull(r.r, head[8:12]); err != nil {
+			return 0, nil, fmt.Errorf("read capture: %w", err)
+		}
+		switch {
+		case binary.LittleEndian.Uint32(head[8:]) == byteOrderMagic:
+			r.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(head[8:]) == byteOrderMagic:
+			r.order = binary.BigEndian
+		default:
+			return 0, nil, errors.New("read capture: bad byte-order magic")
+		}
+	} else if r.order == nil {
+		return 0, nil, errors.New("not a pcapng capture")
+	}
+
+	typ := r.order.Uint32(head[:])
+	total := int(r.order.Uint32(head[4:]))
+	if total < blockOverhead || total%4 != 0 || total > maxBlockSize {
+		return 0, nil, fmt.Errorf("read capture: bad block length %d", total)
+	}
+
+	read := 8
+	if typ == blockSectionHeader {
+		read = 12
+	}
+	block := make([]byte, total)
+	copy(block, head[:read])
+	if _, err := io.ReadFull(r.r, block[read:]); err != nil {
+		return 0, nil, errors.New("read capture: truncated block")
+	}
+	if r.order.Uint32(block[total-4:]) != uint32(total) {
+		return 0, nil, errors.New("read capture: block lengths differ")
+	}
+	return typ, block[8 : total-4], nil
+}
+
+// tsUnit returns the duration of a timestamp tick for an if_tsresol value:
+// 10^-n seconds, or 2^-n seconds if the top bit is set. Resolutions finer
+// than a nanosecond are not supported and read as nanoseconds.
+func tsUnit(resol byte) time.Duration {
+	exp := int(resol & 0x7F)
+	if resol&0x80 != 0 {
+		return max(1, time.Second>>min(exp, 62))
+	}
+	unit := time.Second
+	for i := 0; i < exp && unit > 1; i++ {
+		unit /= 10
+	}
+	return unit
+}
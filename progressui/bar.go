@@ -0,0 +1,195 @@
+package progressui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+)
+
+// DefaultWidth is the default number of cells of the bar.
+const DefaultWidth = 30
+
+// logStep is the percentage step between lines when the output is not a terminal.
+const logStep = 10
+
+// ANSI escape sequences.
+const (
+	clearLine = "\033[K"
+	colorOff  = "\033[0m"
+	colorBar  = "\033[32m" // green
+	colorName = "\033[36m" // cyan
+)
+
+// Bar renders progress updates to a writer.
+// It is safe for concurrent use.
+type Bar struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	width int
+	tty   bool
+	color bool
+	ascii bool
+
+	phase  bootloader.Phase
+	drawn  bool
+	logged float64
+}
+
+// Option configures a Bar.
+type Option func(*Bar)
+
+// WithWidth sets the number of cells of the bar. Default is DefaultWidth.
+func WithWidth(width int) Option {
+	return func(b *Bar) {
+		if width > 0 {
+			b.width = width
+		}
+	}
+}
+
+// WithColor enables or disables colors. Default is enabled on terminals
+// unless the NO_COLOR environment variable is set.
+func WithColor(enabled bool) Option {
+	return func(b *Bar) {
+		b.color = enabled
+	}
+}
+
+// WithTTY overrides terminal detection: true redraws the line in place,
+// false prints a line per phase change and every 10%.
+func WithTTY(tty bool) Option {
+	return func(b *Bar) {
+		b.tty = tty
+	}
+}
+
+// WithASCII draws the bar with '#' and '.' instead of block characters,
+// for terminals without Unicode fonts.
+func WithASCII() Option {
+	return func(b *Bar) {
+		b.ascii = true
+	}
+}
+
+// New returns a Bar writing to w.
+//
+// Example:
+//
+//	bar := progressui.New(os.Stderr, progressui.WithWidth(40))
+//	prog := bootloader.New(device, bootloader.WithProgressCallback(bar.Update))
+func New(w io.Writer, opts ...Option) *Bar {
+	tty := IsTerminal(w)
+	b := &Bar{
+		w:      w,
+		width:  DefaultWidth,
+		tty:    tty,
+		color:  tty && os.Getenv("NO_COLOR") == "",
+		logged: -logStep,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if !b.tty {
+		b.color = false
+	}
+	return b
+}
+
+// IsTerminal reports whether w is a terminal (a character device).
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update renders p. It is used as a bootloader.ProgressCallback.
+func (b *Bar) Update(p bootloader.Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changed := p.Phase != b.phase
+	b.phase = p.Phase
+
+	if !b.tty {
+		step := float64(int(p.Percentage/logStep) * logStep)
+		if !changed && step <= b.logged {
+			return
+		}
+		b.logged = step
+		fmt.Fprintln(b.w, b.render(p))
+		return
+	}
+
+	if changed && b.drawn {
+		fmt.Fprintln(b.w)
+	}
+	b.drawn = true
+	fmt.Fprint(b.w, "\r"+b.render(p)+clearLine)
+}
+
+// Finish ends the progress line. Call it when the operation returns.
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.drawn {
+		fmt.Fprintln(b.w)
+		b.drawn = false
+	}
+	b.phase = ""
+	b.logged = -logStep
+}
+
+// render formats p as one line.
+func (b *Bar) render(p bootloader.Progress) string {
+	filled := int(p.Percentage / 100 * float64(b.width))
+	filled = min(max(filled, 0), b.width)
+
+	full, empty := "█", "░"
+	if b.ascii {
+		full, empty = "#", "."
+	}
+	bar := strings.Repeat(full, filled)
+	if b.color {
+		bar = colorBar + bar + colorOff
+	}
+	bar += strings.Repeat(empty, b.width-filled)
+
+	name := fmt.Sprintf("%-11s", p.Phase)
+	if b.color {
+		name = colorName + name + colorOff
+	}
+
+	line := fmt.Sprintf("%s [%s] %5.1f%%", name, bar, p.Percentage)
+	if p.Phase == bootloader.PhaseProgramming && p.TotalRows > 0 {
+		line += fmt.Sprintf("  row %d/%d", p.CurrentRow, p.TotalRows)
+		if p.BytesPerSecond > 0 {
+			line += "  " + FormatRate(p.BytesPerSecond)
+		}
+		if p.EstimatedRemaining > 0 {
+			line += "  ETA " + p.EstimatedRemaining.Round(time.Second).String()
+		}
+	}
+	return line
+}
+
+// FormatRate formats a throughput in bytes per second with a binary unit,
+// e.g. "850 B/s" or "12.4 KB/s".
+func FormatRate(bytesPerSecond float64) string {
+	switch {
+	case bytesPerSecond >= 1024*1024:
+		return fmt.Sprintf("%.1f MB/s", bytesPerSecond/(1024*1024))
+	case bytesPerSecond >= 1024:
+		return fmt.Sprintf("%.1f KB/s", bytesPerSecond/1024)
+	}
+	return fmt.Sprintf("%.0f B/s", bytesPerSecond)
+}
@@ -0,0 +1,67 @@
+package progressui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+)
+
+func TestBarTTY(t *testing.T) {
+	var buf bytes.Buffer
+	bar := New(&buf, WithTTY(true), WithColor(false), WithASCII(), WithWidth(10))
+
+	bar.Update(bootloader.Progress{Phase: bootloader.PhaseEntering})
+	bar.Update(bootloader.Progress{
+		Phase:              bootloader.PhaseProgramming,
+		Percentage:         50,
+		CurrentRow:         5,
+		TotalRows:          10,
+		BytesPerSecond:     2048,
+		EstimatedRemaining: 3 * time.Second,
+	})
+	bar.Finish()
+
+	want := "\rentering    [..........]   0.0%\033[K\n" +
+		"\rprogramming [#####.....]  50.0%  row 5/10  2.0 KB/s  ETA 3s\033[K\n"
+	if buf.String() != want {
+		t.Errorf("output = %q\nwant     %q", buf.String(), want)
+	}
+}
+
+func TestBarLog(t *testing.T) {
+	var buf bytes.Buffer
+	bar := New(&buf)
+
+	for i := 0; i <= 100; i++ {
+		bar.Update(bootloader.Progress{Phase: bootloader.PhaseProgramming, Percentage: float64(i)})
+	}
+	bar.Update(bootloader.Progress{Phase: bootloader.PhaseComplete, Percentage: 100})
+	bar.Finish()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 12 {
+		t.Fatalf("got %d lines, want 12 (every 10%% and the phase change):\n%s", len(lines), buf.String())
+	}
+	if strings.ContainsAny(buf.String(), "\r\033") {
+		t.Errorf("terminal control characters in log output: %q", buf.String())
+	}
+	if !strings.HasPrefix(lines[11], "complete") {
+		t.Errorf("last line = %q", lines[11])
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := map[float64]string{
+		850:             "850 B/s",
+		12.4 * 1024:     "12.4 KB/s",
+		3 * 1024 * 1024: "3.0 MB/s",
+	}
+	for rate, want := range tests {
+		if got := FormatRate(rate); got != want {
+			t.Errorf("FormatRate(%v) = %q, want %q", rate, got, want)
+		}
+	}
+}
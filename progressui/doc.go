@@ -0,0 +1,25 @@
+// Package progressui renders bootloader programming progress on a terminal.
+//
+// # Overview
+//
+// Bar plugs into bootloader.WithProgressCallback and draws the phase, a
+// progress bar, the row count, the throughput, and the estimated time
+// remaining:
+//
+//	programming [██████████████░░░░░░░░░░░░░░░░]  46.9%  row 150/320  12.4 KB/s  ETA 9s
+//
+// On a terminal the line is redrawn in place and a new line is started when
+// the phase changes. When the output is not a terminal (a log file or CI
+// output), a line is printed on each phase change and every 10% instead, so
+// logs stay readable.
+//
+// # Usage
+//
+//	bar := progressui.New(os.Stderr)
+//	prog := bootloader.New(device, bootloader.WithProgressCallback(bar.Update))
+//	err := prog.Program(ctx, fw, key)
+//	bar.Finish()
+//
+// Colors are used on terminals unless the NO_COLOR environment variable is
+// set or WithColor(false) is given.
+package progressui
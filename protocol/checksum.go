@@ -1,5 +1,11 @@
 package protocol
 
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
 // Checksum algorithm constants.
 const (
 	// ChecksumMask is the 16-bit mask used in checksum calculations
@@ -32,6 +38,29 @@ func calculatePacketChecksum(data []byte) uint16 {
 	return 1 + (ChecksumMask ^ sum)
 }
 
+// PacketChecksum computes the 16-bit packet checksum of data (SOP through DATA)
+// using the given checksum type (ChecksumBasicSum or ChecksumCRC16).
+// The checksum type of a bootloader is recorded in the .cyacd file header.
+func PacketChecksum(data []byte, checksumType byte) uint16 {
+	if checksumType == ChecksumCRC16 {
+		return calculateCRC16(data)
+	}
+	return calculatePacketChecksum(data)
+}
+
+// SetPacketChecksum recomputes the checksum field of a complete frame in place
+// using the given checksum type. The Build*Cmd functions use basic summation;
+// call SetPacketChecksum to send their frames to a bootloader built for CRC-16.
+func SetPacketChecksum(frame []byte, checksumType byte) error {
+	if len(frame) < MinFrameSize {
+		return fmt.Errorf("frame too short: got %d bytes, minimum is %d", len(frame), MinFrameSize)
+	}
+
+	checksum := PacketChecksum(frame[:len(frame)-3], checksumType)
+	binary.LittleEndian.PutUint16(frame[len(frame)-3:len(frame)-1], checksum)
+	return nil
+}
+
 // CalculateRowChecksum computes the 8-bit checksum for a row's data.
 // This is used in .cyacd file format and for row verification.
 //
@@ -89,3 +118,12 @@ func calculateCRC16(data []byte) uint16 {
 
 	return crc
 }
+
+// crc32c is the CRC-32C (Castagnoli) table used for v2 row data checksums.
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// CalculateDataCRC computes the CRC-32C checksum of a complete v2 data row,
+// as sent with the Program Data and Verify Data commands.
+func CalculateDataCRC(data []byte) uint32 {
+	return crc32.Checksum(data, crc32c)
+}
@@ -2,11 +2,54 @@ package protocol
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
+// ValidateKey checks that key can be sent with Enter Bootloader: it must be
+// exactly BootloaderKeySize bytes, or NoKey for bootloaders built without a
+// security key. Nil and empty keys are rejected.
+func ValidateKey(key []byte) error {
+	if len(key) != BootloaderKeySize && !IsNoKey(key) {
+		return fmt.Errorf("key must be exactly %d bytes, got %d", BootloaderKeySize, len(key))
+	}
+	return nil
+}
+
+// IsNoKey reports whether key is the NoKey sentinel itself.
+func IsNoKey(key []byte) bool {
+	return len(key) == 0 && cap(key) > 0 && &key[:1][0] == &NoKey[:1][0]
+}
+
+// ParseKey parses a bootloader key written as BootloaderKeySize bytes of hex,
+// optionally with a 0x prefix and ':', '-', or ' ' separators. "none" (in any
+// case) returns NoKey.
+//
+// Example:
+//
+//	key, err := protocol.ParseKey("0A:1B:2C:3D:4E:5F")
+func ParseKey(s string) ([]byte, error) {
+	if strings.EqualFold(s, "none") {
+		return NoKey, nil
+	}
+
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	digits = strings.NewReplacer(":", "", "-", "", " ", "").Replace(digits)
+	key, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %w", s, err)
+	}
+	if len(key) != BootloaderKeySize {
+		return nil, fmt.Errorf("invalid key %q: must be %d bytes, got %d", s, BootloaderKeySize, len(key))
+	}
+	return key, nil
+}
+
 // BuildEnterBootloaderCmd constructs an Enter Bootloader command frame.
-// The key must be exactly BootloaderKeySize bytes as specified in the Infineon protocol.
+// The key must be exactly BootloaderKeySize bytes as specified in the Infineon
+// protocol, or NoKey to send the command without data, for a bootloader built
+// without a key.
 //
 // Frame structure:
 //
@@ -14,8 +57,11 @@ import (
 //
 // Returns the complete frame ready to send, or an error if validation fails.
 func BuildEnterBootloaderCmd(key []byte) ([]byte, error) {
-	if len(key) != BootloaderKeySize {
-		return nil, fmt.Errorf("key must be exactly %d bytes, got %d", BootloaderKeySize, len(key))
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if IsNoKey(key) {
+		key = nil
 	}
 
 	dataLen := uint16(len(key))
@@ -85,6 +131,13 @@ func BuildGetFlashSizeCmd(arrayID byte) ([]byte, error) {
 //
 // The data length should not exceed the maximum row size for the device.
 func BuildProgramRowCmd(arrayID byte, rowNum uint16, data []byte) ([]byte, error) {
+	return AppendProgramRowCmd(make([]byte, 0, MinFrameSize+3+len(data)), arrayID, rowNum, data)
+}
+
+// AppendProgramRowCmd appends a Program Row command frame to dst and returns the
+// extended slice. It is the allocation-free form of BuildProgramRowCmd: callers
+// programming many rows can reuse one buffer by passing buf[:0].
+func AppendProgramRowCmd(dst []byte, arrayID byte, rowNum uint16, data []byte) ([]byte, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("data cannot be empty")
 	}
@@ -93,33 +146,13 @@ func BuildProgramRowCmd(arrayID byte, rowNum uint16, data []byte) ([]byte, error
 	}
 
 	// Payload: arrayID(1) + rowNum(2) + data
-	payloadSize := 1 + 2 + len(data)
-	dataLen := uint16(payloadSize)
+	start := len(dst)
+	dst = appendFrameHeader(dst, CmdProgramRow, 1+2+len(data))
+	dst = append(dst, arrayID)
+	dst = binary.LittleEndian.AppendUint16(dst, rowNum)
+	dst = append(dst, data...)
 
-	frame := make([]byte, 0, MinFrameSize+payloadSize)
-	frame = append(frame, StartOfPacket)
-	frame = append(frame, CmdProgramRow)
-
-	lenBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(lenBytes, dataLen)
-	frame = append(frame, lenBytes...)
-
-	frame = append(frame, arrayID)
-
-	rowBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(rowBytes, rowNum)
-	frame = append(frame, rowBytes...)
-
-	frame = append(frame, data...)
-
-	checksum := calculatePacketChecksum(frame[0:])
-	checksumBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(checksumBytes, checksum)
-	frame = append(frame, checksumBytes...)
-
-	frame = append(frame, EndOfPacket)
-
-	return frame, nil
+	return appendFrameTrailer(dst, start), nil
 }
 
 // BuildSendDataCmd constructs a Send Data command frame.
@@ -132,6 +165,12 @@ func BuildProgramRowCmd(arrayID byte, rowNum uint16, data []byte) ([]byte, error
 //
 //	[SOP][CMD][LEN_L][LEN_H][DATA...][CHECKSUM_L][CHECKSUM_H][EOP]
 func BuildSendDataCmd(data []byte) ([]byte, error) {
+	return AppendSendDataCmd(make([]byte, 0, MinFrameSize+len(data)), data)
+}
+
+// AppendSendDataCmd appends a Send Data command frame to dst and returns the
+// extended slice; see AppendProgramRowCmd.
+func AppendSendDataCmd(dst []byte, data []byte) ([]byte, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("data cannot be empty")
 	}
@@ -139,26 +178,11 @@ func BuildSendDataCmd(data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("data length %d exceeds maximum %d bytes", len(data), MaxDataSize)
 	}
 
-	dataLen := uint16(len(data))
-	frame := make([]byte, 0, MinFrameSize+len(data))
-
-	frame = append(frame, StartOfPacket)
-	frame = append(frame, CmdSendData)
-
-	lenBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(lenBytes, dataLen)
-	frame = append(frame, lenBytes...)
-
-	frame = append(frame, data...)
-
-	checksum := calculatePacketChecksum(frame[0:])
-	checksumBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(checksumBytes, checksum)
-	frame = append(frame, checksumBytes...)
-
-	frame = append(frame, EndOfPacket)
+	start := len(dst)
+	dst = appendFrameHeader(dst, CmdSendData, len(data))
+	dst = append(dst, data...)
 
-	return frame, nil
+	return appendFrameTrailer(dst, start), nil
 }
 
 // BuildVerifyRowCmd constructs a Verify Row command frame.
@@ -168,30 +192,18 @@ func BuildSendDataCmd(data []byte) ([]byte, error) {
 //
 //	[SOP][CMD][LEN_L][LEN_H][ARRAY_ID][ROW_L][ROW_H][CHECKSUM_L][CHECKSUM_H][EOP]
 func BuildVerifyRowCmd(arrayID byte, rowNum uint16) ([]byte, error) {
-	dataLen := uint16(3) // arrayID(1) + rowNum(2)
-	frame := make([]byte, 0, MinFrameSize+3)
-
-	frame = append(frame, StartOfPacket)
-	frame = append(frame, CmdVerifyRow)
-
-	lenBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(lenBytes, dataLen)
-	frame = append(frame, lenBytes...)
-
-	frame = append(frame, arrayID)
-
-	rowBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(rowBytes, rowNum)
-	frame = append(frame, rowBytes...)
-
-	checksum := calculatePacketChecksum(frame[0:])
-	checksumBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(checksumBytes, checksum)
-	frame = append(frame, checksumBytes...)
+	return AppendVerifyRowCmd(make([]byte, 0, MinFrameSize+3), arrayID, rowNum), nil
+}
 
-	frame = append(frame, EndOfPacket)
+// AppendVerifyRowCmd appends a Verify Row command frame to dst and returns the
+// extended slice; see AppendProgramRowCmd.
+func AppendVerifyRowCmd(dst []byte, arrayID byte, rowNum uint16) []byte {
+	start := len(dst)
+	dst = appendFrameHeader(dst, CmdVerifyRow, 3) // arrayID(1) + rowNum(2)
+	dst = append(dst, arrayID)
+	dst = binary.LittleEndian.AppendUint16(dst, rowNum)
 
-	return frame, nil
+	return appendFrameTrailer(dst, start)
 }
 
 // BuildVerifyChecksumCmd constructs a Verify Checksum command frame.
@@ -399,3 +411,147 @@ func BuildSetActiveAppCmd(appNum byte) ([]byte, error) {
 
 	return frame, nil
 }
+
+// BuildCommand constructs a frame for an arbitrary command code and payload.
+// Intended for vendor-extended bootloaders that implement commands beyond the
+// standard set; prefer the specific Build*Cmd functions for standard commands.
+//
+// Frame structure:
+//
+//	[SOP][CMD][LEN_L][LEN_H][DATA...][CHECKSUM_L][CHECKSUM_H][EOP]
+func BuildCommand(cmd byte, data []byte) ([]byte, error) {
+	return AppendCommand(make([]byte, 0, MinFrameSize+len(data)), cmd, data)
+}
+
+// AppendCommand appends a frame for an arbitrary command code and payload to dst
+// and returns the extended slice; see BuildCommand and AppendProgramRowCmd.
+func AppendCommand(dst []byte, cmd byte, data []byte) ([]byte, error) {
+	if len(data) > MaxDataSize {
+		return nil, fmt.Errorf("data length %d exceeds maximum %d bytes", len(data), MaxDataSize)
+	}
+
+	start := len(dst)
+	dst = appendFrameHeader(dst, cmd, len(data))
+	dst = append(dst, data...)
+
+	return appendFrameTrailer(dst, start), nil
+}
+
+// appendFrameHeader appends the start of packet, command, and little-endian data length.
+func appendFrameHeader(dst []byte, cmd byte, dataLen int) []byte {
+	dst = append(dst, StartOfPacket, cmd)
+	return binary.LittleEndian.AppendUint16(dst, uint16(dataLen))
+}
+
+// appendFrameTrailer appends the checksum of the frame starting at dst[start:]
+// (per Infineon spec: SOP through DATA) and the end of packet.
+func appendFrameTrailer(dst []byte, start int) []byte {
+	dst = binary.LittleEndian.AppendUint16(dst, calculatePacketChecksum(dst[start:]))
+	return append(dst, EndOfPacket)
+}
+
+// RedactFrame returns a copy of frame that is safe to log: the key bytes of an
+// Enter Bootloader frame are replaced with 0xFF. Other frames are copied unchanged.
+// A leading HID report ID byte before the start of packet is tolerated.
+func RedactFrame(frame []byte) []byte {
+	redacted := append([]byte(nil), frame...)
+
+	offset := 0
+	if len(redacted) > 1 && redacted[0] != StartOfPacket && redacted[1] == StartOfPacket {
+		offset = 1
+	}
+
+	keyStart := offset + 4 // SOP, CMD, LEN_L, LEN_H
+	if len(redacted) >= keyStart+BootloaderKeySize &&
+		redacted[offset] == StartOfPacket && redacted[offset+1] == CmdEnterBootloader {
+		for i := keyStart; i < keyStart+BootloaderKeySize; i++ {
+			redacted[i] = 0xFF
+		}
+	}
+
+	return redacted
+}
+
+// BuildSetAppMetadataCmd constructs a v2 Set Application Metadata command frame,
+// which declares the flash region of the application before it is programmed.
+//
+// Frame structure:
+//
+//	[SOP][CMD][LEN_L][LEN_H][APP_ID][START(4)][LENGTH(4)][CHECKSUM_L][CHECKSUM_H][EOP]
+func BuildSetAppMetadataCmd(appID byte, start, length uint32) ([]byte, error) {
+	data := make([]byte, 9)
+	data[0] = appID
+	binary.LittleEndian.PutUint32(data[1:5], start)
+	binary.LittleEndian.PutUint32(data[5:9], length)
+
+	return BuildCommand(CmdSetAppMetadata, data)
+}
+
+// BuildSetEIVCmd constructs a v2 Set EIV command frame, which loads the
+// initialization vector used to decrypt the row data of an encrypted image.
+// The IV must be EIVSize8 or EIVSize16 bytes.
+//
+// Frame structure:
+//
+//	[SOP][CMD][LEN_L][LEN_H][EIV...][CHECKSUM_L][CHECKSUM_H][EOP]
+func BuildSetEIVCmd(eiv []byte) ([]byte, error) {
+	if len(eiv) != EIVSize8 && len(eiv) != EIVSize16 {
+		return nil, fmt.Errorf("EIV must be %d or %d bytes, got %d", EIVSize8, EIVSize16, len(eiv))
+	}
+
+	return BuildCommand(CmdSetEIV, eiv)
+}
+
+// BuildProgramDataCmd constructs a v2 Program Data command frame.
+// crc is the CRC-32C of the complete row (see CalculateDataCRC); data is the part
+// of the row not already sent with Send Data.
+//
+// Frame structure:
+//
+//	[SOP][CMD][LEN_L][LEN_H][ADDRESS(4)][CRC(4)][DATA...][CHECKSUM_L][CHECKSUM_H][EOP]
+func BuildProgramDataCmd(address, crc uint32, data []byte) ([]byte, error) {
+	return buildDataCmd(CmdProgramData, address, crc, data)
+}
+
+// BuildVerifyDataCmd constructs a v2 Verify Data command frame. It has the same
+// layout as Program Data; the bootloader compares the flash contents at address
+// with the data instead of writing it.
+func BuildVerifyDataCmd(address, crc uint32, data []byte) ([]byte, error) {
+	return buildDataCmd(CmdVerifyData, address, crc, data)
+}
+
+// BuildEraseDataCmd constructs a v2 Erase Data command frame.
+//
+// Frame structure:
+//
+//	[SOP][CMD][LEN_L][LEN_H][ADDRESS(4)][CHECKSUM_L][CHECKSUM_H][EOP]
+func BuildEraseDataCmd(address uint32) ([]byte, error) {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, address)
+
+	return BuildCommand(CmdEraseData, data)
+}
+
+// BuildVerifyAppCmd constructs a v2 Verify Application command frame.
+// It shares the command code of Verify Checksum but carries the application ID.
+//
+// Frame structure:
+//
+//	[SOP][CMD][LEN_L][LEN_H][APP_ID][CHECKSUM_L][CHECKSUM_H][EOP]
+func BuildVerifyAppCmd(appID byte) ([]byte, error) {
+	return BuildCommand(CmdVerifyChecksum, []byte{appID})
+}
+
+// buildDataCmd builds a Program Data or Verify Data frame.
+func buildDataCmd(cmd byte, address, crc uint32, data []byte) ([]byte, error) {
+	if len(data)+8 > MaxDataSize {
+		return nil, fmt.Errorf("data length %d exceeds maximum %d bytes", len(data), MaxDataSize-8)
+	}
+
+	payload := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(payload[0:4], address)
+	binary.LittleEndian.PutUint32(payload[4:8], crc)
+	payload = append(payload, data...)
+
+	return BuildCommand(cmd, payload)
+}
@@ -83,6 +83,54 @@ func TestBuildEnterBootloaderCmd(t *testing.T) {
 	}
 }
 
+func TestBuildEnterBootloaderCmdWellKnownKeys(t *testing.T) {
+	frame, err := BuildEnterBootloaderCmd([]byte(DefaultExampleKey))
+	if err != nil {
+		t.Fatalf("example key: %v", err)
+	}
+	if key := frame[4 : 4+BootloaderKeySize]; !bytes.Equal(key, []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}) {
+		t.Errorf("example key in frame = % X", key)
+	}
+
+	frame, err = BuildEnterBootloaderCmd(NoKey)
+	if err != nil {
+		t.Fatalf("no key: %v", err)
+	}
+	if len(frame) != MinFrameSize || frame[2] != 0 || frame[3] != 0 {
+		t.Errorf("no key frame = % X, want a command without data", frame)
+	}
+	if _, _, err := ParseResponse(frame); err != nil {
+		t.Errorf("no key frame does not parse: %v", err)
+	}
+
+	// Only NoKey itself selects a command without data
+	for _, key := range [][]byte{nil, {}, make([]byte, 0, 1), NoKey[:0:0]} {
+		if _, err := BuildEnterBootloaderCmd(key); err == nil {
+			t.Errorf("BuildEnterBootloaderCmd(%#v) accepted a key that is not NoKey", key)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	want := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	for _, s := range []string{"0A1B2C3D4E5F", "0x0a1b2c3d4e5f", "0A:1B:2C:3D:4E:5F", "0A-1B-2C-3D-4E-5F", "0A 1B 2C 3D 4E 5F"} {
+		key, err := ParseKey(s)
+		if err != nil || !bytes.Equal(key, want) {
+			t.Errorf("ParseKey(%q) = %X, %v", s, key, err)
+		}
+	}
+	for _, s := range []string{"none", "NONE"} {
+		if key, err := ParseKey(s); err != nil || !IsNoKey(key) {
+			t.Errorf("ParseKey(%q) = %X, %v, want NoKey", s, key, err)
+		}
+	}
+	for _, s := range []string{"", "0A1B2C", "0A1B2C3D4E5G", "0A1B2C3D4E5F60"} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) succeeded", s)
+		}
+	}
+}
+
 func TestBuildGetFlashSizeCmd(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -376,3 +424,153 @@ func BenchmarkBuildProgramRowCmd(b *testing.B) {
 		_, _ = BuildProgramRowCmd(0, 0, data)
 	}
 }
+
+func BenchmarkAppendProgramRowCmd(b *testing.B) {
+	data := make([]byte, 128)
+	buf := make([]byte, 0, MaxPacketSize*4)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = AppendProgramRowCmd(buf[:0], 0, 0, data)
+	}
+}
+
+func TestAppendCommands(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	prefix := []byte{0xEE}
+
+	want, _ := BuildProgramRowCmd(0x01, 0x0203, data)
+	got, err := AppendProgramRowCmd(prefix, 0x01, 0x0203, data)
+	if err != nil || !bytes.Equal(got[1:], want) || got[0] != 0xEE {
+		t.Errorf("AppendProgramRowCmd = % 02X, want EE % 02X (err %v)", got, want, err)
+	}
+
+	want, _ = BuildSendDataCmd(data)
+	if got, _ := AppendSendDataCmd(nil, data); !bytes.Equal(got, want) {
+		t.Errorf("AppendSendDataCmd = % 02X, want % 02X", got, want)
+	}
+
+	want, _ = BuildVerifyRowCmd(0x01, 0x0203)
+	if got := AppendVerifyRowCmd(nil, 0x01, 0x0203); !bytes.Equal(got, want) {
+		t.Errorf("AppendVerifyRowCmd = % 02X, want % 02X", got, want)
+	}
+
+	if _, err := AppendSendDataCmd(nil, nil); err == nil {
+		t.Error("expected error for empty Send Data")
+	}
+
+	buf := make([]byte, 0, MaxPacketSize)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = AppendSendDataCmd(buf[:0], data)
+	})
+	if allocs != 0 {
+		t.Errorf("AppendSendDataCmd with reused buffer allocates %.0f times, want 0", allocs)
+	}
+}
+
+func TestBuildCommand(t *testing.T) {
+	frame, err := BuildCommand(0x50, []byte{0xAB, 0xCD})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, _ := BuildSendDataCmd([]byte{0xAB, 0xCD})
+	if frame[1] != 0x50 || !bytes.Equal(frame[2:6], want[2:6]) {
+		t.Errorf("frame = % 02X", frame)
+	}
+
+	// Standard commands built generically match their dedicated builders
+	generic, _ := BuildCommand(CmdSendData, []byte{0xAB, 0xCD})
+	if !bytes.Equal(generic, want) {
+		t.Errorf("BuildCommand(CmdSendData) = % 02X, want % 02X", generic, want)
+	}
+
+	empty, err := BuildCommand(CmdSyncBootloader, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sync, _ := BuildSyncBootloaderCmd()
+	if !bytes.Equal(empty, sync) {
+		t.Errorf("BuildCommand(CmdSyncBootloader) = % 02X, want % 02X", empty, sync)
+	}
+
+	if _, err := BuildCommand(0x50, make([]byte, MaxDataSize+1)); err == nil {
+		t.Error("expected error for oversized payload")
+	}
+}
+
+func TestRedactFrame(t *testing.T) {
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	frame, _ := BuildEnterBootloaderCmd(key)
+
+	redacted := RedactFrame(frame)
+	if bytes.Contains(redacted, key) {
+		t.Errorf("redacted frame still contains key: % 02X", redacted)
+	}
+	if !bytes.Equal(redacted[4:10], bytes.Repeat([]byte{0xFF}, BootloaderKeySize)) {
+		t.Errorf("key bytes = % 02X, want FF", redacted[4:10])
+	}
+	if !bytes.Contains(frame, key) {
+		t.Error("RedactFrame modified its input")
+	}
+
+	// With a leading HID report ID
+	withID := append([]byte{0x00}, frame...)
+	if bytes.Contains(RedactFrame(withID), key) {
+		t.Error("redacted frame with report ID still contains key")
+	}
+
+	// Other frames are unchanged
+	sync, _ := BuildSyncBootloaderCmd()
+	if !bytes.Equal(RedactFrame(sync), sync) {
+		t.Error("RedactFrame changed a frame without key material")
+	}
+}
+
+func TestBuildV2Commands(t *testing.T) {
+	frame, err := BuildSetAppMetadataCmd(1, 0x10000000, 0x8000)
+	if err != nil {
+		t.Fatalf("BuildSetAppMetadataCmd: %v", err)
+	}
+	want := []byte{0x01, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00}
+	if frame[1] != CmdSetAppMetadata || !bytes.Equal(frame[4:13], want) {
+		t.Errorf("Set App Metadata frame = % 02X", frame)
+	}
+
+	if _, err := BuildSetEIVCmd(make([]byte, 12)); err == nil {
+		t.Error("expected error for 12-byte EIV")
+	}
+	frame, err = BuildSetEIVCmd(make([]byte, EIVSize16))
+	if err != nil || frame[1] != CmdSetEIV || frame[2] != EIVSize16 {
+		t.Errorf("Set EIV frame = % 02X, err = %v", frame, err)
+	}
+
+	frame, err = BuildProgramDataCmd(0x10000080, 0xAABBCCDD, []byte{0x01, 0x02})
+	if err != nil {
+		t.Fatalf("BuildProgramDataCmd: %v", err)
+	}
+	want = []byte{0x80, 0x00, 0x00, 0x10, 0xDD, 0xCC, 0xBB, 0xAA, 0x01, 0x02}
+	if frame[1] != CmdProgramData || frame[2] != 10 || !bytes.Equal(frame[4:14], want) {
+		t.Errorf("Program Data frame = % 02X", frame)
+	}
+	if len(frame) != ProgramDataOverhead+2 {
+		t.Errorf("Program Data frame is %d bytes, want %d", len(frame), ProgramDataOverhead+2)
+	}
+
+	if _, err := BuildVerifyDataCmd(0, 0, make([]byte, MaxDataSize)); err == nil {
+		t.Error("expected error for oversized Verify Data")
+	}
+
+	frame, err = BuildVerifyAppCmd(1)
+	if err != nil || frame[1] != CmdVerifyChecksum || frame[4] != 1 {
+		t.Errorf("Verify App frame = % 02X, err = %v", frame, err)
+	}
+}
+
+func TestCalculateDataCRC(t *testing.T) {
+	// CRC-32C check value
+	if got := CalculateDataCRC([]byte("123456789")); got != 0xE3069283 {
+		t.Errorf("CalculateDataCRC = 0x%08X, want 0xE3069283", got)
+	}
+}
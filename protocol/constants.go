@@ -3,6 +3,21 @@ package protocol
 // ProtocolVersion is the Infineon bootloader protocol version implemented by this library.
 const ProtocolVersion = "1.30"
 
+// Well-known bootloader keys. They are strings so that they can be constants;
+// pass them as []byte(protocol.DefaultExampleKey).
+const (
+	// DefaultExampleKey is the security key of the Cypress bootloader code
+	// examples and the default of the PSoC Creator Bootloader component:
+	// 0x0A 0x1B 0x2C 0x3D 0x4E 0x5F. Production devices should use their own key.
+	DefaultExampleKey = "\x0A\x1B\x2C\x3D\x4E\x5F"
+)
+
+// NoKey enters a bootloader built without a security key: Enter Bootloader
+// is sent with no data. It is recognized by identity, not by content, so a
+// nil or empty key that was never set is still rejected. Pass NoKey itself,
+// not a copy.
+var NoKey = make([]byte, 0, 1)
+
 // Frame structure constants per Infineon spec.
 const (
 	// StartOfPacket is the frame start marker (0x01)
@@ -55,6 +70,26 @@ const (
 	CmdSetActiveApp = 0x36
 )
 
+// Command codes of bootloader SDK v2.x (.cyacd2 images), which addresses flash
+// by address instead of array and row. Enter Bootloader, Send Data, Sync Bootloader,
+// Exit Bootloader, and Verify Checksum (Verify Application) are shared with v1.
+const (
+	// CmdEraseData erases the flash row at an address
+	CmdEraseData = 0x44
+
+	// CmdProgramData programs the flash row at an address
+	CmdProgramData = 0x49
+
+	// CmdVerifyData compares the flash row at an address with the sent data
+	CmdVerifyData = 0x4A
+
+	// CmdSetAppMetadata sets the start address and length of an application
+	CmdSetAppMetadata = 0x4C
+
+	// CmdSetEIV sets the encryption initialization vector for encrypted images
+	CmdSetEIV = 0x4D
+)
+
 // Status/Error codes per Infineon spec page 23.
 const (
 	// StatusSuccess indicates command was successfully received and executed
@@ -100,6 +135,15 @@ const (
 	ChecksumCRC16 = 0x01
 )
 
+// MaxApplications is the number of application slots in a multi-application
+// (dual-image) bootloader. Application numbers are 0 and 1.
+const MaxApplications = 2
+
+// MetadataSize is the size of the bootloadable metadata region stored in the
+// last bytes of the application's last flash row. Get Metadata reports the first
+// GetMetadataResponseSize bytes of this region.
+const MetadataSize = 64
+
 // MaxDataSize is the maximum data payload size per packet.
 // This is derived from typical USB packet sizes minus protocol overhead.
 const MaxDataSize = 256
@@ -145,4 +189,20 @@ const (
 	// ProgramRowOverhead is the protocol overhead for ProgramRow command:
 	// SOP(1) + CMD(1) + LEN(2) + ArrayID(1) + RowNum(2) + CHECKSUM(2) + EOP(1) = 10 bytes
 	ProgramRowOverhead = 10
+
+	// ProgramDataOverhead is the protocol overhead for the v2 ProgramData and VerifyData commands:
+	// SOP(1) + CMD(1) + LEN(2) + Address(4) + CRC(4) + CHECKSUM(2) + EOP(1) = 15 bytes
+	ProgramDataOverhead = 15
+
+	// VerifyAppResponseSize is the data size for the v2 Verify Application response (1 byte)
+	VerifyAppResponseSize = 1
+)
+
+// Valid encryption initialization vector sizes for Set EIV.
+const (
+	// EIVSize8 is the IV size of 8-byte block ciphers
+	EIVSize8 = 8
+
+	// EIVSize16 is the IV size of AES
+	EIVSize16 = 16
 )
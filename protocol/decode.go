@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Field is a named value decoded from the data of a frame.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// DecodeFields decodes the data of a command or response frame into named
+// fields, for tools that annotate captured traffic. Response data is only
+// meaningful for the command it answers, so command must be the code of the
+// preceding command frame when frame is a response (0 if unknown, in which
+// case the response data is returned undecoded).
+//
+// Unlike FormatFrame, the fields of an Enter Bootloader frame include the
+// key. DecodeFields returns nil for malformed frames and frames without data.
+//
+// Example:
+//
+//	for _, f := range protocol.DecodeFields(frame, 0) {
+//	    fmt.Printf("%s: %s\n", f.Name, f.Value)
+//	}
+//	// Output:
+//	// array: 0
+//	// row: 0x0010 (16)
+//	// data: 128 bytes
+func DecodeFields(frame []byte, command byte) []Field {
+	if len(frame) < MinFrameSize || frame[0] != StartOfPacket {
+		return nil
+	}
+	dataLen := int(binary.LittleEndian.Uint16(frame[2:4]))
+	if len(frame) != MinFrameSize+dataLen || dataLen == 0 {
+		return nil
+	}
+	data := frame[4 : 4+dataLen]
+
+	code := frame[1]
+	if code < CmdVerifyChecksum {
+		return decodeResponse(data, command)
+	}
+	return decodeCommand(code, data)
+}
+
+// decodeCommand decodes the data of a command frame.
+func decodeCommand(cmd byte, data []byte) []Field {
+	var fields []Field
+	switch {
+	case cmd == CmdEnterBootloader && len(data) == BootloaderKeySize:
+		fields = append(fields, Field{"key", fmt.Sprintf("% 02X", data)})
+		return fields
+
+	case (cmd == CmdGetFlashSize || cmd == CmdProgramRow || cmd == CmdEraseRow || cmd == CmdVerifyRow) && len(data) >= 1:
+		fields = append(fields, Field{"array", fmt.Sprint(data[0])})
+		data = data[1:]
+		if cmd == CmdGetFlashSize {
+			break
+		}
+		if len(data) < 2 {
+			break
+		}
+		row := binary.LittleEndian.Uint16(data)
+		fields = append(fields, Field{"row", fmt.Sprintf("0x%04X (%d)", row, row)})
+		data = data[2:]
+
+	case (cmd == CmdGetMetadata || cmd == CmdGetAppStatus || cmd == CmdSetActiveApp) && len(data) >= 1:
+		fields = append(fields, Field{"application", fmt.Sprint(data[0])})
+		data = data[1:]
+
+	case cmd == CmdVerifyChecksum && len(data) == 1:
+		fields = append(fields, Field{"application", fmt.Sprint(data[0])})
+		data = nil
+
+	case (cmd == CmdProgramData || cmd == CmdVerifyData) && len(data) >= 8:
+		fields = append(fields,
+			Field{"address", fmt.Sprintf("0x%08X", binary.LittleEndian.Uint32(data))},
+			Field{"crc", fmt.Sprintf("0x%08X", binary.LittleEndian.Uint32(data[4:]))},
+		)
+		data = data[8:]
+
+	case cmd == CmdEraseData && len(data) >= 4:
+		fields = append(fields, Field{"address", fmt.Sprintf("0x%08X", binary.LittleEndian.Uint32(data))})
+		data = data[4:]
+
+	case cmd == CmdSetAppMetadata && len(data) == 9:
+		return append(fields,
+			Field{"application", fmt.Sprint(data[0])},
+			Field{"start", fmt.Sprintf("0x%08X", binary.LittleEndian.Uint32(data[1:]))},
+			Field{"length", fmt.Sprintf("0x%X", binary.LittleEndian.Uint32(data[5:]))},
+		)
+
+	case cmd == CmdSetEIV:
+		return append(fields, Field{"eiv", fmt.Sprintf("% 02X", data)})
+	}
+
+	if len(data) > 0 {
+		fields = append(fields, Field{"data", fmt.Sprintf("%d bytes", len(data))})
+	}
+	return fields
+}
+
+// decodeResponse decodes the data of a response to command.
+func decodeResponse(data []byte, command byte) []Field {
+	switch command {
+	case CmdEnterBootloader:
+		if info, err := ParseEnterBootloaderResponse(data); err == nil {
+			return []Field{
+				{"silicon ID", fmt.Sprintf("0x%08X", info.SiliconID)},
+				{"silicon revision", fmt.Sprintf("0x%02X", info.SiliconRev)},
+				{"bootloader version", fmt.Sprintf("%d.%d.%d", info.BootloaderVer[0], info.BootloaderVer[1], info.BootloaderVer[2])},
+			}
+		}
+
+	case CmdGetFlashSize:
+		if size, err := ParseGetFlashSizeResponse(data); err == nil {
+			return []Field{
+				{"first row", fmt.Sprintf("0x%04X (%d)", size.StartRow, size.StartRow)},
+				{"last row", fmt.Sprintf("0x%04X (%d)", size.EndRow, size.EndRow)},
+			}
+		}
+
+	case CmdVerifyRow:
+		if len(data) == 1 {
+			return []Field{{"row checksum", fmt.Sprintf("0x%02X", data[0])}}
+		}
+
+	case CmdVerifyChecksum:
+		if valid, err := ParseVerifyChecksumResponse(data); err == nil {
+			return []Field{{"valid", fmt.Sprint(valid)}}
+		}
+
+	case CmdGetAppStatus:
+		if status, err := ParseGetAppStatusResponse(data); err == nil {
+			return []Field{{"valid", fmt.Sprint(status.Valid)}, {"active", fmt.Sprint(status.Active)}}
+		}
+
+	case CmdGetMetadata:
+		if m, err := ParseGetMetadataResponse(data); err == nil {
+			return []Field{
+				{"checksum", fmt.Sprintf("0x%02X", m.Checksum)},
+				{"start address", fmt.Sprintf("0x%08X", m.StartAddr)},
+				{"last row", fmt.Sprint(m.LastRow)},
+				{"length", fmt.Sprint(m.Length)},
+				{"active", fmt.Sprint(m.Active != 0)},
+				{"verified", fmt.Sprint(m.Verified != 0)},
+				{"bootloader version", fmt.Sprintf("0x%04X", m.BootloaderVersion)},
+				{"app ID", fmt.Sprintf("0x%04X", m.AppID)},
+				{"app version", fmt.Sprintf("0x%04X", m.AppVersion)},
+				{"custom ID", fmt.Sprintf("0x%08X", m.CustomID)},
+			}
+		}
+	}
+
+	return []Field{{"data", fmt.Sprintf("% 02X", data)}}
+}
@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeFields(t *testing.T) {
+	programRow, _ := BuildProgramRowCmd(1, 0x0010, make([]byte, 128))
+	programData, _ := BuildProgramDataCmd(0x10000000, 0xCAFEBABE, make([]byte, 16))
+	enter, _ := BuildEnterBootloaderCmd([]byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F})
+	sync, _ := BuildSyncBootloaderCmd()
+	flashSize := []byte{StartOfPacket, StatusSuccess, 0x04, 0x00, 0x10, 0x00, 0xFF, 0x00, 0x00, 0x00, EndOfPacket}
+	verifyRow := []byte{StartOfPacket, StatusSuccess, 0x01, 0x00, 0xAB, 0x00, 0x00, EndOfPacket}
+
+	tests := []struct {
+		name    string
+		frame   []byte
+		command byte
+		want    []Field
+	}{
+		{"program row", programRow, 0, []Field{{"array", "1"}, {"row", "0x0010 (16)"}, {"data", "128 bytes"}}},
+		{"program data", programData, 0, []Field{{"address", "0x10000000"}, {"crc", "0xCAFEBABE"}, {"data", "16 bytes"}}},
+		{"enter bootloader", enter, 0, []Field{{"key", "0A 1B 2C 3D 4E 5F"}}},
+		{"no data", sync, 0, nil},
+		{"flash size response", flashSize, CmdGetFlashSize, []Field{{"first row", "0x0010 (16)"}, {"last row", "0x00FF (255)"}}},
+		{"verify row response", verifyRow, CmdVerifyRow, []Field{{"row checksum", "0xAB"}}},
+		{"unknown response", verifyRow, 0, []Field{{"data", "AB"}}},
+		{"malformed", programRow[:6], 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeFields(tt.frame, tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
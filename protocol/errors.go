@@ -1,6 +1,35 @@
 package protocol
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMalformedFrame is the errors.Is target of FrameError.
+var ErrMalformedFrame = errors.New("malformed frame")
+
+// FrameError is returned for a response frame that cannot be decoded: a
+// missing start or end of packet, a length field that does not match the
+// frame, or a bad packet checksum. The frame was most likely corrupted or cut
+// short in transit, so the command may succeed when sent again.
+type FrameError struct {
+	// Reason describes what is wrong with the frame
+	Reason string
+}
+
+func (e *FrameError) Error() string {
+	return e.Reason
+}
+
+// Is reports whether target is ErrMalformedFrame.
+func (e *FrameError) Is(target error) bool {
+	return target == ErrMalformedFrame
+}
+
+// frameError returns a *FrameError with a formatted reason.
+func frameError(format string, args ...interface{}) error {
+	return &FrameError{Reason: fmt.Sprintf(format, args...)}
+}
 
 // ProtocolError represents an error returned by the bootloader.
 // Contains the status code from the bootloader response.
@@ -17,6 +46,19 @@ func (e *ProtocolError) Error() string {
 	return fmt.Sprintf("%s failed: %s (0x%02X)", e.Operation, statusName, e.StatusCode)
 }
 
+// Timeout reports false: a status code is an answer, not a timeout. Together
+// with Temporary it lets generic retry code classify ProtocolError like a
+// net.Error.
+func (e *ProtocolError) Timeout() bool {
+	return false
+}
+
+// Temporary reports whether retrying the command may succeed: only a packet
+// checksum error (ErrChecksum, a frame corrupted in transit) is temporary.
+func (e *ProtocolError) Temporary() bool {
+	return e.StatusCode == ErrChecksum
+}
+
 // IsProtocolError returns true if the error is a ProtocolError.
 func IsProtocolError(err error) bool {
 	_, ok := err.(*ProtocolError)
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CommandName returns the name of a bootloader command code, such as
+// "Program Row" for CmdProgramRow, or "command 0xNN" for unknown codes.
+func CommandName(cmd byte) string {
+	switch cmd {
+	case CmdEnterBootloader:
+		return "Enter Bootloader"
+	case CmdGetFlashSize:
+		return "Get Flash Size"
+	case CmdProgramRow:
+		return "Program Row"
+	case CmdEraseRow:
+		return "Erase Row"
+	case CmdVerifyRow:
+		return "Verify Row"
+	case CmdVerifyChecksum:
+		return "Verify Checksum"
+	case CmdSendData:
+		return "Send Data"
+	case CmdSyncBootloader:
+		return "Sync Bootloader"
+	case CmdExitBootloader:
+		return "Exit Bootloader"
+	case CmdGetMetadata:
+		return "Get Metadata"
+	case CmdGetAppStatus:
+		return "Get App Status"
+	case CmdSetActiveApp:
+		return "Set Active App"
+	case CmdEraseData:
+		return "Erase Data"
+	case CmdProgramData:
+		return "Program Data"
+	case CmdVerifyData:
+		return "Verify Data"
+	case CmdSetAppMetadata:
+		return "Set App Metadata"
+	case CmdSetEIV:
+		return "Set EIV"
+	default:
+		return fmt.Sprintf("command 0x%02X", cmd)
+	}
+}
+
+// StatusName returns a human-readable name for a response status code,
+// such as "checksum mismatch" for ErrChecksum.
+func StatusName(code byte) string {
+	return getStatusName(code)
+}
+
+// FormatFrame describes a command or response frame for debug logs: the
+// command name or response status, the data length, and whether the packet
+// checksum (of checksumType) is valid. Frames are told apart by their second
+// byte: status codes are all below the lowest command code. The frame data
+// itself is not included, so the result never contains key material.
+//
+// Example:
+//
+//	fmt.Println(protocol.FormatFrame(frame, protocol.ChecksumBasicSum))
+//	// Output: Send Data (0x37) len=57 checksum=ok
+func FormatFrame(frame []byte, checksumType byte) string {
+	if len(frame) < MinFrameSize || frame[0] != StartOfPacket {
+		return fmt.Sprintf("malformed frame (%d bytes)", len(frame))
+	}
+
+	code := frame[1]
+	var name string
+	if code < CmdVerifyChecksum {
+		name = "status " + StatusName(code)
+	} else {
+		name = CommandName(code)
+	}
+
+	dataLen := int(binary.LittleEndian.Uint16(frame[2:4]))
+	if len(frame) != MinFrameSize+dataLen || frame[len(frame)-1] != EndOfPacket {
+		return fmt.Sprintf("%s (0x%02X) len=%d malformed (%d bytes)", name, code, dataLen, len(frame))
+	}
+
+	checksum := "ok"
+	got := binary.LittleEndian.Uint16(frame[len(frame)-3:])
+	if want := PacketChecksum(frame[:len(frame)-3], checksumType); got != want {
+		checksum = fmt.Sprintf("bad (0x%04X, want 0x%04X)", got, want)
+	}
+
+	return fmt.Sprintf("%s (0x%02X) len=%d checksum=%s", name, code, dataLen, checksum)
+}
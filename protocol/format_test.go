@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandName(t *testing.T) {
+	if got := CommandName(CmdProgramRow); got != "Program Row" {
+		t.Errorf("CommandName(CmdProgramRow) = %q", got)
+	}
+	if got := CommandName(0x50); got != "command 0x50" {
+		t.Errorf("CommandName(0x50) = %q", got)
+	}
+	if got := StatusName(ErrChecksum); got != "checksum mismatch" {
+		t.Errorf("StatusName(ErrChecksum) = %q", got)
+	}
+}
+
+func TestFormatFrame(t *testing.T) {
+	sendData, err := BuildSendDataCmd([]byte{0x01, 0x02, 0x03})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte{0x0A, 0x1B, 0x2C, 0x3D, 0x4E, 0x5F}
+	enter, err := BuildEnterBootloaderCmd(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := []byte{StartOfPacket, ErrRow, 0x00, 0x00, 0xF5, 0xFF, EndOfPacket}
+	corrupt := append([]byte(nil), sendData...)
+	corrupt[len(corrupt)-2] ^= 0xFF
+
+	tests := []struct {
+		name         string
+		frame        []byte
+		checksumType byte
+		want         string
+	}{
+		{"command", sendData, ChecksumBasicSum, "Send Data (0x37) len=3 checksum=ok"},
+		{"response", response, ChecksumBasicSum, "status invalid row number (0x0A) len=0 checksum=ok"},
+		{"wrong checksum type", sendData, ChecksumCRC16, "Send Data (0x37) len=3 checksum=bad"},
+		{"corrupt checksum", corrupt, ChecksumBasicSum, "Send Data (0x37) len=3 checksum=bad"},
+		{"truncated", sendData[:5], ChecksumBasicSum, "malformed frame (5 bytes)"},
+		{"length mismatch", append(sendData[:len(sendData):len(sendData)], 0x00), ChecksumBasicSum, "Send Data (0x37) len=3 malformed (11 bytes)"},
+		{"enter bootloader", enter, ChecksumBasicSum, "Enter Bootloader (0x38) len=6 checksum=ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatFrame(tt.frame, tt.checksumType)
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("FormatFrame() = %q, want prefix %q", got, tt.want)
+			}
+		})
+	}
+}
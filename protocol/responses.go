@@ -14,16 +14,22 @@ import (
 //
 // Returns the status code, data payload, and any validation error.
 func ParseResponse(frame []byte) (statusCode byte, data []byte, err error) {
+	return ParseResponseWithChecksum(frame, ChecksumBasicSum)
+}
+
+// ParseResponseWithChecksum is like ParseResponse but validates the frame checksum
+// with the given checksum type (ChecksumBasicSum or ChecksumCRC16).
+func ParseResponseWithChecksum(frame []byte, checksumType byte) (statusCode byte, data []byte, err error) {
 	if len(frame) < MinFrameSize {
-		return 0, nil, fmt.Errorf("frame too short: got %d bytes, minimum is %d", len(frame), MinFrameSize)
+		return 0, nil, frameError("frame too short: got %d bytes, minimum is %d", len(frame), MinFrameSize)
 	}
 
 	if frame[0] != StartOfPacket {
-		return 0, nil, fmt.Errorf("invalid start of packet: got 0x%02X, expected 0x%02X", frame[0], StartOfPacket)
+		return 0, nil, frameError("invalid start of packet: got 0x%02X, expected 0x%02X", frame[0], StartOfPacket)
 	}
 
 	if frame[len(frame)-1] != EndOfPacket {
-		return 0, nil, fmt.Errorf("invalid end of packet: got 0x%02X, expected 0x%02X", frame[len(frame)-1], EndOfPacket)
+		return 0, nil, frameError("invalid end of packet: got 0x%02X, expected 0x%02X", frame[len(frame)-1], EndOfPacket)
 	}
 
 	statusCode = frame[1]
@@ -31,16 +37,16 @@ func ParseResponse(frame []byte) (statusCode byte, data []byte, err error) {
 
 	expectedLen := int(MinFrameSize + dataLen)
 	if len(frame) != expectedLen {
-		return 0, nil, fmt.Errorf("frame length mismatch: got %d bytes, expected %d (MinFrameSize=%d + dataLen=%d)",
+		return 0, nil, frameError("frame length mismatch: got %d bytes, expected %d (MinFrameSize=%d + dataLen=%d)",
 			len(frame), expectedLen, MinFrameSize, dataLen)
 	}
 
 	// Verify checksum
 	checksumExpected := binary.LittleEndian.Uint16(frame[len(frame)-3 : len(frame)-1])
-	checksumActual := calculatePacketChecksum(frame[0 : len(frame)-3])
+	checksumActual := PacketChecksum(frame[0:len(frame)-3], checksumType)
 
 	if checksumExpected != checksumActual {
-		return 0, nil, fmt.Errorf("checksum mismatch: got 0x%04X, expected 0x%04X",
+		return 0, nil, frameError("checksum mismatch: got 0x%04X, expected 0x%04X",
 			checksumActual, checksumExpected)
 	}
 
@@ -451,3 +451,26 @@ func BenchmarkParseResponse(b *testing.B) {
 		_, _, _ = ParseResponse(frame)
 	}
 }
+
+func TestParseResponseWithChecksum(t *testing.T) {
+	frame, _ := BuildCommand(StatusSuccess, []byte{0x01, 0x02})
+	if err := SetPacketChecksum(frame, ChecksumCRC16); err != nil {
+		t.Fatalf("SetPacketChecksum: %v", err)
+	}
+
+	status, data, err := ParseResponseWithChecksum(frame, ChecksumCRC16)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != StatusSuccess || !bytes.Equal(data, []byte{0x01, 0x02}) {
+		t.Errorf("status = 0x%02X, data = % 02X", status, data)
+	}
+
+	if _, _, err := ParseResponse(frame); err == nil {
+		t.Error("expected checksum error parsing a CRC-16 frame as basic sum")
+	}
+
+	if err := SetPacketChecksum([]byte{0x01}, ChecksumCRC16); err == nil {
+		t.Error("expected error for short frame")
+	}
+}
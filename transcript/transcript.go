@@ -0,0 +1,323 @@
+// Package transcript renders recorded bootloader sessions as annotated
+// conversation logs for support tickets: every frame on its own line with a
+// timestamp, the command name or response status, the decoded fields, the
+// response time, and notes for retried commands and commands that got no
+// answer. Where protocol.FormatFrame and protocol.DecodeFields describe one
+// frame, a transcript follows the whole exchange.
+//
+// Sessions are recorded with bootloader.WithCapture and read back with
+// ReadCapture.
+//
+// Example:
+//
+//	f, _ := os.Open("session.pcapng")
+//	entries, err := transcript.ReadCapture(f)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	transcript.Render(os.Stdout, entries, transcript.Options{})
+//
+// prints
+//
+//	Transcript of 4 frames, 2024-03-01 14:15:07.000000 UTC to 14:15:07.004210 (4.21ms)
+//
+//	14:15:07.000000  >  Enter Bootloader (0x38) len=6 checksum=ok
+//	                      key: FF FF FF FF FF FF
+//	14:15:07.001150  <  status success (0x00) len=8 checksum=ok  [1.15ms]
+//	                      silicon ID: 0x1E9602AA
+//	...
+//
+//	2 commands, 2 responses, 0 error statuses, 0 retries, 0 unanswered
+package transcript
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+// Entry is one frame of a recorded session.
+type Entry struct {
+	// Time is when the frame was sent or received
+	Time time.Time
+
+	// Device names the device the frame was exchanged with, for transcripts
+	// of several devices (empty if there is only one)
+	Device string
+
+	// Frame is the command or response frame. Commands and responses are
+	// told apart by their second byte, as in protocol.FormatFrame.
+	Frame []byte
+}
+
+// ReadCapture reads the frames of a pcapng capture written by
+// bootloader.WithCapture, naming each entry's device after the capture
+// interface it was recorded on.
+func ReadCapture(r io.Reader) ([]Entry, error) {
+	cr, err := pcapng.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, Entry{Time: rec.Time, Device: rec.Interface, Frame: rec.Data})
+	}
+}
+
+// Options configures Render.
+type Options struct {
+	// ChecksumType is the packet checksum type of the bootloader, used to
+	// check frame checksums. Default is protocol.ChecksumBasicSum.
+	ChecksumType byte
+
+	// Bytes adds the raw bytes of every frame (with any key redacted).
+	// Default is false.
+	Bytes bool
+
+	// Location is the time zone of the timestamps. Default is time.Local.
+	Location *time.Location
+}
+
+// Summary counts the events of a transcript. Returned by Render.
+type Summary struct {
+	// Commands is the number of command frames
+	Commands int
+
+	// Responses is the number of response frames
+	Responses int
+
+	// ErrorStatuses is the number of responses with a status other than success
+	ErrorStatuses int
+
+	// BadChecksums is the number of frames whose packet checksum is invalid
+	BadChecksums int
+
+	// Retries is the number of commands repeating one sent before a failure
+	Retries int
+
+	// Unanswered is the number of commands that got no response (Exit
+	// Bootloader and Sync Bootloader, which often get none, are not counted)
+	Unanswered int
+}
+
+// Render writes the transcript of entries to w, in the order given, and
+// returns its summary.
+//
+// A command is marked as a retry when the same frame was sent before and an
+// exchange of the same device failed in between (an error status, a bad
+// checksum, or no response). A command is unanswered when the device's next
+// frame is another command, except for the Send Data and Program Row frames
+// of a pipelined row.
+func Render(w io.Writer, entries []Entry, opts Options) (*Summary, error) {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	r := &renderer{
+		w:       w,
+		opts:    opts,
+		summary: &Summary{},
+		devices: make(map[string]*deviceState),
+	}
+	for _, e := range entries {
+		if len(e.Device) > r.deviceWidth {
+			r.deviceWidth = len(e.Device)
+		}
+		if _, ok := r.devices[e.Device]; !ok {
+			r.devices[e.Device] = &deviceState{sent: make(map[string]int), lastFailure: -1}
+		}
+	}
+	if len(r.devices) < 2 {
+		r.deviceWidth = 0
+	}
+
+	r.header(entries)
+	for i, e := range entries {
+		r.entry(i, e)
+	}
+	if len(entries) > 0 {
+		r.printf("\n")
+	}
+	s := r.summary
+	r.printf("%d commands, %d responses, %d error statuses, %d retries, %d unanswered\n",
+		s.Commands, s.Responses, s.ErrorStatuses, s.Retries, s.Unanswered)
+	if s.BadChecksums > 0 {
+		r.printf("%d frames with bad checksums\n", s.BadChecksums)
+	}
+	return s, r.err
+}
+
+// pendingCommand is a command awaiting its response.
+type pendingCommand struct {
+	code  byte
+	index int
+	time  time.Time
+}
+
+// deviceState tracks the exchange with one device.
+type deviceState struct {
+	pending []pendingCommand
+
+	// sent maps each command frame to the index it was last sent at
+	sent map[string]int
+
+	// lastFailure is the index of the last failed exchange (-1 if none)
+	lastFailure int
+
+	// retries counts the retries of each command frame
+	retries map[string]int
+}
+
+// renderer writes one transcript, keeping the first write error.
+type renderer struct {
+	w           io.Writer
+	opts        Options
+	summary     *Summary
+	devices     map[string]*deviceState
+	deviceWidth int
+	err         error
+}
+
+func (r *renderer) printf(format string, args ...interface{}) {
+	if r.err != nil {
+		return
+	}
+	_, r.err = fmt.Fprintf(r.w, format, args...)
+}
+
+func (r *renderer) header(entries []Entry) {
+	if len(entries) == 0 {
+		r.printf("Empty transcript\n\n")
+		return
+	}
+	first, last := entries[0].Time, entries[len(entries)-1].Time
+	r.printf("Transcript of %d frames, %s to %s (%s)\n\n", len(entries),
+		first.In(r.opts.Location).Format("2006-01-02 15:04:05.000000 MST"),
+		last.In(r.opts.Location).Format("15:04:05.000000"), formatDuration(last.Sub(first)))
+}
+
+// line writes a line with the timestamp, device, and marker columns.
+func (r *renderer) line(t time.Time, device, marker, text string) {
+	if r.deviceWidth > 0 {
+		r.printf("%s  %-*s  %s  %s\n", t.In(r.opts.Location).Format("15:04:05.000000"), r.deviceWidth, device, marker, text)
+		return
+	}
+	r.printf("%s  %s  %s\n", t.In(r.opts.Location).Format("15:04:05.000000"), marker, text)
+}
+
+// detail writes an indented line under the last frame.
+func (r *renderer) detail(text string) {
+	indent := len("15:04:05.000000") + 6
+	if r.deviceWidth > 0 {
+		indent += r.deviceWidth + 2
+	}
+	r.printf("%*s%s\n", indent, "", text)
+}
+
+func (r *renderer) entry(index int, e Entry) {
+	dev := r.devices[e.Device]
+	frame := e.Frame
+	if len(frame) < protocol.MinFrameSize || frame[0] != protocol.StartOfPacket {
+		r.line(e.Time, e.Device, "?", protocol.FormatFrame(frame, r.opts.ChecksumType))
+		return
+	}
+
+	code := frame[1]
+	checksumOK := binary.LittleEndian.Uint16(frame[len(frame)-3:]) == protocol.PacketChecksum(frame[:len(frame)-3], r.opts.ChecksumType)
+	if !checksumOK {
+		r.summary.BadChecksums++
+	}
+
+	var command byte
+	var note string
+	if code < protocol.CmdVerifyChecksum {
+		r.summary.Responses++
+		if len(dev.pending) > 0 {
+			cmd := dev.pending[0]
+			dev.pending = dev.pending[1:]
+			command = cmd.code
+			note = "  [" + formatDuration(e.Time.Sub(cmd.time)) + "]"
+		}
+		if code != protocol.StatusSuccess {
+			r.summary.ErrorStatuses++
+		}
+		if code != protocol.StatusSuccess || !checksumOK {
+			dev.lastFailure = index
+		}
+		r.line(e.Time, e.Device, "<", protocol.FormatFrame(frame, r.opts.ChecksumType)+note)
+	} else {
+		r.summary.Commands++
+		r.flushUnanswered(index, e, dev, code)
+
+		key := string(frame)
+		if last, ok := dev.sent[key]; ok && dev.lastFailure > last {
+			if dev.retries == nil {
+				dev.retries = make(map[string]int)
+			}
+			dev.retries[key]++
+			r.summary.Retries++
+			note = fmt.Sprintf("  [retry %d]", dev.retries[key])
+		}
+		dev.sent[key] = index
+		dev.pending = append(dev.pending, pendingCommand{code: code, index: index, time: e.Time})
+		r.line(e.Time, e.Device, ">", protocol.FormatFrame(frame, r.opts.ChecksumType)+note)
+	}
+
+	for _, f := range protocol.DecodeFields(frame, command) {
+		r.detail(f.Name + ": " + f.Value)
+	}
+	if r.opts.Bytes {
+		r.detail(fmt.Sprintf("bytes: % X", protocol.RedactFrame(frame)))
+	}
+}
+
+// flushUnanswered reports the pending commands of dev as unanswered when the
+// command code is sent, unless they are part of the same pipelined row.
+func (r *renderer) flushUnanswered(index int, e Entry, dev *deviceState, code byte) {
+	if len(dev.pending) == 0 {
+		return
+	}
+	if code == protocol.CmdSendData || code == protocol.CmdProgramRow {
+		pipelined := true
+		for _, cmd := range dev.pending {
+			pipelined = pipelined && cmd.code == protocol.CmdSendData
+		}
+		if pipelined {
+			return
+		}
+	}
+
+	for _, cmd := range dev.pending {
+		if cmd.code == protocol.CmdExitBootloader || cmd.code == protocol.CmdSyncBootloader {
+			continue
+		}
+		r.summary.Unanswered++
+		dev.lastFailure = index
+		r.line(e.Time, e.Device, "!", fmt.Sprintf("no response to %s (0x%02X) within %s",
+			protocol.CommandName(cmd.code), cmd.code, formatDuration(e.Time.Sub(cmd.time))))
+	}
+	dev.pending = dev.pending[:0]
+}
+
+// formatDuration formats d with a precision that suits its magnitude.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
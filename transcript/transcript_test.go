@@ -0,0 +1,102 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moffa90/go-cyacd/bootloader"
+	"github.com/moffa90/go-cyacd/bootloadertest"
+	"github.com/moffa90/go-cyacd/cyacd"
+	"github.com/moffa90/go-cyacd/pcapng"
+	"github.com/moffa90/go-cyacd/protocol"
+)
+
+func TestRender(t *testing.T) {
+	fw := &cyacd.Firmware{SiliconID: bootloadertest.DefaultSiliconID}
+	for i := 0; i < 2; i++ {
+		data := []byte{byte(i), 0x11, 0x22, 0x33}
+		fw.Rows = append(fw.Rows, &cyacd.Row{RowNum: uint16(0x10 + i), Size: uint16(len(data)), Data: data, Checksum: protocol.CalculateRowChecksum(data)})
+	}
+
+	// Record a session in which Verify Row of row 0x11 goes unanswered once
+	var capture bytes.Buffer
+	cw, err := pcapng.NewWriter(&capture, pcapng.LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := bootloadertest.NewDevice(bootloadertest.WithFault(bootloadertest.Fault{
+		Kind:    bootloadertest.FaultDropFrame,
+		Command: protocol.CmdVerifyRow,
+		Row:     &bootloadertest.RowAddress{ArrayID: 0, RowNum: 0x11},
+	}))
+	prog := bootloader.New(device, bootloader.WithCapture(cw), bootloader.WithReadTimeout(20*time.Millisecond))
+	if err := prog.Program(context.Background(), fw, []byte(protocol.DefaultExampleKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadCapture(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	summary, err := Render(&out, entries, Options{Location: time.UTC, Bytes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+
+	if summary.Unanswered != 1 || summary.Retries == 0 || summary.ErrorStatuses != 0 || summary.BadChecksums != 0 {
+		t.Errorf("summary %+v\n%s", summary, text)
+	}
+	if summary.Commands != len(device.Commands())+1 {
+		t.Errorf("%d commands in the transcript, the device executed %d and dropped 1", summary.Commands, len(device.Commands()))
+	}
+	for _, want := range []string{
+		"Transcript of ",
+		">  Enter Bootloader (0x38) len=6 checksum=ok",
+		"key: FF FF FF FF FF FF",
+		"<  status success (0x00) len=8 checksum=ok  [",
+		"silicon ID: 0x1E9602AA",
+		"!  no response to Verify Row (0x3A) within ",
+		"[retry 1]",
+		"bytes: 01 38 06 00 FF FF FF FF FF FF",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("transcript has no %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestRenderDevices(t *testing.T) {
+	at := time.Date(2024, 3, 1, 14, 15, 7, 0, time.UTC)
+	enter, _ := protocol.BuildCommand(protocol.CmdEnterBootloader, nil)
+	errFrame, _ := protocol.BuildCommand(protocol.ErrKey, nil)
+	entries := []Entry{
+		{Time: at, Device: "SN-1", Frame: enter},
+		{Time: at, Device: "SN-22", Frame: enter},
+		{Time: at.Add(time.Millisecond), Device: "SN-22", Frame: errFrame},
+		{Time: at.Add(2 * time.Millisecond), Device: "SN-1", Frame: errFrame},
+	}
+	var out bytes.Buffer
+	summary, err := Render(&out, entries, Options{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ErrorStatuses != 2 || summary.Unanswered != 0 {
+		t.Errorf("summary %+v", summary)
+	}
+	want := "Transcript of 4 frames, 2024-03-01 14:15:07.000000 UTC to 14:15:07.002000 (2ms)\n" +
+		"\n" +
+		"14:15:07.000000  SN-1   >  Enter Bootloader (0x38) len=0 checksum=ok\n" +
+		"14:15:07.000000  SN-22  >  Enter Bootloader (0x38) len=0 checksum=ok\n" +
+		"14:15:07.001000  SN-22  <  status " + protocol.StatusName(protocol.ErrKey) + " (0x06) len=0 checksum=ok  [1ms]\n" +
+		"14:15:07.002000  SN-1   <  status " + protocol.StatusName(protocol.ErrKey) + " (0x06) len=0 checksum=ok  [2ms]\n" +
+		"\n" +
+		"2 commands, 2 responses, 2 error statuses, 0 retries, 0 unanswered\n"
+	if out.String() != want {
+		t.Errorf("transcript =\n%s\nwant\n%s", out.String(), want)
+	}
+}